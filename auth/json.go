@@ -18,6 +18,9 @@ type jsonCred struct {
 	Password  string `json:"password"`
 	Username  string `json:"username"`
 	ReCaptcha string `json:"recaptcha"`
+	// OTP is the code of the second factor, or one of the recovery codes,
+	// of the users who set it up.
+	OTP string `json:"otp"`
 }
 
 // JSONAuth is a json implementation of an Auther.
@@ -25,8 +28,9 @@ type JSONAuth struct {
 	ReCaptcha *ReCaptcha `json:"recaptcha" yaml:"recaptcha"`
 }
 
-// Auth authenticates the user via a json in content body.
-func (a JSONAuth) Auth(r *http.Request, usr users.Store, _ *settings.Settings, srv *settings.Server) (*users.User, error) {
+// Auth authenticates the user via a json in content body, checking their
+// second factor if they have one.
+func (a JSONAuth) Auth(r *http.Request, usr users.Store, stg *settings.Settings, srv *settings.Server) (*users.User, error) {
 	var cred jsonCred
 
 	if r.Body == nil {
@@ -56,6 +60,10 @@ func (a JSONAuth) Auth(r *http.Request, usr users.Store, _ *settings.Settings, s
 		return nil, os.ErrPermission
 	}
 
+	if err := CheckTOTP(u, usr, stg, cred.OTP); err != nil {
+		return nil, err
+	}
+
 	return u, nil
 }
 
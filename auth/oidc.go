@@ -0,0 +1,361 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// MethodOIDC is used to identify the OpenID Connect auth.
+const MethodOIDC settings.AuthMethod = "oidc"
+
+// OIDCStateCookie keeps the state of a login while the user is at the
+// provider.
+const OIDCStateCookie = "oidc_state"
+
+// OIDCTimeout is how long the users have to log in at the provider.
+const OIDCTimeout = 10 * time.Minute
+
+// OIDCClaims tells which claims of the ID token fill the fields of the
+// users.
+type OIDCClaims struct {
+	// Username is preferred_username if empty.
+	Username string `json:"username"`
+	// Locale is the claim of the language of the user, which is kept if
+	// empty.
+	Locale string `json:"locale"`
+	// Groups is the claim listing the groups of the user. Being in one of
+	// the AdminGroups makes the user an admin, and being in none of them
+	// removes it.
+	Groups      string   `json:"groups"`
+	AdminGroups []string `json:"adminGroups"`
+}
+
+// OIDCAuth logs the users in with an OpenID Connect provider. The users
+// that don't exist yet get the default settings if AutoProvision is set.
+type OIDCAuth struct {
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"clientID"`
+	ClientSecret string `json:"clientSecret"`
+	// RedirectURL is the callback of the login, the address of the server
+	// followed by /api/login/oidc/callback.
+	RedirectURL string `json:"redirectURL"`
+	// Scopes are asked in addition to openid, profile and email.
+	Scopes        []string   `json:"scopes"`
+	Claims        OIDCClaims `json:"claims"`
+	AutoProvision bool       `json:"autoProvision"`
+}
+
+type oidcState struct {
+	Nonce   string `json:"nonce"`
+	Expires int64  `json:"expires"`
+}
+
+// AuthCodeURL returns the address of the provider to send the user to, and
+// the state to keep in the OIDCStateCookie until the callback.
+func (a *OIDCAuth) AuthCodeURL(r *http.Request, stg *settings.Settings) (url, state string, err error) {
+	config, _, err := a.config(r)
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce := make([]byte, 24) //nolint:gomnd
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", err
+	}
+
+	state, err = sealOIDCState(stg.Key, &oidcState{
+		Nonce:   base64.RawURLEncoding.EncodeToString(nonce),
+		Expires: time.Now().Add(OIDCTimeout).Unix(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	nonceOpt := oidc.Nonce(base64.RawURLEncoding.EncodeToString(nonce))
+	return config.AuthCodeURL(state, nonceOpt), state, nil
+}
+
+// Auth handles the callback of the provider, checking the ID token it
+// issued for the code of the request.
+func (a *OIDCAuth) Auth(r *http.Request, usr users.Store, stg *settings.Settings, srv *settings.Server) (*users.User, error) {
+	cookie, err := r.Cookie(OIDCStateCookie)
+	if err != nil || !hmac.Equal([]byte(cookie.Value), []byte(r.URL.Query().Get("state"))) {
+		return nil, os.ErrPermission
+	}
+
+	state, err := openOIDCState(stg.Key, cookie.Value)
+	if err != nil || time.Now().Unix() > state.Expires {
+		return nil, os.ErrPermission
+	}
+
+	if msg := r.URL.Query().Get("error"); msg != "" {
+		return nil, fmt.Errorf("%w: the provider returned %s", os.ErrPermission, msg)
+	}
+
+	config, provider, err := a.config(r)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := config.Exchange(r.Context(), r.URL.Query().Get("code"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", os.ErrPermission, err) //nolint:errorlint
+	}
+
+	rawID, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: no id_token in the response of the provider", os.ErrPermission)
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: a.ClientID}).Verify(r.Context(), rawID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", os.ErrPermission, err) //nolint:errorlint
+	}
+	if !hmac.Equal([]byte(idToken.Nonce), []byte(state.Nonce)) {
+		return nil, os.ErrPermission
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	return a.user(idToken.Issuer, claims, usr, stg, srv)
+}
+
+// LoginPage tells that the OIDC auth requires a login page, to send the
+// users to the provider.
+func (a *OIDCAuth) LoginPage() bool {
+	return true
+}
+
+// oidcProviders are the providers discovered, by issuer, the discovery
+// running once for the logins of an issuer.
+var oidcProviders = struct {
+	sync.Mutex
+	byIssuer map[string]*oidc.Provider
+}{byIssuer: map[string]*oidc.Provider{}}
+
+// provider returns the provider of the issuer, discovering it on its first
+// login. The failed discoveries are tried again on the next one.
+func (a *OIDCAuth) provider(r *http.Request) (*oidc.Provider, error) {
+	oidcProviders.Lock()
+	defer oidcProviders.Unlock()
+
+	if provider, ok := oidcProviders.byIssuer[a.Issuer]; ok {
+		return provider, nil
+	}
+	provider, err := oidc.NewProvider(r.Context(), a.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	oidcProviders.byIssuer[a.Issuer] = provider
+	return provider, nil
+}
+
+func (a *OIDCAuth) config(r *http.Request) (*oauth2.Config, *oidc.Provider, error) {
+	provider, err := a.provider(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scopes := append([]string{oidc.ScopeOpenID, "profile", "email"}, a.Scopes...)
+	return &oauth2.Config{
+		ClientID:     a.ClientID,
+		ClientSecret: a.ClientSecret,
+		RedirectURL:  a.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}, provider, nil
+}
+
+// OIDCSubject returns the OIDCSubject of the users of an issuer and of the
+// subject of its ID tokens.
+func OIDCSubject(issuer, subject string) string {
+	return issuer + " " + subject
+}
+
+// user returns the user of the claims of an ID token, creating it if it
+// doesn't exist yet and updating the fields mapped to the claims. The users
+// are the ones of the issuer and the subject of the token, the username
+// claim, which the users of the provider may change, only naming the users
+// provisioned. The existing users without this identity aren't linked to
+// it, an admin setting their OIDCSubject to let them log in.
+func (a *OIDCAuth) user(issuer string, claims map[string]interface{}, usr users.Store, stg *settings.Settings, srv *settings.Server) (*users.User, error) {
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, fmt.Errorf("%w: no sub claim in the id token", os.ErrPermission)
+	}
+	subject := OIDCSubject(issuer, sub)
+
+	u, err := userBySubject(subject, usr, srv)
+	if err != nil {
+		return nil, err
+	}
+
+	if u == nil {
+		usernameClaim := a.Claims.Username
+		if usernameClaim == "" {
+			usernameClaim = "preferred_username"
+		}
+		username, _ := claims[usernameClaim].(string)
+		if username == "" {
+			return nil, fmt.Errorf("%w: no %s claim in the id token", os.ErrPermission, usernameClaim)
+		}
+
+		if _, err := usr.Get(srv.Root, username); err == nil {
+			return nil, fmt.Errorf("%w: the user %s isn't linked to the identity of the provider", os.ErrPermission, username)
+		} else if !errors.Is(err, fbErrors.ErrNotExist) {
+			return nil, err
+		}
+		if !a.AutoProvision {
+			return nil, os.ErrPermission
+		}
+		if u, err = a.provision(username, subject, usr, stg, srv); err != nil {
+			return nil, err
+		}
+	}
+
+	fields := []string{}
+	if locale, _ := claims[a.Claims.Locale].(string); a.Claims.Locale != "" && locale != "" && locale != u.Locale {
+		u.Locale = locale
+		fields = append(fields, "Locale")
+	}
+	if a.Claims.Groups != "" {
+		if admin := a.isAdmin(claims); admin != u.Perm.Admin {
+			u.Perm.Admin = admin
+			fields = append(fields, "Perm")
+		}
+	}
+
+	if len(fields) > 0 {
+		if err := usr.Update(u, fields...); err != nil {
+			return nil, err
+		}
+	}
+
+	return u, nil
+}
+
+// userBySubject returns the user of an OIDCSubject, nil if there is none.
+func userBySubject(subject string, usr users.Store, srv *settings.Server) (*users.User, error) {
+	all, err := usr.Gets(srv.Root)
+	if err != nil && !errors.Is(err, fbErrors.ErrNotExist) {
+		return nil, err
+	}
+	for _, u := range all {
+		if u.OIDCSubject == subject {
+			return u, nil
+		}
+	}
+	return nil, nil
+}
+
+// provision creates a user of an identity with the default settings. Its
+// password is random and locked, the user logging in through the provider.
+func (a *OIDCAuth) provision(username, subject string, usr users.Store, stg *settings.Settings, srv *settings.Server) (*users.User, error) {
+	pwd := make([]byte, 32) //nolint:gomnd
+	if _, err := rand.Read(pwd); err != nil {
+		return nil, err
+	}
+	hash, err := users.HashPwd(base64.RawStdEncoding.EncodeToString(pwd))
+	if err != nil {
+		return nil, err
+	}
+
+	u := &users.User{
+		Username:     username,
+		Password:     hash,
+		LockPassword: true,
+		OIDCSubject:  subject,
+	}
+	stg.Defaults.Apply(u)
+
+	userHome, err := stg.MakeUserDir(u.Username, u.Scope, srv.Root)
+	if err != nil {
+		return nil, fmt.Errorf("user: failed to mkdir user home dir: [%s]", userHome)
+	}
+	u.Scope = userHome
+
+	if err := usr.Save(u); err != nil {
+		return nil, err
+	}
+
+	return usr.Get(srv.Root, username)
+}
+
+func (a *OIDCAuth) isAdmin(claims map[string]interface{}) bool {
+	var groups []string
+	switch v := claims[a.Claims.Groups].(type) {
+	case string:
+		groups = strings.Fields(v)
+	case []interface{}:
+		for _, g := range v {
+			if g, ok := g.(string); ok {
+				groups = append(groups, g)
+			}
+		}
+	}
+
+	for _, g := range groups {
+		for _, admin := range a.Claims.AdminGroups {
+			if g == admin {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sealOIDCState signs a state with the key of the settings, so that it
+// can be checked in the callback without being stored.
+func sealOIDCState(key []byte, state *oidcState) (string, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + oidcStateSignature(key, payload), nil
+}
+
+func openOIDCState(key []byte, signed string) (*oidcState, error) {
+	payload, signature, ok := strings.Cut(signed, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(oidcStateSignature(key, payload))) {
+		return nil, errors.New("invalid oidc state")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var state oidcState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func oidcStateSignature(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("oidc state\x00" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
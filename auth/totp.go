@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+var (
+	// ErrTOTPRequired is returned when the password of a user is right but
+	// the code of their second factor is missing.
+	ErrTOTPRequired = errors.New("two-factor code required")
+	// ErrTOTPEnrollment is returned when two-factor authentication is
+	// enforced and the user hasn't set it up yet.
+	ErrTOTPEnrollment = errors.New("two-factor authentication must be set up")
+)
+
+// TOTPEnrollment is what the user needs to add the second factor to their
+// authenticator app. The recovery codes are only shown once.
+type TOTPEnrollment struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"uri"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// EnrollTOTP generates a new secret and recovery codes for a user, replacing
+// the previous ones. The second factor is only enabled once ConfirmTOTP
+// checks a code of the new secret.
+func EnrollTOTP(u *users.User, usr users.Store, stg *settings.Settings) (*TOTPEnrollment, error) {
+	secret, err := users.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := users.EncryptTOTPSecret(stg.Key, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := users.NewRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	u.TOTP = users.TOTP{Secret: encrypted, RecoveryCodes: hashes}
+	if err := usr.Update(u, "TOTP"); err != nil {
+		return nil, err
+	}
+
+	issuer := stg.Branding.Name
+	if issuer == "" {
+		issuer = "File Browser"
+	}
+
+	return &TOTPEnrollment{
+		Secret:        secret,
+		URI:           users.TOTPURI(issuer, u.Username, secret),
+		RecoveryCodes: codes,
+	}, nil
+}
+
+// ConfirmTOTP enables the second factor of a user enrolled with EnrollTOTP
+// if the code matches its secret.
+func ConfirmTOTP(u *users.User, usr users.Store, stg *settings.Settings, code string) error {
+	if u.TOTP.Secret == "" {
+		return ErrTOTPEnrollment
+	}
+
+	if !checkTOTPCode(u, stg, code) {
+		return os.ErrPermission
+	}
+
+	u.TOTP.Enabled = true
+	return usr.Update(u, "TOTP")
+}
+
+// CheckTOTP checks the second factor of a user whose password is right. The
+// code is either one of their authenticator app, which can't be used twice,
+// or one of their recovery codes. The users without a second factor pass
+// unless it is enforced by the settings, in which case their login confirms
+// a pending enrollment.
+func CheckTOTP(u *users.User, usr users.Store, stg *settings.Settings, code string) error {
+	if !u.TOTP.Enabled {
+		if !stg.EnforceTOTP {
+			return nil
+		}
+		if u.TOTP.Secret == "" || code == "" {
+			return ErrTOTPEnrollment
+		}
+		return ConfirmTOTP(u, usr, stg, code)
+	}
+
+	if code == "" {
+		return ErrTOTPRequired
+	}
+
+	if checkTOTPCode(u, stg, code) {
+		return usr.Update(u, "TOTP")
+	}
+
+	if u.TOTP.UseRecoveryCode(code) {
+		return usr.Update(u, "TOTP")
+	}
+
+	return os.ErrPermission
+}
+
+// checkTOTPCode checks a code of the authenticator app, recording its time
+// step so that it can't be replayed.
+func checkTOTPCode(u *users.User, stg *settings.Settings, code string) bool {
+	secret, err := users.DecryptTOTPSecret(stg.Key, u.TOTP.Secret)
+	if err != nil {
+		return false
+	}
+
+	step, ok := users.CheckTOTP(secret, code, time.Now())
+	if !ok || step <= u.TOTP.LastStep {
+		return false
+	}
+
+	u.TOTP.LastStep = step
+	return true
+}
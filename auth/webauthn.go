@@ -0,0 +1,313 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// MethodWebAuthn is used to identify the WebAuthn auth.
+const MethodWebAuthn settings.AuthMethod = "webauthn"
+
+// WebAuthnTimeout is how long the users have to complete a passkey
+// registration or login.
+const WebAuthnTimeout = 5 * time.Minute
+
+// ErrWebAuthnNotConfigured is returned when the relying party of the
+// WebAuthn auth isn't set.
+var ErrWebAuthnNotConfigured = errors.New("webauthn auth needs a relying party ID")
+
+// WebAuthnAuth authenticates the users with their passkeys, registered once
+// they are logged in. The ceremonies are stateless: the challenge sent to
+// the browser comes with a session signed with the key of the settings,
+// which the browser sends back with its answer. The login sessions are
+// remembered once used, until they expire, so that they can't be replayed.
+type WebAuthnAuth struct {
+	// RPID is the domain the passkeys are bound to, such as
+	// files.example.com. It can't change once passkeys are registered.
+	RPID string `json:"rpID"`
+	// RPOrigins are the origins allowed to use the passkeys, the https
+	// origin of the RPID if empty.
+	RPOrigins []string `json:"rpOrigins"`
+	// AllowPassword lets the users log in with their password as well, for
+	// the browsers without WebAuthn support or before they register a
+	// passkey.
+	AllowPassword bool `json:"allowPassword"`
+}
+
+type webAuthnCred struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Session and Credential are the signed session returned by
+	// BeginLogin and the assertion of the browser.
+	Session    string          `json:"session"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+// Auth authenticates the user with the assertion of one of their passkeys,
+// or with their password if allowed.
+func (a WebAuthnAuth) Auth(r *http.Request, usr users.Store, stg *settings.Settings, srv *settings.Server) (*users.User, error) {
+	var cred webAuthnCred
+
+	if r.Body == nil {
+		return nil, os.ErrPermission
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&cred); err != nil {
+		return nil, os.ErrPermission
+	}
+
+	u, err := usr.Get(srv.Root, cred.Username)
+	if err != nil {
+		return nil, os.ErrPermission
+	}
+
+	if len(cred.Credential) == 0 {
+		if !a.AllowPassword || !users.CheckPwd(cred.Password, u.Password) {
+			return nil, os.ErrPermission
+		}
+		return u, nil
+	}
+
+	w, err := a.webAuthn()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := openSession(stg.Key, "login", cred.Session)
+	if err != nil {
+		return nil, os.ErrPermission
+	}
+
+	assertion, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(cred.Credential))
+	if err != nil {
+		return nil, os.ErrPermission
+	}
+
+	credential, err := w.ValidateLogin(webAuthnUser{u}, *session, assertion)
+	if err != nil || !useSession(session, time.Now()) {
+		return nil, os.ErrPermission
+	}
+
+	// the sign count detects cloned authenticators, keep it up to date
+	if i := u.PasskeyIndex(credential.ID); i >= 0 {
+		u.Passkeys[i].Credential.Authenticator = credential.Authenticator
+		if err := usr.Update(u, "Passkeys"); err != nil {
+			return nil, err
+		}
+	}
+
+	return u, nil
+}
+
+// LoginPage tells that the WebAuthn auth requires a login page.
+func (a WebAuthnAuth) LoginPage() bool {
+	return true
+}
+
+// BeginLogin starts the login of a user, returning the options for the
+// browser and the signed session to send back to Auth.
+func (a WebAuthnAuth) BeginLogin(u *users.User, stg *settings.Settings) (*protocol.CredentialAssertion, string, error) {
+	if len(u.Passkeys) == 0 {
+		return nil, "", os.ErrPermission
+	}
+
+	w, err := a.webAuthn()
+	if err != nil {
+		return nil, "", err
+	}
+
+	assertion, session, err := w.BeginLogin(webAuthnUser{u})
+	if err != nil {
+		return nil, "", err
+	}
+
+	signed, err := sealSession(stg.Key, "login", session)
+	return assertion, signed, err
+}
+
+// BeginRegistration starts the registration of a passkey for a user,
+// returning the options for the browser and the signed session to send back
+// to FinishRegistration.
+func (a WebAuthnAuth) BeginRegistration(u *users.User, stg *settings.Settings) (*protocol.CredentialCreation, string, error) {
+	w, err := a.webAuthn()
+	if err != nil {
+		return nil, "", err
+	}
+
+	exclude := make([]protocol.CredentialDescriptor, 0, len(u.Passkeys))
+	for _, passkey := range u.Passkeys {
+		exclude = append(exclude, passkey.Credential.Descriptor())
+	}
+
+	creation, session, err := w.BeginRegistration(webAuthnUser{u},
+		webauthn.WithExclusions(exclude),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	signed, err := sealSession(stg.Key, "registration", session)
+	return creation, signed, err
+}
+
+// FinishRegistration checks the answer of the browser to a registration
+// and returns the new passkey of the user, which the caller saves.
+func (a WebAuthnAuth) FinishRegistration(u *users.User, stg *settings.Settings, name, signed string, credential []byte) (*users.Passkey, error) {
+	w, err := a.webAuthn()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := openSession(stg.Key, "registration", signed)
+	if err != nil {
+		return nil, os.ErrPermission
+	}
+
+	creation, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(credential))
+	if err != nil {
+		return nil, os.ErrPermission
+	}
+
+	created, err := w.CreateCredential(webAuthnUser{u}, *session, creation)
+	if err != nil {
+		return nil, os.ErrPermission
+	}
+
+	if strings.TrimSpace(name) == "" {
+		name = "Passkey"
+	}
+	return &users.Passkey{Name: name, Created: time.Now(), Credential: *created}, nil
+}
+
+func (a WebAuthnAuth) webAuthn() (*webauthn.WebAuthn, error) {
+	if a.RPID == "" {
+		return nil, ErrWebAuthnNotConfigured
+	}
+
+	origins := a.RPOrigins
+	if len(origins) == 0 {
+		origins = []string{"https://" + a.RPID}
+	}
+
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: WebAuthnTimeout, TimeoutUVD: WebAuthnTimeout}
+	return webauthn.New(&webauthn.Config{
+		RPID:          a.RPID,
+		RPDisplayName: "File Browser",
+		RPOrigins:     origins,
+		Timeouts:      webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+}
+
+// webAuthnUser implements webauthn.User for a user.
+type webAuthnUser struct {
+	*users.User
+}
+
+func (u webAuthnUser) WebAuthnID() []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(u.ID))
+}
+
+func (u webAuthnUser) WebAuthnName() string {
+	return u.Username
+}
+
+func (u webAuthnUser) WebAuthnDisplayName() string {
+	return u.Username
+}
+
+func (u webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.Passkeys))
+	for _, passkey := range u.Passkeys {
+		credentials = append(credentials, passkey.Credential)
+	}
+	return credentials
+}
+
+func (u webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+// sealSession signs a ceremony session for the given purpose, so that it
+// can be given to the browser and trusted once sent back.
+func sealSession(key []byte, purpose string, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + sessionSignature(key, purpose, payload), nil
+}
+
+// openSession checks the signature of a session returned by sealSession.
+// Its expiration is checked when validating the ceremony.
+func openSession(key []byte, purpose, signed string) (*webauthn.SessionData, error) {
+	payload, signature, ok := strings.Cut(signed, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(sessionSignature(key, purpose, payload))) {
+		return nil, errors.New("invalid webauthn session")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// usedSessions are the expirations of the login sessions used, by
+// challenge.
+var usedSessions = struct {
+	sync.Mutex
+	expires map[string]time.Time
+}{expires: map[string]time.Time{}}
+
+// useSession marks a login session as used, telling if it wasn't already.
+// The sessions are forgotten once they expire, as they can't be used then.
+func useSession(session *webauthn.SessionData, now time.Time) bool {
+	usedSessions.Lock()
+	defer usedSessions.Unlock()
+
+	for challenge, expires := range usedSessions.expires {
+		if now.After(expires) {
+			delete(usedSessions.expires, challenge)
+		}
+	}
+	if _, ok := usedSessions.expires[session.Challenge]; ok {
+		return false
+	}
+
+	expires := session.Expires
+	if expires.IsZero() {
+		expires = now.Add(WebAuthnTimeout)
+	}
+	usedSessions.expires[session.Challenge] = expires
+	return true
+}
+
+func sessionSignature(key []byte, purpose, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("webauthn " + purpose + "\x00" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestWebAuthnSession(t *testing.T) {
+	session := &webauthn.SessionData{Challenge: "challenge", Expires: time.Now().Add(time.Minute)}
+	signed, err := sealSession([]byte("key"), "login", session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err := openSession([]byte("key"), "login", signed)
+	if err != nil || opened.Challenge != "challenge" {
+		t.Fatalf("expected the session back, got %+v and %v", opened, err)
+	}
+
+	payload, signature, _ := strings.Cut(signed, ".")
+	for name, tt := range map[string]struct {
+		key     string
+		purpose string
+		signed  string
+	}{
+		"other key":     {"other", "login", signed},
+		"other purpose": {"key", "registration", signed},
+		"tampered":      {"key", "login", payload + "x." + signature},
+		"unsigned":      {"key", "login", payload},
+	} {
+		if _, err := openSession([]byte(tt.key), tt.purpose, tt.signed); err == nil {
+			t.Errorf("%s: expected the session to be refused", name)
+		}
+	}
+}
+
+func TestWebAuthnUseSession(t *testing.T) {
+	now := time.Now()
+	session := &webauthn.SessionData{Challenge: "used", Expires: now.Add(time.Minute)}
+
+	if !useSession(session, now) {
+		t.Fatal("expected the session to be used")
+	}
+	if useSession(session, now.Add(time.Second)) {
+		t.Error("expected the session not to be used twice")
+	}
+	if !useSession(session, now.Add(2*time.Minute)) {
+		t.Error("expected the expired session to be forgotten")
+	}
+}
+
+func TestWebAuthnAuth(t *testing.T) {
+	hashed, err := users.HashPwd("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usr := &memoryUsers{user: &users.User{ID: 1, Username: "user", Password: hashed}}
+	stg := &settings.Settings{Key: []byte("key")}
+	srv := &settings.Server{}
+
+	login := func(a WebAuthnAuth, body string) error {
+		r := httptest.NewRequest("POST", "/api/login", strings.NewReader(body))
+		_, err := a.Auth(r, usr, stg, srv)
+		return err
+	}
+
+	password := `{"username":"user","password":"secret"}`
+	if err := login(WebAuthnAuth{RPID: "example.com"}, password); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected the password to be refused, got %v", err)
+	}
+	if err := login(WebAuthnAuth{RPID: "example.com", AllowPassword: true}, password); err != nil {
+		t.Errorf("expected the password to be allowed, got %v", err)
+	}
+	if err := login(WebAuthnAuth{AllowPassword: true}, `{"username":"user","password":"wrong"}`); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected a wrong password to be refused, got %v", err)
+	}
+
+	// the sessions of the registrations can't be used to log in
+	signed, err := sealSession(stg.Key, "registration", &webauthn.SessionData{Challenge: "challenge"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertion := `{"username":"user","session":"` + signed + `","credential":{}}`
+	if err := login(WebAuthnAuth{RPID: "example.com"}, assertion); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected the session to be refused, got %v", err)
+	}
+	if err := login(WebAuthnAuth{}, assertion); !errors.Is(err, ErrWebAuthnNotConfigured) {
+		t.Errorf("expected the relying party to be needed, got %v", err)
+	}
+}
+
+// memoryUsers is a users.Store of a single user.
+type memoryUsers struct {
+	user *users.User
+}
+
+func (m *memoryUsers) Get(_ string, id interface{}) (*users.User, error) {
+	if id != m.user.Username && id != m.user.ID {
+		return nil, os.ErrNotExist
+	}
+	return m.user, nil
+}
+
+func (m *memoryUsers) Gets(string) ([]*users.User, error) {
+	return []*users.User{m.user}, nil
+}
+
+func (m *memoryUsers) Update(*users.User, ...string) error {
+	return nil
+}
+
+func (m *memoryUsers) Save(*users.User) error {
+	return nil
+}
+
+func (m *memoryUsers) Delete(interface{}) error {
+	return nil
+}
+
+func (m *memoryUsers) LastUpdate(uint) int64 {
+	return 0
+}
@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/spf13/cobra"
+	bbolt "go.etcd.io/bbolt"
+
+	"github.com/filebrowser/filebrowser/v2/storage/bolt"
+)
+
+// The entries of the backup bundles.
+const (
+	backupBundleDB     = "filebrowser.db"
+	backupBundleConfig = "config.json"
+)
+
+// dbLockTimeout is how long the commands wait for the lock of a database
+// that is in use before giving up.
+const dbLockTimeout = time.Second
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+
+	flags := backupCmd.Flags()
+	flags.Bool("config", false, "bundle the exported configuration with the database in a tar.gz")
+	flags.String("url", "", "address of a running File Browser to back up through its API")
+	flags.String("token", "", "API token of an admin of the running File Browser")
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup <path>",
+	Short: "Backup the database",
+	Long: `Backup the database to a file, or to the standard output if the
+path is "-". The snapshot is consistent, being written in a read
+transaction of the database.
+
+A database in use by a running File Browser is locked by it: use --url,
+with the --token of an admin, to get the snapshot from the server
+instead, without stopping it.
+
+With --config, the backup is a tar.gz bundle of the database and of its
+configuration, as written by 'config export', which is easier to read.
+The backups, bundled or not, are restored with 'restore'.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := cmd.Flags()
+
+		out := os.Stdout
+		if args[0] != "-" {
+			var err error
+			out, err = os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600) //nolint:gomnd
+			checkErr(err)
+			defer out.Close()
+		}
+
+		err := backup(out, getParam(flags, "database"), mustGetString(flags, "url"),
+			getParam(flags, "token"), mustGetBool(flags, "config"))
+		if err != nil && args[0] != "-" {
+			out.Close()
+			os.Remove(args[0])
+		}
+		checkErr(err)
+		if args[0] != "-" {
+			checkErr(out.Close())
+			log.Println("Backed up to " + args[0])
+		}
+	},
+}
+
+// backup writes a snapshot of a database, or of the one of the server at a
+// URL, bundled with its configuration or not.
+func backup(w io.Writer, path, url, token string, withConfig bool) error {
+	snapshot, err := os.CreateTemp("", "filebrowser-backup-*.db")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(snapshot.Name())
+	defer snapshot.Close()
+
+	if url != "" {
+		err = downloadBackup(url, token, snapshot)
+	} else {
+		err = localBackup(path, snapshot)
+	}
+	if err != nil {
+		return err
+	}
+
+	db, err := openBolt(snapshot.Name(), true)
+	if err != nil {
+		return fmt.Errorf("invalid backup: %w", err)
+	}
+	if err := db.Close(); err != nil {
+		return err
+	}
+
+	if withConfig {
+		return writeBackupBundle(w, snapshot)
+	}
+	if _, err := snapshot.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, snapshot)
+	return err
+}
+
+// openBolt opens a database, failing if another process holds its lock.
+func openBolt(path string, readOnly bool) (*storm.DB, error) {
+	db, err := storm.Open(path, storm.BoltOptions(0600, &bbolt.Options{ //nolint:gomnd
+		Timeout:  dbLockTimeout,
+		ReadOnly: readOnly,
+	}))
+	if errors.Is(err, bbolt.ErrTimeout) {
+		return nil, fmt.Errorf("%s is in use, by a running File Browser?", path)
+	}
+	return db, err
+}
+
+func localBackup(path string, w io.Writer) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	db, err := openBolt(path, true)
+	if err != nil {
+		return fmt.Errorf("%w: back it up with --url", err)
+	}
+	defer db.Close()
+
+	_, err = bolt.Backup(db, w)
+	return err
+}
+
+func downloadBackup(url, token string, w io.Writer) error {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(url, "/")+"/api/backup", http.NoBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get the backup: %s", res.Status)
+	}
+
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// writeBackupBundle writes a bundle of a snapshot and of its configuration.
+// The snapshot is opened after being bundled, its migrations being left out.
+func writeBackupBundle(w io.Writer, snapshot *os.File) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+
+	stat, err := snapshot.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := snapshot.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := writeBackupEntry(tw, backupBundleDB, stat.Size(), snapshot); err != nil {
+		return err
+	}
+
+	config, err := backupConfig(snapshot.Name())
+	if err != nil {
+		return err
+	}
+	if err := writeBackupEntry(tw, backupBundleConfig, int64(len(config)), bytes.NewReader(config)); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeBackupEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600, //nolint:gomnd
+		Size:    size,
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, r)
+	return err
+}
+
+// backupConfig exports the configuration of a database, as in 'config
+// export'.
+func backupConfig(path string) ([]byte, error) {
+	db, err := openBolt(path, false)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	store, err := bolt.NewStorage(db)
+	if err != nil {
+		return nil, err
+	}
+	set, err := store.Settings.Get()
+	if err != nil {
+		return nil, err
+	}
+	server, err := store.Settings.GetServer()
+	if err != nil {
+		return nil, err
+	}
+	auther, err := store.Auth.Get(set.AuthMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(&settingsFile{
+		Settings: set,
+		Auther:   auther,
+		Server:   server,
+	}, "", "    ")
+}
@@ -2,8 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
 )
 
 func init() {
@@ -17,10 +21,34 @@ var cmdsCmd = &cobra.Command{
 	Args:  cobra.NoArgs,
 }
 
-func printEvents(m map[string][]string) {
+func printEvents(m map[string][]settings.HookCommand) {
 	for evt, cmds := range m {
 		for i, cmd := range cmds {
-			fmt.Printf("%s(%d): %s\n", evt, i, cmd)
+			if cmd.Match != "" {
+				fmt.Printf("%s(%d): %s [%s]\n", evt, i, hookCommandString(cmd), cmd.Match)
+				continue
+			}
+			fmt.Printf("%s(%d): %s\n", evt, i, hookCommandString(cmd))
 		}
 	}
 }
+
+// hookCommandString returns the command line of a command, or the name and
+// the parameters of its template.
+func hookCommandString(cmd settings.HookCommand) string {
+	if cmd.Template == "" {
+		return cmd.Command
+	}
+
+	names := make([]string, 0, len(cmd.Params))
+	for name := range cmd.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := []string{"template " + cmd.Template}
+	for _, name := range names {
+		parts = append(parts, name+"="+cmd.Params[name])
+	}
+	return strings.Join(parts, " ")
+}
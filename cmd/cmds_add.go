@@ -1,24 +1,61 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/spf13/cobra"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
 )
 
 func init() {
 	cmdsCmd.AddCommand(cmdsAddCmd)
+	cmdsAddCmd.Flags().String("match", "", "comma separated patterns of the files to run the command for, e.g. *.jpg or image/*")
+	cmdsAddCmd.Flags().String("template", "", "command template to run instead of a command")
+	cmdsAddCmd.Flags().StringArray("param", nil, "name=value parameter of the template, can be repeated")
 }
 
 var cmdsAddCmd = &cobra.Command{
-	Use:   "add <event> <command>",
+	Use:   "add <event> [command]",
 	Short: "Add a command to run on a specific event",
-	Long:  `Add a command to run on a specific event.`,
-	Args:  cobra.MinimumNArgs(2),
-	Run: python(func(_ *cobra.Command, args []string, d pythonData) {
+	Long: `Add a command to run on a specific event. With --match, it only
+runs for the files whose name or mime type match one of the patterns.
+
+With --template, it runs a command template of the settings instead, whose
+parameters are set with --param name=value.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: python(func(cmd *cobra.Command, args []string, d pythonData) {
 		s, err := d.store.Settings.Get()
 		checkErr(err)
-		command := strings.Join(args[1:], " ")
+		command := settings.HookCommand{
+			Command:  strings.Join(args[1:], " "),
+			Match:    mustGetString(cmd.Flags(), "match"),
+			Template: mustGetString(cmd.Flags(), "template"),
+		}
+		if (command.Command == "") == (command.Template == "") {
+			checkErr(errors.New("set either a command or a template"))
+		}
+		if command.Template != "" {
+			if _, ok := s.CommandTemplates[command.Template]; !ok {
+				checkErr(fmt.Errorf("unknown template %q", command.Template))
+			}
+			params, err := cmd.Flags().GetStringArray("param")
+			checkErr(err)
+			for _, param := range params {
+				name, value, ok := strings.Cut(param, "=")
+				if !ok {
+					checkErr(fmt.Errorf("invalid parameter %q, expected name=value", param))
+				}
+				if command.Params == nil {
+					command.Params = map[string]string{}
+				}
+				command.Params[name] = value
+			}
+			_, err = s.ResolveCommand(command)
+			checkErr(err)
+		}
 		s.Commands[args[0]] = append(s.Commands[args[0]], command)
 		err = d.store.Settings.Save(s)
 		checkErr(err)
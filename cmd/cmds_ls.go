@@ -2,11 +2,13 @@ package cmd
 
 import (
 	"github.com/spf13/cobra"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
 )
 
 func init() {
 	cmdsCmd.AddCommand(cmdsLsCmd)
-	cmdsLsCmd.Flags().StringP("event", "e", "", "event name, without 'before' or 'after'")
+	cmdsLsCmd.Flags().StringP("event", "e", "", "event name, without 'before', 'after' or 'finally'")
 }
 
 var cmdsLsCmd = &cobra.Command{
@@ -22,9 +24,10 @@ var cmdsLsCmd = &cobra.Command{
 		if evt == "" {
 			printEvents(s.Commands)
 		} else {
-			show := map[string][]string{}
+			show := map[string][]settings.HookCommand{}
 			show["before_"+evt] = s.Commands["before_"+evt]
 			show["after_"+evt] = s.Commands["after_"+evt]
+			show["finally_"+evt] = s.Commands["finally_"+evt]
 			printEvents(show)
 		}
 	}, pythonConfig{}),
@@ -5,6 +5,7 @@ import (
 	nerrors "errors"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"text/tabwriter"
 
@@ -13,6 +14,7 @@ import (
 
 	"github.com/filebrowser/filebrowser/v2/auth"
 	"github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/runner"
 	"github.com/filebrowser/filebrowser/v2/settings"
 )
 
@@ -32,11 +34,39 @@ func addConfigFlags(flags *pflag.FlagSet) {
 	addUserFlags(flags)
 	flags.BoolP("signup", "s", false, "allow users to signup")
 	flags.Bool("create-user-dir", false, "generate user's home directory automatically")
+	flags.Bool("enforce-totp", false, "require the users to set up two-factor authentication (json auth)")
+	flags.Bool("read-only", false, "refuse the changes to the files, whatever the permissions of the users")
+	flags.Int64("max-upload-size", 0, "bytes of the files the users can upload, unless they have their own (no limit if 0)")
+	flags.Int("max-share-requests-per-minute", 0, "requests to all the public shares together in a minute (no limit if 0)")
+	flags.Int64("max-share-bandwidth", 0, "bytes per second downloaded from all the public shares together (no limit if 0)")
 	flags.String("shell", "", "shell command to which other commands should be appended")
+	flags.Bool("use-shell", false, "run the commands through the shell, /bin/sh -c if not set")
+	flags.String("scripts-dir", "", "directory of the scripts that commands can reference as @name")
+	flags.String("env-dir", "", "directory of the env files that commands can load with --env name")
+	flags.String("allowed-commands", "", "space separated executables the hooks can run (any if empty)")
+	flags.String("hook-working-dir", string(runner.WorkingDirServer), "directory the commands run in: server, scope or file")
+	flags.Bool("dir-hooks", false, "run the commands of the "+runner.DirHooksFile+" files of the directories")
+	flags.Bool("inherit-env", true, "run the commands with the environment of the server")
+	flags.String("search-exclude", "", "space separated names or absolute paths the searches skip, with their contents")
+	flags.String("symlink-policy", "", "how the symlinks of the scopes are handled: deny, follow-within-scope or show-as-link (followed if empty)")
+	flags.String("queue-name", runner.FileBrowserQueue, "name of the redis queue of the after hooks")
 
 	flags.String("auth.method", string(auth.MethodJSONAuth), "authentication type")
 	flags.String("auth.header", "", "HTTP header for auth.method=proxy")
 	flags.String("auth.command", "", "command for auth.method=hook")
+	flags.String("auth.rpID", "", "relying party ID (domain) for auth.method=webauthn")
+	flags.String("auth.rpOrigins", "", "space separated origins allowed for auth.method=webauthn, https://rpID if empty")
+	flags.Bool("auth.allowPassword", false, "also allow password logins for auth.method=webauthn")
+	flags.String("auth.issuer", "", "issuer URL of the provider for auth.method=oidc")
+	flags.String("auth.clientID", "", "client ID for auth.method=oidc")
+	flags.String("auth.clientSecret", "", "client secret for auth.method=oidc")
+	flags.String("auth.redirectURL", "", "callback URL for auth.method=oidc, ending with /api/login/oidc/callback")
+	flags.String("auth.scopes", "", "space separated scopes asked in addition to openid, profile and email for auth.method=oidc")
+	flags.Bool("auth.autoProvision", false, "create the users logging in for the first time for auth.method=oidc")
+	flags.String("auth.claims.username", "", "claim of the username for auth.method=oidc, preferred_username if empty")
+	flags.String("auth.claims.locale", "", "claim of the locale of the users for auth.method=oidc")
+	flags.String("auth.claims.groups", "", "claim of the groups of the users for auth.method=oidc")
+	flags.String("auth.claims.adminGroups", "", "space separated groups whose users are admins for auth.method=oidc")
 
 	flags.String("recaptcha.host", "https://www.google.com", "use another host for ReCAPTCHA. recaptcha.net might be useful in China")
 	flags.String("recaptcha.key", "", "ReCaptcha site key")
@@ -132,6 +162,41 @@ func getAuthentication(flags *pflag.FlagSet, defaults ...interface{}) (settings.
 		auther = &auth.HookAuth{Command: command}
 	}
 
+	if method == auth.MethodWebAuthn {
+		rpID := mustGetString(flags, "auth.rpID")
+		if rpID == "" {
+			rpID, _ = defaultAuther["rpID"].(string)
+		}
+
+		if rpID == "" {
+			checkErr(nerrors.New("you must set the flag 'auth.rpID' for method 'webauthn'"))
+		}
+
+		webAuthn := &auth.WebAuthnAuth{RPID: rpID}
+
+		if flags.Changed("auth.rpOrigins") {
+			webAuthn.RPOrigins = convertCmdStrToCmdArray(mustGetString(flags, "auth.rpOrigins"))
+		} else if origins, ok := defaultAuther["rpOrigins"].([]interface{}); ok {
+			for _, origin := range origins {
+				if origin, ok := origin.(string); ok {
+					webAuthn.RPOrigins = append(webAuthn.RPOrigins, origin)
+				}
+			}
+		}
+
+		if flags.Changed("auth.allowPassword") {
+			webAuthn.AllowPassword = mustGetBool(flags, "auth.allowPassword")
+		} else {
+			webAuthn.AllowPassword, _ = defaultAuther["allowPassword"].(bool)
+		}
+
+		auther = webAuthn
+	}
+
+	if method == auth.MethodOIDC {
+		auther = getOIDCAuth(flags, defaultAuther)
+	}
+
 	if auther == nil {
 		panic(errors.ErrInvalidAuthMethod)
 	}
@@ -139,13 +204,89 @@ func getAuthentication(flags *pflag.FlagSet, defaults ...interface{}) (settings.
 	return method, auther
 }
 
+// getOIDCAuth returns the OIDC auth of the flags, the ones that aren't set
+// keeping their value in the defaults.
+func getOIDCAuth(flags *pflag.FlagSet, defaults map[string]interface{}) *auth.OIDCAuth {
+	claims, _ := defaults["claims"].(map[string]interface{})
+
+	str := func(flag string, values map[string]interface{}, key string) string {
+		if flags.Changed(flag) || values == nil {
+			return mustGetString(flags, flag)
+		}
+		value, _ := values[key].(string)
+		return value
+	}
+	list := func(flag string, values map[string]interface{}, key string) []string {
+		if flags.Changed(flag) || values == nil {
+			return convertCmdStrToCmdArray(mustGetString(flags, flag))
+		}
+		var list []string
+		items, _ := values[key].([]interface{})
+		for _, item := range items {
+			if item, ok := item.(string); ok {
+				list = append(list, item)
+			}
+		}
+		return list
+	}
+
+	oidcAuth := &auth.OIDCAuth{
+		Issuer:       str("auth.issuer", defaults, "issuer"),
+		ClientID:     str("auth.clientID", defaults, "clientID"),
+		ClientSecret: str("auth.clientSecret", defaults, "clientSecret"),
+		RedirectURL:  str("auth.redirectURL", defaults, "redirectURL"),
+		Scopes:       list("auth.scopes", defaults, "scopes"),
+		Claims: auth.OIDCClaims{
+			Username:    str("auth.claims.username", claims, "username"),
+			Locale:      str("auth.claims.locale", claims, "locale"),
+			Groups:      str("auth.claims.groups", claims, "groups"),
+			AdminGroups: list("auth.claims.adminGroups", claims, "adminGroups"),
+		},
+	}
+
+	if flags.Changed("auth.autoProvision") {
+		oidcAuth.AutoProvision = mustGetBool(flags, "auth.autoProvision")
+	} else {
+		oidcAuth.AutoProvision, _ = defaults["autoProvision"].(bool)
+	}
+
+	if oidcAuth.Issuer == "" || oidcAuth.ClientID == "" || oidcAuth.RedirectURL == "" {
+		checkErr(nerrors.New("you must set the flags 'auth.issuer', 'auth.clientID' and 'auth.redirectURL' for method 'oidc'"))
+	}
+
+	return oidcAuth
+}
+
 func printSettings(ser *settings.Server, set *settings.Settings, auther auth.Auther) {
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 
 	fmt.Fprintf(w, "Sign up:\t%t\n", set.Signup)
 	fmt.Fprintf(w, "Create User Dir:\t%t\n", set.CreateUserDir)
 	fmt.Fprintf(w, "Auth method:\t%s\n", set.AuthMethod)
+	fmt.Fprintf(w, "Enforce TOTP:\t%t\n", set.EnforceTOTP)
+	fmt.Fprintf(w, "Read Only:\t%t\n", set.ReadOnly)
+	fmt.Fprintf(w, "Max Upload Size:\t%d\n", set.MaxUploadSize)
+	fmt.Fprintf(w, "Max Share Requests Per Minute:\t%d\n", set.MaxShareRequestsPerMinute)
+	fmt.Fprintf(w, "Max Share Bandwidth:\t%d\n", set.MaxShareBandwidth)
+	key := set.CurrentSigningKey()
+	fmt.Fprintf(w, "Signing Key:\t%s %s\n", key.Algorithm, key.ID)
 	fmt.Fprintf(w, "Shell:\t%s\t\n", strings.Join(set.Shell, " "))
+	fmt.Fprintf(w, "Use Shell:\t%t\t\n", set.UseShell)
+	fmt.Fprintf(w, "Scripts Dir:\t%s\t\n", set.ScriptsDir)
+	fmt.Fprintf(w, "Env Dir:\t%s\t\n", set.EnvDir)
+	fmt.Fprintf(w, "Queue Name:\t%s\t\n", set.QueueName)
+	fmt.Fprintf(w, "Allowed Commands:\t%s\t\n", strings.Join(set.AllowedCommands, " "))
+	templates := make([]string, 0, len(set.CommandTemplates))
+	for name := range set.CommandTemplates {
+		templates = append(templates, name)
+	}
+	sort.Strings(templates)
+	fmt.Fprintf(w, "Command Templates:\t%s\t\n", strings.Join(templates, " "))
+	fmt.Fprintf(w, "Hook Working Dir:\t%s\t\n", set.HookWorkingDir)
+	fmt.Fprintf(w, "Directory Hooks:\t%t\t\n", set.DirHooks)
+	fmt.Fprintf(w, "Search Exclude:\t%s\t\n", strings.Join(set.SearchExclude, " "))
+	fmt.Fprintf(w, "Symlink Policy:\t%s\t\n", set.SymlinkPolicy)
+	fmt.Fprintf(w, "Inherit Env:\t%t\t\n", set.GetInheritEnv())
 	fmt.Fprintln(w, "\nBranding:")
 	fmt.Fprintf(w, "\tName:\t%s\n", set.Branding.Name)
 	fmt.Fprintf(w, "\tFiles override:\t%s\n", set.Branding.Files)
@@ -163,12 +304,65 @@ func printSettings(ser *settings.Server, set *settings.Settings, auther auth.Aut
 	fmt.Fprintf(w, "\tTLS Cert:\t%s\n", ser.TLSCert)
 	fmt.Fprintf(w, "\tTLS Key:\t%s\n", ser.TLSKey)
 	fmt.Fprintf(w, "\tExec Enabled:\t%t\n", ser.EnableExec)
+	fmt.Fprintf(w, "\tThumbnails Enabled:\t%t\n", ser.EnableThumbnails)
+	fmt.Fprintf(w, "\tThumbnail Size:\t%d\n", ser.GetThumbnailSize())
+	fmt.Fprintf(w, "\tPreview Size:\t%d\n", ser.GetPreviewSize())
+	fmt.Fprintf(w, "\tVideo Thumbnail Command:\t%s\n", ser.VideoThumbnailCommand)
+	fmt.Fprintf(w, "\tWebDAV Path:\t%s\n", ser.WebDAVPath)
+	fmt.Fprintf(w, "\tTus Dir:\t%s\n", ser.TusDir)
+	fmt.Fprintf(w, "\tSearch Index:\t%s\n", ser.SearchIndex)
+	fmt.Fprintf(w, "\tHook Queue Enabled:\t%t\n", ser.EnableHookQueue)
+	fmt.Fprintf(w, "\tHook Dry Run:\t%t\n", ser.HookDryRun)
+	fmt.Fprintf(w, "\tHook Strict Validation:\t%t\n", ser.HookStrictValidation)
+	fmt.Fprintf(w, "\tHook Timeout:\t%s\n", ser.HookTimeout)
+	fmt.Fprintf(w, "\tHook Dedup Window:\t%s\n", ser.HookDedupWindow)
+	fmt.Fprintf(w, "\tHook Fallback File:\t%s\n", ser.HookFallbackFile)
+	fmt.Fprintf(w, "\tHook Audit File:\t%s\n", ser.HookAuditFile)
+	fmt.Fprintf(w, "\tHook Audit List:\t%s\n", ser.HookAuditList)
+	fmt.Fprintf(w, "\tPlugins Dir:\t%s\n", ser.PluginsDir)
+	fmt.Fprintf(w, "\tHook Executor:\t%s\n", ser.HookExecutor)
+	fmt.Fprintf(w, "\tHook Executor CA:\t%s\n", ser.HookExecutorCA)
+	fmt.Fprintf(w, "\tHook Log Format:\t%s\n", ser.HookLogFormat)
+	fmt.Fprintf(w, "\tHook Queue Backend:\t%s\n", ser.HookQueueBackend)
+	fmt.Fprintf(w, "\tHook Queue Partitions:\t%d\n", ser.HookQueuePartitions)
+	fmt.Fprintf(w, "\tMax Background Hooks:\t%d\n", ser.MaxBackgroundHooks)
+	fmt.Fprintf(w, "\tMax Hook Output Bytes:\t%d\n", ser.GetMaxHookOutputBytes())
+	fmt.Fprintf(w, "\tLogin Max Attempts:\t%d\n", ser.GetLoginMaxAttempts())
+	fmt.Fprintf(w, "\tLogin Max Attempts Per IP:\t%d\n", ser.GetLoginMaxAttemptsPerIP())
+	fmt.Fprintf(w, "\tLogin Attempt Window:\t%s\n", ser.GetLoginAttemptWindow())
+	fmt.Fprintf(w, "\tLogin Lockout:\t%s\n", ser.GetLoginLockout())
+	fmt.Fprintf(w, "\tLogin Backoff:\t%t\n", ser.LoginBackoff)
+	fmt.Fprintf(w, "\tAllowed IPs:\t%s\n", ser.AllowedIPs)
+	fmt.Fprintf(w, "\tDenied IPs:\t%s\n", ser.DeniedIPs)
+	fmt.Fprintf(w, "\tAdmin Allowed IPs:\t%s\n", ser.AdminAllowedIPs)
+	fmt.Fprintf(w, "\tAdmin Denied IPs:\t%s\n", ser.AdminDeniedIPs)
+	fmt.Fprintf(w, "\tTrusted Proxies:\t%s\n", ser.TrustedProxies)
+	fmt.Fprintf(w, "\tCompression:\t%s\n", ser.Compression)
+	fmt.Fprintf(w, "\tCompression Level:\t%d\n", ser.CompressionLevel)
+	fmt.Fprintf(w, "\tCompression Min Size:\t%d\n", ser.GetCompressionMinSize())
+	fmt.Fprintf(w, "\tWebhook URL:\t%s\n", ser.WebhookURL)
+	fmt.Fprintf(w, "\tWebhook Secret Set:\t%t\n", ser.WebhookSecret != "")
+	fmt.Fprintf(w, "\tWebhook Events:\t%s\n", ser.WebhookEvents)
+	fmt.Fprintf(w, "\tWebhook Retries:\t%d\n", ser.GetWebhookRetries())
+	fmt.Fprintf(w, "\tWebhook Backoff:\t%s\n", ser.GetWebhookBackoff())
+	fmt.Fprintf(w, "\tDirectory Sizes:\t%t\n", ser.DirSizes)
+	fmt.Fprintf(w, "\tDirectory Sizes Interval:\t%s\n", ser.GetDirSizesInterval())
+	fmt.Fprintf(w, "\tSettings Profile:\t%s\n", ser.Profile)
+	fmt.Fprintf(w, "\tRedis Address:\t%s\n", ser.Redis.GetAddress())
+	fmt.Fprintf(w, "\tRedis Password Set:\t%t\n", ser.Redis.Password != "")
+	fmt.Fprintf(w, "\tRedis DB:\t%d\n", ser.Redis.DB)
+	fmt.Fprintf(w, "\tRedis Pool Size:\t%d\n", ser.Redis.PoolSize)
+	fmt.Fprintf(w, "\tRedis TLS:\t%t\n", ser.Redis.TLS)
+	fmt.Fprintf(w, "\tRedis CA:\t%s\n", ser.Redis.CA)
+	fmt.Fprintf(w, "\tRedis Cert:\t%s\n", ser.Redis.Cert)
+	fmt.Fprintf(w, "\tRedis Key:\t%s\n", ser.Redis.Key)
 	fmt.Fprintln(w, "\nDefaults:")
 	fmt.Fprintf(w, "\tScope:\t%s\n", set.Defaults.Scope)
 	fmt.Fprintf(w, "\tLocale:\t%s\n", set.Defaults.Locale)
 	fmt.Fprintf(w, "\tView mode:\t%s\n", set.Defaults.ViewMode)
 	fmt.Fprintf(w, "\tSingle Click:\t%t\n", set.Defaults.SingleClick)
 	fmt.Fprintf(w, "\tCommands:\t%s\n", strings.Join(set.Defaults.Commands, " "))
+	fmt.Fprintf(w, "\tRules:\t%d\n", len(set.Defaults.Rules))
 	fmt.Fprintf(w, "\tSorting:\n")
 	fmt.Fprintf(w, "\t\tBy:\t%s\n", set.Defaults.Sorting.By)
 	fmt.Fprintf(w, "\t\tAsc:\t%t\n", set.Defaults.Sorting.Asc)
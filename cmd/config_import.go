@@ -29,17 +29,18 @@ var configImportCmd = &cobra.Command{
 configuration. Can be used with or without unexisting databases.
 
 If used with a nonexisting database, a key will be generated
-automatically. Otherwise the key will be kept the same as in the
-database.
+automatically. Otherwise the key, and the keys signing the tokens,
+will be kept the same as in the database.
 
 The path must be for a json or yaml file.`,
 	Args: jsonYamlArg,
 	Run: python(func(_ *cobra.Command, args []string, d pythonData) {
 		var key []byte
+		var signingKeys []settings.SigningKey
 		if d.hadDB {
 			settings, err := d.store.Settings.Get()
 			checkErr(err)
-			key = settings.Key
+			key, signingKeys = settings.Key, settings.SigningKeys
 		} else {
 			key = generateKey()
 		}
@@ -48,7 +49,7 @@ The path must be for a json or yaml file.`,
 		err := unmarshal(args[0], &file)
 		checkErr(err)
 
-		file.Settings.Key = key
+		file.Settings.Key, file.Settings.SigningKeys = key, signingKeys
 		err = d.store.Settings.Save(file.Settings)
 		checkErr(err)
 
@@ -72,6 +73,10 @@ The path must be for a json or yaml file.`,
 			auther = getAuther(auth.ProxyAuth{}, rawAuther).(*auth.ProxyAuth)
 		case auth.MethodHookAuth:
 			auther = getAuther(&auth.HookAuth{}, rawAuther).(*auth.HookAuth)
+		case auth.MethodWebAuthn:
+			auther = getAuther(&auth.WebAuthnAuth{}, rawAuther).(*auth.WebAuthnAuth)
+		case auth.MethodOIDC:
+			auther = getAuther(&auth.OIDCAuth{}, rawAuther).(*auth.OIDCAuth)
 		default:
 			checkErr(errors.New("invalid auth method"))
 		}
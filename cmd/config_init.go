@@ -27,14 +27,28 @@ override the options.`,
 		flags := cmd.Flags()
 		getUserDefaults(flags, &defaults, true)
 		authMethod, auther := getAuthentication(flags)
+		inheritEnv := mustGetBool(flags, "inherit-env")
 
 		s := &settings.Settings{
-			Key:           generateKey(),
-			Signup:        mustGetBool(flags, "signup"),
-			CreateUserDir: mustGetBool(flags, "create-user-dir"),
-			Shell:         convertCmdStrToCmdArray(mustGetString(flags, "shell")),
-			AuthMethod:    authMethod,
-			Defaults:      defaults,
+			Key:             generateKey(),
+			Signup:          mustGetBool(flags, "signup"),
+			CreateUserDir:   mustGetBool(flags, "create-user-dir"),
+			EnforceTOTP:     mustGetBool(flags, "enforce-totp"),
+			ReadOnly:        mustGetBool(flags, "read-only"),
+			MaxUploadSize:   mustGetInt64(flags, "max-upload-size"),
+			DirHooks:        mustGetBool(flags, "dir-hooks"),
+			Shell:           convertCmdStrToCmdArray(mustGetString(flags, "shell")),
+			UseShell:        mustGetBool(flags, "use-shell"),
+			ScriptsDir:      mustGetString(flags, "scripts-dir"),
+			EnvDir:          mustGetString(flags, "env-dir"),
+			QueueName:       mustGetString(flags, "queue-name"),
+			AllowedCommands: convertCmdStrToCmdArray(mustGetString(flags, "allowed-commands")),
+			SearchExclude:   convertCmdStrToCmdArray(mustGetString(flags, "search-exclude")),
+			SymlinkPolicy:   mustGetString(flags, "symlink-policy"),
+			InheritEnv:      &inheritEnv,
+			HookWorkingDir:  mustGetString(flags, "hook-working-dir"),
+			AuthMethod:      authMethod,
+			Defaults:        defaults,
 			Branding: settings.Branding{
 				Name:                  mustGetString(flags, "branding.name"),
 				DisableExternal:       mustGetBool(flags, "branding.disableExternal"),
@@ -42,6 +56,9 @@ override the options.`,
 				Theme:                 mustGetString(flags, "branding.theme"),
 				Files:                 mustGetString(flags, "branding.files"),
 			},
+
+			MaxShareRequestsPerMinute: mustGetInt(flags, "max-share-requests-per-minute"),
+			MaxShareBandwidth:         mustGetInt64(flags, "max-share-bandwidth"),
 		}
 
 		ser := &settings.Server{
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	fbhttp "github.com/filebrowser/filebrowser/v2/http"
+)
+
+func init() {
+	configCmd.AddCommand(configRotateKeyCmd)
+	configRotateKeyCmd.Flags().String("algorithm", "", "algorithm of the new key, HS256, RS256 or ES256 (defaults to the one of the current key)")
+	configRotateKeyCmd.Flags().Duration("overlap", 0, "how long the previous key keeps verifying its tokens (defaults to the token expiration time)")
+}
+
+var configRotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Rotate the key signing the tokens",
+	Long: `Rotate the key signing the tokens. The tokens are signed with a
+new key from now on, with its ID in their kid header, and the ones
+of the previous key keep being accepted, and renewed, during the
+overlap. The running instances pick the new key up with the
+settings.`,
+	Args: cobra.NoArgs,
+	Run: python(func(cmd *cobra.Command, _ []string, d pythonData) {
+		flags := cmd.Flags()
+		set, err := d.store.Settings.Get()
+		checkErr(err)
+
+		overlap, err := flags.GetDuration("overlap")
+		checkErr(err)
+		if !flags.Changed("overlap") {
+			ser, err := d.store.Settings.GetServer()
+			checkErr(err)
+			overlap = ser.GetTokenExpirationTime(fbhttp.DefaultTokenExpirationTime)
+		}
+
+		key, err := set.RotateSigningKey(mustGetString(flags, "algorithm"), overlap, time.Now())
+		checkErr(err)
+		checkErr(d.store.Settings.Save(set))
+		fmt.Printf("The tokens are now signed with the %s key %s\n", key.Algorithm, key.ID)
+	}, pythonConfig{}),
+}
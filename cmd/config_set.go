@@ -3,6 +3,9 @@ package cmd
 import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+
+	"github.com/filebrowser/filebrowser/v2/runner"
+	"github.com/filebrowser/filebrowser/v2/users"
 )
 
 func init() {
@@ -43,14 +46,146 @@ you want to change. Other options will remain unchanged.`,
 				ser.Port = mustGetString(flags, flag.Name)
 			case "log":
 				ser.Log = mustGetString(flags, flag.Name)
+			case "webdav-path":
+				ser.WebDAVPath = mustGetString(flags, flag.Name)
+			case "hook-timeout":
+				ser.HookTimeout = mustGetString(flags, flag.Name)
+			case "hook-dedup-window":
+				ser.HookDedupWindow = mustGetString(flags, flag.Name)
+			case "hook-log-format":
+				ser.HookLogFormat = mustGetString(flags, flag.Name)
+			case "tus-dir":
+				ser.TusDir = mustGetString(flags, flag.Name)
+			case "search-index":
+				ser.SearchIndex = mustGetString(flags, flag.Name)
+			case "hook-fallback-file":
+				ser.HookFallbackFile = mustGetString(flags, flag.Name)
+			case "hook-audit-file":
+				ser.HookAuditFile = mustGetString(flags, flag.Name)
+			case "hook-audit-list":
+				ser.HookAuditList = mustGetString(flags, flag.Name)
+			case "plugins-dir":
+				ser.PluginsDir = mustGetString(flags, flag.Name)
+			case "hook-executor":
+				ser.HookExecutor = mustGetString(flags, flag.Name)
+			case "hook-executor-ca":
+				ser.HookExecutorCA = mustGetString(flags, flag.Name)
+			case "hook-queue-backend":
+				ser.HookQueueBackend = mustGetString(flags, flag.Name)
+				_, err := runner.ParseQueueBackend(ser.HookQueueBackend)
+				checkErr(err)
+			case "hook-queue-partitions":
+				ser.HookQueuePartitions = mustGetInt(flags, flag.Name)
+			case "thumbnail-size":
+				ser.ThumbnailSize = mustGetInt(flags, flag.Name)
+			case "preview-size":
+				ser.PreviewSize = mustGetInt(flags, flag.Name)
+			case "video-thumbnail-command":
+				ser.VideoThumbnailCommand = mustGetString(flags, flag.Name)
+			case "login-max-attempts":
+				ser.LoginMaxAttempts = mustGetInt(flags, flag.Name)
+			case "login-max-attempts-per-ip":
+				ser.LoginMaxAttemptsPerIP = mustGetInt(flags, flag.Name)
+			case "login-attempt-window":
+				ser.LoginAttemptWindow = mustGetString(flags, flag.Name)
+			case "login-lockout":
+				ser.LoginLockout = mustGetString(flags, flag.Name)
+			case "login-backoff":
+				ser.LoginBackoff = mustGetBool(flags, flag.Name)
+			case "allowed-ips":
+				ser.AllowedIPs = mustGetString(flags, flag.Name)
+			case "denied-ips":
+				ser.DeniedIPs = mustGetString(flags, flag.Name)
+			case "admin-allowed-ips":
+				ser.AdminAllowedIPs = mustGetString(flags, flag.Name)
+			case "admin-denied-ips":
+				ser.AdminDeniedIPs = mustGetString(flags, flag.Name)
+			case "trusted-proxies":
+				ser.TrustedProxies = mustGetString(flags, flag.Name)
+			case "compression":
+				ser.Compression = mustGetString(flags, flag.Name)
+			case "compression-level":
+				ser.CompressionLevel = mustGetInt(flags, flag.Name)
+			case "compression-min-size":
+				ser.CompressionMinSize = mustGetInt(flags, flag.Name)
+			case "webhook-url":
+				ser.WebhookURL = mustGetString(flags, flag.Name)
+			case "webhook-secret":
+				ser.WebhookSecret = mustGetString(flags, flag.Name)
+			case "webhook-events":
+				ser.WebhookEvents = mustGetString(flags, flag.Name)
+			case "webhook-retries":
+				ser.WebhookRetries = mustGetInt(flags, flag.Name)
+			case "webhook-backoff":
+				ser.WebhookBackoff = mustGetString(flags, flag.Name)
+			case "dir-sizes":
+				ser.DirSizes = mustGetBool(flags, flag.Name)
+			case "dir-sizes-interval":
+				ser.DirSizesInterval = mustGetString(flags, flag.Name)
+			case "profile":
+				ser.Profile = mustGetString(flags, flag.Name)
+			case "redis.address":
+				ser.Redis.Address = mustGetString(flags, flag.Name)
+			case "redis.password":
+				ser.Redis.Password = mustGetString(flags, flag.Name)
+			case "redis.db":
+				ser.Redis.DB = mustGetInt(flags, flag.Name)
+			case "redis.poolSize":
+				ser.Redis.PoolSize = mustGetInt(flags, flag.Name)
+			case "redis.tls":
+				ser.Redis.TLS = mustGetBool(flags, flag.Name)
+			case "redis.ca":
+				ser.Redis.CA = mustGetString(flags, flag.Name)
+			case "redis.cert":
+				ser.Redis.Cert = mustGetString(flags, flag.Name)
+			case "redis.key":
+				ser.Redis.Key = mustGetString(flags, flag.Name)
+			case "max-background-hooks":
+				ser.MaxBackgroundHooks = mustGetInt(flags, flag.Name)
+			case "max-hook-output-bytes":
+				ser.MaxHookOutputBytes = mustGetInt64(flags, flag.Name)
 			case "signup":
 				set.Signup = mustGetBool(flags, flag.Name)
 			case "auth.method":
 				hasAuth = true
 			case "shell":
 				set.Shell = convertCmdStrToCmdArray(mustGetString(flags, flag.Name))
+			case "use-shell":
+				set.UseShell = mustGetBool(flags, flag.Name)
+			case "scripts-dir":
+				set.ScriptsDir = mustGetString(flags, flag.Name)
+			case "env-dir":
+				set.EnvDir = mustGetString(flags, flag.Name)
+			case "queue-name":
+				set.QueueName = mustGetString(flags, flag.Name)
+			case "allowed-commands":
+				set.AllowedCommands = convertCmdStrToCmdArray(mustGetString(flags, flag.Name))
+			case "search-exclude":
+				set.SearchExclude = convertCmdStrToCmdArray(mustGetString(flags, flag.Name))
+			case "symlink-policy":
+				set.SymlinkPolicy = mustGetString(flags, flag.Name)
+				checkErr(users.ValidateSymlinkPolicy(set.SymlinkPolicy))
+			case "hook-working-dir":
+				set.HookWorkingDir = mustGetString(flags, flag.Name)
+				_, err := runner.ParseWorkingDir(set.HookWorkingDir)
+				checkErr(err)
+			case "inherit-env":
+				inheritEnv := mustGetBool(flags, flag.Name)
+				set.InheritEnv = &inheritEnv
 			case "create-user-dir":
 				set.CreateUserDir = mustGetBool(flags, flag.Name)
+			case "enforce-totp":
+				set.EnforceTOTP = mustGetBool(flags, flag.Name)
+			case "read-only":
+				set.ReadOnly = mustGetBool(flags, flag.Name)
+			case "max-upload-size":
+				set.MaxUploadSize = mustGetInt64(flags, flag.Name)
+			case "max-share-requests-per-minute":
+				set.MaxShareRequestsPerMinute = mustGetInt(flags, flag.Name)
+			case "max-share-bandwidth":
+				set.MaxShareBandwidth = mustGetInt64(flags, flag.Name)
+			case "dir-hooks":
+				set.DirHooks = mustGetBool(flags, flag.Name)
 			case "branding.name":
 				set.Branding.Name = mustGetString(flags, flag.Name)
 			case "branding.color":
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"log"
+	"net"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/filebrowser/filebrowser/v2/runner"
+	"github.com/filebrowser/filebrowser/v2/runner/rpc"
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+func init() {
+	rootCmd.AddCommand(hooksDaemonCmd)
+
+	flags := hooksDaemonCmd.Flags()
+	flags.String("listen", "127.0.0.1:7445", "address to listen on")
+	flags.String("cert", "", "TLS certificate (plaintext if empty)")
+	flags.String("key", "", "TLS key")
+	flags.String("shell", "", "shell command to which other commands should be appended")
+	flags.Bool("use-shell", false, "run the commands through the shell, /bin/sh -c if not set")
+	flags.String("scripts-dir", "", "directory of the scripts that commands can reference as @name")
+	flags.String("env-dir", "", "directory of the env files that commands can load with --env name")
+	flags.String("allowed-commands", "", "space separated executables the hooks can run (any if empty)")
+	flags.Bool("inherit-env", true, "run the commands with the environment of the daemon")
+	flags.String("hook-timeout", "", "maximum duration of a hook command (disabled if empty)")
+}
+
+var hooksDaemonCmd = &cobra.Command{
+	Use:   "hooks-daemon",
+	Short: "Runs the hook commands of a remote File Browser",
+	Long: `Runs the hook commands sent by a File Browser started with
+--hook-executor pointing to this daemon. The commands run with the
+settings given here, so that the scripts live on this host only.
+
+Anyone who can connect to the daemon can run commands: listen on a
+private address, or use TLS.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		flags := cmd.Flags()
+		inheritEnv := mustGetBool(flags, "inherit-env")
+
+		server := &settings.Server{HookTimeout: mustGetString(flags, "hook-timeout")}
+		executor := &runner.Runner{
+			Enabled:        true,
+			CommandTimeout: server.GetHookTimeout(),
+			Settings: &settings.Settings{
+				Shell:           convertCmdStrToCmdArray(mustGetString(flags, "shell")),
+				UseShell:        mustGetBool(flags, "use-shell"),
+				ScriptsDir:      mustGetString(flags, "scripts-dir"),
+				EnvDir:          mustGetString(flags, "env-dir"),
+				AllowedCommands: convertCmdStrToCmdArray(mustGetString(flags, "allowed-commands")),
+				InheritEnv:      &inheritEnv,
+			},
+		}
+
+		var opts []grpc.ServerOption
+		if cert, key := mustGetString(flags, "cert"), mustGetString(flags, "key"); cert != "" {
+			creds, err := credentials.NewServerTLSFromFile(cert, key)
+			checkErr(err)
+			opts = append(opts, grpc.Creds(creds))
+		}
+
+		listener, err := net.Listen("tcp", mustGetString(flags, "listen"))
+		checkErr(err)
+
+		log.Println("Running hook commands on", listener.Addr().String())
+		checkErr(rpc.NewServer(executor, opts...).Serve(listener))
+	},
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/filebrowser/filebrowser/v2/storage/bolt"
+)
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <path>",
+	Short: "Restore a backup of the database",
+	Long: `Restore a backup of the database written by 'backup', bundled or
+not, from a file or from the standard input if the path is "-". The
+database is replaced by the one of the backup, which is checked first.
+
+File Browser must be stopped: a database in use isn't replaced.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := getParam(cmd.Flags(), "database")
+
+		in := os.Stdin
+		if args[0] != "-" {
+			var err error
+			in, err = os.Open(args[0])
+			checkErr(err)
+			defer in.Close()
+		}
+
+		checkErr(restoreBackup(in, path))
+		log.Println("Restored " + path)
+	},
+}
+
+// restoreBackup replaces a database with a backup once it's checked,
+// holding the lock of the database.
+func restoreBackup(r io.Reader, path string) error {
+	// the backup is written next to the database, to be renamed over it
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil { //nolint:gomnd
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".filebrowser-restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = readBackup(r, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkBackup(tmp.Name()); err != nil {
+		return err
+	}
+
+	if exists, err := dbExists(path); err != nil {
+		return err
+	} else if exists {
+		db, err := openBolt(path, false)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// readBackup writes the database of a backup, bundled or not.
+func readBackup(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2) //nolint:gomnd
+	if err != nil {
+		return fmt.Errorf("invalid backup: %w", err)
+	}
+	if magic[0] != 0x1f || magic[1] != 0x8b {
+		_, err = io.Copy(w, br)
+		return err
+	}
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return errors.New("invalid backup: no " + backupBundleDB + " in the bundle")
+		}
+		if err != nil {
+			return err
+		}
+		if header.Name == backupBundleDB {
+			_, err = io.Copy(w, tr)
+			return err
+		}
+	}
+}
+
+// checkBackup makes sure a backup is a database of File Browser, migrating
+// it to this version.
+func checkBackup(path string) error {
+	db, err := openBolt(path, false)
+	if err != nil {
+		return fmt.Errorf("invalid backup: %w", err)
+	}
+	defer db.Close()
+
+	store, err := bolt.NewStorage(db)
+	if err != nil {
+		return fmt.Errorf("invalid backup: %w", err)
+	}
+	if _, err := store.Settings.Get(); err != nil {
+		return fmt.Errorf("invalid backup: %w", err)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"io"
@@ -11,14 +12,19 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	v "github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 	lumberjack "gopkg.in/natefinch/lumberjack.v2"
 
 	"github.com/filebrowser/filebrowser/v2/auth"
@@ -26,6 +32,11 @@ import (
 	"github.com/filebrowser/filebrowser/v2/frontend"
 	fbhttp "github.com/filebrowser/filebrowser/v2/http"
 	"github.com/filebrowser/filebrowser/v2/img"
+	"github.com/filebrowser/filebrowser/v2/plugins"
+	"github.com/filebrowser/filebrowser/v2/runner"
+	"github.com/filebrowser/filebrowser/v2/runner/rpc"
+	"github.com/filebrowser/filebrowser/v2/s3fs"
+	"github.com/filebrowser/filebrowser/v2/search"
 	"github.com/filebrowser/filebrowser/v2/settings"
 	"github.com/filebrowser/filebrowser/v2/storage"
 	"github.com/filebrowser/filebrowser/v2/users"
@@ -59,7 +70,7 @@ func addServerFlags(flags *pflag.FlagSet) {
 	flags.StringP("port", "p", "8080", "port to listen on")
 	flags.StringP("cert", "t", "", "tls certificate")
 	flags.StringP("key", "k", "", "tls key")
-	flags.StringP("root", "r", ".", "root to prepend to relative paths")
+	flags.StringP("root", "r", ".", "root to prepend to relative paths, or the URL of an S3 bucket like s3://bucket/prefix?endpoint=...")
 	flags.String("socket", "", "socket to listen to (cannot be used with address, port, cert nor key flags)")
 	flags.Uint32("socket-perm", 0666, "unix socket file permissions") //nolint:gomnd
 	flags.StringP("baseurl", "b", "", "base url")
@@ -68,10 +79,69 @@ func addServerFlags(flags *pflag.FlagSet) {
 	flags.Int("img-processors", 4, "image processors count") //nolint:gomnd
 	flags.Bool("disable-thumbnails", false, "disable image thumbnails")
 	flags.Bool("disable-preview-resize", false, "disable resize of image previews")
+	flags.Int("thumbnail-size", settings.DefaultThumbnailSize, "size of the square thumbnails of the listings")
+	flags.Int("preview-size", settings.DefaultPreviewSize, "size the resized image previews fit in")
+	flags.String("video-thumbnail-command", "", "command writing a frame of the $FILE video to its output (no video thumbnails if empty)")
 	flags.Bool("disable-exec", false, "disables Command Runner feature")
+	flags.String("webdav-path", "", "path to serve the files over WebDAV at (disabled if empty)")
+	flags.Bool("disable-hook-queue", false, "run the after hooks directly instead of queueing them in redis")
 	flags.Bool("disable-type-detection-by-header", false, "disables type detection by reading file headers")
+	flags.Bool("hook-dry-run", false, "log the hook commands instead of running them")
+	flags.Bool("hook-strict-validation", false, "exit at startup if the hook commands are invalid instead of logging it")
+	flags.String("hook-timeout", "", "maximum duration of a blocking hook command (disabled if empty)")
+	flags.String("hook-dedup-window", "", "time identical after hook jobs are skipped for once queued (disabled if empty)")
+	flags.String("hook-log-format", "text", "format of the hook execution logs (text or json)")
+	flags.Int64("max-hook-output-bytes", 0, "output kept for each stream of a hook command, 1MiB if 0 and unlimited if negative")
+	flags.Int("hook-queue-partitions", 0, "number of lists the after hooks are queued in to keep the jobs of a path in order (single list if 0)")
+	flags.Int("max-background-hooks", 0, "maximum number of non-blocking hook commands running at once (unlimited if 0)")
+	flags.String("hook-queue-backend", "list", "redis structure to queue the after hooks in (list or stream)")
+	flags.String("tus-dir", "", "directory of the partial resumable uploads (in the temporary directory if empty)")
+	flags.String("search-index", "", "file of the index of the file contents, searched with contents: (disabled if empty)")
+	flags.String("hook-fallback-file", "", "file to save the after hook jobs that couldn't be queued to (dropped if empty)")
+	flags.String("hook-audit-file", "", "file to append a record of every hook command run to (disabled if empty)")
+	flags.String("hook-audit-list", "", "redis list to append a record of every hook command run to (disabled if empty)")
+	flags.String("plugins-dir", "", "directory the plugins are loaded from (disabled if empty)")
+	flags.String("hook-executor", "", "address of the hooks-daemon running the hook commands (run locally if empty)")
+	flags.String("hook-executor-ca", "", "CA certificate to connect to the hooks-daemon with TLS (plaintext if empty)")
+	flags.Int("login-max-attempts", settings.DefaultLoginMaxAttempts, "failed logins of a username before it's locked out (never if negative)")
+	flags.Int("login-max-attempts-per-ip", settings.DefaultLoginMaxAttemptsPerIP, "failed logins from an IP before it's locked out (never if negative)")
+	flags.String("login-attempt-window", settings.DefaultLoginLockout.String(), "time the failed logins are counted for")
+	flags.String("login-lockout", settings.DefaultLoginLockout.String(), "time the usernames and IPs with too many failed logins are locked out for")
+	flags.Bool("login-backoff", false, "double the lockout each time a username or an IP is locked out again within a day")
+	flags.String("allowed-ips", "", "comma separated IPs and CIDRs allowed to access the server (all if empty)")
+	flags.String("denied-ips", "", "comma separated IPs and CIDRs denied access to the server")
+	flags.String("admin-allowed-ips", "", "comma separated IPs and CIDRs allowed to use the admin API (all if empty)")
+	flags.String("admin-denied-ips", "", "comma separated IPs and CIDRs denied the admin API")
+	flags.String("trusted-proxies", "", "comma separated IPs and CIDRs of the proxies whose X-Forwarded-For header is trusted")
+	flags.String("compression", "", "comma separated algorithms the responses are compressed with, gzip and br, the first ones preferred (disabled if empty)")
+	flags.Int("compression-level", 0, "level of the compression algorithms (their default if 0)")
+	flags.Int("compression-min-size", settings.DefaultCompressionMinSize, "size in bytes of the smallest responses compressed")
+	flags.String("webhook-url", "", "URL the operations are posted to as signed JSON (disabled if empty)")
+	flags.String("webhook-secret", "", "secret the webhook payloads are signed with (unsigned if empty)")
+	flags.String("webhook-events", "", "comma separated operations posted to the webhook (all if empty)")
+	flags.Int("webhook-retries", settings.DefaultWebhookRetries, "times a failed webhook delivery is retried (never if negative)")
+	flags.String("webhook-backoff", settings.DefaultWebhookBackoff.String(), "time before the first retry of a webhook delivery, doubled for the next ones")
+	flags.Bool("dir-sizes", false, "show the total size of the files under the directories of the listings")
+	flags.String("dir-sizes-interval", settings.DefaultDirSizesInterval.String(), "how often the sizes of the directories are computed again")
+	flags.String("profile", "", "profile of the settings merged over them (none if empty)")
+	flags.String("redis.address", settings.DefaultRedisAddress, "address of the redis server the after hooks are queued in")
+	flags.String("redis.password", "", "password of the redis server")
+	flags.Int("redis.db", 0, "redis database number")
+	flags.Int("redis.poolSize", 0, "maximum number of redis connections (client default if 0)")
+	flags.Bool("redis.tls", false, "connect to redis with TLS")
+	flags.String("redis.ca", "", "CA certificate to verify the redis server with (system ones if empty)")
+	flags.String("redis.cert", "", "client certificate to connect to redis with")
+	flags.String("redis.key", "", "key of the redis client certificate")
 }
 
+// hookShutdownTimeout is how long the server waits for the background hooks
+// to finish when shutting down.
+const hookShutdownTimeout = 30 * time.Second
+
+// serverShutdownTimeout is how long the server waits for the requests in
+// flight to finish when shutting down.
+const serverShutdownTimeout = 30 * time.Second
+
 var rootCmd = &cobra.Command{
 	Use:   "filebrowser",
 	Short: "A stylish web-based file browser",
@@ -138,9 +208,39 @@ user created with the credentials from options "username" and "password".`,
 		server := getRunParams(cmd.Flags(), d.store)
 		setupLog(server.Log)
 
-		root, err := filepath.Abs(server.Root)
+		if !s3fs.IsURL(server.Root) {
+			root, err := filepath.Abs(server.Root)
+			checkErr(err)
+			server.Root = root
+		}
+
+		set, err := d.store.Settings.Get()
+		checkErr(err)
+		set, err = set.WithProfile(server.Profile)
 		checkErr(err)
-		server.Root = root
+		if server.Profile != "" {
+			log.Printf("Using the settings profile %s", server.Profile)
+		}
+		// the defaults could have been edited in the database by hand
+		checkErr(set.Defaults.Validate())
+		hookRunner := runner.New(server).WithSettings(set)
+		if server.HookExecutor != "" {
+			hookRunner.Executor = dialHookExecutor(server)
+		}
+		if server.EnableExec {
+			validateHooks(hookRunner, server.HookStrictValidation)
+		}
+		if server.EnableExec && server.EnableHookQueue {
+			replayHookFallback(hookRunner)
+		}
+
+		searchIndex := openSearchIndex(server)
+		if searchIndex != nil {
+			hookRunner.Listeners = append(hookRunner.Listeners, searchIndex)
+		}
+
+		plugs := loadPlugins(server)
+		hookRunner.Listeners = append(hookRunner.Listeners, plugins.Listeners(plugs)...)
 
 		adr := server.Address + ":" + server.Port
 
@@ -167,33 +267,135 @@ user created with the credentials from options "username" and "password".`,
 			checkErr(err)
 		}
 
-		sigc := make(chan os.Signal, 1)
-		signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
-		go cleanupHandler(listener, sigc)
-
 		assetsFs, err := fs.Sub(frontend.Assets(), "dist")
 		if err != nil {
 			panic(err)
 		}
 
-		handler, err := fbhttp.NewHandler(imgSvc, fileCache, d.store, server, assetsFs)
+		handler, err := fbhttp.NewHandler(imgSvc, fileCache, d.store, server, hookRunner, searchIndex, plugs, assetsFs)
 		checkErr(err)
 
-		defer listener.Close()
+		//nolint: gosec
+		srv := &http.Server{Handler: handler}
+		sigc := make(chan os.Signal, 1)
+		signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+		done := make(chan struct{})
+		go cleanupHandler(srv, hookRunner, searchIndex, sigc, done)
 
 		log.Println("Listening on", listener.Addr().String())
-		//nolint: gosec
-		if err := http.Serve(listener, handler); err != nil {
+		if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
 			log.Fatal(err)
 		}
+		// the hooks are drained before the database is closed
+		<-done
 	}, pythonConfig{allowNoDB: true}),
 }
 
-func cleanupHandler(listener net.Listener, c chan os.Signal) { //nolint:interfacer
+// validateHooks logs the problems of the hook commands, and exits if the
+// validation is strict.
+func validateHooks(r *runner.Runner, strict bool) {
+	errs := r.Validate()
+	for _, err := range errs {
+		log.Printf("[WARN] Invalid hook command: %v", err)
+	}
+	if strict && len(errs) > 0 {
+		log.Fatalf("Found %d invalid hook commands, see above", len(errs))
+	}
+}
+
+// replayHookFallback queues the after hook jobs that were saved to the
+// fallback file while the queue was unavailable.
+func replayHookFallback(r *runner.Runner) {
+	if err := r.ReplayFallback(context.Background()); err != nil {
+		log.Printf("[WARN] Failed to replay hook fallback file: %v", err)
+	}
+}
+
+// openSearchIndex loads the index of the file contents, and updates it with
+// the files changed while the server was stopped in the background. It's
+// nil if the contents aren't indexed.
+func openSearchIndex(server *settings.Server) *search.Index {
+	if server.SearchIndex == "" {
+		return nil
+	}
+
+	index, err := search.NewIndex(server.SearchIndex)
+	if err != nil {
+		log.Printf("[WARN] Failed to load the search index, building it again: %v", err)
+		index, _ = search.NewIndex("")
+		index.Path = server.SearchIndex
+	}
+
+	go func() {
+		fs, root, err := users.RootFs(server.Root)
+		if err == nil {
+			err = index.Build(fs, root)
+		}
+		if err != nil {
+			log.Printf("[WARN] Failed to build the search index: %v", err)
+		}
+	}()
+
+	return index
+}
+
+// loadPlugins loads the plugins of the plugins directory, and exits if one
+// is invalid.
+func loadPlugins(server *settings.Server) []plugins.Plugin {
+	if server.PluginsDir == "" {
+		return nil
+	}
+
+	plugs, err := plugins.Load(server.PluginsDir)
+	checkErr(err)
+	for _, p := range plugs {
+		log.Printf("Loaded plugin %s", p.Name())
+	}
+	return plugs
+}
+
+// dialHookExecutor connects to the hooks-daemon that runs the hook commands.
+func dialHookExecutor(server *settings.Server) *rpc.Client {
+	creds := insecure.NewCredentials()
+	if server.HookExecutorCA != "" {
+		var err error
+		creds, err = credentials.NewClientTLSFromFile(server.HookExecutorCA, "")
+		checkErr(err)
+	}
+
+	client, err := rpc.Dial(server.HookExecutor, grpc.WithTransportCredentials(creds))
+	checkErr(err)
+	log.Println("Running the hook commands on", server.HookExecutor)
+	return client
+}
+
+// cleanupHandler shuts the server down on a signal, letting the requests in
+// flight finish, then saves the search index and drains the background
+// hooks, closing done once it's over.
+func cleanupHandler(srv *http.Server, hookRunner *runner.Runner, searchIndex *search.Index, c chan os.Signal, done chan struct{}) {
+	defer close(done)
+
 	sig := <-c
 	log.Printf("Caught signal %s: shutting down.", sig)
-	listener.Close()
-	os.Exit(0)
+
+	serverCtx, serverCancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer serverCancel()
+	if err := srv.Shutdown(serverCtx); err != nil {
+		log.Printf("[WARN] Requests still running: %v", err)
+	}
+
+	if searchIndex != nil {
+		if err := searchIndex.Save(); err != nil {
+			log.Printf("[WARN] Failed to save the search index: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookShutdownTimeout)
+	defer cancel()
+	if err := hookRunner.Shutdown(ctx); err != nil {
+		log.Printf("[WARN] Background hooks still running: %v", err)
+	}
+	hookRunner.Close()
 }
 
 //nolint:gocyclo
@@ -262,10 +464,195 @@ func getRunParams(flags *pflag.FlagSet, st *storage.Storage) *settings.Server {
 	_, disableExec := getParamB(flags, "disable-exec")
 	server.EnableExec = !disableExec
 
+	_, disableHookQueue := getParamB(flags, "disable-hook-queue")
+	server.EnableHookQueue = !disableHookQueue
+
+	_, server.HookDryRun = getParamB(flags, "hook-dry-run")
+	_, server.HookStrictValidation = getParamB(flags, "hook-strict-validation")
+	_, server.LoginBackoff = getParamB(flags, "login-backoff")
+
 	if val, set := getParamB(flags, "token-expiration-time"); set {
 		server.TokenExpirationTime = val
 	}
 
+	if val, set := getParamB(flags, "webdav-path"); set {
+		server.WebDAVPath = val
+	}
+
+	if val, set := getParamB(flags, "hook-timeout"); set {
+		server.HookTimeout = val
+	}
+
+	if val, set := getParamB(flags, "hook-dedup-window"); set {
+		server.HookDedupWindow = val
+	}
+
+	if val, set := getParamB(flags, "hook-log-format"); set {
+		server.HookLogFormat = val
+	}
+
+	if val, set := getParamB(flags, "tus-dir"); set {
+		server.TusDir = val
+	}
+
+	if val, set := getParamB(flags, "search-index"); set {
+		server.SearchIndex = val
+	}
+
+	if val, set := getParamB(flags, "hook-fallback-file"); set {
+		server.HookFallbackFile = val
+	}
+
+	if val, set := getParamB(flags, "hook-audit-file"); set {
+		server.HookAuditFile = val
+	}
+
+	if val, set := getParamB(flags, "hook-audit-list"); set {
+		server.HookAuditList = val
+	}
+
+	if val, set := getParamB(flags, "plugins-dir"); set {
+		server.PluginsDir = val
+	}
+
+	if val, set := getParamB(flags, "hook-executor"); set {
+		server.HookExecutor = val
+	}
+
+	if val, set := getParamB(flags, "hook-executor-ca"); set {
+		server.HookExecutorCA = val
+	}
+
+	getRedisParams(flags, &server.Redis)
+
+	if val, set := getParamB(flags, "hook-queue-backend"); set {
+		_, err := runner.ParseQueueBackend(val)
+		checkErr(err)
+		server.HookQueueBackend = val
+	}
+
+	if val, set := getParamB(flags, "hook-queue-partitions"); set {
+		partitions, err := strconv.Atoi(val)
+		checkErr(err)
+		server.HookQueuePartitions = partitions
+	}
+
+	if val, set := getParamB(flags, "max-background-hooks"); set {
+		maxBackgroundHooks, err := strconv.Atoi(val)
+		checkErr(err)
+		server.MaxBackgroundHooks = maxBackgroundHooks
+	}
+
+	if val, set := getParamB(flags, "thumbnail-size"); set {
+		thumbnailSize, err := strconv.Atoi(val)
+		checkErr(err)
+		server.ThumbnailSize = thumbnailSize
+	}
+
+	if val, set := getParamB(flags, "preview-size"); set {
+		previewSize, err := strconv.Atoi(val)
+		checkErr(err)
+		server.PreviewSize = previewSize
+	}
+
+	if val, set := getParamB(flags, "video-thumbnail-command"); set {
+		server.VideoThumbnailCommand = val
+	}
+
+	if val, set := getParamB(flags, "login-max-attempts"); set {
+		loginMaxAttempts, err := strconv.Atoi(val)
+		checkErr(err)
+		server.LoginMaxAttempts = loginMaxAttempts
+	}
+
+	if val, set := getParamB(flags, "login-max-attempts-per-ip"); set {
+		loginMaxAttemptsPerIP, err := strconv.Atoi(val)
+		checkErr(err)
+		server.LoginMaxAttemptsPerIP = loginMaxAttemptsPerIP
+	}
+
+	if val, set := getParamB(flags, "login-attempt-window"); set {
+		server.LoginAttemptWindow = val
+	}
+
+	if val, set := getParamB(flags, "login-lockout"); set {
+		server.LoginLockout = val
+	}
+
+	if val, set := getParamB(flags, "allowed-ips"); set {
+		server.AllowedIPs = val
+	}
+
+	if val, set := getParamB(flags, "denied-ips"); set {
+		server.DeniedIPs = val
+	}
+
+	if val, set := getParamB(flags, "admin-allowed-ips"); set {
+		server.AdminAllowedIPs = val
+	}
+
+	if val, set := getParamB(flags, "admin-denied-ips"); set {
+		server.AdminDeniedIPs = val
+	}
+
+	if val, set := getParamB(flags, "trusted-proxies"); set {
+		server.TrustedProxies = val
+	}
+
+	if val, set := getParamB(flags, "compression"); set {
+		server.Compression = val
+	}
+
+	if val, set := getParamB(flags, "compression-level"); set {
+		compressionLevel, err := strconv.Atoi(val)
+		checkErr(err)
+		server.CompressionLevel = compressionLevel
+	}
+
+	if val, set := getParamB(flags, "compression-min-size"); set {
+		compressionMinSize, err := strconv.Atoi(val)
+		checkErr(err)
+		server.CompressionMinSize = compressionMinSize
+	}
+
+	if val, set := getParamB(flags, "webhook-url"); set {
+		server.WebhookURL = val
+	}
+
+	if val, set := getParamB(flags, "webhook-secret"); set {
+		server.WebhookSecret = val
+	}
+
+	if val, set := getParamB(flags, "webhook-events"); set {
+		server.WebhookEvents = val
+	}
+
+	if val, set := getParamB(flags, "webhook-retries"); set {
+		webhookRetries, err := strconv.Atoi(val)
+		checkErr(err)
+		server.WebhookRetries = webhookRetries
+	}
+
+	if val, set := getParamB(flags, "webhook-backoff"); set {
+		server.WebhookBackoff = val
+	}
+
+	_, server.DirSizes = getParamB(flags, "dir-sizes")
+
+	if val, set := getParamB(flags, "dir-sizes-interval"); set {
+		server.DirSizesInterval = val
+	}
+
+	if val, set := getParamB(flags, "profile"); set {
+		server.Profile = val
+	}
+
+	if val, set := getParamB(flags, "max-hook-output-bytes"); set {
+		maxHookOutputBytes, err := strconv.ParseInt(val, 10, 64)
+		checkErr(err)
+		server.MaxHookOutputBytes = maxHookOutputBytes
+	}
+
 	return server
 }
 
@@ -425,3 +812,49 @@ func initConfig() {
 		cfgFile = "Using config file: " + v.ConfigFileUsed()
 	}
 }
+
+// getRedisParams reads the redis connection flags, and checks that the TLS
+// certificates can be loaded.
+func getRedisParams(flags *pflag.FlagSet, r *settings.Redis) {
+	if val, set := getParamB(flags, "redis.address"); set {
+		r.Address = val
+	}
+
+	if val, set := getParamB(flags, "redis.password"); set {
+		r.Password = val
+	}
+
+	if val, set := getParamB(flags, "redis.db"); set {
+		db, err := strconv.Atoi(val)
+		checkErr(err)
+		r.DB = db
+	}
+
+	if val, set := getParamB(flags, "redis.poolSize"); set {
+		poolSize, err := strconv.Atoi(val)
+		checkErr(err)
+		r.PoolSize = poolSize
+	}
+
+	switch {
+	case flags.Changed("redis.tls"):
+		r.TLS = mustGetBool(flags, "redis.tls")
+	case v.IsSet("redis.tls"):
+		r.TLS = v.GetBool("redis.tls")
+	}
+
+	if val, set := getParamB(flags, "redis.ca"); set {
+		r.CA = val
+	}
+
+	if val, set := getParamB(flags, "redis.cert"); set {
+		r.Cert = val
+	}
+
+	if val, set := getParamB(flags, "redis.key"); set {
+		r.Key = val
+	}
+
+	_, err := runner.RedisOptions(*r)
+	checkErr(err)
+}
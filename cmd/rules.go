@@ -75,18 +75,26 @@ func printRules(rulez []rules.Rule, id interface{}) {
 
 	for id, rule := range rulez {
 		fmt.Printf("(%d) ", id)
-		if rule.Regex {
-			if rule.Allow {
-				fmt.Printf("Allow Regex: \t%s\n", rule.Regexp.Raw)
-			} else {
-				fmt.Printf("Disallow Regex: \t%s\n", rule.Regexp.Raw)
-			}
-		} else {
-			if rule.Allow {
-				fmt.Printf("Allow Path: \t%s\n", rule.Path)
-			} else {
-				fmt.Printf("Disallow Path: \t%s\n", rule.Path)
+		action := "Disallow"
+		if rule.Allow {
+			action = "Allow"
+		}
+
+		flags := ""
+		if rule.IgnoreCase {
+			flags += " (ignore case)"
+		}
+
+		switch rule.Kind() {
+		case rules.TypeRegex:
+			if rule.Anchored {
+				flags += " (anchored)"
 			}
+			fmt.Printf("%s Regex: \t%s%s\n", action, rule.Regexp.Raw, flags)
+		case rules.TypeGlob:
+			fmt.Printf("%s Glob: \t%s%s\n", action, rule.Path, flags)
+		default:
+			fmt.Printf("%s Path: \t%s%s\n", action, rule.Path, flags)
 		}
 	}
 }
@@ -1,8 +1,6 @@
 package cmd
 
 import (
-	"regexp"
-
 	"github.com/spf13/cobra"
 
 	"github.com/filebrowser/filebrowser/v2/rules"
@@ -14,32 +12,41 @@ func init() {
 	rulesCmd.AddCommand(rulesAddCmd)
 	rulesAddCmd.Flags().BoolP("allow", "a", false, "indicates this is an allow rule")
 	rulesAddCmd.Flags().BoolP("regex", "r", false, "indicates this is a regex rule")
+	rulesAddCmd.Flags().BoolP("glob", "g", false, "indicates this is a glob rule")
+	rulesAddCmd.Flags().Bool("ignore-case", false, "matches the paths whatever their case")
+	rulesAddCmd.Flags().Bool("anchored", false, "matches the regex against the whole path")
 }
 
 var rulesAddCmd = &cobra.Command{
-	Use:   "add <path|expression>",
+	Use:   "add <path|pattern|expression>",
 	Short: "Add a global rule or user rule",
 	Long:  `Add a global rule or user rule.`,
 	Args:  cobra.ExactArgs(1),
 	Run: python(func(cmd *cobra.Command, args []string, d pythonData) {
 		allow := mustGetBool(cmd.Flags(), "allow")
 		regex := mustGetBool(cmd.Flags(), "regex")
+		glob := mustGetBool(cmd.Flags(), "glob")
 		exp := args[0]
 
-		if regex {
-			regexp.MustCompile(exp)
-		}
-
 		rule := rules.Rule{
-			Allow: allow,
-			Regex: regex,
+			Type:       rules.TypePath,
+			Allow:      allow,
+			Regex:      regex,
+			IgnoreCase: mustGetBool(cmd.Flags(), "ignore-case"),
+			Anchored:   mustGetBool(cmd.Flags(), "anchored"),
 		}
 
-		if regex {
+		switch {
+		case regex:
+			rule.Type = rules.TypeRegex
 			rule.Regexp = &rules.Regexp{Raw: exp}
-		} else {
+		case glob:
+			rule.Type = rules.TypeGlob
+			rule.Path = exp
+		default:
 			rule.Path = exp
 		}
+		checkErr(rule.Validate())
 
 		user := func(u *users.User) {
 			u.Rules = append(u.Rules, rule)
@@ -60,6 +60,12 @@ func parseUsernameOrID(arg string) (username string, id uint) {
 	return "", uint(id64)
 }
 
+// addUserLimitFlags adds the flags of the limits the users have of their
+// own only, not in the defaults: the global ones have the same names.
+func addUserLimitFlags(flags *pflag.FlagSet) {
+	flags.Int64("max-upload-size", 0, "bytes of the files the user can upload (the global one if 0, no limit if negative)")
+}
+
 func addUserFlags(flags *pflag.FlagSet) {
 	flags.Bool("perm.admin", false, "admin perm for users")
 	flags.Bool("perm.execute", true, "execute perm for users")
@@ -72,6 +78,12 @@ func addUserFlags(flags *pflag.FlagSet) {
 	flags.String("sorting.by", "name", "sorting mode (name, size or modified)")
 	flags.Bool("sorting.asc", false, "sorting by ascending order")
 	flags.Bool("lockPassword", false, "lock password")
+	flags.Int64("quota", 0, "bytes the user can store (no limit if 0)")
+	flags.Int("versions.count", 0, "previous versions kept of each file the user overwrites (no limit if 0, no versions if days is 0 too)")
+	flags.Int("versions.days", 0, "days the previous versions of the files are kept for (no limit if 0)")
+	flags.Bool("trash.enabled", false, "move the files the user deletes to a trash")
+	flags.Int("trash.days", 0, "days the deleted files are kept in the trash for (no limit if 0)")
+	flags.Uint("role", 0, "id of the role the permissions of the user come from (none if 0)")
 	flags.StringSlice("commands", nil, "a list of the commands a user can execute")
 	flags.String("scope", ".", "scope for users")
 	flags.String("locale", "en", "locale for users")
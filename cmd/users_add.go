@@ -3,12 +3,14 @@ package cmd
 import (
 	"github.com/spf13/cobra"
 
+	"github.com/filebrowser/filebrowser/v2/settings"
 	"github.com/filebrowser/filebrowser/v2/users"
 )
 
 func init() {
 	usersCmd.AddCommand(usersAddCmd)
 	addUserFlags(usersAddCmd.Flags())
+	addUserLimitFlags(usersAddCmd.Flags())
 }
 
 var usersAddCmd = &cobra.Command{
@@ -25,12 +27,35 @@ var usersAddCmd = &cobra.Command{
 		checkErr(err)
 
 		user := &users.User{
-			Username:     args[0],
-			Password:     password,
-			LockPassword: mustGetBool(cmd.Flags(), "lockPassword"),
+			Username:      args[0],
+			Password:      password,
+			LockPassword:  mustGetBool(cmd.Flags(), "lockPassword"),
+			Quota:         mustGetInt64(cmd.Flags(), "quota"),
+			MaxUploadSize: mustGetInt64(cmd.Flags(), "max-upload-size"),
+			Versions: users.Versioning{
+				Count: mustGetInt(cmd.Flags(), "versions.count"),
+				Days:  mustGetInt(cmd.Flags(), "versions.days"),
+			},
+			Trash: users.Trash{
+				Enabled: mustGetBool(cmd.Flags(), "trash.enabled"),
+				Days:    mustGetInt(cmd.Flags(), "trash.days"),
+			},
 		}
 
 		s.Defaults.Apply(user)
+		user.Role = mustGetUint(cmd.Flags(), "role")
+		if user.Role != 0 {
+			role, err := d.store.Roles.Get(user.Role)
+			checkErr(err)
+
+			// the permissions that aren't flags come from the role
+			defaults := settings.UserDefaults{Perm: role.Perm}
+			getUserDefaults(cmd.Flags(), &defaults, false)
+			user.Perm = defaults.Perm
+			if !cmd.Flags().Changed("scope") && role.Scope != "" {
+				user.Scope = role.UserScope(user.Username)
+			}
+		}
 
 		servSettings, err := d.store.Settings.GetServer()
 		checkErr(err)
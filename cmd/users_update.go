@@ -12,7 +12,11 @@ func init() {
 
 	usersUpdateCmd.Flags().StringP("password", "p", "", "new password")
 	usersUpdateCmd.Flags().StringP("username", "u", "", "new username")
+	usersUpdateCmd.Flags().Bool("reset-totp", false, "remove the two-factor authentication of the user")
+	usersUpdateCmd.Flags().Bool("revoke-tokens", false, "log the user out of all the sessions")
+	usersUpdateCmd.Flags().Bool("revoke-api-tokens", false, "revoke all the API tokens of the user")
 	addUserFlags(usersUpdateCmd.Flags())
+	addUserLimitFlags(usersUpdateCmd.Flags())
 }
 
 var usersUpdateCmd = &cobra.Command{
@@ -49,6 +53,15 @@ options you want to change.`,
 			Sorting:     user.Sorting,
 			Commands:    user.Commands,
 		}
+		if flags.Changed("role") {
+			user.Role = mustGetUint(flags, "role")
+			if user.Role != 0 {
+				// the permissions that aren't flags come from the new role
+				role, err := d.store.Roles.Get(user.Role) //nolint:govet
+				checkErr(err)
+				defaults.Perm = role.Perm
+			}
+		}
 		getUserDefaults(flags, &defaults, false)
 		user.Scope = defaults.Scope
 		user.Locale = defaults.Locale
@@ -58,6 +71,24 @@ options you want to change.`,
 		user.Commands = defaults.Commands
 		user.Sorting = defaults.Sorting
 		user.LockPassword = mustGetBool(flags, "lockPassword")
+		if flags.Changed("quota") {
+			user.Quota = mustGetInt64(flags, "quota")
+		}
+		if flags.Changed("max-upload-size") {
+			user.MaxUploadSize = mustGetInt64(flags, "max-upload-size")
+		}
+		if flags.Changed("versions.count") {
+			user.Versions.Count = mustGetInt(flags, "versions.count")
+		}
+		if flags.Changed("versions.days") {
+			user.Versions.Days = mustGetInt(flags, "versions.days")
+		}
+		if flags.Changed("trash.enabled") {
+			user.Trash.Enabled = mustGetBool(flags, "trash.enabled")
+		}
+		if flags.Changed("trash.days") {
+			user.Trash.Days = mustGetInt(flags, "trash.days")
+		}
 
 		if newUsername != "" {
 			user.Username = newUsername
@@ -68,6 +99,19 @@ options you want to change.`,
 			checkErr(err)
 		}
 
+		if mustGetBool(flags, "reset-totp") {
+			user.TOTP = users.TOTP{}
+		}
+
+		if mustGetBool(flags, "revoke-tokens") {
+			user.TokenVersion++
+			checkErr(d.store.Sessions.DeleteByUserID(user.ID))
+		}
+
+		if mustGetBool(flags, "revoke-api-tokens") {
+			checkErr(d.store.Tokens.DeleteByUserID(user.ID))
+		}
+
 		err = d.store.Users.Update(user)
 		checkErr(err)
 		printUsers([]*users.User{user})
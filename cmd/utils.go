@@ -37,6 +37,18 @@ func mustGetBool(flags *pflag.FlagSet, flag string) bool {
 	return b
 }
 
+func mustGetInt(flags *pflag.FlagSet, flag string) int {
+	i, err := flags.GetInt(flag)
+	checkErr(err)
+	return i
+}
+
+func mustGetInt64(flags *pflag.FlagSet, flag string) int64 {
+	i, err := flags.GetInt64(flag)
+	checkErr(err)
+	return i
+}
+
 func mustGetUint(flags *pflag.FlagSet, flag string) uint {
 	b, err := flags.GetUint(flag)
 	checkErr(err)
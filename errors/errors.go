@@ -8,6 +8,8 @@ var (
 	ErrNotExist             = errors.New("the resource does not exist")
 	ErrEmptyPassword        = errors.New("password is empty")
 	ErrEmptyUsername        = errors.New("username is empty")
+	ErrEmptyRoleName        = errors.New("role name is empty")
+	ErrInvalidRule          = errors.New("invalid rule")
 	ErrEmptyRequest         = errors.New("empty request")
 	ErrScopeIsRelative      = errors.New("scope is a relative path")
 	ErrInvalidDataType      = errors.New("invalid data type")
@@ -18,4 +20,6 @@ var (
 	ErrInvalidRequestParams = errors.New("invalid request params")
 	ErrSourceIsParent       = errors.New("source is parent")
 	ErrRootUserDeletion     = errors.New("user with id 1 can't be deleted")
+	ErrShareExhausted       = errors.New("the share has no downloads left")
+	ErrLocked               = errors.New("the resource is locked")
 )
@@ -12,7 +12,6 @@ import (
 	"io"
 	"io/fs"
 	"log"
-	"mime"
 	"net/http"
 	"os"
 	"path"
@@ -53,7 +52,24 @@ type FileInfo struct {
 	Checksums  map[string]string `json:"checksums,omitempty"`
 	Token      string            `json:"token,omitempty"`
 	currentDir []os.FileInfo     `json:"-"`
+	mimeTypes  map[string]string `json:"-"`
 	Resolution *ImageResolution  `json:"resolution,omitempty"`
+	// MimeType is the type the file is served with, from the overrides,
+	// the extension or the content.
+	MimeType string `json:"mimeType,omitempty"`
+	// Annotations are the ones the listing hooks gave to the file.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Lock is the one held on the file, if any.
+	Lock *Lock `json:"lock,omitempty"`
+	// DirSize is the total size of the files under a directory, when the
+	// sizes of the directories are shown and known.
+	DirSize *int64 `json:"dirSize,omitempty"`
+}
+
+// Lock tells who locked a file, and until when.
+type Lock struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
 }
 
 // FileOptions are the options when getting a file info.
@@ -66,6 +82,8 @@ type FileOptions struct {
 	Token      string
 	Checker    rules.Checker
 	Content    bool
+	// MimeTypes override the types of the extensions, see TypeByExtension.
+	MimeTypes map[string]string
 }
 
 type ImageResolution struct {
@@ -122,6 +140,7 @@ func stat(opts *FileOptions) (*FileInfo, error) {
 			Size:      info.Size(),
 			Extension: filepath.Ext(info.Name()),
 			Token:     opts.Token,
+			mimeTypes: opts.MimeTypes,
 		}
 	}
 
@@ -157,6 +176,7 @@ func stat(opts *FileOptions) (*FileInfo, error) {
 		Size:      info.Size(),
 		Extension: filepath.Ext(info.Name()),
 		Token:     opts.Token,
+		mimeTypes: opts.MimeTypes,
 	}
 
 	return file, nil
@@ -228,16 +248,19 @@ func (i *FileInfo) detectType(modify, saveContent, readHeader bool) error {
 	// of files couldn't be opened: we'd have immediately
 	// a 500 even though it doesn't matter. So we just log it.
 
-	mimetype := mime.TypeByExtension(i.Extension)
+	_, overridden := i.mimeTypes[strings.ToLower(i.Extension)]
+	mimetype := TypeByExtension(i.Extension, i.mimeTypes)
 
 	var buffer []byte
 	if readHeader {
 		buffer = i.readFirstBytes()
 
-		if mimetype == "" {
-			mimetype = http.DetectContentType(buffer)
+		sniffed := http.DetectContentType(buffer)
+		if mimetype == "" || (!overridden && misnamedText(mimetype, sniffed)) {
+			mimetype = sniffed
 		}
 	}
+	i.MimeType = mimetype
 
 	switch {
 	case strings.HasPrefix(mimetype, "video"):
@@ -432,9 +455,10 @@ func (i *FileInfo) readListing(checker rules.Checker, readHeader bool) error {
 			Extension:  filepath.Ext(name),
 			Path:       fPath,
 			currentDir: dir,
+			mimeTypes:  i.mimeTypes,
 		}
 
-		if !file.IsDir && strings.HasPrefix(mime.TypeByExtension(file.Extension), "image/") {
+		if !file.IsDir && strings.HasPrefix(TypeByExtension(file.Extension, i.mimeTypes), "image/") {
 			resolution, err := calculateImageResolution(file.Fs, file.Path)
 			if err != nil {
 				log.Printf("Error calculating resolution for image %s: %v", file.Path, err)
@@ -0,0 +1,33 @@
+package files
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// TypeByExtension returns the MIME type of an extension, such as ".md", the
+// overrides by lowercase extension coming before the types of the system.
+func TypeByExtension(ext string, overrides map[string]string) string {
+	if typ, ok := overrides[strings.ToLower(ext)]; ok {
+		return typ
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// misnamedText tells if the content sniffed as text of a file belies the
+// media type of its extension, such as the TypeScript files whose .ts is
+// the extension of the MPEG transport streams.
+func misnamedText(typ, sniffed string) bool {
+	return strings.HasPrefix(sniffed, "text/plain") &&
+		(strings.HasPrefix(typ, "video/") || strings.HasPrefix(typ, "audio/"))
+}
+
+// ContentType returns the MIME type of the file, the one detected with its
+// type or the one of its extension if it wasn't.
+func (i *FileInfo) ContentType() string {
+	if i.MimeType != "" {
+		return i.MimeType
+	}
+	return TypeByExtension(filepath.Ext(i.Name), i.mimeTypes)
+}
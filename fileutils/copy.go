@@ -37,3 +37,30 @@ func Copy(fs afero.Fs, src, dst string) error {
 
 	return CopyFile(fs, src, dst)
 }
+
+// CopyBetween copies a file or folder from a file system to another, like
+// the scopes of two users.
+func CopyBetween(srcFs afero.Fs, src string, dstFs afero.Fs, dst string) error {
+	info, err := srcFs.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return copyFileBetween(srcFs, src, dstFs, dst)
+	}
+
+	if err := dstFs.MkdirAll(dst, info.Mode()); err != nil {
+		return err
+	}
+	children, err := afero.ReadDir(srcFs, src)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := CopyBetween(srcFs, path.Join(src, child.Name()), dstFs, path.Join(dst, child.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package fileutils
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestCopyBetween(t *testing.T) {
+	t.Parallel()
+
+	src, dst := afero.NewMemMapFs(), afero.NewMemMapFs()
+	for name, content := range map[string]string{
+		"/dir/a.txt":     "a",
+		"/dir/sub/b.txt": "b",
+	} {
+		if err := afero.WriteFile(src, name, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := CopyBetween(src, "/dir", dst, "/shared/dir"); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"/shared/dir/a.txt":     "a",
+		"/shared/dir/sub/b.txt": "b",
+	} {
+		got, err := afero.ReadFile(dst, name)
+		if err != nil || string(got) != want {
+			t.Errorf("expected %s to be %q, got %q and %v", name, want, got, err)
+		}
+	}
+	if info, err := dst.Stat("/shared/dir/a.txt"); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("expected the mode to be copied, got %v and %v", info, err)
+	}
+
+	if err := CopyBetween(src, "/missing", dst, "/missing"); err == nil {
+		t.Error("expected missing files to fail")
+	}
+}
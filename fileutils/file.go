@@ -33,8 +33,12 @@ func MoveFile(fs afero.Fs, src, dst string) error {
 // CopyFile copies a file from source to dest and returns
 // an error if any.
 func CopyFile(fs afero.Fs, source, dest string) error {
+	return copyFileBetween(fs, source, fs, dest)
+}
+
+func copyFileBetween(srcFs afero.Fs, source string, dstFs afero.Fs, dest string) error {
 	// Open the source file.
-	src, err := fs.Open(source)
+	src, err := srcFs.Open(source)
 	if err != nil {
 		return err
 	}
@@ -42,13 +46,13 @@ func CopyFile(fs afero.Fs, source, dest string) error {
 
 	// Makes the directory needed to create the dst
 	// file.
-	err = fs.MkdirAll(filepath.Dir(dest), files.PermDir)
+	err = dstFs.MkdirAll(filepath.Dir(dest), files.PermDir)
 	if err != nil {
 		return err
 	}
 
 	// Create the destination file.
-	dst, err := fs.OpenFile(dest, os.O_RDWR|os.O_CREATE|os.O_TRUNC, files.PermFile)
+	dst, err := dstFs.OpenFile(dest, os.O_RDWR|os.O_CREATE|os.O_TRUNC, files.PermFile)
 	if err != nil {
 		return err
 	}
@@ -61,11 +65,11 @@ func CopyFile(fs afero.Fs, source, dest string) error {
 	}
 
 	// Copy the mode
-	info, err := fs.Stat(source)
+	info, err := srcFs.Stat(source)
 	if err != nil {
 		return err
 	}
-	err = fs.Chmod(dest, info.Mode())
+	err = dstFs.Chmod(dest, info.Mode())
 	if err != nil {
 		return err
 	}
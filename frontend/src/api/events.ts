@@ -0,0 +1,24 @@
+import { removePrefix } from "./utils";
+import { baseURL } from "@/utils/constants";
+import { useAuthStore } from "@/stores/auth";
+
+const types = ["create", "modify", "delete", "move"];
+
+// watch calls onchange with the changes of the files under a directory,
+// until the returned function is called.
+export function watch(url: string, onchange: (event: IFileEvent) => void) {
+  const authStore = useAuthStore();
+
+  const path = encodeURIComponent(removePrefix(url));
+  const source = new EventSource(
+    `${baseURL}/api/events?path=${path}&auth=${authStore.jwt}`
+  );
+
+  for (const type of types) {
+    source.addEventListener(type, (e) =>
+      onchange(JSON.parse((e as MessageEvent).data))
+    );
+  }
+
+  return () => source.close();
+}
@@ -1,4 +1,4 @@
-import { createURL, fetchURL, removePrefix } from "./utils";
+import { createURL, fetchURL, removePrefix, StatusError } from "./utils";
 import { baseURL } from "@/utils/constants";
 import { useAuthStore } from "@/stores/auth";
 import { upload as postTus, useTus } from "./tus";
@@ -150,24 +150,54 @@ async function postResources(
   });
 }
 
+// batch runs the operations in a single request, and throws the error of the
+// first one that failed once they all ran
+export async function batch(
+  operations: IBatchOperation[],
+  stopOnError = false
+) {
+  const res = await fetchURL(`/api/batch`, {
+    method: "POST",
+    body: JSON.stringify({ operations, stopOnError }),
+  });
+  const report = (await res.json()) as IBatchReport;
+
+  const failed = report.results.find((result) => result.error);
+  if (failed) {
+    throw new StatusError(`${failed.status} ${failed.error}`, failed.status);
+  }
+  return report;
+}
+
+// the batches take the paths, while the urls have their names encoded
+function batchPath(url: string) {
+  return decodeURIComponent(removePrefix(url));
+}
+
+export async function removeAll(urls: string[]) {
+  return batch(
+    urls.map((url): IBatchOperation => ({
+      action: "delete",
+      from: batchPath(url),
+    }))
+  );
+}
+
 function moveCopy(
   items: any[],
   copy = false,
   overwrite = false,
   rename = false
 ) {
-  const promises = [];
-
-  for (const item of items) {
-    const from = item.from;
-    const to = encodeURIComponent(removePrefix(item.to ?? ""));
-    const url = `${from}?action=${
-      copy ? "copy" : "rename"
-    }&destination=${to}&override=${overwrite}&rename=${rename}`;
-    promises.push(resourceAction(url, "PATCH"));
-  }
-
-  return Promise.all(promises);
+  return batch(
+    items.map((item): IBatchOperation => ({
+      action: copy ? "copy" : "rename",
+      from: batchPath(item.from),
+      to: batchPath(item.to ?? ""),
+      override: overwrite,
+      rename,
+    }))
+  );
 }
 
 export function move(items: any[], overwrite = false, rename = false) {
@@ -183,6 +213,35 @@ export async function checksum(url: string, algo: ChecksumAlg) {
   return (await data.json()).checksums[algo];
 }
 
+export async function versions(url: string) {
+  url = removePrefix(url);
+
+  const res = await fetchURL(`/api/versions${url}`, {});
+  return (await res.json()) as IFileVersion[];
+}
+
+export async function restoreVersion(url: string, id: string) {
+  url = removePrefix(url);
+
+  await fetchURL(`/api/versions${url}?id=${encodeURIComponent(id)}`, {
+    method: "POST",
+  });
+}
+
+export async function transfer(
+  action: "copy" | "move",
+  from: ITransferLocation,
+  to: ITransferLocation,
+  conflict: TransferConflict = ""
+): Promise<ITransferResult> {
+  const res = await fetchURL("/api/transfer", {
+    method: "POST",
+    body: JSON.stringify({ action, from, to, conflict }),
+  });
+
+  return res.json();
+}
+
 export function getDownloadURL(file: ResourceItem, inline: any) {
   const params = {
     ...(inline && { inline: "true" }),
@@ -2,8 +2,38 @@ import * as files from "./files";
 import * as share from "./share";
 import * as users from "./users";
 import * as settings from "./settings";
+import * as passkeys from "./passkeys";
+import * as totp from "./totp";
+import * as sessions from "./sessions";
+import * as tokens from "./tokens";
+import * as roles from "./roles";
+import * as events from "./events";
 import * as pub from "./pub";
+import * as trash from "./trash";
+import * as uploads from "./uploads";
+import * as plugins from "./plugins";
+import * as tasks from "./tasks";
+import * as locks from "./locks";
 import search from "./search";
 import commands from "./commands";
 
-export { files, share, users, settings, pub, commands, search };
+export {
+  files,
+  share,
+  users,
+  settings,
+  passkeys,
+  totp,
+  sessions,
+  tokens,
+  roles,
+  events,
+  pub,
+  trash,
+  uploads,
+  plugins,
+  tasks,
+  locks,
+  commands,
+  search,
+};
@@ -0,0 +1,26 @@
+import { fetchURL, fetchJSON } from "./utils";
+
+export function list() {
+  return fetchJSON<IFileLock[]>(`/api/locks`, {});
+}
+
+// the ttl is in seconds, the server default being used without one
+export function lock(path: string, ttl?: number) {
+  return fetchJSON<IFileLock>(`/api/locks`, {
+    method: "POST",
+    body: JSON.stringify({ path, ttl }),
+  });
+}
+
+export function refresh(token: string, ttl?: number) {
+  return fetchJSON<IFileLock>(`/api/locks/${token}`, {
+    method: "PUT",
+    body: JSON.stringify({ ttl }),
+  });
+}
+
+export async function unlock(token: string) {
+  await fetchURL(`/api/locks/${token}`, {
+    method: "DELETE",
+  });
+}
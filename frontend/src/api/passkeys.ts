@@ -0,0 +1,25 @@
+import { fetchURL, fetchJSON } from "./utils";
+import * as webauthn from "@/utils/webauthn";
+
+export async function list() {
+  return fetchJSON<IPasskey[]>(`/api/passkeys`, {});
+}
+
+export async function register(name: string) {
+  const begin = await fetchJSON<{ options: any; session: string }>(
+    `/api/passkeys/begin`,
+    { method: "POST" }
+  );
+  const credential = await webauthn.create(begin.options);
+
+  return fetchJSON<IPasskey>(`/api/passkeys`, {
+    method: "POST",
+    body: JSON.stringify({ name, session: begin.session, credential }),
+  });
+}
+
+export async function remove(id: string) {
+  await fetchURL(`/api/passkeys/${id}`, {
+    method: "DELETE",
+  });
+}
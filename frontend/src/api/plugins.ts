@@ -0,0 +1,5 @@
+import { fetchJSON } from "./utils";
+
+export function list() {
+  return fetchJSON<IPlugin[]>(`/api/plugins`, {});
+}
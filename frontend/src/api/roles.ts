@@ -0,0 +1,31 @@
+import { fetchURL, fetchJSON, StatusError } from "./utils";
+
+export async function getAll() {
+  return fetchJSON<IRole[]>(`/api/roles`, {});
+}
+
+export async function create(role: IRole) {
+  const res = await fetchURL(`/api/roles`, {
+    method: "POST",
+    body: JSON.stringify(role),
+  });
+
+  if (res.status === 201) {
+    return res.headers.get("Location");
+  }
+
+  throw new StatusError(await res.text(), res.status);
+}
+
+export async function update(role: IRole) {
+  await fetchURL(`/api/roles/${role.id}`, {
+    method: "PUT",
+    body: JSON.stringify(role),
+  });
+}
+
+export async function remove(id: number) {
+  await fetchURL(`/api/roles/${id}`, {
+    method: "DELETE",
+  });
+}
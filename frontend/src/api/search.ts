@@ -25,3 +25,19 @@ export default async function search(base: string, query: string) {
 
   return data;
 }
+
+// the admins search the scopes of the users, all of them if none is given
+export async function users(query: string, ids: number[] = []) {
+  const params = new URLSearchParams({ query });
+  if (ids.length > 0) {
+    params.set("users", ids.join(","));
+  }
+
+  const res = await fetchURL(`/api/admin/search?${params}`, {});
+  const text = await res.text();
+
+  return text
+    .split("\n")
+    .filter((line) => line !== "")
+    .map((line) => JSON.parse(line) as IAdminSearchResult);
+}
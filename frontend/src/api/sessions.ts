@@ -0,0 +1,17 @@
+import { fetchURL, fetchJSON } from "./utils";
+
+export async function list(userId: number) {
+  return fetchJSON<ISession[]>(`/api/users/${userId}/sessions`, {});
+}
+
+export async function remove(userId: number, id: string) {
+  await fetchURL(`/api/users/${userId}/sessions/${id}`, {
+    method: "DELETE",
+  });
+}
+
+export async function removeAll(userId: number) {
+  await fetchURL(`/api/users/${userId}/sessions`, {
+    method: "DELETE",
+  });
+}
@@ -10,3 +10,54 @@ export async function update(settings: ISettings) {
     body: JSON.stringify(settings),
   });
 }
+
+export function testHook(hook: IHookTest) {
+  return fetchJSON<IHookTestResult>(`/api/hooks/test`, {
+    method: "POST",
+    body: JSON.stringify(hook),
+  });
+}
+
+export function testRules(test: IRulesTest) {
+  return fetchJSON<IRulesTestResult>(`/api/rules/test`, {
+    method: "POST",
+    body: JSON.stringify(test),
+  });
+}
+
+export function signingKeys() {
+  return fetchJSON<ISigningKey[]>(`/api/settings/keys`, {});
+}
+
+// the overlap defaults to the expiration time of the tokens
+export function rotateSigningKey(algorithm: string, overlap = "") {
+  return fetchJSON<ISigningKey[]>(`/api/settings/keys`, {
+    method: "POST",
+    body: JSON.stringify({ algorithm, overlap }),
+  });
+}
+
+// the secrets are in the bundle only if they're encrypted with a passphrase
+export async function exportConfig(passphrase: string) {
+  const res = await fetchURL(`/api/config/export`, {
+    headers: passphrase ? { "X-Passphrase": passphrase } : {},
+  });
+  return res.blob();
+}
+
+export function importConfig(
+  bundle: string,
+  passphrase: string,
+  dryRun: boolean,
+  server: boolean
+) {
+  const query = new URLSearchParams({
+    dry_run: String(dryRun),
+    server: String(server),
+  });
+  return fetchJSON<IConfigImportReport>(`/api/config/import?${query}`, {
+    method: "POST",
+    headers: passphrase ? { "X-Passphrase": passphrase } : {},
+    body: bundle,
+  });
+}
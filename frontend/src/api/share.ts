@@ -19,7 +19,10 @@ export async function create(
   url: string,
   password = "",
   expires = "",
-  unit = "hours"
+  unit = "hours",
+  maxDownloads = 0,
+  maxRequestsPerMinute = 0,
+  maxBandwidth = 0
 ) {
   url = removePrefix(url);
   url = `/api/share${url}`;
@@ -27,11 +30,21 @@ export async function create(
     url += `?expires=${expires}&unit=${unit}`;
   }
   let body = "{}";
-  if (password != "" || expires !== "" || unit !== "hours") {
+  if (
+    password != "" ||
+    expires !== "" ||
+    unit !== "hours" ||
+    maxDownloads !== 0 ||
+    maxRequestsPerMinute !== 0 ||
+    maxBandwidth !== 0
+  ) {
     body = JSON.stringify({
       password: password,
       expires: expires.toString(), // backend expects string not number
       unit: unit,
+      maxDownloads: maxDownloads,
+      maxRequestsPerMinute: maxRequestsPerMinute,
+      maxBandwidth: maxBandwidth,
     });
   }
   return fetchJSON(url, {
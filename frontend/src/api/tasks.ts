@@ -0,0 +1,41 @@
+import { fetchURL, fetchJSON } from "./utils";
+
+export function list() {
+  return fetchJSON<IFileTask[]>(`/api/tasks`, {});
+}
+
+export function get(id: string) {
+  return fetchJSON<IFileTask>(`/api/tasks/${id}`, {});
+}
+
+// the existing files are left as conflicts of the task without a conflict
+export function create(
+  action: "copy" | "move",
+  from: string,
+  to: string,
+  conflict?: TaskConflictAction
+) {
+  return fetchJSON<IFileTask>(`/api/tasks`, {
+    method: "POST",
+    body: JSON.stringify({ action, from, to, conflict }),
+  });
+}
+
+// all the conflicts are resolved if none are given
+export function resolve(
+  id: string,
+  conflict: TaskConflictAction,
+  conflicts: string[] = []
+) {
+  return fetchJSON<IFileTask>(`/api/tasks/${id}/resolve`, {
+    method: "POST",
+    body: JSON.stringify({ conflict, conflicts }),
+  });
+}
+
+// a running task is canceled, a finished one forgotten
+export async function remove(id: string) {
+  await fetchURL(`/api/tasks/${id}`, {
+    method: "DELETE",
+  });
+}
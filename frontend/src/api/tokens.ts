@@ -0,0 +1,19 @@
+import { fetchURL, fetchJSON } from "./utils";
+
+export async function list(userId: number) {
+  return fetchJSON<IApiToken[]>(`/api/users/${userId}/tokens`, {});
+}
+
+export async function create(userId: number, token: IApiTokenRequest) {
+  const res = await fetchURL(`/api/users/${userId}/tokens`, {
+    method: "POST",
+    body: JSON.stringify(token),
+  });
+  return (await res.json()) as IApiToken & { secret: string };
+}
+
+export async function remove(userId: number, id: string) {
+  await fetchURL(`/api/users/${userId}/tokens/${id}`, {
+    method: "DELETE",
+  });
+}
@@ -0,0 +1,42 @@
+import { fetchURL, fetchJSON, StatusError } from "./utils";
+import { baseURL } from "@/utils/constants";
+
+export async function get() {
+  return fetchJSON<ITotpStatus>(`/api/totp`, {});
+}
+
+export async function enroll() {
+  return fetchJSON<ITotpEnrollment>(`/api/totp`, { method: "POST" });
+}
+
+// enrollLogin sets up the second factor of a user who must do it before
+// logging in, with their password instead of a token.
+export async function enrollLogin(username: string, password: string) {
+  const res = await fetch(`${baseURL}/api/login/totp`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify({ username, password }),
+  });
+
+  if (res.status !== 200) {
+    throw new StatusError(`${res.status} ${res.statusText}`, res.status);
+  }
+
+  return res.json() as Promise<ITotpEnrollment>;
+}
+
+export async function confirm(code: string) {
+  await fetchURL(`/api/totp`, {
+    method: "PUT",
+    body: JSON.stringify({ code }),
+  });
+}
+
+export async function remove(code: string) {
+  await fetchURL(`/api/totp`, {
+    method: "DELETE",
+    body: JSON.stringify({ code }),
+  });
+}
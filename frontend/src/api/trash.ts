@@ -0,0 +1,29 @@
+import { fetchURL, fetchJSON } from "./utils";
+
+export function list() {
+  return fetchJSON<ITrashItem[]>(`/api/trash`, {});
+}
+
+// an existing file is replaced if overridden, or kept if the item is
+// restored under another name
+export function restore(id: string, override = false, rename = false) {
+  const query = new URLSearchParams({
+    override: String(override),
+    rename: String(rename),
+  });
+  return fetchJSON<ITrashItem>(`/api/trash/${id}?${query}`, {
+    method: "POST",
+  });
+}
+
+export async function purge(id: string) {
+  await fetchURL(`/api/trash/${id}`, {
+    method: "DELETE",
+  });
+}
+
+export async function empty() {
+  await fetchURL(`/api/trash`, {
+    method: "DELETE",
+  });
+}
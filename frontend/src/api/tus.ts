@@ -28,14 +28,17 @@ export async function upload(
   filePath = removePrefix(filePath);
   const resourcePath = `${tusEndpoint}${filePath}?override=${overwrite}`;
 
-  await createUpload(resourcePath);
-
   const authStore = useAuthStore();
 
   // Exit early because of typescript, tus content can't be a string
   if (content === "") {
     return false;
   }
+
+  await createUpload(
+    resourcePath,
+    content instanceof Blob ? content.size : undefined
+  );
   return new Promise<void | string>((resolve, reject) => {
     const upload = new tus.Upload(content, {
       uploadUrl: `${baseURL}${resourcePath}`,
@@ -92,9 +95,18 @@ export async function upload(
   });
 }
 
-async function createUpload(resourcePath: string) {
+async function createUpload(resourcePath: string, size?: number) {
+  // the server finishes the upload once it received its length
+  const headers: Record<string, string> = { "Tus-Resumable": "1.0.0" };
+  if (size !== undefined) {
+    headers["Upload-Length"] = size.toString();
+  } else {
+    headers["Upload-Defer-Length"] = "1";
+  }
+
   const headResp = await fetchURL(resourcePath, {
     method: "POST",
+    headers,
   });
   if (headResp.status !== 201) {
     throw new Error(
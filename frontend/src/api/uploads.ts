@@ -0,0 +1,11 @@
+import { fetchJSON } from "./utils";
+
+// the admins can list the uploads of all the users
+export function list(all = false) {
+  const query = all ? "?all=true" : "";
+  return fetchJSON<IUploadStatus[]>(`/api/uploads${query}`, {});
+}
+
+export function get(id: string) {
+  return fetchJSON<IUploadStatus>(`/api/uploads/${id}`, {});
+}
@@ -9,6 +9,7 @@ import Settings from "@/views/Settings.vue";
 import GlobalSettings from "@/views/settings/Global.vue";
 import ProfileSettings from "@/views/settings/Profile.vue";
 import Shares from "@/views/settings/Shares.vue";
+import Trash from "@/views/settings/Trash.vue";
 import Errors from "@/views/Errors.vue";
 import { useAuthStore } from "@/stores/auth";
 import { baseURL, name } from "@/utils/constants";
@@ -23,6 +24,7 @@ const titles = {
   Settings: "sidebar.settings",
   ProfileSettings: "settings.profileSettings",
   Shares: "settings.shareManagement",
+  Trash: "settings.trash",
   GlobalSettings: "settings.globalSettings",
   Users: "settings.users",
   User: "settings.user",
@@ -87,6 +89,11 @@ const routes = [
             name: "Shares",
             component: Shares,
           },
+          {
+            path: "trash",
+            name: "Trash",
+            component: Trash,
+          },
           {
             path: "global",
             name: "GlobalSettings",
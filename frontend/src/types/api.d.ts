@@ -26,6 +26,10 @@ interface Share {
   userID?: number;
   token?: string;
   username?: string;
+  maxDownloads?: number;
+  downloads?: number;
+  maxRequestsPerMinute?: number;
+  maxBandwidth?: number;
 }
 
 interface SearchParams {
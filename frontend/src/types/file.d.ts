@@ -9,6 +9,25 @@ interface ResourceBase {
   isSymlink: boolean;
   type: ResourceType;
   url: string;
+  // the lock another user, or the user, holds on the file
+  lock?: IResourceLock;
+  // the total size of the files under a directory, when it's known
+  dirSize?: number;
+  // the type the file is served with
+  mimeType?: string;
+}
+
+interface IResourceLock {
+  owner: string;
+  expires: string; // ISO 8601 datetime
+}
+
+interface IFileLock extends IResourceLock {
+  // empty for the locks of the other users
+  token: string;
+  path: string;
+  ownerID: number;
+  created: string;
 }
 
 interface Resource extends ResourceBase {
@@ -26,6 +45,8 @@ interface Resource extends ResourceBase {
 interface ResourceItem extends ResourceBase {
   index: number;
   subtitles?: string[];
+  // set by the listing hooks, such as { scanned: "clean" }
+  annotations?: { [key: string]: string };
 }
 
 type ResourceType =
@@ -56,3 +77,94 @@ interface BreadCrumb {
   name: string;
   url: string;
 }
+
+interface IFileVersion {
+  id: string;
+  size: number;
+  modified: string;
+}
+
+interface IFileEvent {
+  type: "create" | "modify" | "delete" | "move";
+  path: string;
+  dst?: string;
+}
+
+interface ITransferLocation {
+  user: number;
+  path: string;
+}
+
+type TransferConflict = "" | "rename" | "overwrite" | "skip";
+
+interface ITransferResult {
+  path: string;
+  skipped: boolean;
+}
+
+interface IBatchOperation {
+  action: "delete" | "copy" | "move" | "rename";
+  from: string;
+  to?: string;
+  override?: boolean;
+  rename?: boolean;
+}
+
+interface IBatchResult {
+  action: string;
+  from: string;
+  to?: string;
+  status: number;
+  error?: string;
+  skipped?: boolean;
+}
+
+interface IBatchReport {
+  results: IBatchResult[];
+  succeeded: number;
+  failed: number;
+  skipped: number;
+}
+
+interface ITrashItem {
+  id: string;
+  path: string;
+  size: number;
+  isDir: boolean;
+  deleted: string;
+}
+
+// the last result of a failed search only has the error
+interface IAdminSearchResult {
+  user?: number;
+  username?: string;
+  path?: string;
+  dir?: boolean;
+  error?: string;
+}
+
+type TaskConflictAction = "skip" | "rename" | "overwrite";
+
+interface ITaskConflict {
+  path: string;
+  dst: string;
+  size: number;
+}
+
+interface IFileTask {
+  id: string;
+  userID: number;
+  action: "copy" | "move";
+  from: string;
+  to: string;
+  status: "running" | "done" | "failed" | "canceled";
+  size: number;
+  done: number;
+  files: number;
+  filesDone: number;
+  conflicts: ITaskConflict[];
+  warnings: string[];
+  error?: string;
+  created: string;
+  updated: string;
+}
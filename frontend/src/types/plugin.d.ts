@@ -0,0 +1,11 @@
+interface IPluginRoute {
+  method: string;
+  // relative to /api/plugins/<name>
+  path: string;
+  admin: boolean;
+}
+
+interface IPlugin {
+  name: string;
+  routes: IPluginRoute[];
+}
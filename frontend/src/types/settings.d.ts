@@ -1,13 +1,25 @@
 interface ISettings {
   signup: boolean;
   createUserDir: boolean;
+  enforceTotp: boolean;
+  readOnly: boolean;
+  maxUploadSize: number;
+  maxShareRequestsPerMinute: number;
+  maxShareBandwidth: number;
   userHomeBasePath: string;
   defaults: SettingsDefaults;
   rules: any[];
+  searchExclude: string[];
+  symlinkPolicy: "" | "deny" | "follow-within-scope" | "show-as-link";
+  mimeTypes: { [extension: string]: string };
   branding: SettingsBranding;
   tus: SettingsTus;
   shell: string[];
   commands: SettingsCommand;
+  commandTemplates: { [name: string]: ICommandTemplate };
+  dirHooks: boolean;
+  profiles: { [name: string]: { [setting: string]: any } };
+  profile: string;
 }
 
 interface SettingsDefaults {
@@ -18,6 +30,7 @@ interface SettingsDefaults {
   sorting: Sorting;
   perm: Permissions;
   commands: any[];
+  rules: IRule[];
   hideDotfiles: boolean;
   dateFormat: boolean;
 }
@@ -36,17 +49,52 @@ interface SettingsTus {
   retryCount: number;
 }
 
+type HookCommand =
+  | string
+  | { command: string; match?: string }
+  | { template: string; params?: { [name: string]: string }; match?: string };
+
+interface ICommandTemplate {
+  command: string;
+  params: ITemplateParam[];
+  description?: string;
+}
+
+interface ITemplateParam {
+  name: string;
+  default?: string;
+  required?: boolean;
+}
+
 interface SettingsCommand {
-  after_copy?: string[];
-  after_delete?: string[];
-  after_rename?: string[];
-  after_save?: string[];
-  after_upload?: string[];
-  before_copy?: string[];
-  before_delete?: string[];
-  before_rename?: string[];
-  before_save?: string[];
-  before_upload?: string[];
+  after_copy?: HookCommand[];
+  after_delete?: HookCommand[];
+  after_download?: HookCommand[];
+  after_move?: HookCommand[];
+  after_rename?: HookCommand[];
+  after_restore?: HookCommand[];
+  after_save?: HookCommand[];
+  after_trash?: HookCommand[];
+  after_upload?: HookCommand[];
+  before_copy?: HookCommand[];
+  before_delete?: HookCommand[];
+  before_download?: HookCommand[];
+  before_listing?: HookCommand[];
+  before_move?: HookCommand[];
+  before_rename?: HookCommand[];
+  before_restore?: HookCommand[];
+  before_save?: HookCommand[];
+  before_trash?: HookCommand[];
+  before_upload?: HookCommand[];
+  finally_copy?: HookCommand[];
+  finally_delete?: HookCommand[];
+  finally_download?: HookCommand[];
+  finally_move?: HookCommand[];
+  finally_rename?: HookCommand[];
+  finally_restore?: HookCommand[];
+  finally_save?: HookCommand[];
+  finally_trash?: HookCommand[];
+  finally_upload?: HookCommand[];
 }
 
 interface SettingsUnit {
@@ -55,3 +103,53 @@ interface SettingsUnit {
   GB: number;
   TB: number;
 }
+
+interface IHookTest {
+  command: string;
+  event?: string;
+  path?: string;
+  destination?: string;
+}
+
+interface IHookTestResult {
+  exitCode: number;
+  stdout: string;
+  stderr: string;
+  error?: string;
+}
+
+interface IRulesTest {
+  path: string;
+  user?: number;
+  rules?: IRule[];
+  globalRules?: IRule[];
+  hideDotfiles?: boolean;
+}
+
+interface IRulesTestResult {
+  allowed: boolean;
+  source: "" | "global" | "user" | "hidden";
+  index: number;
+  rule: IRule | null;
+}
+
+interface IConfigImportCounts {
+  created: number;
+  updated: number;
+}
+
+interface IConfigImportReport {
+  dryRun: boolean;
+  roles: IConfigImportCounts;
+  users: IConfigImportCounts;
+  shares: IConfigImportCounts;
+  warnings: string[];
+}
+
+interface ISigningKey {
+  id: string;
+  algorithm: string;
+  created: string;
+  expires: string;
+  current: boolean;
+}
@@ -49,3 +49,17 @@ interface ETAState {
   progress: Progress[];
   speedMbyte: number;
 }
+
+interface IUploadStatus {
+  id: string;
+  userID: number;
+  username: string;
+  path: string;
+  // -1 until the size of the file is known
+  length: number;
+  received: number;
+  started: string;
+  updated: string;
+  rate: number;
+  eta: number;
+}
@@ -13,6 +13,28 @@ interface IUser {
   dateFormat: boolean;
   viewMode: ViewModeType;
   sorting?: Sorting;
+  quota?: number;
+  maxUploadSize?: number;
+  role?: number;
+  versions?: IVersioning;
+  sharedFolders?: ISharedFolder[];
+  trash?: ITrash;
+}
+
+interface ISharedFolder {
+  path: string;
+  users: number[];
+  write: boolean;
+}
+
+interface ITrash {
+  enabled: boolean;
+  days: number;
+}
+
+interface IVersioning {
+  count: number;
+  days: number;
 }
 
 type ViewModeType = "list" | "mosaic" | "mosaic gallery";
@@ -30,6 +52,19 @@ interface IUserForm {
   hideDotfiles?: boolean;
   singleClick?: boolean;
   dateFormat?: boolean;
+  quota?: number;
+  maxUploadSize?: number;
+  role?: number;
+  versions?: IVersioning;
+  sharedFolders?: ISharedFolder[];
+  trash?: ITrash;
+}
+
+interface IRole {
+  id: number;
+  name: string;
+  perm: Permissions;
+  scope: string;
 }
 
 interface Permissions {
@@ -52,11 +87,16 @@ interface Sorting {
   asc: boolean;
 }
 
+type RuleType = "path" | "glob" | "regex";
+
 interface IRule {
+  type?: RuleType;
   allow: boolean;
   path: string;
   regex: boolean;
   regexp: IRegexp;
+  ignoreCase?: boolean;
+  anchored?: boolean;
 }
 
 interface IRegexp {
@@ -64,3 +104,52 @@ interface IRegexp {
 }
 
 type UserTheme = "light" | "dark" | "";
+
+interface IPasskey {
+  id: string;
+  name: string;
+  created: string;
+}
+
+interface ITotpStatus {
+  enabled: boolean;
+  enforced: boolean;
+  recoveryCodes: number;
+}
+
+interface ITotpEnrollment {
+  secret: string;
+  uri: string;
+  recoveryCodes: string[];
+}
+
+interface IUserUsage {
+  id: number;
+  username: string;
+  quota: number;
+  used: number;
+}
+
+interface ISession {
+  id: string;
+  device: string;
+  ip: string;
+  issuedAt: number;
+  lastSeen: number;
+  current: boolean;
+}
+
+interface IApiTokenRequest {
+  name: string;
+  perm: Partial<Permissions>;
+  scope: string;
+  expire: number;
+}
+
+interface IApiToken extends IApiTokenRequest {
+  id: string;
+  userID: number;
+  created: number;
+  lastUsed: number;
+  lastIP: string;
+}
@@ -3,6 +3,7 @@ import router from "@/router";
 import { JwtPayload, jwtDecode } from "jwt-decode";
 import { baseURL, noAuth } from "./constants";
 import { StatusError } from "@/api/utils";
+import * as webauthn from "./webauthn";
 
 export function parseToken(token: string) {
   // falsy or malformed jwt will throw InvalidTokenError
@@ -17,10 +18,20 @@ export function parseToken(token: string) {
   authStore.setUser(data.user);
 }
 
+// cookieToken returns the token left in the auth cookie by the callback
+// of the single sign-on.
+function cookieToken() {
+  const cookie = document.cookie
+    .split("; ")
+    .find((c) => c.startsWith("auth="));
+  return cookie ? cookie.substring("auth=".length) : "";
+}
+
 export async function validateLogin() {
   try {
-    if (localStorage.getItem("jwt")) {
-      await renew(<string>localStorage.getItem("jwt"));
+    const jwt = localStorage.getItem("jwt") || cookieToken();
+    if (jwt) {
+      await renew(jwt);
     }
   } catch (error) {
     console.warn("Invalid JWT token in storage"); // eslint-disable-line
@@ -31,9 +42,10 @@ export async function validateLogin() {
 export async function login(
   username: string,
   password: string,
-  recaptcha: string
+  recaptcha: string,
+  otp = ""
 ) {
-  const data = { username, password, recaptcha };
+  const data = { username, password, recaptcha, otp };
 
   const res = await fetch(`${baseURL}/api/login`, {
     method: "POST",
@@ -55,6 +67,45 @@ export async function login(
   }
 }
 
+export async function loginWithPasskey(username: string) {
+  const begin = await fetch(`${baseURL}/api/login/webauthn`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify({ username }),
+  });
+
+  if (begin.status !== 200) {
+    throw new StatusError(
+      (await begin.text()) || `${begin.status} ${begin.statusText}`,
+      begin.status
+    );
+  }
+
+  const { options, session } = await begin.json();
+  const credential = await webauthn.get(options);
+
+  const res = await fetch(`${baseURL}/api/login`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify({ username, session, credential }),
+  });
+
+  const body = await res.text();
+
+  if (res.status === 200) {
+    parseToken(body);
+  } else {
+    throw new StatusError(
+      body || `${res.status} ${res.statusText}`,
+      res.status
+    );
+  }
+}
+
 export async function renew(jwt: string) {
   const res = await fetch(`${baseURL}/api/renew`, {
     method: "POST",
@@ -11,10 +11,13 @@ const logoURL = `${staticURL}/img/logo.svg`;
 const noAuth: boolean = window.FileBrowser.NoAuth;
 const authMethod = window.FileBrowser.AuthMethod;
 const loginPage: boolean = window.FileBrowser.LoginPage;
+const passwordLogin: boolean = window.FileBrowser.PasswordLogin;
 const theme: UserTheme = window.FileBrowser.Theme;
 const enableThumbs: boolean = window.FileBrowser.EnableThumbs;
+const videoThumbs: boolean = window.FileBrowser.VideoThumbs;
 const resizePreview: boolean = window.FileBrowser.ResizePreview;
 const enableExec: boolean = window.FileBrowser.EnableExec;
+const readOnly: boolean = window.FileBrowser.ReadOnly;
 const tusSettings = window.FileBrowser.TusSettings;
 const origin = window.location.origin;
 const tusEndpoint = `/api/tus`;
@@ -32,10 +35,13 @@ export {
   noAuth,
   authMethod,
   loginPage,
+  passwordLogin,
   theme,
   enableThumbs,
+  videoThumbs,
   resizePreview,
   enableExec,
+  readOnly,
   tusSettings,
   origin,
   tusEndpoint,
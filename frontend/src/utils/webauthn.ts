@@ -0,0 +1,71 @@
+// The options of the server encode the binary fields in base64url, which
+// the browser API expects as buffers, and the other way around for its
+// answers.
+
+export function supported() {
+  return typeof window.PublicKeyCredential !== "undefined";
+}
+
+function decode(value: string): ArrayBuffer {
+  const base64 = value.replace(/-/g, "+").replace(/_/g, "/");
+  const binary = atob(base64.padEnd(Math.ceil(base64.length / 4) * 4, "="));
+  return Uint8Array.from(binary, (c) => c.charCodeAt(0)).buffer;
+}
+
+function encode(value: ArrayBuffer | null): string | null {
+  if (value === null) return null;
+  const binary = String.fromCharCode(...new Uint8Array(value));
+  return btoa(binary)
+    .replace(/\+/g, "-")
+    .replace(/\//g, "_")
+    .replace(/=+$/, "");
+}
+
+export async function create(options: any) {
+  const publicKey = options.publicKey;
+  publicKey.challenge = decode(publicKey.challenge);
+  publicKey.user.id = decode(publicKey.user.id);
+  publicKey.excludeCredentials = (publicKey.excludeCredentials || []).map(
+    (c: any) => ({ ...c, id: decode(c.id) })
+  );
+
+  const credential = (await navigator.credentials.create({
+    publicKey,
+  })) as PublicKeyCredential;
+  const response = credential.response as AuthenticatorAttestationResponse;
+
+  return {
+    id: credential.id,
+    rawId: encode(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: encode(response.clientDataJSON),
+      attestationObject: encode(response.attestationObject),
+    },
+  };
+}
+
+export async function get(options: any) {
+  const publicKey = options.publicKey;
+  publicKey.challenge = decode(publicKey.challenge);
+  publicKey.allowCredentials = (publicKey.allowCredentials || []).map(
+    (c: any) => ({ ...c, id: decode(c.id) })
+  );
+
+  const credential = (await navigator.credentials.get({
+    publicKey,
+  })) as PublicKeyCredential;
+  const response = credential.response as AuthenticatorAssertionResponse;
+
+  return {
+    id: credential.id,
+    rawId: encode(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: encode(response.clientDataJSON),
+      authenticatorData: encode(response.authenticatorData),
+      signature: encode(response.signature),
+      userHandle: encode(response.userHandle),
+    },
+  };
+}
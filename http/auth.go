@@ -12,7 +12,9 @@ import (
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/golang-jwt/jwt/v4/request"
 
+	"github.com/filebrowser/filebrowser/v2/auth"
 	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/settings"
 	"github.com/filebrowser/filebrowser/v2/users"
 )
 
@@ -20,6 +22,8 @@ const (
 	DefaultTokenExpirationTime = time.Hour * 2
 )
 
+var errUnknownTokenKey = errors.New("the token key is unknown or expired")
+
 type userInfo struct {
 	ID           uint              `json:"id"`
 	Locale       string            `json:"locale"`
@@ -34,6 +38,8 @@ type userInfo struct {
 
 type authToken struct {
 	User userInfo `json:"user"`
+	// Version is the TokenVersion of the user when the token was issued.
+	Version uint `json:"ver,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -66,12 +72,15 @@ func (e extractor) ExtractToken(r *http.Request) (string, error) {
 
 func withUser(fn handleFunc) handleFunc {
 	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
-		keyFunc := func(_ *jwt.Token) (interface{}, error) {
-			return d.settings.Key, nil
+		if plain, ok := bearerToken(r); ok {
+			if status, err := checkAPIToken(r, d, plain); status != 0 {
+				return status, err
+			}
+			return fn(w, r, d)
 		}
 
 		var tk authToken
-		token, err := request.ParseFromRequest(r, &extractor{}, keyFunc, request.WithClaims(&tk))
+		token, err := request.ParseFromRequest(r, &extractor{}, tokenKeyFunc(d.settings), request.WithClaims(&tk))
 
 		if err != nil || !token.Valid {
 			return http.StatusUnauthorized, nil
@@ -79,8 +88,11 @@ func withUser(fn handleFunc) handleFunc {
 
 		expired := !tk.VerifyExpiresAt(time.Now().Add(time.Hour), true)
 		updated := tk.IssuedAt != nil && tk.IssuedAt.Unix() < d.store.Users.LastUpdate(tk.User.ID)
+		// the tokens of the rotated keys are renewed during their overlap
+		kid, _ := token.Header["kid"].(string)
+		rotated := kid != d.settings.CurrentSigningKey().ID
 
-		if expired || updated {
+		if expired || updated || rotated {
 			w.Header().Add("X-Renew-Token", "true")
 		}
 
@@ -88,13 +100,49 @@ func withUser(fn handleFunc) handleFunc {
 		if err != nil {
 			return http.StatusInternalServerError, err
 		}
+		d.restrictReadOnly(d.user)
+		restrictAdmin(r, d.user)
+		// the token tells the interface which controls to show
+		if tk.User.Perm != d.user.Perm {
+			w.Header().Set("X-Renew-Token", "true")
+		}
+
+		// the tokens are revoked all at once by bumping the version, or
+		// one by one by deleting their session
+		if tk.Version != d.user.TokenVersion {
+			return http.StatusUnauthorized, nil
+		}
+		if tk.ID != "" {
+			d.session, err = checkSession(r, d, tk.ID)
+			if err != nil {
+				return errToStatus(err), err
+			}
+			if d.session == nil {
+				return http.StatusUnauthorized, nil
+			}
+		}
+
 		return fn(w, r, d)
 	}
 }
 
+// tokenKeyFunc returns the key verifying the tokens of the kid they name,
+// while it's the current key or in its overlap after a rotation, refusing
+// the ones signed with another algorithm.
+func tokenKeyFunc(set *settings.Settings) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := set.VerifyingKey(kid, time.Now())
+		if !ok || token.Method.Alg() != key.Algorithm {
+			return nil, errUnknownTokenKey
+		}
+		return key.VerifyKey()
+	}
+}
+
 func withAdmin(fn handleFunc) handleFunc {
 	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
-		if !d.user.Perm.Admin {
+		if adminBlocked(r) || !d.user.Perm.Admin {
 			return http.StatusForbidden, nil
 		}
 
@@ -113,6 +161,10 @@ func loginHandler(tokenExpireTime time.Duration) handleFunc {
 		switch {
 		case errors.Is(err, os.ErrPermission):
 			return http.StatusForbidden, nil
+		case errors.Is(err, auth.ErrTOTPRequired):
+			return http.StatusUnauthorized, nil
+		case errors.Is(err, auth.ErrTOTPEnrollment):
+			return http.StatusPreconditionRequired, nil
 		case err != nil:
 			return http.StatusInternalServerError, err
 		}
@@ -177,41 +229,66 @@ var signupHandler = func(_ http.ResponseWriter, r *http.Request, d *data) (int,
 }
 
 func renewHandler(tokenExpireTime time.Duration) handleFunc {
-	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	return withSessionUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 		w.Header().Set("X-Renew-Token", "false")
 		return printToken(w, r, d, d.user, tokenExpireTime)
 	})
 }
 
-func printToken(w http.ResponseWriter, _ *http.Request, d *data, user *users.User, tokenExpirationTime time.Duration) (int, error) {
+func printToken(w http.ResponseWriter, r *http.Request, d *data, user *users.User, tokenExpirationTime time.Duration) (int, error) {
+	signed, err := signToken(r, d, user, tokenExpirationTime)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	if _, err := w.Write([]byte(signed)); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return 0, nil
+}
+
+// signToken issues a token for a user, in a new session unless it's renewed.
+func signToken(r *http.Request, d *data, user *users.User, tokenExpirationTime time.Duration) (string, error) {
+	sess, err := issueSession(r, d, user, tokenExpirationTime)
+	if err != nil {
+		return "", err
+	}
+
+	perm := user.Perm
+	if d.settings.ReadOnly {
+		perm = perm.ReadOnly()
+	}
+
 	claims := &authToken{
 		User: userInfo{
 			ID:           user.ID,
 			Locale:       user.Locale,
 			ViewMode:     user.ViewMode,
 			SingleClick:  user.SingleClick,
-			Perm:         user.Perm,
+			Perm:         perm,
 			LockPassword: user.LockPassword,
 			Commands:     user.Commands,
 			HideDotfiles: user.HideDotfiles,
 			DateFormat:   user.DateFormat,
 		},
+		Version: user.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sess.ID,
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExpirationTime)),
 			Issuer:    "File Browser",
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString(d.settings.Key)
+	key := d.settings.CurrentSigningKey()
+	signKey, err := key.SignKey()
 	if err != nil {
-		return http.StatusInternalServerError, err
+		return "", err
 	}
-
-	w.Header().Set("Content-Type", "text/plain")
-	if _, err := w.Write([]byte(signed)); err != nil {
-		return http.StatusInternalServerError, err
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
 	}
-	return 0, nil
+	return token.SignedString(signKey)
 }
@@ -0,0 +1,26 @@
+package http
+
+import (
+	"log"
+	"net/http"
+)
+
+// backupGetHandler streams a snapshot of the database of the running
+// server, for the backups that can't stop it.
+var backupGetHandler = withAdmin(func(w http.ResponseWriter, _ *http.Request, d *data) (int, error) {
+	if d.store.DB == nil {
+		return http.StatusNotImplemented, nil
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="filebrowser.db"`)
+	w.Header().Set("Cache-Control", "no-store")
+	if n, err := d.store.DB.Backup(w); err != nil {
+		if n == 0 {
+			return http.StatusInternalServerError, err
+		}
+		// the status was sent with the start of the snapshot
+		log.Printf("Failed to back up the database: %v", err)
+	}
+	return 0, nil
+})
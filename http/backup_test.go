@@ -0,0 +1,61 @@
+package http
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/asdine/storm/v3"
+
+	"github.com/filebrowser/filebrowser/v2/storage/bolt"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestBackup(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	token := issueToken(t, st)
+	if res := serveSessions(t, st, backupGetHandler, token, nil); res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected the users to be refused, got %d", res.StatusCode)
+	}
+
+	user, err := st.Users.Get("", uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Perm = users.Permissions{Admin: true}
+	if err := st.Users.Update(user, "Perm"); err != nil {
+		t.Fatal(err)
+	}
+	res := serveSessions(t, st, backupGetHandler, token, nil)
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected the snapshot, got %d", res.StatusCode)
+	}
+
+	// the snapshot is a database of its own
+	path := filepath.Join(t.TempDir(), "backup.db")
+	fd, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fd.ReadFrom(res.Body); err != nil {
+		t.Fatal(err)
+	}
+	fd.Close()
+
+	db, err := storm.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	backup, err := bolt.NewStorage(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, err := backup.Users.Get("", "username"); err != nil || !u.Perm.Admin {
+		t.Errorf("expected the users in the snapshot, got %v", err)
+	}
+}
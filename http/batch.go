@@ -0,0 +1,132 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+)
+
+// maxBatchOperations is the number of operations a batch can have.
+const maxBatchOperations = 1000
+
+// batchOperation is an operation of a batch, on a path of the scope of the
+// user. The copies, moves and renames have a destination, and handle the
+// existing ones like the PATCH requests of the resources.
+type batchOperation struct {
+	// Action is delete, copy, move or rename.
+	Action   string `json:"action"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Override bool   `json:"override"`
+	Rename   bool   `json:"rename"`
+}
+
+type batchRequest struct {
+	Operations []batchOperation `json:"operations"`
+	// StopOnError skips the operations following the first one that fails.
+	StopOnError bool `json:"stopOnError"`
+}
+
+// batchResult is the outcome of an operation, with the status its own
+// request would have returned.
+type batchResult struct {
+	Action string `json:"action"`
+	From   string `json:"from"`
+	// To is the destination, renamed if the destinations are.
+	To      string `json:"to,omitempty"`
+	Status  int    `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Skipped bool   `json:"skipped,omitempty"`
+}
+
+type batchReport struct {
+	Results   []batchResult `json:"results"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Skipped   int           `json:"skipped"`
+}
+
+// batchSucceeded tells if the status of an operation is a success.
+func batchSucceeded(status int) bool {
+	return status >= 200 && status < 300
+}
+
+// batchHandler runs the operations of a batch in order, each running its
+// own hooks, and reports the outcome of each. They aren't undone when the
+// others fail. The report is sent whatever the outcomes, with 200 if they
+// all succeeded and 207 otherwise. The errors are only logged, the report
+// giving the text of their status.
+func batchHandler(fileCache FileCache) handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		var req batchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return http.StatusBadRequest, err
+		}
+		if len(req.Operations) == 0 || len(req.Operations) > maxBatchOperations {
+			return http.StatusBadRequest, fbErrors.ErrInvalidRequestParams
+		}
+
+		report := batchReport{Results: make([]batchResult, 0, len(req.Operations))}
+		stopped := false
+		for _, op := range req.Operations {
+			result := batchResult{Action: op.Action, From: op.From, To: op.To}
+			if stopped || r.Context().Err() != nil {
+				result.Skipped = true
+				report.Skipped++
+				report.Results = append(report.Results, result)
+				continue
+			}
+
+			var err error
+			result.To, result.Status, err = runBatchOperation(r, d, fileCache, op)
+			if batchSucceeded(result.Status) {
+				report.Succeeded++
+			} else {
+				result.Error = http.StatusText(result.Status)
+				if err != nil {
+					log.Printf("%s: %s %s: %v", r.URL.Path, op.Action, op.From, err)
+				}
+				report.Failed++
+				stopped = req.StopOnError
+			}
+			report.Results = append(report.Results, result)
+		}
+
+		if report.Failed > 0 || report.Skipped > 0 {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusMultiStatus)
+			if err := json.NewEncoder(w).Encode(report); err != nil {
+				return http.StatusInternalServerError, err
+			}
+			return 0, nil
+		}
+		return renderJSON(w, r, report)
+	})
+}
+
+// runBatchOperation runs an operation like its own request would, returning
+// its destination and status.
+func runBatchOperation(r *http.Request, d *data, fileCache FileCache, op batchOperation) (string, int, error) {
+	src := path.Clean("/" + op.From)
+	switch op.Action {
+	case "delete":
+		status, err := deleteResource(r.Context(), d, fileCache, src)
+		return "", status, err
+	case "copy", "move", "rename":
+		if op.To == "" {
+			return "", http.StatusBadRequest, fbErrors.ErrInvalidRequestParams
+		}
+
+		// the moves are renames to another directory
+		action := op.Action
+		if action == "move" {
+			action = "rename"
+		}
+		return patchResource(r.Context(), d, fileCache, action, src, path.Clean("/"+op.To), op.Override, op.Rename)
+	default:
+		return op.To, http.StatusBadRequest, fbErrors.ErrInvalidRequestParams
+	}
+}
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestBatchHandler(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	user, err := st.Users.Get("", uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Perm = users.Permissions{Create: true, Rename: true, Modify: true, Delete: true}
+	if err := st.Users.Update(user, "Perm"); err != nil {
+		t.Fatal(err)
+	}
+	token := issueToken(t, st)
+
+	root := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "dir/d.txt"} {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(root, filepath.FromSlash(name)))
+		return err == nil
+	}
+	serve := func(req batchRequest) (int, batchReport) {
+		t.Helper()
+
+		body, _ := json.Marshal(req)
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		r.Header.Set("X-Auth", token)
+
+		recorder := httptest.NewRecorder()
+		handle(batchHandler(&memoryCache{values: map[string][]byte{}}), "", st, &settings.Server{Root: root}, nil).ServeHTTP(recorder, r)
+
+		var report batchReport
+		_ = json.Unmarshal(recorder.Body.Bytes(), &report)
+		return recorder.Code, report
+	}
+
+	code, report := serve(batchRequest{Operations: []batchOperation{
+		{Action: "copy", From: "/a.txt", To: "/dir/a.txt"},
+		{Action: "move", From: "/b.txt", To: "/dir/b.txt"},
+		{Action: "copy", From: "/c.txt", To: "/dir/d.txt"},
+		{Action: "copy", From: "/c.txt", To: "/dir/d.txt", Rename: true},
+		{Action: "delete", From: "/missing.txt"},
+		{Action: "delete", From: "/c.txt"},
+		{Action: "chmod", From: "/a.txt"},
+	}})
+	if code != http.StatusMultiStatus || report.Succeeded != 4 || report.Failed != 3 {
+		t.Fatalf("expected 4 successes and 3 failures, got %d and %+v", code, report)
+	}
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusConflict, http.StatusOK,
+		http.StatusNotFound, http.StatusNoContent, http.StatusBadRequest} {
+		if got := report.Results[i].Status; got != want {
+			t.Errorf("expected operation %d to return %d, got %d", i, want, got)
+		}
+		if got := report.Results[i].Error; !batchSucceeded(want) && got != http.StatusText(want) {
+			t.Errorf("expected operation %d to fail with the text of its status, got %q", i, got)
+		}
+	}
+	if report.Results[3].To != "/dir/d(1).txt" {
+		t.Errorf("expected the copy to be renamed, got %q", report.Results[3].To)
+	}
+	for name, want := range map[string]bool{
+		"a.txt": true, "dir/a.txt": true, "b.txt": false, "dir/b.txt": true,
+		"dir/d(1).txt": true, "c.txt": false,
+	} {
+		if exists(name) != want {
+			t.Errorf("expected %s to exist: %t", name, want)
+		}
+	}
+
+	// the operations following a failure can be skipped
+	code, report = serve(batchRequest{StopOnError: true, Operations: []batchOperation{
+		{Action: "delete", From: "/"},
+		{Action: "delete", From: "/a.txt"},
+	}})
+	if code != http.StatusMultiStatus || report.Failed != 1 || report.Skipped != 1 || !report.Results[1].Skipped || !exists("a.txt") {
+		t.Errorf("expected the delete to be skipped, got %d and %+v", code, report)
+	}
+
+	code, report = serve(batchRequest{Operations: []batchOperation{{Action: "delete", From: "/a.txt"}}})
+	if code != http.StatusOK || report.Succeeded != 1 || exists("a.txt") {
+		t.Errorf("expected the file to be deleted, got %d and %+v", code, report)
+	}
+}
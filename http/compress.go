@@ -0,0 +1,289 @@
+package http
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+// The compression algorithms of the responses, by their Content-Encoding.
+const (
+	compressionGzip   = "gzip"
+	compressionBrotli = "br"
+)
+
+// encoder is a gzip or a brotli writer.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressor compresses the responses of the clients accepting one of its
+// algorithms, the first ones being preferred.
+type compressor struct {
+	algorithms []string
+	minSize    int
+	pools      map[string]*sync.Pool
+}
+
+func newCompressor(server *settings.Server) (*compressor, error) {
+	c := &compressor{minSize: server.GetCompressionMinSize(), pools: map[string]*sync.Pool{}}
+	level := server.CompressionLevel
+
+	for _, algorithm := range strings.FieldsFunc(server.Compression, func(r rune) bool { return r == ',' || r == ' ' }) {
+		var newEncoder func() encoder
+		switch algorithm {
+		case compressionGzip:
+			if level < 0 || level > gzip.BestCompression {
+				return nil, fmt.Errorf("invalid gzip compression level %d", level)
+			}
+			gzipLevel := level
+			if gzipLevel == 0 {
+				gzipLevel = gzip.DefaultCompression
+			}
+			newEncoder = func() encoder {
+				w, _ := gzip.NewWriterLevel(io.Discard, gzipLevel)
+				return w
+			}
+		case compressionBrotli:
+			if level < 0 || level > brotli.BestCompression {
+				return nil, fmt.Errorf("invalid brotli compression level %d", level)
+			}
+			brotliLevel := level
+			if brotliLevel == 0 {
+				brotliLevel = brotli.DefaultCompression
+			}
+			newEncoder = func() encoder {
+				return brotli.NewWriterLevel(io.Discard, brotliLevel)
+			}
+		default:
+			return nil, fmt.Errorf("unknown compression algorithm %q", algorithm)
+		}
+
+		if _, ok := c.pools[algorithm]; !ok {
+			c.algorithms = append(c.algorithms, algorithm)
+			c.pools[algorithm] = &sync.Pool{New: func() interface{} { return newEncoder() }}
+		}
+	}
+	return c, nil
+}
+
+// enabled tells if any algorithm is set.
+func (c *compressor) enabled() bool {
+	return len(c.algorithms) > 0
+}
+
+// negotiate returns the algorithm of the Accept-Encoding header with the
+// highest weight, the preferred one among the equal ones, or an empty
+// string if none is accepted.
+func (c *compressor) negotiate(accept string) string {
+	weights := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		weight := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+		if name != "" {
+			weights[strings.ToLower(name)] = weight
+		}
+	}
+
+	best, bestWeight := "", 0.0
+	for _, algorithm := range c.algorithms {
+		weight, ok := weights[algorithm]
+		if !ok {
+			weight = weights["*"]
+		}
+		if weight > bestWeight {
+			best, bestWeight = algorithm, weight
+		}
+	}
+	return best
+}
+
+// middleware compresses the responses of the clients accepting it, once
+// they're known to be at least minSize long and compressible. The ranges
+// and the HEAD requests are left as they are, their lengths being the ones
+// of the files.
+func (c *compressor) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		algorithm := c.negotiate(r.Header.Get("Accept-Encoding"))
+		if algorithm == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, c: c, algorithm: algorithm}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// incompressible are the media types that are compressed already, or that
+// are streamed.
+var incompressible = map[string]bool{
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/zip":              true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/vnd.rar":          true,
+	"application/zstd":             true,
+	"application/pdf":              true,
+	"application/octet-stream":     true,
+	"font/woff":                    true,
+	"font/woff2":                   true,
+	"text/event-stream":            true,
+}
+
+// compressible tells if the responses of a media type are worth
+// compressing.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if mediaType == "image/svg+xml" {
+		return true
+	}
+	for _, prefix := range []string{"image/", "video/", "audio/"} {
+		if strings.HasPrefix(mediaType, prefix) {
+			return false
+		}
+	}
+	return !incompressible[mediaType]
+}
+
+// compressWriter buffers the start of a response until it knows if it's
+// compressed.
+type compressWriter struct {
+	http.ResponseWriter
+	c         *compressor
+	algorithm string
+	status    int
+	buf       []byte
+	decided   bool
+	enc       encoder
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if status < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.c.minSize {
+			return len(p), nil
+		}
+		if err := cw.decide(false); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide writes the headers, compressing the response if it's long enough,
+// or streamed, and compressible, and the buffered start of the response.
+func (cw *compressWriter) decide(streamed bool) error {
+	cw.decided = true
+	header := cw.Header()
+	if header.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		// the sniffing of net/http would see the compressed bytes
+		header.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	compress := (streamed || len(cw.buf) >= cw.c.minSize) &&
+		cw.status != http.StatusNoContent && cw.status != http.StatusPartialContent &&
+		cw.status != http.StatusNotModified &&
+		header.Get("Content-Encoding") == "" && header.Get("Content-Range") == "" &&
+		compressible(header.Get("Content-Type"))
+
+	if compress {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", cw.algorithm)
+		// the compressed bytes aren't the ones of the strong tag
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		cw.enc = cw.c.pools[cw.algorithm].Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+
+	if cw.status != 0 {
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.enc != nil {
+		_, err := cw.enc.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush writes what was compressed so far, for the streamed responses.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		_ = cw.decide(true)
+	}
+	if cw.enc != nil {
+		_ = cw.enc.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the original writer.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close ends the response, giving the encoder back.
+func (cw *compressWriter) Close() {
+	if !cw.decided && (cw.status != 0 || len(cw.buf) > 0) {
+		_ = cw.decide(false)
+	}
+	if cw.enc == nil {
+		return
+	}
+	_ = cw.enc.Close()
+	cw.enc.Reset(io.Discard)
+	cw.c.pools[cw.algorithm].Put(cw.enc)
+	cw.enc = nil
+}
@@ -0,0 +1,122 @@
+package http
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+func TestCompressorNegotiate(t *testing.T) {
+	c, err := newCompressor(&settings.Server{Compression: "br, gzip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for accept, want := range map[string]string{
+		"":                        "",
+		"gzip":                    "gzip",
+		"gzip, deflate, br":       "br",
+		"gzip;q=1.0, br;q=0.5":    "gzip",
+		"br;q=0, gzip":            "gzip",
+		"*":                       "br",
+		"*;q=0.5, gzip":           "gzip",
+		"identity, deflate":       "",
+		"GZIP;q=0.8, br;q=broken": "gzip",
+	} {
+		if got := c.negotiate(accept); got != want {
+			t.Errorf("negotiate(%q) = %q, want %q", accept, got, want)
+		}
+	}
+
+	for _, server := range []*settings.Server{
+		{Compression: "zstd"},
+		{Compression: "gzip", CompressionLevel: 10},
+		{Compression: "br", CompressionLevel: 12},
+	} {
+		if _, err := newCompressor(server); err == nil {
+			t.Errorf("expected %q at level %d to be refused", server.Compression, server.CompressionLevel)
+		}
+	}
+}
+
+func TestCompressorMiddleware(t *testing.T) {
+	c, err := newCompressor(&settings.Server{Compression: "br,gzip", CompressionMinSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("compressible text ", 100)
+	handler := c.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+		case "/encoded":
+			w.Header().Set("Content-Encoding", "gzip")
+		case "/short":
+			_, _ = io.WriteString(w, "short")
+			return
+		case "/stream":
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			_, _ = io.WriteString(w, "{}\n")
+			w.(http.Flusher).Flush()
+		}
+		w.Header().Set("ETag", `"tag"`)
+		_, _ = io.WriteString(w, long)
+	}))
+
+	for _, tc := range []struct {
+		path, accept, rng string
+		encoding          string
+	}{
+		{"/", "gzip", "", "gzip"},
+		{"/", "gzip, br", "", "br"},
+		{"/", "", "", ""},
+		{"/", "gzip", "bytes=0-10", ""},
+		{"/image", "gzip", "", ""},
+		{"/encoded", "br", "", "gzip"},
+		{"/short", "gzip", "", ""},
+		{"/stream", "gzip", "", "gzip"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		r.Header.Set("Accept-Encoding", tc.accept)
+		if tc.rng != "" {
+			r.Header.Set("Range", tc.rng)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+
+		res := recorder.Result()
+		if got := res.Header.Get("Content-Encoding"); got != tc.encoding {
+			t.Errorf("%s with %q: expected the encoding %q, got %q", tc.path, tc.accept, tc.encoding, got)
+			continue
+		}
+		if res.Header.Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s: expected to vary with the accepted encodings", tc.path)
+		}
+		if tc.path != "/" || tc.encoding == "" {
+			continue
+		}
+
+		var body io.Reader = recorder.Body
+		if tc.encoding == compressionGzip {
+			if body, err = gzip.NewReader(body); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			body = brotli.NewReader(body)
+		}
+		content, err := io.ReadAll(body)
+		if err != nil || string(content) != long {
+			t.Errorf("expected the %s body to decompress, got %v", tc.encoding, err)
+		}
+		if res.Header.Get("ETag") != `W/"tag"` || res.Header.Get("Content-Type") == "" {
+			t.Errorf("expected a weak tag and the sniffed type, got %q and %q",
+				res.Header.Get("ETag"), res.Header.Get("Content-Type"))
+		}
+	}
+}
@@ -0,0 +1,580 @@
+package http
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/filebrowser/filebrowser/v2/auth"
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/rules"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/share"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// configBundleVersion is the version of the bundles that are exported. The
+// older ones are imported too.
+const configBundleVersion = 1
+
+// configPassphraseHeader has the passphrase the secrets of a bundle are
+// encrypted with.
+const configPassphraseHeader = "X-Passphrase"
+
+var errWrongPassphrase = errors.New("wrong passphrase")
+
+// configBundle is the whole configuration of a server. The key of the
+// settings isn't in it, and the secrets, the password hashes of the users
+// and the shares, the TOTP secrets and the secrets of the server and of the
+// auth method, are encrypted with a passphrase or left out.
+type configBundle struct {
+	Version  int                `json:"version"`
+	Settings *settings.Settings `json:"settings"`
+	Server   *settings.Server   `json:"server"`
+	Auther   json.RawMessage    `json:"auther"`
+	Roles    []*users.Role      `json:"roles"`
+	Users    []*users.User      `json:"users"`
+	Shares   []*share.Link      `json:"shares"`
+	// Salt derives the key of the secrets from the passphrase, none if the
+	// secrets were left out.
+	Salt []byte `json:"salt,omitempty"`
+}
+
+type importCounts struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+}
+
+type importReport struct {
+	DryRun   bool         `json:"dryRun"`
+	Roles    importCounts `json:"roles"`
+	Users    importCounts `json:"users"`
+	Shares   importCounts `json:"shares"`
+	Warnings []string     `json:"warnings"`
+}
+
+var configExportHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	bundle, err := exportConfig(d, r.Header.Get(configPassphraseHeader))
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="filebrowser-config.json"`)
+	return renderJSON(w, r, bundle)
+})
+
+var configImportHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	if r.Body == nil {
+		return http.StatusBadRequest, fbErrors.ErrEmptyRequest
+	}
+
+	var bundle configBundle
+	if err := json.NewDecoder(r.Body).Decode(&bundle); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	withServer, _ := strconv.ParseBool(r.URL.Query().Get("server"))
+
+	report, err := importConfig(d, &bundle, r.Header.Get(configPassphraseHeader), dryRun, withServer)
+	if errors.Is(err, errWrongPassphrase) {
+		return http.StatusForbidden, err
+	}
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	return renderJSON(w, r, report)
+})
+
+func exportConfig(d *data, passphrase string) (*configBundle, error) {
+	bundle := &configBundle{Version: configBundleVersion}
+
+	var key []byte
+	if passphrase != "" {
+		bundle.Salt = make([]byte, 16) //nolint:gomnd
+		if _, err := rand.Read(bundle.Salt); err != nil {
+			return nil, err
+		}
+
+		var err error
+		if key, err = bundleKey(passphrase, bundle.Salt); err != nil {
+			return nil, err
+		}
+	}
+
+	stored, err := storedSettings(d)
+	if err != nil {
+		return nil, err
+	}
+	set := *stored
+	set.Key, set.SigningKeys = nil, nil
+	bundle.Settings = &set
+	server := *d.server
+	if err := sealSecrets(key, serverSecrets(&server)); err != nil {
+		return nil, err
+	}
+	bundle.Server = &server
+
+	auther, err := d.store.Auth.Get(d.settings.AuthMethod)
+	if err != nil {
+		return nil, err
+	}
+	if err := sealSecrets(key, authSecrets(auther)); err != nil {
+		return nil, err
+	}
+	if bundle.Auther, err = json.Marshal(auther); err != nil {
+		return nil, err
+	}
+
+	if bundle.Roles, err = d.store.Roles.Gets(); err != nil && !errors.Is(err, fbErrors.ErrNotExist) {
+		return nil, err
+	}
+
+	all, err := d.store.Users.Gets(d.server.Root)
+	if err != nil && !errors.Is(err, fbErrors.ErrNotExist) {
+		return nil, err
+	}
+	for _, u := range all {
+		if err := sealUser(u, d.settings.Key, key); err != nil {
+			return nil, err
+		}
+		bundle.Users = append(bundle.Users, u)
+	}
+
+	links, err := d.store.Share.All()
+	if err != nil && !errors.Is(err, fbErrors.ErrNotExist) {
+		return nil, err
+	}
+	for _, link := range links {
+		if link.PasswordHash != "" {
+			// the protected shares would be public without their password
+			if key == nil {
+				continue
+			}
+			if link.PasswordHash, err = sealSecret(key, link.PasswordHash); err != nil {
+				return nil, err
+			}
+			if link.Token, err = sealSecret(key, link.Token); err != nil {
+				return nil, err
+			}
+		}
+		bundle.Shares = append(bundle.Shares, link)
+	}
+
+	return bundle, nil
+}
+
+// sealUser encrypts the password hash of a user and its TOTP secret, which
+// is decrypted with the key of the settings first, or leaves them out if
+// there's no key.
+func sealUser(u *users.User, settingsKey, key []byte) error {
+	if key == nil {
+		u.Password = ""
+		u.TOTP = users.TOTP{}
+		return nil
+	}
+
+	var err error
+	if u.Password, err = sealSecret(key, u.Password); err != nil {
+		return err
+	}
+
+	if u.TOTP.Secret != "" {
+		secret, err := users.DecryptTOTPSecret(settingsKey, u.TOTP.Secret)
+		if err != nil {
+			return err
+		}
+		if u.TOTP.Secret, err = sealSecret(key, secret); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// serverSecrets returns the secrets of the server settings, by name.
+func serverSecrets(server *settings.Server) map[string]*string {
+	return map[string]*string{
+		"redis.password": &server.Redis.Password,
+		"webhookSecret":  &server.WebhookSecret,
+	}
+}
+
+// authSecrets returns the secrets of an auth method, by name.
+func authSecrets(auther auth.Auther) map[string]*string {
+	switch a := auther.(type) {
+	case *auth.OIDCAuth:
+		return map[string]*string{"clientSecret": &a.ClientSecret}
+	case *auth.JSONAuth:
+		if a.ReCaptcha != nil {
+			return map[string]*string{"recaptcha.secret": &a.ReCaptcha.Secret}
+		}
+	}
+	return nil
+}
+
+// secretValues returns the values of secrets.
+func secretValues(secrets map[string]*string) map[string]string {
+	values := map[string]string{}
+	for name, secret := range secrets {
+		values[name] = *secret
+	}
+	return values
+}
+
+// sealSecrets encrypts the secrets that are set, or leaves them out if
+// there's no key.
+func sealSecrets(key []byte, secrets map[string]*string) error {
+	for _, secret := range secrets {
+		if *secret == "" {
+			continue
+		}
+		if key == nil {
+			*secret = ""
+			continue
+		}
+
+		sealed, err := sealSecret(key, *secret)
+		if err != nil {
+			return err
+		}
+		*secret = sealed
+	}
+	return nil
+}
+
+// openSecrets decrypts the secrets of a bundle. Without a key, the bundle
+// has none and the previous ones are kept.
+func openSecrets(key []byte, secrets map[string]*string, previous map[string]string) error {
+	for name, secret := range secrets {
+		if key == nil {
+			*secret = previous[name]
+			continue
+		}
+		if *secret == "" {
+			continue
+		}
+
+		opened, err := openSecret(key, *secret)
+		if err != nil {
+			return err
+		}
+		*secret = opened
+	}
+	return nil
+}
+
+// importConfig checks a bundle and saves it, merging the roles, users and
+// shares with the existing ones of the same name, username and hash. The
+// ones that aren't in the bundle are kept. Nothing is saved on a dry run.
+func importConfig(d *data, bundle *configBundle, passphrase string, dryRun, withServer bool) (*importReport, error) {
+	report := &importReport{DryRun: dryRun, Warnings: []string{}}
+
+	if err := validateBundle(bundle); err != nil {
+		return nil, fmt.Errorf("%w: %v", fbErrors.ErrInvalidRequestParams, err) //nolint:errorlint
+	}
+	// the server would fail to start with its profile removed
+	if _, ok := bundle.Settings.Profiles[d.server.Profile]; d.server.Profile != "" && !ok {
+		return nil, fmt.Errorf("%w: the bundle has no settings profile %q", fbErrors.ErrInvalidOption, d.server.Profile)
+	}
+
+	var key []byte
+	if bundle.Salt != nil {
+		if passphrase == "" {
+			return nil, errWrongPassphrase
+		}
+
+		var err error
+		if key, err = bundleKey(passphrase, bundle.Salt); err != nil {
+			return nil, err
+		}
+	}
+
+	auther, err := d.store.Auth.Get(bundle.Settings.AuthMethod)
+	if errors.Is(err, fbErrors.ErrInvalidAuthMethod) {
+		return nil, fmt.Errorf("%w: %v", fbErrors.ErrInvalidRequestParams, err) //nolint:errorlint
+	}
+	if err != nil && !errors.Is(err, fbErrors.ErrNotExist) {
+		return nil, err
+	}
+	if len(bundle.Auther) > 0 {
+		previous := secretValues(authSecrets(auther))
+		if err := json.Unmarshal(bundle.Auther, auther); err != nil {
+			return nil, fmt.Errorf("%w: %v", fbErrors.ErrInvalidRequestParams, err) //nolint:errorlint
+		}
+		if err := openSecrets(key, authSecrets(auther), previous); err != nil {
+			return nil, err
+		}
+	}
+	if withServer && bundle.Server != nil {
+		if err := openSecrets(key, serverSecrets(bundle.Server), secretValues(serverSecrets(d.server))); err != nil {
+			return nil, err
+		}
+	}
+
+	// the secrets are opened before anything is saved, not to import half
+	// of a bundle with a wrong passphrase
+	existing := make([]*users.User, len(bundle.Users))
+	for i, u := range bundle.Users {
+		existing[i], err = d.store.Users.Get(d.server.Root, u.Username)
+		if err != nil && !errors.Is(err, fbErrors.ErrNotExist) {
+			return nil, err
+		}
+
+		warning, err := openUser(u, existing[i], d.settings.Key, key)
+		if err != nil {
+			return nil, err
+		}
+		if warning != "" {
+			report.Warnings = append(report.Warnings, warning)
+		}
+	}
+	for _, link := range bundle.Shares {
+		if link.PasswordHash == "" {
+			continue
+		}
+		if link.PasswordHash, err = openSecret(key, link.PasswordHash); err != nil {
+			return nil, err
+		}
+		if link.Token, err = openSecret(key, link.Token); err != nil {
+			return nil, err
+		}
+	}
+
+	// the IDs of the bundle are mapped to the ones of this server
+	roleIDs := map[uint]uint{}
+	for _, role := range bundle.Roles {
+		bundleID := role.ID
+		role.ID = 0
+		if found, err := findRole(d, role.Name); err != nil {
+			return nil, err
+		} else if found != nil {
+			role.ID = found.ID
+			report.Roles.Updated++
+		} else {
+			report.Roles.Created++
+		}
+
+		if !dryRun {
+			if err := d.store.Roles.Save(role); err != nil {
+				return nil, err
+			}
+		}
+		roleIDs[bundleID] = role.ID
+	}
+
+	userIDs := map[uint]uint{}
+	for i, u := range bundle.Users {
+		bundleID := u.ID
+		u.ID = 0
+		u.Role = roleIDs[u.Role]
+		if existing[i] != nil {
+			u.ID = existing[i].ID
+			report.Users.Updated++
+		} else {
+			report.Users.Created++
+		}
+
+		if !dryRun {
+			if err := d.store.Users.Save(u); err != nil {
+				return nil, err
+			}
+		}
+		userIDs[bundleID] = u.ID
+	}
+
+	for _, link := range bundle.Shares {
+		link.UserID = userIDs[link.UserID]
+
+		if _, err := d.store.Share.GetByHash(link.Hash); err == nil {
+			report.Shares.Updated++
+		} else if errors.Is(err, fbErrors.ErrNotExist) {
+			report.Shares.Created++
+		} else {
+			return nil, err
+		}
+
+		if !dryRun {
+			if err := d.store.Share.Save(link); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	bundle.Settings.Key, bundle.Settings.SigningKeys = d.settings.Key, d.settings.SigningKeys
+	if err := d.store.Settings.Save(bundle.Settings); err != nil {
+		return nil, err
+	}
+	if err := d.store.Auth.Save(auther); err != nil {
+		return nil, err
+	}
+	if withServer && bundle.Server != nil {
+		if err := d.store.Settings.SaveServer(bundle.Server); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// validateBundle checks a bundle before anything of it is saved.
+func validateBundle(bundle *configBundle) error {
+	if bundle.Version < 1 || bundle.Version > configBundleVersion {
+		return fmt.Errorf("unsupported version %d", bundle.Version)
+	}
+	if bundle.Settings == nil {
+		return errors.New("no settings")
+	}
+	if err := rules.Validate(bundle.Settings.Rules); err != nil {
+		return err
+	}
+
+	roles := map[uint]bool{}
+	names := map[string]bool{}
+	for _, role := range bundle.Roles {
+		if role.Name == "" || names[role.Name] {
+			return fmt.Errorf("invalid or duplicate role %q", role.Name)
+		}
+		names[role.Name] = true
+		roles[role.ID] = true
+	}
+
+	ids := map[uint]bool{}
+	usernames := map[string]bool{}
+	for _, u := range bundle.Users {
+		if u.Username == "" || usernames[u.Username] {
+			return fmt.Errorf("invalid or duplicate user %q", u.Username)
+		}
+		if u.Role != 0 && !roles[u.Role] {
+			return fmt.Errorf("unknown role %d of user %q", u.Role, u.Username)
+		}
+		if err := rules.Validate(u.Rules); err != nil {
+			return fmt.Errorf("user %q: %w", u.Username, err)
+		}
+		usernames[u.Username] = true
+		ids[u.ID] = true
+	}
+
+	for _, link := range bundle.Shares {
+		if link.Hash == "" || !ids[link.UserID] {
+			return fmt.Errorf("invalid share %q", link.Hash)
+		}
+	}
+
+	return nil
+}
+
+// openUser decrypts the secrets of a user of a bundle, encrypting its TOTP
+// secret with the key of the settings. Without secrets, an existing user
+// keeps its own and a new one gets a random password, which is warned
+// about.
+func openUser(u, existing *users.User, settingsKey, key []byte) (string, error) {
+	if key != nil {
+		var err error
+		if u.Password, err = openSecret(key, u.Password); err != nil {
+			return "", err
+		}
+		if u.TOTP.Secret != "" {
+			secret, err := openSecret(key, u.TOTP.Secret)
+			if err != nil {
+				return "", err
+			}
+			if u.TOTP.Secret, err = users.EncryptTOTPSecret(settingsKey, secret); err != nil {
+				return "", err
+			}
+		}
+		return "", nil
+	}
+
+	if existing != nil {
+		u.Password, u.TOTP = existing.Password, existing.TOTP
+		return "", nil
+	}
+
+	pwd := make([]byte, 32) //nolint:gomnd
+	if _, err := rand.Read(pwd); err != nil {
+		return "", err
+	}
+	hash, err := users.HashPwd(base64.RawStdEncoding.EncodeToString(pwd))
+	if err != nil {
+		return "", err
+	}
+	u.Password = hash
+	return fmt.Sprintf("user %q has no password, a new one has to be set", u.Username), nil
+}
+
+func findRole(d *data, name string) (*users.Role, error) {
+	roles, err := d.store.Roles.Gets()
+	if err != nil && !errors.Is(err, fbErrors.ErrNotExist) {
+		return nil, err
+	}
+	for _, role := range roles {
+		if role.Name == name {
+			return role, nil
+		}
+	}
+	return nil, nil
+}
+
+// bundleKey derives the key of the secrets of a bundle from a passphrase.
+func bundleKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32) //nolint:gomnd
+}
+
+func sealSecret(key []byte, secret string) (string, error) {
+	gcm, err := bundleCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openSecret(key []byte, sealed string) (string, error) {
+	gcm, err := bundleCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < gcm.NonceSize() {
+		return "", errWrongPassphrase
+	}
+
+	secret, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errWrongPassphrase
+	}
+	return string(secret), nil
+}
+
+func bundleCipher(key []byte) (cipher.AEAD, error) {
+	if key == nil {
+		return nil, errWrongPassphrase
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
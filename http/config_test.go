@@ -0,0 +1,213 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/asdine/storm/v3"
+
+	"github.com/filebrowser/filebrowser/v2/auth"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/share"
+	"github.com/filebrowser/filebrowser/v2/storage"
+	"github.com/filebrowser/filebrowser/v2/storage/bolt"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func newConfigStorage(t *testing.T, key string) *storage.Storage {
+	t.Helper()
+
+	db, err := storm.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	st, err := bolt.NewStorage(db)
+	if err != nil {
+		t.Fatalf("failed to get storage: %v", err)
+	}
+	if err := st.Settings.Save(&settings.Settings{Key: []byte(key), AuthMethod: auth.MethodJSONAuth}); err != nil {
+		t.Fatalf("failed to save settings: %v", err)
+	}
+	if err := st.Auth.Save(&auth.JSONAuth{}); err != nil {
+		t.Fatalf("failed to save auther: %v", err)
+	}
+	if err := st.Users.Save(&users.User{Username: "admin", Password: "pw", Perm: users.Permissions{Admin: true}}); err != nil {
+		t.Fatalf("failed to save user: %v", err)
+	}
+	return st
+}
+
+func serveConfig(t *testing.T, st *storage.Storage, fn handleFunc, target, passphrase string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	r.Header.Set("X-Auth", issueToken(t, st))
+	if passphrase != "" {
+		r.Header.Set(configPassphraseHeader, passphrase)
+	}
+
+	recorder := httptest.NewRecorder()
+	handle(fn, "", st, &settings.Server{Root: t.TempDir()}, nil).ServeHTTP(recorder, r)
+	return recorder
+}
+
+func TestConfigExportImport(t *testing.T) {
+	t.Parallel()
+
+	src := newConfigStorage(t, "source key")
+	role := &users.Role{Name: "editors", Perm: users.Permissions{Create: true}}
+	if err := src.Roles.Save(role); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := users.NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := users.EncryptTOTPSecret([]byte("source key"), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	editor := &users.User{Username: "editor", Password: "hash", Role: role.ID, Perm: role.Perm,
+		TOTP: users.TOTP{Secret: encrypted, Enabled: true}}
+	if err := src.Users.Save(editor); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []*share.Link{
+		{Hash: "public", Path: "/a", UserID: editor.ID},
+		{Hash: "protected", Path: "/b", UserID: editor.ID, PasswordHash: "share hash", Token: "token"},
+	} {
+		if err := src.Share.Save(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the secrets are left out without passphrase, with the shares they
+	// protect
+	res := serveConfig(t, src, configExportHandler, "/", "", nil)
+	var plain configBundle
+	if err := json.NewDecoder(res.Body).Decode(&plain); err != nil || res.Code != http.StatusOK {
+		t.Fatalf("expected a bundle, got %d and %v", res.Code, err)
+	}
+	if plain.Settings.Key != nil || plain.Salt != nil || len(plain.Shares) != 1 {
+		t.Fatalf("expected no key, no salt and one share, got %+v", plain)
+	}
+	for _, u := range plain.Users {
+		if u.Password != "" || u.TOTP.Secret != "" {
+			t.Fatalf("expected no secret, got %+v", u)
+		}
+	}
+
+	res = serveConfig(t, src, configExportHandler, "/", "passphrase", nil)
+	bundle := res.Body.Bytes()
+	if res.Code != http.StatusOK || bytes.Contains(bundle, []byte("share hash")) {
+		t.Fatalf("expected the secrets to be sealed, got %d: %s", res.Code, bundle)
+	}
+
+	dst := newConfigStorage(t, "destination key")
+	if res := serveConfig(t, dst, configImportHandler, "/", "wrong", bundle); res.Code != http.StatusForbidden {
+		t.Fatalf("expected a wrong passphrase to be rejected, got %d", res.Code)
+	}
+
+	// a dry run reports what would be done without saving it
+	res = serveConfig(t, dst, configImportHandler, "/?dry_run=true", "passphrase", bundle)
+	var report importReport
+	if err := json.NewDecoder(res.Body).Decode(&report); err != nil || res.Code != http.StatusOK {
+		t.Fatalf("expected a report, got %d and %v", res.Code, err)
+	}
+	if report.Roles.Created != 1 || report.Users.Created != 1 || report.Users.Updated != 1 || report.Shares.Created != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if _, err := dst.Users.Get("", "editor"); err == nil {
+		t.Fatal("expected the dry run not to save the users")
+	}
+
+	if res := serveConfig(t, dst, configImportHandler, "/", "passphrase", bundle); res.Code != http.StatusOK {
+		t.Fatalf("expected the bundle to be imported, got %d: %s", res.Code, res.Body)
+	}
+
+	user, err := dst.Users.Get("", "editor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := users.DecryptTOTPSecret([]byte("destination key"), user.TOTP.Secret)
+	if err != nil || imported != secret || user.Password != "hash" {
+		t.Errorf("expected the secrets to be kept, got %+v", user)
+	}
+	roles, err := dst.Roles.Gets()
+	if err != nil || len(roles) != 1 || user.Role != roles[0].ID || user.Perm != role.Perm {
+		t.Errorf("expected the user to be in the imported role, got %+v and %+v", user, roles)
+	}
+	link, err := dst.Share.GetByHash("protected")
+	if err != nil || link.UserID != user.ID || link.PasswordHash != "share hash" {
+		t.Errorf("expected the share of the user, got %+v and %v", link, err)
+	}
+	set, err := dst.Settings.Get()
+	if err != nil || string(set.Key) != "destination key" {
+		t.Errorf("expected the key to be kept, got %+v and %v", set, err)
+	}
+
+	var invalid configBundle
+	_ = json.Unmarshal(bundle, &invalid)
+	invalid.Version = configBundleVersion + 1
+	body, _ := json.Marshal(invalid)
+	if res := serveConfig(t, dst, configImportHandler, "/", "passphrase", body); res.Code != http.StatusBadRequest {
+		t.Errorf("expected a newer version to be rejected, got %d", res.Code)
+	}
+}
+
+func TestConfigExportSecrets(t *testing.T) {
+	t.Parallel()
+
+	src := newConfigStorage(t, "source key")
+	if err := src.Auth.Save(&auth.JSONAuth{ReCaptcha: &auth.ReCaptcha{Host: "https://captcha", Secret: "captcha secret"}}); err != nil {
+		t.Fatal(err)
+	}
+	server := &settings.Server{Root: t.TempDir(), WebhookSecret: "webhook secret", Redis: settings.Redis{Password: "redis secret"}}
+	serve := func(st *storage.Storage, fn handleFunc, target, passphrase string, body []byte) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+		r.Header.Set("X-Auth", issueToken(t, st))
+		if passphrase != "" {
+			r.Header.Set(configPassphraseHeader, passphrase)
+		}
+		recorder := httptest.NewRecorder()
+		handle(fn, "", st, server, nil).ServeHTTP(recorder, r)
+		return recorder
+	}
+	secrets := []string{"captcha secret", "webhook secret", "redis secret"}
+
+	plain := serve(src, configExportHandler, "/", "", nil).Body.Bytes()
+	sealed := serve(src, configExportHandler, "/", "passphrase", nil).Body.Bytes()
+	for _, secret := range secrets {
+		if bytes.Contains(plain, []byte(secret)) || bytes.Contains(sealed, []byte(secret)) {
+			t.Errorf("expected %q not to be exported in plaintext", secret)
+		}
+	}
+	if server.WebhookSecret != "webhook secret" {
+		t.Fatal("expected the secrets of the running server to be kept")
+	}
+
+	// the sealed secrets are imported, the plain bundles keep the existing
+	dst := newConfigStorage(t, "destination key")
+	if res := serve(dst, configImportHandler, "/?server=true", "passphrase", sealed); res.Code != http.StatusOK {
+		t.Fatalf("expected the bundle to be imported, got %d: %s", res.Code, res.Body)
+	}
+	if res := serve(dst, configImportHandler, "/?server=true", "", plain); res.Code != http.StatusOK {
+		t.Fatalf("expected the plain bundle to be imported, got %d: %s", res.Code, res.Body)
+	}
+	saved, err := dst.Settings.GetServer()
+	if err != nil || saved.WebhookSecret != "webhook secret" || saved.Redis.Password != "redis secret" {
+		t.Errorf("expected the secrets of the server, got %+v and %v", saved, err)
+	}
+	auther, err := dst.Auth.Get(auth.MethodJSONAuth)
+	if err != nil || auther.(*auth.JSONAuth).ReCaptcha == nil || auther.(*auth.JSONAuth).ReCaptcha.Secret != "captcha secret" {
+		t.Errorf("expected the secret of the auth method, got %+v and %v", auther, err)
+	}
+}
@@ -1,17 +1,21 @@
 package http
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"path"
+	"regexp"
 	"strconv"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/tomasen/realip"
 
-	"github.com/filebrowser/filebrowser/v2/rules"
 	"github.com/filebrowser/filebrowser/v2/runner"
+	"github.com/filebrowser/filebrowser/v2/session"
 	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/share"
 	"github.com/filebrowser/filebrowser/v2/storage"
+	"github.com/filebrowser/filebrowser/v2/tokens"
 	"github.com/filebrowser/filebrowser/v2/users"
 )
 
@@ -23,32 +27,52 @@ type data struct {
 	server   *settings.Server
 	store    *storage.Storage
 	user     *users.User
-	raw      interface{}
+	// session is the one of the token of the request, if it has one.
+	session *session.Session
+	// token is the API token of the request, if it has one.
+	token *tokens.Token
+	// link is the share of the public requests.
+	link *share.Link
+	// lockToken is the token of the lock the request gives, see fileLock.
+	lockToken string
+	raw       interface{}
 }
 
-// Check implements rules.Checker.
-func (d *data) Check(path string) bool {
-	if d.user.HideDotfiles && rules.MatchHidden(path) {
+// Check implements rules.Checker. The versions of the files and the trash
+// are denied, they're only reached through their own endpoints, and so are
+// the files out of the scope of the API token.
+func (d *data) Check(p string) bool {
+	if isVersionPath(p) || isTrashPath(p) {
 		return false
 	}
-
-	allow := true
-	for _, rule := range d.settings.Rules {
-		if rule.Matches(path) {
-			allow = rule.Allow
-		}
+	// the API tokens only reach the files of their scope
+	if d.token != nil && !under(d.token.Scope, path.Clean("/"+p)) {
+		return false
 	}
+	return evaluateRules(p, d.user.HideDotfiles, d.settings.Rules, d.user.Rules).Allowed
+}
 
-	for _, rule := range d.user.Rules {
-		if rule.Matches(path) {
-			allow = rule.Allow
-		}
-	}
+// unscoped tells if the request reaches all the files of the user, its API
+// token, if any, having no narrower scope. The handlers of the files of any
+// path, such as the ones of the trash, are only allowed to these requests.
+func (d *data) unscoped() bool {
+	return d.token == nil || path.Clean("/"+d.token.Scope) == "/"
+}
 
-	return allow
+// restrictReadOnly takes the permissions changing the files from a user
+// while the server is read only.
+func (d *data) restrictReadOnly(user *users.User) {
+	if d.settings.ReadOnly {
+		user.Perm = user.Perm.ReadOnly()
+	}
 }
 
-func handle(fn handleFunc, prefix string, store *storage.Storage, server *settings.Server) http.Handler {
+func handle(fn handleFunc, prefix string, store *storage.Storage, server *settings.Server, hookRunner *runner.Runner) http.Handler {
+	// handlers that don't run hooks don't get a runner
+	if hookRunner == nil {
+		hookRunner = &runner.Runner{}
+	}
+
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		for k, v := range globalHeaders {
 			w.Header().Set(k, v)
@@ -59,20 +83,32 @@ func handle(fn handleFunc, prefix string, store *storage.Storage, server *settin
 			log.Fatalf("ERROR: couldn't get settings: %v\n", err)
 			return
 		}
+		if settings, err = settings.WithProfile(server.Profile); err != nil {
+			log.Printf("ERROR: couldn't apply the settings profile: %v\n", err)
+			http.Error(w, strconv.Itoa(http.StatusInternalServerError)+" "+http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		id := requestID(r)
+		w.Header().Set("X-Request-Id", id)
+		r = r.WithContext(runner.WithRequestID(r.Context(), id))
 
-		status, err := fn(w, r, &data{
-			Runner: &runner.Runner{
-				Enabled:  server.EnableExec,
-				Settings: settings,
-				RedisClient: redis.NewClient(&redis.Options{
-					Addr: "localhost:6379",
-					DB:   0,
-				}),
-			},
+		d := &data{
+			Runner:   hookRunner.WithSettings(settings),
 			store:    store,
 			settings: settings,
 			server:   server,
-		})
+
+			lockToken: r.Header.Get("X-Lock-Token"),
+		}
+		// the hooks get the paths allowed by the same rules as the requests
+		d.Runner.Checker = d
+		d.Runner.Locker = d
+		d.Runner.OnWarning = func(msg string) {
+			w.Header().Add("X-Hook-Warning", msg)
+		}
+
+		status, err := fn(w, r, d)
 
 		if status >= 400 || err != nil {
 			clientIP := realip.FromRequest(r)
@@ -81,6 +117,20 @@ func handle(fn handleFunc, prefix string, store *storage.Storage, server *settin
 
 		if status != 0 {
 			txt := http.StatusText(status)
+			var rejected *runner.ErrHookRejected
+			var quota *quotaError
+			var tooLarge *uploadSizeError
+			var locked *lockedError
+			switch {
+			case errors.As(err, &rejected) && rejected.Message != "":
+				txt = rejected.Message
+			case errors.As(err, &quota):
+				txt = quota.Error()
+			case errors.As(err, &tooLarge):
+				txt = tooLarge.Error()
+			case errors.As(err, &locked):
+				txt = locked.Error()
+			}
 			http.Error(w, strconv.Itoa(status)+" "+txt, status)
 			return
 		}
@@ -88,3 +138,15 @@ func handle(fn handleFunc, prefix string, store *storage.Storage, server *settin
 
 	return stripPrefix(prefix, handler)
 }
+
+var requestIDPattern = regexp.MustCompile(`^[\w.-]{1,128}$`)
+
+// requestID returns the ID sent by the client or a proxy in the
+// X-Request-Id header, or a new one. IDs that could mess the logs up are
+// replaced.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-Id"); requestIDPattern.MatchString(id) {
+		return id
+	}
+	return runner.NewRequestID()
+}
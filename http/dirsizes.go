@@ -0,0 +1,232 @@
+package http
+
+import (
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/files"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// dirSizes keeps the total size of the files under each directory of the
+// root, by real path. It's computed by walking the root, kept up to date
+// with the operations, which sync the paths they changed with the disk, and
+// computed again every interval to fix the drift of the changes made out of
+// the server. It implements runner.Listener.
+type dirSizes struct {
+	fs       afero.Fs
+	root     string
+	interval time.Duration
+
+	mu    sync.RWMutex
+	files map[string]int64
+	dirs  map[string]int64
+	built bool
+
+	queue chan func()
+}
+
+// newDirSizes returns the sizes of the directories of the root of the
+// server, nil if they aren't shown. They're computed in the background.
+func newDirSizes(server *settings.Server) (*dirSizes, error) {
+	if !server.DirSizes {
+		return nil, nil
+	}
+
+	fs, root, err := users.RootFs(server.Root)
+	if err != nil {
+		return nil, err
+	}
+	s := &dirSizes{
+		fs:       fs,
+		root:     filepath.Clean(root),
+		interval: server.GetDirSizesInterval(),
+		files:    map[string]int64{},
+		dirs:     map[string]int64{},
+		queue:    make(chan func(), 1024), //nolint:gomnd
+	}
+	go s.work()
+	return s, nil
+}
+
+// work runs the updates and the reconciliations in order, the first
+// updates waiting for the root to be walked.
+func (s *dirSizes) work() {
+	s.reconcile()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case job := <-s.queue:
+			job()
+		case <-ticker.C:
+			s.reconcile()
+		}
+	}
+}
+
+// reconcile walks the root again, replacing the sizes at once.
+func (s *dirSizes) reconcile() {
+	fileSizes := map[string]int64{}
+	dirs := map[string]int64{}
+	err := afero.Walk(s.fs, s.root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil //nolint:nilerr
+		}
+		if info.Mode().IsRegular() {
+			key := filepath.Clean(name)
+			fileSizes[key] = info.Size()
+			s.eachParent(key, func(dir string) { dirs[dir] += info.Size() })
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[WARN] Failed to compute the sizes of the directories: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	s.files, s.dirs, s.built = fileSizes, dirs, true
+	s.mu.Unlock()
+}
+
+// eachParent calls fn with the directories a file is in, up to the root.
+func (s *dirSizes) eachParent(key string, fn func(dir string)) {
+	for dir := filepath.Dir(key); inDir(s.root, dir); dir = filepath.Dir(dir) {
+		fn(dir)
+		if dir == s.root || dir == filepath.Dir(dir) {
+			return
+		}
+	}
+}
+
+// inDir tells if a real path is dir or under it.
+func inDir(dir, name string) bool {
+	rel, err := filepath.Rel(dir, name)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// setFile sets the size of a file, adjusting its directories. The sizes
+// must be locked.
+func (s *dirSizes) setFile(key string, size int64) {
+	delta := size - s.files[key]
+	s.files[key] = size
+	if delta != 0 {
+		s.eachParent(key, func(dir string) { s.dirs[dir] += delta })
+	}
+}
+
+// removeFile forgets a file, adjusting its directories. The sizes must be
+// locked.
+func (s *dirSizes) removeFile(key string) {
+	size, ok := s.files[key]
+	if !ok {
+		return
+	}
+	delete(s.files, key)
+	s.eachParent(key, func(dir string) {
+		s.dirs[dir] -= size
+		if s.dirs[dir] == 0 {
+			delete(s.dirs, dir)
+		}
+	})
+}
+
+// sync makes the sizes of a file, or of the files under a directory, of a
+// file system match the disk, whether it was created, changed or removed.
+func (s *dirSizes) sync(fs afero.Fs, name string) {
+	found := map[string]int64{}
+	_ = afero.Walk(fs, name, func(name string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			found[fsRealPath(fs, name)] = info.Size()
+		}
+		return nil
+	})
+	prefix := fsRealPath(fs, name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.built {
+		return
+	}
+	for key := range s.files {
+		if _, ok := found[key]; !ok && inDir(prefix, key) {
+			s.removeFile(key)
+		}
+	}
+	for key, size := range found {
+		if inDir(s.root, key) {
+			s.setFile(key, size)
+		}
+	}
+}
+
+// size returns the total size of the files under a directory of a file
+// system, false until the root was walked.
+func (s *dirSizes) size(fs afero.Fs, name string) (int64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.built {
+		return 0, false
+	}
+	return s.dirs[fsRealPath(fs, name)], true
+}
+
+// OperationDone syncs the paths an operation changed, in the background.
+func (s *dirSizes) OperationDone(event, src, dst string, user *users.User) {
+	var names []string
+	switch event {
+	case "after_upload", "after_save", "after_delete":
+		names = []string{src}
+	case "after_copy":
+		names = []string{dst}
+	case "after_rename", "after_move":
+		names = []string{src, dst}
+	case "after_trash", "after_restore":
+		// the trashed files are kept in the trash of the scope
+		names = []string{src, trashDir}
+	default:
+		return
+	}
+
+	fs := user.Fs
+	select {
+	case s.queue <- func() {
+		for _, name := range names {
+			s.sync(fs, name)
+		}
+	}:
+	default:
+		// the next reconciliation catches up
+		log.Printf("[WARN] The directory sizes queue is full, dropping the update of %s", src)
+	}
+}
+
+// showDirSizes gives their total size to the directory and the directories
+// of the listing of a file.
+func showDirSizes(sizes *dirSizes, d *data, file *files.FileInfo) {
+	if sizes == nil || file.Listing == nil {
+		return
+	}
+
+	if size, ok := sizes.size(d.user.Fs, file.Path); ok {
+		file.DirSize = &size
+	}
+	for _, item := range file.Items {
+		if !item.IsDir {
+			continue
+		}
+		if size, ok := sizes.size(d.user.Fs, path.Clean("/"+item.Path)); ok {
+			item.DirSize = &size
+		}
+	}
+}
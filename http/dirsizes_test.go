@@ -0,0 +1,72 @@
+package http
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestDirSizes(t *testing.T) {
+	root := t.TempDir()
+	write := func(name string, size int) {
+		t.Helper()
+		name = filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(strings.Repeat("a", size)), 0644); err != nil { //nolint:gosec
+			t.Fatal(err)
+		}
+	}
+	write("a/one.txt", 10)
+	write("a/b/two.txt", 20)
+	write("c/three.txt", 30)
+
+	newSizes := func() *dirSizes {
+		s := &dirSizes{fs: afero.NewOsFs(), root: root, files: map[string]int64{}, dirs: map[string]int64{}}
+		s.reconcile()
+		return s
+	}
+	sizes := newSizes()
+	fs := afero.NewBasePathFs(afero.NewOsFs(), root)
+	expect := func(want map[string]int64) {
+		t.Helper()
+		for name, size := range want {
+			if got, ok := sizes.size(fs, name); !ok || got != size {
+				t.Errorf("expected %s to be %d bytes, got %d", name, size, got)
+			}
+		}
+	}
+	expect(map[string]int64{"/": 60, "/a": 30, "/a/b": 20, "/c": 30})
+
+	// the operations sync the paths they changed
+	write("a/b/two.txt", 5)
+	sizes.sync(fs, "/a/b/two.txt")
+	expect(map[string]int64{"/": 45, "/a": 15, "/a/b": 5})
+
+	if err := fs.Rename("/a/b", "/c/b"); err != nil {
+		t.Fatal(err)
+	}
+	sizes.sync(fs, "/a/b")
+	sizes.sync(fs, "/c/b")
+	expect(map[string]int64{"/": 45, "/a": 10, "/a/b": 0, "/c": 35, "/c/b": 5})
+
+	if err := fs.RemoveAll("/c"); err != nil {
+		t.Fatal(err)
+	}
+	sizes.sync(fs, "/c")
+	expect(map[string]int64{"/": 10, "/a": 10, "/c": 0})
+
+	// without drift from the sizes computed again
+	if fresh := newSizes(); !reflect.DeepEqual(sizes.dirs, fresh.dirs) || !reflect.DeepEqual(sizes.files, fresh.files) {
+		t.Errorf("expected the synced sizes %v to be the computed ones %v", sizes.dirs, fresh.dirs)
+	}
+
+	if _, ok := (&dirSizes{}).size(fs, "/"); ok {
+		t.Error("expected the sizes not to be known before the root is walked")
+	}
+}
@@ -0,0 +1,236 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+const (
+	// eventsDebounce is how long the changes are gathered before they're
+	// sent, so that a burst of them is sent at once.
+	eventsDebounce = 250 * time.Millisecond
+	// eventsHeartbeat is how often a comment is sent to keep the stream
+	// open through the proxies.
+	eventsHeartbeat = 30 * time.Second
+	// eventsBuffer is how many changes a client can be behind before they
+	// are dropped.
+	eventsBuffer = 64
+)
+
+// fileEvent is a change of a file streamed to the clients. Type is
+// create, modify, delete or move, Dst being the new path of the moves.
+type fileEvent struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+	Dst  string `json:"dst,omitempty"`
+}
+
+type eventSubscriber struct {
+	d      *data
+	events chan fileEvent
+}
+
+// eventHub sends the changes made through the runner to the clients of
+// the events endpoint. It implements runner.Listener, the paths of the
+// events being real ones until they're scoped to each client.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[*eventSubscriber]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: map[*eventSubscriber]struct{}{}}
+}
+
+// OperationDone implements runner.Listener.
+func (h *eventHub) OperationDone(event, src, dst string, user *users.User) {
+	var e fileEvent
+	switch event {
+	case "after_upload", "after_mkdir":
+		e = fileEvent{Type: "create", Path: src}
+	case "after_save", "after_restore":
+		e = fileEvent{Type: "modify", Path: src}
+	case "after_copy":
+		e = fileEvent{Type: "create", Path: dst}
+	case "after_rename", "after_move":
+		e = fileEvent{Type: "move", Path: src, Dst: dst}
+	case "after_delete", "after_trash":
+		e = fileEvent{Type: "delete", Path: src}
+	default:
+		return
+	}
+
+	e.Path = fsRealPath(user.Fs, e.Path)
+	if e.Dst != "" {
+		e.Dst = fsRealPath(user.Fs, e.Dst)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers {
+		select {
+		case sub.events <- e:
+		default:
+			// the client is too slow, it misses the change
+		}
+	}
+}
+
+func (h *eventHub) subscribe(d *data) *eventSubscriber {
+	sub := &eventSubscriber{d: d, events: make(chan fileEvent, eventsBuffer)}
+
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+func (h *eventHub) unsubscribe(sub *eventSubscriber) {
+	h.mu.Lock()
+	delete(h.subscribers, sub)
+	h.mu.Unlock()
+}
+
+// scope returns the event as seen by the user of the subscriber, if it's
+// under the directory. A move in or out of the scope is a creation or a
+// deletion.
+func (sub *eventSubscriber) scope(e fileEvent, dir string) (fileEvent, bool) {
+	visible := func(name string) (string, bool) {
+		if name == "" {
+			return "", false
+		}
+		p, ok := scopedPath(sub.d.user.Fs, name)
+		if !ok || !sub.d.Check(p) || !within(p, dir) {
+			return "", false
+		}
+		return p, true
+	}
+
+	src, srcOk := visible(e.Path)
+	dst, dstOk := visible(e.Dst)
+
+	switch {
+	case e.Type != "move" && srcOk:
+		return fileEvent{Type: e.Type, Path: src}, true
+	case e.Type != "move":
+		return e, false
+	case srcOk && dstOk:
+		return fileEvent{Type: "move", Path: src, Dst: dst}, true
+	case srcOk:
+		return fileEvent{Type: "delete", Path: src}, true
+	case dstOk:
+		return fileEvent{Type: "create", Path: dst}, true
+	default:
+		return e, false
+	}
+}
+
+// eventsHandler streams the changes of the files of the user as
+// server-sent events, only the ones under the path query if given.
+func eventsHandler(hub *eventHub) handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			return http.StatusInternalServerError, errors.New("the response can't be streamed")
+		}
+
+		dir := path.Clean("/" + r.URL.Query().Get("path"))
+
+		sub := hub.subscribe(d)
+		defer hub.unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(eventsHeartbeat)
+		defer heartbeat.Stop()
+
+		var (
+			pending  []fileEvent
+			debounce <-chan time.Time
+		)
+		for {
+			select {
+			case <-r.Context().Done():
+				return 0, nil
+			case e := <-sub.events:
+				e, ok := sub.scope(e, dir)
+				if !ok {
+					continue
+				}
+				pending = appendEvent(pending, e)
+				if debounce == nil {
+					debounce = time.After(eventsDebounce)
+				}
+			case <-debounce:
+				debounce = nil
+				for _, e := range pending {
+					payload, err := json.Marshal(e)
+					if err != nil {
+						return 0, err
+					}
+					if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, payload); err != nil {
+						return 0, nil //nolint:nilerr
+					}
+				}
+				pending = pending[:0]
+				flusher.Flush()
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return 0, nil //nolint:nilerr
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+// appendEvent adds an event unless it's the same as one waiting to be
+// sent.
+func appendEvent(pending []fileEvent, e fileEvent) []fileEvent {
+	for _, p := range pending {
+		if p == e {
+			return pending
+		}
+	}
+	return append(pending, e)
+}
+
+// fsRealPath returns the path of a file outside of its file system.
+func fsRealPath(fs afero.Fs, name string) string {
+	if base, ok := fs.(*afero.BasePathFs); ok {
+		if p, err := base.RealPath(name); err == nil {
+			return p
+		}
+	}
+	return filepath.Clean(name)
+}
+
+// scopedPath returns the path of a real file in a file system, if it's in
+// it.
+func scopedPath(fs afero.Fs, name string) (string, bool) {
+	rel, err := filepath.Rel(fsRealPath(fs, "/"), name)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return path.Join("/", filepath.ToSlash(rel)), true
+}
+
+// within tells if a path is a directory or under it.
+func within(name, dir string) bool {
+	return dir == "/" || name == dir || strings.HasPrefix(name, dir+"/")
+}
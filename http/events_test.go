@@ -0,0 +1,99 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestEventsStream(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	token := issueToken(t, st)
+	server := &settings.Server{Root: t.TempDir()}
+
+	hub := newEventHub()
+	srv := httptest.NewServer(handle(eventsHandler(hub), "", st, server, nil))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?path=/docs", nil)
+	req.Header.Set("X-Auth", token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); res.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d and %s", res.StatusCode, ct)
+	}
+
+	// another user whose scope is the same
+	user := &users.User{Fs: afero.NewBasePathFs(afero.NewOsFs(), server.Root)}
+	hub.OperationDone("after_upload", "/other/a.txt", "", user)
+	hub.OperationDone("after_save", "/docs/a.txt", "", user)
+	hub.OperationDone("after_save", "/docs/a.txt", "", user)
+	hub.OperationDone("after_rename", "/docs/a.txt", "/b.txt", user)
+
+	want := []fileEvent{
+		{Type: "modify", Path: "/docs/a.txt"},
+		{Type: "delete", Path: "/docs/a.txt"},
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	for _, w := range want {
+		var got fileEvent
+		for scanner.Scan() {
+			if payload, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				if err := json.Unmarshal([]byte(payload), &got); err != nil {
+					t.Fatal(err)
+				}
+				break
+			}
+		}
+		if got != w {
+			t.Fatalf("expected the event %+v, got %+v", w, got)
+		}
+	}
+}
+
+func TestEventSubscriberScope(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	d := &data{
+		user:     &users.User{Fs: afero.NewBasePathFs(afero.NewOsFs(), root+"/home")},
+		settings: &settings.Settings{},
+	}
+	sub := &eventSubscriber{d: d}
+
+	tests := []struct {
+		event fileEvent
+		want  fileEvent
+		ok    bool
+	}{
+		{fileEvent{Type: "create", Path: root + "/home/a"}, fileEvent{Type: "create", Path: "/a"}, true},
+		{fileEvent{Type: "create", Path: root + "/a"}, fileEvent{}, false},
+		{fileEvent{Type: "move", Path: root + "/a", Dst: root + "/home/b"}, fileEvent{Type: "create", Path: "/b"}, true},
+		{fileEvent{Type: "move", Path: root + "/home/b", Dst: root + "/home/c"}, fileEvent{Type: "move", Path: "/b", Dst: "/c"}, true},
+	}
+
+	for _, tt := range tests {
+		got, ok := sub.scope(tt.event, "/")
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("expected %+v (%t) for %+v, got %+v (%t)", tt.want, tt.ok, tt.event, got, ok)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/filebrowser/filebrowser/v2/runner"
+)
+
+type hookTestRequest struct {
+	Command     string `json:"command"`
+	Event       string `json:"event"`
+	Path        string `json:"path"`
+	Destination string `json:"destination"`
+}
+
+type hookTestResponse struct {
+	*runner.ExecResult
+	Error string `json:"error,omitempty"`
+}
+
+// hookTestHandler runs a hook command for a sample event of the admin, so
+// that it can be checked from the settings without a real file operation.
+var hookTestHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	req := &hookTestRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if req.Command == "" {
+		return http.StatusBadRequest, nil
+	}
+	if req.Event == "" {
+		req.Event = "test"
+	}
+
+	sample := runner.Job{
+		Event:       req.Event,
+		Path:        slashClean(req.Path),
+		Destination: req.Destination,
+	}
+	if sample.Destination != "" {
+		sample.Destination = slashClean(sample.Destination)
+	}
+
+	result, err := d.TestCommand(r.Context(), req.Command, sample, d.user)
+
+	res := &hookTestResponse{ExecResult: result}
+	if res.ExecResult == nil {
+		res.ExecResult = &runner.ExecResult{ExitCode: -1}
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	return renderJSON(w, r, res)
+})
+
+var hookJobsGetHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	return renderJSON(w, r, d.BackgroundJobs())
+})
+
+// hookJobDeleteHandler cancels a running non-blocking hook command.
+var hookJobDeleteHandler = withAdmin(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	err := d.Cancel(mux.Vars(r)["id"])
+	if err != nil {
+		return errToStatus(err), err
+	}
+	return http.StatusNoContent, nil
+})
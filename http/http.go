@@ -5,7 +5,11 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
 
+	"github.com/filebrowser/filebrowser/v2/plugins"
+	"github.com/filebrowser/filebrowser/v2/runner"
+	"github.com/filebrowser/filebrowser/v2/search"
 	"github.com/filebrowser/filebrowser/v2/settings"
 	"github.com/filebrowser/filebrowser/v2/storage"
 )
@@ -20,10 +24,22 @@ func NewHandler(
 	fileCache FileCache,
 	store *storage.Storage,
 	server *settings.Server,
+	hookRunner *runner.Runner,
+	searchIndex *search.Index,
+	plugs []plugins.Plugin,
 	assetsFs fs.FS,
 ) (http.Handler, error) {
 	server.Clean()
 
+	filters, err := newIPFilters(server)
+	if err != nil {
+		return nil, err
+	}
+	compress, err := newCompressor(server)
+	if err != nil {
+		return nil, err
+	}
+
 	r := mux.NewRouter()
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -38,29 +54,87 @@ func NewHandler(
 	// URLs https://www.gorillatoolkit.org/pkg/mux#Router.SkipClean
 	r = r.SkipClean(true)
 
+	events := newEventHub()
+	thumbs := newThumbnailer(imgSvc, fileCache, hookRunner, store, server)
+	sizes, err := newDirSizes(server)
+	if err != nil {
+		return nil, err
+	}
+	// the login limits are shared by the instances through the redis of the
+	// hooks, if any
+	var redisClient *redis.Client
+	if hookRunner != nil {
+		redisClient = hookRunner.RedisClient
+		hookRunner.Listeners = append(hookRunner.Listeners, events)
+		if server.EnableThumbnails {
+			hookRunner.Listeners = append(hookRunner.Listeners, thumbs)
+		}
+		if sizes != nil {
+			hookRunner.Listeners = append(hookRunner.Listeners, sizes)
+		}
+	}
+
 	monkey := func(fn handleFunc, prefix string) http.Handler {
-		return handle(fn, prefix, store, server)
+		return handle(fn, prefix, store, server, hookRunner)
 	}
 
-	r.HandleFunc("/health", healthHandler)
+	r.Handle("/health", monkey(healthHandler, ""))
 	r.PathPrefix("/static").Handler(static)
+
+	logins := newLoginLimiter(server, redisClient, filters)
+	if server.WebDAVPath != "" && server.WebDAVPath != "/" {
+		dav := monkey(webdavHandler(server.WebDAVPath, logins), "")
+		r.Path(server.WebDAVPath).Handler(dav)
+		r.PathPrefix(server.WebDAVPath + "/").Handler(dav)
+	}
+
 	r.NotFoundHandler = index
 
 	api := r.PathPrefix("/api").Subrouter()
 
 	tokenExpirationTime := server.GetTokenExpirationTime(DefaultTokenExpirationTime)
-	api.Handle("/login", monkey(loginHandler(tokenExpirationTime), ""))
+	api.Handle("/login", monkey(limitLogins(logins, loginHandler(tokenExpirationTime)), ""))
 	api.Handle("/signup", monkey(signupHandler, ""))
 	api.Handle("/renew", monkey(renewHandler(tokenExpirationTime), ""))
+	api.Handle("/login/webauthn", monkey(passkeyLoginHandler, "")).Methods("POST")
+	api.Handle("/login/totp", monkey(limitLogins(logins, totpLoginHandler), "")).Methods("POST")
+	api.Handle("/login/limits", monkey(loginLimitsHandler(logins), "")).Methods("GET")
+	api.Handle("/login/oidc", monkey(oidcLoginHandler, "")).Methods("GET")
+	api.Handle("/login/oidc/callback", monkey(oidcCallbackHandler(tokenExpirationTime), "")).Methods("GET")
+
+	api.Handle("/totp", monkey(totpGetHandler, "")).Methods("GET")
+	api.Handle("/totp", monkey(totpPostHandler, "")).Methods("POST")
+	api.Handle("/totp", monkey(totpPutHandler, "")).Methods("PUT")
+	api.Handle("/totp", monkey(totpDeleteHandler, "")).Methods("DELETE")
+
+	passkeys := api.PathPrefix("/passkeys").Subrouter()
+	passkeys.Handle("", monkey(passkeysGetHandler, "")).Methods("GET")
+	passkeys.Handle("", monkey(passkeyPostHandler, "")).Methods("POST")
+	passkeys.Handle("/begin", monkey(passkeyBeginHandler, "")).Methods("POST")
+	passkeys.Handle("/{id}", monkey(passkeyDeleteHandler, "")).Methods("DELETE")
 
 	users := api.PathPrefix("/users").Subrouter()
 	users.Handle("", monkey(usersGetHandler, "")).Methods("GET")
 	users.Handle("", monkey(userPostHandler, "")).Methods("POST")
+	users.Handle("/usage", monkey(usersUsageHandler, "")).Methods("GET")
 	users.Handle("/{id:[0-9]+}", monkey(userPutHandler, "")).Methods("PUT")
 	users.Handle("/{id:[0-9]+}", monkey(userGetHandler, "")).Methods("GET")
 	users.Handle("/{id:[0-9]+}", monkey(userDeleteHandler, "")).Methods("DELETE")
-
-	api.PathPrefix("/resources").Handler(monkey(resourceGetHandler, "/api/resources")).Methods("GET")
+	users.Handle("/{id:[0-9]+}/sessions", monkey(sessionsGetHandler, "")).Methods("GET")
+	users.Handle("/{id:[0-9]+}/sessions", monkey(sessionsDeleteHandler, "")).Methods("DELETE")
+	users.Handle("/{id:[0-9]+}/sessions/{session}", monkey(sessionDeleteHandler, "")).Methods("DELETE")
+	users.Handle("/{id:[0-9]+}/tokens", monkey(tokensGetHandler, "")).Methods("GET")
+	users.Handle("/{id:[0-9]+}/tokens", monkey(tokenPostHandler, "")).Methods("POST")
+	users.Handle("/{id:[0-9]+}/tokens/{token}", monkey(tokenDeleteHandler, "")).Methods("DELETE")
+
+	roles := api.PathPrefix("/roles").Subrouter()
+	roles.Handle("", monkey(rolesGetHandler, "")).Methods("GET")
+	roles.Handle("", monkey(rolePostHandler, "")).Methods("POST")
+	roles.Handle("/{id:[0-9]+}", monkey(roleGetHandler, "")).Methods("GET")
+	roles.Handle("/{id:[0-9]+}", monkey(rolePutHandler, "")).Methods("PUT")
+	roles.Handle("/{id:[0-9]+}", monkey(roleDeleteHandler, "")).Methods("DELETE")
+
+	api.PathPrefix("/resources").Handler(monkey(resourceGetHandler(sizes), "/api/resources")).Methods("GET")
 	api.PathPrefix("/resources").Handler(monkey(resourceDeleteHandler(fileCache), "/api/resources")).Methods("DELETE")
 	api.PathPrefix("/resources").Handler(monkey(resourcePostHandler(fileCache), "/api/resources")).Methods("POST")
 	api.PathPrefix("/resources").Handler(monkey(resourcePutHandler, "/api/resources")).Methods("PUT")
@@ -69,7 +143,28 @@ func NewHandler(
 	api.PathPrefix("/tus").Handler(monkey(tusPostHandler(), "/api/tus")).Methods("POST")
 	api.PathPrefix("/tus").Handler(monkey(tusHeadHandler(), "/api/tus")).Methods("HEAD", "GET")
 	api.PathPrefix("/tus").Handler(monkey(tusPatchHandler(), "/api/tus")).Methods("PATCH")
-	api.PathPrefix("/tus").Handler(monkey(resourceDeleteHandler(fileCache), "/api/tus")).Methods("DELETE")
+	api.PathPrefix("/tus").Handler(monkey(tusDeleteHandler(), "/api/tus")).Methods("DELETE")
+
+	api.Handle("/uploads", monkey(uploadsGetHandler, "")).Methods("GET")
+	api.Handle("/uploads/{id}", monkey(uploadGetHandler, "")).Methods("GET")
+
+	api.PathPrefix("/versions").Handler(monkey(versionsGetHandler, "/api/versions")).Methods("GET")
+	api.PathPrefix("/versions").Handler(monkey(versionRestoreHandler(fileCache), "/api/versions")).Methods("POST")
+	api.Handle("/transfer", monkey(transferHandler(fileCache), "")).Methods("POST")
+	api.Handle("/batch", monkey(batchHandler(fileCache), "")).Methods("POST")
+	api.Handle("/tasks", monkey(tasksGetHandler, "")).Methods("GET")
+	api.Handle("/tasks", monkey(taskPostHandler(fileCache), "")).Methods("POST")
+	api.Handle("/tasks/{id}", monkey(taskGetHandler, "")).Methods("GET")
+	api.Handle("/tasks/{id}", monkey(taskDeleteHandler, "")).Methods("DELETE")
+	api.Handle("/tasks/{id}/resolve", monkey(taskResolveHandler, "")).Methods("POST")
+	api.Handle("/locks", monkey(locksGetHandler, "")).Methods("GET")
+	api.Handle("/locks", monkey(lockPostHandler, "")).Methods("POST")
+	api.Handle("/locks/{token}", monkey(lockPutHandler, "")).Methods("PUT")
+	api.Handle("/locks/{token}", monkey(lockDeleteHandler, "")).Methods("DELETE")
+	api.Handle("/trash", monkey(trashGetHandler, "")).Methods("GET")
+	api.Handle("/trash", monkey(trashDeleteHandler, "")).Methods("DELETE")
+	api.Handle("/trash/{id}", monkey(trashRestoreHandler(fileCache), "")).Methods("POST")
+	api.Handle("/trash/{id}", monkey(trashDeleteHandler, "")).Methods("DELETE")
 
 	api.PathPrefix("/usage").Handler(monkey(diskUsage, "/api/usage")).Methods("GET")
 
@@ -80,17 +175,37 @@ func NewHandler(
 
 	api.Handle("/settings", monkey(settingsGetHandler, "")).Methods("GET")
 	api.Handle("/settings", monkey(settingsPutHandler, "")).Methods("PUT")
+	api.Handle("/settings/keys", monkey(signingKeysGetHandler, "")).Methods("GET")
+	api.Handle("/settings/keys", monkey(signingKeysRotateHandler(tokenExpirationTime), "")).Methods("POST")
+	api.Handle("/config/export", monkey(configExportHandler, "")).Methods("GET")
+	api.Handle("/config/import", monkey(configImportHandler, "")).Methods("POST")
+	api.Handle("/backup", monkey(backupGetHandler, "")).Methods("GET")
+	api.Handle("/hooks/test", monkey(hookTestHandler, "")).Methods("POST")
+	api.Handle("/rules/test", monkey(rulesTestHandler, "")).Methods("POST")
+	api.Handle("/hooks/jobs", monkey(hookJobsGetHandler, "")).Methods("GET")
+	api.Handle("/hooks/jobs/{id}", monkey(hookJobDeleteHandler, "")).Methods("DELETE")
 
 	api.PathPrefix("/raw").Handler(monkey(rawHandler, "/api/raw")).Methods("GET")
 	api.PathPrefix("/preview/{size}/{path:.*}").
-		Handler(monkey(previewHandler(imgSvc, fileCache, server.EnableThumbnails, server.ResizePreview), "/api/preview")).Methods("GET")
+		Handler(monkey(previewHandler(thumbs, server.EnableThumbnails, server.ResizePreview), "/api/preview")).Methods("GET")
 	api.PathPrefix("/command").Handler(monkey(commandsHandler, "/api/command")).Methods("GET")
-	api.PathPrefix("/search").Handler(monkey(searchHandler, "/api/search")).Methods("GET")
+	api.Handle("/events", monkey(eventsHandler(events), "")).Methods("GET")
+	api.Handle("/admin/search", monkey(adminSearchHandler(searchIndex), "")).Methods("GET")
+	api.PathPrefix("/search").Handler(monkey(searchHandler(searchIndex), "/api/search")).Methods("GET")
+	api.Handle("/plugins", monkey(pluginsGetHandler(plugs), "")).Methods("GET")
+	registerPlugins(api, plugs, monkey)
 	api.PathPrefix("/subtitle").Handler(monkey(subtitleHandler, "/api/subtitle")).Methods("GET")
 
 	public := api.PathPrefix("/public").Subrouter()
 	public.PathPrefix("/dl").Handler(monkey(publicDlHandler, "/api/public/dl/")).Methods("GET")
 	public.PathPrefix("/share").Handler(monkey(publicShareHandler, "/api/public/share/")).Methods("GET")
 
-	return stripPrefix(server.BaseURL, r), nil
+	handler := stripPrefix(server.BaseURL, r)
+	if compress.enabled() {
+		handler = compress.middleware(handler)
+	}
+	if filters.enabled() {
+		handler = filters.middleware(handler)
+	}
+	return handler, nil
 }
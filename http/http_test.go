@@ -0,0 +1,18 @@
+package http
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+func TestNewHandlerWithoutRunner(t *testing.T) {
+	t.Parallel()
+
+	server := &settings.Server{Root: t.TempDir(), WebDAVPath: "/dav"}
+	assets := fstest.MapFS{"public/index.html": &fstest.MapFile{Data: []byte("index")}}
+	if _, err := NewHandler(nil, nil, newSessionsStorage(t), server, nil, nil, nil, assets); err != nil {
+		t.Fatal(err)
+	}
+}
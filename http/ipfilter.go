@@ -0,0 +1,193 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// ipList is a list of networks, the single IPs being networks of their
+// own.
+type ipList []*net.IPNet
+
+// parseIPList parses the comma or space separated IPs and CIDRs of a list.
+func parseIPList(s string) (ipList, error) {
+	list := ipList{}
+	for _, entry := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			list = append(list, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", entry, err)
+		}
+		list = append(list, network)
+	}
+	return list, nil
+}
+
+func (l ipList) contains(ip net.IP) bool {
+	for _, network := range l {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipFilter allows the IPs of its allow list, or all of them if empty,
+// unless they're in its deny list.
+type ipFilter struct {
+	allow ipList
+	deny  ipList
+}
+
+func newIPFilter(allow, deny string) (ipFilter, error) {
+	var (
+		f   ipFilter
+		err error
+	)
+	if f.allow, err = parseIPList(allow); err != nil {
+		return f, err
+	}
+	f.deny, err = parseIPList(deny)
+	return f, err
+}
+
+// blocked returns why an IP isn't allowed, or an empty string if it is.
+func (f ipFilter) blocked(ip net.IP) string {
+	switch {
+	case f.deny.contains(ip):
+		return "denied"
+	case len(f.allow) > 0 && !f.allow.contains(ip):
+		return "not allowed"
+	default:
+		return ""
+	}
+}
+
+// ipFilters are the IP filters of the server, the admin one applying to
+// the admin API on top of the general one.
+type ipFilters struct {
+	all     ipFilter
+	admin   ipFilter
+	proxies ipList
+}
+
+func newIPFilters(server *settings.Server) (*ipFilters, error) {
+	var (
+		f   ipFilters
+		err error
+	)
+	if f.all, err = newIPFilter(server.AllowedIPs, server.DeniedIPs); err != nil {
+		return nil, err
+	}
+	if f.admin, err = newIPFilter(server.AdminAllowedIPs, server.AdminDeniedIPs); err != nil {
+		return nil, err
+	}
+	if f.proxies, err = parseIPList(server.TrustedProxies); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// clientIP returns the IP of the client of a request. The X-Forwarded-For
+// header is only read for the requests of the trusted proxies, skipping the
+// proxies it went through from the last one.
+func (f *ipFilters) clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !f.proxies.contains(ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !f.proxies.contains(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+type clientAccessKey struct{}
+
+// clientAccess is what the IP filters decided for the client of a request.
+type clientAccess struct {
+	ip   net.IP
+	addr string
+	// admin is why the admin API is blocked, empty if it isn't.
+	admin string
+}
+
+// enabled tells if any of the lists is set.
+func (f *ipFilters) enabled() bool {
+	return len(f.all.allow)+len(f.all.deny)+len(f.admin.allow)+len(f.admin.deny) > 0
+}
+
+// middleware refuses the requests of the blocked IPs with a 403, and lets
+// withAdmin know if the admin API is blocked for the other ones. The
+// clients without an IP, such as the ones of a socket, are only allowed
+// without an allow list.
+func (f *ipFilters) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		access := clientAccess{addr: r.RemoteAddr}
+		if ip := f.clientIP(r); ip != nil {
+			access.ip, access.addr = ip, ip.String()
+		}
+
+		if reason := f.all.blocked(access.ip); reason != "" {
+			log.Printf("[WARN] Blocked %s %s from %s: %s", r.Method, r.URL.Path, access.addr, reason)
+			http.Error(w, strconv.Itoa(http.StatusForbidden)+" "+http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		access.admin = f.admin.blocked(access.ip)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientAccessKey{}, access)))
+	})
+}
+
+// adminBlocked logs and tells if the admin API is blocked for the client of
+// a request.
+func adminBlocked(r *http.Request) bool {
+	access, ok := r.Context().Value(clientAccessKey{}).(clientAccess)
+	if !ok || access.admin == "" {
+		return false
+	}
+	log.Printf("[WARN] Blocked the admin API %s %s from %s: %s", r.Method, r.URL.Path, access.addr, access.admin)
+	return true
+}
+
+// restrictAdmin takes the admin permission away from the user of a request
+// whose client is blocked from the admin API, for the handlers checking it
+// by themselves, such as the ones of the users.
+func restrictAdmin(r *http.Request, user *users.User) {
+	if access, ok := r.Context().Value(clientAccessKey{}).(clientAccess); ok && access.admin != "" {
+		user.Perm.Admin = false
+	}
+}
@@ -0,0 +1,171 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestParseIPList(t *testing.T) {
+	list, err := parseIPList("10.0.0.0/8, 192.168.1.10 ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]bool{
+		"10.1.2.3":     true,
+		"192.168.1.10": true,
+		"192.168.1.11": false,
+		"::1":          true,
+		"::2":          false,
+	} {
+		if got := list.contains(net.ParseIP(ip)); got != want {
+			t.Errorf("contains(%s) = %t, want %t", ip, got, want)
+		}
+	}
+
+	for _, invalid := range []string{"10.0.0.0/33", "localhost", "10.0.0"} {
+		if _, err := parseIPList(invalid); err == nil {
+			t.Errorf("expected %q to be refused", invalid)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	filters, err := newIPFilters(&settings.Server{TrustedProxies: "10.0.0.1, 10.0.0.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		// the header of the other clients is ignored
+		{"1.2.3.4:1000", []string{"5.6.7.8"}, "1.2.3.4"},
+		{"10.0.0.1:1000", nil, "10.0.0.1"},
+		{"10.0.0.1:1000", []string{"5.6.7.8"}, "5.6.7.8"},
+		// the forged hops before the trusted proxies are skipped
+		{"10.0.0.1:1000", []string{"9.9.9.9, 5.6.7.8, 10.0.0.2"}, "5.6.7.8"},
+		{"10.0.0.1:1000", []string{"9.9.9.9", "5.6.7.8"}, "5.6.7.8"},
+		{"10.0.0.1:1000", []string{"garbage"}, "10.0.0.1"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remote
+		for _, value := range tc.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if got := filters.clientIP(r); got.String() != tc.want {
+			t.Errorf("clientIP(%s, %q) = %s, want %s", tc.remote, tc.forwarded, got, tc.want)
+		}
+	}
+}
+
+func TestIPFilters(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	user, err := st.Users.Get("", uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Perm.Admin = true
+	if err := st.Users.Update(user, "Perm"); err != nil {
+		t.Fatal(err)
+	}
+	token := issueToken(t, st)
+
+	filters, err := newIPFilters(&settings.Server{
+		AllowedIPs:      "10.0.0.0/8",
+		DeniedIPs:       "10.0.0.66",
+		AdminAllowedIPs: "10.1.0.0/16",
+		TrustedProxies:  "10.0.0.1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := filters.middleware(handle(withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		return renderJSON(w, r, "ok")
+	}), "", st, &settings.Server{}, nil))
+
+	for _, tc := range []struct {
+		remote, forwarded string
+		want              int
+	}{
+		{"10.1.0.5:1000", "", http.StatusOK},
+		{"10.2.0.5:1000", "", http.StatusForbidden},
+		{"10.0.0.66:1000", "", http.StatusForbidden},
+		{"8.8.8.8:1000", "", http.StatusForbidden},
+		{"8.8.8.8:1000", "10.1.0.5", http.StatusForbidden},
+		{"10.0.0.1:1000", "10.1.0.5", http.StatusOK},
+		{"10.0.0.1:1000", "8.8.8.8", http.StatusForbidden},
+		{"@", "", http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remote
+		r.Header.Set("X-Auth", token)
+		if tc.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		recorder := httptest.NewRecorder()
+		admin.ServeHTTP(recorder, r)
+		if recorder.Code != tc.want {
+			t.Errorf("%s forwarding %q: expected %d, got %d", tc.remote, tc.forwarded, tc.want, recorder.Code)
+		}
+	}
+}
+
+func TestIPFiltersSelfOrAdmin(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	admin, err := st.Users.Get("", uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin.Perm.Admin = true
+	if err := st.Users.Update(admin, "Perm"); err != nil {
+		t.Fatal(err)
+	}
+	other := &users.User{Username: "other", Password: "pw"}
+	if err := st.Users.Save(other); err != nil {
+		t.Fatal(err)
+	}
+	token := issueToken(t, st)
+
+	filters, err := newIPFilters(&settings.Server{AdminAllowedIPs: "10.1.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := func(remote string) int {
+		body := `{"what":"user","which":["perm"],"data":{"id":2,"perm":{"admin":true}}}`
+		r := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		r.RemoteAddr = remote
+		r.Header.Set("X-Auth", token)
+		r = mux.SetURLVars(r, map[string]string{"id": "2"})
+		recorder := httptest.NewRecorder()
+		filters.middleware(handle(userPutHandler, "", st, &settings.Server{}, nil)).ServeHTTP(recorder, r)
+		return recorder.Code
+	}
+
+	// the admins of the blocked IPs aren't admins for the other users
+	if code := put("10.2.0.5:1000"); code != http.StatusForbidden {
+		t.Errorf("expected the blocked admin not to change another user, got %d", code)
+	}
+	if got, err := st.Users.Get("", other.ID); err != nil || got.Perm.Admin {
+		t.Fatalf("expected the user not to be an admin, got %v", err)
+	}
+	if code := put("10.1.0.5:1000"); code != http.StatusOK {
+		t.Errorf("expected the allowed admin to change another user, got %d", code)
+	}
+	if got, err := st.Users.Get("", other.ID); err != nil || !got.Perm.Admin {
+		t.Errorf("expected the user to be an admin, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package http
+
+import (
+	"context"
+
+	"github.com/filebrowser/filebrowser/v2/files"
+	"github.com/filebrowser/filebrowser/v2/runner"
+)
+
+// transformListing hides and annotates the files of a listing as its
+// listing hooks ask, see runner.TransformListing. The hidden files are only
+// left out of the listing, they can still be reached.
+func transformListing(ctx context.Context, d *data, file *files.FileInfo) error {
+	if file.Listing == nil {
+		return nil
+	}
+
+	entries := make([]runner.ListingEntry, len(file.Items))
+	for i, item := range file.Items {
+		entries[i] = runner.ListingEntry{Name: item.Name, IsDir: item.IsDir, Size: item.Size, Modified: item.ModTime}
+	}
+	transformed, err := d.TransformListing(ctx, file.Path, d.user, entries)
+	if err != nil {
+		return err
+	}
+
+	kept := map[string]runner.ListingEntry{}
+	for _, entry := range transformed {
+		kept[entry.Name] = entry
+	}
+	items := make([]*files.FileInfo, 0, len(transformed))
+	file.NumDirs, file.NumFiles = 0, 0
+	for _, item := range file.Items {
+		entry, ok := kept[item.Name]
+		if !ok {
+			continue
+		}
+		item.Annotations = entry.Annotations
+		items = append(items, item)
+		if item.IsDir {
+			file.NumDirs++
+		} else {
+			file.NumFiles++
+		}
+	}
+	file.Items = items
+	return nil
+}
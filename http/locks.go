@@ -0,0 +1,304 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/afero"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/files"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// The time to live of the locks, when none is asked for, and at most.
+const (
+	defaultLockTTL = 5 * time.Minute
+	maxLockTTL     = time.Hour
+)
+
+// fileLock is an advisory lock on a file, or on a directory and the files
+// under it. The operations changing the locked files are refused to the
+// other users, unless they give its token in the X-Lock-Token header.
+type fileLock struct {
+	Token string `json:"token"`
+	// Path is relative to the scope of the user reading the lock.
+	Path    string    `json:"path"`
+	Owner   string    `json:"owner"`
+	OwnerID uint      `json:"ownerID"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+
+	// key is the real path of the file, which the locks of users with
+	// different scopes are compared on.
+	key string
+}
+
+// lockedError tells who locked a file. It is fbErrors.ErrLocked.
+type lockedError struct {
+	Owner   string
+	Expires time.Time
+}
+
+func (e *lockedError) Error() string {
+	return fmt.Sprintf("locked by %s until %s", e.Owner, e.Expires.UTC().Format(time.RFC3339))
+}
+
+func (e *lockedError) Is(target error) bool {
+	return target == fbErrors.ErrLocked
+}
+
+// lockTable keeps the locks, by token.
+type lockTable struct {
+	mu    sync.Mutex
+	locks map[string]*fileLock
+}
+
+var fileLocks = &lockTable{locks: map[string]*fileLock{}}
+
+// lockKey returns the real path of a file of a user.
+func lockKey(user *users.User, p string) string {
+	if fs, ok := user.Fs.(*afero.BasePathFs); ok {
+		return path.Clean(filepath.ToSlash(afero.FullBaseFsPath(fs, p)))
+	}
+	return path.Join("/", user.Scope, p)
+}
+
+// under tells if a path is dir or under it.
+func under(dir, p string) bool {
+	return dir == "/" || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// overlap tells if the locks of two paths would cover the same file.
+func overlap(a, b string) bool {
+	return under(a, b) || under(b, a)
+}
+
+// expire forgets the expired locks. The table must be locked.
+func (t *lockTable) expire(now time.Time) {
+	for token, lock := range t.locks {
+		if !now.Before(lock.Expires) {
+			delete(t.locks, token)
+		}
+	}
+}
+
+// conflict returns the lock keeping a user from changing a path of the
+// scope of owner, if any. The locks of the user and the one of the token
+// don't.
+func (t *lockTable) conflict(user, owner *users.User, p, token string, now time.Time) *fileLock {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expire(now)
+	return t.find(user, lockKey(owner, p), token)
+}
+
+// find returns the lock keeping a user from changing the key, a copy of
+// it. The table must be locked.
+func (t *lockTable) find(user *users.User, key, token string) *fileLock {
+	for _, lock := range t.locks {
+		if lock.OwnerID != user.ID && lock.Token != token && overlap(lock.key, key) {
+			l := *lock
+			return &l
+		}
+	}
+	return nil
+}
+
+// lock locks a path of a user for ttl, unless some of its files are locked
+// by someone else.
+func (t *lockTable) lock(user *users.User, p string, ttl time.Duration, now time.Time) (*fileLock, error) {
+	id := make([]byte, 16) //nolint:gomnd
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expire(now)
+	key := lockKey(user, p)
+	if other := t.find(user, key, ""); other != nil {
+		return nil, &lockedError{Owner: other.Owner, Expires: other.Expires}
+	}
+
+	lock := &fileLock{
+		Token:   hex.EncodeToString(id),
+		Path:    p,
+		Owner:   user.Username,
+		OwnerID: user.ID,
+		Created: now,
+		Expires: now.Add(ttl),
+		key:     key,
+	}
+	t.locks[lock.Token] = lock
+	l := *lock
+	return &l, nil
+}
+
+// refresh extends a lock of a user for ttl from now.
+func (t *lockTable) refresh(user *users.User, token string, ttl time.Duration, now time.Time) (*fileLock, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expire(now)
+
+	lock, ok := t.locks[token]
+	if !ok || lock.OwnerID != user.ID {
+		return nil, fbErrors.ErrNotExist
+	}
+	lock.Expires = now.Add(ttl)
+	l := *lock
+	return &l, nil
+}
+
+// unlock removes a lock of a user, or any lock for the admins.
+func (t *lockTable) unlock(user *users.User, token string, now time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expire(now)
+
+	lock, ok := t.locks[token]
+	if !ok || (lock.OwnerID != user.ID && !user.Perm.Admin) {
+		return fbErrors.ErrNotExist
+	}
+	delete(t.locks, token)
+	return nil
+}
+
+// list returns the locks of the files of the scope of a user, with their
+// paths relative to it. The tokens of the locks of the others are left
+// out.
+func (t *lockTable) list(user *users.User, now time.Time) []fileLock {
+	scope := lockKey(user, "/")
+
+	t.mu.Lock()
+	locks := []fileLock{}
+	t.expire(now)
+	for _, lock := range t.locks {
+		if !under(scope, lock.key) {
+			continue
+		}
+		l := *lock
+		l.Path = path.Join("/", strings.TrimPrefix(lock.key, scope))
+		if l.OwnerID != user.ID {
+			l.Token = ""
+		}
+		locks = append(locks, l)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Path < locks[j].Path })
+	return locks
+}
+
+// CheckLock implements runner.Locker.
+func (d *data) CheckLock(p string, user *users.User) error {
+	if lock := fileLocks.conflict(d.user, user, p, d.lockToken, time.Now()); lock != nil {
+		return &lockedError{Owner: lock.Owner, Expires: lock.Expires}
+	}
+	return nil
+}
+
+// showLocks gives their lock to a file and the files of its listing.
+func showLocks(d *data, file *files.FileInfo) {
+	locks := map[string]*files.Lock{}
+	for _, lock := range fileLocks.list(d.user, time.Now()) {
+		locks[lock.Path] = &files.Lock{Owner: lock.Owner, Expires: lock.Expires}
+	}
+	if len(locks) == 0 {
+		return
+	}
+
+	file.Lock = locks[path.Clean("/"+file.Path)]
+	if file.Listing == nil {
+		return
+	}
+	for _, item := range file.Items {
+		item.Lock = locks[path.Clean("/"+item.Path)]
+	}
+}
+
+type lockRequest struct {
+	Path string `json:"path"`
+	// TTL is the time to live of the lock in seconds, defaultLockTTL when
+	// zero and maxLockTTL at most.
+	TTL int `json:"ttl"`
+}
+
+func (req *lockRequest) ttl() (time.Duration, error) {
+	switch {
+	case req.TTL < 0:
+		return 0, fbErrors.ErrInvalidRequestParams
+	case req.TTL == 0:
+		return defaultLockTTL, nil
+	case req.TTL > int(maxLockTTL/time.Second):
+		return maxLockTTL, nil
+	default:
+		return time.Duration(req.TTL) * time.Second, nil
+	}
+}
+
+var locksGetHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	return renderJSON(w, r, fileLocks.list(d.user, time.Now()))
+})
+
+// lockPostHandler locks a file of the user, who must be able to change it.
+var lockPostHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	var req lockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return http.StatusBadRequest, err
+	}
+	ttl, err := req.ttl()
+	if err != nil || req.Path == "" {
+		return http.StatusBadRequest, err
+	}
+
+	p := path.Clean("/" + req.Path)
+	if !d.user.Perm.Modify || !d.Check(p) {
+		return http.StatusForbidden, nil
+	}
+	if _, err := d.user.Fs.Stat(p); err != nil {
+		return errToStatus(err), err
+	}
+
+	lock, err := fileLocks.lock(d.user, p, ttl, time.Now())
+	if err != nil {
+		return errToStatus(err), err
+	}
+	return renderJSON(w, r, lock)
+})
+
+// lockPutHandler refreshes a lock of the user.
+var lockPutHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	var req lockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return http.StatusBadRequest, err
+	}
+	ttl, err := req.ttl()
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	lock, err := fileLocks.refresh(d.user, mux.Vars(r)["token"], ttl, time.Now())
+	if err != nil {
+		return errToStatus(err), err
+	}
+	return renderJSON(w, r, lock)
+})
+
+// lockDeleteHandler removes a lock of the user, the admins removing any.
+var lockDeleteHandler = withUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	if err := fileLocks.unlock(d.user, mux.Vars(r)["token"], time.Now()); err != nil {
+		return errToStatus(err), err
+	}
+	return http.StatusNoContent, nil
+})
@@ -0,0 +1,167 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/filebrowser/filebrowser/v2/files"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestLocks(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	owner, err := st.Users.Get("", uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner.Perm = users.Permissions{Modify: true}
+	if err := st.Users.Update(owner, "Perm"); err != nil {
+		t.Fatal(err)
+	}
+	other := &users.User{Username: "other", Password: "pw", Perm: users.Permissions{Create: true, Modify: true}}
+	if err := st.Users.Save(other); err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "dir", "a.txt"), []byte("a"), 0644); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+	server := &settings.Server{Root: root}
+
+	tokens := map[uint]string{}
+	for _, id := range []uint{owner.ID, other.ID} {
+		id := id
+		login := func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+			user, err := d.store.Users.Get(d.server.Root, id)
+			if err != nil {
+				return http.StatusInternalServerError, err
+			}
+			return printToken(w, r, d, user, time.Hour)
+		}
+		recorder := httptest.NewRecorder()
+		handle(login, "", st, server, nil).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		tokens[id] = recorder.Body.String()
+	}
+
+	serve := func(fn handleFunc, user uint, method, target, lockToken string, body interface{}) *httptest.ResponseRecorder {
+		t.Helper()
+
+		var reader io.Reader = http.NoBody
+		if s, ok := body.(string); ok {
+			reader = strings.NewReader(s)
+		} else if body != nil {
+			encoded, _ := json.Marshal(body)
+			reader = bytes.NewReader(encoded)
+		}
+		r := httptest.NewRequest(method, target, reader)
+		r.Header.Set("X-Auth", tokens[user])
+		if lockToken != "" {
+			r.Header.Set("X-Lock-Token", lockToken)
+		}
+		r = mux.SetURLVars(r, map[string]string{"token": lockToken})
+
+		recorder := httptest.NewRecorder()
+		handle(fn, "", st, server, nil).ServeHTTP(recorder, r)
+		return recorder
+	}
+	save := func(user uint, lockToken string) int {
+		return serve(resourcePutHandler, user, http.MethodPut, "/dir/a.txt", lockToken, "changed").Code
+	}
+
+	res := serve(lockPostHandler, owner.ID, http.MethodPost, "/", "", lockRequest{Path: "/dir", TTL: 60})
+	var lock fileLock
+	if err := json.Unmarshal(res.Body.Bytes(), &lock); err != nil || res.Code != http.StatusOK || lock.Token == "" {
+		t.Fatalf("expected the directory to be locked, got %d and %v", res.Code, err)
+	}
+
+	// the files under the lock are only changed by its owner, or with its
+	// token
+	res = serve(resourcePutHandler, other.ID, http.MethodPut, "/dir/a.txt", "", "changed")
+	if res.Code != http.StatusLocked || !strings.Contains(res.Body.String(), "locked by username") {
+		t.Errorf("expected the file to be locked, got %d: %s", res.Code, res.Body)
+	}
+	// the refused uploads leave the locked file as it is
+	upload := resourcePostHandler(&memoryCache{values: map[string][]byte{}})
+	if res := serve(upload, other.ID, http.MethodPost, "/dir/a.txt?override=true", "", "replaced"); res.Code != http.StatusLocked {
+		t.Errorf("expected the upload over the locked file to be refused, got %d", res.Code)
+	}
+	if content, err := os.ReadFile(filepath.Join(root, "dir", "a.txt")); err != nil || string(content) != "a" {
+		t.Errorf("expected the locked file to be kept, got %q and %v", content, err)
+	}
+	if code := save(other.ID, lock.Token); code != http.StatusOK {
+		t.Errorf("expected the token to unlock the file, got %d", code)
+	}
+	if code := save(owner.ID, ""); code != http.StatusOK {
+		t.Errorf("expected the owner to change the file, got %d", code)
+	}
+	if res := serve(lockPostHandler, other.ID, http.MethodPost, "/", "", lockRequest{Path: "/dir/a.txt"}); res.Code != http.StatusLocked {
+		t.Errorf("expected the locked file not to be locked again, got %d", res.Code)
+	}
+
+	// the listings tell who locked the files
+	res = serve(resourceGetHandler(nil), other.ID, http.MethodGet, "/", "", nil)
+	var listing files.FileInfo
+	if err := json.Unmarshal(res.Body.Bytes(), &listing); err != nil || listing.Listing == nil || len(listing.Items) != 1 {
+		t.Fatalf("expected the listing, got %d and %v", res.Code, err)
+	}
+	if l := listing.Items[0].Lock; l == nil || l.Owner != "username" {
+		t.Errorf("expected the lock of the directory, got %+v", l)
+	}
+
+	// the locks are refreshed and removed by their owner
+	if res := serve(lockPutHandler, other.ID, http.MethodPut, "/", lock.Token, lockRequest{TTL: 120}); res.Code != http.StatusNotFound {
+		t.Errorf("expected the lock of another user not to be refreshed, got %d", res.Code)
+	}
+	res = serve(lockPutHandler, owner.ID, http.MethodPut, "/", lock.Token, lockRequest{TTL: 120})
+	var refreshed fileLock
+	if err := json.Unmarshal(res.Body.Bytes(), &refreshed); err != nil || !refreshed.Expires.After(lock.Expires) {
+		t.Errorf("expected the lock to be refreshed, got %d and %v", res.Code, err)
+	}
+	if res := serve(lockDeleteHandler, other.ID, http.MethodDelete, "/", lock.Token, nil); res.Code != http.StatusNotFound {
+		t.Errorf("expected the lock of another user not to be removed, got %d", res.Code)
+	}
+	if res := serve(lockDeleteHandler, owner.ID, http.MethodDelete, "/", lock.Token, nil); res.Code != http.StatusNoContent {
+		t.Errorf("expected the lock to be removed, got %d", res.Code)
+	}
+	if code := save(other.ID, ""); code != http.StatusOK {
+		t.Errorf("expected the file to be unlocked, got %d", code)
+	}
+}
+
+func TestLockTableExpiration(t *testing.T) {
+	table := &lockTable{locks: map[string]*fileLock{}}
+	owner := &users.User{ID: 1, Username: "owner", Scope: "/scope"}
+	other := &users.User{ID: 2, Username: "other", Scope: "/"}
+	now := time.Now()
+
+	if _, err := table.lock(owner, "/dir", time.Minute, now); err != nil {
+		t.Fatal(err)
+	}
+	// the scopes are compared on the real paths
+	if table.conflict(other, other, "/scope/dir/file", "", now) == nil {
+		t.Error("expected the file of the scope of the owner to be locked")
+	}
+	if table.conflict(other, other, "/scope/directory", "", now) != nil {
+		t.Error("expected a sibling not to be locked")
+	}
+	if table.conflict(other, other, "/scope/dir/file", "", now.Add(time.Minute)) != nil {
+		t.Error("expected the lock to expire")
+	}
+}
@@ -0,0 +1,401 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+const (
+	// loginBackoffPeriod is how long the lockouts of a key are remembered
+	// to double the next one.
+	loginBackoffPeriod = 24 * time.Hour
+	// maxLoginLockout is the longest a backoff locks a key out for.
+	maxLoginLockout = 24 * time.Hour
+	// maxLoginBody is the size of the login bodies read to get their
+	// username.
+	maxLoginBody = 1 << 20
+	// loginLimitPrefix is the prefix of the redis keys of the counters.
+	loginLimitPrefix = "filebrowser:login:"
+)
+
+// loginAttempts keeps the failed logins and the lockouts of the keys, the
+// IPs and the usernames.
+type loginAttempts interface {
+	// fail counts a failed login and returns the failures of the window.
+	fail(ctx context.Context, key string, window time.Duration) (int64, error)
+	// lock locks a key out, resetting its failures. lockout returns how
+	// long for from the number of times it was locked out in the backoff
+	// period, including this one.
+	lock(ctx context.Context, key string, lockout func(int64) time.Duration) (time.Duration, error)
+	// lockedFor returns how long a key remains locked out, zero if it isn't.
+	lockedFor(ctx context.Context, key string) (time.Duration, error)
+	// reset forgets the failures of a key.
+	reset(ctx context.Context, key string) error
+}
+
+// loginLimitStats are the counters of the limiter since the start, for the
+// monitoring.
+type loginLimitStats struct {
+	Backend  string `json:"backend"`
+	Failures uint64 `json:"failures"`
+	Lockouts uint64 `json:"lockouts"`
+	Rejected uint64 `json:"rejected"`
+	Errors   uint64 `json:"errors"`
+}
+
+// loginLimiter locks the IPs and the usernames with too many failed logins
+// out for a while.
+type loginLimiter struct {
+	attempts         loginAttempts
+	backend          string
+	maxAttempts      int
+	maxAttemptsPerIP int
+	window           time.Duration
+	lockout          time.Duration
+	backoff          bool
+	filters          *ipFilters
+	now              func() time.Time
+
+	failures atomic.Uint64
+	lockouts atomic.Uint64
+	rejected atomic.Uint64
+	storeErr atomic.Uint64
+}
+
+// newLoginLimiter returns the limiter of the server settings, keeping the
+// counters in redis when there is a client to share them between the
+// instances, in memory otherwise. The IPs are the ones of the clients
+// behind the trusted proxies of the filters.
+func newLoginLimiter(server *settings.Server, client *redis.Client, filters *ipFilters) *loginLimiter {
+	l := &loginLimiter{
+		maxAttempts:      server.GetLoginMaxAttempts(),
+		maxAttemptsPerIP: server.GetLoginMaxAttemptsPerIP(),
+		window:           server.GetLoginAttemptWindow(),
+		lockout:          server.GetLoginLockout(),
+		backoff:          server.LoginBackoff,
+		filters:          filters,
+		now:              time.Now,
+	}
+	if client != nil {
+		l.attempts, l.backend = &redisLoginAttempts{client: client}, "redis"
+	} else {
+		l.attempts, l.backend = newMemoryLoginAttempts(l), "memory"
+	}
+	return l
+}
+
+func (l *loginLimiter) stats() loginLimitStats {
+	return loginLimitStats{
+		Backend:  l.backend,
+		Failures: l.failures.Load(),
+		Lockouts: l.lockouts.Load(),
+		Rejected: l.rejected.Load(),
+		Errors:   l.storeErr.Load(),
+	}
+}
+
+// loginKey is a key of the limiter and the failures it's locked out after.
+type loginKey struct {
+	key         string
+	maxAttempts int
+}
+
+func (l *loginLimiter) keys(r *http.Request, username string) []loginKey {
+	keys := []loginKey{}
+	if l.maxAttemptsPerIP > 0 {
+		addr := r.RemoteAddr
+		if ip := l.filters.clientIP(r); ip != nil {
+			addr = ip.String()
+		}
+		keys = append(keys, loginKey{"ip:" + addr, l.maxAttemptsPerIP})
+	}
+	if username != "" && l.maxAttempts > 0 {
+		keys = append(keys, loginKey{"user:" + strings.ToLower(username), l.maxAttempts})
+	}
+	return keys
+}
+
+// loginUsername returns the username of a login body, leaving the body to
+// be read again by the handler.
+func loginUsername(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxLoginBody))
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var cred struct {
+		Username string `json:"username"`
+	}
+	_ = json.Unmarshal(body, &cred)
+	return cred.Username
+}
+
+// lockoutFor returns the lockout after some in the backoff period, doubling
+// each time when backing off.
+func (l *loginLimiter) lockoutFor(n int64) time.Duration {
+	lockout := l.lockout
+	if !l.backoff {
+		return lockout
+	}
+	for i := int64(1); i < n && lockout < maxLoginLockout; i++ {
+		lockout = min(2*lockout, maxLoginLockout)
+	}
+	return lockout
+}
+
+func (l *loginLimiter) logError(err error) {
+	l.storeErr.Add(1)
+	log.Printf("[WARN] Failed to count the failed logins: %v", err)
+}
+
+// limitLogins rejects the logins of the IPs and the usernames locked out
+// with 429 and a Retry-After header, and counts the logins fn rejects with
+// 403. The failures are counted from the first one for the window, and a
+// successful login resets the ones of its username. The IPs and the
+// usernames can't be checked when the counters are unavailable, so the
+// logins are let through then.
+func limitLogins(l *loginLimiter, fn handleFunc) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		keys := l.keys(r, loginUsername(r))
+		if l.locked(w, r, keys) {
+			return http.StatusTooManyRequests, nil
+		}
+
+		status, err := fn(w, r, d)
+		switch {
+		case status == http.StatusForbidden:
+			l.failed(r.Context(), keys)
+		case status == 0 || status == http.StatusOK:
+			l.succeeded(r.Context(), keys)
+		}
+		return status, err
+	}
+}
+
+// locked tells if any of the keys is locked out, setting the Retry-After
+// header of the response if so.
+func (l *loginLimiter) locked(w http.ResponseWriter, r *http.Request, keys []loginKey) bool {
+	var retryAfter time.Duration
+	for _, k := range keys {
+		locked, err := l.attempts.lockedFor(r.Context(), k.key)
+		if err != nil {
+			l.logError(err)
+			continue
+		}
+		retryAfter = max(retryAfter, locked)
+	}
+	if retryAfter == 0 {
+		return false
+	}
+
+	l.rejected.Add(1)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	return true
+}
+
+// failed counts a failed login for the keys.
+func (l *loginLimiter) failed(ctx context.Context, keys []loginKey) {
+	l.failures.Add(1)
+	for _, k := range keys {
+		l.fail(ctx, k)
+	}
+}
+
+// succeeded resets the failures of the usernames of the keys.
+func (l *loginLimiter) succeeded(ctx context.Context, keys []loginKey) {
+	for _, k := range keys {
+		if !strings.HasPrefix(k.key, "user:") {
+			continue
+		}
+		if err := l.attempts.reset(ctx, k.key); err != nil {
+			l.logError(err)
+		}
+	}
+}
+
+func (l *loginLimiter) fail(ctx context.Context, k loginKey) {
+	n, err := l.attempts.fail(ctx, k.key, l.window)
+	if err != nil {
+		l.logError(err)
+		return
+	}
+	if n < int64(k.maxAttempts) {
+		return
+	}
+
+	lockout, err := l.attempts.lock(ctx, k.key, l.lockoutFor)
+	if err != nil {
+		l.logError(err)
+		return
+	}
+	l.lockouts.Add(1)
+	log.Printf("[WARN] Locked the logins of %s out for %s after %d failures", k.key, lockout, n)
+}
+
+// loginLimitsHandler reports the counters of the limiter.
+func loginLimitsHandler(l *loginLimiter) handleFunc {
+	return withAdmin(func(w http.ResponseWriter, r *http.Request, _ *data) (int, error) {
+		return renderJSON(w, r, l.stats())
+	})
+}
+
+// memoryLoginAttempts keeps the counters of a single instance.
+type memoryLoginAttempts struct {
+	mu        sync.Mutex
+	limiter   *loginLimiter
+	keys      map[string]*memoryLoginKey
+	nextSweep time.Time
+}
+
+type memoryLoginKey struct {
+	failures    int64
+	windowEnd   time.Time
+	lockedUntil time.Time
+	lockouts    int64
+	backoffEnd  time.Time
+}
+
+func newMemoryLoginAttempts(l *loginLimiter) *memoryLoginAttempts {
+	return &memoryLoginAttempts{limiter: l, keys: map[string]*memoryLoginKey{}}
+}
+
+// get returns the counters of a key, forgetting the expired ones once in
+// a while.
+func (m *memoryLoginAttempts) get(key string, now time.Time) *memoryLoginKey {
+	if now.After(m.nextSweep) {
+		for k, v := range m.keys {
+			if now.After(v.windowEnd) && now.After(v.lockedUntil) && now.After(v.backoffEnd) {
+				delete(m.keys, k)
+			}
+		}
+		m.nextSweep = now.Add(time.Minute)
+	}
+
+	v, ok := m.keys[key]
+	if !ok {
+		v = &memoryLoginKey{}
+		m.keys[key] = v
+	}
+	return v
+}
+
+func (m *memoryLoginAttempts) fail(_ context.Context, key string, window time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.limiter.now()
+	v := m.get(key, now)
+	if now.After(v.windowEnd) {
+		v.failures, v.windowEnd = 0, now.Add(window)
+	}
+	v.failures++
+	return v.failures, nil
+}
+
+func (m *memoryLoginAttempts) lock(_ context.Context, key string, lockout func(int64) time.Duration) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.limiter.now()
+	v := m.get(key, now)
+	if now.After(v.backoffEnd) {
+		v.lockouts = 0
+	}
+	v.lockouts++
+	v.backoffEnd = now.Add(loginBackoffPeriod)
+
+	d := lockout(v.lockouts)
+	v.failures, v.windowEnd, v.lockedUntil = 0, time.Time{}, now.Add(d)
+	return d, nil
+}
+
+func (m *memoryLoginAttempts) lockedFor(_ context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	v, ok := m.keys[key]
+	if !ok {
+		return 0, nil
+	}
+	return max(v.lockedUntil.Sub(m.limiter.now()), 0), nil
+}
+
+func (m *memoryLoginAttempts) reset(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if v, ok := m.keys[key]; ok {
+		v.failures, v.windowEnd = 0, time.Time{}
+	}
+	return nil
+}
+
+// redisLoginAttempts keeps the counters in redis, shared by the instances
+// using the same server, with the keys expiring with the windows and the
+// lockouts.
+type redisLoginAttempts struct {
+	client *redis.Client
+}
+
+func (a *redisLoginAttempts) fail(ctx context.Context, key string, window time.Duration) (int64, error) {
+	name := loginLimitPrefix + "failures:" + key
+	n, err := a.client.Incr(ctx, name).Result()
+	if err != nil {
+		return 0, err
+	}
+	if n == 1 {
+		err = a.client.PExpire(ctx, name, window).Err()
+	}
+	return n, err
+}
+
+func (a *redisLoginAttempts) lock(ctx context.Context, key string, lockout func(int64) time.Duration) (time.Duration, error) {
+	name := loginLimitPrefix + "lockouts:" + key
+	n, err := a.client.Incr(ctx, name).Result()
+	if err != nil {
+		return 0, err
+	}
+	if err := a.client.PExpire(ctx, name, loginBackoffPeriod).Err(); err != nil {
+		return 0, err
+	}
+
+	d := lockout(n)
+	_, err = a.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, loginLimitPrefix+"locked:"+key, n, d)
+		pipe.Del(ctx, loginLimitPrefix+"failures:"+key)
+		return nil
+	})
+	return d, err
+}
+
+func (a *redisLoginAttempts) lockedFor(ctx context.Context, key string) (time.Duration, error) {
+	d, err := a.client.PTTL(ctx, loginLimitPrefix+"locked:"+key).Result()
+	if errors.Is(err, redis.Nil) || d < 0 {
+		return 0, nil
+	}
+	return d, err
+}
+
+func (a *redisLoginAttempts) reset(ctx context.Context, key string) error {
+	return a.client.Del(ctx, loginLimitPrefix+"failures:"+key).Err()
+}
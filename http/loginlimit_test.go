@@ -0,0 +1,126 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+func TestLimitLogins(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newLoginLimiter(&settings.Server{
+		LoginMaxAttempts:      2,
+		LoginMaxAttemptsPerIP: 5,
+		LoginLockout:          "1m",
+		LoginBackoff:          true,
+	}, nil, &ipFilters{})
+	l.now = func() time.Time { return now }
+
+	password := "right"
+	fn := limitLogins(l, func(_ http.ResponseWriter, r *http.Request, _ *data) (int, error) {
+		if !strings.Contains(readBody(t, r), `"password":"`+password) {
+			return http.StatusForbidden, nil
+		}
+		return http.StatusOK, nil
+	})
+	login := func(username, pw, ip string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/login",
+			strings.NewReader(`{"username":"`+username+`","password":"`+pw+`"}`))
+		r.RemoteAddr = ip + ":1234"
+		recorder := httptest.NewRecorder()
+		status, _ := fn(recorder, r, &data{})
+		recorder.Code = status
+		return recorder
+	}
+
+	// a success resets the failures of the username
+	login("admin", "wrong", "10.0.0.1")
+	login("admin", password, "10.0.0.1")
+	if res := login("admin", "wrong", "10.0.0.1"); res.Code != http.StatusForbidden {
+		t.Fatalf("expected the failure to be reset, got %d", res.Code)
+	}
+
+	res := login("Admin", "wrong", "10.0.0.2")
+	if res = login("admin", password, "10.0.0.3"); res.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the username to be locked out, got %d", res.Code)
+	}
+	if retry := res.Header().Get("Retry-After"); retry != "60" {
+		t.Errorf("expected to retry after 60s, got %q", retry)
+	}
+	if res := login("other", password, "10.0.0.1"); res.Code != http.StatusOK {
+		t.Errorf("expected the other usernames not to be locked out, got %d", res.Code)
+	}
+
+	// the next lockout of the day is twice as long
+	now = now.Add(time.Minute)
+	login("admin", "wrong", "10.0.0.4")
+	res = login("admin", "wrong", "10.0.0.4")
+	if res = login("admin", password, "10.0.0.4"); res.Header().Get("Retry-After") != "120" {
+		t.Errorf("expected the lockout to back off, got %d after %q", res.Code, res.Header().Get("Retry-After"))
+	}
+
+	// the IPs are locked out whatever the usernames
+	for i := 0; i < 5; i++ {
+		login("user"+string(rune('a'+i)), "wrong", "10.0.0.5")
+	}
+	if res := login("other", password, "10.0.0.5"); res.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the IP to be locked out, got %d", res.Code)
+	}
+
+	stats := l.stats()
+	if stats.Backend != "memory" || stats.Failures != 10 || stats.Lockouts != 3 || stats.Rejected != 3 {
+		t.Errorf("unexpected counters %+v", stats)
+	}
+}
+
+func TestLimitLoginsProxies(t *testing.T) {
+	t.Parallel()
+
+	filters, err := newIPFilters(&settings.Server{TrustedProxies: "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newLoginLimiter(&settings.Server{LoginMaxAttemptsPerIP: 1, LoginLockout: "1m"}, nil, filters)
+	fn := limitLogins(l, func(_ http.ResponseWriter, _ *http.Request, _ *data) (int, error) {
+		return http.StatusForbidden, nil
+	})
+	login := func(addr, forwarded string) int {
+		r := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{}`))
+		r.RemoteAddr = addr + ":1234"
+		r.Header.Set("X-Forwarded-For", forwarded)
+		status, _ := fn(httptest.NewRecorder(), r, &data{})
+		return status
+	}
+
+	// the clients behind the proxy are locked out on their own
+	login("10.0.0.1", "192.168.0.1")
+	if status := login("10.0.0.1", "192.168.0.2"); status != http.StatusForbidden {
+		t.Errorf("expected the other clients of the proxy not to be locked out, got %d", status)
+	}
+	if status := login("10.0.0.1", "192.168.0.1"); status != http.StatusTooManyRequests {
+		t.Errorf("expected the client behind the proxy to be locked out, got %d", status)
+	}
+
+	// the other clients can't pick their IP with the header
+	login("10.0.0.2", "192.168.0.3")
+	if status := login("10.0.0.2", "192.168.0.4"); status != http.StatusTooManyRequests {
+		t.Errorf("expected the header of an untrusted client to be ignored, got %d", status)
+	}
+}
+
+func readBody(t *testing.T, r *http.Request) string {
+	t.Helper()
+
+	var b strings.Builder
+	if _, err := io.Copy(&b, r.Body); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/filebrowser/filebrowser/v2/auth"
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+)
+
+// withOIDC only lets the request through when the users log in with an
+// OpenID Connect provider.
+func withOIDC(fn func(w http.ResponseWriter, r *http.Request, d *data, a *auth.OIDCAuth) (int, error)) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		if d.settings.AuthMethod != auth.MethodOIDC {
+			return http.StatusMethodNotAllowed, nil
+		}
+
+		auther, err := d.store.Auth.Get(d.settings.AuthMethod)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		a, ok := auther.(*auth.OIDCAuth)
+		if !ok {
+			return http.StatusInternalServerError, fbErrors.ErrInvalidAuthMethod
+		}
+
+		return fn(w, r, d, a)
+	}
+}
+
+func oidcStateCookie(r *http.Request, d *data, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     auth.OIDCStateCookie,
+		Value:    value,
+		Path:     d.server.BaseURL + "/api/login/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// oidcLoginHandler sends the user to the provider.
+var oidcLoginHandler = withOIDC(func(w http.ResponseWriter, r *http.Request, d *data, a *auth.OIDCAuth) (int, error) {
+	url, state, err := a.AuthCodeURL(r, d.settings)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	http.SetCookie(w, oidcStateCookie(r, d, state, int(auth.OIDCTimeout/time.Second)))
+	http.Redirect(w, r, url, http.StatusFound)
+	return 0, nil
+})
+
+// oidcCallbackHandler logs in the user coming back from the provider. The
+// token is given to the frontend in the auth cookie, which it reads at the
+// login page.
+func oidcCallbackHandler(tokenExpireTime time.Duration) handleFunc {
+	return withOIDC(func(w http.ResponseWriter, r *http.Request, d *data, a *auth.OIDCAuth) (int, error) {
+		user, err := a.Auth(r, d.store.Users, d.settings, d.server)
+		http.SetCookie(w, oidcStateCookie(r, d, "", -1))
+		switch {
+		case errors.Is(err, os.ErrPermission):
+			return http.StatusForbidden, err
+		case err != nil:
+			return http.StatusInternalServerError, err
+		}
+
+		signed, err := signToken(r, d, user, tokenExpireTime)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     "auth",
+			Value:    signed,
+			Path:     d.server.BaseURL + "/",
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, d.server.BaseURL+"/login", http.StatusFound)
+		return 0, nil
+	})
+}
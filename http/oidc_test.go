@@ -0,0 +1,207 @@
+package http
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/go-jose/go-jose/v4"
+
+	"github.com/filebrowser/filebrowser/v2/auth"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/storage/bolt"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// newOIDCProvider serves the discovery, keys and token endpoints of a
+// provider, the ID tokens getting the claims of the given function.
+func newOIDCProvider(t *testing.T, claims func(nonce string) map[string]interface{}) *httptest.Server {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, (&jose.SignerOptions{}).WithHeader("kid", "key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nonce string
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"jwks_uri":               srv.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "key", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/authorize", func(_ http.ResponseWriter, r *http.Request) {
+		nonce = r.URL.Query().Get("nonce")
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, _ *http.Request) {
+		c := claims(nonce)
+		c["iss"], c["aud"] = srv.URL, "client"
+		if _, ok := c["sub"]; !ok {
+			c["sub"] = "subject"
+		}
+		c["iat"], c["exp"] = time.Now().Unix(), time.Now().Add(time.Minute).Unix()
+
+		payload, _ := json.Marshal(c)
+		signed, err := signer.Sign(payload)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		idToken, _ := signed.CompactSerialize()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "token",
+			"token_type":   "Bearer",
+			"id_token":     idToken,
+		})
+	})
+
+	return srv
+}
+
+func TestOIDCLogin(t *testing.T) {
+	t.Parallel()
+
+	claims := map[string]interface{}{"preferred_username": "sso", "groups": []string{"admins"}}
+	provider := newOIDCProvider(t, func(nonce string) map[string]interface{} {
+		c := map[string]interface{}{"nonce": nonce}
+		for k, v := range claims {
+			c[k] = v
+		}
+		return c
+	})
+
+	db, err := storm.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	st, err := bolt.NewStorage(db)
+	if err != nil {
+		t.Fatalf("failed to get storage: %v", err)
+	}
+	if err := st.Settings.Save(&settings.Settings{Key: []byte("key"), AuthMethod: auth.MethodOIDC}); err != nil {
+		t.Fatalf("failed to save settings: %v", err)
+	}
+	err = st.Auth.Save(&auth.OIDCAuth{
+		Issuer:        provider.URL,
+		ClientID:      "client",
+		RedirectURL:   "http://localhost/api/login/oidc/callback",
+		AutoProvision: true,
+		Claims:        auth.OIDCClaims{Groups: "groups", AdminGroups: []string{"admins"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to save auther: %v", err)
+	}
+	server := &settings.Server{Root: t.TempDir()}
+
+	recorder := httptest.NewRecorder()
+	handle(oidcLoginHandler, "", st, server, nil).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	location, err := url.Parse(recorder.Header().Get("Location"))
+	if err != nil || recorder.Code != http.StatusFound {
+		t.Fatalf("expected a redirect to the provider, got %d and %v", recorder.Code, err)
+	}
+	cookies := recorder.Result().Cookies()
+
+	// the provider keeps the nonce of the login
+	res, err := http.Get(location.String()) //nolint:noctx
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	callback := func(state string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/?code=code&state="+url.QueryEscape(state), nil)
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		handle(oidcCallbackHandler(time.Hour), "", st, server, nil).ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	if recorder := callback("forged"); recorder.Code != http.StatusForbidden {
+		t.Errorf("expected a forged state to be rejected, got %d", recorder.Code)
+	}
+
+	recorder = callback(location.Query().Get("state"))
+	if recorder.Code != http.StatusFound || recorder.Header().Get("Location") != "/login" {
+		t.Fatalf("expected a redirect to the login page, got %d", recorder.Code)
+	}
+
+	var token string
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == "auth" {
+			token = cookie.Value
+		}
+	}
+	if token == "" {
+		t.Error("expected the token in the auth cookie")
+	}
+
+	user, err := st.Users.Get(server.Root, "sso")
+	if err != nil {
+		t.Fatalf("expected the user to be provisioned, got %v", err)
+	}
+	if !user.Perm.Admin || !user.LockPassword || user.OIDCSubject != auth.OIDCSubject(provider.URL, "subject") {
+		t.Errorf("expected a locked admin user of the identity, got %+v", user)
+	}
+
+	// the users are the ones of the subjects, not of the usernames
+	if err := st.Users.Save(&users.User{Username: "admin", Password: "pw"}); err != nil {
+		t.Fatal(err)
+	}
+	login := func() int {
+		t.Helper()
+
+		recorder := httptest.NewRecorder()
+		handle(oidcLoginHandler, "", st, server, nil).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		location, err := url.Parse(recorder.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cookies = recorder.Result().Cookies()
+		res, err := http.Get(location.String()) //nolint:noctx
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return callback(location.Query().Get("state")).Code
+	}
+
+	claims["preferred_username"] = "admin"
+	if code := login(); code != http.StatusFound {
+		t.Errorf("expected the renamed user of the provider to log in, got %d", code)
+	}
+	if admin, err := st.Users.Get(server.Root, "admin"); err != nil || admin.OIDCSubject != "" {
+		t.Errorf("expected the local user not to be linked, got %v", err)
+	}
+	claims["sub"] = "other"
+	if code := login(); code != http.StatusForbidden {
+		t.Errorf("expected the local user not to be taken by another identity, got %d", code)
+	}
+}
@@ -0,0 +1,142 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/filebrowser/filebrowser/v2/auth"
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+)
+
+type passkeyInfo struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+type passkeyBeginResponse struct {
+	Options interface{} `json:"options"`
+	Session string      `json:"session"`
+}
+
+type passkeyBody struct {
+	Username   string          `json:"username"`
+	Name       string          `json:"name"`
+	Session    string          `json:"session"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+// withWebAuthn only lets the request through when the users log in with
+// their passkeys.
+func withWebAuthn(fn func(w http.ResponseWriter, r *http.Request, d *data, a *auth.WebAuthnAuth) (int, error)) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		if d.settings.AuthMethod != auth.MethodWebAuthn {
+			return http.StatusMethodNotAllowed, nil
+		}
+
+		auther, err := d.store.Auth.Get(d.settings.AuthMethod)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		a, ok := auther.(*auth.WebAuthnAuth)
+		if !ok {
+			return http.StatusInternalServerError, fbErrors.ErrInvalidAuthMethod
+		}
+
+		return fn(w, r, d, a)
+	}
+}
+
+var passkeyLoginHandler = withWebAuthn(func(w http.ResponseWriter, r *http.Request, d *data, a *auth.WebAuthnAuth) (int, error) {
+	if r.Body == nil {
+		return http.StatusBadRequest, nil
+	}
+
+	var body passkeyBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	u, err := d.store.Users.Get(d.server.Root, body.Username)
+	if err != nil {
+		return http.StatusForbidden, nil
+	}
+
+	options, session, err := a.BeginLogin(u, d.settings)
+	switch {
+	case errors.Is(err, os.ErrPermission):
+		return http.StatusForbidden, nil
+	case err != nil:
+		return http.StatusInternalServerError, err
+	}
+
+	return renderJSON(w, r, passkeyBeginResponse{Options: options, Session: session})
+})
+
+var passkeysGetHandler = withSessionUser(withWebAuthn(func(w http.ResponseWriter, r *http.Request, d *data, _ *auth.WebAuthnAuth) (int, error) {
+	passkeys := make([]passkeyInfo, 0, len(d.user.Passkeys))
+	for _, passkey := range d.user.Passkeys {
+		passkeys = append(passkeys, passkeyInfo{ID: passkey.ID(), Name: passkey.Name, Created: passkey.Created})
+	}
+
+	return renderJSON(w, r, passkeys)
+}))
+
+var passkeyBeginHandler = withSessionUser(withWebAuthn(func(w http.ResponseWriter, r *http.Request, d *data, a *auth.WebAuthnAuth) (int, error) {
+	options, session, err := a.BeginRegistration(d.user, d.settings)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return renderJSON(w, r, passkeyBeginResponse{Options: options, Session: session})
+}))
+
+var passkeyPostHandler = withSessionUser(withWebAuthn(func(w http.ResponseWriter, r *http.Request, d *data, a *auth.WebAuthnAuth) (int, error) {
+	if r.Body == nil {
+		return http.StatusBadRequest, nil
+	}
+
+	var body passkeyBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	passkey, err := a.FinishRegistration(d.user, d.settings, body.Name, body.Session, body.Credential)
+	switch {
+	case errors.Is(err, os.ErrPermission):
+		return http.StatusBadRequest, nil
+	case err != nil:
+		return http.StatusInternalServerError, err
+	}
+
+	d.user.Passkeys = append(d.user.Passkeys, *passkey)
+	if err := d.store.Users.Update(d.user, "Passkeys"); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return renderJSON(w, r, passkeyInfo{ID: passkey.ID(), Name: passkey.Name, Created: passkey.Created})
+}))
+
+var passkeyDeleteHandler = withSessionUser(withWebAuthn(func(_ http.ResponseWriter, r *http.Request, d *data, _ *auth.WebAuthnAuth) (int, error) {
+	id := mux.Vars(r)["id"]
+
+	for i, passkey := range d.user.Passkeys {
+		if passkey.ID() != id {
+			continue
+		}
+
+		d.user.Passkeys = append(d.user.Passkeys[:i], d.user.Passkeys[i+1:]...)
+		if err := d.store.Users.Update(d.user, "Passkeys"); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return http.StatusOK, nil
+	}
+
+	return http.StatusNotFound, nil
+}))
@@ -0,0 +1,69 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/filebrowser/filebrowser/v2/plugins"
+)
+
+// pluginRoute is a route of a plugin, as listed to the clients.
+type pluginRoute struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Admin  bool   `json:"admin"`
+}
+
+type pluginInfo struct {
+	Name   string        `json:"name"`
+	Routes []pluginRoute `json:"routes"`
+}
+
+// pluginHandler serves a route of a plugin to the authenticated users, or
+// to the admins, with the context of the request.
+func pluginHandler(route plugins.Route) handleFunc {
+	fn := func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		return route.Handler(w, r, &plugins.Context{
+			User:     d.user,
+			Store:    d.store,
+			Settings: d.settings,
+			Server:   d.server,
+			Runner:   d.Runner,
+		})
+	}
+	if route.Admin {
+		return withAdmin(fn)
+	}
+	return withUser(fn)
+}
+
+// registerPlugins serves the routes of the plugins under /plugins/<name>
+// of the router.
+func registerPlugins(router *mux.Router, plugs []plugins.Plugin, monkey func(handleFunc, string) http.Handler) {
+	for _, p := range plugs {
+		sub := router.PathPrefix("/plugins/" + p.Name()).Subrouter()
+		for _, route := range p.Routes() {
+			sub.Handle(route.Path, monkey(pluginHandler(route), "")).Methods(route.Method)
+		}
+	}
+}
+
+// pluginsGetHandler lists the plugins and their routes, the ones of the
+// admins only to them.
+func pluginsGetHandler(plugs []plugins.Plugin) handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		infos := make([]pluginInfo, 0, len(plugs))
+		for _, p := range plugs {
+			info := pluginInfo{Name: p.Name(), Routes: []pluginRoute{}}
+			for _, route := range p.Routes() {
+				if route.Admin && !d.user.Perm.Admin {
+					continue
+				}
+				info.Routes = append(info.Routes, pluginRoute{Method: route.Method, Path: route.Path, Admin: route.Admin})
+			}
+			infos = append(infos, info)
+		}
+		return renderJSON(w, r, infos)
+	})
+}
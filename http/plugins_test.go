@@ -0,0 +1,64 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/filebrowser/filebrowser/v2/plugins"
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+type testPlugin struct{}
+
+func (testPlugin) Name() string { return "test" }
+
+func (testPlugin) Routes() []plugins.Route {
+	hello := func(w http.ResponseWriter, r *http.Request, c *plugins.Context) (int, error) {
+		_, err := io.WriteString(w, c.User.Username+" "+mux.Vars(r)["name"])
+		return 0, err
+	}
+	return []plugins.Route{
+		{Method: http.MethodGet, Path: "/hello/{name}", Handler: hello},
+		{Method: http.MethodGet, Path: "/admin", Admin: true, Handler: hello},
+	}
+}
+
+func TestPluginRoutes(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	server := &settings.Server{Root: t.TempDir()}
+	monkey := func(fn handleFunc, prefix string) http.Handler {
+		return handle(fn, prefix, st, server, nil)
+	}
+	router := mux.NewRouter()
+	registerPlugins(router, []plugins.Plugin{testPlugin{}}, monkey)
+
+	token := issueToken(t, st)
+	serve := func(target, token string) (int, string) {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set("X-Auth", token)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, r)
+		return recorder.Code, recorder.Body.String()
+	}
+
+	if code, body := serve("/plugins/test/hello/world", token); code != http.StatusOK || body != "username world" {
+		t.Errorf("expected the route to get the user and its variables, got %d and %q", code, body)
+	}
+	if code, _ := serve("/plugins/test/hello/world", ""); code == http.StatusOK {
+		t.Error("expected the route to need a user")
+	}
+	if code, _ := serve("/plugins/test/admin", token); code != http.StatusForbidden {
+		t.Errorf("expected the admin route to be forbidden, got %d", code)
+	}
+	if code, _ := serve("/plugins/other/hello/world", token); code != http.StatusNotFound {
+		t.Errorf("expected the routes to be under the name of their plugin, got %d", code)
+	}
+}
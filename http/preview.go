@@ -4,10 +4,11 @@ package http
 import (
 	"bytes"
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 
@@ -34,7 +35,11 @@ type FileCache interface {
 	Delete(ctx context.Context, key string) error
 }
 
-func previewHandler(imgSvc ImgService, fileCache FileCache, enableThumbnails, resizePreview bool) handleFunc {
+// previewMaxAge is how long the browsers keep the previews asked for the
+// current modification time of their file.
+const previewMaxAge = 365 * 24 * time.Hour
+
+func previewHandler(thumbs *thumbnailer, enableThumbnails, resizePreview bool) handleFunc {
 	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 		if !d.user.Perm.Download {
 			return http.StatusAccepted, nil
@@ -52,6 +57,7 @@ func previewHandler(imgSvc ImgService, fileCache FileCache, enableThumbnails, re
 			Modify:     d.user.Perm.Modify,
 			Expand:     true,
 			ReadHeader: d.server.TypeDetectionByHeader,
+			MimeTypes:  d.settings.MimeTypes,
 			Checker:    d,
 		})
 		if err != nil {
@@ -61,97 +67,53 @@ func previewHandler(imgSvc ImgService, fileCache FileCache, enableThumbnails, re
 		setContentDisposition(w, r, file)
 
 		switch file.Type {
-		case "image":
-			return handleImagePreview(w, r, imgSvc, fileCache, file, previewSize, enableThumbnails, resizePreview)
+		case "image", "video":
+			return handlePreview(w, r, thumbs, file, previewSize, enableThumbnails, resizePreview)
 		default:
 			return http.StatusNotImplemented, fmt.Errorf("can't create preview for %s type", file.Type)
 		}
 	})
 }
 
-func handleImagePreview(
+func handlePreview(
 	w http.ResponseWriter,
 	r *http.Request,
-	imgSvc ImgService,
-	fileCache FileCache,
+	thumbs *thumbnailer,
 	file *files.FileInfo,
 	previewSize PreviewSize,
 	enableThumbnails, resizePreview bool,
 ) (int, error) {
-	if (previewSize == PreviewSizeBig && !resizePreview) ||
-		(previewSize == PreviewSizeThumb && !enableThumbnails) {
-		return rawFileHandler(w, r, file)
-	}
+	disabled := (previewSize == PreviewSizeBig && !resizePreview) ||
+		(previewSize == PreviewSizeThumb && !enableThumbnails)
 
-	format, err := imgSvc.FormatFromExtension(file.Extension)
-	// Unsupported extensions directly return the raw data
-	if errors.Is(err, img.ErrUnsupportedFormat) || format == img.FormatGif {
+	if !thumbs.supports(file) || disabled {
+		if file.Type == "video" {
+			return http.StatusNotImplemented, fmt.Errorf("can't create preview for %s", file.Path)
+		}
+		// Unsupported extensions directly return the raw data
 		return rawFileHandler(w, r, file)
 	}
-	if err != nil {
-		return errToStatus(err), err
-	}
 
-	cacheKey := previewCacheKey(file, previewSize)
-	resizedImage, ok, err := fileCache.Load(r.Context(), cacheKey)
+	preview, err := thumbs.get(r.Context(), file, previewSize)
 	if err != nil {
 		return errToStatus(err), err
 	}
-	if !ok {
-		resizedImage, err = createPreview(imgSvc, fileCache, file, previewSize)
-		if err != nil {
-			return errToStatus(err), err
-		}
-	}
 
-	w.Header().Set("Cache-Control", "private")
-	http.ServeContent(w, r, file.Name, file.ModTime, bytes.NewReader(resizedImage))
-
-	return 0, nil
-}
-
-func createPreview(imgSvc ImgService, fileCache FileCache,
-	file *files.FileInfo, previewSize PreviewSize) ([]byte, error) {
-	fd, err := file.Fs.Open(file.Path)
-	if err != nil {
-		return nil, err
-	}
-	defer fd.Close()
-
-	var (
-		width   int
-		height  int
-		options []img.Option
-	)
-
-	switch {
-	case previewSize == PreviewSizeBig:
-		width = 1080
-		height = 1080
-		options = append(options, img.WithMode(img.ResizeModeFit), img.WithQuality(img.QualityMedium))
-	case previewSize == PreviewSizeThumb:
-		width = 256
-		height = 256
-		options = append(options, img.WithMode(img.ResizeModeFill), img.WithQuality(img.QualityLow), img.WithFormat(img.FormatJpeg))
-	default:
-		return nil, img.ErrUnsupportedFormat
+	// the previews are asked with the modification time of their file, the
+	// ones of an older version are checked again
+	if r.URL.Query().Get("key") == strconv.FormatInt(file.ModTime.UnixMilli(), 10) {
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d, immutable", int(previewMaxAge.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
 	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, file.ModTime.UnixNano(), previewSize))
+	http.ServeContent(w, r, file.Name, file.ModTime, bytes.NewReader(preview))
 
-	buf := &bytes.Buffer{}
-	if err := imgSvc.Resize(context.Background(), fd, width, height, buf, options...); err != nil {
-		return nil, err
-	}
-
-	go func() {
-		cacheKey := previewCacheKey(file, previewSize)
-		if err := fileCache.Store(context.Background(), cacheKey, buf.Bytes()); err != nil {
-			fmt.Printf("failed to cache resized image: %v", err)
-		}
-	}()
-
-	return buf.Bytes(), nil
+	return 0, nil
 }
 
+// previewCacheKey is the key of a preview in the file cache, which keeps the
+// modification time of the file with it.
 func previewCacheKey(f *files.FileInfo, previewSize PreviewSize) string {
-	return fmt.Sprintf("%x%x%x", f.RealPath(), f.ModTime.Unix(), previewSize)
+	return fmt.Sprintf("%x%x", f.RealPath(), previewSize)
 }
@@ -0,0 +1,162 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// uploadStatus is the progress of an upload in flight, identified like the
+// tus uploads by its user and its path.
+type uploadStatus struct {
+	ID       string `json:"id"`
+	UserID   uint   `json:"userID"`
+	Username string `json:"username"`
+	Path     string `json:"path"`
+	// Length is the size of the file, -1 until it's known.
+	Length   int64     `json:"length"`
+	Received int64     `json:"received"`
+	Started  time.Time `json:"started"`
+	Updated  time.Time `json:"updated"`
+	// Rate is the bytes received per second since the upload is tracked,
+	// and ETA the seconds left at this rate, -1 if it can't be told.
+	Rate float64 `json:"rate"`
+	ETA  int64   `json:"eta"`
+
+	// resumed is what was received before the upload was tracked, by the
+	// previous instance for the tus uploads.
+	resumed int64
+}
+
+// progressTracker keeps the progress of the uploads in flight, from their
+// first byte until they complete or are aborted.
+type progressTracker struct {
+	mu      sync.Mutex
+	uploads map[string]*uploadStatus
+}
+
+var uploadProgress = &progressTracker{uploads: map[string]*uploadStatus{}}
+
+// track starts tracking an upload at offset, or returns it with its length
+// and offset updated if it already is.
+func (t *progressTracker) track(user *users.User, p string, length, offset int64) *uploadStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := tusUploadID(user.ID, p)
+	status, ok := t.uploads[id]
+	if !ok {
+		now := time.Now()
+		status = &uploadStatus{
+			ID:       id,
+			UserID:   user.ID,
+			Username: user.Username,
+			Path:     p,
+			Started:  now,
+			Updated:  now,
+			resumed:  offset,
+		}
+		t.uploads[id] = status
+	}
+	status.Length = length
+	status.Received = offset
+	return status
+}
+
+// reader counts the bytes of an upload read from r.
+func (t *progressTracker) reader(status *uploadStatus, r io.Reader) io.Reader {
+	return &progressReader{tracker: t, status: status, r: r}
+}
+
+// done stops tracking an upload.
+func (t *progressTracker) done(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.uploads, id)
+}
+
+// list returns the uploads of a user, or of everyone if userID is zero,
+// the last started first. The ones that didn't receive anything for
+// tusUploadExpiration are forgotten.
+func (t *progressTracker) list(userID uint, now time.Time) []uploadStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	list := []uploadStatus{}
+	for id, status := range t.uploads {
+		if now.Sub(status.Updated) > tusUploadExpiration {
+			delete(t.uploads, id)
+			continue
+		}
+		if userID == 0 || status.UserID == userID {
+			list = append(list, status.at(now))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.After(list[j].Started) })
+	return list
+}
+
+// at returns a copy of the status with its rate and ETA at a time.
+func (s uploadStatus) at(now time.Time) uploadStatus {
+	s.ETA = -1
+	elapsed := now.Sub(s.Started).Seconds()
+	if elapsed <= 0 {
+		return s
+	}
+
+	s.Rate = float64(s.Received-s.resumed) / elapsed
+	if s.Length >= 0 && s.Rate > 0 {
+		s.ETA = int64(float64(s.Length-s.Received) / s.Rate)
+	}
+	return s
+}
+
+type progressReader struct {
+	tracker *progressTracker
+	status  *uploadStatus
+	r       io.Reader
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.tracker.mu.Lock()
+		p.status.Received += int64(n)
+		p.status.Updated = time.Now()
+		p.tracker.mu.Unlock()
+	}
+	return n, err
+}
+
+// uploadsGetHandler lists the uploads in flight of the user, or of all the
+// users for the admins asking for all of them.
+var uploadsGetHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	userID := d.user.ID
+	if d.user.Perm.Admin && r.URL.Query().Get("all") == "true" {
+		userID = 0
+	}
+	return renderJSON(w, r, uploadProgress.list(userID, time.Now()))
+})
+
+// uploadGetHandler returns the progress of an upload in flight. The uploads
+// of the other users are only found by the admins.
+var uploadGetHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	userID := d.user.ID
+	if d.user.Perm.Admin {
+		userID = 0
+	}
+
+	id := mux.Vars(r)["id"]
+	for _, status := range uploadProgress.list(userID, time.Now()) {
+		if status.ID == id {
+			return renderJSON(w, r, status)
+		}
+	}
+	return http.StatusNotFound, nil
+})
@@ -0,0 +1,46 @@
+package http
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestProgressTracker(t *testing.T) {
+	t.Parallel()
+
+	tracker := &progressTracker{uploads: map[string]*uploadStatus{}}
+	alice, bob := &users.User{ID: 1, Username: "alice"}, &users.User{ID: 2, Username: "bob"}
+
+	// a resumed upload only counts the bytes received since
+	status := tracker.track(alice, "/big.iso", 1000, 400)
+	if _, err := io.Copy(io.Discard, tracker.reader(status, strings.NewReader(strings.Repeat("x", 100)))); err != nil {
+		t.Fatal(err)
+	}
+	tracker.track(bob, "/other", -1, 0)
+
+	list := tracker.list(alice.ID, status.Started.Add(10*time.Second))
+	if len(list) != 1 {
+		t.Fatalf("expected only the upload of alice, got %+v", list)
+	}
+	if got := list[0]; got.Received != 500 || got.Rate != 10 || got.ETA != 50 || got.Username != "alice" {
+		t.Errorf("unexpected progress %+v", got)
+	}
+
+	// the length of the others isn't known yet
+	list = tracker.list(0, status.Started.Add(time.Second))
+	if len(list) != 2 || list[0].Path != "/other" || list[0].ETA != -1 {
+		t.Errorf("expected the uploads of everyone, got %+v", list)
+	}
+
+	tracker.done(status.ID)
+	if list := tracker.list(alice.ID, time.Now()); len(list) != 0 {
+		t.Errorf("expected the completed upload to be forgotten, got %+v", list)
+	}
+	if list := tracker.list(0, time.Now().Add(2*tusUploadExpiration)); len(list) != 0 {
+		t.Errorf("expected the idle uploads to be forgotten, got %+v", list)
+	}
+}
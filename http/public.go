@@ -1,12 +1,17 @@
 package http
 
 import (
+	"context"
 	"errors"
+	"log"
+	"math"
 	"net/http"
 	"net/url"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/afero"
 	"golang.org/x/crypto/bcrypt"
@@ -15,6 +20,8 @@ import (
 	"github.com/filebrowser/filebrowser/v2/share"
 )
 
+const healthCheckTimeout = 5 * time.Second
+
 var withHashFile = func(fn handleFunc) handleFunc {
 	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 		id, ifPath := ifPathWithName(r)
@@ -23,17 +30,28 @@ var withHashFile = func(fn handleFunc) handleFunc {
 			return errToStatus(err), err
 		}
 
+		// the wrong passwords are counted too
+		if retryAfter := shareLimits.allow(link, d.settings, time.Now()); retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			return http.StatusTooManyRequests, nil
+		}
+
 		status, err := authenticateShareRequest(r, link)
 		if status != 0 || err != nil {
 			return status, err
 		}
 
+		if link.Exhausted() {
+			return http.StatusGone, nil
+		}
+
 		user, err := d.store.Users.Get(d.server.Root, link.UserID)
 		if err != nil {
 			return errToStatus(err), err
 		}
 
-		d.user = user
+		d.user, d.link = user, link
+		d.restrictReadOnly(d.user)
 
 		file, err := files.NewFileInfo(&files.FileOptions{
 			Fs:         d.user.Fs,
@@ -41,6 +59,7 @@ var withHashFile = func(fn handleFunc) handleFunc {
 			Modify:     d.user.Perm.Modify,
 			Expand:     false,
 			ReadHeader: d.server.TypeDetectionByHeader,
+			MimeTypes:  d.settings.MimeTypes,
 			Checker:    d,
 			Token:      link.Token,
 		})
@@ -98,23 +117,87 @@ var publicShareHandler = withHashFile(func(w http.ResponseWriter, r *http.Reques
 	file := d.raw.(*files.FileInfo)
 
 	if file.IsDir {
+		if err := transformListing(r.Context(), d, file); err != nil {
+			return errToStatus(err), err
+		}
 		file.Listing.Sorting = files.Sorting{By: "name", Asc: false}
 		file.Listing.ApplySort()
-		return renderJSON(w, r, file)
+		return renderTaggedJSON(w, r, file)
 	}
 
-	return renderJSON(w, r, file)
+	return renderTaggedJSON(w, r, file)
 })
 
+// publicDlHandler serves the files of a share. Only the shares with a limit
+// count their downloads, which are taken before sending them, so that the
+// concurrent ones can't go over it, and given back if they fail. The HEAD
+// requests and the byte ranges that don't start the file, such as the ones
+// of the players seeking, don't count.
 var publicDlHandler = withHashFile(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 	file := d.raw.(*files.FileInfo)
+
+	counted := d.link.MaxDownloads > 0 && countsDownload(r, file)
+	if counted {
+		if _, err := d.store.Share.UseDownload(d.link.Hash); err != nil {
+			return errToStatus(err), err
+		}
+	}
+
+	d.user.Fs = shareLimits.throttle(d.link, d.settings, d.user.Fs)
+	file.Fs = d.user.Fs
+
+	rec := &statusRecorder{ResponseWriter: w}
+	var (
+		status int
+		err    error
+	)
 	if !file.IsDir {
-		return rawFileHandler(w, r, file)
+		status, err = rawFileHandler(rec, r, file)
+	} else {
+		status, err = rawDirHandler(rec, r, d, file)
 	}
 
-	return rawDirHandler(w, r, d, file)
+	if counted && (status != 0 || err != nil || rec.status >= http.StatusMultipleChoices) {
+		if returnErr := d.store.Share.ReturnDownload(d.link.Hash); returnErr != nil {
+			log.Printf("Failed to give back the download of the share %s: %v", d.link.Hash, returnErr)
+		}
+	}
+	return status, err
 })
 
+// countsDownload tells if a request downloads a share: the GET requests of
+// the directories, and the ones of the files that may get them whole or
+// from their first byte. The ranges are ignored when the If-Range header
+// doesn't match, or when their unit isn't known.
+func countsDownload(r *http.Request, file *files.FileInfo) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+
+	ranges := r.Header.Get("Range")
+	if file.IsDir || ranges == "" || r.Header.Get("If-Range") != "" {
+		return true
+	}
+	spec, ok := strings.CutPrefix(ranges, "bytes=")
+	if !ok {
+		return true
+	}
+	for _, part := range strings.Split(spec, ",") {
+		start, end, _ := strings.Cut(strings.TrimSpace(part), "-")
+		if start == "" {
+			// the suffix ranges get the last bytes of the file
+			if n, err := strconv.ParseInt(end, 10, 64); err == nil && n >= file.Size {
+				return true
+			}
+			continue
+		}
+		if n, err := strconv.ParseInt(start, 10, 64); err == nil && n == 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func authenticateShareRequest(r *http.Request, l *share.Link) (int, error) {
 	if l.PasswordHash == "" {
 		return 0, nil
@@ -142,7 +225,21 @@ func authenticateShareRequest(r *http.Request, l *share.Link) (int, error) {
 	return 0, nil
 }
 
-func healthHandler(w http.ResponseWriter, _ *http.Request) {
+// healthHandler reports if the instance is ready, including its hooks. The
+// reason it isn't is only logged, as the endpoint is public.
+func healthHandler(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	if err := d.Runner.HealthCheck(ctx); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"status":"ERROR"}`))
+		return 0, err
+	}
+
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte(`{"status":"OK"}`))
+	return 0, nil
 }
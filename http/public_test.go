@@ -10,6 +10,7 @@ import (
 	"github.com/asdine/storm/v3"
 	"github.com/spf13/afero"
 
+	"github.com/filebrowser/filebrowser/v2/runner"
 	"github.com/filebrowser/filebrowser/v2/settings"
 	"github.com/filebrowser/filebrowser/v2/share"
 	"github.com/filebrowser/filebrowser/v2/storage/bolt"
@@ -55,6 +56,11 @@ func TestPublicShareHandlerAuthentication(t *testing.T) {
 			req:                newHTTPRequest(t, func(r *http.Request) { r.Header.Set("X-SHARE-PASSWORD", "wrong-password") }),
 			expectedStatusCode: 401,
 		},
+		"Share without downloads left, 410": {
+			share:              &share.Link{Hash: "h", UserID: 1, MaxDownloads: 2, Downloads: 2},
+			req:                newHTTPRequest(t),
+			expectedStatusCode: 410,
+		},
 	}
 
 	for name, tc := range testCases {
@@ -95,7 +101,7 @@ func TestPublicShareHandlerAuthentication(t *testing.T) {
 				}
 
 				recorder := httptest.NewRecorder()
-				handler := handle(handler, "", storage, &settings.Server{})
+				handler := handle(handler, "", storage, &settings.Server{}, nil)
 
 				handler.ServeHTTP(recorder, tc.req)
 				result := recorder.Result()
@@ -108,6 +114,129 @@ func TestPublicShareHandlerAuthentication(t *testing.T) {
 	}
 }
 
+func TestPublicDlHandlerMaxDownloads(t *testing.T) {
+	t.Parallel()
+
+	db, err := storm.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	storage, err := bolt.NewStorage(db)
+	if err != nil {
+		t.Fatalf("failed to get storage: %v", err)
+	}
+	if err := storage.Share.Save(&share.Link{Hash: "h", UserID: 1, MaxDownloads: 2}); err != nil {
+		t.Fatalf("failed to save share: %v", err)
+	}
+	if err := storage.Users.Save(&users.User{Username: "username", Password: "pw"}); err != nil {
+		t.Fatalf("failed to save user: %v", err)
+	}
+	if err := storage.Settings.Save(&settings.Settings{Key: []byte("key")}); err != nil {
+		t.Fatalf("failed to save settings: %v", err)
+	}
+	storage.Users = &customFSUser{Store: storage.Users, fs: &afero.MemMapFs{}}
+
+	handler := handle(publicDlHandler, "", storage, &settings.Server{}, nil)
+
+	// the HEAD requests don't count
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newHTTPRequest(t, func(r *http.Request) { r.Method = http.MethodHead }))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected the HEAD request to be served, got %d", recorder.Code)
+	}
+
+	for i, expected := range []int{200, 200, 410, 410} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, newHTTPRequest(t))
+		if recorder.Code != expected {
+			t.Errorf("download %d: expected status code %d, got %d", i+1, expected, recorder.Code)
+		}
+	}
+
+	link, err := storage.Share.GetByHash("h")
+	if err != nil {
+		t.Fatalf("failed to get share: %v", err)
+	}
+	if link.Downloads != 2 {
+		t.Errorf("expected 2 downloads, got %d", link.Downloads)
+	}
+}
+
+func TestPublicDlHandlerRanges(t *testing.T) {
+	t.Parallel()
+
+	db, err := storm.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	storage, err := bolt.NewStorage(db)
+	if err != nil {
+		t.Fatalf("failed to get storage: %v", err)
+	}
+	if err := storage.Share.Save(&share.Link{Hash: "h", UserID: 1, Path: "/file.txt", MaxDownloads: 2}); err != nil {
+		t.Fatalf("failed to save share: %v", err)
+	}
+	if err := storage.Users.Save(&users.User{Username: "username", Password: "pw"}); err != nil {
+		t.Fatalf("failed to save user: %v", err)
+	}
+	if err := storage.Settings.Save(&settings.Settings{Key: []byte("key")}); err != nil {
+		t.Fatalf("failed to save settings: %v", err)
+	}
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "/file.txt", []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	storage.Users = &customFSUser{Store: storage.Users, fs: fs}
+
+	handler := handle(publicDlHandler, "", storage, &settings.Server{}, nil)
+	serve := func(header map[string]string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, newHTTPRequest(t, func(r *http.Request) {
+			for k, v := range header {
+				r.Header.Set(k, v)
+			}
+		}))
+		return recorder
+	}
+	downloads := func() int {
+		link, err := storage.Share.GetByHash("h")
+		if err != nil {
+			t.Fatalf("failed to get share: %v", err)
+		}
+		return link.Downloads
+	}
+
+	// the players seeking don't count, the ranges from the start do
+	if res := serve(map[string]string{"Range": "bytes=5-"}); res.Code != http.StatusPartialContent || downloads() != 0 {
+		t.Errorf("expected the seek not to count, got %d and %d downloads", res.Code, downloads())
+	}
+	res := serve(map[string]string{"Range": "bytes=0-"})
+	if res.Code != http.StatusPartialContent || downloads() != 1 {
+		t.Errorf("expected the range from the start to count, got %d and %d downloads", res.Code, downloads())
+	}
+	if res := serve(map[string]string{"Range": "bytes=-10"}); res.Code != http.StatusPartialContent || downloads() != 2 {
+		t.Errorf("expected the suffix of the whole file to count, got %d and %d downloads", res.Code, downloads())
+	}
+	if res := serve(map[string]string{"Range": "bytes=0-"}); res.Code != http.StatusGone {
+		t.Errorf("expected no download to be left, got %d", res.Code)
+	}
+
+	// the failed downloads are given back
+	if err := storage.Share.ReturnDownload("h"); err != nil {
+		t.Fatal(err)
+	}
+	if res := serve(map[string]string{"If-None-Match": res.Header().Get("ETag")}); res.Code != http.StatusNotModified || downloads() != 1 {
+		t.Errorf("expected the download not to count, got %d and %d downloads", res.Code, downloads())
+	}
+	if res := serve(nil); res.Code != http.StatusOK || res.Body.String() != "0123456789" || downloads() != 2 {
+		t.Errorf("expected the last download, got %d and %d downloads", res.Code, downloads())
+	}
+}
+
 func newHTTPRequest(t *testing.T, requestModifiers ...func(*http.Request)) *http.Request {
 	t.Helper()
 	r, err := http.NewRequest(http.MethodGet, "h", http.NoBody)
@@ -134,3 +263,16 @@ func (cu *customFSUser) Get(baseScope string, id interface{}) (*users.User, erro
 
 	return user, nil
 }
+
+func TestHealthHandler(t *testing.T) {
+	t.Parallel()
+
+	d := &data{Runner: &runner.Runner{Enabled: true, Settings: &settings.Settings{ScriptsDir: "/missing/scripts"}}}
+	recorder := httptest.NewRecorder()
+	if _, err := healthHandler(recorder, httptest.NewRequest(http.MethodGet, "/health", nil), d); err == nil {
+		t.Fatal("expected the error to be returned to be logged")
+	}
+	if recorder.Code != http.StatusServiceUnavailable || recorder.Body.String() != `{"status":"ERROR"}` {
+		t.Errorf("expected a generic status, got %d and %s", recorder.Code, recorder.Body.String())
+	}
+}
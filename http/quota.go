@@ -0,0 +1,227 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// quotaUsageTTL is how long the usage of a user is trusted before it's
+// computed again, so that the changes made out of the handlers are seen.
+const quotaUsageTTL = 5 * time.Minute
+
+// errQuotaExceeded is returned when an operation doesn't fit in the quota
+// of the user.
+var errQuotaExceeded = errors.New("the quota of the user is exceeded")
+
+// quotaError tells how much space an operation needed. It is
+// errQuotaExceeded.
+type quotaError struct {
+	Quota  int64
+	Used   int64
+	Needed int64
+}
+
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("quota exceeded: %d bytes needed but %d of the %d bytes of the quota are used",
+		e.Needed, e.Used, e.Quota)
+}
+
+func (e *quotaError) Is(target error) bool {
+	return target == errQuotaExceeded
+}
+
+type usageEntry struct {
+	used     int64
+	computed time.Time
+}
+
+// usageCache keeps the used bytes of the users, computed the first time
+// they're needed and adjusted by the handlers that write files.
+type usageCache struct {
+	mu      sync.Mutex
+	entries map[uint]usageEntry
+}
+
+var quotaUsage = &usageCache{entries: map[uint]usageEntry{}}
+
+// get returns the bytes used by a user, walking its scope if they aren't
+// known.
+func (c *usageCache) get(userID uint, fs afero.Fs) (int64, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[userID]
+	c.mu.Unlock()
+	if ok && time.Since(entry.computed) < quotaUsageTTL {
+		return entry.used, nil
+	}
+
+	used, err := scopeUsage(fs, "/")
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	c.entries[userID] = usageEntry{used: used, computed: time.Now()}
+	c.mu.Unlock()
+	return used, nil
+}
+
+// add adjusts the bytes used by a user, if they're known.
+func (c *usageCache) add(userID uint, delta int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[userID]; ok {
+		entry.used += delta
+		c.entries[userID] = entry
+	}
+}
+
+// forget makes the bytes used by a user be computed again.
+func (c *usageCache) forget(userID uint) {
+	c.mu.Lock()
+	delete(c.entries, userID)
+	c.mu.Unlock()
+}
+
+// quotaRemaining returns how many bytes the user can still store once the
+// freed bytes are given back, or -1 if the user has no quota.
+func quotaRemaining(user *users.User, freed int64) (int64, error) {
+	if user.Quota <= 0 {
+		return -1, nil
+	}
+
+	used, err := quotaUsage.get(user.ID, user.Fs)
+	if err != nil {
+		return 0, err
+	}
+
+	remaining := user.Quota - used + freed
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, nil
+}
+
+// checkQuota returns a quotaError if the needed bytes don't fit in the
+// quota of the user once the freed bytes are given back.
+func checkQuota(user *users.User, needed, freed int64) error {
+	remaining, err := quotaRemaining(user, freed)
+	if err != nil || remaining < 0 || needed <= remaining {
+		return err
+	}
+	return &quotaError{Quota: user.Quota, Used: user.Quota - remaining, Needed: needed}
+}
+
+// checkCopyQuota returns a quotaError if a copy of src to dst doesn't fit in
+// the quota of the user.
+func checkCopyQuota(d *data, src, dst string) error {
+	if d.user.Quota <= 0 {
+		return nil
+	}
+
+	needed, err := scopeUsage(d.user.Fs, src)
+	if err != nil {
+		return err
+	}
+
+	// an overridden destination frees its space
+	var freed int64
+	if _, err := d.user.Fs.Stat(dst); err == nil {
+		if freed, err = scopeUsage(d.user.Fs, dst); err != nil {
+			return err
+		}
+	}
+
+	return checkQuota(d.user, needed, freed)
+}
+
+// quotaReader fails with a quotaError once more than the remaining bytes
+// are read, for the uploads whose length isn't known beforehand.
+type quotaReader struct {
+	r         io.Reader
+	remaining int64
+	read      int64
+	quota     int64
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	n, err := q.r.Read(p)
+	q.read += int64(n)
+	if q.read > q.remaining {
+		return n, &quotaError{Quota: q.quota, Used: q.quota - q.remaining, Needed: q.read}
+	}
+	return n, err
+}
+
+// limitQuota checks the length of an upload against the quota of the user
+// and returns the reader to write it from.
+func limitQuota(d *data, r *http.Request, freed int64) (io.Reader, error) {
+	remaining, err := quotaRemaining(d.user, freed)
+	if err != nil || remaining < 0 {
+		return r.Body, err
+	}
+
+	if r.ContentLength > remaining {
+		return nil, &quotaError{Quota: d.user.Quota, Used: d.user.Quota - remaining, Needed: r.ContentLength}
+	}
+	return &quotaReader{r: r.Body, remaining: remaining, quota: d.user.Quota}, nil
+}
+
+// scopeUsage returns the size of the files under a path of a file system.
+func scopeUsage(fs afero.Fs, root string) (int64, error) {
+	var size int64
+	err := afero.Walk(fs, root, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil //nolint:nilerr
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+type userUsage struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+	Quota    int64  `json:"quota"`
+	Used     int64  `json:"used"`
+}
+
+var usersUsageHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	all, err := d.store.Users.Gets(d.server.Root)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	usage := make([]userUsage, 0, len(all))
+	for _, u := range all {
+		if r.URL.Query().Get("refresh") == "true" {
+			quotaUsage.forget(u.ID)
+		}
+
+		used, err := quotaUsage.get(u.ID, u.Fs)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		usage = append(usage, userUsage{ID: u.ID, Username: u.Username, Quota: u.Quota, Used: used})
+	}
+
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].ID < usage[j].ID
+	})
+
+	return renderJSON(w, r, usage)
+})
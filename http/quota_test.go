@@ -0,0 +1,88 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestScopeUsage(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	_ = afero.WriteFile(fs, "/a.txt", []byte("abc"), 0644)
+	_ = afero.WriteFile(fs, "/dir/b.txt", []byte("de"), 0644)
+
+	if usage, err := scopeUsage(fs, "/"); err != nil || usage != 5 {
+		t.Errorf("expected a usage of 5, got %d and %v", usage, err)
+	}
+	if usage, err := scopeUsage(fs, "/dir"); err != nil || usage != 2 {
+		t.Errorf("expected a usage of 2, got %d and %v", usage, err)
+	}
+}
+
+func TestCheckQuota(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	_ = afero.WriteFile(fs, "/a.txt", []byte("abcdef"), 0644)
+	d := &data{user: &users.User{ID: 1001, Quota: 10, Fs: fs}}
+	t.Cleanup(func() { quotaUsage.forget(d.user.ID) })
+
+	if err := checkQuota(d.user, 4, 0); err != nil {
+		t.Errorf("expected 4 bytes to fit, got %v", err)
+	}
+
+	err := checkQuota(d.user, 5, 0)
+	var quota *quotaError
+	if !errors.As(err, &quota) || !errors.Is(err, errQuotaExceeded) {
+		t.Fatalf("expected a quota error, got %v", err)
+	}
+	if quota.Used != 6 || quota.Needed != 5 {
+		t.Errorf("expected 6 bytes used and 5 needed, got %+v", quota)
+	}
+
+	// the usage is cached and adjusted by the writes
+	_ = afero.WriteFile(fs, "/b.txt", []byte("ghij"), 0644)
+	if err := checkQuota(d.user, 4, 0); err != nil {
+		t.Errorf("expected the cached usage to be used, got %v", err)
+	}
+	quotaUsage.add(d.user.ID, 4)
+	if err := checkQuota(d.user, 1, 0); err == nil {
+		t.Error("expected the adjusted usage to be used")
+	}
+
+	// replacing a file frees its space
+	if err := checkQuota(d.user, 6, 6); err != nil {
+		t.Errorf("expected the replaced file to free its space, got %v", err)
+	}
+
+	d.user.Quota = 0
+	if err := checkQuota(d.user, 100, 0); err != nil {
+		t.Errorf("expected no limit without quota, got %v", err)
+	}
+}
+
+func TestLimitQuota(t *testing.T) {
+	d := &data{user: &users.User{ID: 1002, Quota: 4, Fs: afero.NewMemMapFs()}}
+	t.Cleanup(func() { quotaUsage.forget(d.user.ID) })
+
+	r := httptest.NewRequest(http.MethodPost, "/a.txt", strings.NewReader("abcde"))
+	if _, err := limitQuota(d, r, 0); !errors.Is(err, errQuotaExceeded) {
+		t.Errorf("expected the length to be checked, got %v", err)
+	}
+
+	// without a length the body is cut once it goes over the quota
+	r = httptest.NewRequest(http.MethodPost, "/a.txt", strings.NewReader("abcde"))
+	r.ContentLength = -1
+	body, err := limitQuota(d, r, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(body); !errors.Is(err, errQuotaExceeded) {
+		t.Errorf("expected the body to be cut, got %v", err)
+	}
+}
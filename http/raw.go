@@ -2,12 +2,15 @@ package http
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
 	gopath "path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/mholt/archiver/v3"
 
@@ -66,12 +69,49 @@ func parseQueryAlgorithm(r *http.Request) (string, archiver.Writer, error) {
 	}
 }
 
+// inlineTypes are the types of the files the browsers can render instead of
+// downloading them, leaving out the ones that can run scripts such as HTML
+// or SVG. The patterns ending with /* match all the subtypes.
+var inlineTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"image/avif",
+	"image/bmp",
+	"video/*",
+	"audio/*",
+	"application/pdf",
+	"text/plain",
+}
+
+// canInline tells if a file can be rendered by the browsers, from the type
+// it's served with.
+func canInline(file *files.FileInfo) bool {
+	typ, _, err := mime.ParseMediaType(file.ContentType())
+	if err != nil {
+		return false
+	}
+
+	for _, allowed := range inlineTypes {
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok && strings.HasPrefix(typ, prefix) || typ == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// setContentDisposition makes the browsers download the file, unless it's
+// asked inline and its type is one of the inlineTypes.
 func setContentDisposition(w http.ResponseWriter, r *http.Request, file *files.FileInfo) {
-	if r.URL.Query().Get("inline") == "true" {
-		w.Header().Set("Content-Disposition", "inline")
+	// As per RFC6266 section 4.3
+	filename := "filename*=utf-8''" + url.PathEscape(file.Name)
+	if r.URL.Query().Get("inline") == "true" && canInline(file) {
+		// the browsers mustn't guess another type from the content
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Disposition", "inline; "+filename)
 	} else {
-		// As per RFC6266 section 4.3
-		w.Header().Set("Content-Disposition", "attachment; filename*=utf-8''"+url.PathEscape(file.Name))
+		w.Header().Set("Content-Disposition", "attachment; "+filename)
 	}
 }
 
@@ -86,6 +126,7 @@ var rawHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data)
 		Modify:     d.user.Perm.Modify,
 		Expand:     false,
 		ReadHeader: d.server.TypeDetectionByHeader,
+		MimeTypes:  d.settings.MimeTypes,
 		Checker:    d,
 	})
 	if err != nil {
@@ -97,11 +138,31 @@ var rawHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data)
 		return 0, nil
 	}
 
-	if !file.IsDir {
-		return rawFileHandler(w, r, file)
-	}
+	var status int
+	served := false
+	err = d.RunHook(r.Context(), func() error {
+		served = true
+		if !file.IsDir {
+			status, err = rawFileHandler(w, r, file)
+		} else {
+			status, err = rawDirHandler(w, r, d, file)
+		}
+		return err
+	}, "download", file.Path, "", d.user)
 
-	return rawDirHandler(w, r, d, file)
+	switch {
+	case !served:
+		// a before hook blocked the download
+		if status := errToStatus(err); status != http.StatusInternalServerError {
+			return status, err
+		}
+		return http.StatusForbidden, err
+	case status != 0:
+		return status, err
+	default:
+		// the after hooks failed, but the file is already sent
+		return 0, err
+	}
 })
 
 func addFile(ar archiver.Writer, d *data, path, commonPath string) error {
@@ -168,12 +229,6 @@ func rawDirHandler(w http.ResponseWriter, r *http.Request, d *data, file *files.
 		return http.StatusInternalServerError, err
 	}
 
-	err = ar.Create(w)
-	if err != nil {
-		return http.StatusInternalServerError, err
-	}
-	defer ar.Close()
-
 	commonDir := fileutils.CommonPrefix(filepath.Separator, filenames...)
 
 	name := filepath.Base(commonDir)
@@ -188,6 +243,16 @@ func rawDirHandler(w http.ResponseWriter, r *http.Request, d *data, file *files.
 	name += extension
 	w.Header().Set("Content-Disposition", "attachment; filename*=utf-8''"+url.PathEscape(name))
 
+	if extension == ".zip" {
+		return streamZip(w, r, d, filenames, commonDir)
+	}
+
+	err = ar.Create(w)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer ar.Close()
+
 	for _, fname := range filenames {
 		err = addFile(ar, d, fname, commonDir)
 		if err != nil {
@@ -198,6 +263,10 @@ func rawDirHandler(w http.ResponseWriter, r *http.Request, d *data, file *files.
 	return 0, nil
 }
 
+// rawFileHandler serves the content of a file, with the byte ranges of the
+// Range header if any, as the players request them to seek in the media
+// files. The entity tag lets the clients check with If-Range that the file
+// didn't change since they got its first bytes.
 func rawFileHandler(w http.ResponseWriter, r *http.Request, file *files.FileInfo) (int, error) {
 	fd, err := file.Fs.Open(file.Path)
 	if err != nil {
@@ -208,6 +277,17 @@ func rawFileHandler(w http.ResponseWriter, r *http.Request, file *files.FileInfo
 	setContentDisposition(w, r, file)
 	w.Header().Add("Content-Security-Policy", `script-src 'none';`)
 	w.Header().Set("Cache-Control", "private")
+	w.Header().Set("ETag", fileETag(file.ModTime, file.Size))
+	// the overrides of the types come before the ones of the extensions
+	if typ := file.ContentType(); typ != "" {
+		w.Header().Set("Content-Type", typ)
+	}
 	http.ServeContent(w, r, file.Name, file.ModTime, fd)
 	return 0, nil
 }
+
+// fileETag returns the entity tag of a version of a file, which changes
+// with its modification time and its size.
+func fileETag(modTime time.Time, size int64) string {
+	return fmt.Sprintf(`"%x%x"`, modTime.UnixNano(), size)
+}
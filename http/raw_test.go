@@ -0,0 +1,155 @@
+package http
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/files"
+)
+
+func TestRawFileHandlerRanges(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "/video.mp4", []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	file := &files.FileInfo{Fs: fs, Path: "/video.mp4", Name: "video.mp4", Size: 10, ModTime: modTime}
+	etag := fileETag(file.ModTime, file.Size)
+
+	serve := func(headers map[string]string) *http.Response {
+		r := httptest.NewRequest(http.MethodGet, "/api/raw/video.mp4?inline=true", http.NoBody)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		recorder := httptest.NewRecorder()
+		if _, err := rawFileHandler(recorder, r, file); err != nil {
+			t.Fatal(err)
+		}
+		return recorder.Result()
+	}
+	body := func(res *http.Response) string {
+		b, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		status       int
+		contentRange string
+		body         string
+	}{
+		{"whole file", nil, http.StatusOK, "", "0123456789"},
+		{"range", map[string]string{"Range": "bytes=2-5"}, http.StatusPartialContent, "bytes 2-5/10", "2345"},
+		{"open range", map[string]string{"Range": "bytes=7-"}, http.StatusPartialContent, "bytes 7-9/10", "789"},
+		{"suffix range", map[string]string{"Range": "bytes=-3"}, http.StatusPartialContent, "bytes 7-9/10", "789"},
+		{"range past the end", map[string]string{"Range": "bytes=8-20"}, http.StatusPartialContent, "bytes 8-9/10", "89"},
+		{"unsatisfiable range", map[string]string{"Range": "bytes=10-"}, http.StatusRequestedRangeNotSatisfiable, "bytes */10", ""},
+		{"if-range with the etag", map[string]string{"Range": "bytes=0-1", "If-Range": etag},
+			http.StatusPartialContent, "bytes 0-1/10", "01"},
+		{"if-range with another etag", map[string]string{"Range": "bytes=0-1", "If-Range": `"other"`},
+			http.StatusOK, "", "0123456789"},
+		{"if-range with the date", map[string]string{"Range": "bytes=0-1", "If-Range": modTime.Format(http.TimeFormat)},
+			http.StatusPartialContent, "bytes 0-1/10", "01"},
+		{"if-range with an older date", map[string]string{"Range": "bytes=0-1", "If-Range": modTime.Add(-time.Hour).Format(http.TimeFormat)},
+			http.StatusOK, "", "0123456789"},
+	}
+	for _, tt := range tests {
+		res := serve(tt.headers)
+		if res.StatusCode != tt.status || res.Header.Get("Content-Range") != tt.contentRange {
+			t.Errorf("%s: expected %d with range %q, got %d with %q",
+				tt.name, tt.status, tt.contentRange, res.StatusCode, res.Header.Get("Content-Range"))
+			continue
+		}
+		if tt.status == http.StatusRequestedRangeNotSatisfiable {
+			continue
+		}
+		if got := body(res); got != tt.body {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.body, got)
+		}
+		if res.Header.Get("Accept-Ranges") != "bytes" || res.Header.Get("ETag") != etag {
+			t.Errorf("%s: expected the ranges to be accepted with the etag, got %v", tt.name, res.Header)
+		}
+	}
+
+	// the clients having the file are told it didn't change, and get it
+	// again once it did
+	if res := serve(map[string]string{"If-None-Match": etag}); res.StatusCode != http.StatusNotModified || body(res) != "" {
+		t.Errorf("expected the file to be not modified, got %d", res.StatusCode)
+	}
+	if res := serve(map[string]string{"If-None-Match": `"other"`}); res.StatusCode != http.StatusOK || body(res) != "0123456789" {
+		t.Errorf("expected the file to be sent for another etag, got %d", res.StatusCode)
+	}
+	if changed := fileETag(modTime.Add(time.Second), file.Size); changed == etag || fileETag(modTime, 11) == etag {
+		t.Error("expected the etag to change with the file")
+	}
+
+	// several ranges are sent in the parts of a multipart body
+	res := serve(map[string]string{"Range": "bytes=0-1,5-6"})
+	mediaType, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil || res.StatusCode != http.StatusPartialContent || mediaType != "multipart/byteranges" {
+		t.Fatalf("expected a multipart response, got %d with %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	reader := multipart.NewReader(res.Body, params["boundary"])
+	for _, want := range []struct{ contentRange, body string }{{"bytes 0-1/10", "01"}, {"bytes 5-6/10", "56"}} {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(part)
+		if part.Header.Get("Content-Range") != want.contentRange || string(b) != want.body {
+			t.Errorf("expected the part %q of %q, got %q of %q", want.body, want.contentRange, b, part.Header.Get("Content-Range"))
+		}
+	}
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Errorf("expected two parts, got %v", err)
+	}
+}
+
+func TestSetContentDisposition(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		inline bool
+		want   string
+	}{
+		{"photo.JPG", true, "inline; filename*=utf-8''photo.JPG"},
+		{"movie.mp4", true, "inline; filename*=utf-8''movie.mp4"},
+		{"paper.pdf", true, "inline; filename*=utf-8''paper.pdf"},
+		{"notes.txt", true, "inline; filename*=utf-8''notes.txt"},
+		{"paper.pdf", false, "attachment; filename*=utf-8''paper.pdf"},
+		// the types that can run scripts are always downloaded
+		{"page.html", true, "attachment; filename*=utf-8''page.html"},
+		{"drawing.svg", true, "attachment; filename*=utf-8''drawing.svg"},
+		{"unknown", true, "attachment; filename*=utf-8''unknown"},
+	}
+	for _, tt := range tests {
+		target := "/api/raw/" + tt.name
+		if tt.inline {
+			target += "?inline=true"
+		}
+		recorder := httptest.NewRecorder()
+		setContentDisposition(recorder, httptest.NewRequest(http.MethodGet, target, http.NoBody), &files.FileInfo{Name: tt.name})
+
+		if got := recorder.Header().Get("Content-Disposition"); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", target, tt.want, got)
+		}
+		if nosniff := recorder.Header().Get("X-Content-Type-Options") == "nosniff"; nosniff != strings.HasPrefix(tt.want, "inline") {
+			t.Errorf("%s: expected nosniff only inline", target)
+		}
+	}
+}
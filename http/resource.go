@@ -11,6 +11,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/spf13/afero"
@@ -18,79 +19,104 @@ import (
 	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
 	"github.com/filebrowser/filebrowser/v2/files"
 	"github.com/filebrowser/filebrowser/v2/fileutils"
+	"github.com/filebrowser/filebrowser/v2/s3fs"
 )
 
-var resourceGetHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
-	file, err := files.NewFileInfo(&files.FileOptions{
-		Fs:         d.user.Fs,
-		Path:       r.URL.Path,
-		Modify:     d.user.Perm.Modify,
-		Expand:     true,
-		ReadHeader: d.server.TypeDetectionByHeader,
-		Checker:    d,
-		Content:    true,
-	})
-	if err != nil {
-		return errToStatus(err), err
-	}
-
-	if file.IsDir {
-		file.Listing.Sorting = d.user.Sorting
-		file.Listing.ApplySort()
-		return renderJSON(w, r, file)
-	}
-
-	if checksum := r.URL.Query().Get("checksum"); checksum != "" {
-		err := file.Checksum(checksum)
-		if errors.Is(err, fbErrors.ErrInvalidOption) {
-			return http.StatusBadRequest, nil
-		} else if err != nil {
-			return http.StatusInternalServerError, err
-		}
-
-		// do not waste bandwidth if we just want the checksum
-		file.Content = ""
-	}
-
-	return renderJSON(w, r, file)
-})
-
-func resourceDeleteHandler(fileCache FileCache) handleFunc {
-	return withUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
-		if r.URL.Path == "/" || !d.user.Perm.Delete {
-			return http.StatusForbidden, nil
-		}
-
+func resourceGetHandler(sizes *dirSizes) handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 		file, err := files.NewFileInfo(&files.FileOptions{
 			Fs:         d.user.Fs,
 			Path:       r.URL.Path,
 			Modify:     d.user.Perm.Modify,
-			Expand:     false,
+			Expand:     true,
 			ReadHeader: d.server.TypeDetectionByHeader,
+			MimeTypes:  d.settings.MimeTypes,
 			Checker:    d,
+			Content:    true,
 		})
 		if err != nil {
 			return errToStatus(err), err
 		}
 
-		// delete thumbnails
-		err = delThumbs(r.Context(), fileCache, file)
-		if err != nil {
-			return errToStatus(err), err
+		if file.IsDir {
+			if err := transformListing(r.Context(), d, file); err != nil {
+				return errToStatus(err), err
+			}
+			file.Listing.Sorting = d.user.Sorting
+			file.Listing.ApplySort()
+			showLocks(d, file)
+			showDirSizes(sizes, d, file)
+			return renderTaggedJSON(w, r, file)
 		}
 
-		err = d.RunHook(func() error {
-			return d.user.Fs.RemoveAll(r.URL.Path)
-		}, "delete", r.URL.Path, "", d.user)
+		showLocks(d, file)
+		if checksum := r.URL.Query().Get("checksum"); checksum != "" {
+			err := file.Checksum(checksum)
+			if errors.Is(err, fbErrors.ErrInvalidOption) {
+				return http.StatusBadRequest, nil
+			} else if err != nil {
+				return http.StatusInternalServerError, err
+			}
 
-		if err != nil {
-			return errToStatus(err), err
+			// do not waste bandwidth if we just want the checksum
+			file.Content = ""
 		}
 
-		return http.StatusNoContent, nil
+		return renderTaggedJSON(w, r, file)
 	})
 }
 
+func resourceDeleteHandler(fileCache FileCache) handleFunc {
+	return withUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		return deleteResource(r.Context(), d, fileCache, r.URL.Path)
+	})
+}
+
+// deleteResource removes a file or a directory, running the delete hooks,
+// or moves it to the trash, running the trash ones, if the user has one.
+func deleteResource(ctx context.Context, d *data, fileCache FileCache, p string) (int, error) {
+	if p == "/" || !d.user.Perm.Delete {
+		return http.StatusForbidden, nil
+	}
+
+	file, err := files.NewFileInfo(&files.FileOptions{
+		Fs:         d.user.Fs,
+		Path:       p,
+		Modify:     d.user.Perm.Modify,
+		Expand:     false,
+		ReadHeader: d.server.TypeDetectionByHeader,
+		MimeTypes:  d.settings.MimeTypes,
+		Checker:    d,
+	})
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	// delete thumbnails
+	err = delThumbs(ctx, fileCache, file)
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	if d.user.Trash.Enabled {
+		err = d.RunHook(ctx, func() error {
+			defer quotaUsage.forget(d.user.ID)
+			return trashFile(d.user, p, time.Now())
+		}, "trash", p, "", d.user)
+	} else {
+		err = d.RunHook(ctx, func() error {
+			defer quotaUsage.forget(d.user.ID)
+			return d.user.Fs.RemoveAll(p)
+		}, "delete", p, "", d.user)
+	}
+
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	return http.StatusNoContent, nil
+}
+
 func resourcePostHandler(fileCache FileCache) handleFunc {
 	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 		if !d.user.Perm.Create || !d.Check(r.URL.Path) {
@@ -100,6 +126,9 @@ func resourcePostHandler(fileCache FileCache) handleFunc {
 		// Directories creation on POST.
 		if strings.HasSuffix(r.URL.Path, "/") {
 			err := d.user.Fs.MkdirAll(r.URL.Path, files.PermDir)
+			if err == nil {
+				d.Notify("after_mkdir", r.URL.Path, "", d.user)
+			}
 			return errToStatus(err), err
 		}
 
@@ -109,9 +138,12 @@ func resourcePostHandler(fileCache FileCache) handleFunc {
 			Modify:     d.user.Perm.Modify,
 			Expand:     false,
 			ReadHeader: d.server.TypeDetectionByHeader,
+			MimeTypes:  d.settings.MimeTypes,
 			Checker:    d,
 		})
+		var replaced int64
 		if err == nil {
+			replaced = file.Size
 			if r.URL.Query().Get("override") != "true" {
 				return http.StatusConflict, nil
 			}
@@ -127,19 +159,45 @@ func resourcePostHandler(fileCache FileCache) handleFunc {
 			}
 		}
 
-		err = d.RunHook(func() error {
-			info, writeErr := writeFile(d.user.Fs, r.URL.Path, r.Body)
+		body, err := limitQuota(d, r, replaced)
+		if err == nil {
+			body, err = limitUploadSize(d, r, body)
+		}
+		if err != nil {
+			return errToStatus(err), err
+		}
+		progress := uploadProgress.track(d.user, r.URL.Path, r.ContentLength, 0)
+		defer uploadProgress.done(progress.ID)
+		body = uploadProgress.reader(progress, body)
+
+		// a before hook may rename the file. It's only removed on a failure
+		// once it was written, the refused uploads leaving it as it is.
+		target, written := r.URL.Path, false
+		err = d.RunHookPath(r.Context(), func(p string) error {
+			if p != r.URL.Path && r.URL.Query().Get("override") != "true" {
+				if _, statErr := d.user.Fs.Stat(p); statErr == nil {
+					return fbErrors.ErrExist
+				}
+			}
+			target = p
+
+			if versionErr := snapshotVersion(d.user, p); versionErr != nil {
+				return versionErr
+			}
+			written = true
+			info, writeErr := writeFile(d.user.Fs, p, body)
 			if writeErr != nil {
 				return writeErr
 			}
+			quotaUsage.add(d.user.ID, info.Size()-replaced)
 
-			etag := fmt.Sprintf(`"%x%x"`, info.ModTime().UnixNano(), info.Size())
-			w.Header().Set("ETag", etag)
+			w.Header().Set("ETag", fileETag(info.ModTime(), info.Size()))
 			return nil
 		}, "upload", r.URL.Path, "", d.user)
 
-		if err != nil {
-			_ = d.user.Fs.RemoveAll(r.URL.Path)
+		if err != nil && written {
+			_ = d.user.Fs.RemoveAll(target)
+			quotaUsage.forget(d.user.ID)
 		}
 
 		return errToStatus(err), err
@@ -156,22 +214,34 @@ var resourcePutHandler = withUser(func(w http.ResponseWriter, r *http.Request, d
 		return http.StatusMethodNotAllowed, nil
 	}
 
-	exists, err := afero.Exists(d.user.Fs, r.URL.Path)
+	existing, err := d.user.Fs.Stat(r.URL.Path)
+	if os.IsNotExist(err) {
+		return http.StatusNotFound, nil
+	}
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
-	if !exists {
-		return http.StatusNotFound, nil
+
+	body, err := limitQuota(d, r, existing.Size())
+	if err == nil {
+		body, err = limitUploadSize(d, r, body)
+	}
+	if err != nil {
+		return errToStatus(err), err
 	}
 
-	err = d.RunHook(func() error {
-		info, writeErr := writeFile(d.user.Fs, r.URL.Path, r.Body)
+	err = d.RunHook(r.Context(), func() error {
+		if versionErr := snapshotVersion(d.user, r.URL.Path); versionErr != nil {
+			return versionErr
+		}
+		info, writeErr := writeFile(d.user.Fs, r.URL.Path, body)
 		if writeErr != nil {
+			quotaUsage.forget(d.user.ID)
 			return writeErr
 		}
+		quotaUsage.add(d.user.ID, info.Size()-existing.Size())
 
-		etag := fmt.Sprintf(`"%x%x"`, info.ModTime().UnixNano(), info.Size())
-		w.Header().Set("ETag", etag)
+		w.Header().Set("ETag", fileETag(info.ModTime(), info.Size()))
 		return nil
 	}, "save", r.URL.Path, "", d.user)
 
@@ -180,47 +250,71 @@ var resourcePutHandler = withUser(func(w http.ResponseWriter, r *http.Request, d
 
 func resourcePatchHandler(fileCache FileCache) handleFunc {
 	return withUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
-		src := r.URL.Path
-		dst := r.URL.Query().Get("destination")
-		action := r.URL.Query().Get("action")
-		dst, err := url.QueryUnescape(dst)
-		if !d.Check(src) || !d.Check(dst) {
-			return http.StatusForbidden, nil
-		}
+		dst, err := url.QueryUnescape(r.URL.Query().Get("destination"))
 		if err != nil {
+			if !d.Check(r.URL.Path) {
+				return http.StatusForbidden, nil
+			}
 			return errToStatus(err), err
 		}
-		if dst == "/" || src == "/" {
-			return http.StatusForbidden, nil
-		}
-
-		err = checkParent(src, dst)
-		if err != nil {
-			return http.StatusBadRequest, err
-		}
 
 		override := r.URL.Query().Get("override") == "true"
 		rename := r.URL.Query().Get("rename") == "true"
-		if !override && !rename {
-			if _, err = d.user.Fs.Stat(dst); err == nil {
-				return http.StatusConflict, nil
-			}
-		}
-		if rename {
-			dst = addVersionSuffix(dst, d.user.Fs)
+		_, status, err := patchResource(r.Context(), d, fileCache, r.URL.Query().Get("action"), r.URL.Path, dst, override, rename)
+		return status, err
+	})
+}
+
+// patchResource copies or renames a file or a directory, running the hooks
+// of the action. An existing destination is a conflict unless it's
+// overridden, or the destination renamed, in which case the destination it
+// was renamed to is returned.
+func patchResource(ctx context.Context, d *data, fileCache FileCache, action, src, dst string, override, rename bool) (string, int, error) {
+	if !d.Check(src) || !d.Check(dst) {
+		return dst, http.StatusForbidden, nil
+	}
+	if dst == "/" || src == "/" {
+		return dst, http.StatusForbidden, nil
+	}
+
+	err := checkParent(src, dst)
+	if err != nil {
+		return dst, http.StatusBadRequest, err
+	}
+
+	if !override && !rename {
+		if _, err = d.user.Fs.Stat(dst); err == nil {
+			return dst, http.StatusConflict, nil
 		}
+	}
+	if rename {
+		dst = addVersionSuffix(dst, d.user.Fs)
+	}
 
-		// Permission for overwriting the file
-		if override && !d.user.Perm.Modify {
-			return http.StatusForbidden, nil
+	// Permission for overwriting the file
+	if override && !d.user.Perm.Modify {
+		return dst, http.StatusForbidden, nil
+	}
+
+	err = d.RunHook(ctx, func() error {
+		if override {
+			if versionErr := snapshotVersion(d.user, dst); versionErr != nil {
+				return versionErr
+			}
 		}
+		return patchAction(ctx, action, src, dst, d, fileCache)
+	}, patchEvent(action, src, dst), src, dst, d.user)
 
-		err = d.RunHook(func() error {
-			return patchAction(r.Context(), action, src, dst, d, fileCache)
-		}, action, src, dst, d.user)
+	return dst, errToStatus(err), err
+}
 
-		return errToStatus(err), err
-	})
+// patchEvent returns the hook event of a patch action. Renaming a file to
+// another directory is a move.
+func patchEvent(action, src, dst string) string {
+	if action == "rename" && path.Dir(path.Clean("/"+src)) != path.Dir(path.Clean("/"+dst)) {
+		return "move"
+	}
+	return action
 }
 
 func checkParent(src, dst string) error {
@@ -300,6 +394,11 @@ func patchAction(ctx context.Context, action, src, dst string, d *data, fileCach
 			return fbErrors.ErrPermissionDenied
 		}
 
+		if err := checkCopyQuota(d, src, dst); err != nil {
+			return err
+		}
+
+		defer quotaUsage.forget(d.user.ID)
 		return fileutils.Copy(d.user.Fs, src, dst)
 	case "rename":
 		if !d.user.Perm.Rename {
@@ -351,7 +450,7 @@ var diskUsage = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (
 		return errToStatus(err), err
 	}
 	fPath := file.RealPath()
-	if !file.IsDir {
+	if !file.IsDir || s3fs.IsURL(d.server.Root) {
 		return renderJSON(w, r, &DiskUsageResponse{
 			Total: 0,
 			Used:  0,
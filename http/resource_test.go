@@ -0,0 +1,227 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/files"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestPatchEvent(t *testing.T) {
+	tests := []struct {
+		action string
+		src    string
+		dst    string
+		want   string
+	}{
+		{"rename", "/dir/a.txt", "/dir/b.txt", "rename"},
+		{"rename", "/dir/a.txt", "/other/a.txt", "move"},
+		{"rename", "dir/a.txt", "/dir/b.txt", "rename"},
+		{"copy", "/dir/a.txt", "/other/a.txt", "copy"},
+	}
+
+	for _, tt := range tests {
+		if got := patchEvent(tt.action, tt.src, tt.dst); got != tt.want {
+			t.Errorf("patchEvent(%q, %q, %q) = %q, want %q", tt.action, tt.src, tt.dst, got, tt.want)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	user, err := st.Users.Get("", uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Perm = users.Permissions{Create: true, Rename: true, Modify: true, Delete: true, Download: true}
+	if err := st.Users.Update(user, "Perm"); err != nil {
+		t.Fatal(err)
+	}
+	token := issueToken(t, st)
+
+	set, err := st.Settings.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.ReadOnly = true
+	if err := st.Settings.Save(set); err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	serve := func(fn handleFunc, method, target string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(method, target, nil)
+		r.Header.Set("X-Auth", token)
+
+		recorder := httptest.NewRecorder()
+		handle(fn, "", st, &settings.Server{Root: root}, nil).ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	// the permissions of the user don't matter
+	if rec := serve(resourceDeleteHandler(&memoryCache{values: map[string][]byte{}}), http.MethodDelete, "/a.txt"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected the deletion to be forbidden, got %d", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.txt")); err != nil {
+		t.Errorf("expected the file to be kept: %v", err)
+	}
+	if rec := serve(resourceGetHandler(nil), http.MethodGet, "/a.txt"); rec.Code != http.StatusOK {
+		t.Errorf("expected the file to be read, got %d", rec.Code)
+	}
+
+	// the renewed tokens tell the interface to hide the write controls
+	rec := serve(renewHandler(time.Hour), http.MethodPost, "/")
+	var claims authToken
+	if _, err := jwt.ParseWithClaims(rec.Body.String(), &claims, func(*jwt.Token) (interface{}, error) {
+		return []byte("key"), nil
+	}); err != nil {
+		t.Fatalf("failed to parse the renewed token: %v", err)
+	}
+	if want := (users.Permissions{Download: true}); claims.User.Perm != want {
+		t.Errorf("expected the token to have the permissions %+v, got %+v", want, claims.User.Perm)
+	}
+}
+
+func TestResourceGetETag(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	token := issueToken(t, st)
+	root := t.TempDir()
+	write := func(name, content string, modTime time.Time) {
+		t.Helper()
+		name = filepath.Join(root, name)
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil { //nolint:gosec
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	write("a.txt", "a", modTime)
+
+	serve := func(target, etag string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set("X-Auth", token)
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		recorder := httptest.NewRecorder()
+		handle(resourceGetHandler(nil), "", st, &settings.Server{Root: root}, nil).ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	for _, target := range []string{"/", "/a.txt"} {
+		first := serve(target, "")
+		etag := first.Header().Get("ETag")
+		if first.Code != http.StatusOK || etag == "" {
+			t.Fatalf("%s: expected an entity tag, got %d and %q", target, first.Code, etag)
+		}
+		if again := serve(target, "").Header().Get("ETag"); again != etag {
+			t.Errorf("%s: expected the entity tag to be stable, got %q and %q", target, etag, again)
+		}
+
+		// the clients having the response are told it didn't change
+		for _, header := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+			if rec := serve(target, header); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+				t.Errorf("%s: expected %s to be not modified, got %d", target, header, rec.Code)
+			}
+		}
+		if rec := serve(target, `"other"`); rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+			t.Errorf("%s: expected another entity tag to get the response, got %d", target, rec.Code)
+		}
+	}
+
+	// the changes of the files change the tags of the listings
+	listing := serve("/", "").Header().Get("ETag")
+	file := serve("/a.txt", "").Header().Get("ETag")
+	write("a.txt", "b", modTime.Add(time.Hour))
+	if rec := serve("/a.txt", file); rec.Code != http.StatusOK {
+		t.Errorf("expected the changed file to be sent again, got %d", rec.Code)
+	}
+	if rec := serve("/", listing); rec.Code != http.StatusOK {
+		t.Errorf("expected the changed listing to be sent again, got %d", rec.Code)
+	}
+	listing = serve("/", "").Header().Get("ETag")
+	write("b.txt", "b", modTime)
+	if rec := serve("/", listing); rec.Code != http.StatusOK {
+		t.Errorf("expected the listing with a new file to be sent again, got %d", rec.Code)
+	}
+}
+
+func TestResourceMimeTypes(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	token := issueToken(t, st)
+	set, err := st.Settings.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.MimeTypes = map[string]string{".tar.gz": "application/gzip"}
+	if err := st.Settings.Save(set); !errors.Is(err, fbErrors.ErrInvalidOption) {
+		t.Errorf("expected an extension no file has to be refused, got %v", err)
+	}
+	set.MimeTypes = map[string]string{".MD": "text/plain"}
+	if err := st.Settings.Save(set); err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"notes.md":  "# Notes",
+		"clip.mp4":  "const a: number = 1",
+		"movie.mp4": "\x00\x00\x00\x18ftypmp42",
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil { //nolint:gosec
+			t.Fatal(err)
+		}
+	}
+	server := &settings.Server{Root: root, TypeDetectionByHeader: true}
+
+	for name, want := range map[string]struct{ typ, mimeType string }{
+		"notes.md": {"textImmutable", "text/plain"},
+		// the text the extension belies is sniffed
+		"clip.mp4":  {"textImmutable", "text/plain; charset=utf-8"},
+		"movie.mp4": {"video", "video/mp4"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/"+name, nil)
+		r.Header.Set("X-Auth", token)
+		recorder := httptest.NewRecorder()
+		handle(resourceGetHandler(nil), "", st, server, nil).ServeHTTP(recorder, r)
+
+		var file files.FileInfo
+		if err := json.Unmarshal(recorder.Body.Bytes(), &file); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if file.Type != want.typ || file.MimeType != want.mimeType {
+			t.Errorf("%s: expected %s as %s, got %s as %s", name, want.typ, want.mimeType, file.Type, file.MimeType)
+		}
+	}
+
+	// the files are served inline with their resolved type
+	if !canInline(&files.FileInfo{Name: "notes.md", MimeType: "text/plain"}) {
+		t.Error("expected the overridden type to be served inline")
+	}
+}
@@ -0,0 +1,153 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func getRoleID(r *http.Request) (uint, error) {
+	i, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 0)
+	if err != nil {
+		return 0, err
+	}
+	return uint(i), nil
+}
+
+func getRole(r *http.Request) (*users.Role, error) {
+	if r.Body == nil {
+		return nil, fbErrors.ErrEmptyRequest
+	}
+
+	role := &users.Role{}
+	if err := json.NewDecoder(r.Body).Decode(role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// roleUsers returns the users of a role.
+func roleUsers(d *data, id uint) ([]*users.User, error) {
+	all, err := d.store.Users.Gets(d.server.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []*users.User{}
+	for _, u := range all {
+		if u.Role == id {
+			members = append(members, u)
+		}
+	}
+	return members, nil
+}
+
+var rolesGetHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	roles, err := d.store.Roles.Gets()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].ID < roles[j].ID
+	})
+
+	return renderJSON(w, r, roles)
+})
+
+var roleGetHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	id, err := getRoleID(r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	role, err := d.store.Roles.Get(id)
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	return renderJSON(w, r, role)
+})
+
+var rolePostHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	role, err := getRole(r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	role.ID = 0
+	if err := d.store.Roles.Save(role); err != nil {
+		return errToStatus(err), err
+	}
+
+	w.Header().Set("Location", "/settings/roles/"+strconv.FormatUint(uint64(role.ID), 10))
+	return http.StatusCreated, nil
+})
+
+// rolePutHandler saves a role, and the permissions of its users so that
+// their tokens are renewed with them.
+var rolePutHandler = withAdmin(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	id, err := getRoleID(r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	role, err := getRole(r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if role.ID != id {
+		return http.StatusBadRequest, nil
+	}
+
+	if _, err := d.store.Roles.Get(id); err != nil {
+		return errToStatus(err), err
+	}
+	if err := d.store.Roles.Save(role); err != nil {
+		return errToStatus(err), err
+	}
+
+	members, err := roleUsers(d, id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	for _, u := range members {
+		if err := d.store.Users.Update(u, "Perm"); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	return http.StatusOK, nil
+})
+
+// roleDeleteHandler deletes a role, its users keeping its permissions as
+// their own.
+var roleDeleteHandler = withAdmin(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	id, err := getRoleID(r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	members, err := roleUsers(d, id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	for _, u := range members {
+		u.Role = 0
+		if err := d.store.Users.Update(u, "Role", "Perm"); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	if err := d.store.Roles.Delete(id); err != nil {
+		return errToStatus(err), err
+	}
+
+	return http.StatusOK, nil
+})
@@ -0,0 +1,112 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/asdine/storm/v3"
+	"github.com/gorilla/mux"
+
+	"github.com/filebrowser/filebrowser/v2/rules"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/storage/bolt"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestRoles(t *testing.T) {
+	t.Parallel()
+
+	db, err := storm.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	st, err := bolt.NewStorage(db)
+	if err != nil {
+		t.Fatalf("failed to get storage: %v", err)
+	}
+	defaults := users.Permissions{Create: true, Download: true}
+	if err := st.Settings.Save(&settings.Settings{Key: []byte("key"), Defaults: settings.UserDefaults{Perm: defaults}}); err != nil {
+		t.Fatalf("failed to save settings: %v", err)
+	}
+	admin := &users.User{Username: "admin", Password: "pw", Perm: users.Permissions{Admin: true}}
+	if err := st.Users.Save(admin); err != nil {
+		t.Fatalf("failed to save user: %v", err)
+	}
+	editor := &users.User{Username: "editor", Password: "pw", Perm: users.Permissions{Create: true},
+		Rules: []rules.Rule{{Path: "/a"}, {Regex: true, Regexp: &rules.Regexp{Raw: "b"}}}}
+	if err := st.Users.Save(editor); err != nil {
+		t.Fatalf("failed to save user: %v", err)
+	}
+
+	// the users of an older database are put in a default role, and their
+	// rules get a type
+	if err := db.Set("config", "version", 2); err != nil {
+		t.Fatal(err)
+	}
+	if st, err = bolt.NewStorage(db); err != nil {
+		t.Fatalf("failed to migrate storage: %v", err)
+	}
+	roles, err := st.Roles.Gets()
+	if err != nil || len(roles) != 1 || roles[0].Perm != defaults {
+		t.Fatalf("expected a default role, got %v and %v", roles, err)
+	}
+	role := roles[0]
+
+	user, err := st.Users.Get("", editor.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != role.ID || user.Perm != editor.Perm {
+		t.Fatalf("expected the permissions of the user to be kept, got %+v", user.Perm)
+	}
+	if user.Rules[0].Type != rules.TypePath || user.Rules[1].Type != rules.TypeRegex {
+		t.Fatalf("expected the rules to get a type, got %+v", user.Rules)
+	}
+
+	token := issueToken(t, st)
+	serve := func(fn handleFunc, method string, body interface{}) int {
+		t.Helper()
+
+		data, _ := json.Marshal(body)
+		r := httptest.NewRequest(method, "/", bytes.NewReader(data))
+		r.Header.Set("X-Auth", token)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+
+		recorder := httptest.NewRecorder()
+		handle(fn, "", st, &settings.Server{Root: t.TempDir()}, nil).ServeHTTP(recorder, r)
+		return recorder.Code
+	}
+
+	// the permissions the user didn't override follow the role
+	role.Perm.Delete, role.Perm.Create = true, false
+	if code := serve(rolePutHandler, http.MethodPut, role); code != http.StatusOK {
+		t.Fatalf("expected the role to be saved, got %d", code)
+	}
+	if user, err = st.Users.Get("", editor.ID); err != nil {
+		t.Fatal(err)
+	}
+	if want := (users.Permissions{Delete: true}); user.Perm != want {
+		t.Errorf("expected the permissions %+v, got %+v", want, user.Perm)
+	}
+
+	// the users of a deleted role keep its permissions
+	if code := serve(roleDeleteHandler, http.MethodDelete, nil); code != http.StatusOK {
+		t.Fatalf("expected the role to be deleted, got %d", code)
+	}
+	if user, err = st.Users.Get("", editor.ID); err != nil {
+		t.Fatal(err)
+	}
+	if want := (users.Permissions{Delete: true}); user.Role != 0 || user.Perm != want {
+		t.Errorf("expected the permissions %+v without role, got %+v", want, user.Perm)
+	}
+
+	if code := serve(rolePostHandler, http.MethodPost, &users.Role{}); code != http.StatusBadRequest {
+		t.Errorf("expected a role without name to be rejected, got %d", code)
+	}
+}
@@ -0,0 +1,88 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/rules"
+)
+
+// ruleEvaluation tells if a path is allowed and why. Source is where the
+// deciding rule is, global or user, hidden for the dotfiles hidden to the
+// user and empty if no rule matched.
+type ruleEvaluation struct {
+	Allowed bool        `json:"allowed"`
+	Source  string      `json:"source"`
+	Index   int         `json:"index"`
+	Rule    *rules.Rule `json:"rule"`
+}
+
+// evaluateRules checks a path against the global rules and then the ones of
+// the user, the last rule that matches deciding.
+func evaluateRules(path string, hideDotfiles bool, global, user []rules.Rule) ruleEvaluation {
+	if hideDotfiles && rules.MatchHidden(path) {
+		return ruleEvaluation{Allowed: false, Source: "hidden", Index: -1}
+	}
+
+	e := ruleEvaluation{Allowed: true, Index: -1}
+	for source, list := range [][]rules.Rule{global, user} {
+		for i := range list {
+			if list[i].Matches(path) {
+				e = ruleEvaluation{Allowed: list[i].Allow, Source: [...]string{"global", "user"}[source], Index: i, Rule: &list[i]}
+			}
+		}
+	}
+	return e
+}
+
+type ruleTestRequest struct {
+	Path string `json:"path"`
+	// User is the ID of the user whose rules are checked, none if zero.
+	User uint `json:"user"`
+	// Rules and GlobalRules replace the ones of the user and the settings
+	// when given, so that they're tested before being saved.
+	Rules        *[]rules.Rule `json:"rules"`
+	GlobalRules  *[]rules.Rule `json:"globalRules"`
+	HideDotfiles *bool         `json:"hideDotfiles"`
+}
+
+var rulesTestHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	if r.Body == nil {
+		return http.StatusBadRequest, fbErrors.ErrEmptyRequest
+	}
+
+	var req ruleTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if req.Path == "" {
+		return http.StatusBadRequest, fbErrors.ErrInvalidRequestParams
+	}
+
+	global, user, hideDotfiles := d.settings.Rules, []rules.Rule{}, false
+	if req.User != 0 {
+		u, err := d.store.Users.Get(d.server.Root, req.User)
+		if err != nil {
+			return errToStatus(err), err
+		}
+		user, hideDotfiles = u.Rules, u.HideDotfiles
+	}
+
+	if req.GlobalRules != nil {
+		global = *req.GlobalRules
+	}
+	if req.Rules != nil {
+		user = *req.Rules
+	}
+	if req.HideDotfiles != nil {
+		hideDotfiles = *req.HideDotfiles
+	}
+	for _, list := range [][]rules.Rule{global, user} {
+		if err := rules.Validate(list); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+
+	return renderJSON(w, r, evaluateRules(req.Path, hideDotfiles, global, user))
+})
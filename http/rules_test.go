@@ -0,0 +1,45 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/filebrowser/filebrowser/v2/rules"
+)
+
+func TestEvaluateRules(t *testing.T) {
+	t.Parallel()
+
+	global := []rules.Rule{
+		{Path: "/private"},
+		{Regex: true, Regexp: &rules.Regexp{Raw: `\.log$`}},
+	}
+	user := []rules.Rule{
+		{Path: "/private/shared", Allow: true},
+	}
+
+	tests := map[string]struct {
+		path    string
+		hidden  bool
+		allowed bool
+		source  string
+		index   int
+	}{
+		"no rule matching":     {path: "/docs/a.txt", allowed: true, source: "", index: -1},
+		"global rule":          {path: "/private/a.txt", allowed: false, source: "global", index: 0},
+		"user overriding":      {path: "/private/shared/a.txt", allowed: true, source: "user", index: 0},
+		"last rule matching":   {path: "/docs/a.log", allowed: false, source: "global", index: 1},
+		"hidden dotfile":       {path: "/docs/.env", hidden: true, allowed: false, source: "hidden", index: -1},
+		"dotfile not hidden":   {path: "/docs/.env", allowed: true, source: "", index: -1},
+		"user after the regex": {path: "/private/shared/a.log", allowed: true, source: "user", index: 0},
+	}
+
+	for name, tt := range tests {
+		e := evaluateRules(tt.path, tt.hidden, global, user)
+		if e.Allowed != tt.allowed || e.Source != tt.source || e.Index != tt.index {
+			t.Errorf("%s: got %+v", name, e)
+		}
+		if (e.Rule != nil) != (tt.index >= 0) {
+			t.Errorf("%s: unexpected rule %+v", name, e.Rule)
+		}
+	}
+}
@@ -1,28 +1,150 @@
 package http
 
 import (
+	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/rules"
 	"github.com/filebrowser/filebrowser/v2/search"
+	"github.com/filebrowser/filebrowser/v2/users"
 )
 
-var searchHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
-	response := []map[string]interface{}{}
-	query := r.URL.Query().Get("query")
+// adminSearchFlush is how many results of the admin searches are sent at
+// once.
+const adminSearchFlush = 100
 
-	err := search.Search(d.user.Fs, r.URL.Path, query, d, func(path string, f os.FileInfo) error {
-		response = append(response, map[string]interface{}{
-			"dir":  f.IsDir(),
-			"path": path,
+// searchChecker checks the paths of the searches, the excluded ones being
+// denied on top of the rules. The excluded directories are skipped.
+type searchChecker struct {
+	rules.Checker
+	exclude []string
+}
+
+func (c searchChecker) Check(p string) bool {
+	return !search.Excluded(c.exclude, p) && c.Checker.Check(p)
+}
+
+func (c searchChecker) SkipDir(p string) bool {
+	return search.Excluded(c.exclude, p)
+}
+
+func searchHandler(index *search.Index) handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		response := []map[string]interface{}{}
+		query := r.URL.Query().Get("query")
+
+		checker := searchChecker{Checker: d, exclude: d.settings.SearchExclude}
+		err := search.Search(d.user.Fs, r.URL.Path, query, checker, index, func(path string, f os.FileInfo) error {
+			response = append(response, map[string]interface{}{
+				"dir":  f.IsDir(),
+				"path": path,
+			})
+
+			return nil
 		})
 
-		return nil
+		if errors.Is(err, search.ErrNotIndexed) {
+			return http.StatusBadRequest, err
+		}
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		return renderJSON(w, r, response)
 	})
+}
+
+// adminSearchResult is a file found by an admin search, in the scope of
+// its user.
+type adminSearchResult struct {
+	User     uint   `json:"user,omitempty"`
+	Username string `json:"username,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Dir      bool   `json:"dir,omitempty"`
+	// Error ends the results of a search that failed once they were sent.
+	Error string `json:"error,omitempty"`
+}
 
-	if err != nil {
-		return http.StatusInternalServerError, err
+// searchUsers returns the users of the users query, a comma separated list
+// of IDs, or all of them if empty.
+func searchUsers(d *data, ids string) ([]*users.User, error) {
+	if ids == "" {
+		return d.store.Users.Gets(d.server.Root)
 	}
 
-	return renderJSON(w, r, response)
-})
+	list := []*users.User{}
+	for _, raw := range strings.Split(ids, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 32)
+		if err != nil {
+			return nil, fbErrors.ErrInvalidRequestParams
+		}
+		user, err := d.store.Users.Get(d.server.Root, uint(id))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, user)
+	}
+	return list, nil
+}
+
+// adminSearchHandler searches the scopes of several users, all of them
+// unless given in the users query, as they see them. The results are
+// streamed as JSON lines naming their user, the last one being an error if
+// the search failed after the first results.
+func adminSearchHandler(index *search.Index) handleFunc {
+	return withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		targets, err := searchUsers(d, r.URL.Query().Get("users"))
+		if err != nil {
+			return errToStatus(err), err
+		}
+		query := r.URL.Query().Get("query")
+
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		sent := 0
+		send := func(result adminSearchResult) error {
+			if sent == 0 {
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				w.Header().Set("Cache-Control", "no-cache")
+			}
+			if err := enc.Encode(result); err != nil {
+				return err
+			}
+			sent++
+			if sent%adminSearchFlush == 0 && flusher != nil {
+				flusher.Flush()
+			}
+			return r.Context().Err()
+		}
+
+		for _, user := range targets {
+			checker := searchChecker{Checker: &data{user: user, settings: d.settings}, exclude: d.settings.SearchExclude}
+			err = search.Search(user.Fs, "/", query, checker, index, func(p string, f os.FileInfo) error {
+				return send(adminSearchResult{User: user.ID, Username: user.Username, Path: "/" + p, Dir: f.IsDir()})
+			})
+			if err != nil {
+				break
+			}
+		}
+
+		switch {
+		case err != nil && sent > 0:
+			log.Printf("[WARN] Admin search failed: %v", err)
+			_ = enc.Encode(adminSearchResult{Error: err.Error()})
+		case errors.Is(err, search.ErrNotIndexed):
+			return http.StatusBadRequest, err
+		case err != nil:
+			return errToStatus(err), err
+		case sent == 0:
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+		}
+		return 0, nil
+	})
+}
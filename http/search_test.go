@@ -0,0 +1,117 @@
+package http
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/asdine/storm/v3"
+
+	"github.com/filebrowser/filebrowser/v2/rules"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/storage/bolt"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestAdminSearchHandler(t *testing.T) {
+	t.Parallel()
+
+	db, err := storm.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	st, err := bolt.NewStorage(db)
+	if err != nil {
+		t.Fatalf("failed to get storage: %v", err)
+	}
+	set := &settings.Settings{Key: []byte("key"), SearchExclude: []string{"node_modules", "/private"}}
+	if err := st.Settings.Save(set); err != nil {
+		t.Fatalf("failed to save settings: %v", err)
+	}
+
+	admin := &users.User{Username: "admin", Password: "pw", Scope: "/admin", Perm: users.Permissions{Admin: true}}
+	alice := &users.User{Username: "alice", Password: "pw", Scope: "/alice",
+		Rules: []rules.Rule{{Path: "/hidden", Allow: false}}}
+	bob := &users.User{Username: "bob", Password: "pw", Scope: "/bob"}
+	for _, u := range []*users.User{admin, alice, bob} {
+		if err := st.Users.Save(u); err != nil {
+			t.Fatalf("failed to save user: %v", err)
+		}
+	}
+
+	root := t.TempDir()
+	for _, name := range []string{
+		"/admin/report.txt",
+		"/alice/report.txt",
+		"/alice/hidden/report.txt",
+		"/alice/node_modules/report.txt",
+		"/bob/docs/report.txt",
+		"/bob/private/report.txt",
+		"/bob/other.txt",
+	} {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte("report"), 0644); err != nil { //nolint:gosec
+			t.Fatal(err)
+		}
+	}
+
+	token := issueToken(t, st)
+	serve := func(query string) (int, []adminSearchResult) {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		r.Header.Set("X-Auth", token)
+		recorder := httptest.NewRecorder()
+		handle(adminSearchHandler(nil), "", st, &settings.Server{Root: root}, nil).ServeHTTP(recorder, r)
+
+		results := []adminSearchResult{}
+		if recorder.Code != http.StatusOK {
+			return recorder.Code, results
+		}
+		scanner := bufio.NewScanner(strings.NewReader(recorder.Body.String()))
+		for scanner.Scan() {
+			var result adminSearchResult
+			if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+				t.Fatalf("expected JSON lines, got %q", recorder.Body.String())
+			}
+			results = append(results, result)
+		}
+		return recorder.Code, results
+	}
+	found := func(results []adminSearchResult) string {
+		names := []string{}
+		for _, result := range results {
+			names = append(names, result.Username+":"+result.Path)
+		}
+		sort.Strings(names)
+		return strings.Join(names, " ")
+	}
+
+	// the excluded paths and the ones the users don't see are skipped
+	code, results := serve("query=report")
+	if want := "admin:/report.txt alice:/report.txt bob:/docs/report.txt"; code != http.StatusOK || found(results) != want {
+		t.Errorf("expected %q, got %d and %q", want, code, found(results))
+	}
+	code, results = serve("query=report&users=" + strconv.Itoa(int(bob.ID)))
+	if want := "bob:/docs/report.txt"; code != http.StatusOK || found(results) != want || results[0].User != bob.ID {
+		t.Errorf("expected %q, got %d and %q", want, code, found(results))
+	}
+	if code, _ := serve("query=report&users=x"); code != http.StatusBadRequest {
+		t.Errorf("expected the invalid users to be refused, got %d", code)
+	}
+	if code, _ := serve("query=contents:report"); code != http.StatusBadRequest {
+		t.Errorf("expected the contents not to be searched without an index, got %d", code)
+	}
+}
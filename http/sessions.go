@@ -0,0 +1,134 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tomasen/realip"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/session"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// sessionTouchInterval is how often the last time a session or an API token
+// is seen is saved, not to write to the database on every request.
+const sessionTouchInterval = time.Minute
+
+// issueSession returns the session of a new token for a user. The renewed
+// tokens keep the session of the request.
+func issueSession(r *http.Request, d *data, user *users.User, expiration time.Duration) (*session.Session, error) {
+	now := time.Now()
+
+	sess := d.session
+	if sess == nil || sess.UserID != user.ID {
+		id := make([]byte, 24) //nolint:gomnd
+		if _, err := rand.Read(id); err != nil {
+			return nil, err
+		}
+
+		sess = &session.Session{
+			ID:       base64.RawURLEncoding.EncodeToString(id),
+			UserID:   user.ID,
+			Device:   r.UserAgent(),
+			IP:       realip.FromRequest(r),
+			IssuedAt: now.Unix(),
+		}
+	}
+
+	sess.LastSeen = now.Unix()
+	sess.Expire = now.Add(expiration).Unix()
+	if err := d.store.Sessions.Save(sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// checkSession returns the session of a token, or nil if it was revoked.
+func checkSession(r *http.Request, d *data, id string) (*session.Session, error) {
+	sess, err := d.store.Sessions.Get(id)
+	if errors.Is(err, fbErrors.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sess.UserID != d.user.ID {
+		return nil, nil
+	}
+
+	if time.Since(time.Unix(sess.LastSeen, 0)) > sessionTouchInterval {
+		sess.LastSeen = time.Now().Unix()
+		sess.IP = realip.FromRequest(r)
+		if err := d.store.Sessions.Save(sess); err != nil {
+			return nil, err
+		}
+	}
+
+	return sess, nil
+}
+
+type sessionInfo struct {
+	*session.Session
+	Current bool `json:"current"`
+}
+
+var sessionsGetHandler = withSelfOrAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	sessions, err := d.store.Sessions.FindByUserID(d.raw.(uint))
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen > sessions[j].LastSeen
+	})
+
+	infos := make([]sessionInfo, 0, len(sessions))
+	for _, sess := range sessions {
+		current := d.session != nil && d.session.ID == sess.ID
+		infos = append(infos, sessionInfo{Session: sess, Current: current})
+	}
+
+	return renderJSON(w, r, infos)
+})
+
+var sessionDeleteHandler = withSelfOrAdmin(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	sess, err := d.store.Sessions.Get(mux.Vars(r)["session"])
+	if err != nil {
+		return errToStatus(err), err
+	}
+	if sess.UserID != d.raw.(uint) {
+		return http.StatusNotFound, nil
+	}
+
+	if err := d.store.Sessions.Delete(sess.ID); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusNoContent, nil
+})
+
+// sessionsDeleteHandler revokes all the tokens of a user, including the
+// ones issued before the sessions were kept.
+var sessionsDeleteHandler = withSelfOrAdmin(func(_ http.ResponseWriter, _ *http.Request, d *data) (int, error) {
+	user, err := d.store.Users.Get(d.server.Root, d.raw.(uint))
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	user.TokenVersion++
+	if err := d.store.Users.Update(user, "TokenVersion"); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err := d.store.Sessions.DeleteByUserID(user.ID); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusNoContent, nil
+})
@@ -0,0 +1,126 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/gorilla/mux"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/storage"
+	"github.com/filebrowser/filebrowser/v2/storage/bolt"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func newSessionsStorage(t *testing.T) *storage.Storage {
+	t.Helper()
+
+	db, err := storm.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	st, err := bolt.NewStorage(db)
+	if err != nil {
+		t.Fatalf("failed to get storage: %v", err)
+	}
+	if err := st.Users.Save(&users.User{Username: "username", Password: "pw"}); err != nil {
+		t.Fatalf("failed to save user: %v", err)
+	}
+	if err := st.Settings.Save(&settings.Settings{Key: []byte("key")}); err != nil {
+		t.Fatalf("failed to save settings: %v", err)
+	}
+	return st
+}
+
+func serveSessions(t *testing.T, st *storage.Storage, fn handleFunc, token string, vars map[string]string) *http.Response {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Auth", token)
+	r = mux.SetURLVars(r, vars)
+
+	recorder := httptest.NewRecorder()
+	handle(fn, "", st, &settings.Server{Root: t.TempDir()}, nil).ServeHTTP(recorder, r)
+	return recorder.Result()
+}
+
+func issueToken(t *testing.T, st *storage.Storage) string {
+	t.Helper()
+
+	login := func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		user, err := d.store.Users.Get(d.server.Root, uint(1))
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return printToken(w, r, d, user, time.Hour)
+	}
+
+	res := serveSessions(t, st, login, "", nil)
+	defer res.Body.Close()
+	token, _ := io.ReadAll(res.Body)
+	return string(token)
+}
+
+func TestSessionsRevoke(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	ok := withUser(func(_ http.ResponseWriter, _ *http.Request, _ *data) (int, error) {
+		return http.StatusOK, nil
+	})
+	vars := map[string]string{"id": "1"}
+
+	first, second := issueToken(t, st), issueToken(t, st)
+	sessions, err := st.Sessions.FindByUserID(1)
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d and %v", len(sessions), err)
+	}
+
+	// revoking a session rejects its token only
+	res := serveSessions(t, st, sessionDeleteHandler, second, map[string]string{"id": "1", "session": sessions[0].ID})
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected the session to be revoked, got %d", res.StatusCode)
+	}
+
+	statuses := 0
+	for _, token := range []string{first, second} {
+		res := serveSessions(t, st, ok, token, vars)
+		res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			statuses++
+		}
+	}
+	if statuses != 1 {
+		t.Fatalf("expected a single token to be valid, got %d", statuses)
+	}
+
+	// revoking all of them bumps the version of the user
+	third := issueToken(t, st)
+	res = serveSessions(t, st, sessionsDeleteHandler, third, vars)
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected the sessions to be revoked, got %d", res.StatusCode)
+	}
+
+	for _, token := range []string{first, second, third} {
+		res := serveSessions(t, st, ok, token, vars)
+		res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected the token to be revoked, got %d", res.StatusCode)
+		}
+	}
+
+	res = serveSessions(t, st, ok, issueToken(t, st), vars)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected a new token to be valid, got %d", res.StatusCode)
+	}
+}
@@ -4,33 +4,106 @@ import (
 	"encoding/json"
 	"net/http"
 
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
 	"github.com/filebrowser/filebrowser/v2/rules"
 	"github.com/filebrowser/filebrowser/v2/settings"
 )
 
 type settingsData struct {
-	Signup           bool                  `json:"signup"`
-	CreateUserDir    bool                  `json:"createUserDir"`
-	UserHomeBasePath string                `json:"userHomeBasePath"`
-	Defaults         settings.UserDefaults `json:"defaults"`
-	Rules            []rules.Rule          `json:"rules"`
-	Branding         settings.Branding     `json:"branding"`
-	Tus              settings.Tus          `json:"tus"`
-	Shell            []string              `json:"shell"`
-	Commands         map[string][]string   `json:"commands"`
+	Signup           bool                                `json:"signup"`
+	CreateUserDir    bool                                `json:"createUserDir"`
+	EnforceTOTP      bool                                `json:"enforceTotp"`
+	ReadOnly         bool                                `json:"readOnly"`
+	MaxUploadSize    int64                               `json:"maxUploadSize"`
+	UserHomeBasePath string                              `json:"userHomeBasePath"`
+	Defaults         settings.UserDefaults               `json:"defaults"`
+	Rules            []rules.Rule                        `json:"rules"`
+	SearchExclude    []string                            `json:"searchExclude"`
+	SymlinkPolicy    string                              `json:"symlinkPolicy"`
+	MimeTypes        map[string]string                   `json:"mimeTypes"`
+	Branding         settings.Branding                   `json:"branding"`
+	Tus              settings.Tus                        `json:"tus"`
+	Shell            []string                            `json:"shell"`
+	UseShell         bool                                `json:"useShell"`
+	Commands         map[string][]settings.HookCommand   `json:"commands"`
+	CommandTemplates map[string]settings.CommandTemplate `json:"commandTemplates"`
+	ScriptsDir       string                              `json:"scriptsDir"`
+	EnvDir           string                              `json:"envDir"`
+	QueueName        string                              `json:"queueName"`
+	HookPolicies     map[string]string                   `json:"hookPolicies"`
+	HookBreaker      settings.HookBreaker                `json:"hookBreaker"`
+	AllowedCommands  []string                            `json:"allowedCommands"`
+	StdinEvents      []string                            `json:"stdinEvents"`
+	MetadataEvents   []string                            `json:"metadataEvents"`
+	InheritEnv       bool                                `json:"inheritEnv"`
+	HookWorkingDir   string                              `json:"hookWorkingDir"`
+	DirHooks         bool                                `json:"dirHooks"`
+	ExtraEnv         map[string]string                   `json:"extraEnv"`
+	// hooks rate limits
+	MaxHooksPerMinute       int `json:"maxHooksPerMinute"`
+	MaxGlobalHooksPerMinute int `json:"maxGlobalHooksPerMinute"`
+	// shares rate limits
+	MaxShareRequestsPerMinute int   `json:"maxShareRequestsPerMinute"`
+	MaxShareBandwidth         int64 `json:"maxShareBandwidth"`
+	// settings profiles, the active one being the one of the server
+	Profiles map[string]json.RawMessage `json:"profiles"`
+	Profile  string                     `json:"profile"`
+}
+
+// storedSettings returns the settings as they're saved, without the profile
+// of the server merged over them, for them to be edited.
+func storedSettings(d *data) (*settings.Settings, error) {
+	if d.server.Profile == "" {
+		return d.settings, nil
+	}
+	return d.store.Settings.Get()
 }
 
 var settingsGetHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	set, err := storedSettings(d)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
 	data := &settingsData{
-		Signup:           d.settings.Signup,
-		CreateUserDir:    d.settings.CreateUserDir,
-		UserHomeBasePath: d.settings.UserHomeBasePath,
-		Defaults:         d.settings.Defaults,
-		Rules:            d.settings.Rules,
-		Branding:         d.settings.Branding,
-		Tus:              d.settings.Tus,
-		Shell:            d.settings.Shell,
-		Commands:         d.settings.Commands,
+		Signup:           set.Signup,
+		CreateUserDir:    set.CreateUserDir,
+		EnforceTOTP:      set.EnforceTOTP,
+		ReadOnly:         set.ReadOnly,
+		MaxUploadSize:    set.MaxUploadSize,
+		UserHomeBasePath: set.UserHomeBasePath,
+		Defaults:         set.Defaults,
+		Rules:            set.Rules,
+		SearchExclude:    set.SearchExclude,
+		SymlinkPolicy:    set.SymlinkPolicy,
+		MimeTypes:        set.MimeTypes,
+		Branding:         set.Branding,
+		Tus:              set.Tus,
+		Shell:            set.Shell,
+		UseShell:         set.UseShell,
+		Commands:         set.Commands,
+		CommandTemplates: set.CommandTemplates,
+		ScriptsDir:       set.ScriptsDir,
+		EnvDir:           set.EnvDir,
+		QueueName:        set.QueueName,
+		HookPolicies:     set.HookPolicies,
+		HookBreaker:      set.HookBreaker,
+		AllowedCommands:  set.AllowedCommands,
+		StdinEvents:      set.StdinEvents,
+		MetadataEvents:   set.MetadataEvents,
+		InheritEnv:       set.GetInheritEnv(),
+		HookWorkingDir:   set.HookWorkingDir,
+		DirHooks:         set.DirHooks,
+		ExtraEnv:         set.ExtraEnv,
+
+		MaxHooksPerMinute:       set.MaxHooksPerMinute,
+		MaxGlobalHooksPerMinute: set.MaxGlobalHooksPerMinute,
+
+		MaxShareRequestsPerMinute: set.MaxShareRequestsPerMinute,
+		MaxShareBandwidth:         set.MaxShareBandwidth,
+
+		Profiles: set.Profiles,
+		Profile:  d.server.Profile,
 	}
 
 	return renderJSON(w, r, data)
@@ -42,17 +115,51 @@ var settingsPutHandler = withAdmin(func(_ http.ResponseWriter, r *http.Request,
 	if err != nil {
 		return http.StatusBadRequest, err
 	}
+	// the server would fail to start with its profile removed
+	if _, ok := req.Profiles[d.server.Profile]; d.server.Profile != "" && !ok {
+		return http.StatusBadRequest, fbErrors.ErrInvalidOption
+	}
+
+	set, err := storedSettings(d)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	set.Signup = req.Signup
+	set.CreateUserDir = req.CreateUserDir
+	set.EnforceTOTP = req.EnforceTOTP
+	set.ReadOnly = req.ReadOnly
+	set.MaxUploadSize = req.MaxUploadSize
+	set.MaxShareRequestsPerMinute = req.MaxShareRequestsPerMinute
+	set.MaxShareBandwidth = req.MaxShareBandwidth
+	set.UserHomeBasePath = req.UserHomeBasePath
+	set.Defaults = req.Defaults
+	set.Rules = req.Rules
+	set.SearchExclude = req.SearchExclude
+	set.SymlinkPolicy = req.SymlinkPolicy
+	set.MimeTypes = req.MimeTypes
+	set.Branding = req.Branding
+	set.Tus = req.Tus
+	set.Shell = req.Shell
+	set.UseShell = req.UseShell
+	set.Commands = req.Commands
+	set.CommandTemplates = req.CommandTemplates
+	set.ScriptsDir = req.ScriptsDir
+	set.EnvDir = req.EnvDir
+	set.QueueName = req.QueueName
+	set.HookPolicies = req.HookPolicies
+	set.HookBreaker = req.HookBreaker
+	set.AllowedCommands = req.AllowedCommands
+	set.StdinEvents = req.StdinEvents
+	set.MetadataEvents = req.MetadataEvents
+	set.InheritEnv = &req.InheritEnv
+	set.ExtraEnv = req.ExtraEnv
+	set.HookWorkingDir = req.HookWorkingDir
+	set.DirHooks = req.DirHooks
+	set.MaxHooksPerMinute = req.MaxHooksPerMinute
+	set.MaxGlobalHooksPerMinute = req.MaxGlobalHooksPerMinute
+	set.Profiles = req.Profiles
 
-	d.settings.Signup = req.Signup
-	d.settings.CreateUserDir = req.CreateUserDir
-	d.settings.UserHomeBasePath = req.UserHomeBasePath
-	d.settings.Defaults = req.Defaults
-	d.settings.Rules = req.Rules
-	d.settings.Branding = req.Branding
-	d.settings.Tus = req.Tus
-	d.settings.Shell = req.Shell
-	d.settings.Commands = req.Commands
-
-	err = d.store.Settings.Save(d.settings)
+	err = d.store.Settings.Save(set)
 	return errToStatus(err), err
 })
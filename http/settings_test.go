@@ -0,0 +1,103 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/filebrowser/filebrowser/v2/auth"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestSettingsProfiles(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	admin, err := st.Users.Get("", uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin.Perm = users.Permissions{Admin: true}
+	if err := st.Users.Update(admin, "Perm"); err != nil {
+		t.Fatal(err)
+	}
+	set, err := st.Settings.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.MaxUploadSize = 10
+	set.Profiles = map[string]json.RawMessage{
+		"staging": json.RawMessage(`{"maxUploadSize": 5, "searchExclude": ["tmp"]}`),
+	}
+	if err := st.Settings.Save(set); err != nil {
+		t.Fatal(err)
+	}
+	token := issueToken(t, st)
+
+	serve := func(fn handleFunc, profile, method string, body interface{}) *httptest.ResponseRecorder {
+		t.Helper()
+
+		encoded, _ := json.Marshal(body)
+		r := httptest.NewRequest(method, "/", bytes.NewReader(encoded))
+		r.Header.Set("X-Auth", token)
+		recorder := httptest.NewRecorder()
+		handle(fn, "", st, &settings.Server{Root: t.TempDir(), Profile: profile}, nil).ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	// the handlers get the profile merged over the settings
+	var got *settings.Settings
+	capture := func(_ http.ResponseWriter, _ *http.Request, d *data) (int, error) {
+		got = d.settings
+		return http.StatusOK, nil
+	}
+	if res := serve(capture, "staging", http.MethodGet, nil); res.Code != http.StatusOK {
+		t.Fatalf("expected the profile to be applied, got %d", res.Code)
+	}
+	if got.MaxUploadSize != 5 || len(got.SearchExclude) != 1 || string(got.Key) != "key" {
+		t.Errorf("expected the overrides of the profile, got %d and %v", got.MaxUploadSize, got.SearchExclude)
+	}
+	if res := serve(capture, "production", http.MethodGet, nil); res.Code != http.StatusInternalServerError {
+		t.Errorf("expected an unknown profile to fail, got %d", res.Code)
+	}
+
+	// the settings are edited without the profile
+	res := serve(settingsGetHandler, "staging", http.MethodGet, nil)
+	var data settingsData
+	if err := json.Unmarshal(res.Body.Bytes(), &data); err != nil || res.Code != http.StatusOK {
+		t.Fatalf("expected the settings, got %d and %v", res.Code, err)
+	}
+	if data.MaxUploadSize != 10 || data.Profile != "staging" || len(data.Profiles) != 1 {
+		t.Errorf("expected the stored settings and the active profile, got %+v", data)
+	}
+
+	data.Profiles = map[string]json.RawMessage{}
+	if res := serve(settingsPutHandler, "staging", http.MethodPut, data); res.Code != http.StatusBadRequest {
+		t.Errorf("expected the active profile not to be removed, got %d", res.Code)
+	}
+	data.Profiles = map[string]json.RawMessage{"staging": json.RawMessage(`{"maxUploadSize": "big"}`)}
+	if res := serve(settingsPutHandler, "staging", http.MethodPut, data); res.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid profile to be refused, got %d", res.Code)
+	}
+	data.Profiles = map[string]json.RawMessage{"staging": json.RawMessage(`{"maxUploadSize": 7}`)}
+	data.MaxUploadSize = 20
+	if res := serve(settingsPutHandler, "staging", http.MethodPut, data); res.Code != http.StatusOK {
+		t.Fatalf("expected the settings to be saved, got %d", res.Code)
+	}
+	if set, err = st.Settings.Get(); err != nil || set.MaxUploadSize != 20 || len(set.SearchExclude) != 0 {
+		t.Errorf("expected the profile not to be saved in the settings, got %+v and %v", set, err)
+	}
+
+	// the bundles imported keep the active profile too
+	set.Profiles, set.AuthMethod = nil, auth.MethodJSONAuth
+	bundle := configBundle{Version: configBundleVersion, Settings: set}
+	if res := serve(configImportHandler, "staging", http.MethodPost, bundle); res.Code != http.StatusBadRequest {
+		t.Errorf("expected a bundle without the active profile to be refused, got %d", res.Code)
+	}
+	if res := serve(capture, "staging", http.MethodGet, nil); res.Code != http.StatusOK {
+		t.Errorf("expected the profile to be kept, got %d", res.Code)
+	}
+}
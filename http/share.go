@@ -82,6 +82,11 @@ var shareDeleteHandler = withPermShare(func(_ http.ResponseWriter, r *http.Reque
 })
 
 var sharePostHandler = withPermShare(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	// the shares are downloaded without the API token limiting them
+	if !d.Check(r.URL.Path) {
+		return http.StatusForbidden, nil
+	}
+
 	var s *share.Link
 	var body share.CreateBody
 	if r.Body != nil {
@@ -123,6 +128,10 @@ var sharePostHandler = withPermShare(func(w http.ResponseWriter, r *http.Request
 		expire = time.Now().Add(add).Unix()
 	}
 
+	if body.MaxDownloads < 0 || body.MaxRequestsPerMinute < 0 || body.MaxBandwidth < 0 {
+		return http.StatusBadRequest, fbErrors.ErrInvalidRequestParams
+	}
+
 	hash, status, err := getSharePasswordHash(body)
 	if err != nil {
 		return status, err
@@ -144,6 +153,10 @@ var sharePostHandler = withPermShare(func(w http.ResponseWriter, r *http.Request
 		UserID:       d.user.ID,
 		PasswordHash: string(hash),
 		Token:        token,
+		MaxDownloads: body.MaxDownloads,
+
+		MaxRequestsPerMinute: body.MaxRequestsPerMinute,
+		MaxBandwidth:         body.MaxBandwidth,
 	}
 
 	if err := d.store.Share.Save(s); err != nil {
@@ -0,0 +1,181 @@
+package http
+
+import (
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/share"
+)
+
+// globalShareKey is the key of the buckets of all the shares together, no
+// hash being empty.
+const globalShareKey = ""
+
+// shareLimiterSize is how many buckets are kept before the full ones, of
+// the shares that weren't used for a while, are forgotten.
+const shareLimiterSize = 10000
+
+// shareLimiter throttles the public shares, each one with its own limits
+// and all of them together with the ones of the settings. The requests are
+// limited by minute, and the bytes that are downloaded by second.
+type shareLimiter struct {
+	mu        sync.Mutex
+	requests  map[string]*shareBucket
+	bandwidth map[string]*shareBucket
+}
+
+// shareBucket is a token bucket, whose tokens can be taken in advance by
+// the downloads, which then wait for them.
+type shareBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+var shareLimits = newShareLimiter()
+
+func newShareLimiter() *shareLimiter {
+	return &shareLimiter{requests: map[string]*shareBucket{}, bandwidth: map[string]*shareBucket{}}
+}
+
+// bucket returns the bucket of a key, refilled with limit tokens every
+// period up to limit.
+func (l *shareLimiter) bucket(buckets map[string]*shareBucket, key string, limit float64, period time.Duration, now time.Time) *shareBucket {
+	b, ok := buckets[key]
+	if !ok {
+		if len(buckets) >= shareLimiterSize {
+			l.forget(buckets, limit, period, now)
+		}
+		b = &shareBucket{tokens: limit, last: now}
+		buckets[key] = b
+	}
+
+	b.tokens = math.Min(limit, b.tokens+float64(now.Sub(b.last))/float64(period)*limit)
+	b.last = now
+	return b
+}
+
+// forget removes the buckets that would be full again by now.
+func (l *shareLimiter) forget(buckets map[string]*shareBucket, limit float64, period time.Duration, now time.Time) {
+	for key, b := range buckets {
+		if b.tokens+float64(now.Sub(b.last))/float64(period)*limit >= limit {
+			delete(buckets, key)
+		}
+	}
+}
+
+// wait returns how long it takes for a bucket to have n tokens.
+func (b *shareBucket) wait(limit float64, period time.Duration, n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / limit * float64(period))
+}
+
+// allow counts a request to a share, returning how long to wait before
+// trying again if it exceeds its limit, or the one of all the shares. The
+// requests that are refused aren't counted.
+func (l *shareLimiter) allow(link *share.Link, set *settings.Settings, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var taken []*shareBucket
+	for key, limit := range map[string]int{globalShareKey: set.MaxShareRequestsPerMinute, link.Hash: link.MaxRequestsPerMinute} {
+		if limit <= 0 {
+			continue
+		}
+		b := l.bucket(l.requests, key, float64(limit), time.Minute, now)
+		if wait := b.wait(float64(limit), time.Minute, 1); wait > 0 {
+			return wait
+		}
+		taken = append(taken, b)
+	}
+
+	for _, b := range taken {
+		b.tokens--
+	}
+	return 0
+}
+
+// reserve takes the bandwidth of n bytes downloaded from a share, returning
+// how long to wait for its limit, and the one of all the shares, to allow
+// them.
+func (l *shareLimiter) reserve(link *share.Link, set *settings.Settings, n int, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var wait time.Duration
+	for key, limit := range map[string]int64{globalShareKey: set.MaxShareBandwidth, link.Hash: link.MaxBandwidth} {
+		if limit <= 0 {
+			continue
+		}
+		b := l.bucket(l.bandwidth, key, float64(limit), time.Second, now)
+		b.tokens -= float64(n)
+		wait = max(wait, b.wait(float64(limit), time.Second, 0))
+	}
+	return wait
+}
+
+// throttle returns the file system of a share whose files are read no
+// faster than its bandwidth, and the one of all the shares, allow. It is fs
+// if there's no limit.
+func (l *shareLimiter) throttle(link *share.Link, set *settings.Settings, fs afero.Fs) afero.Fs {
+	chunk := int64(math.MaxInt32)
+	for _, limit := range []int64{link.MaxBandwidth, set.MaxShareBandwidth} {
+		if limit > 0 {
+			chunk = min(chunk, limit)
+		}
+	}
+	if chunk == math.MaxInt32 {
+		return fs
+	}
+	return &throttledFs{Fs: fs, limiter: l, link: link, settings: set, chunk: int(chunk)}
+}
+
+// throttledFs is a file system whose files wait for the bandwidth of a
+// share when they're read.
+type throttledFs struct {
+	afero.Fs
+	limiter  *shareLimiter
+	link     *share.Link
+	settings *settings.Settings
+	// chunk is the most that is read at once, not to wait for more than a
+	// second.
+	chunk int
+}
+
+func (fs *throttledFs) Open(name string) (afero.File, error) {
+	f, err := fs.Fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &throttledFile{File: f, fs: fs}, nil
+}
+
+func (fs *throttledFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	f, err := fs.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &throttledFile{File: f, fs: fs}, nil
+}
+
+type throttledFile struct {
+	afero.File
+	fs *throttledFs
+}
+
+func (f *throttledFile) Read(p []byte) (int, error) {
+	if len(p) > f.fs.chunk {
+		p = p[:f.fs.chunk]
+	}
+	n, err := f.File.Read(p)
+	if n > 0 {
+		time.Sleep(f.fs.limiter.reserve(f.fs.link, f.fs.settings, n, time.Now()))
+	}
+	return n, err
+}
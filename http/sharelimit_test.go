@@ -0,0 +1,121 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/share"
+	"github.com/filebrowser/filebrowser/v2/storage/bolt"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestShareLimiter(t *testing.T) {
+	l := newShareLimiter()
+	link := &share.Link{Hash: "h", MaxRequestsPerMinute: 2}
+	set := &settings.Settings{MaxShareRequestsPerMinute: 3}
+	other := &share.Link{Hash: "other"}
+	now := time.Now()
+
+	for i, want := range []bool{true, true, false} {
+		if got := l.allow(link, set, now) == 0; got != want {
+			t.Errorf("request %d: expected allowed to be %t", i+1, want)
+		}
+	}
+	// the requests of all the shares are limited together
+	if l.allow(other, set, now) != 0 {
+		t.Error("expected the other share to be allowed")
+	}
+	if wait := l.allow(other, set, now); wait <= 0 || wait > 20*time.Second {
+		t.Errorf("expected the global limit to wait for its next request, got %v", wait)
+	}
+	if l.allow(link, set, now.Add(30*time.Second)) != 0 {
+		t.Error("expected the limit to be refilled")
+	}
+
+	// the downloads take the bandwidth in advance
+	link = &share.Link{Hash: "h", MaxBandwidth: 100}
+	set = &settings.Settings{}
+	if wait := l.reserve(link, set, 100, now); wait != 0 {
+		t.Errorf("expected the burst not to wait, got %v", wait)
+	}
+	if wait := l.reserve(link, set, 50, now); wait != 500*time.Millisecond {
+		t.Errorf("expected to wait for the bandwidth, got %v", wait)
+	}
+	if fs := afero.NewMemMapFs(); l.throttle(&share.Link{}, set, fs) != fs {
+		t.Error("expected the shares without limits not to be throttled")
+	}
+}
+
+func TestPublicShareLimits(t *testing.T) {
+	t.Parallel()
+
+	db, err := storm.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	storage, err := bolt.NewStorage(db)
+	if err != nil {
+		t.Fatalf("failed to get storage: %v", err)
+	}
+	links := []*share.Link{
+		{Hash: "limited-requests", UserID: 1, Path: "/file", MaxRequestsPerMinute: 2},
+		{Hash: "limited-bandwidth", UserID: 1, Path: "/file", MaxBandwidth: 1000},
+	}
+	for _, link := range links {
+		if err := storage.Share.Save(link); err != nil {
+			t.Fatalf("failed to save share: %v", err)
+		}
+	}
+	if err := storage.Users.Save(&users.User{Username: "username", Password: "pw"}); err != nil {
+		t.Fatalf("failed to save user: %v", err)
+	}
+	if err := storage.Settings.Save(&settings.Settings{Key: []byte("key")}); err != nil {
+		t.Fatalf("failed to save settings: %v", err)
+	}
+	fs := afero.NewMemMapFs()
+	content := strings.Repeat("x", 1500)
+	if err := afero.WriteFile(fs, "/file", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	storage.Users = &customFSUser{Store: storage.Users, fs: fs}
+
+	download := func(hash string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest(http.MethodGet, hash, http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		handle(publicDlHandler, "", storage, &settings.Server{}, nil).ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	for i, expected := range []int{200, 200, 429} {
+		res := download("limited-requests")
+		if res.Code != expected {
+			t.Errorf("request %d: expected status code %d, got %d", i+1, expected, res.Code)
+		}
+		if expected == http.StatusTooManyRequests && res.Header().Get("Retry-After") != "30" {
+			t.Errorf("expected to retry after 30 seconds, got %q", res.Header().Get("Retry-After"))
+		}
+	}
+
+	// the first second of bandwidth is used at once, the rest is waited for
+	start := time.Now()
+	res := download("limited-bandwidth")
+	if res.Code != http.StatusOK || res.Body.String() != content {
+		t.Fatalf("expected the file, got %d", res.Code)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("expected the download to be throttled, took %v", elapsed)
+	}
+}
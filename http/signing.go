@@ -0,0 +1,85 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+// signingKeyInfo is a signing key without its secret.
+type signingKeyInfo struct {
+	ID        string    `json:"id"`
+	Algorithm string    `json:"algorithm"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"`
+	Current   bool      `json:"current"`
+}
+
+func signingKeyInfos(set *settings.Settings) []signingKeyInfo {
+	current := set.CurrentSigningKey()
+	if len(set.SigningKeys) == 0 {
+		return []signingKeyInfo{{Algorithm: current.Algorithm, Current: true}}
+	}
+
+	infos := make([]signingKeyInfo, 0, len(set.SigningKeys))
+	for _, k := range set.SigningKeys {
+		infos = append(infos, signingKeyInfo{
+			ID:        k.ID,
+			Algorithm: k.Algorithm,
+			Created:   k.Created,
+			Expires:   k.Expires,
+			Current:   k.ID == current.ID,
+		})
+	}
+	return infos
+}
+
+var signingKeysGetHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	return renderJSON(w, r, signingKeyInfos(d.settings))
+})
+
+type signingKeyRotation struct {
+	Algorithm string `json:"algorithm"`
+	// Overlap is how long the previous key keeps verifying the tokens, the
+	// expiration time of the tokens if empty.
+	Overlap string `json:"overlap"`
+}
+
+// signingKeysRotateHandler signs the tokens with a new key from now on,
+// letting the tokens of the previous one be renewed during the overlap.
+func signingKeysRotateHandler(tokenExpireTime time.Duration) handleFunc {
+	return withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		var req signingKeyRotation
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return http.StatusBadRequest, err
+		}
+
+		overlap := tokenExpireTime
+		if req.Overlap != "" {
+			var err error
+			if overlap, err = time.ParseDuration(req.Overlap); err != nil || overlap < 0 {
+				return http.StatusBadRequest, fbErrors.ErrInvalidRequestParams
+			}
+		}
+		switch req.Algorithm {
+		case "", settings.SigningHS256, settings.SigningRS256, settings.SigningES256:
+		default:
+			return http.StatusBadRequest, fbErrors.ErrInvalidRequestParams
+		}
+
+		set, err := storedSettings(d)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if _, err := set.RotateSigningKey(req.Algorithm, overlap, time.Now()); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if err := d.store.Settings.Save(set); err != nil {
+			return errToStatus(err), err
+		}
+		return renderJSON(w, r, signingKeyInfos(set))
+	})
+}
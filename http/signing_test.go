@@ -0,0 +1,94 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+func TestSigningKeysRotation(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	ok := withUser(func(_ http.ResponseWriter, _ *http.Request, _ *data) (int, error) {
+		return http.StatusOK, nil
+	})
+	check := func(token string, want int, renew bool) {
+		t.Helper()
+
+		res := serveSessions(t, st, ok, token, nil)
+		defer res.Body.Close()
+		if res.StatusCode != want {
+			t.Fatalf("expected %d, got %d", want, res.StatusCode)
+		}
+		if got := res.Header.Get("X-Renew-Token") == "true"; want == http.StatusOK && got != renew {
+			t.Fatalf("expected the renewal to be %t", renew)
+		}
+	}
+	// the tokens expiring within the hour are renewed anyway
+	issue := func() string {
+		t.Helper()
+
+		login := func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+			user, err := d.store.Users.Get(d.server.Root, uint(1))
+			if err != nil {
+				return http.StatusInternalServerError, err
+			}
+			return printToken(w, r, d, user, 2*time.Hour)
+		}
+		res := serveSessions(t, st, login, "", nil)
+		defer res.Body.Close()
+		token, _ := io.ReadAll(res.Body)
+		return string(token)
+	}
+	rotate := func(algorithm string, overlap time.Duration) settings.SigningKey {
+		t.Helper()
+
+		set, err := st.Settings.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := set.RotateSigningKey(algorithm, overlap, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := st.Settings.Save(set); err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	legacy := issue()
+	check(legacy, http.StatusOK, false)
+
+	// the tokens of the settings key are renewed during the overlap
+	es := rotate(settings.SigningES256, time.Hour)
+	check(legacy, http.StatusOK, true)
+	signed := issue()
+	token, _, err := jwt.NewParser().ParseUnverified(signed, &authToken{})
+	if err != nil || token.Header["kid"] != es.ID || token.Method.Alg() != settings.SigningES256 {
+		t.Fatalf("expected a token of the new key, got %v and %v", token.Header, err)
+	}
+	check(signed, http.StatusOK, false)
+
+	// a token of a key signed with another algorithm is refused
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &authToken{User: userInfo{ID: 1}})
+	forged.Header["kid"] = es.ID
+	forgedSigned, err := forged.SignedString(es.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(forgedSigned, http.StatusUnauthorized, false)
+
+	// the keys past their overlap are forgotten, the ones rotated before
+	// keep theirs
+	rotate(settings.SigningRS256, 0)
+	check(signed, http.StatusUnauthorized, false)
+	check(legacy, http.StatusOK, true)
+	check(issue(), http.StatusOK, false)
+}
@@ -39,12 +39,15 @@ func handleWithStaticData(w http.ResponseWriter, _ *http.Request, d *data, fSys
 		"NoAuth":                d.settings.AuthMethod == auth.MethodNoAuth,
 		"AuthMethod":            d.settings.AuthMethod,
 		"LoginPage":             auther.LoginPage(),
+		"PasswordLogin":         true,
 		"CSS":                   false,
 		"ReCaptcha":             false,
 		"Theme":                 d.settings.Branding.Theme,
 		"EnableThumbs":          d.server.EnableThumbnails,
+		"VideoThumbs":           d.server.EnableThumbnails && d.server.VideoThumbnailCommand != "",
 		"ResizePreview":         d.server.ResizePreview,
 		"EnableExec":            d.server.EnableExec,
+		"ReadOnly":              d.settings.ReadOnly,
 		"TusSettings":           d.settings.Tus,
 	}
 
@@ -76,6 +79,10 @@ func handleWithStaticData(w http.ResponseWriter, _ *http.Request, d *data, fSys
 		}
 	}
 
+	if webAuthn, ok := auther.(*auth.WebAuthnAuth); ok {
+		data["PasswordLogin"] = webAuthn.AllowPassword
+	}
+
 	b, err := json.Marshal(data)
 	if err != nil {
 		return http.StatusInternalServerError, err
@@ -107,7 +114,7 @@ func getStaticHandlers(store *storage.Storage, server *settings.Server, assetsFs
 
 		w.Header().Set("x-xss-protection", "1; mode=block")
 		return handleWithStaticData(w, r, d, assetsFs, "public/index.html", "text/html; charset=utf-8")
-	}, "", store, server)
+	}, "", store, server, nil)
 
 	static = handle(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 		if r.Method != http.MethodGet {
@@ -152,7 +159,7 @@ func getStaticHandlers(store *storage.Storage, server *settings.Server, assetsFs
 		}
 
 		return 0, nil
-	}, "/static/", store, server)
+	}, "/static/", store, server, nil)
 
 	return index, static
 }
@@ -21,6 +21,7 @@ var subtitleHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *d
 		Modify:     d.user.Perm.Modify,
 		Expand:     false,
 		ReadHeader: d.server.TypeDetectionByHeader,
+		MimeTypes:  d.settings.MimeTypes,
 		Checker:    d,
 	})
 	if err != nil {
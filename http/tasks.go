@@ -0,0 +1,516 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/afero"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/files"
+)
+
+// taskExpiration is how long the finished tasks are kept for their status
+// to be read.
+const taskExpiration = 24 * time.Hour
+
+// The states of the tasks.
+const (
+	taskRunning  = "running"
+	taskDone     = "done"
+	taskFailed   = "failed"
+	taskCanceled = "canceled"
+)
+
+// taskConflict is a file a task left alone since its destination exists,
+// until it's resolved.
+type taskConflict struct {
+	Path string `json:"path"`
+	Dst  string `json:"dst"`
+	Size int64  `json:"size"`
+}
+
+// fileTask is a copy or a move of a file or a directory run in the
+// background, whose conflicts are reported as warnings instead of failing
+// it.
+type fileTask struct {
+	ID     string `json:"id"`
+	UserID uint   `json:"userID"`
+	// Action is copy or move.
+	Action string `json:"action"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Status string `json:"status"`
+	// Size and Files are the bytes and the files of the source, and Done
+	// and FilesDone the ones copied or skipped so far. The conflicts are
+	// done once they're resolved.
+	Size      int64          `json:"size"`
+	Done      int64          `json:"done"`
+	Files     int            `json:"files"`
+	FilesDone int            `json:"filesDone"`
+	Conflicts []taskConflict `json:"conflicts"`
+	// Warnings are the warnings of the hooks.
+	Warnings []string  `json:"warnings"`
+	Error    string    `json:"error,omitempty"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+
+	cancel context.CancelFunc
+}
+
+// taskTracker keeps the tasks of the users.
+type taskTracker struct {
+	mu    sync.Mutex
+	tasks map[string]*fileTask
+}
+
+var fileTasks = &taskTracker{tasks: map[string]*fileTask{}}
+
+// add registers a running task, and forgets the ones finished long ago.
+func (t *taskTracker) add(task *fileTask, cancel context.CancelFunc, now time.Time) error {
+	id := make([]byte, 16) //nolint:gomnd
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, other := range t.tasks {
+		if other.Status != taskRunning && now.Sub(other.Updated) > taskExpiration {
+			delete(t.tasks, id)
+		}
+	}
+
+	task.ID = hex.EncodeToString(id)
+	task.Status = taskRunning
+	task.Conflicts = []taskConflict{}
+	task.Warnings = []string{}
+	task.Created = now
+	task.Updated = now
+	task.cancel = cancel
+	t.tasks[task.ID] = task
+	return nil
+}
+
+// update changes a task.
+func (t *taskTracker) update(task *fileTask, fn func(task *fileTask)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fn(task)
+	task.Updated = time.Now()
+}
+
+// snapshot returns a copy of a task that can be read without the lock.
+func (t *taskTracker) snapshot(task *fileTask) fileTask {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := *task
+	s.Conflicts = append([]taskConflict{}, task.Conflicts...)
+	s.Warnings = append([]string{}, task.Warnings...)
+	return s
+}
+
+// get returns a task of a user.
+func (t *taskTracker) get(userID uint, id string) (*fileTask, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	task, ok := t.tasks[id]
+	if !ok || task.UserID != userID {
+		return nil, false
+	}
+	return task, true
+}
+
+// list returns the tasks of a user, the last created first.
+func (t *taskTracker) list(userID uint) []*fileTask {
+	t.mu.Lock()
+	tasks := []*fileTask{}
+	for _, task := range t.tasks {
+		if task.UserID == userID {
+			tasks = append(tasks, task)
+		}
+	}
+	t.mu.Unlock()
+
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Created.After(tasks[j].Created) })
+	return tasks
+}
+
+func (t *taskTracker) remove(id string) {
+	t.mu.Lock()
+	delete(t.tasks, id)
+	t.mu.Unlock()
+}
+
+// taskReader counts the bytes of a task as they're copied, and stops once
+// it's canceled.
+type taskReader struct {
+	ctx  context.Context
+	r    io.Reader
+	task *fileTask
+}
+
+func (tr *taskReader) Read(p []byte) (int, error) {
+	if err := tr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := tr.r.Read(p)
+	fileTasks.update(tr.task, func(task *fileTask) { task.Done += int64(n) })
+	return n, err
+}
+
+type taskRequest struct {
+	// Action is copy or move.
+	Action string `json:"action"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	// Conflict is how the existing files are handled, see the transfers.
+	// Without any, they're left as conflicts of the task.
+	Conflict string `json:"conflict"`
+}
+
+// taskPostHandler starts a copy or a move in the background, once it's
+// checked like the PATCH requests of the resources, and answers with the
+// task.
+func taskPostHandler(fileCache FileCache) handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		var req taskRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return http.StatusBadRequest, err
+		}
+		src, dst := path.Clean("/"+req.From), path.Clean("/"+req.To)
+
+		switch {
+		case req.Action != "copy" && req.Action != "move", req.From == "", req.To == "":
+			return http.StatusBadRequest, fbErrors.ErrInvalidRequestParams
+		case req.Conflict != "" && req.Conflict != conflictSkip && req.Conflict != conflictRename &&
+			req.Conflict != conflictOverwrite:
+			return http.StatusBadRequest, fbErrors.ErrInvalidRequestParams
+		case src == "/" || dst == "/" || !d.Check(src) || !d.Check(dst):
+			return http.StatusForbidden, nil
+		case req.Action == "copy" && !d.user.Perm.Create, req.Action == "move" && !d.user.Perm.Rename:
+			return http.StatusForbidden, nil
+		case req.Conflict == conflictOverwrite && !d.user.Perm.Modify:
+			return http.StatusForbidden, nil
+		}
+		if err := checkParent(src, dst); err != nil {
+			return http.StatusBadRequest, err
+		}
+
+		task := &fileTask{UserID: d.user.ID, Action: req.Action, From: src, To: dst}
+		if _, err := d.user.Fs.Stat(src); err != nil {
+			return errToStatus(err), err
+		}
+		if err := afero.Walk(d.user.Fs, src, func(_ string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				task.Size += info.Size()
+				task.Files++
+			}
+			return nil
+		}); err != nil {
+			return errToStatus(err), err
+		}
+		if req.Action == "copy" {
+			if err := checkCopyQuota(d, src, dst); err != nil {
+				return errToStatus(err), err
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+		if err := fileTasks.add(task, cancel, time.Now()); err != nil {
+			cancel()
+			return http.StatusInternalServerError, err
+		}
+		event := patchEvent(strings.Replace(req.Action, "move", "rename", 1), src, dst)
+		if err := runTask(ctx, d, task, func(d *data) error {
+			return d.RunHook(ctx, func() error {
+				return copyTask(ctx, d, fileCache, task, req.Conflict)
+			}, event, src, dst, d.user)
+		}); err != nil {
+			fileTasks.remove(task.ID)
+			cancel()
+			return http.StatusServiceUnavailable, err
+		}
+
+		w.Header().Set("Location", "/api/tasks/"+task.ID)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(fileTasks.snapshot(task)); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return 0, nil
+	})
+}
+
+// runTask runs the function of a task in the background, with a copy of
+// the data of the request whose hook warnings go to the task, and records
+// how it ended.
+func runTask(ctx context.Context, d *data, task *fileTask, fn func(d *data) error) error {
+	hooks := *d.Runner
+	hooks.OnWarning = func(msg string) {
+		fileTasks.update(task, func(task *fileTask) { task.Warnings = append(task.Warnings, msg) })
+	}
+	bg := *d
+	bg.Runner = &hooks
+
+	return d.Go(func() {
+		defer quotaUsage.forget(d.user.ID)
+
+		err := fn(&bg)
+		fileTasks.update(task, func(task *fileTask) {
+			switch {
+			case ctx.Err() != nil:
+				task.Status = taskCanceled
+			case err != nil:
+				task.Status = taskFailed
+				task.Error = err.Error()
+			default:
+				task.Status = taskDone
+			}
+		})
+	})
+}
+
+// copyTask copies or moves the files of a task, handling the existing ones
+// with the conflict. A move to a new destination is a rename.
+func copyTask(ctx context.Context, d *data, fileCache FileCache, task *fileTask, conflict string) error {
+	fs := d.user.Fs
+	info, err := fs.Stat(task.From)
+	if err != nil {
+		return err
+	}
+
+	move := task.Action == "move"
+	if _, err := fs.Stat(task.To); move && errors.Is(err, os.ErrNotExist) {
+		if err := patchAction(ctx, "rename", task.From, task.To, d, fileCache); err != nil {
+			return err
+		}
+		fileTasks.update(task, func(task *fileTask) {
+			task.Done = task.Size
+			task.FilesDone = task.Files
+		})
+		return nil
+	}
+
+	if !info.IsDir() {
+		return copyTaskFile(ctx, d, task, task.From, task.To, conflict)
+	}
+
+	dirs := []string{}
+	err = afero.Walk(fs, task.From, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		dst := path.Join(task.To, strings.TrimPrefix(p, task.From))
+		if info.IsDir() {
+			dirs = append(dirs, p)
+			return fs.MkdirAll(dst, files.PermDir)
+		}
+		return copyTaskFile(ctx, d, task, p, dst, conflict)
+	})
+	if err != nil || !move {
+		return err
+	}
+
+	// the directories left with conflicts are kept
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = fs.Remove(dirs[i])
+	}
+	return nil
+}
+
+// copyTaskFile copies or moves a file of a task, or leaves it as a conflict
+// if the destination exists and there's no conflict to handle it.
+func copyTaskFile(ctx context.Context, d *data, task *fileTask, src, dst, conflict string) error {
+	fs := d.user.Fs
+	info, err := fs.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fs.Stat(dst); err == nil {
+		switch conflict {
+		case conflictRename:
+			dst = addVersionSuffix(dst, fs)
+		case conflictOverwrite:
+			if err := snapshotVersion(d.user, dst); err != nil {
+				return err
+			}
+		case conflictSkip:
+			fileTasks.update(task, func(task *fileTask) {
+				task.Done += info.Size()
+				task.FilesDone++
+			})
+			return nil
+		default:
+			fileTasks.update(task, func(task *fileTask) {
+				task.Conflicts = append(task.Conflicts, taskConflict{Path: src, Dst: dst, Size: info.Size()})
+			})
+			return nil
+		}
+	}
+
+	in, err := fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if _, err := writeFile(fs, dst, &taskReader{ctx: ctx, r: in, task: task}); err != nil {
+		return err
+	}
+	if err := fs.Chmod(dst, info.Mode()); err != nil {
+		return err
+	}
+	if task.Action == "move" {
+		if err := fs.Remove(src); err != nil {
+			return err
+		}
+	}
+
+	fileTasks.update(task, func(task *fileTask) { task.FilesDone++ })
+	return nil
+}
+
+var tasksGetHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	tasks := []fileTask{}
+	for _, task := range fileTasks.list(d.user.ID) {
+		tasks = append(tasks, fileTasks.snapshot(task))
+	}
+	return renderJSON(w, r, tasks)
+})
+
+var taskGetHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	task, ok := fileTasks.get(d.user.ID, mux.Vars(r)["id"])
+	if !ok {
+		return http.StatusNotFound, nil
+	}
+	return renderJSON(w, r, fileTasks.snapshot(task))
+})
+
+type taskResolution struct {
+	// Conflicts are the sources of the conflicts to resolve, all of them
+	// if empty.
+	Conflicts []string `json:"conflicts"`
+	// Conflict is skip, rename or overwrite.
+	Conflict string `json:"conflict"`
+}
+
+// taskResolveHandler resolves conflicts of a finished task, copying or
+// moving their files in the background with the hooks of each. The skipped
+// ones are only forgotten.
+var taskResolveHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	task, ok := fileTasks.get(d.user.ID, mux.Vars(r)["id"])
+	if !ok {
+		return http.StatusNotFound, nil
+	}
+
+	var req taskResolution
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return http.StatusBadRequest, err
+	}
+	switch req.Conflict {
+	case conflictSkip, conflictRename:
+	case conflictOverwrite:
+		if !d.user.Perm.Modify {
+			return http.StatusForbidden, nil
+		}
+	default:
+		return http.StatusBadRequest, fbErrors.ErrInvalidRequestParams
+	}
+
+	selected := map[string]bool{}
+	for _, p := range req.Conflicts {
+		selected[path.Clean("/"+p)] = true
+	}
+
+	var resolved []taskConflict
+	running := false
+	fileTasks.update(task, func(task *fileTask) {
+		if running = task.Status == taskRunning; running {
+			return
+		}
+		kept := []taskConflict{}
+		for _, c := range task.Conflicts {
+			if len(selected) == 0 || selected[c.Path] {
+				resolved = append(resolved, c)
+			} else {
+				kept = append(kept, c)
+			}
+		}
+		task.Conflicts = kept
+		if req.Conflict == conflictSkip {
+			for _, c := range resolved {
+				task.Done += c.Size
+				task.FilesDone++
+			}
+		} else if len(resolved) > 0 {
+			task.Status = taskRunning
+			task.Error = ""
+		}
+	})
+	if running {
+		return http.StatusConflict, nil
+	}
+	if req.Conflict == conflictSkip || len(resolved) == 0 {
+		return renderJSON(w, r, fileTasks.snapshot(task))
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	fileTasks.update(task, func(task *fileTask) { task.cancel = cancel })
+	event := patchEvent(strings.Replace(task.Action, "move", "rename", 1), task.From, task.To)
+	err := runTask(ctx, d, task, func(d *data) error {
+		for _, c := range resolved {
+			err := d.RunHook(ctx, func() error {
+				return copyTaskFile(ctx, d, task, c.Path, c.Dst, req.Conflict)
+			}, event, c.Path, c.Dst, d.user)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		cancel()
+		return http.StatusServiceUnavailable, err
+	}
+	return renderJSON(w, r, fileTasks.snapshot(task))
+})
+
+// taskDeleteHandler cancels a running task, or forgets a finished one.
+var taskDeleteHandler = withUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	task, ok := fileTasks.get(d.user.ID, mux.Vars(r)["id"])
+	if !ok {
+		return http.StatusNotFound, nil
+	}
+
+	var cancel context.CancelFunc
+	fileTasks.update(task, func(task *fileTask) {
+		if task.Status == taskRunning {
+			cancel = task.cancel
+		}
+	})
+	if cancel != nil {
+		cancel()
+		return http.StatusAccepted, nil
+	}
+	fileTasks.remove(task.ID)
+	return http.StatusNoContent, nil
+})
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestTasks(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	user, err := st.Users.Get("", uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Perm = users.Permissions{Create: true, Rename: true, Modify: true, Delete: true}
+	if err := st.Users.Update(user, "Perm"); err != nil {
+		t.Fatal(err)
+	}
+	token := issueToken(t, st)
+
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"src/a.txt":     "new a",
+		"src/sub/b.txt": "b",
+		"dst/a.txt":     "old a",
+		"c.txt":         "c",
+	} {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil { //nolint:gosec
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		content, _ := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+		return string(content)
+	}
+
+	serve := func(fn handleFunc, method, id string, req interface{}) (int, fileTask) {
+		t.Helper()
+
+		body, _ := json.Marshal(req)
+		r := httptest.NewRequest(method, "/", bytes.NewReader(body))
+		r.Header.Set("X-Auth", token)
+		r = mux.SetURLVars(r, map[string]string{"id": id})
+
+		recorder := httptest.NewRecorder()
+		handle(fn, "", st, &settings.Server{Root: root}, nil).ServeHTTP(recorder, r)
+
+		var task fileTask
+		_ = json.Unmarshal(recorder.Body.Bytes(), &task)
+		return recorder.Code, task
+	}
+	wait := func(id string) fileTask {
+		t.Helper()
+
+		for i := 0; i < 100; i++ {
+			code, task := serve(taskGetHandler, http.MethodGet, id, nil)
+			if code != http.StatusOK {
+				t.Fatalf("expected the task to be found, got %d", code)
+			}
+			if task.Status != taskRunning {
+				return task
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("expected the task %s to end", id)
+		return fileTask{}
+	}
+	post := taskPostHandler(&memoryCache{values: map[string][]byte{}})
+
+	if code, _ := serve(post, http.MethodPost, "", taskRequest{Action: "delete", From: "/c.txt", To: "/d.txt"}); code != http.StatusBadRequest {
+		t.Errorf("expected the invalid action to be refused, got %d", code)
+	}
+	if code, _ := serve(post, http.MethodPost, "", taskRequest{Action: "copy", From: "/src", To: "/src/sub"}); code != http.StatusBadRequest {
+		t.Errorf("expected a copy into the source to be refused, got %d", code)
+	}
+
+	// the existing files are left as conflicts
+	code, task := serve(post, http.MethodPost, "", taskRequest{Action: "copy", From: "/src", To: "/dst"})
+	if code != http.StatusAccepted || task.ID == "" || task.Size != 6 || task.Files != 2 {
+		t.Fatalf("expected the task to start, got %d and %+v", code, task)
+	}
+	task = wait(task.ID)
+	if task.Status != taskDone || task.FilesDone != 1 || task.Done != 1 || len(task.Conflicts) != 1 ||
+		task.Conflicts[0].Path != "/src/a.txt" || task.Conflicts[0].Dst != "/dst/a.txt" {
+		t.Fatalf("expected a conflict, got %+v", task)
+	}
+	if read("dst/sub/b.txt") != "b" || read("dst/a.txt") != "old a" {
+		t.Errorf("expected only the new files to be copied")
+	}
+
+	if code, _ := serve(taskResolveHandler, http.MethodPost, task.ID, taskResolution{Conflict: "merge"}); code != http.StatusBadRequest {
+		t.Errorf("expected the invalid resolution to be refused, got %d", code)
+	}
+	code, _ = serve(taskResolveHandler, http.MethodPost, task.ID, taskResolution{Conflict: conflictRename})
+	if code != http.StatusOK {
+		t.Fatalf("expected the conflicts to be resolved, got %d", code)
+	}
+	task = wait(task.ID)
+	if task.Status != taskDone || task.FilesDone != 2 || task.Done != task.Size || len(task.Conflicts) != 0 {
+		t.Errorf("expected the task to be done, got %+v", task)
+	}
+	if read("dst/a(1).txt") != "new a" || read("dst/a.txt") != "old a" {
+		t.Errorf("expected the conflict to be renamed")
+	}
+
+	// a move to a new destination is a rename
+	code, task = serve(post, http.MethodPost, "", taskRequest{Action: "move", From: "/c.txt", To: "/dst/c.txt"})
+	if code != http.StatusAccepted {
+		t.Fatalf("expected the move to start, got %d", code)
+	}
+	if task = wait(task.ID); task.Status != taskDone || task.FilesDone != 1 || read("dst/c.txt") != "c" {
+		t.Errorf("expected the file to be moved, got %+v", task)
+	}
+	if _, err := os.Stat(filepath.Join(root, "c.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected the source to be removed, got %v", err)
+	}
+
+	// the finished tasks are forgotten
+	if code, _ := serve(taskDeleteHandler, http.MethodDelete, task.ID, nil); code != http.StatusNoContent {
+		t.Errorf("expected the task to be forgotten, got %d", code)
+	}
+	if code, _ := serve(taskGetHandler, http.MethodGet, task.ID, nil); code != http.StatusNotFound {
+		t.Errorf("expected the task to be gone, got %d", code)
+	}
+}
@@ -0,0 +1,254 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/filebrowser/filebrowser/v2/files"
+	"github.com/filebrowser/filebrowser/v2/img"
+	"github.com/filebrowser/filebrowser/v2/runner"
+	"github.com/filebrowser/filebrowser/v2/s3fs"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/storage"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// maxVideoFrameBytes limits the output of the video thumbnail command.
+const maxVideoFrameBytes = 32 << 20
+
+// thumbnailHeaderSize is the length of the modification time and the size
+// saved before the cached previews.
+const thumbnailHeaderSize = 16
+
+var errVideoFrameTooLarge = errors.New("the video frame is too large")
+
+// thumbnailer creates the previews of the images and the videos and keeps
+// them in the file cache, along with the modification time of their file
+// so that they're created again once it changes. It implements
+// runner.Listener to create the thumbnails of the uploads beforehand.
+type thumbnailer struct {
+	imgSvc    ImgService
+	fileCache FileCache
+	runner    *runner.Runner
+	store     *storage.Storage
+	server    *settings.Server
+
+	once  sync.Once
+	queue chan func()
+}
+
+func newThumbnailer(imgSvc ImgService, fileCache FileCache, hookRunner *runner.Runner,
+	store *storage.Storage, server *settings.Server) *thumbnailer {
+	if hookRunner == nil {
+		hookRunner = &runner.Runner{}
+	}
+	return &thumbnailer{
+		imgSvc:    imgSvc,
+		fileCache: fileCache,
+		runner:    hookRunner,
+		store:     store,
+		server:    server,
+	}
+}
+
+// supports tells if the file has previews, the other ones being served as
+// they are.
+func (t *thumbnailer) supports(file *files.FileInfo) bool {
+	switch file.Type {
+	case "image":
+		format, err := t.imgSvc.FormatFromExtension(file.Extension)
+		return err == nil && format != img.FormatGif
+	case "video":
+		// the frames are extracted from the local files
+		return t.server.VideoThumbnailCommand != "" && !s3fs.IsURL(t.server.Root)
+	default:
+		return false
+	}
+}
+
+// get returns the preview of a file, from the cache if it's still fresh.
+func (t *thumbnailer) get(ctx context.Context, file *files.FileInfo, previewSize PreviewSize) ([]byte, error) {
+	width, _, err := t.dimensions(previewSize)
+	if err != nil {
+		return nil, err
+	}
+
+	key := previewCacheKey(file, previewSize)
+	cached, ok, err := t.fileCache.Load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if preview, fresh := openThumbnail(cached, file, width); fresh {
+			return preview, nil
+		}
+	}
+
+	preview, err := t.create(ctx, file, previewSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.fileCache.Store(ctx, key, sealThumbnail(preview, file, width)); err != nil {
+		log.Printf("[WARN] Failed to cache the preview of %s: %v", file.Path, err)
+	}
+	return preview, nil
+}
+
+func (t *thumbnailer) dimensions(previewSize PreviewSize) (int, []img.Option, error) {
+	switch previewSize {
+	case PreviewSizeBig:
+		return t.server.GetPreviewSize(), []img.Option{img.WithMode(img.ResizeModeFit), img.WithQuality(img.QualityMedium)}, nil
+	case PreviewSizeThumb:
+		return t.server.GetThumbnailSize(), []img.Option{img.WithMode(img.ResizeModeFill), img.WithQuality(img.QualityLow), img.WithFormat(img.FormatJpeg)}, nil
+	default:
+		return 0, nil, img.ErrUnsupportedFormat
+	}
+}
+
+func (t *thumbnailer) create(ctx context.Context, file *files.FileInfo, previewSize PreviewSize) ([]byte, error) {
+	size, options, err := t.dimensions(previewSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var in io.Reader
+	if file.Type == "video" {
+		if in, err = t.videoFrame(ctx, file); err != nil {
+			return nil, err
+		}
+		options = append(options, img.WithFormat(img.FormatJpeg))
+	} else {
+		fd, err := file.Fs.Open(file.Path)
+		if err != nil {
+			return nil, err
+		}
+		defer fd.Close()
+		in = fd
+	}
+
+	buf := &bytes.Buffer{}
+	if err := t.imgSvc.Resize(ctx, in, size, size, buf, options...); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// videoFrame runs the video thumbnail command through the runner, so that
+// it's parsed, allowed and limited as the hook commands are.
+func (t *thumbnailer) videoFrame(ctx context.Context, file *files.FileInfo) (io.Reader, error) {
+	set, err := t.store.Settings.Get()
+	if err == nil {
+		set, err = set.WithProfile(t.server.Profile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	frame := &frameBuffer{}
+	stderr := &bytes.Buffer{}
+	_, err = t.runner.WithSettings(set).Execute(ctx, &runner.ExecRequest{
+		Command: t.server.VideoThumbnailCommand,
+		Event:   "thumbnail",
+		Path:    file.Path,
+		Env:     map[string]string{"FILE": file.RealPath()},
+	}, frame, stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract a frame of %s: %w: %s", file.Path, err, stderr.String())
+	}
+	return &frame.Buffer, nil
+}
+
+// OperationDone implements runner.Listener, creating the thumbnails of the
+// uploaded and copied files in the background.
+func (t *thumbnailer) OperationDone(event, path, dst string, user *users.User) {
+	switch event {
+	case "after_upload":
+	case "after_copy":
+		path = dst
+	default:
+		return
+	}
+
+	t.once.Do(func() {
+		t.queue = make(chan func(), 256) //nolint:gomnd
+		go func() {
+			for job := range t.queue {
+				job()
+			}
+		}()
+	})
+
+	select {
+	case t.queue <- func() { t.pregenerate(path, user) }:
+	default:
+		// the thumbnail is created when it's first asked instead
+	}
+}
+
+func (t *thumbnailer) pregenerate(path string, user *users.User) {
+	set, err := t.store.Settings.Get()
+	if err == nil {
+		set, err = set.WithProfile(t.server.Profile)
+	}
+	if err != nil {
+		return
+	}
+
+	file, err := files.NewFileInfo(&files.FileOptions{
+		Fs:         user.Fs,
+		Path:       path,
+		Expand:     true,
+		ReadHeader: t.server.TypeDetectionByHeader,
+		MimeTypes:  set.MimeTypes,
+		Checker:    &data{user: user, settings: set},
+	})
+	if err != nil || file.IsDir || !t.supports(file) {
+		return
+	}
+
+	if _, err := t.get(context.Background(), file, PreviewSizeThumb); err != nil {
+		log.Printf("[WARN] Failed to create the thumbnail of %s: %v", path, err)
+	}
+}
+
+// sealThumbnail puts the modification time of the file and the size of a
+// preview before it.
+func sealThumbnail(preview []byte, file *files.FileInfo, size int) []byte {
+	sealed := make([]byte, thumbnailHeaderSize, thumbnailHeaderSize+len(preview))
+	binary.BigEndian.PutUint64(sealed, uint64(file.ModTime.UnixNano()))
+	binary.BigEndian.PutUint64(sealed[8:], uint64(size))
+	return append(sealed, preview...)
+}
+
+// openThumbnail returns a cached preview, if it was made at this size from
+// the current version of the file.
+func openThumbnail(cached []byte, file *files.FileInfo, size int) ([]byte, bool) {
+	if len(cached) < thumbnailHeaderSize {
+		return nil, false
+	}
+	if binary.BigEndian.Uint64(cached) != uint64(file.ModTime.UnixNano()) ||
+		binary.BigEndian.Uint64(cached[8:]) != uint64(size) {
+		return nil, false
+	}
+	return cached[thumbnailHeaderSize:], true
+}
+
+// frameBuffer keeps the output of the video thumbnail command, up to
+// maxVideoFrameBytes.
+type frameBuffer struct {
+	bytes.Buffer
+}
+
+func (b *frameBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > maxVideoFrameBytes {
+		return 0, errVideoFrameTooLarge
+	}
+	return b.Buffer.Write(p)
+}
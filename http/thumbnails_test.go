@@ -0,0 +1,173 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/files"
+	"github.com/filebrowser/filebrowser/v2/img"
+	"github.com/filebrowser/filebrowser/v2/runner"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// fakeImgService "resizes" the images by prefixing them, keeping what it
+// was given.
+type fakeImgService struct {
+	mu      sync.Mutex
+	resized [][]byte
+}
+
+func (s *fakeImgService) FormatFromExtension(_ string) (img.Format, error) {
+	return img.FormatJpeg, nil
+}
+
+func (s *fakeImgService) Resize(_ context.Context, in io.Reader, _, _ int, out io.Writer, _ ...img.Option) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.resized = append(s.resized, data)
+	s.mu.Unlock()
+
+	_, err = out.Write(append([]byte("thumb:"), data...))
+	return err
+}
+
+type memoryCache struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func (c *memoryCache) Store(_ context.Context, key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = value
+	return nil
+}
+
+func (c *memoryCache) Load(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.values[key]
+	return value, ok, nil
+}
+
+func (c *memoryCache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.values, key)
+	return nil
+}
+
+func thumbnailFile(t *testing.T, fs afero.Fs, name string) *files.FileInfo {
+	t.Helper()
+
+	file, err := files.NewFileInfo(&files.FileOptions{
+		Fs:      fs,
+		Path:    name,
+		Expand:  true,
+		Checker: &data{user: &users.User{}, settings: &settings.Settings{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestThumbnailerCache(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.jpg"), []byte("image"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fs := afero.NewBasePathFs(afero.NewOsFs(), root)
+
+	imgSvc := &fakeImgService{}
+	thumbs := newThumbnailer(imgSvc, &memoryCache{values: map[string][]byte{}}, nil, nil, &settings.Server{})
+
+	for i := 0; i < 2; i++ {
+		preview, err := thumbs.get(context.Background(), thumbnailFile(t, fs, "/a.jpg"), PreviewSizeThumb)
+		if err != nil || string(preview) != "thumb:image" {
+			t.Fatalf("expected the thumbnail, got %q and %v", preview, err)
+		}
+	}
+	if len(imgSvc.resized) != 1 {
+		t.Errorf("expected the thumbnail to be cached, got %d resizes", len(imgSvc.resized))
+	}
+
+	// a new version of the file makes a new thumbnail
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "a.jpg"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := thumbs.get(context.Background(), thumbnailFile(t, fs, "/a.jpg"), PreviewSizeThumb); err != nil {
+		t.Fatal(err)
+	}
+	if len(imgSvc.resized) != 2 {
+		t.Errorf("expected the thumbnail to be invalidated, got %d resizes", len(imgSvc.resized))
+	}
+
+	// so does another size
+	thumbs.server.ThumbnailSize = 128
+	if _, err := thumbs.get(context.Background(), thumbnailFile(t, fs, "/a.jpg"), PreviewSizeThumb); err != nil {
+		t.Fatal(err)
+	}
+	if len(imgSvc.resized) != 3 {
+		t.Errorf("expected the thumbnail to be resized again, got %d resizes", len(imgSvc.resized))
+	}
+}
+
+func TestThumbnailerVideo(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	// binary, not to be sniffed as text
+	frame := []byte("\x00\x00\x00\x18ftypmp42frame")
+	if err := os.WriteFile(filepath.Join(root, "a.mp4"), frame, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fs := afero.NewBasePathFs(afero.NewOsFs(), root)
+
+	imgSvc := &fakeImgService{}
+	server := &settings.Server{VideoThumbnailCommand: "cat $FILE"}
+	thumbs := newThumbnailer(imgSvc, &memoryCache{values: map[string][]byte{}}, &runner.Runner{}, newSessionsStorage(t), server)
+
+	file := thumbnailFile(t, fs, "/a.mp4")
+	if file.Type != "video" || !thumbs.supports(file) {
+		t.Fatalf("expected a video with thumbnails, got %s", file.Type)
+	}
+
+	// the uploads get their thumbnail beforehand
+	thumbs.OperationDone("after_upload", "/a.mp4", "", &users.User{Fs: fs})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		thumbs.fileCache.(*memoryCache).mu.Lock()
+		n := len(thumbs.fileCache.(*memoryCache).values)
+		thumbs.fileCache.(*memoryCache).mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the thumbnail of the upload to be created")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	imgSvc.mu.Lock()
+	defer imgSvc.mu.Unlock()
+	if len(imgSvc.resized) != 1 || !bytes.Equal(imgSvc.resized[0], frame) {
+		t.Errorf("expected the output of the command to be resized, got %q", imgSvc.resized)
+	}
+}
@@ -0,0 +1,177 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tomasen/realip"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/tokens"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// bearerToken returns the API token of the Authorization header of a
+// request, false if it has none.
+func bearerToken(r *http.Request) (string, bool) {
+	plain, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !strings.HasPrefix(plain, tokens.Prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(plain), true
+}
+
+// checkAPIToken authenticates a request with an API token, the user getting
+// the permissions the token grants among its own. It returns 0 when the
+// token is valid.
+func checkAPIToken(r *http.Request, d *data, plain string) (int, error) {
+	id, ok := tokens.ParseID(plain)
+	if !ok {
+		return http.StatusUnauthorized, nil
+	}
+	tok, err := d.store.Tokens.Get(id)
+	if errors.Is(err, fbErrors.ErrNotExist) {
+		return http.StatusUnauthorized, nil
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !tok.Verify(plain) {
+		return http.StatusUnauthorized, nil
+	}
+
+	d.user, err = d.store.Users.Get(d.server.Root, tok.UserID)
+	if errors.Is(err, fbErrors.ErrNotExist) {
+		return http.StatusUnauthorized, nil
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	d.restrictReadOnly(d.user)
+	restrictAdmin(r, d.user)
+	d.user.Perm = d.user.Perm.Intersect(tok.Perm)
+
+	if time.Since(time.Unix(tok.LastUsed, 0)) > sessionTouchInterval {
+		tok.LastUsed = time.Now().Unix()
+		tok.LastIP = realip.FromRequest(r)
+		if err := d.store.Tokens.Save(tok); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	d.token = tok
+	return 0, nil
+}
+
+// withSessionUser is withUser refusing the API tokens, for the endpoints
+// managing the credentials of the user, which a token could otherwise use
+// to get more than it grants.
+func withSessionUser(fn handleFunc) handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		if d.token != nil {
+			return http.StatusForbidden, nil
+		}
+		return fn(w, r, d)
+	})
+}
+
+type tokenRequest struct {
+	Name  string            `json:"name"`
+	Perm  users.Permissions `json:"perm"`
+	Scope string            `json:"scope"`
+	// Expire is the Unix time the token expires at, never when zero.
+	Expire int64 `json:"expire"`
+}
+
+// tokenCreated is a new token, with its plain text shown this once.
+type tokenCreated struct {
+	*tokens.Token
+	Secret string `json:"secret"`
+}
+
+var tokensGetHandler = withSelfOrAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	list, err := d.store.Tokens.FindByUserID(d.raw.(uint))
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created > list[j].Created
+	})
+	for _, tok := range list {
+		tok.Hash = ""
+	}
+
+	return renderJSON(w, r, list)
+})
+
+// tokenPostHandler creates an API token of a user, granting some of its
+// permissions on a directory of its scope. The tokens don't create tokens.
+var tokenPostHandler = withSelfOrAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	if d.token != nil {
+		return http.StatusForbidden, nil
+	}
+
+	var req tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return http.StatusBadRequest, err
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || (req.Expire != 0 && req.Expire <= time.Now().Unix()) {
+		return http.StatusBadRequest, nil
+	}
+
+	user, err := d.store.Users.Get(d.server.Root, d.raw.(uint))
+	if err != nil {
+		return errToStatus(err), err
+	}
+	if req.Perm.Intersect(user.Perm) != req.Perm {
+		return http.StatusForbidden, nil
+	}
+
+	scope := path.Clean("/" + req.Scope)
+	info, err := user.Fs.Stat(scope)
+	if err != nil {
+		return errToStatus(err), err
+	}
+	if !info.IsDir() {
+		return http.StatusBadRequest, nil
+	}
+
+	tok, plain, err := tokens.New(user.ID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	tok.Name = req.Name
+	tok.Perm = req.Perm
+	tok.Scope = scope
+	tok.Expire = req.Expire
+	if err := d.store.Tokens.Save(tok); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	tok.Hash = ""
+	return renderJSON(w, r, tokenCreated{Token: tok, Secret: plain})
+})
+
+var tokenDeleteHandler = withSelfOrAdmin(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	tok, err := d.store.Tokens.Get(mux.Vars(r)["token"])
+	if err != nil {
+		return errToStatus(err), err
+	}
+	if tok.UserID != d.raw.(uint) {
+		return http.StatusNotFound, nil
+	}
+
+	if err := d.store.Tokens.Delete(tok.ID); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusNoContent, nil
+})
@@ -0,0 +1,138 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/tokens"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestAPITokens(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	user, err := st.Users.Get("", uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Perm = users.Permissions{Create: true, Modify: true, Download: true, Share: true}
+	if err := st.Users.Update(user, "Perm"); err != nil {
+		t.Fatal(err)
+	}
+	jwt := issueToken(t, st)
+
+	root := t.TempDir()
+	for _, name := range []string{"docs/a.txt", "other/b.txt"} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), []byte("content"), 0644); err != nil { //nolint:gosec
+			t.Fatal(err)
+		}
+	}
+	server := &settings.Server{Root: root}
+
+	serve := func(fn handleFunc, method, target, auth string, vars map[string]string, body interface{}) *httptest.ResponseRecorder {
+		t.Helper()
+
+		var encoded []byte
+		if body != nil {
+			encoded, _ = json.Marshal(body)
+		}
+		r := httptest.NewRequest(method, target, bytes.NewReader(encoded))
+		if strings.HasPrefix(auth, tokens.Prefix) {
+			r.Header.Set("Authorization", "Bearer "+auth)
+		} else {
+			r.Header.Set("X-Auth", auth)
+		}
+		urlVars := map[string]string{"id": "1"}
+		for k, v := range vars {
+			urlVars[k] = v
+		}
+		r = mux.SetURLVars(r, urlVars)
+
+		recorder := httptest.NewRecorder()
+		handle(fn, "", st, server, nil).ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	readOnly := tokenRequest{Name: "ci", Perm: users.Permissions{Download: true}, Scope: "docs"}
+	res := serve(tokenPostHandler, http.MethodPost, "/", jwt, nil, readOnly)
+	var created tokenCreated
+	if err := json.Unmarshal(res.Body.Bytes(), &created); err != nil || res.Code != http.StatusOK || created.Secret == "" {
+		t.Fatalf("expected the token to be created, got %d: %s", res.Code, res.Body)
+	}
+	if created.Scope != "/docs" {
+		t.Errorf("expected the scope to be cleaned, got %q", created.Scope)
+	}
+	stored, err := st.Tokens.Get(created.ID)
+	if err != nil || stored.Hash == "" || strings.Contains(res.Body.String(), stored.Hash) {
+		t.Errorf("expected only the hash of the token to be kept, got %v", err)
+	}
+
+	if res := serve(tokenPostHandler, http.MethodPost, "/", jwt, nil, tokenRequest{Name: "admin", Perm: users.Permissions{Admin: true}}); res.Code != http.StatusForbidden {
+		t.Errorf("expected the permissions the user lacks to be refused, got %d", res.Code)
+	}
+
+	// the token grants its permissions on its scope only
+	secret := created.Secret
+	if res := serve(resourceGetHandler(nil), http.MethodGet, "/docs/a.txt", secret, nil, nil); res.Code != http.StatusOK {
+		t.Errorf("expected the file of the scope to be read, got %d", res.Code)
+	}
+	if res := serve(resourceGetHandler(nil), http.MethodGet, "/other/b.txt", secret, nil, nil); res.Code != http.StatusForbidden {
+		t.Errorf("expected the file out of the scope to be refused, got %d", res.Code)
+	}
+	if res := serve(resourcePutHandler, http.MethodPut, "/docs/a.txt", secret, nil, "changed"); res.Code != http.StatusForbidden {
+		t.Errorf("expected the token not to modify the file, got %d", res.Code)
+	}
+	if res := serve(resourceGetHandler(nil), http.MethodGet, "/docs/a.txt", secret[:len(secret)-1]+"x", nil, nil); res.Code != http.StatusUnauthorized {
+		t.Errorf("expected a wrong secret to be refused, got %d", res.Code)
+	}
+
+	// the shares and the trash don't escape the scope
+	res = serve(tokenPostHandler, http.MethodPost, "/", jwt, nil, tokenRequest{Name: "share", Perm: users.Permissions{Download: true, Share: true}, Scope: "docs"})
+	var sharing tokenCreated
+	if err := json.Unmarshal(res.Body.Bytes(), &sharing); err != nil || res.Code != http.StatusOK {
+		t.Fatalf("expected the token to be created, got %d: %s", res.Code, res.Body)
+	}
+	if res := serve(sharePostHandler, http.MethodPost, "/other/b.txt", sharing.Secret, nil, struct{}{}); res.Code != http.StatusForbidden {
+		t.Errorf("expected the file out of the scope not to be shared, got %d", res.Code)
+	}
+	if res := serve(sharePostHandler, http.MethodPost, "/docs/a.txt", sharing.Secret, nil, struct{}{}); res.Code != http.StatusOK {
+		t.Errorf("expected the file of the scope to be shared, got %d", res.Code)
+	}
+	if res := serve(trashGetHandler, http.MethodGet, "/", sharing.Secret, nil, nil); res.Code != http.StatusForbidden {
+		t.Errorf("expected the trash not to be listed, got %d", res.Code)
+	}
+
+	// the tokens don't manage the credentials
+	if res := serve(tokenPostHandler, http.MethodPost, "/", secret, nil, readOnly); res.Code != http.StatusForbidden {
+		t.Errorf("expected the token not to create tokens, got %d", res.Code)
+	}
+	if res := serve(renewHandler(DefaultTokenExpirationTime), http.MethodPost, "/", secret, nil, nil); res.Code != http.StatusForbidden {
+		t.Errorf("expected the token not to be renewed as a session, got %d", res.Code)
+	}
+
+	res = serve(tokensGetHandler, http.MethodGet, "/", jwt, nil, nil)
+	var list []*tokens.Token
+	if err := json.Unmarshal(res.Body.Bytes(), &list); err != nil || len(list) != 2 || list[0].LastUsed == 0 {
+		t.Fatalf("expected the token to be listed as used, got %d: %s", res.Code, res.Body)
+	}
+
+	if res := serve(tokenDeleteHandler, http.MethodDelete, "/", jwt, map[string]string{"token": created.ID}, nil); res.Code != http.StatusNoContent {
+		t.Errorf("expected the token to be revoked, got %d", res.Code)
+	}
+	if res := serve(resourceGetHandler(nil), http.MethodGet, "/docs/a.txt", secret, nil, nil); res.Code != http.StatusUnauthorized {
+		t.Errorf("expected the revoked token to be refused, got %d", res.Code)
+	}
+}
@@ -0,0 +1,148 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/filebrowser/filebrowser/v2/auth"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+type totpStatus struct {
+	Enabled       bool `json:"enabled"`
+	Enforced      bool `json:"enforced"`
+	RecoveryCodes int  `json:"recoveryCodes"`
+}
+
+type totpBody struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// withTOTP only lets the request through when the users log in with the
+// json auth, the one with a second factor.
+func withTOTP(fn handleFunc) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		if d.settings.AuthMethod != auth.MethodJSONAuth {
+			return http.StatusMethodNotAllowed, nil
+		}
+
+		return fn(w, r, d)
+	}
+}
+
+func getTOTPBody(r *http.Request) (*totpBody, error) {
+	body := &totpBody{}
+	if r.Body == nil {
+		return body, nil
+	}
+
+	err := json.NewDecoder(r.Body).Decode(body)
+	if errors.Is(err, io.EOF) {
+		return body, nil
+	}
+	return body, err
+}
+
+var totpGetHandler = withSessionUser(withTOTP(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	return renderJSON(w, r, totpStatus{
+		Enabled:       d.user.TOTP.Enabled,
+		Enforced:      d.settings.EnforceTOTP,
+		RecoveryCodes: len(d.user.TOTP.RecoveryCodes),
+	})
+}))
+
+var totpPostHandler = withSessionUser(withTOTP(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	return enrollTOTP(w, r, d, d.user)
+}))
+
+// totpLoginHandler enrolls the users who must set up their second factor
+// before they can log in, checking their password instead of a token.
+var totpLoginHandler = withTOTP(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	body, err := getTOTPBody(r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	u, err := d.store.Users.Get(d.server.Root, body.Username)
+	if err != nil || !users.CheckPwd(body.Password, u.Password) {
+		return http.StatusForbidden, nil
+	}
+
+	if !d.settings.EnforceTOTP {
+		return http.StatusMethodNotAllowed, nil
+	}
+
+	return enrollTOTP(w, r, d, u)
+})
+
+func enrollTOTP(w http.ResponseWriter, r *http.Request, d *data, u *users.User) (int, error) {
+	if u.TOTP.Enabled {
+		return http.StatusConflict, nil
+	}
+
+	enrollment, err := auth.EnrollTOTP(u, d.store.Users, d.settings)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return renderJSON(w, r, enrollment)
+}
+
+var totpPutHandler = withSessionUser(withTOTP(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	body, err := getTOTPBody(r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if d.user.TOTP.Enabled {
+		return http.StatusConflict, nil
+	}
+
+	err = auth.ConfirmTOTP(d.user, d.store.Users, d.settings, body.Code)
+	switch {
+	case errors.Is(err, os.ErrPermission):
+		return http.StatusForbidden, nil
+	case errors.Is(err, auth.ErrTOTPEnrollment):
+		return http.StatusBadRequest, nil
+	case err != nil:
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}))
+
+var totpDeleteHandler = withSessionUser(withTOTP(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	if d.settings.EnforceTOTP {
+		return http.StatusForbidden, nil
+	}
+
+	if !d.user.TOTP.Enabled {
+		return http.StatusNotFound, nil
+	}
+
+	body, err := getTOTPBody(r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	// removing the second factor needs it, so that a stolen session can't
+	err = auth.CheckTOTP(d.user, d.store.Users, d.settings, body.Code)
+	switch {
+	case errors.Is(err, os.ErrPermission), errors.Is(err, auth.ErrTOTPRequired):
+		return http.StatusForbidden, nil
+	case err != nil:
+		return http.StatusInternalServerError, err
+	}
+
+	d.user.TOTP = users.TOTP{}
+	if err := d.store.Users.Update(d.user, "TOTP"); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}))
@@ -0,0 +1,256 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/files"
+	"github.com/filebrowser/filebrowser/v2/fileutils"
+	"github.com/filebrowser/filebrowser/v2/runner"
+	"github.com/filebrowser/filebrowser/v2/s3fs"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// The ways a transfer handles a destination that already exists. Without
+// any, it fails with a conflict.
+const (
+	conflictRename    = "rename"
+	conflictOverwrite = "overwrite"
+	conflictSkip      = "skip"
+)
+
+// transferLocation is a path in the scope of a user, the one of the request
+// if its ID is zero.
+type transferLocation struct {
+	User uint   `json:"user"`
+	Path string `json:"path"`
+}
+
+type transferRequest struct {
+	// Action is copy or move.
+	Action   string           `json:"action"`
+	From     transferLocation `json:"from"`
+	To       transferLocation `json:"to"`
+	Conflict string           `json:"conflict"`
+}
+
+type transferResult struct {
+	// Path is the destination, renamed if it existed and the conflicts
+	// are renamed.
+	Path    string `json:"path"`
+	Skipped bool   `json:"skipped"`
+}
+
+// transferUser returns the user of the scope of a location, checking that
+// the user of the request can read it, or write to it. The users can reach
+// their own scopes, the folders the other users share with them and, for
+// the admins, all the scopes. The permissions and the rules of both users
+// apply, and the versions and the trash are left to their own handlers. The
+// API tokens only reach the files of their scope, and the other scopes only
+// if they aren't narrower than the one of the user.
+func transferUser(d *data, loc transferLocation, write bool) (*users.User, error) {
+	user := d.user
+	if loc.User != 0 && loc.User != d.user.ID {
+		var err error
+		user, err = d.store.Users.Get(d.server.Root, loc.User)
+		switch {
+		case errors.Is(err, fbErrors.ErrNotExist) && !d.user.Perm.Admin:
+			// the other users can't be told apart from the missing ones
+			return nil, fbErrors.ErrPermissionDenied
+		case err != nil:
+			return nil, err
+		case !d.user.Perm.Admin && !user.SharedWith(d.user.ID, path.Dir(loc.Path), write):
+			// the shared folders themselves are left to their owners
+			return nil, fbErrors.ErrPermissionDenied
+		}
+		d.restrictReadOnly(user)
+	}
+
+	if loc.Path == "/" || isVersionPath(loc.Path) || isTrashPath(loc.Path) ||
+		!evaluateRules(loc.Path, user.HideDotfiles, d.settings.Rules, user.Rules).Allowed ||
+		!d.Check(loc.Path) || user != d.user && !d.unscoped() {
+		return nil, fbErrors.ErrPermissionDenied
+	}
+	// the paths are cleaned from the root, so only the links lead out
+	if !runner.InsideScope(user, user.FullPath(loc.Path)) {
+		return nil, fbErrors.ErrPermissionDenied
+	}
+	return user, nil
+}
+
+// transferHandler copies or moves a file or a directory between the scopes
+// of two users, running the copy or move hooks of the source user with the
+// paths in both scopes. The source must be readable, and deletable for the
+// moves, and the destination must be creatable, and modifiable to be
+// overwritten, by both the user of the request and the one of the scope.
+func transferHandler(fileCache FileCache) handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		var req transferRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return http.StatusBadRequest, err
+		}
+		if req.Action != "copy" && req.Action != "move" {
+			return http.StatusBadRequest, fbErrors.ErrInvalidRequestParams
+		}
+		switch req.Conflict {
+		case "", conflictRename, conflictOverwrite, conflictSkip:
+		default:
+			return http.StatusBadRequest, fbErrors.ErrInvalidRequestParams
+		}
+		req.From.Path = path.Clean("/" + req.From.Path)
+		req.To.Path = path.Clean("/" + req.To.Path)
+
+		// the moves remove the sources, so they need to be writable too
+		src, err := transferUser(d, req.From, req.Action == "move")
+		if err != nil {
+			return errToStatus(err), err
+		}
+		dst, err := transferUser(d, req.To, true)
+		if err != nil {
+			return errToStatus(err), err
+		}
+		if src.ID == dst.ID && within(req.To.Path, req.From.Path) {
+			// a directory can't go inside itself, nor a file replace itself
+			return http.StatusBadRequest, fbErrors.ErrInvalidRequestParams
+		}
+
+		can := func(perm func(users.Permissions) bool, owners ...*users.User) bool {
+			for _, u := range append(owners, d.user) {
+				if !perm(u.Perm) {
+					return false
+				}
+			}
+			return true
+		}
+		if !can(func(p users.Permissions) bool { return p.Download }, src) ||
+			req.Action == "move" && !can(func(p users.Permissions) bool { return p.Delete }, src) ||
+			!can(func(p users.Permissions) bool { return p.Create }, dst) {
+			return http.StatusForbidden, nil
+		}
+
+		info, err := src.Fs.Stat(req.From.Path)
+		if err != nil {
+			return errToStatus(err), err
+		}
+
+		result := transferResult{Path: req.To.Path}
+		existing, err := dst.Fs.Stat(req.To.Path)
+		if err == nil {
+			switch req.Conflict {
+			case conflictSkip:
+				result.Skipped = true
+				return renderJSON(w, r, result)
+			case conflictRename:
+				result.Path = addVersionSuffix(req.To.Path, dst.Fs)
+				existing = nil
+			case conflictOverwrite:
+				if !can(func(p users.Permissions) bool { return p.Modify }, dst) {
+					return http.StatusForbidden, nil
+				}
+			default:
+				return http.StatusConflict, nil
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return errToStatus(err), err
+		}
+
+		if err := checkTransferQuota(src, req.From.Path, dst, result.Path, existing, req.Action == "move"); err != nil {
+			return errToStatus(err), err
+		}
+
+		err = d.RunHookTransfer(r.Context(), func() error {
+			defer quotaUsage.forget(src.ID)
+			defer quotaUsage.forget(dst.ID)
+
+			if existing != nil {
+				if err := replaceTransferred(r, fileCache, dst, result.Path, existing); err != nil {
+					return err
+				}
+			}
+			if req.Action == "copy" {
+				return fileutils.CopyBetween(src.Fs, req.From.Path, dst.Fs, result.Path)
+			}
+
+			if !info.IsDir() {
+				_ = delThumbs(r.Context(), fileCache, transferFileInfo(src, req.From.Path, info))
+			}
+			return moveBetween(d, src, req.From.Path, dst, result.Path)
+		}, req.Action, req.From.Path, src, result.Path, dst)
+		if err != nil {
+			return errToStatus(err), err
+		}
+
+		d.Notify("after_upload", result.Path, "", dst)
+		if req.Action == "move" {
+			d.Notify("after_delete", req.From.Path, "", src)
+		}
+		return renderJSON(w, r, result)
+	})
+}
+
+// checkTransferQuota checks that the files fit in the quota of the user of
+// the destination, once the one they replace is freed. A move in the same
+// scope needs no space.
+func checkTransferQuota(src *users.User, from string, dst *users.User, to string, existing os.FileInfo, move bool) error {
+	if dst.Quota <= 0 || move && src.ID == dst.ID {
+		return nil
+	}
+
+	needed, err := scopeUsage(src.Fs, from)
+	if err != nil {
+		return err
+	}
+	var freed int64
+	if existing != nil {
+		if freed, err = scopeUsage(dst.Fs, to); err != nil {
+			return err
+		}
+	}
+	return checkQuota(dst, needed, freed)
+}
+
+// replaceTransferred removes the destination a transfer overwrites, keeping
+// a version of it if it's a file.
+func replaceTransferred(r *http.Request, fileCache FileCache, user *users.User, p string, existing os.FileInfo) error {
+	if err := snapshotVersion(user, p); err != nil {
+		return err
+	}
+	if !existing.IsDir() {
+		if err := delThumbs(r.Context(), fileCache, transferFileInfo(user, p, existing)); err != nil {
+			return err
+		}
+	}
+	return user.Fs.RemoveAll(p)
+}
+
+func transferFileInfo(user *users.User, p string, info os.FileInfo) *files.FileInfo {
+	return &files.FileInfo{
+		Fs:        user.Fs,
+		Path:      p,
+		Name:      info.Name(),
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		Extension: path.Ext(p),
+	}
+}
+
+// moveBetween moves files between two scopes, renaming them when they're
+// on the local disk and copying them otherwise.
+func moveBetween(d *data, src *users.User, from string, dst *users.User, to string) error {
+	if err := dst.Fs.MkdirAll(path.Dir(to), files.PermDir); err != nil {
+		return err
+	}
+	if !s3fs.IsURL(d.server.Root) && os.Rename(src.FullPath(from), dst.FullPath(to)) == nil {
+		return nil
+	}
+
+	if err := fileutils.CopyBetween(src.Fs, from, dst.Fs, to); err != nil {
+		_ = dst.Fs.RemoveAll(to)
+		return err
+	}
+	return src.Fs.RemoveAll(from)
+}
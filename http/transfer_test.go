@@ -0,0 +1,181 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/asdine/storm/v3"
+	"github.com/gorilla/mux"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/storage/bolt"
+	"github.com/filebrowser/filebrowser/v2/tokens"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestTransferHandler(t *testing.T) {
+	t.Parallel()
+
+	db, err := storm.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	st, err := bolt.NewStorage(db)
+	if err != nil {
+		t.Fatalf("failed to get storage: %v", err)
+	}
+	if err := st.Settings.Save(&settings.Settings{Key: []byte("key")}); err != nil {
+		t.Fatalf("failed to save settings: %v", err)
+	}
+
+	perm := users.Permissions{Create: true, Modify: true, Delete: true, Download: true}
+	alice := &users.User{Username: "alice", Password: "pw", Scope: "/alice", Perm: perm}
+	bob := &users.User{Username: "bob", Password: "pw", Scope: "/bob", Perm: perm,
+		SharedFolders: []users.SharedFolder{{Path: "/shared", Users: []uint{1}, Write: true}, {Path: "/read", Users: []uint{1}},
+			{Path: trashDir, Users: []uint{1}, Write: true}}}
+	carol := &users.User{Username: "carol", Password: "pw", Scope: "/carol", Perm: perm}
+	for _, u := range []*users.User{alice, bob, carol} {
+		if err := st.Users.Save(u); err != nil {
+			t.Fatalf("failed to save user: %v", err)
+		}
+	}
+
+	root := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil {
+			return ""
+		}
+		return string(content)
+	}
+	write("/alice/a.txt", "a")
+	write("/alice/dir/b.txt", "b")
+	write("/bob/shared/a.txt", "old")
+	write("/bob/read/r.txt", "r")
+	write("/bob/.trash/t.txt", "t")
+	write("/carol/c.txt", "c")
+
+	token := issueToken(t, st)
+	serveAs := func(auth string, req transferRequest) (int, transferResult) {
+		t.Helper()
+
+		body, _ := json.Marshal(req)
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		if strings.HasPrefix(auth, tokens.Prefix) {
+			r.Header.Set("Authorization", "Bearer "+auth)
+		} else {
+			r.Header.Set("X-Auth", auth)
+		}
+
+		recorder := httptest.NewRecorder()
+		handle(transferHandler(&memoryCache{values: map[string][]byte{}}), "", st, &settings.Server{Root: root}, nil).ServeHTTP(recorder, r)
+
+		var result transferResult
+		_ = json.Unmarshal(recorder.Body.Bytes(), &result)
+		return recorder.Code, result
+	}
+	serve := func(req transferRequest) (int, transferResult) {
+		t.Helper()
+		return serveAs(token, req)
+	}
+	to := func(p string) transferLocation { return transferLocation{User: bob.ID, Path: p} }
+
+	// the folders not shared, or shared to be read, can't be written to
+	for _, req := range []transferRequest{
+		{Action: "copy", From: transferLocation{Path: "/a.txt"}, To: transferLocation{User: carol.ID, Path: "/a.txt"}},
+		{Action: "copy", From: transferLocation{Path: "/a.txt"}, To: transferLocation{User: 42, Path: "/a.txt"}},
+		{Action: "copy", From: transferLocation{Path: "/a.txt"}, To: to("/a.txt")},
+		{Action: "copy", From: transferLocation{Path: "/a.txt"}, To: to("/read/a.txt")},
+		{Action: "copy", From: transferLocation{Path: "/a.txt"}, To: to("/shared/../a.txt")},
+		{Action: "move", From: to("/shared"), To: transferLocation{Path: "/shared"}},
+		{Action: "copy", From: transferLocation{User: carol.ID, Path: "/c.txt"}, To: transferLocation{Path: "/c.txt"}},
+		{Action: "copy", From: transferLocation{Path: "/a.txt"}, To: transferLocation{Path: trashDir + "/a.txt"}},
+		{Action: "copy", From: to(trashDir + "/t.txt"), To: transferLocation{Path: "/t.txt"}},
+		{Action: "copy", From: transferLocation{Path: "/a.txt"}, To: to(trashDir + "/a.txt")},
+	} {
+		if code, _ := serve(req); code != http.StatusForbidden {
+			t.Errorf("expected %+v to be forbidden, got %d", req, code)
+		}
+	}
+	if read("/bob/a.txt") != "" || read("/alice/c.txt") != "" {
+		t.Fatal("expected nothing to be copied")
+	}
+
+	// the API tokens stay in their scope
+	body, _ := json.Marshal(tokenRequest{Name: "dir", Perm: perm, Scope: "dir"})
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	r.Header.Set("X-Auth", token)
+	r = mux.SetURLVars(r, map[string]string{"id": strconv.FormatUint(uint64(alice.ID), 10)})
+	recorder := httptest.NewRecorder()
+	handle(tokenPostHandler, "", st, &settings.Server{Root: root}, nil).ServeHTTP(recorder, r)
+	var scoped tokenCreated
+	if err := json.Unmarshal(recorder.Body.Bytes(), &scoped); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("expected the token to be created, got %d: %s", recorder.Code, recorder.Body)
+	}
+	for _, req := range []transferRequest{
+		{Action: "copy", From: transferLocation{Path: "/a.txt"}, To: transferLocation{Path: "/dir/a.txt"}},
+		{Action: "copy", From: transferLocation{Path: "/dir/b.txt"}, To: to("/shared/b.txt")},
+		{Action: "copy", From: to("/shared/a.txt"), To: transferLocation{Path: "/dir/a.txt"}},
+	} {
+		if code, _ := serveAs(scoped.Secret, req); code != http.StatusForbidden {
+			t.Errorf("expected %+v to be forbidden to the scoped token, got %d", req, code)
+		}
+	}
+	req := transferRequest{Action: "copy", From: transferLocation{Path: "/dir/b.txt"}, To: transferLocation{Path: "/dir/c.txt"}}
+	if code, _ := serveAs(scoped.Secret, req); code != http.StatusOK || read("/alice/dir/c.txt") != "b" {
+		t.Errorf("expected the copy in the scope of the token, got %d", code)
+	}
+
+	// the existing files conflict unless told how to handle them
+	req = transferRequest{Action: "copy", From: transferLocation{Path: "/a.txt"}, To: to("/shared/a.txt")}
+	if code, _ := serve(req); code != http.StatusConflict {
+		t.Errorf("expected a conflict, got %d", code)
+	}
+	req.Conflict = conflictSkip
+	if code, result := serve(req); code != http.StatusOK || !result.Skipped || read("/bob/shared/a.txt") != "old" {
+		t.Errorf("expected the copy to be skipped, got %d and %+v", code, result)
+	}
+	req.Conflict = conflictRename
+	if code, result := serve(req); code != http.StatusOK || result.Path != "/shared/a(1).txt" || read("/bob/shared/a(1).txt") != "a" {
+		t.Errorf("expected the copy to be renamed, got %d and %+v", code, result)
+	}
+	req.Conflict = conflictOverwrite
+	if code, _ := serve(req); code != http.StatusOK || read("/bob/shared/a.txt") != "a" || read("/alice/a.txt") != "a" {
+		t.Errorf("expected the file to be overwritten, got %d", code)
+	}
+
+	// the shared files can be taken back, unless they're only shared to be
+	// read, and the directories moved
+	req = transferRequest{Action: "move", From: to("/read/r.txt"), To: transferLocation{Path: "/r.txt"}}
+	if code, _ := serve(req); code != http.StatusForbidden || read("/bob/read/r.txt") != "r" {
+		t.Errorf("expected the read-only file not to be moved, got %d", code)
+	}
+	req = transferRequest{Action: "move", From: to("/shared/a(1).txt"), To: transferLocation{Path: "/r.txt"}}
+	if code, _ := serve(req); code != http.StatusOK || read("/alice/r.txt") != "a" || read("/bob/shared/a(1).txt") != "" {
+		t.Errorf("expected the file to be moved, got %d", code)
+	}
+	req = transferRequest{Action: "move", From: transferLocation{Path: "/dir"}, To: to("/shared/dir")}
+	if code, _ := serve(req); code != http.StatusOK || read("/bob/shared/dir/b.txt") != "b" || read("/alice/dir/b.txt") != "" {
+		t.Errorf("expected the directory to be moved, got %d", code)
+	}
+}
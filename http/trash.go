@@ -0,0 +1,281 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/afero"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/files"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// trashDir is the directory of the scopes the deleted files are moved to,
+// each in a directory of its ID next to the JSON file of its trashItem. Like
+// the versions, it's denied by the rules.
+const trashDir = "/.trash"
+
+// trashItem is a file or a directory in the trash.
+type trashItem struct {
+	ID string `json:"id"`
+	// Path is where it was deleted from, and is restored to.
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	IsDir   bool      `json:"isDir"`
+	Deleted time.Time `json:"deleted"`
+}
+
+// isTrashPath tells if a path is in the trash.
+func isTrashPath(p string) bool {
+	p = path.Clean("/" + p)
+	return p == trashDir || strings.HasPrefix(p, trashDir+"/")
+}
+
+// validTrashID tells if an ID is one of the trash, the time the file was
+// deleted at followed by a counter if several were deleted at once.
+func validTrashID(id string) bool {
+	taken, n, found := strings.Cut(id, "-")
+	if _, err := time.Parse(versionIDFormat, taken); err != nil {
+		return false
+	}
+	if found {
+		if _, err := strconv.ParseUint(n, 10, 32); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// trashFile moves a file or a directory to the trash, and purges the files
+// deleted past the retention. The trash is in the scope, so the trashed
+// files keep counting in the quota until they're purged.
+func trashFile(user *users.User, p string, now time.Time) error {
+	info, err := user.Fs.Stat(p)
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if info.IsDir() {
+		if size, err = scopeUsage(user.Fs, p); err != nil {
+			return err
+		}
+	}
+
+	if err := user.Fs.MkdirAll(trashDir, files.PermDir); err != nil {
+		return err
+	}
+	id := now.UTC().Format(versionIDFormat)
+	for i := 1; ; i++ {
+		if _, err := user.Fs.Stat(path.Join(trashDir, id)); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		id = now.UTC().Format(versionIDFormat) + "-" + strconv.Itoa(i)
+	}
+
+	item := trashItem{ID: id, Path: p, Size: size, IsDir: info.IsDir(), Deleted: now.UTC()}
+	meta, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if err := user.Fs.Mkdir(path.Join(trashDir, id), files.PermDir); err != nil {
+		return err
+	}
+	if err := afero.WriteFile(user.Fs, path.Join(trashDir, id+".json"), meta, files.PermFile); err != nil {
+		return err
+	}
+	if err := user.Fs.Rename(p, path.Join(trashDir, id, path.Base(p))); err != nil {
+		_ = removeTrashItem(user.Fs, id)
+		return err
+	}
+	return purgeTrash(user.Fs, user.Trash, now)
+}
+
+// listTrash returns the items of the trash, the last deleted first. The
+// ones whose metadata is missing are left for the purges.
+func listTrash(fs afero.Fs) ([]trashItem, error) {
+	infos, err := afero.ReadDir(fs, trashDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []trashItem{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]trashItem, 0, len(infos))
+	for _, info := range infos {
+		id, ok := strings.CutSuffix(info.Name(), ".json")
+		if !ok || !validTrashID(id) || info.IsDir() {
+			continue
+		}
+		item, err := getTrashItem(fs, id)
+		if err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Deleted.After(items[j].Deleted) })
+	return items, nil
+}
+
+func getTrashItem(fs afero.Fs, id string) (trashItem, error) {
+	var item trashItem
+	meta, err := afero.ReadFile(fs, path.Join(trashDir, id+".json"))
+	if err != nil {
+		return item, err
+	}
+	if err := json.Unmarshal(meta, &item); err != nil {
+		return item, err
+	}
+	item.ID = id
+	return item, nil
+}
+
+func removeTrashItem(fs afero.Fs, id string) error {
+	if err := fs.RemoveAll(path.Join(trashDir, id)); err != nil {
+		return err
+	}
+	err := fs.Remove(path.Join(trashDir, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// purgeTrash removes the items deleted longer ago than the days of the
+// trash.
+func purgeTrash(fs afero.Fs, trash users.Trash, now time.Time) error {
+	if trash.Days <= 0 {
+		return nil
+	}
+
+	items, err := listTrash(fs)
+	if err != nil {
+		return err
+	}
+	oldest := now.AddDate(0, 0, -trash.Days)
+	for _, item := range items {
+		if !item.Deleted.Before(oldest) {
+			continue
+		}
+		if err := removeTrashItem(fs, item.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trashGetHandler lists the trash, once the expired items are purged.
+var trashGetHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	// the trash has the files of the whole scope
+	if !d.unscoped() {
+		return http.StatusForbidden, nil
+	}
+	if err := purgeTrash(d.user.Fs, d.user.Trash, time.Now()); err != nil {
+		return errToStatus(err), err
+	}
+	quotaUsage.forget(d.user.ID)
+
+	items, err := listTrash(d.user.Fs)
+	if err != nil {
+		return errToStatus(err), err
+	}
+	return renderJSON(w, r, items)
+})
+
+// trashRestoreHandler puts an item of the trash back where it was deleted
+// from, running the restore hooks. An existing file there is a conflict,
+// unless it's overridden or the item restored under another name with the
+// override and rename queries.
+func trashRestoreHandler(fileCache FileCache) handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		id := mux.Vars(r)["id"]
+		if !validTrashID(id) {
+			return http.StatusBadRequest, fbErrors.ErrInvalidRequestParams
+		}
+		if !d.user.Perm.Create {
+			return http.StatusForbidden, nil
+		}
+		item, err := getTrashItem(d.user.Fs, id)
+		if err != nil {
+			return errToStatus(err), err
+		}
+
+		dst := path.Clean("/" + item.Path)
+		if dst == "/" || !d.Check(dst) {
+			return http.StatusForbidden, nil
+		}
+
+		override := r.URL.Query().Get("override") == "true"
+		existing, err := d.user.Fs.Stat(dst)
+		switch {
+		case err == nil && r.URL.Query().Get("rename") == "true":
+			dst = addVersionSuffix(dst, d.user.Fs)
+			existing = nil
+		case err == nil && !override:
+			return http.StatusConflict, nil
+		case err == nil && !d.user.Perm.Modify:
+			return http.StatusForbidden, nil
+		case err != nil && !errors.Is(err, os.ErrNotExist):
+			return errToStatus(err), err
+		}
+
+		err = d.RunHook(r.Context(), func() error {
+			if existing != nil {
+				if err := replaceTransferred(r, fileCache, d.user, dst, existing); err != nil {
+					return err
+				}
+			}
+			if err := d.user.Fs.MkdirAll(path.Dir(dst), files.PermDir); err != nil {
+				return err
+			}
+			if err := d.user.Fs.Rename(path.Join(trashDir, id, path.Base(item.Path)), dst); err != nil {
+				return err
+			}
+			return removeTrashItem(d.user.Fs, id)
+		}, "restore", dst, "", d.user)
+		if err != nil {
+			return errToStatus(err), err
+		}
+
+		item.Path = dst
+		return renderJSON(w, r, item)
+	})
+}
+
+// trashDeleteHandler purges an item of the trash for good, or all of them
+// without an ID.
+var trashDeleteHandler = withUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	if !d.user.Perm.Delete || !d.unscoped() {
+		return http.StatusForbidden, nil
+	}
+	defer quotaUsage.forget(d.user.ID)
+
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		err := d.user.Fs.RemoveAll(trashDir)
+		if err != nil {
+			return errToStatus(err), err
+		}
+		return http.StatusNoContent, nil
+	}
+
+	if !validTrashID(id) {
+		return http.StatusBadRequest, fbErrors.ErrInvalidRequestParams
+	}
+	if _, err := d.user.Fs.Stat(path.Join(trashDir, id)); err != nil {
+		return errToStatus(err), err
+	}
+	if err := removeTrashItem(d.user.Fs, id); err != nil {
+		return errToStatus(err), err
+	}
+	return http.StatusNoContent, nil
+})
@@ -0,0 +1,139 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestTrashHandlers(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	user, err := st.Users.Get("", uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Perm = users.Permissions{Create: true, Modify: true, Delete: true}
+	user.Trash = users.Trash{Enabled: true}
+	if err := st.Users.Update(user, "Perm", "Trash"); err != nil {
+		t.Fatal(err)
+	}
+	token := issueToken(t, st)
+
+	root := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		content, _ := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+		return string(content)
+	}
+	serve := func(fn handleFunc, method, target string, vars map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(method, target, nil)
+		r.Header.Set("X-Auth", token)
+		r = mux.SetURLVars(r, vars)
+
+		recorder := httptest.NewRecorder()
+		handle(fn, "", st, &settings.Server{Root: root}, nil).ServeHTTP(recorder, r)
+		return recorder
+	}
+	list := func() []trashItem {
+		t.Helper()
+
+		var items []trashItem
+		rec := serve(trashGetHandler, http.MethodGet, "/", nil)
+		if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil {
+			t.Fatalf("failed to list the trash: %d %v", rec.Code, err)
+		}
+		return items
+	}
+	cache := &memoryCache{values: map[string][]byte{}}
+
+	write("/a.txt", "a")
+	write("/dir/b.txt", "b")
+	for _, p := range []string{"/a.txt", "/dir"} {
+		if rec := serve(resourceDeleteHandler(cache), http.MethodDelete, p, nil); rec.Code != http.StatusNoContent {
+			t.Fatalf("expected %s to be trashed, got %d", p, rec.Code)
+		}
+	}
+	items := list()
+	if len(items) != 2 || items[0].Path != "/dir" || !items[0].IsDir || items[1].Path != "/a.txt" || items[1].Size != 1 {
+		t.Fatalf("expected the two deleted files in the trash, got %+v", items)
+	}
+	if read("/a.txt") != "" || read("/.trash/"+items[1].ID+"/a.txt") != "a" {
+		t.Fatal("expected the file to be moved to the trash")
+	}
+
+	// the trash is only reached through its endpoints
+	if rec := serve(resourceGetHandler(nil), http.MethodGet, "/.trash", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("expected the trash to be forbidden, got %d", rec.Code)
+	}
+
+	// the restores don't replace the files created since unless told to
+	write("/a.txt", "new")
+	vars := map[string]string{"id": items[1].ID}
+	if rec := serve(trashRestoreHandler(cache), http.MethodPost, "/", vars); rec.Code != http.StatusConflict {
+		t.Errorf("expected a conflict, got %d", rec.Code)
+	}
+	if rec := serve(trashRestoreHandler(cache), http.MethodPost, "/?rename=true", vars); rec.Code != http.StatusOK || read("/a(1).txt") != "a" || read("/a.txt") != "new" {
+		t.Errorf("expected the file to be restored next to the new one, got %d", rec.Code)
+	}
+
+	if rec := serve(trashDeleteHandler, http.MethodDelete, "/", map[string]string{"id": items[0].ID}); rec.Code != http.StatusNoContent {
+		t.Errorf("expected the directory to be purged, got %d", rec.Code)
+	}
+	if items := list(); len(items) != 0 {
+		t.Errorf("expected the trash to be empty, got %+v", items)
+	}
+	if rec := serve(trashDeleteHandler, http.MethodDelete, "/", map[string]string{"id": "../a.txt"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid ID to be refused, got %d", rec.Code)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	t.Parallel()
+
+	user := &users.User{ID: 1, Fs: afero.NewMemMapFs(), Trash: users.Trash{Enabled: true, Days: 1}}
+	now := time.Now()
+	for i, name := range []string{"/a.txt", "/b.txt", "/c.txt"} {
+		if err := afero.WriteFile(user.Fs, name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// the first two are deleted at once, two days ago
+		deleted := now.AddDate(0, 0, -2)
+		if i == 2 {
+			deleted = now
+		}
+		if err := trashFile(user, name, deleted); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, err := listTrash(user.Fs)
+	if err != nil || len(items) != 1 || items[0].Path != "/c.txt" {
+		t.Fatalf("expected only the last deleted file to be kept, got %+v and %v", items, err)
+	}
+	if infos, _ := afero.ReadDir(user.Fs, trashDir); len(infos) != 2 {
+		t.Errorf("expected the purged files to be removed, got %d entries", len(infos))
+	}
+}
@@ -3,25 +3,28 @@ package http
 import (
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 
 	"github.com/spf13/afero"
 
 	"github.com/filebrowser/filebrowser/v2/files"
+	"github.com/filebrowser/filebrowser/v2/s3fs"
 )
 
+const tusVersion = "1.0.0"
+
 func tusPostHandler() handleFunc {
-	return withUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+
 		file, err := files.NewFileInfo(&files.FileOptions{
 			Fs:         d.user.Fs,
 			Path:       r.URL.Path,
 			Modify:     d.user.Perm.Modify,
 			Expand:     false,
 			ReadHeader: d.server.TypeDetectionByHeader,
+			MimeTypes:  d.settings.MimeTypes,
 			Checker:    d,
 		})
 		switch {
@@ -29,62 +32,113 @@ func tusPostHandler() handleFunc {
 			if !d.user.Perm.Create || !d.Check(r.URL.Path) {
 				return http.StatusForbidden, nil
 			}
-
-			dirPath := filepath.Dir(r.URL.Path)
-			if _, statErr := d.user.Fs.Stat(dirPath); os.IsNotExist(statErr) {
-				if mkdirErr := d.user.Fs.MkdirAll(dirPath, files.PermDir); mkdirErr != nil {
-					return http.StatusInternalServerError, err
-				}
-			}
 		case err != nil:
 			return errToStatus(err), err
 		}
 
-		fileFlags := os.O_CREATE | os.O_WRONLY
-		if r.URL.Query().Get("override") == "true" {
-			fileFlags |= os.O_TRUNC
-		}
+		override := r.URL.Query().Get("override") == "true"
 
 		// if file exists
 		if file != nil {
 			if file.IsDir {
 				return http.StatusBadRequest, fmt.Errorf("cannot upload to a directory %s", file.RealPath())
 			}
+			if !override {
+				return http.StatusConflict, nil
+			}
 		}
 
-		openFile, err := d.user.Fs.OpenFile(r.URL.Path, fileFlags, files.PermFile)
+		length, err := getUploadLength(r)
 		if err != nil {
+			return http.StatusBadRequest, err
+		}
+
+		dir := tusDir(d.server)
+		w.Header().Set("Location", r.URL.String())
+
+		// the same upload is resumed, for example after reloading the page
+		if upload, err := loadTusUpload(dir, d.user.ID, r.URL.Path); err == nil && upload.Length == length && length >= 0 {
+			return http.StatusCreated, nil
+		}
+
+		if err := checkUploadSize(d, length); err != nil {
 			return errToStatus(err), err
 		}
-		if err := openFile.Close(); err != nil {
+		limit, err := tusUploadLimit(d, file, length)
+		if err != nil {
 			return errToStatus(err), err
 		}
 
+		upload := &tusUpload{
+			UserID:   d.user.ID,
+			Path:     r.URL.Path,
+			Length:   length,
+			Override: override,
+			Limit:    limit,
+		}
+		if size := maxUploadSize(d); size > 0 {
+			upload.SizeLimit = size
+		}
+		if err := newTusUpload(dir, upload); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		uploadProgress.done(upload.ID)
+		uploadProgress.track(d.user, upload.Path, length, 0)
+
+		// an empty file won't get any chunk
+		if length == 0 {
+			if status, err := tusFinish(r, d, upload); status >= http.StatusBadRequest {
+				return status, err
+			}
+		}
+
 		return http.StatusCreated, nil
 	})
 }
 
+// tusUploadLimit returns how large an upload can be with the quota of the
+// user, zero meaning no limit.
+func tusUploadLimit(d *data, existing *files.FileInfo, length int64) (int64, error) {
+	// the file being replaced frees its space
+	var freed int64
+	if existing != nil {
+		freed = existing.Size
+	}
+
+	remaining, err := quotaRemaining(d.user, freed)
+	if err != nil || remaining < 0 {
+		return 0, err
+	}
+	if remaining == 0 || length > remaining {
+		return 0, &quotaError{Quota: d.user.Quota, Used: d.user.Quota - remaining, Needed: length}
+	}
+	return remaining, nil
+}
+
 func tusHeadHandler() handleFunc {
 	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Tus-Resumable", tusVersion)
 		if !d.Check(r.URL.Path) {
 			return http.StatusForbidden, nil
 		}
 
-		file, err := files.NewFileInfo(&files.FileOptions{
-			Fs:         d.user.Fs,
-			Path:       r.URL.Path,
-			Modify:     d.user.Perm.Modify,
-			Expand:     false,
-			ReadHeader: d.server.TypeDetectionByHeader,
-			Checker:    d,
-		})
+		upload, err := loadTusUpload(tusDir(d.server), d.user.ID, r.URL.Path)
 		if err != nil {
 			return errToStatus(err), err
 		}
 
-		w.Header().Set("Upload-Offset", strconv.FormatInt(file.Size, 10))
-		w.Header().Set("Upload-Length", "-1")
+		offset, err := upload.offset()
+		if err != nil {
+			return errToStatus(err), err
+		}
+
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		if upload.Length >= 0 {
+			w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+		} else {
+			w.Header().Set("Upload-Defer-Length", "1")
+		}
 
 		return http.StatusOK, nil
 	})
@@ -92,6 +146,7 @@ func tusHeadHandler() handleFunc {
 
 func tusPatchHandler() handleFunc {
 	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		w.Header().Set("Tus-Resumable", tusVersion)
 		if !d.user.Perm.Modify || !d.Check(r.URL.Path) {
 			return http.StatusForbidden, nil
 		}
@@ -104,52 +159,120 @@ func tusPatchHandler() handleFunc {
 			return http.StatusBadRequest, fmt.Errorf("invalid upload offset: %w", err)
 		}
 
-		file, err := files.NewFileInfo(&files.FileOptions{
-			Fs:         d.user.Fs,
-			Path:       r.URL.Path,
-			Modify:     d.user.Perm.Modify,
-			Expand:     false,
-			ReadHeader: d.server.TypeDetectionByHeader,
-			Checker:    d,
-		})
-
-		switch {
-		case errors.Is(err, afero.ErrFileNotFound):
-			return http.StatusNotFound, nil
-		case err != nil:
+		upload, err := loadTusUpload(tusDir(d.server), d.user.ID, r.URL.Path)
+		if err != nil {
 			return errToStatus(err), err
 		}
 
-		switch {
-		case file.IsDir:
-			return http.StatusBadRequest, fmt.Errorf("cannot upload to a directory %s", file.RealPath())
-		case file.Size != uploadOffset:
+		offset, err := upload.offset()
+		if err != nil {
+			return errToStatus(err), err
+		}
+		if offset != uploadOffset {
 			return http.StatusConflict, fmt.Errorf(
-				"%s file size doesn't match the provided offset: %d",
-				file.RealPath(),
+				"%s upload size doesn't match the provided offset: %d",
+				r.URL.Path,
 				uploadOffset,
 			)
 		}
 
-		openFile, err := d.user.Fs.OpenFile(r.URL.Path, os.O_WRONLY|os.O_APPEND, files.PermFile)
-		if err != nil {
-			return http.StatusInternalServerError, fmt.Errorf("could not open file: %w", err)
-		}
-		defer openFile.Close()
-
-		_, err = openFile.Seek(uploadOffset, 0)
-		if err != nil {
-			return http.StatusInternalServerError, fmt.Errorf("could not seek file: %w", err)
+		// the length can be deferred to any of the chunks
+		if upload.Length < 0 && r.Header.Get("Upload-Length") != "" {
+			if upload.Length, err = getUploadLength(r); err != nil {
+				return http.StatusBadRequest, err
+			}
+			if upload.SizeLimit > 0 && upload.Length > upload.SizeLimit {
+				return http.StatusRequestEntityTooLarge, &uploadSizeError{Limit: upload.SizeLimit, Size: upload.Length}
+			}
+			if upload.Limit > 0 && upload.Length > upload.Limit {
+				return http.StatusRequestEntityTooLarge, &quotaError{
+					Quota: d.user.Quota, Used: d.user.Quota - upload.Limit, Needed: upload.Length,
+				}
+			}
+			if err := upload.save(); err != nil {
+				return http.StatusInternalServerError, err
+			}
 		}
 
 		defer r.Body.Close()
-		bytesWritten, err := io.Copy(openFile, r.Body)
-		if err != nil {
+		progress := uploadProgress.track(d.user, upload.Path, upload.Length, offset)
+		offset, err = upload.write(offset, uploadProgress.reader(progress, r.Body))
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		switch {
+		case errors.Is(err, errQuotaExceeded), errors.Is(err, errUploadTooLarge):
+			return http.StatusRequestEntityTooLarge, err
+		case err != nil:
 			return http.StatusInternalServerError, fmt.Errorf("could not write to file: %w", err)
 		}
 
-		w.Header().Set("Upload-Offset", strconv.FormatInt(uploadOffset+bytesWritten, 10))
+		if offset != upload.Length {
+			return http.StatusNoContent, nil
+		}
+
+		return tusFinish(r, d, upload)
+	})
+}
+
+// tusFinish moves a complete upload into the scope of the user, running the
+// upload hooks around it as for the other uploads.
+func tusFinish(r *http.Request, d *data, upload *tusUpload) (int, error) {
+	var replaced int64
+	if info, err := d.user.Fs.Stat(upload.Path); err == nil {
+		replaced = info.Size()
+	}
+
+	var moveErr error
+	moved := false
+	err := d.RunHook(r.Context(), func() error {
+		moved = true
+		if moveErr = snapshotVersion(d.user, upload.Path); moveErr != nil {
+			return moveErr
+		}
+		moveErr = upload.finish(d.user.Fs, !s3fs.IsURL(d.server.Root))
+		return moveErr
+	}, "upload", upload.Path, "", d.user)
+
+	if moved && moveErr == nil {
+		quotaUsage.add(d.user.ID, upload.Length-replaced)
+	}
+	uploadProgress.done(upload.ID)
 
+	switch {
+	case !moved:
+		// a before hook rejected the file, which is discarded
+		if removeErr := upload.remove(); removeErr != nil {
+			return http.StatusInternalServerError, removeErr
+		}
+		if status := errToStatus(err); status != http.StatusInternalServerError {
+			return status, err
+		}
+		return http.StatusForbidden, err
+	case moveErr != nil:
+		return errToStatus(moveErr), moveErr
+	case err != nil:
+		// the after hooks failed, but the file is already uploaded
+		return http.StatusNoContent, err
+	}
+
+	return http.StatusNoContent, nil
+}
+
+func tusDeleteHandler() handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if !d.Check(r.URL.Path) {
+			return http.StatusForbidden, nil
+		}
+
+		upload, err := loadTusUpload(tusDir(d.server), d.user.ID, r.URL.Path)
+		if err != nil {
+			return errToStatus(err), err
+		}
+
+		if err := upload.remove(); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		uploadProgress.done(upload.ID)
 		return http.StatusNoContent, nil
 	})
 }
@@ -161,3 +284,17 @@ func getUploadOffset(r *http.Request) (int64, error) {
 	}
 	return uploadOffset, nil
 }
+
+// getUploadLength returns the length of the upload, -1 if deferred.
+func getUploadLength(r *http.Request) (int64, error) {
+	header := r.Header.Get("Upload-Length")
+	if header == "" {
+		return -1, nil
+	}
+
+	length, err := strconv.ParseInt(header, 10, 64)
+	if err != nil || length < 0 {
+		return 0, fmt.Errorf("invalid upload length: %q", header)
+	}
+	return length, nil
+}
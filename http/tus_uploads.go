@@ -0,0 +1,257 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/files"
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+// tusUploadExpiration is how long the partial uploads are kept without
+// being completed.
+const tusUploadExpiration = 24 * time.Hour
+
+// tusUpload is a partial upload of the tus handlers. Its content is kept out
+// of the scope of the user, in the tus directory of the server, until it is
+// complete.
+type tusUpload struct {
+	ID     string `json:"id"`
+	UserID uint   `json:"userID"`
+	Path   string `json:"path"`
+	// Length is the size of the file, -1 until the client tells it.
+	Length   int64 `json:"length"`
+	Override bool  `json:"override"`
+	// Limit is the size the upload can't exceed, from the quota of the user
+	// when it was created. Zero means no limit.
+	Limit int64 `json:"limit"`
+	// SizeLimit is the maximum upload size of the user when it was created.
+	// Zero means no limit.
+	SizeLimit int64     `json:"sizeLimit"`
+	Created   time.Time `json:"created"`
+
+	dir string
+}
+
+// tusDir returns the directory of the partial uploads.
+func tusDir(server *settings.Server) string {
+	if server.TusDir != "" {
+		return server.TusDir
+	}
+	return filepath.Join(os.TempDir(), "filebrowser-tus")
+}
+
+// tusUploadID identifies the upload of a user to a path, so that the client
+// resumes it with the URL of the file.
+func tusUploadID(userID uint, path string) string {
+	sum := sha256.Sum256([]byte(strconv.FormatUint(uint64(userID), 10) + ":" + path))
+	return hex.EncodeToString(sum[:16])
+}
+
+// newTusUpload starts an upload, replacing the previous one to the same
+// path.
+func newTusUpload(dir string, upload *tusUpload) error {
+	if err := os.MkdirAll(dir, 0700); err != nil { //nolint:gomnd
+		return err
+	}
+	cleanTusUploads(dir)
+
+	upload.ID = tusUploadID(upload.UserID, upload.Path)
+	upload.Created = time.Now()
+	upload.dir = dir
+
+	if err := os.WriteFile(upload.partPath(), nil, 0600); err != nil { //nolint:gomnd
+		return err
+	}
+	return upload.save()
+}
+
+// loadTusUpload returns the upload of a user to a path.
+func loadTusUpload(dir string, userID uint, path string) (*tusUpload, error) {
+	upload := &tusUpload{ID: tusUploadID(userID, path), dir: dir}
+
+	data, err := os.ReadFile(upload.infoPath())
+	if os.IsNotExist(err) {
+		return nil, fbErrors.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, upload); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+func (u *tusUpload) partPath() string {
+	return filepath.Join(u.dir, u.ID+".part")
+}
+
+func (u *tusUpload) infoPath() string {
+	return filepath.Join(u.dir, u.ID+".json")
+}
+
+func (u *tusUpload) save() error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(u.infoPath(), data, 0600) //nolint:gomnd
+}
+
+// offset returns how much of the file was received.
+func (u *tusUpload) offset() (int64, error) {
+	info, err := os.Stat(u.partPath())
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// maxSize returns the size the upload can't exceed, -1 if none.
+func (u *tusUpload) maxSize() int64 {
+	switch {
+	case u.Length >= 0:
+		return u.Length
+	case u.Limit > 0 && (u.SizeLimit <= 0 || u.Limit < u.SizeLimit):
+		return u.Limit
+	case u.SizeLimit > 0:
+		return u.SizeLimit
+	default:
+		return -1
+	}
+}
+
+// write appends a chunk to the upload at offset, returning the new offset.
+// The chunk is cut, and errQuotaExceeded returned, if it makes the upload
+// larger than its length or the quota of the user, or errUploadTooLarge if
+// it makes it larger than the maximum upload size.
+func (u *tusUpload) write(offset int64, r io.Reader) (int64, error) {
+	fd, err := os.OpenFile(u.partPath(), os.O_WRONLY, 0600) //nolint:gomnd
+	if err != nil {
+		return offset, err
+	}
+	defer fd.Close()
+
+	if _, err := fd.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+
+	limit := u.maxSize()
+	if limit < 0 {
+		n, err := io.Copy(fd, r)
+		return offset + n, err
+	}
+
+	n, err := io.Copy(fd, io.LimitReader(r, limit-offset))
+	if err != nil {
+		return offset + n, err
+	}
+
+	// anything left is more than the upload can take
+	if extra, _ := r.Read(make([]byte, 1)); extra > 0 {
+		if u.Length < 0 && limit == u.SizeLimit {
+			return offset + n, &uploadSizeError{Limit: u.SizeLimit}
+		}
+		return offset + n, errQuotaExceeded
+	}
+	return offset + n, nil
+}
+
+// finish moves the complete upload to its path in the file system of the
+// user, which may be renamed to if it's local.
+func (u *tusUpload) finish(fs afero.Fs, local bool) error {
+	if !u.Override {
+		if _, err := fs.Stat(u.Path); err == nil {
+			return fbErrors.ErrExist
+		}
+	}
+
+	if err := fs.MkdirAll(filepath.Dir(u.Path), files.PermDir); err != nil {
+		return err
+	}
+
+	// renaming is enough when the scope is on the same device
+	if base, ok := fs.(*afero.BasePathFs); ok && local {
+		if realPath, err := base.RealPath(u.Path); err == nil && os.Rename(u.partPath(), realPath) == nil {
+			if err := os.Chmod(realPath, files.PermFile); err != nil {
+				return err
+			}
+			return u.remove()
+		}
+	}
+
+	src, err := os.Open(u.partPath())
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := fs.OpenFile(u.Path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, files.PermFile)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("could not move the upload: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return u.remove()
+}
+
+func (u *tusUpload) remove() error {
+	err := os.Remove(u.partPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	err = os.Remove(u.infoPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// cleanTusUploads removes the uploads that didn't receive anything for
+// tusUploadExpiration.
+func cleanTusUploads(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+
+		upload := &tusUpload{ID: id, dir: dir}
+		info, err := os.Stat(upload.partPath())
+		if err == nil && time.Since(info.ModTime()) < tusUploadExpiration {
+			continue
+		}
+
+		if err := upload.remove(); err != nil {
+			log.Printf("[WARN] Failed to remove expired upload %s: %v", id, err)
+		}
+		uploadProgress.done(id)
+	}
+}
@@ -0,0 +1,66 @@
+package http
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestTusUpload(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := newTusUpload(dir, &tusUpload{UserID: 1, Path: "/a.txt", Length: 6}); err != nil {
+		t.Fatal(err)
+	}
+
+	upload, err := loadTusUpload(dir, 1, "/a.txt")
+	if err != nil {
+		t.Fatalf("failed to load the upload: %v", err)
+	}
+	if _, err := loadTusUpload(dir, 2, "/a.txt"); err == nil {
+		t.Error("expected the upload of another user not to be found")
+	}
+
+	offset, err := upload.write(0, strings.NewReader("abc"))
+	if err != nil || offset != 3 {
+		t.Fatalf("expected an offset of 3, got %d and %v", offset, err)
+	}
+
+	// the chunk is cut at the length of the upload
+	offset, err = upload.write(offset, strings.NewReader("defgh"))
+	if !errors.Is(err, errQuotaExceeded) || offset != 6 {
+		t.Fatalf("expected the chunk to be cut at 6, got %d and %v", offset, err)
+	}
+
+	fs := afero.NewMemMapFs()
+	if err := upload.finish(fs, true); err != nil {
+		t.Fatalf("failed to finish the upload: %v", err)
+	}
+
+	content, err := afero.ReadFile(fs, "/a.txt")
+	if err != nil || string(content) != "abcdef" {
+		t.Errorf("expected the uploaded file, got %q and %v", content, err)
+	}
+	if _, err := loadTusUpload(dir, 1, "/a.txt"); err == nil {
+		t.Error("expected the upload to be removed once finished")
+	}
+}
+
+func TestTusUploadNoOverride(t *testing.T) {
+	dir := t.TempDir()
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "/a.txt", []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	upload := &tusUpload{UserID: 1, Path: "/a.txt", Length: 0}
+	if err := newTusUpload(dir, upload); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := upload.finish(fs, true); err == nil {
+		t.Error("expected the existing file not to be replaced")
+	}
+}
@@ -0,0 +1,85 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// errUploadTooLarge is returned for the uploads larger than the maximum
+// upload size of the user.
+var errUploadTooLarge = errors.New("the upload is too large")
+
+// uploadSizeError tells the maximum upload size an upload exceeded. It is
+// errUploadTooLarge.
+type uploadSizeError struct {
+	Limit int64
+	// Size is the size of the upload, zero if it's only known to be larger
+	// than the limit.
+	Size int64
+}
+
+func (e *uploadSizeError) Error() string {
+	if e.Size > 0 {
+		return fmt.Sprintf("upload too large: the file is %d bytes but the uploads are limited to %d bytes", e.Size, e.Limit)
+	}
+	return fmt.Sprintf("upload too large: the uploads are limited to %d bytes", e.Limit)
+}
+
+func (e *uploadSizeError) Is(target error) bool {
+	return target == errUploadTooLarge
+}
+
+// maxUploadSize returns the size of the files the user can upload, its own
+// or the one of the settings, -1 if there's no limit.
+func maxUploadSize(d *data) int64 {
+	switch {
+	case d.user.MaxUploadSize > 0:
+		return d.user.MaxUploadSize
+	case d.user.MaxUploadSize < 0 || d.settings.MaxUploadSize <= 0:
+		return -1
+	default:
+		return d.settings.MaxUploadSize
+	}
+}
+
+// checkUploadSize returns an uploadSizeError if an upload of a length, -1
+// if unknown, is larger than the maximum upload size of the user.
+func checkUploadSize(d *data, length int64) error {
+	if limit := maxUploadSize(d); limit >= 0 && length > limit {
+		return &uploadSizeError{Limit: limit, Size: length}
+	}
+	return nil
+}
+
+// uploadSizeReader fails with an uploadSizeError once more than the limit
+// is read, for the uploads whose length isn't known beforehand.
+type uploadSizeReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
+
+func (u *uploadSizeReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	u.read += int64(n)
+	if u.read > u.limit {
+		return n, &uploadSizeError{Limit: u.limit}
+	}
+	return n, err
+}
+
+// limitUploadSize checks the length of an upload against the maximum upload
+// size of the user, before any of it is read, and returns the reader to
+// write it from.
+func limitUploadSize(d *data, r *http.Request, body io.Reader) (io.Reader, error) {
+	limit := maxUploadSize(d)
+	if limit < 0 {
+		return body, nil
+	}
+	if err := checkUploadSize(d, r.ContentLength); err != nil {
+		return nil, err
+	}
+	return &uploadSizeReader{r: body, limit: limit}, nil
+}
@@ -0,0 +1,131 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestMaxUploadSize(t *testing.T) {
+	tests := []struct {
+		global, user, want int64
+	}{
+		{0, 0, -1},
+		{10, 0, 10},
+		{10, 20, 20},
+		{10, -1, -1},
+		{0, 5, 5},
+	}
+	for _, tt := range tests {
+		d := &data{settings: &settings.Settings{MaxUploadSize: tt.global}, user: &users.User{MaxUploadSize: tt.user}}
+		if got := maxUploadSize(d); got != tt.want {
+			t.Errorf("maxUploadSize(%d, %d) = %d, want %d", tt.global, tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestLimitUploadSize(t *testing.T) {
+	d := &data{settings: &settings.Settings{MaxUploadSize: 4}, user: &users.User{}}
+
+	// the length is checked before the body is read
+	r := httptest.NewRequest(http.MethodPost, "/a.txt", strings.NewReader("abcde"))
+	_, err := limitUploadSize(d, r, r.Body)
+	var tooLarge *uploadSizeError
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != 4 || tooLarge.Size != 5 {
+		t.Fatalf("expected the length to be checked, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "limited to 4 bytes") {
+		t.Errorf("expected the error to tell the limit, got %q", err)
+	}
+
+	// without a length the body is cut once it goes over the limit
+	r = httptest.NewRequest(http.MethodPost, "/a.txt", strings.NewReader("abcde"))
+	r.ContentLength = -1
+	body, err := limitUploadSize(d, r, r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(body); !errors.Is(err, errUploadTooLarge) {
+		t.Errorf("expected the body to be cut, got %v", err)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/a.txt", strings.NewReader("abcd"))
+	if body, err = limitUploadSize(d, r, r.Body); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := io.ReadAll(body); err != nil || string(content) != "abcd" {
+		t.Errorf("expected the body to fit, got %q and %v", content, err)
+	}
+}
+
+func TestTusUploadSizeLimit(t *testing.T) {
+	dir := t.TempDir()
+
+	upload := &tusUpload{UserID: 1, Path: "/a.txt", Length: -1, SizeLimit: 4}
+	if err := newTusUpload(dir, upload); err != nil {
+		t.Fatal(err)
+	}
+	offset, err := upload.write(0, strings.NewReader("abcdef"))
+	if !errors.Is(err, errUploadTooLarge) || offset != 4 {
+		t.Fatalf("expected the chunk to be cut at the limit, got %d and %v", offset, err)
+	}
+
+	// the quota is told when it's the lower limit
+	upload = &tusUpload{UserID: 1, Path: "/b.txt", Length: -1, SizeLimit: 4, Limit: 2}
+	if err := newTusUpload(dir, upload); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := upload.write(0, strings.NewReader("abc")); !errors.Is(err, errQuotaExceeded) {
+		t.Fatalf("expected the quota to be exceeded, got %v", err)
+	}
+}
+
+func TestUploadTooLarge(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	user, err := st.Users.Get("", uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Perm = users.Permissions{Create: true, Modify: true}
+	user.MaxUploadSize = 4
+	if err := st.Users.Update(user, "Perm", "MaxUploadSize"); err != nil {
+		t.Fatal(err)
+	}
+	token := issueToken(t, st)
+	root := t.TempDir()
+
+	serve := func(content string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodPost, "/a.txt", strings.NewReader(content))
+		r.Header.Set("X-Auth", token)
+		recorder := httptest.NewRecorder()
+		handle(resourcePostHandler(&memoryCache{values: map[string][]byte{}}), "", st, &settings.Server{Root: root}, nil).
+			ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	rec := serve("abcde")
+	if rec.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rec.Body.String(), "limited to 4 bytes") {
+		t.Errorf("expected the upload to be too large, got %d and %q", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no file to be written, got %v", err)
+	}
+	if rec := serve("abcd"); rec.Code != http.StatusOK {
+		t.Errorf("expected the upload to fit, got %d", rec.Code)
+	}
+	if content, err := os.ReadFile(filepath.Join(root, "a.txt")); err != nil || string(content) != "abcd" {
+		t.Errorf("expected the file to be uploaded, got %q and %v", content, err)
+	}
+}
@@ -17,12 +17,14 @@ import (
 )
 
 var (
-	NonModifiableFieldsForNonAdmin = []string{"Username", "Scope", "LockPassword", "Perm", "Commands", "Rules"}
+	NonModifiableFieldsForNonAdmin = []string{"Username", "Scope", "LockPassword", "Perm", "Commands", "Rules", "Hooks", "Passkeys", "TOTP", "Quota", "MaxUploadSize", "TokenVersion", "Role", "PermOverrides", "Versions", "Trash", "OIDCSubject"}
 )
 
 type modifyUserRequest struct {
 	modifyRequest
 	Data *users.User `json:"data"`
+	// fields are the fields of the user given by the request.
+	fields map[string]json.RawMessage
 }
 
 func getUserID(r *http.Request) (uint, error) {
@@ -34,21 +36,37 @@ func getUserID(r *http.Request) (uint, error) {
 	return uint(i), err
 }
 
-func getUser(_ http.ResponseWriter, r *http.Request) (*modifyUserRequest, error) {
+// getUser decodes the user of a request on top of base, the fields the
+// request doesn't give being kept.
+func getUser(_ http.ResponseWriter, r *http.Request, base *users.User) (*modifyUserRequest, error) {
 	if r.Body == nil {
 		return nil, fbErrors.ErrEmptyRequest
 	}
 
-	req := &modifyUserRequest{}
-	err := json.NewDecoder(r.Body).Decode(req)
+	var raw struct {
+		modifyRequest
+		Data json.RawMessage `json:"data"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&raw)
 	if err != nil {
 		return nil, err
 	}
 
-	if req.What != "user" {
+	if raw.What != "user" {
 		return nil, fbErrors.ErrInvalidDataType
 	}
 
+	req := &modifyUserRequest{modifyRequest: raw.modifyRequest, Data: base}
+	if len(raw.Data) == 0 || string(raw.Data) == "null" {
+		return req, nil
+	}
+	if err := json.Unmarshal(raw.Data, &req.fields); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw.Data, req.Data); err != nil {
+		return nil, err
+	}
+
 	return req, nil
 }
 
@@ -62,6 +80,10 @@ func withSelfOrAdmin(fn handleFunc) handleFunc {
 		if d.user.ID != id && !d.user.Perm.Admin {
 			return http.StatusForbidden, nil
 		}
+		// the accounts are only managed by the API tokens of the admins
+		if d.token != nil && !d.user.Perm.Admin {
+			return http.StatusForbidden, nil
+		}
 
 		d.raw = id
 		return fn(w, r, d)
@@ -76,6 +98,7 @@ var usersGetHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *
 
 	for _, u := range users {
 		u.Password = ""
+		u.TOTP.Secret, u.TOTP.RecoveryCodes = "", nil
 	}
 
 	sort.Slice(users, func(i, j int) bool {
@@ -96,6 +119,7 @@ var userGetHandler = withSelfOrAdmin(func(w http.ResponseWriter, r *http.Request
 	}
 
 	u.Password = ""
+	u.TOTP.Secret, u.TOTP.RecoveryCodes = "", nil
 	if !d.user.Perm.Admin {
 		u.Scope = ""
 	}
@@ -108,11 +132,24 @@ var userDeleteHandler = withSelfOrAdmin(func(_ http.ResponseWriter, _ *http.Requ
 		return errToStatus(err), err
 	}
 
+	err = d.store.Sessions.DeleteByUserID(d.raw.(uint))
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	err = d.store.Tokens.DeleteByUserID(d.raw.(uint))
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
 	return http.StatusOK, nil
 })
 
 var userPostHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
-	req, err := getUser(w, r)
+	// the defaults of the settings are overridden by the request
+	user := &users.User{}
+	d.settings.Defaults.Apply(user)
+	req, err := getUser(w, r, user)
 	if err != nil {
 		return http.StatusBadRequest, err
 	}
@@ -130,6 +167,14 @@ var userPostHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *
 		return http.StatusInternalServerError, err
 	}
 
+	if _, ok := req.fields["scope"]; req.Data.Role != 0 && (!ok || req.Data.Scope == "") {
+		role, err := d.store.Roles.Get(req.Data.Role) //nolint:govet
+		if err != nil {
+			return errToStatus(err), err
+		}
+		req.Data.Scope = role.UserScope(req.Data.Username)
+	}
+
 	userHome, err := d.settings.MakeUserDir(req.Data.Username, req.Data.Scope, d.server.Root)
 	if err != nil {
 		log.Printf("create user: failed to mkdir user home dir: [%s]", userHome)
@@ -148,7 +193,7 @@ var userPostHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *
 })
 
 var userPutHandler = withSelfOrAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
-	req, err := getUser(w, r)
+	req, err := getUser(w, r, &users.User{})
 	if err != nil {
 		return http.StatusBadRequest, err
 	}
@@ -162,11 +207,25 @@ var userPutHandler = withSelfOrAdmin(func(w http.ResponseWriter, r *http.Request
 			return http.StatusForbidden, nil
 		}
 
+		var suser *users.User
+		suser, err = d.store.Users.Get(d.server.Root, d.raw.(uint))
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		// the passkeys, second factor and tokens are only changed through
+		// their own endpoints
+		req.Data.Passkeys = suser.Passkeys
+		req.Data.TOTP = suser.TOTP
+		req.Data.TokenVersion = suser.TokenVersion
+		// the identity of the provider is kept unless it's changed
+		if _, ok := req.fields["oidcSubject"]; !ok {
+			req.Data.OIDCSubject = suser.OIDCSubject
+		}
+
 		if req.Data.Password != "" {
 			req.Data.Password, err = users.HashPwd(req.Data.Password)
 		} else {
-			var suser *users.User
-			suser, err = d.store.Users.Get(d.server.Root, d.raw.(uint))
 			req.Data.Password = suser.Password
 		}
 
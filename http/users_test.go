@@ -0,0 +1,106 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/filebrowser/filebrowser/v2/files"
+	"github.com/filebrowser/filebrowser/v2/rules"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestUserPostDefaults(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	admin, err := st.Users.Get("", uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin.Perm.Admin = true
+	if err := st.Users.Update(admin, "Perm"); err != nil {
+		t.Fatal(err)
+	}
+	token := issueToken(t, st)
+
+	set, err := st.Settings.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.Defaults = settings.UserDefaults{
+		Scope:    "/home",
+		Locale:   "fr",
+		Perm:     users.Permissions{Download: true},
+		Commands: []string{"ls"},
+		Rules:    []rules.Rule{{Type: rules.TypeGlob, Path: "/secret"}},
+	}
+	if err := st.Settings.Save(set); err != nil {
+		t.Fatal(err)
+	}
+	role := &users.Role{Name: "team", Scope: "/teams/{username}"}
+	if err := st.Roles.Save(role); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(body string) int {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("X-Auth", token)
+		recorder := httptest.NewRecorder()
+		handle(userPostHandler, "", st, &settings.Server{Root: t.TempDir()}, nil).ServeHTTP(recorder, r)
+		return recorder.Code
+	}
+
+	// the fields of the request override the defaults
+	if code := post(`{"what":"user","data":{"username":"alice","password":"pw","locale":"de"}}`); code != http.StatusCreated {
+		t.Fatalf("expected the user to be created, got %d", code)
+	}
+	alice, err := st.Users.Get("", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.Locale != "de" || alice.Scope != "/home" || !alice.Perm.Download || alice.Perm.Create ||
+		len(alice.Commands) != 1 || len(alice.Rules) != 1 || alice.Rules[0].Path != "/secret" {
+		t.Errorf("expected the defaults with the locale of the request, got %+v", alice)
+	}
+
+	// the scope of the role is used unless the request gives one
+	if code := post(fmt.Sprintf(`{"what":"user","data":{"username":"bob","password":"pw","role":%d,"rules":[]}}`, role.ID)); code != http.StatusCreated {
+		t.Fatalf("expected the user to be created, got %d", code)
+	}
+	bob, err := st.Users.Get("", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.Scope != "/teams/bob" || len(bob.Rules) != 0 {
+		t.Errorf("expected the scope of the role without rules, got %q and %v", bob.Scope, bob.Rules)
+	}
+
+	if code := post(fmt.Sprintf(`{"what":"user","data":{"username":"carol","password":"pw","role":%d,"scope":"/carol"}}`, role.ID)); code != http.StatusCreated {
+		t.Fatalf("expected the user to be created, got %d", code)
+	}
+	if carol, err := st.Users.Get("", "carol"); err != nil || carol.Scope != "/carol" {
+		t.Errorf("expected the scope of the request, got %v", err)
+	}
+}
+
+func TestUserDefaultsValidate(t *testing.T) {
+	for _, defaults := range []settings.UserDefaults{
+		{Scope: "../outside"},
+		{ViewMode: "grid"},
+		{Sorting: files.Sorting{By: "color"}},
+		{Commands: []string{" "}},
+		{Rules: []rules.Rule{{Type: rules.TypeRegex}}},
+	} {
+		if err := defaults.Validate(); err == nil {
+			t.Errorf("expected %+v to be refused", defaults)
+		}
+	}
+	valid := settings.UserDefaults{Scope: "/home/..users", ViewMode: users.ListViewMode, Sorting: files.Sorting{By: "size"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("expected the defaults to be valid, got %v", err)
+	}
+}
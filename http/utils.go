@@ -1,6 +1,8 @@
 package http
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -9,6 +11,7 @@ import (
 	"strings"
 
 	libErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/runner"
 )
 
 func renderJSON(w http.ResponseWriter, _ *http.Request, data interface{}) (int, error) {
@@ -26,22 +29,78 @@ func renderJSON(w http.ResponseWriter, _ *http.Request, data interface{}) (int,
 	return 0, nil
 }
 
+// renderTaggedJSON renders data like renderJSON, with a strong entity tag
+// of the response, which is not sent again to the clients that have it.
+func renderTaggedJSON(w http.ResponseWriter, r *http.Request, data interface{}) (int, error) {
+	marsh, err := json.Marshal(data)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	sum := sha256.Sum256(marsh)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return 0, nil
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if _, err := w.Write(marsh); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return 0, nil
+}
+
+// etagMatches tells if an If-None-Match header matches an entity tag, with
+// the weak comparison it uses.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
 func errToStatus(err error) int {
+	var rejected *runner.ErrHookRejected
+
 	switch {
 	case err == nil:
 		return http.StatusOK
+	case errors.As(err, &rejected):
+		return rejected.Status
+	case errors.Is(err, runner.ErrPathNotAllowed), errors.Is(err, runner.ErrReadOnly):
+		return http.StatusForbidden
+	case errors.Is(err, runner.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, runner.ErrTooManyBackgroundHooks), errors.Is(err, runner.ErrCircuitOpen),
+		errors.Is(err, runner.ErrEnqueue):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, runner.ErrTimeout):
+		return http.StatusGatewayTimeout
 	case os.IsPermission(err):
 		return http.StatusForbidden
-	case os.IsNotExist(err), errors.Is(err, libErrors.ErrNotExist):
+	case os.IsNotExist(err), errors.Is(err, libErrors.ErrNotExist), errors.Is(err, runner.ErrJobNotFound):
 		return http.StatusNotFound
 	case os.IsExist(err), errors.Is(err, libErrors.ErrExist):
 		return http.StatusConflict
 	case errors.Is(err, libErrors.ErrPermissionDenied):
 		return http.StatusForbidden
-	case errors.Is(err, libErrors.ErrInvalidRequestParams):
+	case errors.Is(err, libErrors.ErrInvalidRequestParams), errors.Is(err, libErrors.ErrEmptyRoleName),
+		errors.Is(err, libErrors.ErrInvalidRule), errors.Is(err, libErrors.ErrInvalidOption):
 		return http.StatusBadRequest
 	case errors.Is(err, libErrors.ErrRootUserDeletion):
 		return http.StatusForbidden
+	case errors.Is(err, errQuotaExceeded), errors.Is(err, errUploadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, libErrors.ErrShareExhausted):
+		return http.StatusGone
+	case errors.Is(err, libErrors.ErrLocked):
+		return http.StatusLocked
 	default:
 		return http.StatusInternalServerError
 	}
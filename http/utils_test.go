@@ -0,0 +1,29 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/filebrowser/filebrowser/v2/runner"
+)
+
+func TestErrToStatusRunnerErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{runner.ErrParseCommand, http.StatusInternalServerError},
+		{runner.ErrCommandFailed, http.StatusInternalServerError},
+		{runner.ErrEnqueue, http.StatusServiceUnavailable},
+		{runner.ErrTimeout, http.StatusGatewayTimeout},
+		{runner.ErrPathNotAllowed, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		err := fmt.Errorf("%w: details", tt.err)
+		if got := errToStatus(err); got != tt.want {
+			t.Errorf("errToStatus(%v) = %d, want %d", err, got, tt.want)
+		}
+	}
+}
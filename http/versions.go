@@ -0,0 +1,181 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/files"
+	"github.com/filebrowser/filebrowser/v2/fileutils"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+const (
+	// versionsDir is the directory of the scopes the versions of the files
+	// are kept in, under the path of each file. The rules deny it, so it
+	// is only reached through the versions endpoints.
+	versionsDir = "/.versions"
+	// versionIDFormat is the format of the times the versions were taken
+	// at, their IDs, which sort in the same order.
+	versionIDFormat = "20060102T150405.000000000Z"
+)
+
+// fileVersion is a previous content of a file.
+type fileVersion struct {
+	ID       string    `json:"id"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// isVersionPath tells if a path is in the directory of the versions.
+func isVersionPath(p string) bool {
+	p = path.Clean("/" + p)
+	return p == versionsDir || strings.HasPrefix(p, versionsDir+"/")
+}
+
+// versionsOf returns the directory of the versions of a file.
+func versionsOf(p string) string {
+	return versionsDir + path.Clean("/"+p)
+}
+
+// snapshotVersion keeps the current content of a file before it's
+// overwritten, if the user has versioning, and removes the versions past
+// the retention. Directories and missing files have nothing to keep.
+func snapshotVersion(user *users.User, p string) error {
+	if !user.Versions.Enabled() {
+		return nil
+	}
+
+	if err := takeVersion(user, p); err != nil {
+		return err
+	}
+	return pruneVersions(user.Fs, p, user.Versions, time.Now())
+}
+
+func takeVersion(user *users.User, p string) error {
+	info, err := user.Fs.Stat(p)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && info.IsDir()) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	defer quotaUsage.forget(user.ID)
+	dst := path.Join(versionsOf(p), time.Now().UTC().Format(versionIDFormat))
+	return fileutils.CopyFile(user.Fs, p, dst)
+}
+
+// listVersions returns the versions of a file, the newest first.
+func listVersions(fs afero.Fs, p string) ([]fileVersion, error) {
+	infos, err := afero.ReadDir(fs, versionsOf(p))
+	if errors.Is(err, os.ErrNotExist) {
+		return []fileVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]fileVersion, 0, len(infos))
+	for _, info := range infos {
+		taken, err := time.Parse(versionIDFormat, info.Name())
+		if err != nil || info.IsDir() {
+			continue
+		}
+		versions = append(versions, fileVersion{ID: info.Name(), Size: info.Size(), Modified: taken})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].ID > versions[j].ID })
+	return versions, nil
+}
+
+// pruneVersions removes the versions of a file past the retention count,
+// or older than its days.
+func pruneVersions(fs afero.Fs, p string, retention users.Versioning, now time.Time) error {
+	versions, err := listVersions(fs, p)
+	if err != nil {
+		return err
+	}
+
+	oldest := time.Time{}
+	if retention.Days > 0 {
+		oldest = now.AddDate(0, 0, -retention.Days)
+	}
+	for i, version := range versions {
+		if (retention.Count <= 0 || i < retention.Count) && !version.Modified.Before(oldest) {
+			continue
+		}
+		if err := fs.Remove(path.Join(versionsOf(p), version.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var versionsGetHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	if !d.Check(r.URL.Path) {
+		return http.StatusForbidden, nil
+	}
+
+	versions, err := listVersions(d.user.Fs, r.URL.Path)
+	if err != nil {
+		return errToStatus(err), err
+	}
+	return renderJSON(w, r, versions)
+})
+
+// versionRestoreHandler puts the version of the id query back in place of
+// the file, running the restore hooks around it. The content it replaces
+// becomes a version itself, so that a restore can be undone, whether the
+// user has versioning or not.
+func versionRestoreHandler(fileCache FileCache) handleFunc {
+	return withUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		if !d.user.Perm.Modify || !d.Check(r.URL.Path) {
+			return http.StatusForbidden, nil
+		}
+
+		id := r.URL.Query().Get("id")
+		if _, err := time.Parse(versionIDFormat, id); err != nil {
+			return http.StatusBadRequest, fbErrors.ErrInvalidRequestParams
+		}
+		version := path.Join(versionsOf(r.URL.Path), id)
+		if _, err := d.user.Fs.Stat(version); err != nil {
+			return errToStatus(err), err
+		}
+
+		if file, err := files.NewFileInfo(&files.FileOptions{
+			Fs:      d.user.Fs,
+			Path:    r.URL.Path,
+			Modify:  d.user.Perm.Modify,
+			Checker: d,
+		}); err == nil {
+			if file.IsDir {
+				return http.StatusConflict, nil
+			}
+			if err := delThumbs(r.Context(), fileCache, file); err != nil {
+				return errToStatus(err), err
+			}
+		}
+
+		// the retention applies once the version is back in place, not to
+		// remove it first
+		err := d.RunHook(r.Context(), func() error {
+			if err := takeVersion(d.user, r.URL.Path); err != nil {
+				return err
+			}
+			defer quotaUsage.forget(d.user.ID)
+			if err := fileutils.CopyFile(d.user.Fs, version, r.URL.Path); err != nil {
+				return err
+			}
+			return pruneVersions(d.user.Fs, r.URL.Path, d.user.Versions, time.Now())
+		}, "restore", r.URL.Path, "", d.user)
+
+		return errToStatus(err), err
+	})
+}
@@ -0,0 +1,80 @@
+package http
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestSnapshotVersion(t *testing.T) {
+	t.Parallel()
+
+	user := &users.User{ID: 1, Fs: afero.NewMemMapFs(), Versions: users.Versioning{Count: 2}}
+	for _, content := range []string{"one", "two", "three", "four"} {
+		if err := snapshotVersion(user, "/dir/a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if err := afero.WriteFile(user.Fs, "/dir/a.txt", []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	versions, err := listVersions(user.Fs, "/dir/a.txt")
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("expected the two last versions, got %+v and %v", versions, err)
+	}
+	for i, want := range []string{"three", "two"} {
+		got, err := afero.ReadFile(user.Fs, path.Join(versionsOf("/dir/a.txt"), versions[i].ID))
+		if err != nil || string(got) != want {
+			t.Errorf("expected version %d to be %q, got %q and %v", i, want, got, err)
+		}
+	}
+
+	// the versions older than the days are removed whatever the count
+	old := time.Now().AddDate(0, 0, -2).UTC().Format(versionIDFormat)
+	if err := afero.WriteFile(user.Fs, path.Join(versionsOf("/dir/a.txt"), old), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := pruneVersions(user.Fs, "/dir/a.txt", users.Versioning{Days: 1}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if versions, _ := listVersions(user.Fs, "/dir/a.txt"); len(versions) != 2 {
+		t.Errorf("expected the old version to be removed, got %+v", versions)
+	}
+
+	// nothing is kept without versioning, nor for the directories
+	user.Versions = users.Versioning{}
+	if err := snapshotVersion(user, "/dir/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	user.Versions = users.Versioning{Count: 5}
+	if err := snapshotVersion(user, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if versions, _ := listVersions(user.Fs, "/dir/a.txt"); len(versions) != 2 {
+		t.Errorf("expected no new version, got %+v", versions)
+	}
+	if versions, _ := listVersions(user.Fs, "/dir"); len(versions) != 0 {
+		t.Errorf("expected the directories to have no versions, got %+v", versions)
+	}
+}
+
+func TestIsVersionPath(t *testing.T) {
+	t.Parallel()
+
+	for p, want := range map[string]bool{
+		"/.versions":          true,
+		"/.versions/a.txt/id": true,
+		".versions/a.txt":     true,
+		"/dir/.versions":      false,
+		"/.versions-old":      false,
+	} {
+		if got := isVersionPath(p); got != want {
+			t.Errorf("isVersionPath(%q) = %t, want %t", p, got, want)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+	"golang.org/x/net/webdav"
+
+	"github.com/filebrowser/filebrowser/v2/auth"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// errWebDAVFailed tells RunHook that the WebDAV operation failed, so that the
+// after hooks don't run. The response was already written by then.
+var errWebDAVFailed = errors.New("webdav operation failed")
+
+// webdavLocks keeps a lock system per user, so that locks outlive the
+// requests that took them.
+type webdavLocks struct {
+	mu      sync.Mutex
+	systems map[uint]webdav.LockSystem
+}
+
+func (l *webdavLocks) get(id uint) webdav.LockSystem {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ls, ok := l.systems[id]
+	if !ok {
+		ls = webdav.NewMemLS()
+		l.systems[id] = ls
+	}
+	return ls
+}
+
+// webdavHandler serves the files of the user over WebDAV under prefix,
+// relative to the base URL. The operations that change files run the same
+// hooks as their API counterparts. The failed logins count toward the
+// lockouts of the login limiter.
+func webdavHandler(prefix string, logins *loginLimiter) handleFunc {
+	locks := &webdavLocks{systems: map[uint]webdav.LockSystem{}}
+
+	return withBasicAuth(logins, func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		if !d.user.Perm.Download {
+			return http.StatusForbidden, nil
+		}
+
+		if dst := r.Header.Get("Destination"); dst != "" {
+			// the destination is a full URL, unlike the request path
+			// the base URL wasn't stripped from it
+			u, err := url.Parse(dst)
+			if err != nil {
+				return http.StatusBadRequest, err
+			}
+			u.Path = strings.TrimPrefix(u.Path, d.server.BaseURL)
+			u.RawPath = ""
+			r.Header.Set("Destination", u.String())
+		}
+
+		handler := &webdav.Handler{
+			Prefix:     prefix,
+			FileSystem: &webdavFs{d: d},
+			LockSystem: locks.get(d.user.ID),
+			Logger: func(r *http.Request, err error) {
+				if err != nil {
+					log.Printf("webdav: %s %s: %v", r.Method, r.URL.Path, err)
+				}
+			},
+		}
+
+		evt, src, dst := webdavEvent(r, prefix, d.user.Fs)
+		if evt == "delete" && d.user.Trash.Enabled {
+			evt = "trash"
+		}
+		if evt == "" {
+			handler.ServeHTTP(w, r)
+			return 0, nil
+		}
+
+		body, err := webdavLimits(r, d, evt, src, dst)
+		if err != nil {
+			return errToStatus(err), err
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		err = d.RunHook(r.Context(), func() error {
+			if evt == "save" {
+				if err := snapshotVersion(d.user, src); err != nil {
+					return err
+				}
+			}
+			handler.ServeHTTP(rec, r)
+			switch evt {
+			case "save", "upload", "copy":
+				quotaUsage.forget(d.user.ID)
+			}
+			if body != nil && body.exceeded {
+				// the file was cut at the limit
+				_ = d.user.Fs.RemoveAll(src)
+			}
+			if rec.status >= http.StatusBadRequest {
+				return errWebDAVFailed
+			}
+			return nil
+		}, evt, src, dst, d.user)
+
+		switch {
+		case errors.Is(err, errWebDAVFailed):
+			return 0, nil
+		case rec.status != 0:
+			// the after hooks failed, but the response is already written
+			return 0, err
+		default:
+			return errToStatus(err), err
+		}
+	})
+}
+
+// webdavLimits checks the uploads and the copies of a WebDAV request against
+// the quota of the user, and the uploads against their maximum size too.
+// The body of an upload is limited to the remaining space and the maximum
+// size, and returned, to tell if it went over them.
+func webdavLimits(r *http.Request, d *data, evt, src, dst string) (*webdavBody, error) {
+	switch evt {
+	case "save", "upload":
+		var freed int64
+		if info, err := d.user.Fs.Stat(src); err == nil {
+			freed = info.Size()
+		}
+		reader, err := limitQuota(d, r, freed)
+		if err == nil {
+			reader, err = limitUploadSize(d, r, reader)
+		}
+		if err != nil {
+			return nil, err
+		}
+		body := &webdavBody{Reader: reader, Closer: r.Body}
+		r.Body = body
+		return body, nil
+	case "copy":
+		return nil, checkCopyQuota(d, src, dst)
+	default:
+		return nil, nil
+	}
+}
+
+// webdavBody is the body of an upload limited to the quota and the maximum
+// upload size of the user.
+type webdavBody struct {
+	io.Reader
+	io.Closer
+	exceeded bool
+}
+
+func (b *webdavBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if errors.Is(err, errQuotaExceeded) || errors.Is(err, errUploadTooLarge) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// webdavEvent returns the hook event of a WebDAV request, along with its
+// source and destination paths. Requests that don't change files have no
+// event.
+func webdavEvent(r *http.Request, prefix string, fs afero.Fs) (evt, src, dst string) {
+	src = path.Clean("/" + strings.TrimPrefix(r.URL.Path, prefix))
+
+	if header := r.Header.Get("Destination"); header != "" {
+		if u, err := url.Parse(header); err == nil {
+			dst = path.Clean("/" + strings.TrimPrefix(u.Path, prefix))
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if info, err := fs.Stat(src); err == nil && !info.IsDir() {
+			return "download", src, ""
+		}
+		return "", src, dst
+	case http.MethodPut:
+		if _, err := fs.Stat(src); err == nil {
+			return "save", src, ""
+		}
+		return "upload", src, ""
+	case http.MethodDelete:
+		return "delete", src, ""
+	case "MOVE":
+		return patchEvent("rename", src, dst), src, dst
+	case "COPY":
+		return "copy", src, dst
+	default:
+		return "", src, dst
+	}
+}
+
+// withBasicAuth authenticates the request with HTTP basic authentication,
+// which is what WebDAV clients support, unless the authentication method
+// doesn't use passwords, or the WebAuthn one doesn't allow them. The users
+// with a second factor, or who must set one up, can't use it, as the
+// password alone would bypass it. The credentials are limited like the ones
+// of the login API.
+func withBasicAuth(l *loginLimiter, fn handleFunc) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		username, _, sent := r.BasicAuth()
+		keys := l.keys(r, username)
+		if sent && l.locked(w, r, keys) {
+			return http.StatusTooManyRequests, nil
+		}
+
+		user, err := webdavUser(r, d)
+		if err != nil {
+			if sent {
+				l.failed(r.Context(), keys)
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="File Browser"`)
+			return http.StatusUnauthorized, nil
+		}
+		if sent {
+			l.succeeded(r.Context(), keys)
+		}
+
+		d.user = user
+		d.restrictReadOnly(d.user)
+		return fn(w, r, d)
+	}
+}
+
+func webdavUser(r *http.Request, d *data) (*users.User, error) {
+	switch d.settings.AuthMethod {
+	case auth.MethodNoAuth, auth.MethodProxyAuth:
+		auther, err := d.store.Auth.Get(d.settings.AuthMethod)
+		if err != nil {
+			return nil, err
+		}
+		return auther.Auth(r, d.store.Users, d.settings, d.server)
+	case auth.MethodWebAuthn:
+		auther, err := d.store.Auth.Get(d.settings.AuthMethod)
+		if err != nil {
+			return nil, err
+		}
+		if a, ok := auther.(*auth.WebAuthnAuth); !ok || !a.AllowPassword {
+			return nil, os.ErrPermission
+		}
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, os.ErrPermission
+	}
+
+	user, err := d.store.Users.Get(d.server.Root, username)
+	if err != nil || !users.CheckPwd(password, user.Password) {
+		return nil, os.ErrPermission
+	}
+	if user.TOTP.Enabled || d.settings.EnforceTOTP {
+		return nil, os.ErrPermission
+	}
+
+	return user, nil
+}
+
+// statusRecorder keeps the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(p)
+}
+
+// webdavFs is the file system of a user for WebDAV. It enforces the rules
+// and the permissions of the user, as the API does.
+type webdavFs struct {
+	d *data
+}
+
+func (f *webdavFs) check(name string, allowed bool) (string, error) {
+	name = path.Clean("/" + name)
+	if !allowed || !f.d.Check(name) {
+		return "", os.ErrPermission
+	}
+	return name, nil
+}
+
+func (f *webdavFs) Mkdir(_ context.Context, name string, perm os.FileMode) error {
+	name, err := f.check(name, f.d.user.Perm.Create)
+	if err != nil {
+		return err
+	}
+	return f.d.user.Fs.Mkdir(name, perm)
+}
+
+func (f *webdavFs) OpenFile(_ context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	name, err := f.check(name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		_, err := f.d.user.Fs.Stat(name)
+		exists := err == nil
+		if (exists && !f.d.user.Perm.Modify) || (!exists && !f.d.user.Perm.Create) {
+			return nil, os.ErrPermission
+		}
+	}
+
+	file, err := f.d.user.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webdavFile{File: file, fs: f, name: name}, nil
+}
+
+func (f *webdavFs) RemoveAll(_ context.Context, name string) error {
+	name, err := f.check(name, f.d.user.Perm.Delete)
+	if err != nil {
+		return err
+	}
+	if name == "/" {
+		return os.ErrPermission
+	}
+	if f.d.user.Trash.Enabled {
+		if _, err := f.d.user.Fs.Stat(name); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		defer quotaUsage.forget(f.d.user.ID)
+		return trashFile(f.d.user, name, time.Now())
+	}
+	return f.d.user.Fs.RemoveAll(name)
+}
+
+func (f *webdavFs) Rename(_ context.Context, oldName, newName string) error {
+	oldName, err := f.check(oldName, f.d.user.Perm.Rename)
+	if err != nil {
+		return err
+	}
+	newName, err = f.check(newName, f.d.user.Perm.Rename)
+	if err != nil {
+		return err
+	}
+	if oldName == "/" || newName == "/" {
+		return os.ErrPermission
+	}
+	return f.d.user.Fs.Rename(oldName, newName)
+}
+
+func (f *webdavFs) Stat(_ context.Context, name string) (os.FileInfo, error) {
+	name, err := f.check(name, true)
+	if err != nil {
+		return nil, err
+	}
+	return f.d.user.Fs.Stat(name)
+}
+
+// webdavFile hides the directory entries denied by the rules.
+type webdavFile struct {
+	afero.File
+	fs   *webdavFs
+	name string
+}
+
+func (f *webdavFile) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := f.File.Readdir(count)
+
+	allowed := infos[:0]
+	for _, info := range infos {
+		if f.fs.d.Check(path.Join(f.name, info.Name())) {
+			allowed = append(allowed, info)
+		}
+	}
+
+	return allowed, err
+}
@@ -0,0 +1,364 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/auth"
+	"github.com/filebrowser/filebrowser/v2/rules"
+	"github.com/filebrowser/filebrowser/v2/runner"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestWebDAVFsPermissions(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "/file.txt", []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := afero.WriteFile(fs, "/private/secret.txt", []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	d := &data{
+		settings: &settings.Settings{},
+		user: &users.User{
+			Fs:    fs,
+			Perm:  users.Permissions{Create: true},
+			Rules: []rules.Rule{{Path: "/private"}},
+		},
+	}
+	davFs := &webdavFs{d: d}
+	ctx := context.Background()
+
+	if _, err := davFs.Stat(ctx, "/private/secret.txt"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected the rules to deny the stat, got %v", err)
+	}
+	if _, err := davFs.OpenFile(ctx, "/file.txt", os.O_WRONLY|os.O_TRUNC, 0644); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected overwriting to need the modify permission, got %v", err)
+	}
+	if err := davFs.RemoveAll(ctx, "/file.txt"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected deleting to need the delete permission, got %v", err)
+	}
+
+	file, err := davFs.OpenFile(ctx, "/new.txt", os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatalf("expected creating a file to be allowed, got %v", err)
+	}
+	file.Close()
+
+	dir, err := davFs.OpenFile(ctx, "/", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer dir.Close()
+
+	infos, err := dir.Readdir(-1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, info := range infos {
+		if info.Name() == "private" {
+			t.Error("expected the denied directory to be hidden")
+		}
+	}
+}
+
+func TestWebDAVUserTOTP(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	hashed, err := users.HashPwd("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*users.User{
+		{Username: "plain", Password: hashed},
+		{Username: "second", Password: hashed, TOTP: users.TOTP{Secret: "x", Enabled: true}},
+	} {
+		if err := st.Users.Save(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	set, err := st.Settings.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login := func(username string) error {
+		r := httptest.NewRequest("PROPFIND", "/", nil)
+		r.SetBasicAuth(username, "secret")
+		_, err := webdavUser(r, &data{store: st, settings: set, server: &settings.Server{Root: t.TempDir()}})
+		return err
+	}
+	if err := login("plain"); err != nil {
+		t.Errorf("expected the password to be enough, got %v", err)
+	}
+	// the password alone would bypass the second factor
+	if err := login("second"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected the user with a second factor to be refused, got %v", err)
+	}
+	set.EnforceTOTP = true
+	if err := login("plain"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected the users to be refused while the second factor is enforced, got %v", err)
+	}
+}
+
+func TestWebDAVUserPasskeys(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	hashed, err := users.HashPwd("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Users.Save(&users.User{Username: "plain", Password: hashed}); err != nil {
+		t.Fatal(err)
+	}
+	set, err := st.Settings.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.AuthMethod = auth.MethodWebAuthn
+
+	login := func(a *auth.WebAuthnAuth) error {
+		if err := st.Auth.Save(a); err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("PROPFIND", "/", nil)
+		r.SetBasicAuth("plain", "secret")
+		_, err := webdavUser(r, &data{store: st, settings: set, server: &settings.Server{Root: t.TempDir()}})
+		return err
+	}
+	if err := login(&auth.WebAuthnAuth{RPID: "example.com"}); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected the password to be refused without the passkeys, got %v", err)
+	}
+	if err := login(&auth.WebAuthnAuth{RPID: "example.com", AllowPassword: true}); err != nil {
+		t.Errorf("expected the password to be allowed, got %v", err)
+	}
+}
+
+func TestWebDAVLoginLimit(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	hashed, err := users.HashPwd("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Users.Save(&users.User{Username: "basic", Password: hashed}); err != nil {
+		t.Fatal(err)
+	}
+	set, err := st.Settings.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &settings.Server{Root: t.TempDir(), LoginMaxAttempts: 2, LoginLockout: "1m"}
+	l := newLoginLimiter(server, nil, &ipFilters{})
+	fn := withBasicAuth(l, func(_ http.ResponseWriter, _ *http.Request, _ *data) (int, error) {
+		return http.StatusOK, nil
+	})
+	login := func(password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("PROPFIND", "/", nil)
+		if password != "" {
+			r.SetBasicAuth("basic", password)
+		}
+		recorder := httptest.NewRecorder()
+		status, _ := fn(recorder, r, &data{store: st, settings: set, server: server})
+		recorder.Code = status
+		return recorder
+	}
+
+	// the challenges without credentials aren't failures
+	for i := 0; i < 3; i++ {
+		login("")
+	}
+	if res := login("secret"); res.Code != http.StatusOK {
+		t.Fatalf("expected the password to be accepted, got %d", res.Code)
+	}
+
+	login("wrong")
+	login("wrong")
+	if res := login("secret"); res.Code != http.StatusTooManyRequests || res.Header().Get("Retry-After") == "" {
+		t.Errorf("expected the username to be locked out, got %d", res.Code)
+	}
+}
+
+func TestWebDAVQuota(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	hashed, err := users.HashPwd("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &users.User{
+		Username: "quota",
+		Password: hashed,
+		Scope:    ".",
+		Quota:    10,
+		Perm:     users.Permissions{Download: true, Create: true, Modify: true},
+	}
+	if err := st.Users.Save(user); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { quotaUsage.forget(user.ID) })
+	set, err := st.Settings.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &settings.Server{Root: t.TempDir()}
+	if err := os.WriteFile(filepath.Join(server.Root, "file.txt"), []byte("12345"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	fn := webdavHandler("/dav", newLoginLimiter(server, nil, &ipFilters{}))
+	serve := func(method, path, body string, length int64, header map[string]string) int {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.ContentLength = length
+		r.SetBasicAuth("quota", "secret")
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		recorder := httptest.NewRecorder()
+		status, _ := fn(recorder, r, &data{Runner: &runner.Runner{}, store: st, settings: set, server: server})
+		if status == 0 {
+			status = recorder.Code
+		}
+		return status
+	}
+
+	if status := serve(http.MethodPut, "/dav/big.txt", "123456", 6, nil); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected the length of an upload to be checked, got %d", status)
+	}
+	// without a length the upload is cut and removed
+	if status := serve(http.MethodPut, "/dav/big.txt", "123456", -1, nil); status < http.StatusBadRequest {
+		t.Errorf("expected the upload to fail, got %d", status)
+	}
+	if _, err := os.Stat(filepath.Join(server.Root, "big.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected the cut upload to be removed, got %v", err)
+	}
+	// the replaced file frees its space
+	if status := serve(http.MethodPut, "/dav/file.txt", "1234567890", 10, nil); status >= http.StatusBadRequest {
+		t.Errorf("expected the file to be replaced, got %d", status)
+	}
+
+	copyTo := map[string]string{"Destination": "http://example.com/dav/copy.txt"}
+	if status := serve("COPY", "/dav/file.txt", "", 0, copyTo); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected the copy to be checked, got %d", status)
+	}
+	if _, err := os.Stat(filepath.Join(server.Root, "copy.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected no copy, got %v", err)
+	}
+}
+
+func TestWebDAVUploadSize(t *testing.T) {
+	t.Parallel()
+
+	st := newSessionsStorage(t)
+	hashed, err := users.HashPwd("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &users.User{
+		Username: "limited",
+		Password: hashed,
+		Scope:    ".",
+		Perm:     users.Permissions{Download: true, Create: true, Modify: true},
+	}
+	if err := st.Users.Save(user); err != nil {
+		t.Fatal(err)
+	}
+	set, err := st.Settings.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.MaxUploadSize = 5
+	server := &settings.Server{Root: t.TempDir()}
+
+	fn := webdavHandler("/dav", newLoginLimiter(server, nil, &ipFilters{}))
+	put := func(name, body string, length int64) int {
+		r := httptest.NewRequest(http.MethodPut, "/dav/"+name, strings.NewReader(body))
+		r.ContentLength = length
+		r.SetBasicAuth("limited", "secret")
+		recorder := httptest.NewRecorder()
+		status, _ := fn(recorder, r, &data{Runner: &runner.Runner{}, store: st, settings: set, server: server})
+		if status == 0 {
+			status = recorder.Code
+		}
+		return status
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(server.Root, name))
+		return err == nil
+	}
+
+	if status := put("big.txt", "123456", 6); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected the length of an upload to be checked, got %d", status)
+	}
+	// without a length the upload is cut and removed
+	if status := put("big.txt", "123456", -1); status < http.StatusBadRequest || exists("big.txt") {
+		t.Errorf("expected the upload to fail and be removed, got %d", status)
+	}
+	if status := put("small.txt", "12345", 5); status >= http.StatusBadRequest || !exists("small.txt") {
+		t.Errorf("expected the upload to fit, got %d", status)
+	}
+
+	// the limit of the user comes first
+	user.MaxUploadSize = 10
+	if err := st.Users.Update(user, "MaxUploadSize"); err != nil {
+		t.Fatal(err)
+	}
+	if status := put("big.txt", "123456", 6); status >= http.StatusBadRequest || !exists("big.txt") {
+		t.Errorf("expected the limit of the user to apply, got %d", status)
+	}
+}
+
+func TestWebDAVEvent(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "/file.txt", []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		dst    string
+		want   string
+	}{
+		{"PUT", "/dav/file.txt", "", "save"},
+		{"PUT", "/dav/new.txt", "", "upload"},
+		{"DELETE", "/dav/file.txt", "", "delete"},
+		{"MOVE", "/dav/file.txt", "http://example.com/dav/renamed.txt", "rename"},
+		{"MOVE", "/dav/file.txt", "http://example.com/dav/dir/file.txt", "move"},
+		{"COPY", "/dav/file.txt", "http://example.com/dav/copy.txt", "copy"},
+		{"GET", "/dav/file.txt", "", "download"},
+		{"PROPFIND", "/dav/file.txt", "", ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.dst != "" {
+			r.Header.Set("Destination", tt.dst)
+		}
+
+		evt, src, dst := webdavEvent(r, "/dav", fs)
+		if evt != tt.want {
+			t.Errorf("%s %s: got event %q, want %q", tt.method, tt.path, evt, tt.want)
+		}
+		if src != "/file.txt" && src != "/new.txt" {
+			t.Errorf("%s %s: unexpected source %q", tt.method, tt.path, src)
+		}
+		if tt.dst != "" && dst == "" {
+			t.Errorf("%s %s: expected a destination", tt.method, tt.path)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package http
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// zipStream writes a zip archive to the response as it reads the files, so
+// that the memory used doesn't grow with the size of the archive.
+type zipStream struct {
+	ctx  context.Context
+	d    *data
+	w    *recordingWriter
+	zw   *zip.Writer
+	base string
+}
+
+// recordingWriter keeps the first error writing to the client, which means
+// that it went away and that the archive can't be completed.
+type recordingWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	n, err := w.w.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// streamZip sends the files, relative to commonDir, as a zip archive. Every
+// entry is checked against the scope and rules of the user. The archive
+// stops as soon as the client disconnects.
+func streamZip(w http.ResponseWriter, r *http.Request, d *data, filenames []string, commonDir string) (int, error) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Cache-Control", "private")
+	// the archive is generated on the fly, it can't be resumed
+	w.Header().Set("Accept-Ranges", "none")
+
+	rw := &recordingWriter{w: w}
+	z := &zipStream{ctx: r.Context(), d: d, w: rw, zw: zip.NewWriter(rw), base: commonDir}
+
+	for _, name := range filenames {
+		if err := z.add(name); err != nil {
+			if z.aborted() {
+				return 0, nil
+			}
+			log.Printf("Failed to archive %s: %v", name, err)
+		}
+	}
+
+	if err := z.zw.Close(); err != nil && !z.aborted() {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// aborted tells if the client went away.
+func (z *zipStream) aborted() bool {
+	return z.w.err != nil || z.ctx.Err() != nil
+}
+
+func (z *zipStream) add(path string) error {
+	if err := z.ctx.Err(); err != nil {
+		return err
+	}
+
+	if !z.d.Check(path) {
+		return nil
+	}
+
+	info, err := z.d.user.Fs.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		return nil
+	}
+
+	if path != z.base {
+		if err := z.write(path, info); err != nil {
+			return err
+		}
+	}
+
+	if !info.IsDir() {
+		return nil
+	}
+
+	dir, err := z.d.user.Fs.Open(path)
+	if err != nil {
+		return err
+	}
+	names, err := dir.Readdirnames(0)
+	dir.Close()
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		fPath := filepath.Join(path, name)
+		if err := z.add(fPath); err != nil {
+			if z.aborted() {
+				return err
+			}
+			log.Printf("Failed to archive %s: %v", fPath, err)
+		}
+	}
+
+	return nil
+}
+
+// write adds the entry of a file or directory to the archive.
+func (z *zipStream) write(path string, info os.FileInfo) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimPrefix(path, z.base)
+	name = strings.TrimPrefix(name, string(filepath.Separator))
+	header.Name = filepath.ToSlash(name)
+	if info.IsDir() {
+		header.Name += "/"
+	} else {
+		header.Method = zip.Deflate
+	}
+
+	entry, err := z.zw.CreateHeader(header)
+	if err != nil || info.IsDir() {
+		return err
+	}
+
+	fd, err := z.d.user.Fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	_, err = io.Copy(entry, fd)
+	if err != nil && !z.aborted() {
+		// the entry is already in the archive, which is now corrupted
+		return fmt.Errorf("archive truncated: %w", err)
+	}
+	return err
+}
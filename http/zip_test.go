@@ -0,0 +1,93 @@
+package http
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/rules"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func newZipData(t *testing.T) *data {
+	t.Helper()
+
+	fs := afero.NewMemMapFs()
+	for name, content := range map[string]string{
+		"/dir/a.txt":        "a",
+		"/dir/sub/b.txt":    "b",
+		"/dir/secret/c.txt": "c",
+	} {
+		if err := afero.WriteFile(fs, name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return &data{
+		settings: &settings.Settings{},
+		user: &users.User{
+			Fs:    fs,
+			Rules: []rules.Rule{{Path: "/dir/secret", Allow: false}},
+		},
+	}
+}
+
+func TestStreamZip(t *testing.T) {
+	d := newZipData(t)
+	recorder := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+
+	if _, err := streamZip(recorder, r, d, []string{"/dir"}, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+
+	body := recorder.Body.Bytes()
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("invalid archive: %v", err)
+	}
+
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+
+	if got := strings.Join(names, " "); got != "a.txt sub/ sub/b.txt" {
+		t.Errorf("expected the entries allowed by the rules, got %q", got)
+	}
+	if ct := recorder.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("expected a zip content type, got %q", ct)
+	}
+}
+
+type brokenWriter struct {
+	http.ResponseWriter
+	writes int
+}
+
+func (w *brokenWriter) Write([]byte) (int, error) {
+	w.writes++
+	return 0, errors.New("broken pipe")
+}
+
+func TestStreamZipClientGone(t *testing.T) {
+	d := newZipData(t)
+	w := &brokenWriter{ResponseWriter: httptest.NewRecorder()}
+	r := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+
+	if _, err := streamZip(w, r, d, []string{"/dir"}, "/dir"); err != nil {
+		t.Errorf("expected a disconnect not to be an error, got %v", err)
+	}
+	if w.writes != 1 {
+		t.Errorf("expected the archive to stop at the first failed write, got %d writes", w.writes)
+	}
+}
@@ -0,0 +1,158 @@
+// Package plugins extends the API with routes, and the operations with
+// listeners, without forking the server. The plugins are loaded from a
+// directory, either Go plugins built against the same version of the server
+// or programs it runs for each request, described by manifests.
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"plugin"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/filebrowser/filebrowser/v2/runner"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/storage"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// Symbol is the variable of type Plugin the Go plugins export.
+const Symbol = "Plugin"
+
+// ErrInvalidPlugin is returned for the plugins that can't be loaded.
+var ErrInvalidPlugin = errors.New("invalid plugin")
+
+var namePattern = regexp.MustCompile(`^[\w-]+$`)
+
+// Context is what the routes of the plugins are given about a request. The
+// user is the one of the request, with its permissions restricted like
+// they are for the API, and the runner runs the hooks of the operations on
+// its behalf.
+type Context struct {
+	User     *users.User
+	Store    *storage.Storage
+	Settings *settings.Settings
+	Server   *settings.Server
+	Runner   *runner.Runner
+}
+
+// HandlerFunc handles a request to a route of a plugin. Like the handlers of
+// the API, it returns the status to send, or 0 once it wrote the response.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request, c *Context) (int, error)
+
+// Route is a route of a plugin, served at /api/plugins/<name><path> to the
+// authenticated users, or to the admins only.
+type Route struct {
+	Method string
+	// Path may have the variables of gorilla/mux, such as {id}.
+	Path    string
+	Admin   bool
+	Handler HandlerFunc
+}
+
+// Plugin extends the server. A plugin that also implements runner.Listener
+// is told about the operations once they're done.
+type Plugin interface {
+	// Name names the routes of the plugin, and is unique.
+	Name() string
+	Routes() []Route
+}
+
+// Listeners returns the plugins that listen to the operations.
+func Listeners(plugins []Plugin) []runner.Listener {
+	listeners := []runner.Listener{}
+	for _, p := range plugins {
+		if l, ok := p.(runner.Listener); ok {
+			listeners = append(listeners, l)
+		}
+	}
+	return listeners
+}
+
+// Load loads the plugins of a directory: the Go plugins of its .so files,
+// which export a Plugin named by Symbol, and the programs of its .json
+// manifests, see Manifest. They're sorted by name.
+func Load(dir string) ([]Plugin, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	plugins := []Plugin{}
+	names := map[string]bool{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		var p Plugin
+		name := filepath.Join(dir, entry.Name())
+		switch filepath.Ext(name) {
+		case ".so":
+			p, err = openGoPlugin(name)
+		case ".json":
+			p, err = openManifest(name)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := validate(p); err != nil {
+			return nil, fmt.Errorf("%w %s: %v", ErrInvalidPlugin, name, err)
+		}
+		if names[p.Name()] {
+			return nil, fmt.Errorf("%w %s: duplicate name %q", ErrInvalidPlugin, name, p.Name())
+		}
+		names[p.Name()] = true
+		plugins = append(plugins, p)
+	}
+
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name() < plugins[j].Name() })
+	return plugins, nil
+}
+
+func openGoPlugin(name string) (Plugin, error) {
+	lib, err := plugin.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrInvalidPlugin, name, err)
+	}
+	sym, err := lib.Lookup(Symbol)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrInvalidPlugin, name, err)
+	}
+	p, ok := sym.(*Plugin)
+	if !ok || *p == nil {
+		return nil, fmt.Errorf("%w %s: %s is not a plugins.Plugin", ErrInvalidPlugin, name, Symbol)
+	}
+	return *p, nil
+}
+
+// validate checks the name and the routes of a plugin.
+func validate(p Plugin) error {
+	if !namePattern.MatchString(p.Name()) {
+		return fmt.Errorf("invalid name %q", p.Name())
+	}
+
+	routes := map[string]bool{}
+	for _, route := range p.Routes() {
+		switch {
+		case route.Method == "" || strings.ToUpper(route.Method) != route.Method:
+			return fmt.Errorf("invalid method %q", route.Method)
+		case !strings.HasPrefix(route.Path, "/"):
+			return fmt.Errorf("invalid path %q", route.Path)
+		case route.Handler == nil:
+			return fmt.Errorf("route %s %s has no handler", route.Method, route.Path)
+		case routes[route.Method+" "+route.Path]:
+			return fmt.Errorf("duplicate route %s %s", route.Method, route.Path)
+		}
+		routes[route.Method+" "+route.Path] = true
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package plugins
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(name, []byte(content), 0755); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "b.json"), `{"name": "b", "command": ["b.sh"], "routes": [{"method": "GET", "path": "/"}]}`)
+	writeFile(t, filepath.Join(dir, "a.json"), `{"name": "a", "command": ["a.sh"], "events": ["after_upload"]}`)
+	writeFile(t, filepath.Join(dir, "README"), "not a plugin")
+
+	plugs, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plugs) != 2 || plugs[0].Name() != "a" || plugs[1].Name() != "b" {
+		t.Fatalf("expected the plugins a and b, got %v", plugs)
+	}
+	if len(Listeners(plugs)) != 2 {
+		t.Error("expected the programs to listen to the operations")
+	}
+
+	for _, manifest := range []string{
+		`{"name": "a", "command": []}`,
+		`{"name": "a b", "command": ["a"]}`,
+		`{"name": "a", "command": ["a"], "timeout": "soon"}`,
+		`{"name": "a", "command": ["a"], "routes": [{"method": "get", "path": "/"}]}`,
+		`{"name": "a", "command": ["a"], "routes": [{"method": "GET", "path": "x"}]}`,
+		`{"name": "a", "command": ["a"], "routes": [{"method": "GET", "path": "/"}, {"method": "GET", "path": "/"}]}`,
+	} {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "a.json"), manifest)
+		if _, err := Load(dir); !errors.Is(err, ErrInvalidPlugin) {
+			t.Errorf("expected %s to be invalid, got %v", manifest, err)
+		}
+	}
+
+	// the names are unique
+	writeFile(t, filepath.Join(dir, "c.json"), `{"name": "a", "command": ["c.sh"]}`)
+	if _, err := Load(dir); !errors.Is(err, ErrInvalidPlugin) {
+		t.Errorf("expected the duplicate name to be refused, got %v", err)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell to run the plugin with")
+	}
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "plugin.sh"), `#!/bin/sh
+req=$(cat)
+case "$req" in
+*'"type":"event"'*) echo "$req" > event.json ;;
+*) printf '{"status": 201, "headers": {"X-Plugin": "yes"}, "body": "%s"}' "$(echo "$req" | grep -o '"username":"[^"]*"')" | sed 's/"username":"\([^"]*\)"/\1/' ;;
+esac
+`)
+	writeFile(t, filepath.Join(dir, "plugin.json"), `{
+		"name": "echo",
+		"command": ["sh", "plugin.sh"],
+		"routes": [{"method": "POST", "path": "/echo"}],
+		"events": ["after_upload"]
+	}`)
+
+	plugs, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := plugs[0].(*Process)
+	user := &users.User{ID: 1, Username: "alice", Scope: "/alice"}
+
+	recorder := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/plugins/echo/echo", strings.NewReader("body"))
+	status, err := p.Routes()[0].Handler(recorder, r, &Context{User: user})
+	switch {
+	case err != nil || status != 0:
+		t.Fatalf("expected the response to be written, got %d and %v", status, err)
+	case recorder.Code != http.StatusCreated || recorder.Header().Get("X-Plugin") != "yes":
+		t.Fatalf("expected the status and the headers of the program, got %d and %v", recorder.Code, recorder.Header())
+	case recorder.Body.String() != "alice":
+		t.Fatalf("expected the program to get the user, got %q", recorder.Body.String())
+	}
+
+	// the events it doesn't listen to are ignored
+	p.OperationDone("after_delete", "/a.txt", "", user)
+	p.OperationDone("after_upload", "/b.txt", "", user)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		event, err := os.ReadFile(filepath.Join(dir, "event.json"))
+		if err == nil && strings.Contains(string(event), `"src":"/b.txt"`) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the program to be told about the upload, got %q", event)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
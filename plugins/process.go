@@ -0,0 +1,230 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+const (
+	// DefaultTimeout limits the runs of the programs whose manifest sets
+	// no timeout.
+	DefaultTimeout = 30 * time.Second
+	// maxRequestBody is the size of the bodies given to the programs.
+	maxRequestBody = 10 << 20
+)
+
+// Manifest describes a program run as a plugin, in a .json file of the
+// plugins directory. The program is run for each request to its routes and
+// each of its events, with a ProcessRequest on its standard input.
+type Manifest struct {
+	Name string `json:"name"`
+	// Command is the program and its arguments. A relative program is
+	// looked up in the directory of the manifest, then in the PATH.
+	Command []string        `json:"command"`
+	Routes  []ManifestRoute `json:"routes"`
+	// Events are the events the program is told about once the operations
+	// are done, such as after_upload.
+	Events []string `json:"events"`
+	// Timeout limits each run, DefaultTimeout if empty.
+	Timeout string `json:"timeout"`
+}
+
+// ManifestRoute is a route of a program, see Route.
+type ManifestRoute struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Admin  bool   `json:"admin"`
+}
+
+// ProcessUser is the user of a request or an event given to a program.
+type ProcessUser struct {
+	ID       uint              `json:"id"`
+	Username string            `json:"username"`
+	Scope    string            `json:"scope"`
+	Perm     users.Permissions `json:"perm"`
+}
+
+// ProcessRequest is given to the programs, a request to one of their routes
+// if its type is route, or an operation if it's event. The paths of the
+// events are relative to the scope of the user.
+type ProcessRequest struct {
+	Type   string              `json:"type"`
+	Method string              `json:"method,omitempty"`
+	Route  string              `json:"route,omitempty"`
+	Path   string              `json:"path,omitempty"`
+	Vars   map[string]string   `json:"vars,omitempty"`
+	Query  map[string][]string `json:"query,omitempty"`
+	// Body is the body of the request, which is expected to be text.
+	Body        string      `json:"body,omitempty"`
+	Event       string      `json:"event,omitempty"`
+	Source      string      `json:"src,omitempty"`
+	Destination string      `json:"dst,omitempty"`
+	User        ProcessUser `json:"user"`
+}
+
+// ProcessResponse is what the programs write to their standard output for
+// the requests to their routes. The status is 200 if zero.
+type ProcessResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// Process is a plugin run as a program.
+type Process struct {
+	Manifest
+	// Dir is the directory of the manifest, where the program runs.
+	Dir     string
+	timeout time.Duration
+	events  map[string]bool
+}
+
+func openManifest(name string) (*Process, error) {
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Process{Dir: filepath.Dir(name), timeout: DefaultTimeout, events: map[string]bool{}}
+	if err := json.Unmarshal(raw, &p.Manifest); err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrInvalidPlugin, name, err)
+	}
+	if len(p.Command) == 0 {
+		return nil, fmt.Errorf("%w %s: no command", ErrInvalidPlugin, name)
+	}
+	if p.Timeout != "" {
+		if p.timeout, err = time.ParseDuration(p.Timeout); err != nil || p.timeout <= 0 {
+			return nil, fmt.Errorf("%w %s: invalid timeout %q", ErrInvalidPlugin, name, p.Timeout)
+		}
+	}
+	for _, evt := range p.Events {
+		p.events[evt] = true
+	}
+	return p, nil
+}
+
+// Name implements Plugin.
+func (p *Process) Name() string {
+	return p.Manifest.Name
+}
+
+// Routes implements Plugin, running the program for each request.
+func (p *Process) Routes() []Route {
+	routes := make([]Route, 0, len(p.Manifest.Routes))
+	for _, route := range p.Manifest.Routes {
+		route := route
+		routes = append(routes, Route{
+			Method: route.Method,
+			Path:   route.Path,
+			Admin:  route.Admin,
+			Handler: func(w http.ResponseWriter, r *http.Request, c *Context) (int, error) {
+				return p.serve(w, r, c, route.Path)
+			},
+		})
+	}
+	return routes
+}
+
+func (p *Process) serve(w http.ResponseWriter, r *http.Request, c *Context, route string) (int, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody+1))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if len(body) > maxRequestBody {
+		return http.StatusRequestEntityTooLarge, nil
+	}
+
+	out, err := p.run(r.Context(), ProcessRequest{
+		Type:   "route",
+		Method: r.Method,
+		Route:  route,
+		Path:   r.URL.Path,
+		Vars:   mux.Vars(r),
+		Query:  r.URL.Query(),
+		Body:   string(body),
+		User:   processUser(c.User),
+	})
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+
+	var res ProcessResponse
+	if err := json.Unmarshal(out, &res); err != nil {
+		return http.StatusBadGateway, fmt.Errorf("plugin %s: invalid response: %w", p.Name(), err)
+	}
+	if res.Status == 0 {
+		res.Status = http.StatusOK
+	}
+	for k, v := range res.Headers {
+		w.Header().Set(k, v)
+	}
+	w.WriteHeader(res.Status)
+	if _, err := io.WriteString(w, res.Body); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return 0, nil
+}
+
+// OperationDone implements runner.Listener, running the program for its
+// events in the background.
+func (p *Process) OperationDone(event, src, dst string, user *users.User) {
+	if !p.events[event] {
+		return
+	}
+
+	req := ProcessRequest{Type: "event", Event: event, Source: src, Destination: dst, User: processUser(user)}
+	go func() {
+		if _, err := p.run(context.Background(), req); err != nil {
+			log.Printf("[WARN] Plugin %s failed for %s of %s: %v", p.Name(), event, src, err)
+		}
+	}()
+}
+
+// run runs the program with a request, returning its output.
+func (p *Process) run(ctx context.Context, req ProcessRequest) ([]byte, error) {
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	program := p.Command[0]
+	if !filepath.IsAbs(program) {
+		if _, err := os.Stat(filepath.Join(p.Dir, program)); err == nil {
+			program = filepath.Join(p.Dir, program)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, program, p.Command[1:]...) //nolint:gosec
+	cmd.Dir = p.Dir
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("plugin %s: %w: %s", p.Name(), err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
+
+func processUser(user *users.User) ProcessUser {
+	if user == nil {
+		return ProcessUser{}
+	}
+	return ProcessUser{ID: user.ID, Username: user.Username, Scope: user.Scope, Perm: user.Perm}
+}
@@ -1,9 +1,27 @@
 package rules
 
 import (
+	"fmt"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/filebrowser/filebrowser/v2/errors"
+)
+
+// The types of the rules.
+const (
+	// TypePath rules match the paths starting with their Path.
+	TypePath = "path"
+	// TypeGlob rules match the paths, or the files under the paths, that
+	// match their Path as a pattern. A pattern with no slash matches the
+	// base names at any depth, and ** matches any number of directories.
+	TypeGlob = "glob"
+	// TypeRegex rules match the paths their Regexp matches.
+	TypeRegex = "regex"
 )
 
 // Checker is a Rules checker.
@@ -11,12 +29,21 @@ type Checker interface {
 	Check(path string) bool
 }
 
-// Rule is a allow/disallow rule.
+// Rule is a allow/disallow rule. The paths and the patterns are compared
+// in the NFC normal form, so that the names written by any platform match.
 type Rule struct {
+	// Type is TypePath, TypeGlob or TypeRegex. The rules without one are
+	// from before the types, Regex telling which one they are.
+	Type   string  `json:"type"`
 	Regex  bool    `json:"regex"`
 	Allow  bool    `json:"allow"`
 	Path   string  `json:"path"`
 	Regexp *Regexp `json:"regexp"`
+	// IgnoreCase matches the paths whatever their case.
+	IgnoreCase bool `json:"ignoreCase"`
+	// Anchored matches the regex against the whole path rather than any
+	// part of it. The other types are always anchored.
+	Anchored bool `json:"anchored"`
 }
 
 // MatchHidden matches paths with a basename
@@ -25,13 +52,165 @@ func MatchHidden(path string) bool {
 	return path != "" && strings.HasPrefix(filepath.Base(path), ".")
 }
 
+// Kind returns the type of the rule, telling the one of the rules saved
+// before the types from Regex.
+func (r *Rule) Kind() string {
+	switch {
+	case r.Type != "":
+		return r.Type
+	case r.Regex:
+		return TypeRegex
+	default:
+		return TypePath
+	}
+}
+
 // Matches matches a path against a rule.
 func (r *Rule) Matches(path string) bool {
-	if r.Regex {
-		return r.Regexp.MatchString(path)
+	path = norm.NFC.String(path)
+
+	if r.Kind() == TypePath {
+		prefix := norm.NFC.String(r.Path)
+		if r.IgnoreCase {
+			return strings.HasPrefix(strings.ToLower(path), strings.ToLower(prefix))
+		}
+		return strings.HasPrefix(path, prefix)
 	}
 
-	return strings.HasPrefix(path, r.Path)
+	expr, err := r.expression()
+	if err != nil {
+		panic(err)
+	}
+	return compile(expr).MatchString(path)
+}
+
+// Validate returns an error if the type of the rule is unknown or its
+// expression doesn't compile.
+func (r *Rule) Validate() error {
+	switch r.Kind() {
+	case TypePath:
+		return nil
+	case TypeGlob, TypeRegex:
+		expr, err := r.expression()
+		if err != nil {
+			return err
+		}
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("%w: %v", errors.ErrInvalidRule, err) //nolint:errorlint
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown type %q", errors.ErrInvalidRule, r.Type)
+	}
+}
+
+// Validate returns the error of the first invalid rule of a list.
+func Validate(rules []Rule) error {
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expression returns the regular expression of a glob or regex rule, with
+// its flags.
+func (r *Rule) expression() (string, error) {
+	var expr string
+	if r.Kind() == TypeGlob {
+		expr = globExpression(norm.NFC.String(r.Path))
+	} else {
+		if r.Regexp == nil {
+			return "", fmt.Errorf("%w: no regexp", errors.ErrInvalidRule)
+		}
+		expr = norm.NFC.String(r.Regexp.Raw)
+		if r.Anchored {
+			expr = "^(?:" + expr + ")$"
+		}
+	}
+
+	if r.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	return expr, nil
+}
+
+// globExpression returns the regular expression of a glob pattern.
+func globExpression(pattern string) string {
+	var expr strings.Builder
+	if strings.Contains(strings.TrimSuffix(pattern, "/"), "/") {
+		expr.WriteString("^")
+		if !strings.HasPrefix(pattern, "/") {
+			expr.WriteString("/")
+		}
+	} else {
+		expr.WriteString("(?:^|/)")
+	}
+
+	pattern = strings.TrimSuffix(pattern, "/")
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				expr.WriteString("(?:.*/)?")
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				expr.WriteString(".*")
+				i++
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	expr.WriteString("(?:/.*)?$")
+	return expr.String()
+}
+
+// maxCompiled is the number of regular expressions kept compiled.
+const maxCompiled = 1024
+
+// compiled keeps the regular expressions of the rules, which are matched
+// against every path that is listed. It starts over once full, so that the
+// rules edited over time don't fill the memory.
+var compiled = struct {
+	sync.RWMutex
+	exprs map[string]*regexp.Regexp
+}{exprs: map[string]*regexp.Regexp{}}
+
+func compile(expr string) *regexp.Regexp {
+	compiled.RLock()
+	re, ok := compiled.exprs[expr]
+	compiled.RUnlock()
+	if ok {
+		return re
+	}
+
+	re = regexp.MustCompile(expr)
+	compiled.Lock()
+	if len(compiled.exprs) >= maxCompiled {
+		compiled.exprs = map[string]*regexp.Regexp{}
+	}
+	compiled.exprs[expr] = re
+	compiled.Unlock()
+	return re
 }
 
 // Regexp is a wrapper to the native regexp type where we
@@ -1,6 +1,12 @@
 package rules
 
-import "testing"
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+)
 
 func TestMatchHidden(t *testing.T) {
 	cases := map[string]bool{
@@ -21,3 +27,97 @@ func TestMatchHidden(t *testing.T) {
 		}
 	}
 }
+
+func TestRuleMatches(t *testing.T) {
+	regex := func(raw string) *Regexp { return &Regexp{Raw: raw} }
+
+	cases := []struct {
+		rule Rule
+		path string
+		want bool
+	}{
+		// the rules saved before the types
+		{Rule{Path: "/private"}, "/private/a.txt", true},
+		{Rule{Regex: true, Regexp: regex(`\.log$`)}, "/a/b.log", true},
+
+		// paths are prefixes, not directories
+		{Rule{Type: TypePath, Path: "/private"}, "/privateer", true},
+		{Rule{Type: TypePath, Path: "/private/"}, "/privateer", false},
+		{Rule{Type: TypePath, Path: "/Private"}, "/private/a", false},
+		{Rule{Type: TypePath, Path: "/Private", IgnoreCase: true}, "/PRIVATE/a", true},
+
+		// globs match whole segments, and the files under them
+		{Rule{Type: TypeGlob, Path: "*.log"}, "/a/b/c.log", true},
+		{Rule{Type: TypeGlob, Path: "*.log"}, "/a/c.log.txt", false},
+		{Rule{Type: TypeGlob, Path: "*.LOG", IgnoreCase: true}, "/c.log", true},
+		{Rule{Type: TypeGlob, Path: "/private"}, "/private/a/b", true},
+		{Rule{Type: TypeGlob, Path: "/private"}, "/privateer", false},
+		{Rule{Type: TypeGlob, Path: "/docs/*.md"}, "/docs/a.md", true},
+		{Rule{Type: TypeGlob, Path: "/docs/*.md"}, "/docs/sub/a.md", false},
+		{Rule{Type: TypeGlob, Path: "/docs/**/*.md"}, "/docs/a.md", true},
+		{Rule{Type: TypeGlob, Path: "/docs/**/*.md"}, "/docs/sub/dir/a.md", true},
+		{Rule{Type: TypeGlob, Path: "docs/?.md"}, "/docs/a.md", true},
+		{Rule{Type: TypeGlob, Path: "docs/?.md"}, "/x/docs/a.md", false},
+		{Rule{Type: TypeGlob, Path: "/[!a]*.txt"}, "/b.txt", true},
+		{Rule{Type: TypeGlob, Path: "/[!a]*.txt"}, "/a.txt", false},
+		{Rule{Type: TypeGlob, Path: "/a+b (1).txt"}, "/a+b (1).txt", true},
+
+		// regexes match any part of the path unless anchored
+		{Rule{Type: TypeRegex, Regexp: regex(`secret`)}, "/my-secret-file", true},
+		{Rule{Type: TypeRegex, Regexp: regex(`secret`), Anchored: true}, "/my-secret-file", false},
+		{Rule{Type: TypeRegex, Regexp: regex(`/secret.*`), Anchored: true}, "/secret/file", true},
+		{Rule{Type: TypeRegex, Regexp: regex(`a|/b`), Anchored: true}, "/b", true},
+		{Rule{Type: TypeRegex, Regexp: regex(`a|/b`), Anchored: true}, "/ba", false},
+		{Rule{Type: TypeRegex, Regexp: regex(`SECRET`), IgnoreCase: true}, "/secret", true},
+
+		// the names are compared in the same normal form: "é" is composed
+		// in the rules and decomposed in the paths, as on macOS
+		{Rule{Type: TypePath, Path: "/caf\u00e9"}, "/cafe\u0301/menu", true},
+		{Rule{Type: TypeGlob, Path: "caf\u00e9.txt"}, "/cafe\u0301.txt", true},
+		{Rule{Type: TypeRegex, Regexp: regex("^/caf\u00e9$")}, "/cafe\u0301", true},
+		{Rule{Type: TypeGlob, Path: "/\u00c9t\u00e9", IgnoreCase: true}, "/e\u0301te\u0301", true},
+	}
+
+	for _, c := range cases {
+		if got := c.rule.Matches(c.path); got != c.want {
+			t.Errorf("%+v.Matches(%q)=%v; want %v", c.rule, c.path, got, c.want)
+		}
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	valid := []Rule{
+		{Path: "/a"},
+		{Type: TypeGlob, Path: "/[a"},
+		{Type: TypeRegex, Regexp: &Regexp{Raw: `^/a$`}},
+	}
+	if err := Validate(valid); err != nil {
+		t.Errorf("Validate(%+v)=%v; want nil", valid, err)
+	}
+
+	invalid := []Rule{
+		{Type: "prefix", Path: "/a"},
+		{Type: TypeRegex},
+		{Type: TypeRegex, Regexp: &Regexp{Raw: `(`}},
+	}
+	for _, rule := range invalid {
+		if err := rule.Validate(); !errors.Is(err, fbErrors.ErrInvalidRule) {
+			t.Errorf("%+v.Validate()=%v; want ErrInvalidRule", rule, err)
+		}
+	}
+}
+
+func TestCompileBounded(t *testing.T) {
+	for i := 0; i <= 2*maxCompiled; i++ {
+		rule := Rule{Type: TypeGlob, Path: "/dir" + strconv.Itoa(i)}
+		if !rule.Matches("/dir" + strconv.Itoa(i) + "/file") {
+			t.Fatalf("expected %s to match", rule.Path)
+		}
+	}
+
+	compiled.RLock()
+	defer compiled.RUnlock()
+	if n := len(compiled.exprs); n > maxCompiled {
+		t.Errorf("expected at most %d compiled expressions, got %d", maxCompiled, n)
+	}
+}
@@ -0,0 +1,251 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// AuditRecord is an entry of the audit log, written for every command run,
+// blocking or not, once it is done.
+//
+// The records are chained: each one has the hash of the previous one, so
+// that removing or changing a record breaks the chain, see VerifyAuditLog.
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	UserName   string    `json:"username"`
+	Event      string    `json:"event"`
+	Path       string    `json:"path"`
+	Command    string    `json:"command"`
+	Blocking   bool      `json:"blocking"`
+	ExitCode   int       `json:"exit_code"`
+	DurationMs int64     `json:"duration_ms"`
+	RequestID  string    `json:"request_id,omitempty"`
+	JobID      string    `json:"job_id,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	// PrevHash is the Hash of the previous record, empty for the first one.
+	PrevHash string `json:"prev_hash"`
+	// Hash is the SHA-256 of the record without it.
+	Hash string `json:"hash"`
+}
+
+// hash returns the hash of the record, computed without its Hash.
+func (a AuditRecord) hash() (string, error) {
+	a.Hash = ""
+	data, err := json.Marshal(a)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditSink stores the audit records. The records are only ever appended.
+// Record is called concurrently.
+type AuditSink interface {
+	Record(ctx context.Context, rec AuditRecord) error
+}
+
+// auditChain links the records written by a sink, starting from the last
+// record already stored when the first one is written.
+type auditChain struct {
+	mu     sync.Mutex
+	loaded bool
+	prev   string
+}
+
+// append seals a record with the hash of the previous one and stores it
+// with write, keeping the records in the order they are chained.
+func (c *auditChain) append(rec AuditRecord, last func() (string, error), write func([]byte) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.loaded {
+		prev, err := last()
+		if err != nil {
+			return err
+		}
+		c.prev, c.loaded = prev, true
+	}
+
+	rec.PrevHash = c.prev
+	hash, err := rec.hash()
+	if err != nil {
+		return err
+	}
+	rec.Hash = hash
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := write(data); err != nil {
+		return err
+	}
+
+	c.prev = hash
+	return nil
+}
+
+// lastHash returns the hash of the last of the records, empty if there are
+// none.
+func lastHash(line []byte) (string, error) {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return "", nil
+	}
+
+	var rec AuditRecord
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return "", fmt.Errorf("invalid audit record: %w", err)
+	}
+	return rec.Hash, nil
+}
+
+// FileAuditSink appends the records to a file, one JSON object per line.
+// The file must only be written by a single instance.
+type FileAuditSink struct {
+	Path string
+
+	chain auditChain
+}
+
+// Record implements AuditSink.
+func (s *FileAuditSink) Record(_ context.Context, rec AuditRecord) error {
+	return s.chain.append(rec, s.last, func(data []byte) error {
+		fd, err := os.OpenFile(s.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600) //nolint:gomnd
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+
+		_, err = fd.Write(append(data, '\n'))
+		return err
+	})
+}
+
+func (s *FileAuditSink) last() (string, error) {
+	fd, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+
+	var line []byte
+	scanner := bufio.NewScanner(fd)
+	scanner.Buffer(nil, 1<<20) //nolint:gomnd
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+			line = append(line[:0], scanner.Bytes()...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return lastHash(line)
+}
+
+// RedisAuditSink appends the records to a redis list, which must only be
+// written by a single instance.
+type RedisAuditSink struct {
+	Client *redis.Client
+	Key    string
+
+	chain auditChain
+}
+
+// Record implements AuditSink.
+func (s *RedisAuditSink) Record(ctx context.Context, rec AuditRecord) error {
+	last := func() (string, error) {
+		line, err := s.Client.LIndex(ctx, s.Key, -1).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return lastHash(line)
+	}
+
+	return s.chain.append(rec, last, func(data []byte) error {
+		return s.Client.RPush(ctx, s.Key, data).Err()
+	})
+}
+
+// VerifyAuditLog checks the chain of the records of an audit log, one per
+// line. It returns an error for the first record that was changed, or that
+// doesn't follow the previous one.
+func VerifyAuditLog(r io.Reader) error {
+	prev := ""
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20) //nolint:gomnd
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var rec AuditRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+
+		hash, err := rec.hash()
+		if err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+		if hash != rec.Hash {
+			return fmt.Errorf("record %d was modified", n)
+		}
+		if rec.PrevHash != prev {
+			return fmt.Errorf("record %d doesn't follow the previous one", n)
+		}
+		prev = rec.Hash
+	}
+
+	return scanner.Err()
+}
+
+// audit records a finished command in the audit sink, if any.
+func (r *Runner) audit(c *commandLog, elapsed time.Duration, err error) {
+	if r.Audit == nil {
+		return
+	}
+
+	rec := AuditRecord{
+		Time:       time.Now().UTC(),
+		UserName:   c.username,
+		Event:      c.evt,
+		Path:       c.path,
+		Command:    strings.Join(c.command, " "),
+		Blocking:   c.blocking,
+		ExitCode:   exitCode(err),
+		DurationMs: elapsed.Milliseconds(),
+		RequestID:  c.requestID,
+		JobID:      c.jobID,
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	if err := r.Audit.Record(context.Background(), rec); err != nil {
+		r.logWarn("Failed to write the audit log", err)
+	}
+}
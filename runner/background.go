@@ -0,0 +1,252 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// BackgroundHookWait is how long a non-blocking command waits for one of
+// the running ones to finish when the limit of background hooks is reached.
+const BackgroundHookWait = 5 * time.Second
+
+// ErrTooManyBackgroundHooks is returned when a non-blocking command can't
+// be started because too many of them are already running.
+var ErrTooManyBackgroundHooks = errors.New("too many background hooks running, try again later")
+
+// ErrJobNotFound is returned when canceling a background hook that isn't
+// running.
+var ErrJobNotFound = errors.New("background hook not found")
+
+// CancelGracePeriod is how long a canceled background hook has to exit
+// after SIGTERM before it is killed.
+const CancelGracePeriod = 10 * time.Second
+
+// ErrShutdown is returned when a non-blocking command is run after the
+// runner was shut down.
+var ErrShutdown = errors.New("hook runner is shutting down")
+
+// backgroundHooks tracks the non-blocking commands that are running.
+type backgroundHooks struct {
+	// slots limits the commands running at once, nil means no limit.
+	slots chan struct{}
+
+	mu      sync.Mutex
+	closed  bool
+	running sync.WaitGroup
+	// jobs are the running commands by job ID.
+	jobs map[string]*backgroundJob
+}
+
+// backgroundJob is a running non-blocking command.
+type backgroundJob struct {
+	info    BackgroundJob
+	process *os.Process
+	done    chan struct{}
+}
+
+// BackgroundJob describes a running non-blocking command.
+type BackgroundJob struct {
+	ID      string    `json:"id"`
+	Command string    `json:"command"`
+	Event   string    `json:"event"`
+	Started time.Time `json:"started"`
+}
+
+func newBackgroundHooks(limit int) *backgroundHooks {
+	b := &backgroundHooks{jobs: map[string]*backgroundJob{}}
+	if limit > 0 {
+		b.slots = make(chan struct{}, limit)
+	}
+	return b
+}
+
+// acquire takes a slot for a non-blocking command, waiting up to
+// BackgroundHookWait if all of them are taken.
+func (b *backgroundHooks) acquire() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrShutdown
+	}
+	b.running.Add(1)
+	b.mu.Unlock()
+
+	if b.slots == nil {
+		return nil
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(BackgroundHookWait)
+	defer timer.Stop()
+
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		b.running.Done()
+		return ErrTooManyBackgroundHooks
+	}
+}
+
+func (b *backgroundHooks) release() {
+	if b == nil {
+		return
+	}
+
+	if b.slots != nil {
+		<-b.slots
+	}
+	b.running.Done()
+}
+
+// track registers a started command so that it can be canceled. The
+// returned function must be called once the command exited.
+func (b *backgroundHooks) track(c *commandLog, process *os.Process) func() {
+	if b == nil {
+		return func() {}
+	}
+
+	job := &backgroundJob{
+		info: BackgroundJob{
+			ID:      c.jobID,
+			Command: strings.Join(c.command, " "),
+			Event:   c.evt,
+			Started: time.Now(),
+		},
+		process: process,
+		done:    make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	b.jobs[c.jobID] = job
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		delete(b.jobs, c.jobID)
+		b.mu.Unlock()
+		close(job.done)
+	}
+}
+
+// BackgroundJobs returns the non-blocking commands that are running, oldest
+// first. Their IDs are also in the logs of the commands.
+func (r *Runner) BackgroundJobs() []BackgroundJob {
+	b := r.background
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	jobs := make([]BackgroundJob, 0, len(b.jobs))
+	for _, job := range b.jobs {
+		jobs = append(jobs, job.info)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Started.Before(jobs[j].Started)
+	})
+	return jobs
+}
+
+// Cancel stops a running non-blocking command by its job ID. The command is
+// sent SIGTERM, and killed if it didn't exit after CancelGracePeriod.
+func (r *Runner) Cancel(jobID string) error {
+	b := r.background
+	if b == nil {
+		return ErrJobNotFound
+	}
+
+	b.mu.Lock()
+	job, ok := b.jobs[jobID]
+	b.mu.Unlock()
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	// SIGTERM isn't supported everywhere, e.g. on windows
+	if err := job.process.Signal(syscall.SIGTERM); err != nil {
+		return job.process.Kill()
+	}
+
+	go func() {
+		timer := time.NewTimer(CancelGracePeriod)
+		defer timer.Stop()
+
+		select {
+		case <-job.done:
+		case <-timer.C:
+			_ = job.process.Kill()
+		}
+	}()
+
+	return nil
+}
+
+// Go runs a function in the background, such as a long operation on the
+// files, which Shutdown waits for like the non-blocking commands. It isn't
+// limited by their slots, and returns ErrShutdown once the runner is shut
+// down.
+func (r *Runner) Go(fn func()) error {
+	b := r.background
+	if b == nil {
+		go fn()
+		return nil
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrShutdown
+	}
+	b.running.Add(1)
+	b.mu.Unlock()
+
+	go func() {
+		defer b.running.Done()
+		fn()
+	}()
+	return nil
+}
+
+// Shutdown stops the runner from starting new non-blocking commands and
+// waits for the running ones to finish, or for the context to be done.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	b := r.background
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,102 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of running a before hook that failed
+// too many times in a row, until its cooldown ends.
+var ErrCircuitOpen = errors.New("hook is failing repeatedly, skipped")
+
+// breaker is a set of circuit breakers, one per event and command. A
+// circuit opens after a number of consecutive failures. Once the cooldown
+// ends, a single run is let through: its success closes the circuit, its
+// failure opens it again.
+type breaker struct {
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker() *breaker {
+	return &breaker{circuits: map[string]*circuit{}}
+}
+
+func (b *breaker) allow(key string, threshold int, cooldown time.Duration) error {
+	if b == nil || threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[key]
+	if !ok || c.failures < threshold {
+		return nil
+	}
+
+	if c.probing || time.Since(c.openedAt) < cooldown {
+		return ErrCircuitOpen
+	}
+
+	c.probing = true
+	return nil
+}
+
+func (b *breaker) record(key string, threshold int, err error) {
+	if b == nil || threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		delete(b.circuits, key)
+		return
+	}
+
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+
+	c.failures++
+	c.probing = false
+	if c.failures >= threshold {
+		c.openedAt = time.Now()
+	}
+}
+
+// runBefore runs a before hook through its circuit breaker.
+func (r *Runner) runBefore(ctx context.Context, command string, evt *hookEvent) (*ExecResult, error) {
+	var threshold int
+	var cooldown time.Duration
+	if r.Settings != nil {
+		threshold = r.HookBreaker.Threshold
+		cooldown = r.HookBreaker.GetCooldown()
+	}
+
+	key := evt.name + "\x00" + command
+	if err := r.breaker.allow(key, threshold, cooldown); err != nil {
+		return nil, err
+	}
+
+	result, err := r.exec(ctx, command, evt)
+	// a rejection is the hook working as intended
+	if rejection(result) != nil {
+		err = nil
+	}
+	r.breaker.record(key, threshold, err)
+
+	return result, err
+}
@@ -0,0 +1,118 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// ErrPathNotAllowed is returned when a hook would be given a path that is
+// outside of the user scope or denied by the rules.
+var ErrPathNotAllowed = errors.New("path not allowed for hooks")
+
+// ErrCommandNotAllowed is returned when a hook runs an executable that is
+// not in the allowed commands of the settings.
+var ErrCommandNotAllowed = errors.New("command not allowed")
+
+// checkAllowed verifies that an executable is in the allowed commands, if
+// any. A name in the list only allows the executable of that name found in
+// the PATH, while an absolute path allows that file. When the commands run
+// through a shell, the shell is what must be allowed.
+func (r *Runner) checkAllowed(name string) error {
+	if r.Settings == nil || len(r.AllowedCommands) == 0 {
+		return nil
+	}
+
+	resolved, err := exec.LookPath(name)
+	if err == nil {
+		resolved, err = filepath.Abs(resolved)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCommandNotAllowed, name, err)
+	}
+
+	byName := !strings.ContainsRune(name, filepath.Separator) && !strings.ContainsRune(name, '/')
+	for _, allowed := range r.AllowedCommands {
+		if filepath.IsAbs(allowed) {
+			if filepath.Clean(allowed) == resolved {
+				return nil
+			}
+		} else if byName && allowed == name {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrCommandNotAllowed, name)
+}
+
+// checkPaths verifies that the paths of an event, which are passed to the
+// commands as $FILE and $DESTINATION, are inside the user scope and allowed
+// by the rules of the runner Checker.
+func (r *Runner) checkPaths(evt *hookEvent) error {
+	dstUser := evt.dstUser
+	if dstUser == nil {
+		dstUser = evt.user
+	}
+	paths := []struct {
+		rel  string
+		full string
+		user *users.User
+	}{
+		{evt.relPath, evt.path, evt.user},
+		{evt.relDst, evt.dst, dstUser},
+	}
+
+	for _, p := range paths {
+		if p.rel == "" {
+			continue
+		}
+
+		if !InsideScope(p.user, p.full) {
+			return fmt.Errorf("%w: %s is outside of the user scope", ErrPathNotAllowed, p.rel)
+		}
+
+		// the rules are the ones of the user, the handlers check the
+		// destinations in the scopes of the others
+		if r.Checker != nil && p.user == evt.user && !r.Checker.Check(p.rel) {
+			return fmt.Errorf("%w: %s is denied by the rules", ErrPathNotAllowed, p.rel)
+		}
+	}
+
+	return nil
+}
+
+// InsideScope tells if a full path is inside the user scope, following the
+// symbolic links.
+func InsideScope(user *users.User, full string) bool {
+	scope := evalSymlinks(user.FullPath("/"))
+	rel, err := filepath.Rel(scope, evalSymlinks(full))
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// evalSymlinks resolves the symbolic links of the longest existing part of
+// a path, so that a file about to be created under a link is resolved too.
+func evalSymlinks(path string) string {
+	path = filepath.Clean(path)
+
+	rest := ""
+	for {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, rest)
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
@@ -0,0 +1,77 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// FileBrowserDeadQueue is the default name of the dead letter queue. The
+// dead letter queue is always named after the main queue.
+const FileBrowserDeadQueue = FileBrowserQueue + deadQueueSuffix
+
+const deadQueueSuffix = ":dead"
+
+func (r *Runner) deadQueueName() string {
+	return r.queueName() + deadQueueSuffix
+}
+
+// DeadLetter is a job that a worker failed to process.
+type DeadLetter struct {
+	Job      json.RawMessage `json:"job"`
+	Reason   string          `json:"reason"`
+	FailedAt int64           `json:"failed_at"`
+}
+
+// MoveToDeadLetter pushes a job that couldn't be processed to the dead
+// letter queue, along with the reason of the failure.
+func (r *Runner) MoveToDeadLetter(job []byte, reason string) error {
+	letter, err := json.Marshal(DeadLetter{
+		Job:      job,
+		Reason:   reason,
+		FailedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = r.RedisClient.LPush(context.Background(), r.deadQueueName(), letter).Err()
+	if err != nil {
+		return fmt.Errorf("failed to move job to dead letter queue: %w", err)
+	}
+
+	return nil
+}
+
+// RedriveDeadLetters moves all the jobs in the dead letter queue back to
+// the main queue, oldest first. It returns the number of jobs moved.
+func (r *Runner) RedriveDeadLetters(ctx context.Context) (int, error) {
+	moved := 0
+
+	for {
+		raw, err := r.RedisClient.RPop(ctx, r.deadQueueName()).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return moved, nil
+		}
+		if err != nil {
+			return moved, err
+		}
+
+		var letter DeadLetter
+		if err := json.Unmarshal(raw, &letter); err != nil {
+			// put it back so it isn't lost
+			_ = r.RedisClient.RPush(ctx, r.deadQueueName(), raw).Err()
+			return moved, fmt.Errorf("invalid dead letter: %w", err)
+		}
+
+		if err := r.push(ctx, letter.Job); err != nil {
+			_ = r.RedisClient.RPush(ctx, r.deadQueueName(), raw).Err()
+			return moved, fmt.Errorf("failed to queue job: %w", err)
+		}
+		moved++
+	}
+}
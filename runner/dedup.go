@@ -0,0 +1,28 @@
+package runner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// duplicate tells if an identical job was queued within the dedup window.
+// Otherwise, it records the job so that the next identical ones are skipped
+// until the window ends. Without redis, or when it can't be reached, the
+// job is not considered a duplicate.
+func (r *Runner) duplicate(ctx context.Context, job *Job) bool {
+	if r.DedupWindow <= 0 || r.RedisClient == nil {
+		return false
+	}
+
+	hash := sha256.Sum256([]byte(job.Command + "\x00" + job.Event + "\x00" + job.Path))
+	key := r.queueName() + ":dedup:" + hex.EncodeToString(hash[:])
+
+	set, err := r.RedisClient.SetNX(ctx, key, 1, r.DedupWindow).Result()
+	if err != nil {
+		r.logWarn("Failed to check for duplicated jobs", err)
+		return false
+	}
+
+	return !set
+}
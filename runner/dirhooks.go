@@ -0,0 +1,107 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// DirHooksFile is the file of a directory defining the hooks of the
+// operations in its subtree, in the format of the commands of the settings,
+// such as {"after_upload": ["make -C $SCOPE/site"]}.
+const DirHooksFile = ".fbhooks.json"
+
+// dirShellOperators are the characters letting a command line run through
+// a shell chain other commands than its executable.
+const dirShellOperators = ";&|<>`\n"
+
+// dirCommands returns the commands of an event from the hooks file nearest
+// to a path, looked up from its directory to the root of the scope. They're
+// only read when the settings enable DirHooks, and for the users allowed to
+// execute commands. As anyone able to write the file chooses what runs, only
+// the commands whose executable is both in the commands of the user and in
+// the allowed commands of the settings are kept, see checkDirCommand. The
+// files leading out of the scope through links are skipped.
+func (r *Runner) dirCommands(event, p string, user *users.User) ([]settings.HookCommand, error) {
+	if r.Settings == nil || !r.DirHooks || !user.Perm.Execute || user.Fs == nil {
+		return nil, nil
+	}
+
+	dir := path.Dir(path.Clean("/" + p))
+	for {
+		file := path.Join(dir, DirHooksFile)
+		raw, err := afero.ReadFile(user.Fs, file)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, err
+		case InsideScope(user, user.FullPath(file)):
+			var commands map[string][]settings.HookCommand
+			if err := json.Unmarshal(raw, &commands); err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", ErrParseCommand, file, err)
+			}
+			return r.allowedDirCommands(matchCommands(commands, event), file, user)
+		}
+
+		if dir == "/" {
+			return nil, nil
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// allowedDirCommands returns the commands of a hooks file that the user is
+// allowed to run, with their templates resolved, logging the others.
+func (r *Runner) allowedDirCommands(commands []settings.HookCommand, file string, user *users.User) ([]settings.HookCommand, error) {
+	commands, err := r.resolveTemplates(commands)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	allowed := make([]settings.HookCommand, 0, len(commands))
+	for _, command := range commands {
+		if err := r.checkDirCommand(command.Command, user); err != nil {
+			r.logWarn(fmt.Sprintf("Hook %q of %s dropped", command.Command, file), err)
+			continue
+		}
+		allowed = append(allowed, command)
+	}
+	return allowed, nil
+}
+
+// checkDirCommand verifies that the user can run a command of a hooks file:
+// its executable must be in the commands of the user and in the allowed
+// commands of the settings, which must be set. Through a shell, the command
+// can't chain others.
+func (r *Runner) checkDirCommand(raw string, user *users.User) error {
+	if len(r.AllowedCommands) == 0 {
+		return fmt.Errorf("%w: the hooks files need the allowed commands to be set", ErrCommandNotAllowed)
+	}
+	if shell(r.Settings) != nil && (strings.ContainsAny(raw, dirShellOperators) || strings.Contains(raw, "$(")) {
+		return fmt.Errorf("%w: the commands of the hooks files can't use the shell operators", ErrCommandNotAllowed)
+	}
+
+	name, _, err := SplitCommandAndArgs(raw)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrParseCommand, err)
+	}
+	if !user.CanExecute(name) {
+		return fmt.Errorf("%w: %s isn't in the commands of %s", ErrCommandNotAllowed, name, user.Username)
+	}
+
+	executable := name
+	if strings.HasPrefix(name, "@") {
+		if executable, err = resolveScript(r.Settings, name[1:]); err != nil {
+			return fmt.Errorf("%w: %w", ErrParseCommand, err)
+		}
+	}
+	return r.checkAllowed(executable)
+}
@@ -0,0 +1,81 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// envFilePattern matches the env file option at the end of a command.
+var envFilePattern = regexp.MustCompile(`\s+--env\s+(\S+)$`)
+
+// splitEnvFile removes the env file option, such as --env secrets.env, from
+// the end of a command and returns the name of the file. The option is only
+// recognized when an EnvDir is set, so that commands taking an --env option
+// of their own keep working otherwise.
+func (r *Runner) splitEnvFile(raw string) (command, name string) {
+	if r.Settings == nil || r.EnvDir == "" {
+		return raw, ""
+	}
+
+	match := envFilePattern.FindStringSubmatchIndex(raw)
+	if match == nil {
+		return raw, ""
+	}
+	return strings.TrimSpace(raw[:match[0]]), raw[match[2]:match[3]]
+}
+
+// loadEnvFile reads the variables of an env file from the EnvDir. Empty
+// names load nothing.
+func (r *Runner) loadEnvFile(name string) (map[string]string, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	if name != filepath.Base(name) || name == ".." {
+		return nil, fmt.Errorf("invalid env file name %q", name)
+	}
+
+	path := filepath.Join(r.EnvDir, name)
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read env file: %w", err)
+	}
+	defer fd.Close()
+
+	return parseEnvFile(fd, path)
+}
+
+// parseEnvFile parses the KEY=VALUE lines of an env file. Empty lines and
+// the ones starting with # are ignored, and the values can be quoted.
+func parseEnvFile(fd *os.File, path string) (map[string]string, error) {
+	env := map[string]string{}
+
+	scanner := bufio.NewScanner(fd)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("invalid line %d in env file %s", n, path)
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("can't read env file: %w", err)
+	}
+	return env, nil
+}
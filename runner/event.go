@@ -0,0 +1,255 @@
+package runner
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// hookEvent describes the event a hook command runs for.
+type hookEvent struct {
+	name string
+	// path and dst are the full paths on the server, relPath and relDst
+	// the paths relative to the user scope.
+	path    string
+	dst     string
+	relPath string
+	relDst  string
+	user    *users.User
+	// dstUser is the user dst is in the scope of, user but for the
+	// transfers between the scopes.
+	dstUser *users.User
+	// requestID is the ID of the request the event comes from.
+	requestID string
+	// file is the information of the file at path, nil if it doesn't exist.
+	file os.FileInfo
+	mime string
+	time time.Time
+	// checksum caches the SHA-256 of the file, see sha256.
+	checksum *string
+	// input is the standard input of the commands, instead of the file,
+	// such as the entries of the listings.
+	input []byte
+	// outcome tells the finally hooks if the operation succeeded, and
+	// outcomeErr why it failed.
+	outcome    string
+	outcomeErr string
+}
+
+// The outcomes of the operations the finally hooks get.
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+// newHookEvent creates an event for paths relative to the user scope. The
+// information about the file is read from the user file system, so it
+// reflects the state of the file at the time the event is created.
+func newHookEvent(name, path, dst string, user *users.User) *hookEvent {
+	return newTransferEvent(name, path, user, dst, user)
+}
+
+// newTransferEvent creates an event for a path relative to the scope of a
+// user and a destination relative to the one of dstUser.
+func newTransferEvent(name, path string, user *users.User, dst string, dstUser *users.User) *hookEvent {
+	e := &hookEvent{
+		name:    name,
+		path:    user.FullPath(path),
+		relPath: path,
+		relDst:  dst,
+		user:    user,
+		dstUser: dstUser,
+		time:    time.Now(),
+	}
+
+	// single path events, like deletes, have no destination
+	if dst != "" {
+		e.dst = dstUser.FullPath(dst)
+	}
+
+	info, err := user.Fs.Stat(path)
+	if err != nil {
+		return e
+	}
+	e.file = info
+
+	if !info.IsDir() {
+		e.mime = detectMime(user, path)
+	}
+
+	return e
+}
+
+// detectMime returns the mime type of a file from its extension or, when it
+// is unknown, from its first bytes.
+func detectMime(user *users.User, path string) string {
+	if mimeType := mime.TypeByExtension(filepath.Ext(path)); mimeType != "" {
+		return mimeType
+	}
+
+	fd, err := user.Fs.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer fd.Close()
+
+	buffer := make([]byte, 512) //nolint:gomnd
+	n, err := fd.Read(buffer)
+	if err != nil && err != io.EOF {
+		return ""
+	}
+
+	return http.DetectContentType(buffer[:n])
+}
+
+// vars returns the variables available to the hook commands, both as
+// placeholders and environment variables. The file related ones are empty
+// when the file doesn't exist.
+func (e *hookEvent) vars() map[string]string {
+	vars := map[string]string{
+		"FILE":          e.path,
+		"SCOPE":         e.user.Scope,
+		"TRIGGER":       e.name,
+		"USERNAME":      e.user.Username,
+		"DESTINATION":   e.dst,
+		"EVENT_TIME":    e.time.UTC().Format(time.RFC3339),
+		"REQUEST_ID":    e.requestID,
+		"FILE_SIZE":     "",
+		"FILE_MIME":     e.mime,
+		"FILE_MODTIME":  "",
+		"OUTCOME":       e.outcome,
+		"OUTCOME_ERROR": e.outcomeErr,
+	}
+
+	// hashing reads the whole file, only the after hooks get it
+	if strings.HasPrefix(e.name, "after_") {
+		vars["FILE_SHA256"] = e.sha256()
+	}
+
+	if e.file != nil {
+		vars["FILE_MODTIME"] = e.file.ModTime().UTC().Format(time.RFC3339)
+		if !e.file.IsDir() {
+			vars["FILE_SIZE"] = strconv.FormatInt(e.file.Size(), 10)
+		}
+	}
+
+	return vars
+}
+
+// sha256 returns the hex encoded SHA-256 of the file, computed the first
+// time it is needed. It is empty if the file isn't a regular file or can't
+// be read.
+func (e *hookEvent) sha256() string {
+	if e.checksum != nil {
+		return *e.checksum
+	}
+
+	sum := ""
+	e.checksum = &sum
+	if e.file == nil || !e.file.Mode().IsRegular() {
+		return sum
+	}
+
+	fd, err := e.user.Fs.Open(e.relPath)
+	if err != nil {
+		return sum
+	}
+	defer fd.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, fd); err != nil {
+		return sum
+	}
+
+	sum = hex.EncodeToString(h.Sum(nil))
+	return sum
+}
+
+// templates returns the values of the templates of the commands. As they
+// are meant to build paths, such as "$DESTINATION/{{year}}/{{month}}", a
+// value that could traverse directories stops the command.
+func (e *hookEvent) templates() (map[string]string, error) {
+	templates := map[string]string{
+		"year":     e.time.Format("2006"),
+		"month":    e.time.Format("01"),
+		"day":      e.time.Format("02"),
+		"username": e.user.Username,
+	}
+
+	for name, value := range templates {
+		if value == "." || value == ".." || strings.ContainsAny(value, `/\`) {
+			return nil, fmt.Errorf("%w: template {{%s}} has an invalid value %q", ErrPathNotAllowed, name, value)
+		}
+	}
+
+	return templates, nil
+}
+
+// knownVars returns a mapping for os.Expand that only expands the given
+// variables. Any other variable, such as $HOME, is kept as is, so the host
+// environment never ends up in the arguments of a command.
+func knownVars(vars map[string]string) func(string) string {
+	return func(key string) string {
+		if value, ok := vars[key]; ok {
+			return value
+		}
+		return "${" + key + "}"
+	}
+}
+
+// stdin returns the input of the event, or the content of its file if the
+// commands of the event get it as their standard input. Only the commands
+// run by the runner get it, not the queued ones, and only when the file
+// exists: there is no file yet before an upload.
+func (r *Runner) stdin(evt *hookEvent) (io.ReadCloser, error) {
+	if evt.input != nil {
+		return io.NopCloser(bytes.NewReader(evt.input)), nil
+	}
+
+	if r.Settings == nil || !slices.Contains(r.StdinEvents, evt.name) {
+		return nil, nil
+	}
+
+	if evt.file == nil || evt.file.IsDir() {
+		return nil, nil
+	}
+
+	return evt.user.Fs.Open(evt.relPath)
+}
+
+// env returns the environment of a command: the one of the server unless
+// the settings disable inheriting it, the extra variables of the settings,
+// the ones of the env file of the command and the variables of the event,
+// which take precedence.
+func (r *Runner) env(vars, fileEnv map[string]string) []string {
+	var env []string
+	if r.GetInheritEnv() {
+		env = os.Environ()
+	}
+	env = append(env, environ(r.ExtraEnv)...)
+	env = append(env, environ(fileEnv)...)
+	return append(env, environ(vars)...)
+}
+
+// environ returns the variables in the KEY=value form, sorted by key.
+func environ(vars map[string]string) []string {
+	env := make([]string, 0, len(vars))
+	for key, value := range vars {
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
@@ -0,0 +1,49 @@
+package runner
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// matchCommands returns the commands of an event. Besides the exact event
+// name, the keys can be patterns such as "before_*", or several of them
+// separated by "|", e.g. "after_copy|after_move". The commands of the exact
+// key come first, followed by the ones of the matching patterns sorted by
+// key. The patterns don't match the ListingEvent.
+func matchCommands[T any](commands map[string][]T, event string) []T {
+	if event == ListingEvent {
+		return commands[event]
+	}
+
+	var patterns []string
+	for key := range commands {
+		if isEventPattern(key) && matchEvent(key, event) {
+			patterns = append(patterns, key)
+		}
+	}
+
+	if len(patterns) == 0 {
+		return commands[event]
+	}
+	sort.Strings(patterns)
+
+	matched := append([]T{}, commands[event]...)
+	for _, key := range patterns {
+		matched = append(matched, commands[key]...)
+	}
+	return matched
+}
+
+func isEventPattern(key string) bool {
+	return strings.ContainsAny(key, "*?[|")
+}
+
+func matchEvent(pattern, event string) bool {
+	for _, alt := range strings.Split(pattern, "|") {
+		if ok, err := path.Match(strings.TrimSpace(alt), event); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Executor runs hook commands on behalf of the runner, for example on a
+// separate host so that the scripts don't run next to the web server.
+type Executor interface {
+	// Execute runs a command, writing its output to stdout and stderr as
+	// it comes, and returns its exit code, -1 if it couldn't run.
+	Execute(ctx context.Context, req *ExecRequest, stdout, stderr io.Writer) (int, error)
+}
+
+// ExecRequest is a hook command sent to an Executor. The command is sent as
+// configured, the executor parses and expands it with its own settings, so
+// that the executables are looked up where they run.
+type ExecRequest struct {
+	Command     string `json:"command"`
+	Event       string `json:"event"`
+	Path        string `json:"path"`
+	Destination string `json:"destination"`
+	UserName    string `json:"username"`
+	UserScope   string `json:"user_scope"`
+	// Env are the variables of the event, also used for the placeholders.
+	Env map[string]string `json:"env"`
+	// Templates are the values of the templates, such as {{year}}.
+	Templates map[string]string `json:"templates"`
+}
+
+// Execute implements Executor, running the command locally with the
+// settings of the runner. This is what a remote executor daemon does with
+// the requests it receives.
+func (r *Runner) Execute(ctx context.Context, req *ExecRequest, stdout, stderr io.Writer) (int, error) {
+	raw, envFile := r.splitEnvFile(req.Command)
+	fileEnv, err := r.loadEnvFile(envFile)
+	if err != nil {
+		return -1, err
+	}
+
+	command, err := ParseCommand(r.Settings, raw)
+	if err != nil {
+		return -1, err
+	}
+
+	if err := r.checkAllowed(command[0]); err != nil {
+		return -1, err
+	}
+
+	command = filterEmptyParts(expandCommand(r.Settings, command, knownVars(req.Env), req.Templates))
+
+	if r.CommandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.CommandTimeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...) //nolint:gosec
+	cmd.Env = r.env(req.Env, fileEnv)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err = cmd.Run()
+	if err != nil && r.CommandTimeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return exitCode(err), timeoutError(req.Command, r.CommandTimeout)
+	}
+	if err != nil {
+		return exitCode(err), commandError(err, "")
+	}
+	return 0, nil
+}
+
+// execRemote runs a command of an event through the Executor.
+func (r *Runner) execRemote(ctx context.Context, raw string, evt *hookEvent, blocking bool) (*ExecResult, error) {
+	templates, err := evt.templates()
+	if err != nil {
+		return nil, err
+	}
+
+	vars := evt.vars()
+	env := make(map[string]string, len(r.ExtraEnv)+len(vars))
+	for key, value := range r.ExtraEnv {
+		env[key] = value
+	}
+	for key, value := range vars {
+		env[key] = value
+	}
+
+	req := &ExecRequest{
+		Command:     raw,
+		Event:       evt.name,
+		Path:        evt.path,
+		Destination: evt.dst,
+		UserName:    evt.user.Username,
+		UserScope:   evt.user.Scope,
+		Env:         env,
+		Templates:   templates,
+	}
+
+	info := &commandLog{
+		command:   []string{raw},
+		evt:       evt.name,
+		path:      evt.path,
+		username:  evt.user.Username,
+		requestID: evt.requestID,
+		blocking:  blocking,
+	}
+
+	if r.DryRun {
+		r.logDryRun(info, environ(vars))
+		return nil, nil
+	}
+
+	if !blocking {
+		if err := r.background.acquire(); err != nil {
+			return nil, err
+		}
+
+		r.logStarted(info)
+		start := time.Now()
+		go func() {
+			defer r.background.release()
+			_, err := r.Executor.Execute(context.WithoutCancel(ctx), req, os.Stdout, os.Stderr)
+			r.commandFinished(info, time.Since(start), err)
+		}()
+		return nil, nil
+	}
+
+	var cancel context.CancelFunc
+	if r.CommandTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, r.CommandTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	stdout := &outputBuffer{limit: r.MaxOutputBytes, onOverflow: cancel}
+	stderr := &outputBuffer{limit: r.MaxOutputBytes, onOverflow: cancel}
+	var outw, errw io.Writer = os.Stdout, os.Stderr
+	if r.CaptureOutput {
+		outw = io.MultiWriter(os.Stdout, stdout)
+		errw = io.MultiWriter(os.Stderr, stderr)
+	}
+
+	r.logStarted(info)
+	start := time.Now()
+
+	code, err := r.Executor.Execute(ctx, req, outw, errw)
+	result := &ExecResult{
+		ExitCode: code,
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+	}
+
+	switch {
+	case err != nil && (stdout.killed || stderr.killed):
+		err = overflowError(raw, r.MaxOutputBytes)
+	case err != nil && r.CommandTimeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded):
+		err = timeoutError(raw, r.CommandTimeout)
+	case err != nil && !errors.Is(err, ErrCommandFailed) && !errors.Is(err, ErrTimeout):
+		err = commandError(err, stderr.String())
+	}
+	r.commandFinished(info, time.Since(start), err)
+	return result, err
+}
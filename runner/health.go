@@ -0,0 +1,64 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// HealthCheck verifies that the hooks can run: that redis answers, when
+// the after hooks are queued, and that the scripts referenced by the
+// commands exist and are executable.
+func (r *Runner) HealthCheck(ctx context.Context) error {
+	if !r.Enabled {
+		return nil
+	}
+
+	var errs []error
+
+	if r.RedisClient != nil {
+		if err := r.RedisClient.Ping(ctx).Err(); err != nil {
+			errs = append(errs, fmt.Errorf("redis is unreachable: %w", err))
+		}
+	}
+
+	if r.Settings != nil {
+		if r.ScriptsDir != "" {
+			if info, err := os.Stat(r.ScriptsDir); err != nil || !info.IsDir() {
+				errs = append(errs, fmt.Errorf("scripts directory %s is not a directory", r.ScriptsDir))
+			}
+		}
+
+		if r.EnvDir != "" {
+			if info, err := os.Stat(r.EnvDir); err != nil || !info.IsDir() {
+				errs = append(errs, fmt.Errorf("env directory %s is not a directory", r.EnvDir))
+			}
+		}
+
+		for _, commands := range r.Commands {
+			for _, command := range commands {
+				if name, ok := scriptName(command.Command); ok {
+					if _, err := resolveScript(r.Settings, name); err != nil {
+						errs = append(errs, err)
+					}
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// scriptName returns the name of the script a command runs, if it is an
+// @name command.
+func scriptName(command string) (string, bool) {
+	command = strings.TrimSpace(command)
+	if !strings.HasPrefix(command, "@") {
+		return "", false
+	}
+
+	name, _, _ := strings.Cut(command[1:], " ")
+	return strings.TrimSuffix(name, "&"), true
+}
@@ -0,0 +1,39 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Job is an after hook queued for a worker. Producers and consumers should
+// use Marshal and UnmarshalJob so that they agree on the format.
+type Job struct {
+	Command     string `json:"command"`
+	Event       string `json:"event"`
+	Path        string `json:"path"`
+	Destination string `json:"destination"`
+	UserName    string `json:"username"`
+	UserScope   string `json:"user_scope"`
+	// PartitionKey keeps the jobs with the same key in order on partitioned
+	// queues. It is the path of the job.
+	PartitionKey string `json:"partition_key,omitempty"`
+	// SHA256 is the hex encoded SHA-256 of the file, empty if it isn't a
+	// regular file.
+	SHA256 string `json:"sha256,omitempty"`
+	// RequestID is the ID of the request that queued the job.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Marshal encodes the job as it is queued.
+func (j *Job) Marshal() ([]byte, error) {
+	return json.Marshal(j)
+}
+
+// UnmarshalJob decodes a job taken from the queue.
+func UnmarshalJob(data []byte) (*Job, error) {
+	job := &Job{}
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil, fmt.Errorf("invalid job: %w", err)
+	}
+	return job, nil
+}
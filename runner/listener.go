@@ -0,0 +1,22 @@
+package runner
+
+import "github.com/filebrowser/filebrowser/v2/users"
+
+// Listener is told about the operations run through a runner once they're
+// done, with the event and the paths the after hooks get, whether the
+// commands are enabled or not. It's called from the request, so it should
+// not block.
+type Listener interface {
+	OperationDone(event, path, dst string, user *users.User)
+}
+
+func (r *Runner) operationDone(event, path, dst string, user *users.User) {
+	for _, l := range r.Listeners {
+		l.OperationDone(event, path, dst, user)
+	}
+}
+
+// Notify tells the listeners about an operation that runs no hooks.
+func (r *Runner) Notify(event, path, dst string, user *users.User) {
+	r.operationDone(event, path, dst, user)
+}
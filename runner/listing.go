@@ -0,0 +1,233 @@
+package runner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// ListingEvent is the event of the hooks transforming the listings of the
+// directories. Unlike the ones of the operations, it only runs the commands
+// of its own key, the patterns such as before_* not matching it, so that
+// the listings don't run the hooks of the operations.
+const ListingEvent = "before_listing"
+
+// ListingCacheTTL is how long the listing transformed by the hooks is kept
+// for, as long as the directory doesn't change.
+const ListingCacheTTL = time.Minute
+
+// maxCachedListings is how many transformed listings are kept.
+const maxCachedListings = 1000
+
+// ListingEntry is a file of a listing given to the listing hooks.
+type ListingEntry struct {
+	Name     string    `json:"name"`
+	IsDir    bool      `json:"isDir"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	// Annotations are the ones the hooks gave to the file, such as
+	// {"scanned": "clean"}.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// listingInput is what the listing hooks get on their standard input.
+type listingInput struct {
+	Path  string         `json:"path"`
+	Items []ListingEntry `json:"items"`
+}
+
+// listingChanges are the changes a listing hook asks for by printing a JSON
+// line on stdout, such as {"hide":["a.tmp"],"annotations":{"b.txt":
+// {"scanned":"clean"}}}.
+type listingChanges struct {
+	// Hide are the names of the files left out of the listing.
+	Hide []string `json:"hide"`
+	// Annotations are added to the ones of the files, by name.
+	Annotations map[string]map[string]string `json:"annotations"`
+}
+
+// apply returns the entries once changed.
+func (c *listingChanges) apply(entries []ListingEntry) []ListingEntry {
+	hidden := map[string]bool{}
+	for _, name := range c.Hide {
+		hidden[name] = true
+	}
+
+	changed := make([]ListingEntry, 0, len(entries))
+	for _, entry := range entries {
+		if hidden[entry.Name] {
+			continue
+		}
+		if annotations := c.Annotations[entry.Name]; len(annotations) > 0 {
+			merged := map[string]string{}
+			for k, v := range entry.Annotations {
+				merged[k] = v
+			}
+			for k, v := range annotations {
+				merged[k] = v
+			}
+			entry.Annotations = merged
+		}
+		changed = append(changed, entry)
+	}
+	return changed
+}
+
+// parseListingChanges returns the changes of the last JSON line of the
+// output of a listing hook, nil if there are none.
+func parseListingChanges(result *ExecResult) *listingChanges {
+	if result == nil {
+		return nil
+	}
+
+	lines := strings.Split(strings.TrimSpace(result.Stdout), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+
+		var changes listingChanges
+		if err := json.Unmarshal([]byte(line), &changes); err == nil {
+			return &changes
+		}
+	}
+	return nil
+}
+
+// TransformListing runs the listing hooks of a directory, relative to the
+// scope of the user, and returns its entries hidden or annotated as they
+// ask. The hooks get the directory as their FILE and the entries as JSON on
+// their standard input, but for the remote executor. The commands of a
+// directory are the ones of the event, whose match patterns are matched on
+// the name of the directory, and the ones of its own hooks file.
+//
+// The result is cached for ListingCacheTTL while the entries stay the same,
+// and the entries are returned as they are when there are no commands.
+func (r *Runner) TransformListing(ctx context.Context, dir string, user *users.User, entries []ListingEntry) ([]ListingEntry, error) {
+	if !r.Enabled {
+		return entries, nil
+	}
+
+	// the hooks file of the directory itself applies to its listing
+	commands, err := r.hookCommands(ListingEvent, path.Join(dir, DirHooksFile), user)
+	if err != nil || len(commands) == 0 {
+		return entries, err
+	}
+	evt := newHookEvent(ListingEvent, dir, "", user)
+	evt.requestID = requestID(ctx)
+	matched := evt.runFor(commands)
+	if len(matched) == 0 {
+		return entries, nil
+	}
+
+	input, err := json.Marshal(listingInput{Path: dir, Items: entries})
+	if err != nil {
+		return nil, err
+	}
+	key := listingKey(user, dir, matched, input)
+	if cached, ok := r.listings.get(key); ok {
+		return cached, nil
+	}
+
+	for _, command := range matched {
+		if err := r.allowHook(user.Username); err != nil {
+			return nil, err
+		}
+
+		evt.input = input
+		result, err := r.runBefore(ctx, command, evt)
+		if rejected := rejection(result); rejected != nil {
+			return nil, rejected
+		}
+		if err != nil {
+			if err := r.handleBeforeFailure(evt, command, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if changes := parseListingChanges(result); changes != nil {
+			entries = changes.apply(entries)
+			if input, err = json.Marshal(listingInput{Path: dir, Items: entries}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	r.listings.set(key, entries)
+	return entries, nil
+}
+
+// listingKey is the key of the cache of a listing, which changes with the
+// commands and the entries.
+func listingKey(user *users.User, dir string, commands []string, input []byte) string {
+	h := sha256.New()
+	h.Write([]byte(strconv.FormatUint(uint64(user.ID), 10) + "\x00" + user.Scope + "\x00" + dir + "\x00"))
+	h.Write([]byte(strings.Join(commands, "\x00") + "\x00"))
+	h.Write(input)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// listingCache keeps the transformed listings for ListingCacheTTL.
+type listingCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedListing
+}
+
+type cachedListing struct {
+	entries []ListingEntry
+	expires time.Time
+}
+
+func newListingCache() *listingCache {
+	return &listingCache{entries: map[string]cachedListing{}}
+}
+
+// get returns a cached listing, in a slice of its own.
+func (c *listingCache) get(key string) ([]ListingEntry, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.entries[key]
+	if !ok || time.Now().After(cached.expires) {
+		return nil, false
+	}
+	return append([]ListingEntry{}, cached.entries...), true
+}
+
+// set caches a listing, dropping the expired ones once full, then any.
+func (c *listingCache) set(key string, entries []ListingEntry) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.entries) >= maxCachedListings {
+		for k, cached := range c.entries {
+			if now.After(cached.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	for k := range c.entries {
+		if len(c.entries) < maxCachedListings {
+			break
+		}
+		delete(c.entries, k)
+	}
+	c.entries[key] = cachedListing{entries: entries, expires: now.Add(ListingCacheTTL)}
+}
@@ -0,0 +1,99 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// commandLog holds the fields that describe a hook command in the logs.
+type commandLog struct {
+	command   []string
+	evt       string
+	path      string
+	username  string
+	requestID string
+	blocking  bool
+	// jobID identifies a non-blocking command, see Runner.Cancel.
+	jobID string
+}
+
+func (c *commandLog) attrs() []any {
+	return []any{
+		"command", strings.Join(c.command, " "),
+		"event", c.evt,
+		"path", c.path,
+		"username", c.username,
+		"request_id", c.requestID,
+		"blocking", c.blocking,
+		"job_id", c.jobID,
+	}
+}
+
+// exitCode returns the exit code of a finished command, or -1 if the
+// command couldn't be run at all.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+
+	return -1
+}
+
+func (r *Runner) logStarted(c *commandLog) {
+	if r.Logger == nil {
+		if c.blocking {
+			log.Printf("[INFO] Blocking Command: \"%s\"", strings.Join(c.command, " "))
+		} else {
+			log.Printf("[INFO] Nonblocking Command: \"%s\" (job %s)", strings.Join(c.command, " "), c.jobID)
+		}
+		return
+	}
+
+	r.Logger.Info("hook command started", c.attrs()...)
+}
+
+func (r *Runner) logFinished(c *commandLog, elapsed time.Duration, err error) {
+	if r.Logger == nil {
+		if !c.blocking && err != nil {
+			log.Printf("[INFO] Nonblocking Command \"%s\" (job %s) failed: %s", strings.Join(c.command, " "), c.jobID, err)
+		}
+		return
+	}
+
+	attrs := append(c.attrs(), "duration_ms", elapsed.Milliseconds(), "exit_code", exitCode(err))
+	if err != nil {
+		attrs = append(attrs, "error", err.Error())
+		r.Logger.Log(context.Background(), slog.LevelError, "hook command failed", attrs...)
+		return
+	}
+
+	r.Logger.Info("hook command finished", attrs...)
+}
+
+func (r *Runner) logDryRun(c *commandLog, env []string) {
+	if r.Logger == nil {
+		log.Printf("[INFO] Dry Run Command: \"%s\" Env: %q", strings.Join(c.command, " "), env)
+		return
+	}
+
+	r.Logger.Info("hook command dry run", append(c.attrs(), "env", env)...)
+}
+
+func (r *Runner) logWarn(msg string, err error) {
+	if r.Logger == nil {
+		log.Printf("[WARN] %s: %s", msg, err)
+		return
+	}
+
+	r.Logger.Warn(msg, "error", err)
+}
@@ -0,0 +1,73 @@
+package runner
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+// runFor returns the commands that run for the file of the event, leaving
+// out the ones whose patterns don't match it.
+func (e *hookEvent) runFor(commands []settings.HookCommand) []string {
+	var matched []string
+	for _, command := range commands {
+		if e.matches(command.Match) {
+			matched = append(matched, command.Command)
+		}
+	}
+	return matched
+}
+
+// matches checks if the file of the event matches one of the comma
+// separated patterns, on its name or, for the patterns with a slash, on its
+// mime type. The names are compared regardless of their case. Empty
+// patterns match every file.
+func (e *hookEvent) matches(patterns string) bool {
+	if strings.TrimSpace(patterns) == "" {
+		return true
+	}
+
+	name := strings.ToLower(path.Base(e.relPath))
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+
+		subject := name
+		if strings.Contains(pattern, "/") {
+			subject = e.mimeType()
+		}
+		if ok, err := path.Match(pattern, subject); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// mimeType returns the mime type of the file without its parameters. When
+// the file doesn't exist yet, e.g. before an upload, it is guessed from the
+// extension.
+func (e *hookEvent) mimeType() string {
+	mimeType := e.mime
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(filepath.Ext(e.relPath))
+	}
+
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
+
+// validateMatch checks the syntax of the patterns of a command.
+func validateMatch(patterns string) error {
+	for _, pattern := range strings.Split(patterns, ",") {
+		if _, err := path.Match(strings.TrimSpace(pattern), ""); err != nil {
+			return fmt.Errorf("invalid match pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
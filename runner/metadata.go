@@ -0,0 +1,53 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Metadata are the changes a before hook asks for by printing a JSON line
+// on stdout, such as {"name":"photo.jpg"}. They are only read for the
+// events in the MetadataEvents, and the following hooks see them applied.
+type Metadata struct {
+	// Name replaces the name of the file, which stays in its directory.
+	Name string `json:"name,omitempty"`
+}
+
+// metadata returns the changes asked by a before hook result, nil if there
+// are none or the event doesn't accept them.
+func (r *Runner) metadata(event string, result *ExecResult) (*Metadata, error) {
+	if result == nil || r.Settings == nil || !slices.Contains(r.MetadataEvents, event) {
+		return nil, nil
+	}
+
+	lines := strings.Split(strings.TrimSpace(result.Stdout), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+
+		var meta Metadata
+		if err := json.Unmarshal([]byte(line), &meta); err != nil || meta.Name == "" {
+			continue
+		}
+
+		if meta.Name == "." || meta.Name == ".." || strings.ContainsAny(meta.Name, `/\`) {
+			return nil, fmt.Errorf("%w: invalid name %q returned by hook", ErrPathNotAllowed, meta.Name)
+		}
+		return &meta, nil
+	}
+
+	return nil, nil
+}
+
+// apply returns the path once changed by the metadata.
+func (m *Metadata) apply(p string) string {
+	if m == nil || m.Name == "" {
+		return p
+	}
+	return path.Join(path.Dir(p), m.Name)
+}
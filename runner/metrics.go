@@ -0,0 +1,31 @@
+package runner
+
+import "time"
+
+// Metrics receives the measurements of the hooks, e.g. to expose them to
+// Prometheus. A typical implementation keeps a counter of executions and
+// one of failures, and a histogram of the duration in seconds, all of them
+// labeled by event and blocking, and registers them in a Registerer. The
+// methods are called concurrently.
+type Metrics interface {
+	// CommandFinished is called when a command is done. err is not nil if
+	// the command failed or couldn't be started.
+	CommandFinished(event string, blocking bool, elapsed time.Duration, err error)
+	// JobQueued is called when an after hook is queued, err is not nil if
+	// it couldn't be.
+	JobQueued(event string, err error)
+}
+
+func (r *Runner) commandFinished(c *commandLog, elapsed time.Duration, err error) {
+	r.logFinished(c, elapsed, err)
+	r.audit(c, elapsed, err)
+	if r.Metrics != nil {
+		r.Metrics.CommandFinished(c.evt, c.blocking, elapsed, err)
+	}
+}
+
+func (r *Runner) jobQueued(event string, err error) {
+	if r.Metrics != nil {
+		r.Metrics.JobQueued(event, err)
+	}
+}
@@ -0,0 +1,58 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// truncatedMarker ends the captured output that exceeded the limit.
+const truncatedMarker = "\n[output truncated]"
+
+// outputBuffer captures the output of a command up to a limit, dropping the
+// rest. A command that keeps writing once as much again was dropped gets
+// killed through onOverflow.
+type outputBuffer struct {
+	buf        bytes.Buffer
+	limit      int64
+	dropped    int64
+	killed     bool
+	onOverflow func()
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	if b.limit <= 0 {
+		return b.buf.Write(p)
+	}
+
+	if remaining := b.limit - int64(b.buf.Len()); int64(len(p)) > remaining {
+		b.buf.Write(p[:remaining])
+		b.dropped += int64(len(p)) - remaining
+
+		if b.dropped > b.limit && !b.killed {
+			b.killed = true
+			if b.onOverflow != nil {
+				b.onOverflow()
+			}
+		}
+		return len(p), nil
+	}
+
+	return b.buf.Write(p)
+}
+
+func (b *outputBuffer) Len() int {
+	return b.buf.Len()
+}
+
+// String returns the captured output, with a marker if it was truncated.
+func (b *outputBuffer) String() string {
+	if b.dropped > 0 {
+		return b.buf.String() + truncatedMarker
+	}
+	return b.buf.String()
+}
+
+// overflowError describes a command killed for writing too much output.
+func overflowError(command string, limit int64) error {
+	return fmt.Errorf("%w: command %q killed: its output exceeded %d bytes", ErrCommandFailed, command, limit)
+}
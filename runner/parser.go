@@ -1,23 +1,78 @@
 package runner
 
 import (
+	"errors"
+	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/filebrowser/filebrowser/v2/settings"
 )
 
+// ErrParseCommand is returned when a hook command can't be parsed, or its
+// executable or script can't be found.
+var ErrParseCommand = errors.New("invalid hook command")
+
+// DefaultShell is the shell the commands run through when the settings
+// enable UseShell without setting a Shell.
+var DefaultShell = []string{"/bin/sh", "-c"}
+
+// shell returns the shell the commands run through, nil if they don't.
+func shell(s *settings.Settings) []string {
+	if len(s.Shell) > 0 {
+		return s.Shell
+	}
+	if s.UseShell {
+		return DefaultShell
+	}
+	return nil
+}
+
 // ParseCommand parses the command taking in account if the current
 // instance uses a shell to run the commands or just calls the binary
 // directyly.
+//
+// Without a shell, the command is split shell-style, so quoted substrings
+// and escaped spaces are kept as a single argument. The placeholders such
+// as $FILE are not expanded here, see expandCommand.
+//
+// Running the commands through a shell allows pipes and redirections, but
+// the shell interprets the whole command line: a placeholder must always be
+// quoted, e.g. "$FILE", or a crafted file name could inject shell code. The
+// shell expands the placeholders from the environment of the command.
+//
+// A command starting with @name runs the script name from the scripts
+// directory of the settings, which must exist and be executable.
+//
+// The errors wrap ErrParseCommand.
 func ParseCommand(s *settings.Settings, raw string) ([]string, error) {
+	command, err := parseCommand(s, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrParseCommand, err)
+	}
+	return command, nil
+}
+
+func parseCommand(s *settings.Settings, raw string) ([]string, error) {
 	var command []string
 
-	if len(s.Shell) == 0 {
+	sh := shell(s)
+	if len(sh) == 0 {
 		cmd, args, err := SplitCommandAndArgs(raw)
 		if err != nil {
 			return nil, err
 		}
 
+		if strings.HasPrefix(cmd, "@") {
+			cmd, err = resolveScript(s, cmd[1:])
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		_, err = exec.LookPath(cmd)
 		if err != nil {
 			return nil, err
@@ -26,8 +81,105 @@ func ParseCommand(s *settings.Settings, raw string) ([]string, error) {
 		command = append(command, cmd)
 		command = append(command, args...)
 	} else {
-		command = append(s.Shell, raw) //nolint:gocritic
+		if strings.HasPrefix(raw, "@") {
+			name, rest, _ := strings.Cut(raw[1:], " ")
+			script, err := resolveScript(s, name)
+			if err != nil {
+				return nil, err
+			}
+			raw = strings.TrimSpace(shellQuote(script) + " " + rest)
+		}
+
+		command = append(append([]string{}, sh...), raw)
 	}
 
 	return command, nil
 }
+
+// resolveScript returns the absolute path of a script from the scripts
+// directory, checking that it can be run.
+func resolveScript(s *settings.Settings, name string) (string, error) {
+	if s.ScriptsDir == "" {
+		return "", fmt.Errorf("can't run script %q: the scripts directory is not set", name)
+	}
+
+	if name == "" || name != filepath.Base(name) || name == ".." {
+		return "", fmt.Errorf("invalid script name %q", name)
+	}
+
+	dir, err := filepath.Abs(s.ScriptsDir)
+	if err != nil {
+		return "", err
+	}
+	script := filepath.Join(dir, name)
+
+	info, err := os.Stat(script)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("script %q not found in %s", name, dir)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if info.IsDir() || info.Mode().Perm()&0111 == 0 {
+		return "", fmt.Errorf("script %s is not an executable file", script)
+	}
+
+	return script, nil
+}
+
+// shellQuote quotes a string so that a POSIX shell reads it as one word.
+func shellQuote(str string) string {
+	return "'" + strings.ReplaceAll(str, "'", `'"'"'`) + "'"
+}
+
+// expandCommand replaces the placeholders in the arguments of a command
+// returned by ParseCommand. The command is already split at this point,
+// so a placeholder always expands to a single argument, even if its value
+// has spaces, quotes, dollar signs or newlines, and the value itself is
+// never expanded again.
+//
+// The arguments can also have templates such as {{year}}, which are
+// replaced by the given values, e.g. "$DESTINATION/{{year}}/{{month}}".
+// Both are expanded in a single pass: a template in the value of a
+// placeholder, or a placeholder in the value of a template, is kept as is.
+// Unknown templates are kept as is too.
+//
+// When the command runs through a shell, the script is left untouched: the
+// values are available to it as environment variables and the script must
+// quote them itself, e.g. "$FILE". Pasting them into the script would let
+// a crafted file name inject shell code.
+func expandCommand(s *settings.Settings, command []string, mapping func(string) string, templates map[string]string) []string {
+	expanded := make([]string, 0, len(command))
+
+	for i, arg := range command {
+		if i == 0 || (len(shell(s)) > 0 && i == len(command)-1) {
+			expanded = append(expanded, arg)
+			continue
+		}
+		expanded = append(expanded, expandArg(arg, mapping, templates))
+	}
+
+	return expanded
+}
+
+var templatePattern = regexp.MustCompile(`{{\s*(\w+)\s*}}`)
+
+func expandArg(arg string, mapping func(string) string, templates map[string]string) string {
+	var b strings.Builder
+	last := 0
+
+	for _, loc := range templatePattern.FindAllStringSubmatchIndex(arg, -1) {
+		value, ok := templates[arg[loc[2]:loc[3]]]
+		if !ok {
+			continue
+		}
+
+		b.WriteString(os.Expand(arg[last:loc[0]], mapping))
+		b.WriteString(value)
+		last = loc[1]
+	}
+	b.WriteString(os.Expand(arg[last:], mapping))
+
+	return b.String()
+}
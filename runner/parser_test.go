@@ -0,0 +1,150 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+func TestExpandCommand(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("echo is not a binary on windows")
+	}
+
+	// force linux parsing
+	runtimeGoos = osLinux
+	defer func() {
+		runtimeGoos = runtime.GOOS
+	}()
+
+	values := map[string]string{
+		"FILE":        "/srv/my report.pdf",
+		"DESTINATION": "/srv/cost_$HOME.txt",
+		"USERNAME":    "line\nbreak",
+	}
+	mapping := func(key string) string {
+		return values[key]
+	}
+
+	tests := map[string]struct {
+		shell []string
+		raw   string
+		want  []string
+	}{
+		"path with spaces": {
+			raw:  `echo $FILE`,
+			want: []string{"echo", "/srv/my report.pdf"},
+		},
+		"quoted placeholder": {
+			raw:  `echo "$FILE"`,
+			want: []string{"echo", "/srv/my report.pdf"},
+		},
+		"placeholder inside an argument": {
+			raw:  `echo --in=$FILE "--out=${DESTINATION}"`,
+			want: []string{"echo", "--in=/srv/my report.pdf", "--out=/srv/cost_$HOME.txt"},
+		},
+		"value with a dollar sign isn't expanded again": {
+			raw:  `echo $DESTINATION`,
+			want: []string{"echo", "/srv/cost_$HOME.txt"},
+		},
+		"value with a newline": {
+			raw:  `echo $USERNAME`,
+			want: []string{"echo", "line\nbreak"},
+		},
+		"quoted literal with spaces": {
+			raw:  `echo 'a b' a\ b`,
+			want: []string{"echo", "a b", "a b"},
+		},
+		"shell script is left to the shell": {
+			shell: []string{"sh", "-c"},
+			raw:   `echo "$FILE" > "$DESTINATION"`,
+			want:  []string{"sh", "-c", `echo "$FILE" > "$DESTINATION"`},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := &settings.Settings{Shell: tt.shell}
+
+			command, err := ParseCommand(s, tt.raw)
+			if err != nil {
+				t.Fatalf("failed to parse command: %v", err)
+			}
+
+			got := expandCommand(s, command, mapping, nil)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCommandScript(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("scripts are not executable on windows")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "scan.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte(""), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	s := &settings.Settings{ScriptsDir: dir}
+
+	command, err := ParseCommand(s, "@scan.sh $FILE")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := []string{filepath.Join(dir, "scan.sh"), "$FILE"}; !reflect.DeepEqual(command, want) {
+		t.Errorf("got %q, want %q", command, want)
+	}
+
+	s.Shell = []string{"sh", "-c"}
+	command, err = ParseCommand(s, `@scan.sh "$FILE"`)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := []string{"sh", "-c", "'" + filepath.Join(dir, "scan.sh") + `' "$FILE"`}; !reflect.DeepEqual(command, want) {
+		t.Errorf("got %q, want %q", command, want)
+	}
+
+	for _, raw := range []string{"@missing.sh", "@notes.txt", "@../scan.sh", "@"} {
+		if _, err := ParseCommand(s, raw); err == nil {
+			t.Errorf("expected an error for %q", raw)
+		}
+	}
+
+	if _, err := ParseCommand(&settings.Settings{}, "@scan.sh"); err == nil {
+		t.Error("expected an error without a scripts directory")
+	}
+}
+
+func TestExpandCommandTemplates(t *testing.T) {
+	values := map[string]string{
+		"DESTINATION": "/srv/{{year}}",
+		"FILE":        "/srv/a.txt",
+	}
+	mapping := func(key string) string {
+		return values[key]
+	}
+	templates := map[string]string{
+		"year":     "2024",
+		"month":    "03",
+		"username": "$FILE",
+	}
+
+	command := []string{"cp", "$FILE", "$DESTINATION/{{year}}/{{ month }}/{{username}}/{{unknown}}"}
+	want := []string{"cp", "/srv/a.txt", "/srv/{{year}}/2024/03/$FILE/{{unknown}}"}
+
+	got := expandCommand(&settings.Settings{}, command, mapping, templates)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expandCommand() = %q, want %q", got, want)
+	}
+}
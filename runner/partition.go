@@ -0,0 +1,33 @@
+package runner
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// Partitioned queues keep the jobs of a path in order.
+//
+// With the list backend and Partitions set, the jobs aren't pushed to the
+// queue list itself but to one of Partitions lists, named after the queue
+// and the partition number, e.g. "fbq:0", "fbq:1"... The partition of a job
+// is the FNV-1a hash of its PartitionKey, its path, modulo the number of
+// partitions, so all the jobs of a path end up in the same list, in the
+// order they were queued. The workers pop each partition list from a single
+// goroutine, processing its jobs one after the other, while the different
+// partitions are processed in parallel.
+//
+// A partition must be consumed by a single worker at a time for the order
+// to hold, see Worker.Partitions to spread them across processes. The
+// producers and the workers must agree on the number of partitions.
+
+// PartitionQueueName returns the name of the list of a partition.
+func PartitionQueueName(queue string, partition int) string {
+	return fmt.Sprintf("%s:%d", queue, partition)
+}
+
+// partitionOf returns the partition of a key among n.
+func partitionOf(key string, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// FailurePolicy tells what to do with the operation when a before hook
+// fails. It is set per event in the settings, e.g. "before_upload": "continue".
+type FailurePolicy string
+
+const (
+	// PolicyAbort makes the operation fail. This is the default.
+	PolicyAbort FailurePolicy = "abort"
+	// PolicyContinue logs the failure and runs the operation.
+	PolicyContinue FailurePolicy = "continue"
+	// PolicyWarn runs the operation and reports the failure to the client
+	// through OnWarning.
+	PolicyWarn FailurePolicy = "warn"
+)
+
+func (r *Runner) failurePolicy(event string) FailurePolicy {
+	if r.Settings == nil {
+		return PolicyAbort
+	}
+
+	switch policy := FailurePolicy(r.HookPolicies[event]); policy {
+	case "", PolicyAbort:
+		return PolicyAbort
+	case PolicyContinue, PolicyWarn:
+		return policy
+	default:
+		log.Printf("[WARN] Unknown hook policy %q for %s, using %q", policy, event, PolicyAbort)
+		return PolicyAbort
+	}
+}
+
+// handleBeforeFailure applies the failure policy of the event to the error
+// of a before hook. It returns the error if the operation must be aborted.
+func (r *Runner) handleBeforeFailure(evt *hookEvent, command string, err error) error {
+	switch r.failurePolicy(evt.name) {
+	case PolicyContinue:
+		r.logWarn(fmt.Sprintf("Before hook %q failed, continuing", command), err)
+	case PolicyWarn:
+		r.logWarn(fmt.Sprintf("Before hook %q failed, continuing", command), err)
+		if r.OnWarning != nil {
+			msg := fmt.Sprintf("%s hook %q failed: %v", evt.name, command, err)
+			r.OnWarning(strings.Join(strings.Fields(msg), " "))
+		}
+	default:
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrEnqueue is returned when the jobs of the after hooks can't be queued,
+// nor saved to the fallback file. The jobs are dropped then.
+var ErrEnqueue = errors.New("failed to queue job")
+
+// Queue receives the after hooks jobs, which workers run later on.
+type Queue interface {
+	Enqueue(ctx context.Context, job Job) error
+}
+
+// BatchQueue is a Queue that can enqueue the jobs of an event at once, so
+// that either all of them or none are queued.
+type BatchQueue interface {
+	Queue
+	EnqueueBatch(ctx context.Context, jobs []Job) error
+}
+
+// enqueueJobs queues the jobs in a batch if the queue supports it, or one by
+// one otherwise. It returns the jobs that weren't queued on error.
+func enqueueJobs(ctx context.Context, queue Queue, jobs []Job) ([]Job, error) {
+	if batch, ok := queue.(BatchQueue); ok {
+		if err := batch.EnqueueBatch(ctx, jobs); err != nil {
+			return jobs, err
+		}
+		return nil, nil
+	}
+
+	for i, job := range jobs {
+		if err := queue.Enqueue(ctx, job); err != nil {
+			return jobs[i:], err
+		}
+	}
+	return nil, nil
+}
+
+// RedisQueue queues the jobs in redis, where the Worker reads them.
+type RedisQueue struct {
+	Client *redis.Client
+	// Name is the key of the queue. When empty, FileBrowserQueue is used.
+	Name string
+	// Backend is the redis structure of the queue. When empty, the list
+	// backend is used.
+	Backend QueueBackend
+	// Partitions splits a list queue in lists that keep the jobs of a path
+	// in order, see PartitionQueueName. Zero means a single list.
+	Partitions int
+}
+
+// Enqueue implements Queue.
+func (q *RedisQueue) Enqueue(ctx context.Context, job Job) error {
+	data, err := job.Marshal()
+	if err != nil {
+		return err
+	}
+	return q.push(ctx, q.Client, job.PartitionKey, data)
+}
+
+// EnqueueBatch implements BatchQueue. The jobs are pushed in a single
+// MULTI/EXEC transaction.
+func (q *RedisQueue) EnqueueBatch(ctx context.Context, jobs []Job) error {
+	encoded := make([][]byte, 0, len(jobs))
+	for _, job := range jobs {
+		data, err := job.Marshal()
+		if err != nil {
+			return err
+		}
+		encoded = append(encoded, data)
+	}
+
+	_, err := q.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, data := range encoded {
+			if err := q.push(ctx, pipe, jobs[i].PartitionKey, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (q *RedisQueue) name() string {
+	if q.Name == "" {
+		return FileBrowserQueue
+	}
+	return q.Name
+}
+
+// push adds an encoded job to the queue, in the partition of its key.
+func (q *RedisQueue) push(ctx context.Context, c redis.Cmdable, key string, job []byte) error {
+	if q.Backend == QueueBackendStream {
+		return c.XAdd(ctx, &redis.XAddArgs{
+			Stream: q.name(),
+			Values: map[string]interface{}{streamJobField: job},
+		}).Err()
+	}
+
+	name := q.name()
+	if q.Partitions > 0 {
+		name = PartitionQueueName(name, partitionOf(key, q.Partitions))
+	}
+	return c.LPush(ctx, name, job).Err()
+}
+
+// MemoryQueue keeps the jobs in memory. It is meant for tests and for
+// handlers that process the jobs in the same process.
+type MemoryQueue struct {
+	mu   sync.Mutex
+	jobs []Job
+}
+
+// Enqueue implements Queue.
+func (q *MemoryQueue) Enqueue(ctx context.Context, job Job) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.jobs = append(q.jobs, job)
+	return nil
+}
+
+// EnqueueBatch implements BatchQueue.
+func (q *MemoryQueue) EnqueueBatch(ctx context.Context, jobs []Job) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.jobs = append(q.jobs, jobs...)
+	return nil
+}
+
+// Jobs returns the queued jobs, oldest first.
+func (q *MemoryQueue) Jobs() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]Job(nil), q.jobs...)
+}
+
+// Take removes the queued jobs and returns them, oldest first.
+func (q *MemoryQueue) Take() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := q.jobs
+	q.jobs = nil
+	return jobs
+}
+
+// queue returns where the after hooks are queued: the Queue if set, the
+// redis queue if there is a redis client, nil to run them right away.
+func (r *Runner) queue() Queue {
+	if r.Queue != nil {
+		return r.Queue
+	}
+	if r.RedisClient != nil {
+		return r.redisQueue()
+	}
+	return nil
+}
+
+func (r *Runner) redisQueue() *RedisQueue {
+	return &RedisQueue{
+		Client:     r.RedisClient,
+		Name:       r.queueName(),
+		Backend:    r.QueueBackend,
+		Partitions: r.Partitions,
+	}
+}
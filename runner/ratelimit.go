@@ -0,0 +1,77 @@
+package runner
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a hook can't run because its user, or
+// the whole instance, ran too many hooks recently.
+var ErrRateLimited = errors.New("too many hooks, try again later")
+
+const globalLimiterKey = ""
+
+// rateLimiter is a set of token buckets, one per key.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: map[string]*bucket{}}
+}
+
+// allow takes a token from the bucket of the key, which is refilled at a rate
+// of perMinute tokens per minute. A limit of zero disables the bucket.
+func (l *rateLimiter) allow(key string, perMinute int) bool {
+	if perMinute <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	limit := float64(perMinute)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(limit, b.tokens+now.Sub(b.last).Minutes()*limit)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// allowHook checks both the user and the global hook rate limits.
+func (r *Runner) allowHook(username string) error {
+	if r.limiter == nil {
+		return nil
+	}
+
+	if !r.limiter.allow(globalLimiterKey, r.MaxGlobalHooksPerMinute) {
+		return ErrRateLimited
+	}
+
+	// the global key is empty, so it never collides with an username
+	if !r.limiter.allow("user:"+username, r.MaxHooksPerMinute) {
+		return ErrRateLimited
+	}
+
+	return nil
+}
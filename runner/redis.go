@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+// RedisOptions returns the options of the redis client of the runner. It
+// fails if the TLS certificates can't be loaded.
+func RedisOptions(s settings.Redis) (*redis.Options, error) {
+	opts := &redis.Options{
+		Addr:     s.GetAddress(),
+		Password: s.Password,
+		DB:       s.DB,
+		PoolSize: s.PoolSize,
+	}
+
+	if !s.TLS {
+		if s.CA != "" || s.Cert != "" {
+			return nil, errors.New("redis certificates are set but TLS is disabled")
+		}
+		return opts, nil
+	}
+
+	opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if s.CA != "" {
+		pem, err := os.ReadFile(s.CA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis CA: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in redis CA %s", s.CA)
+		}
+		opts.TLSConfig.RootCAs = pool
+	}
+
+	if s.Cert != "" || s.Key != "" {
+		cert, err := tls.LoadX509KeyPair(s.Cert, s.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load redis client certificate: %w", err)
+		}
+		opts.TLSConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,60 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HookRejectedExitCode is the exit code a before hook uses to reject an
+// operation without giving a specific status.
+const HookRejectedExitCode = 2
+
+// ErrHookRejected is returned when a before hook rejects the operation.
+// It is built either from the HookRejectedExitCode or from a JSON line
+// printed to stdout, such as {"status":403,"message":"not allowed"}.
+type ErrHookRejected struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func (e *ErrHookRejected) Error() string {
+	return fmt.Sprintf("rejected by hook with status %d: %s", e.Status, e.Message)
+}
+
+// rejection checks if a before hook result asks to abort the operation.
+// It returns nil when it doesn't.
+func rejection(result *ExecResult) *ErrHookRejected {
+	if result == nil {
+		return nil
+	}
+
+	lines := strings.Split(strings.TrimSpace(result.Stdout), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+
+		var rejected ErrHookRejected
+		if err := json.Unmarshal([]byte(line), &rejected); err != nil || rejected.Status == 0 {
+			continue
+		}
+
+		if rejected.Status < http.StatusBadRequest || rejected.Status > 599 { //nolint:gomnd
+			rejected.Status = http.StatusForbidden
+		}
+		return &rejected
+	}
+
+	if result.ExitCode == HookRejectedExitCode {
+		message := strings.TrimSpace(result.Stderr)
+		if message == "" {
+			message = "operation rejected"
+		}
+		return &ErrHookRejected{Status: http.StatusForbidden, Message: message}
+	}
+
+	return nil
+}
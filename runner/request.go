@@ -0,0 +1,44 @@
+package runner
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the ID of the request an
+// operation comes from. The hooks run by RunHook with this context get it
+// as REQUEST_ID, and the queued jobs keep it, so that the logs of the
+// workers can be correlated with the request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID of the context, empty if it has none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID generates a random request ID.
+func NewRequestID() string {
+	b := make([]byte, 16) //nolint:gomnd
+	if _, err := rand.Read(b); err != nil {
+		// still unique enough to correlate the logs
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestID returns the request ID of the context, generating one if it has
+// none so that every operation can be traced.
+func requestID(ctx context.Context) string {
+	if id := RequestID(ctx); id != "" {
+		return id
+	}
+	return NewRequestID()
+}
@@ -0,0 +1,80 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc"
+
+	"github.com/filebrowser/filebrowser/v2/runner"
+)
+
+// ErrRemote is wrapped by the errors of the commands run by the remote
+// executor.
+var ErrRemote = errors.New("remote command failed")
+
+// Client runs the commands on a remote executor. It implements
+// runner.Executor.
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// Dial connects to the remote executor at addr. The options must set the
+// transport credentials.
+func Dial(addr string, opts ...grpc.DialOption) (*Client, error) {
+	opts = append(opts, grpc.WithDefaultCallOptions(grpc.ForceCodec(codec{})))
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Execute implements runner.Executor.
+func (c *Client) Execute(ctx context.Context, req *runner.ExecRequest, stdout, stderr io.Writer) (int, error) {
+	stream, err := c.conn.NewStream(ctx, &executeStream, executeMethod)
+	if err != nil {
+		return -1, err
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return -1, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return -1, err
+	}
+
+	for {
+		out := &Output{}
+		if err := stream.RecvMsg(out); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return -1, err
+		}
+
+		if out.Done {
+			if out.Error != "" {
+				return out.ExitCode, fmt.Errorf("%w: %s", ErrRemote, out.Error)
+			}
+			return out.ExitCode, nil
+		}
+
+		if len(out.Stdout) > 0 {
+			if _, err := stdout.Write(out.Stdout); err != nil {
+				return -1, err
+			}
+		}
+		if len(out.Stderr) > 0 {
+			if _, err := stderr.Write(out.Stderr); err != nil {
+				return -1, err
+			}
+		}
+	}
+}
+
+// Close closes the connection to the remote executor.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,50 @@
+// Package rpc runs the hook commands on a remote executor over gRPC, so that
+// untrusted scripts don't run on the host of the web server.
+//
+// The service, filebrowser.runner.Executor, has a single server streaming
+// method, Execute, which takes a runner.ExecRequest and streams back Output
+// messages: the output of the command as it is written, then a last one
+// with Done set, with the exit code and the error of the command. The
+// messages are encoded in JSON.
+package rpc
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc"
+)
+
+// ServiceName is the name of the gRPC service.
+const ServiceName = "filebrowser.runner.Executor"
+
+const executeMethod = "/" + ServiceName + "/Execute"
+
+// Output is a message streamed back by Execute.
+type Output struct {
+	Stdout []byte `json:"stdout,omitempty"`
+	Stderr []byte `json:"stderr,omitempty"`
+	// Done is set on the last message, with the result of the command.
+	Done     bool   `json:"done,omitempty"`
+	ExitCode int    `json:"exitCode"`
+	Error    string `json:"error,omitempty"`
+}
+
+// codec encodes the messages in JSON, they aren't protobuf messages.
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return "json"
+}
+
+var executeStream = grpc.StreamDesc{
+	StreamName:    "Execute",
+	ServerStreams: true,
+}
@@ -0,0 +1,60 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/filebrowser/filebrowser/v2/runner"
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestRemoteExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh is not available on windows")
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(&runner.Runner{Settings: &settings.Settings{}})
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	client, err := Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	r := &runner.Runner{
+		Enabled:       true,
+		CaptureOutput: true,
+		Executor:      client,
+		Settings: &settings.Settings{
+			Commands: map[string][]settings.HookCommand{
+				"before_upload": {{Command: `sh -c 'echo "$FILE"; echo denied >&2; exit 2'`}},
+			},
+		},
+	}
+	user := &users.User{Username: "user", Fs: afero.NewBasePathFs(afero.NewMemMapFs(), "/")}
+
+	err = r.RunHook(context.Background(), func() error { return nil }, "upload", "/a.txt", "", user)
+	if err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("expected the remote command to reject the upload, got %v", err)
+	}
+
+	code, err := client.Execute(context.Background(), &runner.ExecRequest{Command: "missing-command-xyz"}, &strings.Builder{}, &strings.Builder{})
+	if code != -1 || err == nil {
+		t.Errorf("expected an error for a missing command, got %d and %v", code, err)
+	}
+}
@@ -0,0 +1,63 @@
+package rpc
+
+import (
+	"sync"
+
+	"google.golang.org/grpc"
+
+	"github.com/filebrowser/filebrowser/v2/runner"
+)
+
+// NewServer returns a gRPC server running the requests with the executor,
+// usually a runner.Runner with the settings of the remote host.
+func NewServer(executor runner.Executor, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(append(opts, grpc.ForceServerCodec(codec{}))...)
+
+	stream := executeStream
+	stream.Handler = func(_ interface{}, ss grpc.ServerStream) error {
+		return execute(executor, ss)
+	}
+
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: ServiceName,
+		HandlerType: (*interface{})(nil),
+		Streams:     []grpc.StreamDesc{stream},
+	}, executor)
+
+	return s
+}
+
+func execute(executor runner.Executor, ss grpc.ServerStream) error {
+	req := &runner.ExecRequest{}
+	if err := ss.RecvMsg(req); err != nil {
+		return err
+	}
+
+	// the output of the command is written from two goroutines
+	var mu sync.Mutex
+	send := func(out *Output) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return ss.SendMsg(out)
+	}
+
+	stdout := writerFunc(func(p []byte) error { return send(&Output{Stdout: p}) })
+	stderr := writerFunc(func(p []byte) error { return send(&Output{Stderr: p}) })
+
+	code, err := executor.Execute(ss.Context(), req, stdout, stderr)
+
+	done := &Output{Done: true, ExitCode: code}
+	if err != nil {
+		done.Error = err.Error()
+	}
+	return send(done)
+}
+
+type writerFunc func(p []byte) error
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	if err := f(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
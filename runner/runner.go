@@ -1,21 +1,50 @@
 package runner
 
 import (
+	"bufio"
+	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/filebrowser/filebrowser/v2/rules"
 	"github.com/filebrowser/filebrowser/v2/settings"
 	"github.com/filebrowser/filebrowser/v2/users"
 	"github.com/redis/go-redis/v9"
 )
 
+// FileBrowserQueue is the default name of the queue of the after hooks.
 const FileBrowserQueue = "fbq"
 
+const (
+	DefaultRedisRetries      = 3
+	DefaultRedisRetryBackoff = 100 * time.Millisecond
+)
+
+// fallbackMu serializes the access to the fallback file, which is shared
+// between all the runners of the instance.
+var fallbackMu sync.Mutex
+
+var (
+	// ErrCommandFailed is returned when a blocking command can't be run,
+	// exits with an error or is killed.
+	ErrCommandFailed = errors.New("hook command failed")
+	// ErrTimeout is returned when a blocking command runs for longer than
+	// the CommandTimeout.
+	ErrTimeout = errors.New("hook command timed out")
+	// ErrReadOnly is returned when an operation would change the files
+	// while the settings make the server read only.
+	ErrReadOnly = errors.New("the server is read only")
+)
+
 // filterEmptyParts removes empty strings from the command slice.
 func filterEmptyParts(command []string) []string {
 	filteredCommand := command[:0]
@@ -29,135 +58,762 @@ func filterEmptyParts(command []string) []string {
 
 // Runner is a commands runner.
 type Runner struct {
-	Enabled     bool
+	Enabled bool
+	// Queue receives the after hooks. When nil, they are queued in redis
+	// with RedisClient, or run directly like the before hooks without it.
+	Queue Queue
+	// RedisClient is used to queue the after hooks when there is no Queue,
+	// and by the workers to read them. New creates it from the server
+	// settings, see RedisOptions.
 	RedisClient *redis.Client
+	// RedisRetries is the number of times a failed enqueue is retried.
+	RedisRetries int
+	// RedisRetryBackoff is the delay before the first retry. It doubles
+	// after each attempt.
+	RedisRetryBackoff time.Duration
+	// FallbackFile is where jobs that couldn't be queued are written to,
+	// one per line. They are queued again by ReplayFallback.
+	FallbackFile string
+	// QueueName is the redis list the after hooks are pushed to. When
+	// empty, FileBrowserQueue is used.
+	QueueName string
+	// DedupWindow is how long an after hook job is skipped for once an
+	// identical one, with the same command, event and path, was queued.
+	// Zero disables the deduplication.
+	DedupWindow time.Duration
+	// QueueBackend is how the after hooks are queued. When empty, the list
+	// backend is used.
+	QueueBackend QueueBackend
+	// Partitions is the number of lists of the list backend, to keep the
+	// jobs of a path in order. Zero means a single list. See
+	// PartitionQueueName.
+	Partitions int
+	// CommandTimeout is the maximum time a blocking command can run for.
+	// Zero means no limit. Non-blocking commands are not affected.
+	CommandTimeout time.Duration
+	// Logger receives structured logs of the hooks executions. When nil,
+	// the standard logger is used.
+	Logger *slog.Logger
+	// CaptureOutput makes the blocking commands output to be kept in
+	// their ExecResult, in addition to being written to the process output.
+	CaptureOutput bool
+	// MaxOutputBytes limits the output kept for each stream of a command.
+	// The rest is dropped, and a command that keeps writing is killed.
+	// Zero means no limit.
+	MaxOutputBytes int64
+	// DryRun makes the commands to be logged, once expanded, instead of
+	// being run. The operations themselves still run normally.
+	DryRun bool
+	// Checker validates the paths given to the commands. When nil, only
+	// the user scope is enforced.
+	Checker rules.Checker
+	// OnWarning is called with the failures of the before hooks that use
+	// the warn policy. The message is a single line.
+	OnWarning func(msg string)
+	// Locker refuses the operations changing the files locked by others.
+	// When nil, no file is locked.
+	Locker Locker
+	// Executor runs the commands instead of the server process when set,
+	// see the rpc package for a remote one.
+	Executor Executor
+	// Metrics receives the measurements of the hooks, if not nil.
+	Metrics Metrics
+	// Audit records every command run, if not nil.
+	Audit AuditSink
+	// Listeners are told about the operations that succeeded.
+	Listeners []Listener
 	*settings.Settings
+
+	limiter    *rateLimiter
+	breaker    *breaker
+	background *backgroundHooks
+	listings   *listingCache
+}
+
+// New creates a runner configured from the server settings. The runner is
+// meant to be shared by the whole instance, see WithSettings.
+func New(server *settings.Server) *Runner {
+	r := &Runner{
+		Enabled:           server.EnableExec,
+		RedisRetries:      DefaultRedisRetries,
+		RedisRetryBackoff: DefaultRedisRetryBackoff,
+		FallbackFile:      server.HookFallbackFile,
+		CommandTimeout:    server.GetHookTimeout(),
+		DedupWindow:       server.GetHookDedupWindow(),
+		CaptureOutput:     true,
+		MaxOutputBytes:    server.GetMaxHookOutputBytes(),
+		DryRun:            server.HookDryRun,
+		limiter:           newRateLimiter(),
+		breaker:           newBreaker(),
+		background:        newBackgroundHooks(server.MaxBackgroundHooks),
+		listings:          newListingCache(),
+	}
+
+	backend, err := ParseQueueBackend(server.HookQueueBackend)
+	if err != nil {
+		log.Printf("[WARN] %v, using %q", err, QueueBackendList)
+		backend = QueueBackendList
+	}
+	r.QueueBackend = backend
+
+	if server.HookQueuePartitions > 0 {
+		if backend == QueueBackendList {
+			r.Partitions = server.HookQueuePartitions
+		} else {
+			log.Printf("[WARN] The hook queue partitions need the %q backend, ignoring them", QueueBackendList)
+		}
+	}
+
+	if server.HookLogFormat == "json" {
+		r.Logger = slog.New(slog.NewJSONHandler(log.Writer(), nil))
+	}
+
+	if server.EnableHookQueue {
+		opts, err := RedisOptions(server.Redis)
+		if err != nil {
+			// the after hooks run directly instead of being lost
+			log.Printf("[WARN] %v, running the after hooks without queueing them", err)
+		} else {
+			r.RedisClient = redis.NewClient(opts)
+		}
+	}
+
+	switch {
+	case server.HookAuditFile != "":
+		r.Audit = &FileAuditSink{Path: server.HookAuditFile}
+	case server.HookAuditList != "" && r.RedisClient != nil:
+		r.Audit = &RedisAuditSink{Client: r.RedisClient, Key: server.HookAuditList}
+	case server.HookAuditList != "":
+		log.Printf("[WARN] The hook audit list needs the hook queue, not writing the audit log")
+	}
+
+	if sink := NewWebhookSink(server); sink != nil {
+		r.Listeners = append(r.Listeners, sink)
+	}
+
+	return r
+}
+
+// WithSettings returns a copy of the runner that uses the given settings,
+// including their queue name if set. The copy shares the state of the
+// runner, such as the rate limits.
+func (r *Runner) WithSettings(s *settings.Settings) *Runner {
+	c := *r
+	c.Settings = s
+	if s != nil && s.QueueName != "" {
+		c.QueueName = s.QueueName
+	}
+	return &c
+}
+
+func (r *Runner) queueName() string {
+	if r.QueueName == "" {
+		return FileBrowserQueue
+	}
+	return r.QueueName
+}
+
+// ExecResult is the outcome of a blocking command.
+type ExecResult struct {
+	ExitCode int    `json:"exitCode"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
 }
 
-// RunHook runs the hooks for the before and after event.
-func (r *Runner) RunHook(fn func() error, evt, path, dst string, user *users.User) error {
-	path = user.FullPath(path)
-	dst = user.FullPath(dst)
+// Close releases the resources held by the runner.
+func (r *Runner) Close() error {
+	if closer, ok := r.Executor.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+
+	if r.RedisClient == nil {
+		return nil
+	}
+	return r.RedisClient.Close()
+}
+
+// RunHook runs the hooks for the before and after event. The paths are
+// relative to the user scope. Canceling the context stops the blocking
+// commands and the queueing of the after hooks, but not the non-blocking
+// commands already started.
+func (r *Runner) RunHook(ctx context.Context, fn func() error, evt, path, dst string, user *users.User) error {
+	return r.RunHookPath(ctx, func(string) error {
+		return fn()
+	}, evt, path, dst, user)
+}
+
+// RunHookPath is like RunHook, but fn gets the path of the operation, which
+// the before hooks can rename through their Metadata. The after hooks get
+// the renamed path too.
+func (r *Runner) RunHookPath(ctx context.Context, fn func(path string) error, evt, path, dst string, user *users.User) error {
+	return r.runHook(ctx, fn, evt, path, user, dst, user)
+}
+
+// RunHookTransfer is like RunHook for the copies and the moves between the
+// scopes of two users. The path is relative to the scope of user, whose
+// hooks run, and dst to the one of dstUser. The listeners aren't told, the
+// operation being a creation in a scope and maybe a deletion in the other,
+// see Notify.
+func (r *Runner) RunHookTransfer(ctx context.Context, fn func() error, evt, path string, user *users.User, dst string, dstUser *users.User) error {
+	return r.runHook(ctx, func(string) error {
+		return fn()
+	}, evt, path, user, dst, dstUser)
+}
+
+// Locker tells if the files can be changed, see Runner.Locker.
+type Locker interface {
+	// CheckLock returns an error if the path, relative to the scope of the
+	// user, is locked by someone else.
+	CheckLock(path string, user *users.User) error
+}
+
+func (r *Runner) runHook(ctx context.Context, fn func(path string) error, evt, path string, user *users.User, dst string, dstUser *users.User) error {
+	id := requestID(ctx)
+
+	// the downloads are the only operations leaving the files as they are
+	if r.Settings != nil && r.ReadOnly && evt != "download" {
+		return ErrReadOnly
+	}
+
+	if r.Locker != nil && evt != "download" {
+		// the copies leave their source as it is
+		if evt != "copy" {
+			if err := r.Locker.CheckLock(path, user); err != nil {
+				return err
+			}
+		}
+		if dst != "" {
+			if err := r.Locker.CheckLock(dst, dstUser); err != nil {
+				return err
+			}
+		}
+	}
 
 	if r.Enabled {
 		// these should not be queued, if there is some blocking process that we need
 		// to do before executing fn(), then we can't queue it in redis,
 		// it needs to be done immediately.
-		if val, ok := r.Commands["before_"+evt]; ok {
-			for _, command := range val {
-				err := r.exec(command, "before_"+evt, path, dst, user)
+		val, err := r.hookCommands("before_"+evt, path, user)
+		if err != nil {
+			return err
+		}
+		if len(val) > 0 {
+			before := newTransferEvent("before_"+evt, path, user, dst, dstUser)
+			before.requestID = id
+			for _, command := range before.runFor(val) {
+				if err := r.allowHook(user.Username); err != nil {
+					return err
+				}
+
+				result, err := r.runBefore(ctx, command, before)
+				if rejected := rejection(result); rejected != nil {
+					return rejected
+				}
+				if err != nil {
+					if err := r.handleBeforeFailure(before, command, err); err != nil {
+						return err
+					}
+					continue
+				}
+
+				meta, err := r.metadata(before.name, result)
 				if err != nil {
 					return err
 				}
+				if renamed := meta.apply(path); renamed != path {
+					path = renamed
+					before = newTransferEvent(before.name, path, user, dst, dstUser)
+					before.requestID = id
+					// the rules apply to the new name as well
+					if err := r.checkPaths(before); err != nil {
+						return err
+					}
+				}
 			}
 		}
 	}
 
-	err := fn()
+	err := fn(path)
+	if r.Enabled {
+		r.runFinallyHooks(ctx, "finally_"+evt, path, user, dst, dstUser, id, err)
+	}
 	if err != nil {
 		return err
 	}
+	if dstUser == user {
+		r.operationDone("after_"+evt, path, dst, user)
+	}
 
 	if r.Enabled {
-		// queue here
-		if val, ok := r.Commands["after_"+evt]; ok {
-			for _, command := range val {
-				job := struct {
-					Command     string `json:"command"`
-					Event       string `json:"event"`
-					Path        string `json:"path"`
-					Destination string `json:"destination"`
-					UserName    string `json:"username"`
-					UserScope   string `json:"user_scope"`
-				}{
-					Command:     command,
-					Event:       "after_" + evt,
-					Path:        path,
-					Destination: dst,
-					UserName:    user.Username,
-					UserScope:   user.Scope,
-				}
+		// the operation succeeded, the invalid after hooks are only logged
+		val, err := r.hookCommands("after_"+evt, path, user)
+		if err != nil {
+			r.logWarn("After hooks of "+path+" skipped", err)
+		}
+		if len(val) > 0 {
+			after := newTransferEvent("after_"+evt, path, user, dst, dstUser)
+			after.requestID = id
+			r.runAfterHooks(ctx, after.runFor(val), after)
+		}
+	}
 
-				jobBytes, err := json.Marshal(job)
-				if err != nil {
-					return err
-				}
+	return nil
+}
 
-				res := r.RedisClient.LPush(context.Background(), FileBrowserQueue, jobBytes)
-				if res.Err() != nil {
-					return fmt.Errorf("failed to queue job: %w", res.Err())
-				}
+// commands returns the commands of an event for a user. The commands of the
+// user replace the global ones, unless they are appended to them.
+func (r *Runner) commands(event string, user *users.User) []settings.HookCommand {
+	var global []settings.HookCommand
+	if r.Settings != nil {
+		global = matchCommands(r.Commands, event)
+	}
+
+	override, ok := user.Hooks[event]
+	if !ok {
+		return global
+	}
+
+	var commands []settings.HookCommand
+	if override.Append {
+		commands = append(commands, global...)
+	}
+	for _, command := range override.Commands {
+		commands = append(commands, settings.HookCommand{Command: command})
+	}
+	return commands
+}
+
+// hookCommands returns the commands of an event on a path, with their
+// templates resolved: the global or user ones followed by the ones of the
+// nearest hooks file of its directories.
+func (r *Runner) hookCommands(event, p string, user *users.User) ([]settings.HookCommand, error) {
+	dir, err := r.dirCommands(event, p, user)
+	if err != nil {
+		// the operation of the after and finally hooks is done already
+		if !strings.HasPrefix(event, "after_") && !strings.HasPrefix(event, "finally_") {
+			return nil, err
+		}
+		r.logWarn("Hooks file of "+p+" skipped", err)
+	}
+
+	commands := append(append([]settings.HookCommand{}, r.commands(event, user)...), dir...)
+	return r.resolveTemplates(commands)
+}
+
+// resolveTemplates replaces the commands referencing a template by their
+// command line. The errors wrap ErrParseCommand.
+func (r *Runner) resolveTemplates(commands []settings.HookCommand) ([]settings.HookCommand, error) {
+	resolved := make([]settings.HookCommand, 0, len(commands))
+	for _, command := range commands {
+		if command.Template != "" {
+			raw, err := r.ResolveCommand(command)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrParseCommand, err)
 			}
+			command = settings.HookCommand{Command: raw, Match: command.Match}
 		}
+		resolved = append(resolved, command)
+	}
+	return resolved, nil
+}
+
+// runFinallyHooks runs the finally hooks of an event once its operation
+// was done, whether it succeeded or failed with opErr, as told by their
+// OUTCOME. They run right away, before the after hooks, even if the
+// request was canceled, not to skip the cleanups they're meant for. The
+// operation being over, their errors are only logged.
+func (r *Runner) runFinallyHooks(ctx context.Context, name, path string, user *users.User, dst string, dstUser *users.User, id string, opErr error) {
+	val, err := r.hookCommands(name, path, user)
+	if err != nil {
+		r.logWarn("Finally hooks of "+path+" skipped", err)
+		return
+	}
+	if len(val) == 0 {
+		return
+	}
+
+	finally := newTransferEvent(name, path, user, dst, dstUser)
+	finally.requestID = id
+	finally.outcome = OutcomeSuccess
+	if opErr != nil {
+		finally.outcome, finally.outcomeErr = OutcomeError, opErr.Error()
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	for _, command := range finally.runFor(val) {
+		if err := r.allowHook(finally.user.Username); err != nil {
+			r.logWarn(fmt.Sprintf("Finally hook %q dropped", command), err)
+			continue
+		}
+		if _, err := r.exec(ctx, command, finally); err != nil {
+			r.logWarn(fmt.Sprintf("Finally hook %q failed", command), err)
+		}
+	}
+}
+
+// runAfterHooks runs or queues the after hooks of an event. The jobs of the
+// event are queued together, in a single batch if the queue supports it, so
+// that a worker never sees only some of them. The operation already
+// succeeded, so the jobs that can't be queued are only logged and dropped.
+func (r *Runner) runAfterHooks(ctx context.Context, commands []string, after *hookEvent) {
+	queue := r.queue()
+	var jobs []Job
+
+	for _, command := range commands {
+		if err := r.allowHook(after.user.Username); err != nil {
+			r.logWarn(fmt.Sprintf("After hook %q dropped", command), err)
+			continue
+		}
+
+		// without a queue, the after hooks are run right away. The operation
+		// already succeeded, so their errors are only logged. In dry run
+		// mode, they're not queued so that they're logged too.
+		if queue == nil || r.DryRun {
+			_, err := r.exec(ctx, command, after)
+			if err != nil {
+				r.logWarn(fmt.Sprintf("After hook %q failed", command), err)
+			}
+			continue
+		}
+
+		if err := r.checkPaths(after); err != nil {
+			r.logWarn(fmt.Sprintf("After hook %q dropped", command), err)
+			continue
+		}
+
+		job := Job{
+			Command:      command,
+			Event:        after.name,
+			Path:         after.path,
+			Destination:  after.dst,
+			UserName:     after.user.Username,
+			UserScope:    after.user.Scope,
+			PartitionKey: after.path,
+			SHA256:       after.sha256(),
+			RequestID:    after.requestID,
+		}
+
+		if r.duplicate(ctx, &job) {
+			continue
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	if len(jobs) == 0 {
+		return
+	}
+
+	err := r.enqueue(ctx, queue, jobs)
+	for range jobs {
+		r.jobQueued(after.name, err)
+	}
+	if err != nil {
+		r.logWarn("After hooks of "+after.path+" dropped", err)
+	}
+}
+
+// enqueue pushes jobs to the queue, retrying with an exponential backoff.
+// If every attempt fails and a fallback file is set, the jobs are saved
+// there instead of being dropped.
+func (r *Runner) enqueue(ctx context.Context, queue Queue, jobs []Job) error {
+	backoff := r.RedisRetryBackoff
+	pending := jobs
+
+	var err error
+	for attempt := 0; attempt <= r.RedisRetries; attempt++ {
+		if attempt > 0 {
+			r.logWarn(fmt.Sprintf("Failed to queue job (attempt %d/%d)", attempt, r.RedisRetries+1), err)
+			if !sleepContext(ctx, backoff) {
+				err = ctx.Err()
+				break
+			}
+			backoff *= 2
+		}
+
+		pending, err = enqueueJobs(ctx, queue, pending)
+		if err == nil {
+			return nil
+		}
+	}
+
+	if r.FallbackFile == "" {
+		return fmt.Errorf("%w: %w", ErrEnqueue, err)
+	}
+
+	r.logWarn("Failed to queue job, saving it to "+r.FallbackFile, err)
+
+	var lines []byte
+	for _, job := range pending {
+		data, err := job.Marshal()
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, data...), '\n')
+	}
+	return r.writeFallback(lines)
+}
+
+// sleepContext waits for the given duration, returning false if the context
+// is done before.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// writeFallback appends jobs, one per line, to the fallback file.
+func (r *Runner) writeFallback(lines []byte) error {
+	fallbackMu.Lock()
+	defer fallbackMu.Unlock()
+
+	fd, err := os.OpenFile(r.FallbackFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600) //nolint:gomnd
+	if err != nil {
+		return fmt.Errorf("%w: can't save it to the fallback file: %w", ErrEnqueue, err)
+	}
+	defer fd.Close()
+
+	_, err = fd.Write(lines)
+	if err != nil {
+		return fmt.Errorf("%w: can't save it to the fallback file: %w", ErrEnqueue, err)
 	}
 
 	return nil
 }
 
-func (r *Runner) exec(raw, evt, path, dst string, user *users.User) error {
+// ReplayFallback queues again the jobs saved in the fallback file. The jobs
+// that still can't be queued are kept in the file.
+func (r *Runner) ReplayFallback(ctx context.Context) error {
+	queue := r.queue()
+	if r.FallbackFile == "" || queue == nil {
+		return nil
+	}
+
+	fallbackMu.Lock()
+	defer fallbackMu.Unlock()
+
+	content, err := os.ReadFile(r.FallbackFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var pending bytes.Buffer
+	replayed := 0
+
+	s := bufio.NewScanner(bytes.NewReader(content))
+	for s.Scan() {
+		line := s.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		job, err := UnmarshalJob(line)
+		if err == nil {
+			err = queue.Enqueue(ctx, *job)
+		}
+		if err != nil {
+			pending.Write(line)
+			pending.WriteByte('\n')
+			continue
+		}
+		replayed++
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	if replayed > 0 {
+		log.Printf("[INFO] Replayed %d jobs from %s", replayed, r.FallbackFile)
+	}
+
+	if pending.Len() == 0 {
+		return os.Remove(r.FallbackFile)
+	}
+
+	return os.WriteFile(r.FallbackFile, pending.Bytes(), 0600) //nolint:gomnd
+}
+
+// exec runs a hook command. The result is only returned for blocking
+// commands, non-blocking ones return a nil result.
+func (r *Runner) exec(ctx context.Context, raw string, evt *hookEvent) (*ExecResult, error) {
 	blocking := true
 
 	raw = strings.TrimSpace(raw)
 
 	if strings.HasSuffix(raw, "&") {
-		log.Printf("[DEBUG] non blocking")
 		blocking = false
 		raw = strings.TrimSpace(strings.TrimSuffix(raw, "&"))
 	}
 
+	if err := r.checkPaths(evt); err != nil {
+		return nil, err
+	}
+
+	if r.Executor != nil {
+		return r.execRemote(ctx, raw, evt, blocking)
+	}
+
+	raw, envFile := r.splitEnvFile(raw)
+	fileEnv, err := r.loadEnvFile(envFile)
+	if err != nil {
+		return nil, err
+	}
+
 	command, err := ParseCommand(r.Settings, raw)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	envMapping := func(key string) string {
-		switch key {
-		case "FILE":
-			return path
-		case "SCOPE":
-			return user.Scope
-		case "TRIGGER":
-			return evt
-		case "USERNAME":
-			return user.Username
-		case "DESTINATION":
-			return dst
-		default:
-			return os.Getenv(key)
-		}
-	}
-	for i, arg := range command {
-		if i == 0 {
-			continue
+	if err := r.checkAllowed(command[0]); err != nil {
+		return nil, err
+	}
+
+	vars := evt.vars()
+	templates, err := evt.templates()
+	if err != nil {
+		return nil, err
+	}
+	command = filterEmptyParts(expandCommand(r.Settings, command, knownVars(vars), templates))
+
+	dir, err := r.workingDir(evt)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &commandLog{
+		command:   command,
+		evt:       evt.name,
+		path:      evt.path,
+		username:  evt.user.Username,
+		requestID: evt.requestID,
+		blocking:  blocking,
+	}
+	if !blocking {
+		info.jobID = NewRequestID()
+	}
+
+	if r.DryRun {
+		r.logDryRun(info, environ(vars))
+		return nil, nil
+	}
+
+	// non-blocking commands outlive the operation that started them
+	if !blocking {
+		ctx = context.WithoutCancel(ctx)
+	}
+
+	if blocking && r.CommandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.CommandTimeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...) //nolint:gosec
+	cmd.Env = r.env(vars, fileEnv)
+	cmd.Dir = dir
+
+	kill := func() {
+		if cmd.Process != nil {
+			_ = cmd.Process.Kill()
 		}
-		command[i] = os.Expand(arg, envMapping)
 	}
-	command = filterEmptyParts(command)
+	stdout := &outputBuffer{limit: r.MaxOutputBytes, onOverflow: kill}
+	stderr := &outputBuffer{limit: r.MaxOutputBytes, onOverflow: kill}
 
-	cmd := exec.Command(command[0], command[1:]...) //nolint:gosec
-	cmd.Env = append(os.Environ(), fmt.Sprintf("FILE=%s", path))
-	cmd.Env = append(cmd.Env, fmt.Sprintf("SCOPE=%s", user.Scope)) //nolint:gocritic
-	cmd.Env = append(cmd.Env, fmt.Sprintf("TRIGGER=%s", evt))
-	cmd.Env = append(cmd.Env, fmt.Sprintf("USERNAME=%s", user.Username))
-	cmd.Env = append(cmd.Env, fmt.Sprintf("DESTINATION=%s", dst))
+	stdin, err := r.stdin(evt)
+	if err != nil {
+		return nil, err
+	}
+	closeStdin := func() {
+		if stdin != nil {
+			stdin.Close()
+		}
+	}
 
 	cmd.Stdin = os.Stdin
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	if blocking && r.CaptureOutput {
+		cmd.Stdout = io.MultiWriter(os.Stdout, stdout)
+		cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
+	}
 
 	if !blocking {
-		log.Printf("[INFO] Nonblocking Command: \"%s\"", strings.Join(command, " "))
-		defer func() {
-			go func() {
-				err := cmd.Wait()
-				if err != nil {
-					log.Printf("[INFO] Nonblocking Command \"%s\" failed: %s", strings.Join(command, " "), err)
-				}
-			}()
+		if err := r.background.acquire(); err != nil {
+			closeStdin()
+			return nil, err
+		}
+	} else {
+		defer closeStdin()
+	}
+
+	r.logStarted(info)
+	start := time.Now()
+
+	if !blocking {
+		if err := cmd.Start(); err != nil {
+			closeStdin()
+			r.background.release()
+			r.commandFinished(info, time.Since(start), err)
+			return nil, err
+		}
+
+		untrack := r.background.track(info, cmd.Process)
+		go func() {
+			defer r.background.release()
+			err := cmd.Wait()
+			untrack()
+			closeStdin()
+			r.commandFinished(info, time.Since(start), err)
 		}()
-		return cmd.Start()
+		return nil, nil
+	}
+
+	err = cmd.Run()
+	result := &ExecResult{
+		ExitCode: exitCode(err),
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+	}
+
+	switch {
+	case err != nil && r.CommandTimeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded):
+		err = timeoutError(strings.Join(command, " "), r.CommandTimeout)
+	case err != nil && (stdout.killed || stderr.killed):
+		err = overflowError(strings.Join(command, " "), r.MaxOutputBytes)
+	case err != nil && ctx.Err() != nil:
+		err = fmt.Errorf("%w: command %q stopped: %w", ErrCommandFailed, strings.Join(command, " "), ctx.Err())
+	case err != nil:
+		err = commandError(err, stderr.String())
 	}
+	r.commandFinished(info, time.Since(start), err)
+	return result, err
+}
 
-	log.Printf("[INFO] Blocking Command: \"%s\"", strings.Join(command, " "))
-	return cmd.Run()
+// timeoutError is the error of a command that ran for longer than timeout.
+func timeoutError(command string, timeout time.Duration) error {
+	return fmt.Errorf("%w: command %q timed out after %s", ErrTimeout, command, timeout)
+}
+
+// commandError is the error of a command that failed, with its error output
+// if any.
+func commandError(err error, stderr string) error {
+	if stderr = strings.TrimSpace(stderr); stderr != "" {
+		return fmt.Errorf("%w: %w: %s", ErrCommandFailed, err, stderr)
+	}
+	return fmt.Errorf("%w: %w", ErrCommandFailed, err)
 }
@@ -0,0 +1,1729 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func testUser() *users.User {
+	return &users.User{Username: "user", Fs: afero.NewBasePathFs(afero.NewMemMapFs(), "/")}
+}
+
+// hookCommands returns the commands of the settings, without patterns.
+func hookCommands(m map[string][]string) map[string][]settings.HookCommand {
+	commands := make(map[string][]settings.HookCommand, len(m))
+	for event, raw := range m {
+		commands[event] = make([]settings.HookCommand, 0, len(raw))
+		for _, command := range raw {
+			commands[event] = append(commands[event], settings.HookCommand{Command: command})
+		}
+	}
+	return commands
+}
+
+func TestEnqueueFallback(t *testing.T) {
+	fallback := filepath.Join(t.TempDir(), "fallback")
+
+	// nothing listens on port 1, so every push fails right away
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+
+	r := &Runner{
+		RedisClient:       client,
+		RedisRetries:      2,
+		RedisRetryBackoff: time.Millisecond,
+		FallbackFile:      fallback,
+	}
+
+	var want string
+	for _, job := range []Job{{Command: "a"}, {Command: "b"}} {
+		if err := r.enqueue(context.Background(), r.queue(), []Job{job}); err != nil {
+			t.Fatalf("expected job to be saved to fallback file, got error: %v", err)
+		}
+
+		data, err := job.Marshal()
+		if err != nil {
+			t.Fatalf("failed to marshal job: %v", err)
+		}
+		want += string(data) + "\n"
+	}
+
+	content, err := os.ReadFile(fallback)
+	if err != nil {
+		t.Fatalf("failed to read fallback file: %v", err)
+	}
+
+	if string(content) != want {
+		t.Errorf("fallback file = %q, want %q", content, want)
+	}
+
+	// replaying keeps the jobs that still can't be queued
+	if err := r.ReplayFallback(context.Background()); err != nil {
+		t.Fatalf("failed to replay fallback file: %v", err)
+	}
+
+	content, err = os.ReadFile(fallback)
+	if err != nil {
+		t.Fatalf("failed to read fallback file: %v", err)
+	}
+	if string(content) != want {
+		t.Errorf("fallback file after replay = %q, want %q", content, want)
+	}
+
+	// the jobs are replayed to the queue once it works again
+	queue := &MemoryQueue{}
+	r.Queue = queue
+	if err := r.ReplayFallback(context.Background()); err != nil {
+		t.Fatalf("failed to replay fallback file: %v", err)
+	}
+	if jobs := queue.Jobs(); len(jobs) != 2 || jobs[0].Command != "a" || jobs[1].Command != "b" {
+		t.Errorf("unexpected replayed jobs %+v", jobs)
+	}
+	if _, err := os.Stat(fallback); !os.IsNotExist(err) {
+		t.Errorf("expected the fallback file to be removed, got %v", err)
+	}
+}
+
+func TestRunHookQueue(t *testing.T) {
+	queue := &MemoryQueue{}
+	r := &Runner{
+		Enabled: true,
+		Queue:   queue,
+		Settings: &settings.Settings{
+			Commands: hookCommands(map[string][]string{"after_upload": {"echo $FILE"}}),
+		},
+	}
+
+	ctx := WithRequestID(context.Background(), "abc")
+	if err := r.RunHook(ctx, func() error { return nil }, "upload", "/file", "", testUser()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := []Job{{
+		Command:      "echo $FILE",
+		Event:        "after_upload",
+		Path:         "/file",
+		UserName:     "user",
+		PartitionKey: "/file",
+		RequestID:    "abc",
+	}}
+	if got := queue.Take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("queued jobs = %+v, want %+v", got, want)
+	}
+	if got := queue.Jobs(); len(got) != 0 {
+		t.Errorf("expected Take to empty the queue, got %+v", got)
+	}
+}
+
+func TestEnqueueWithoutFallback(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+
+	r := &Runner{RedisClient: client}
+
+	err := r.enqueue(context.Background(), r.queue(), []Job{{}})
+	if !errors.Is(err, ErrEnqueue) || !strings.Contains(err.Error(), "failed to queue job") {
+		t.Errorf("expected queue error, got %v", err)
+	}
+}
+
+func TestRunHookErrors(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("sh is not available on windows")
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+
+	tests := map[string]struct {
+		event   string
+		command string
+		want    error
+	}{
+		"unknown executable": {"before_upload", "filebrowser-missing-command", ErrParseCommand},
+		"unbalanced quotes":  {"before_upload", `echo "oops`, ErrParseCommand},
+		"failing command":    {"before_upload", "false", ErrCommandFailed},
+		"too much output":    {"before_upload", "yes", ErrCommandFailed},
+		"timeout":            {"before_upload", "sleep 5", ErrTimeout},
+		// the operation succeeded, the jobs are dropped
+		"unreachable queue": {"after_upload", "true", nil},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := &Runner{
+				Enabled:        true,
+				CaptureOutput:  true,
+				CommandTimeout: 50 * time.Millisecond,
+				MaxOutputBytes: 4,
+				RedisClient:    client,
+				Settings: &settings.Settings{
+					Commands: hookCommands(map[string][]string{tt.event: {tt.command}}),
+				},
+			}
+
+			err := r.RunHook(context.Background(), func() error { return nil }, "upload", "/file", "", testUser())
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestExecTimeout(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("sleep is not available on windows")
+	}
+
+	r := &Runner{
+		Enabled:        true,
+		CommandTimeout: 50 * time.Millisecond,
+		Settings:       &settings.Settings{},
+	}
+
+	start := time.Now()
+	_, err := r.exec(context.Background(), "sleep 5", newHookEvent("before_upload", "/file", "", testUser()))
+	if !errors.Is(err, ErrTimeout) || !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("command wasn't killed on timeout, took %s", elapsed)
+	}
+}
+
+func TestExecCaptureOutput(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("sh is not available on windows")
+	}
+
+	r := &Runner{
+		Enabled:       true,
+		CaptureOutput: true,
+		Settings:      &settings.Settings{},
+	}
+
+	result, err := r.exec(context.Background(), `sh -c "echo out; echo oops >&2; exit 3"`, newHookEvent("before_upload", "/file", "", testUser()))
+	if err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Errorf("expected error with the command stderr, got %v", err)
+	}
+	if result == nil {
+		t.Fatal("expected a result for a blocking command")
+	}
+	if result.ExitCode != 3 {
+		t.Errorf("exit code = %d, want 3", result.ExitCode)
+	}
+	if result.Stdout != "out\n" {
+		t.Errorf("stdout = %q, want %q", result.Stdout, "out\n")
+	}
+	if result.Stderr != "oops\n" {
+		t.Errorf("stderr = %q, want %q", result.Stderr, "oops\n")
+	}
+}
+
+func TestRunHookRejected(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("sh is not available on windows")
+	}
+
+	tests := map[string]struct {
+		command string
+		want    ErrHookRejected
+	}{
+		"json line": {
+			command: `sh -c 'echo "{\"status\":413,\"message\":\"too big\"}"'`,
+			want:    ErrHookRejected{Status: 413, Message: "too big"},
+		},
+		"json line with invalid status": {
+			command: `sh -c 'echo "{\"status\":200,\"message\":\"nope\"}"; exit 1'`,
+			want:    ErrHookRejected{Status: 403, Message: "nope"},
+		},
+		"exit code": {
+			command: `sh -c 'echo denied >&2; exit 2'`,
+			want:    ErrHookRejected{Status: 403, Message: "denied"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := &Runner{
+				Enabled:       true,
+				CaptureOutput: true,
+				Settings: &settings.Settings{
+					Commands: hookCommands(map[string][]string{"before_upload": {tt.command}}),
+				},
+			}
+			user := testUser()
+
+			called := false
+			err := r.RunHook(context.Background(), func() error {
+				called = true
+				return nil
+			}, "upload", "/file", "", user)
+
+			var rejected *ErrHookRejected
+			if !errors.As(err, &rejected) {
+				t.Fatalf("expected ErrHookRejected, got %v", err)
+			}
+			if *rejected != tt.want {
+				t.Errorf("rejection = %+v, want %+v", *rejected, tt.want)
+			}
+			if called {
+				t.Error("the operation shouldn't run when a hook rejects it")
+			}
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter()
+
+	for i := 0; i < 3; i++ {
+		if !l.allow("a", 3) {
+			t.Fatalf("call %d should be allowed", i)
+		}
+	}
+	if l.allow("a", 3) {
+		t.Error("call over the limit should be rejected")
+	}
+	if !l.allow("b", 3) {
+		t.Error("buckets should be independent")
+	}
+	if !l.allow("a", 0) {
+		t.Error("a zero limit should disable the bucket")
+	}
+
+	r := &Runner{
+		limiter:  l,
+		Settings: &settings.Settings{MaxGlobalHooksPerMinute: 1},
+	}
+	if err := r.allowHook("c"); err != nil {
+		t.Errorf("first hook should be allowed, got %v", err)
+	}
+	if err := r.allowHook("d"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited from the global limit, got %v", err)
+	}
+}
+
+func TestHookEventVars(t *testing.T) {
+	user := testUser()
+	if err := afero.WriteFile(user.Fs, "/photo.png", []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	vars := newHookEvent("after_upload", "/photo.png", "", user).vars()
+	if vars["FILE_SIZE"] != "7" {
+		t.Errorf("FILE_SIZE = %q, want %q", vars["FILE_SIZE"], "7")
+	}
+	if vars["FILE_MIME"] != "image/png" {
+		t.Errorf("FILE_MIME = %q, want %q", vars["FILE_MIME"], "image/png")
+	}
+	if want := "ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73"; vars["FILE_SHA256"] != want {
+		t.Errorf("FILE_SHA256 = %q, want %q", vars["FILE_SHA256"], want)
+	}
+	if vars["FILE_MODTIME"] == "" || vars["EVENT_TIME"] == "" {
+		t.Errorf("expected FILE_MODTIME and EVENT_TIME to be set, got %q and %q", vars["FILE_MODTIME"], vars["EVENT_TIME"])
+	}
+
+	vars = newHookEvent("before_upload", "/missing.txt", "", user).vars()
+	if _, ok := vars["FILE_SHA256"]; ok {
+		t.Error("expected no FILE_SHA256 for a before hook")
+	}
+	if vars["FILE_SIZE"] != "" || vars["FILE_MIME"] != "" || vars["FILE_MODTIME"] != "" {
+		t.Errorf("expected empty file variables for a missing file, got %v", vars)
+	}
+}
+
+func TestHookEventTemplates(t *testing.T) {
+	user := testUser()
+	evt := newHookEvent("after_upload", "/file", "", user)
+	evt.time = time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC)
+
+	templates, err := evt.templates()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if templates["year"] != "2024" || templates["month"] != "03" || templates["day"] != "05" {
+		t.Errorf("unexpected date templates %v", templates)
+	}
+
+	for _, username := range []string{"..", "a/b", `a\b`} {
+		user.Username = username
+		if _, err := newHookEvent("after_upload", "/file", "", user).templates(); !errors.Is(err, ErrPathNotAllowed) {
+			t.Errorf("username %q: expected ErrPathNotAllowed, got %v", username, err)
+		}
+	}
+}
+
+func TestExecDryRun(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "marker")
+	r := &Runner{DryRun: true, Settings: &settings.Settings{}}
+
+	result, err := r.exec(context.Background(), "touch "+marker, newHookEvent("before_upload", "/file", "", testUser()))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result != nil {
+		t.Errorf("expected no result, got %+v", result)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("expected the command not to run, got %v", err)
+	}
+}
+
+func TestExecBackgroundLimit(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("sleep is not a binary on windows")
+	}
+
+	r := &Runner{Settings: &settings.Settings{}, background: newBackgroundHooks(1)}
+	evt := newHookEvent("after_upload", "/file", "", testUser())
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, err := r.exec(context.Background(), "sleep 0.2 &", evt); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("expected the second command to wait for the first one, took %s", elapsed)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("sleep is not a binary on windows")
+	}
+
+	r := &Runner{Settings: &settings.Settings{}, background: newBackgroundHooks(0)}
+	evt := newHookEvent("after_upload", "/file", "", testUser())
+
+	if _, err := r.exec(context.Background(), "sleep 0.2 &", evt); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := r.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the shutdown to time out, got %v", err)
+	}
+
+	if _, err := r.exec(context.Background(), "sleep 0.2 &", evt); !errors.Is(err, ErrShutdown) {
+		t.Errorf("expected ErrShutdown, got %v", err)
+	}
+
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Errorf("expected the running command to finish, got %v", err)
+	}
+}
+
+func TestGo(t *testing.T) {
+	r := &Runner{background: newBackgroundHooks(1)}
+
+	release := make(chan struct{})
+	if err := r.Go(func() { <-release }); err != nil {
+		t.Fatalf("expected the function to run, got %v", err)
+	}
+	// the functions don't take the slots of the commands
+	if err := r.background.acquire(); err != nil {
+		t.Fatalf("expected a slot to be free, got %v", err)
+	}
+	r.background.release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := r.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the shutdown to wait for the function, got %v", err)
+	}
+	if err := r.Go(func() {}); !errors.Is(err, ErrShutdown) {
+		t.Errorf("expected ErrShutdown, got %v", err)
+	}
+
+	close(release)
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Errorf("expected the function to finish, got %v", err)
+	}
+}
+
+func TestExecCanceled(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("sleep is not a binary on windows")
+	}
+
+	r := &Runner{Settings: &settings.Settings{}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := r.exec(ctx, "sleep 5", newHookEvent("before_upload", "/file", "", testUser()))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the command to be killed, took %s", elapsed)
+	}
+}
+
+func TestWithSettingsQueueName(t *testing.T) {
+	r := &Runner{}
+	if got := r.WithSettings(&settings.Settings{}).queueName(); got != FileBrowserQueue {
+		t.Errorf("queueName() = %q, want %q", got, FileBrowserQueue)
+	}
+
+	c := r.WithSettings(&settings.Settings{QueueName: "fbq:tenant-a"})
+	if got := c.queueName(); got != "fbq:tenant-a" {
+		t.Errorf("queueName() = %q, want %q", got, "fbq:tenant-a")
+	}
+	if got := c.deadQueueName(); got != "fbq:tenant-a:dead" {
+		t.Errorf("deadQueueName() = %q, want %q", got, "fbq:tenant-a:dead")
+	}
+}
+
+func TestParseQueueBackend(t *testing.T) {
+	for name, want := range map[string]QueueBackend{
+		"":       QueueBackendList,
+		"list":   QueueBackendList,
+		"stream": QueueBackendStream,
+	} {
+		got, err := ParseQueueBackend(name)
+		if err != nil || got != want {
+			t.Errorf("ParseQueueBackend(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+
+	if _, err := ParseQueueBackend("kafka"); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
+
+type denyChecker string
+
+func (d denyChecker) Check(path string) bool {
+	return !strings.HasPrefix(path, string(d))
+}
+
+func TestExecCheckPaths(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("symlinks need privileges on windows")
+	}
+
+	scope := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(scope, "link")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	user := &users.User{Username: "user", Fs: afero.NewBasePathFs(afero.NewOsFs(), scope)}
+	r := &Runner{Settings: &settings.Settings{}, Checker: denyChecker("/private")}
+
+	tests := map[string]struct {
+		path    string
+		dst     string
+		allowed bool
+	}{
+		"inside scope":     {path: "/file.txt", allowed: true},
+		"denied by rules":  {path: "/private/file.txt"},
+		"denied dst":       {path: "/file.txt", dst: "/private/file.txt"},
+		"symlink escaping": {path: "/link/file.txt"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := r.exec(context.Background(), "true", newHookEvent("before_rename", tt.path, tt.dst, user))
+			if tt.allowed && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrPathNotAllowed) {
+				t.Errorf("expected ErrPathNotAllowed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRunHookQueuedCheckPaths(t *testing.T) {
+	queue := &MemoryQueue{}
+	r := &Runner{
+		Enabled:  true,
+		Queue:    queue,
+		Checker:  denyChecker("/private"),
+		Settings: &settings.Settings{Commands: hookCommands(map[string][]string{"after_upload": {"echo $FILE"}})},
+	}
+
+	// the operation is done, the denied paths only skip the queued jobs
+	ran := false
+	err := r.RunHook(context.Background(), func() error {
+		ran = true
+		return nil
+	}, "upload", "/private/file.txt", "", testUser())
+	if err != nil || !ran {
+		t.Fatalf("expected the upload to succeed, got %v", err)
+	}
+	if jobs := queue.Take(); len(jobs) != 0 {
+		t.Errorf("expected the denied job not to be queued, got %+v", jobs)
+	}
+}
+
+func TestRunHookInvalidAfterTemplate(t *testing.T) {
+	queue := &MemoryQueue{}
+	r := &Runner{
+		Enabled: true,
+		Queue:   queue,
+		Settings: &settings.Settings{Commands: map[string][]settings.HookCommand{
+			"after_upload": {{Template: "missing"}},
+		}},
+	}
+
+	ran := false
+	err := r.RunHook(context.Background(), func() error {
+		ran = true
+		return nil
+	}, "upload", "/file.txt", "", testUser())
+	if err != nil || !ran {
+		t.Fatalf("expected the upload to succeed, got %v", err)
+	}
+	if jobs := queue.Take(); len(jobs) != 0 {
+		t.Errorf("expected no job to be queued, got %+v", jobs)
+	}
+}
+
+type recordedCommand struct {
+	event    string
+	blocking bool
+	failed   bool
+}
+
+type recordingMetrics struct {
+	commands []recordedCommand
+}
+
+func (m *recordingMetrics) CommandFinished(event string, blocking bool, _ time.Duration, err error) {
+	m.commands = append(m.commands, recordedCommand{event, blocking, err != nil})
+}
+
+func (m *recordingMetrics) JobQueued(string, error) {}
+
+func TestExecMetrics(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("true and false are not binaries on windows")
+	}
+
+	metrics := &recordingMetrics{}
+	r := &Runner{Settings: &settings.Settings{}, Metrics: metrics}
+	evt := newHookEvent("before_upload", "/file", "", testUser())
+
+	_, _ = r.exec(context.Background(), "true", evt)
+	_, _ = r.exec(context.Background(), "false", evt)
+
+	want := []recordedCommand{
+		{"before_upload", true, false},
+		{"before_upload", true, true},
+	}
+	if !reflect.DeepEqual(metrics.commands, want) {
+		t.Errorf("got %+v, want %+v", metrics.commands, want)
+	}
+}
+
+func TestRunHookFailurePolicy(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("false is not a binary on windows")
+	}
+
+	for policy, wantErr := range map[string]bool{"": true, "abort": true, "continue": false, "warn": false} {
+		t.Run(policy, func(t *testing.T) {
+			var warnings []string
+			r := &Runner{
+				Enabled: true,
+				Settings: &settings.Settings{
+					Commands:     hookCommands(map[string][]string{"before_upload": {"false"}}),
+					HookPolicies: map[string]string{"before_upload": policy},
+				},
+				OnWarning: func(msg string) {
+					warnings = append(warnings, msg)
+				},
+			}
+
+			ran := false
+			err := r.RunHook(context.Background(), func() error {
+				ran = true
+				return nil
+			}, "upload", "/file", "", testUser())
+
+			if (err != nil) != wantErr || ran == wantErr {
+				t.Errorf("got error %v and ran %t", err, ran)
+			}
+			if (len(warnings) > 0) != (policy == "warn") {
+				t.Errorf("unexpected warnings %q", warnings)
+			}
+		})
+	}
+}
+
+func TestRunnerEnv(t *testing.T) {
+	t.Setenv("SECRET", "hunter2")
+
+	inherit := false
+	r := &Runner{Settings: &settings.Settings{
+		InheritEnv: &inherit,
+		ExtraEnv:   map[string]string{"TOKEN": "abc", "FILE": "overridden"},
+	}}
+
+	got := r.env(map[string]string{"FILE": "/a.txt"}, nil)
+	want := []string{"FILE=overridden", "TOKEN=abc", "FILE=/a.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("env() = %q, want %q", got, want)
+	}
+
+	r.InheritEnv = nil
+	if got := r.env(nil, nil); !slices.Contains(got, "SECRET=hunter2") {
+		t.Error("expected the environment of the server to be inherited by default")
+	}
+}
+
+func TestExecEnvInjection(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("echo is not a binary on windows")
+	}
+
+	t.Setenv("SECRET", "hunter2")
+
+	r := &Runner{Settings: &settings.Settings{}, CaptureOutput: true}
+
+	tests := map[string]struct {
+		path    string
+		command string
+		want    string
+	}{
+		"braces in file name": {
+			path:    "/report_${HOME}.txt",
+			command: "echo $FILE",
+			want:    "/report_${HOME}.txt",
+		},
+		"dollar in file name": {
+			path:    "/report_$SECRET.txt",
+			command: "echo $FILE",
+			want:    "/report_$SECRET.txt",
+		},
+		"unknown variable in command": {
+			path:    "/report.txt",
+			command: "echo ${SECRET} $FILE",
+			want:    "${SECRET} /report.txt",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := r.exec(context.Background(), tt.command, newHookEvent("before_upload", tt.path, "", testUser()))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got := strings.TrimSpace(result.Stdout); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkerStartRequirements(t *testing.T) {
+	handler := func(Job) error { return nil }
+	queued := &Runner{RedisClient: redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})}
+	defer queued.Close()
+
+	for name, w := range map[string]*Worker{
+		"no runner":       {Handler: handler},
+		"no redis client": {Runner: &Runner{}, Handler: handler},
+		"no handler":      {Runner: queued},
+	} {
+		if err := w.Start(context.Background()); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestJobMarshal(t *testing.T) {
+	job := &Job{
+		Command:     "scan $FILE",
+		Event:       "after_upload",
+		Path:        "/srv/file",
+		Destination: "/srv/dst",
+		UserName:    "user",
+		UserScope:   "/",
+	}
+
+	data, err := job.Marshal()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	got, err := UnmarshalJob(data)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(got, job) {
+		t.Errorf("got %+v, want %+v", got, job)
+	}
+
+	if _, err := UnmarshalJob([]byte("not json")); err == nil {
+		t.Error("expected an error for an invalid job")
+	}
+}
+
+func TestHookEventDestination(t *testing.T) {
+	user := testUser()
+
+	if vars := newHookEvent("after_delete", "/file", "", user).vars(); vars["DESTINATION"] != "" {
+		t.Errorf("expected no destination for a delete, got %q", vars["DESTINATION"])
+	}
+	if vars := newHookEvent("after_move", "/file", "/dir/file", user).vars(); vars["DESTINATION"] != "/dir/file" {
+		t.Errorf("DESTINATION = %q, want %q", vars["DESTINATION"], "/dir/file")
+	}
+}
+
+func TestCommandsUserOverrides(t *testing.T) {
+	r := &Runner{Settings: &settings.Settings{
+		Commands: hookCommands(map[string][]string{
+			"before_upload": {"scan $FILE"},
+			"after_upload":  {"index $FILE"},
+		}),
+	}}
+
+	user := testUser()
+	user.Hooks = map[string]users.EventHooks{
+		"before_upload": {Commands: []string{"quota $FILE"}},
+		"after_upload":  {Commands: []string{"notify $FILE"}, Append: true},
+		"after_delete":  {Commands: []string{"audit $FILE"}},
+	}
+
+	tests := map[string][]string{
+		"before_upload": {"quota $FILE"},
+		"after_upload":  {"index $FILE", "notify $FILE"},
+		"after_delete":  {"audit $FILE"},
+		"before_delete": nil,
+	}
+
+	evt := newHookEvent("before_upload", "/file", "", user)
+	for event, want := range tests {
+		if got := evt.runFor(r.commands(event, user)); !reflect.DeepEqual(got, want) {
+			t.Errorf("commands(%q) = %q, want %q", event, got, want)
+		}
+	}
+
+	if got := evt.runFor(r.commands("before_upload", testUser())); !reflect.DeepEqual(got, []string{"scan $FILE"}) {
+		t.Errorf("expected the global commands without overrides, got %q", got)
+	}
+}
+
+func TestResolveTemplates(t *testing.T) {
+	r := &Runner{Settings: &settings.Settings{
+		CommandTemplates: map[string]settings.CommandTemplate{
+			"thumbnail": {
+				Command: "convert $FILE -resize {{ size }} {{dir}}/{{year}}/{{name}}",
+				Params: []settings.TemplateParam{
+					{Name: "size", Default: "256x256"},
+					{Name: "dir", Required: true},
+					{Name: "name", Default: "thumb.jpg"},
+				},
+			},
+		},
+	}}
+
+	resolved, err := r.resolveTemplates([]settings.HookCommand{
+		{Command: "scan $FILE"},
+		{Template: "thumbnail", Match: "image/*", Params: map[string]string{"dir": "$SCOPE/thumbs", "name": "{{size}}"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []settings.HookCommand{
+		{Command: "scan $FILE"},
+		{Command: "convert $FILE -resize 256x256 $SCOPE/thumbs/{{year}}/{{size}}", Match: "image/*"},
+	}
+	if !reflect.DeepEqual(resolved, want) {
+		t.Errorf("resolveTemplates() = %q, want %q", resolved, want)
+	}
+
+	_, err = r.resolveTemplates([]settings.HookCommand{{Template: "thumbnail"}})
+	if !errors.Is(err, ErrParseCommand) || !errors.Is(err, settings.ErrCommandTemplate) {
+		t.Errorf("expected a missing parameter to be an invalid command, got %v", err)
+	}
+}
+
+func TestRunForMatch(t *testing.T) {
+	user := testUser()
+	if err := afero.WriteFile(user.Fs, "/notes", []byte("%PDF-1.4"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	commands := []settings.HookCommand{
+		{Command: "all"},
+		{Command: "pictures", Match: "*.jpg, *.PNG"},
+		{Command: "images", Match: "image/*"},
+		{Command: "documents", Match: "application/pdf,*.txt"},
+		{Command: "invalid", Match: "[a"},
+	}
+
+	tests := map[string][]string{
+		"/dir/photo.JPG": {"all", "pictures", "images"},
+		"/icon.png":      {"all", "pictures", "images"},
+		"/drawing.svg":   {"all", "images"},
+		"/readme.txt":    {"all", "documents"},
+		"/notes":         {"all", "documents"},
+		"/archive.zip":   {"all"},
+	}
+
+	for p, want := range tests {
+		evt := newHookEvent("before_upload", p, "", user)
+		if got := evt.runFor(commands); !reflect.DeepEqual(got, want) {
+			t.Errorf("runFor(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
+
+func TestMatchCommands(t *testing.T) {
+	commands := map[string][]string{
+		"after_copy":            {"exact"},
+		"after_*":               {"all after"},
+		"after_copy|after_move": {"copy or move"},
+		"before_[cd]*":          {"before c or d"},
+	}
+
+	tests := map[string][]string{
+		"after_copy":    {"exact", "all after", "copy or move"},
+		"after_move":    {"all after", "copy or move"},
+		"after_upload":  {"all after"},
+		"before_delete": {"before c or d"},
+		"before_upload": nil,
+	}
+
+	for event, want := range tests {
+		if got := matchCommands(commands, event); !reflect.DeepEqual(got, want) {
+			t.Errorf("matchCommands(%q) = %q, want %q", event, got, want)
+		}
+	}
+}
+
+func TestExecAllowedCommands(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("true is not a binary on windows")
+	}
+
+	truePath, err := exec.LookPath("true")
+	if err != nil {
+		t.Skip("true is not available")
+	}
+	truePath, _ = filepath.Abs(truePath)
+
+	evt := newHookEvent("before_upload", "/file", "", testUser())
+
+	tests := map[string]struct {
+		allowed []string
+		command string
+		ok      bool
+	}{
+		"empty list":          {nil, "true", true},
+		"allowed by name":     {[]string{"true"}, "true", true},
+		"allowed by path":     {[]string{truePath}, "true", true},
+		"path not by name":    {[]string{"true"}, truePath, false},
+		"not in the list":     {[]string{"false"}, "true", false},
+		"absolute not listed": {[]string{"/usr/local/bin/true-copy"}, truePath, false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := &Runner{Settings: &settings.Settings{AllowedCommands: tt.allowed}}
+			_, err := r.exec(context.Background(), tt.command, evt)
+			if tt.ok && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrCommandNotAllowed) {
+				t.Errorf("expected ErrCommandNotAllowed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDuplicateWithoutRedis(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer client.Close()
+
+	job := &Job{Command: "index $FILE", Event: "after_save", Path: "/srv/file"}
+
+	r := &Runner{RedisClient: client}
+	if r.duplicate(context.Background(), job) {
+		t.Error("expected no deduplication without a window")
+	}
+
+	r.DedupWindow = time.Minute
+	if r.duplicate(context.Background(), job) {
+		t.Error("expected the job to be queued when redis can't be reached")
+	}
+
+	r.RedisClient = nil
+	if r.duplicate(context.Background(), job) {
+		t.Error("expected no deduplication without a client")
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	dir := t.TempDir()
+
+	r := &Runner{Enabled: true, Settings: &settings.Settings{
+		ScriptsDir: dir,
+		Commands:   hookCommands(map[string][]string{"after_upload": {"@missing.sh $FILE &"}}),
+	}}
+	if err := r.HealthCheck(context.Background()); err == nil {
+		t.Error("expected an error for a missing script")
+	}
+
+	r.Commands = hookCommands(map[string][]string{"after_upload": {"echo $FILE"}})
+	if err := r.HealthCheck(context.Background()); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer client.Close()
+	r.RedisClient = client
+	if err := r.HealthCheck(context.Background()); err == nil {
+		t.Error("expected an error when redis is unreachable")
+	}
+}
+
+func TestExecUseShell(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("/bin/sh is not available on windows")
+	}
+
+	r := &Runner{Settings: &settings.Settings{UseShell: true}, CaptureOutput: true}
+	evt := newHookEvent("before_upload", "/my file; rm -rf ~", "", testUser())
+
+	result, err := r.exec(context.Background(), `echo "$FILE" | tr a-z A-Z`, evt)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got, want := strings.TrimSpace(result.Stdout), "/MY FILE; RM -RF ~"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	result, err = r.exec(context.Background(), `echo "$FILE" | wc -c &`, evt)
+	if err != nil || result != nil {
+		t.Errorf("expected the command to run in the background, got %+v and %v", result, err)
+	}
+}
+
+func TestExecStdin(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("cat is not a binary on windows")
+	}
+
+	user := testUser()
+	if err := afero.WriteFile(user.Fs, "/file.txt", []byte("file content"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	r := &Runner{
+		Settings:      &settings.Settings{StdinEvents: []string{"after_upload"}},
+		CaptureOutput: true,
+	}
+
+	result, err := r.exec(context.Background(), "cat", newHookEvent("after_upload", "/file.txt", "", user))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.Stdout != "file content" {
+		t.Errorf("got %q, want %q", result.Stdout, "file content")
+	}
+}
+
+func TestRunBeforeBreaker(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("false is not a binary on windows")
+	}
+
+	r := &Runner{
+		Settings: &settings.Settings{
+			HookBreaker: settings.HookBreaker{Threshold: 2, Cooldown: "50ms"},
+		},
+		breaker: newBreaker(),
+	}
+	evt := newHookEvent("before_upload", "/file", "", testUser())
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.runBefore(context.Background(), "false", evt); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected the command to fail, got %v", err)
+		}
+	}
+
+	if _, err := r.runBefore(context.Background(), "false", evt); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the circuit to be open, got %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	// the probe fails and opens the circuit again
+	if _, err := r.runBefore(context.Background(), "false", evt); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the probe to run, got %v", err)
+	}
+	if _, err := r.runBefore(context.Background(), "false", evt); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the circuit to be open again, got %v", err)
+	}
+
+	// other commands aren't affected
+	if _, err := r.runBefore(context.Background(), "true", evt); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestExecWorkingDir(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("pwd is not a binary on windows")
+	}
+
+	scope, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to resolve the scope: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(scope, "docs"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(scope, "docs", "a.txt"), []byte(""), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	user := &users.User{Username: "user", Fs: afero.NewBasePathFs(afero.NewOsFs(), scope)}
+
+	tests := map[string]struct {
+		path string
+		want string
+	}{
+		"scope": {"/docs/a.txt", scope},
+		"file":  {"/docs/a.txt", filepath.Join(scope, "docs")},
+	}
+
+	for mode, tt := range tests {
+		t.Run(mode, func(t *testing.T) {
+			r := &Runner{Settings: &settings.Settings{HookWorkingDir: mode}, CaptureOutput: true}
+
+			result, err := r.exec(context.Background(), "pwd", newHookEvent("before_save", tt.path, "", user))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got := strings.TrimSpace(result.Stdout); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	r := &Runner{Settings: &settings.Settings{HookWorkingDir: "file"}}
+	_, err = r.exec(context.Background(), "pwd", newHookEvent("before_upload", "/missing/a.txt", "", user))
+	if err == nil {
+		t.Error("expected an error for a missing working directory")
+	}
+}
+
+func TestRunHookRequestID(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("sh is not available on windows")
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	r := &Runner{
+		Enabled: true,
+		Settings: &settings.Settings{
+			Commands: hookCommands(map[string][]string{
+				"before_upload": {`sh -c 'test -n "$REQUEST_ID"'`},
+				"after_upload":  {`sh -c 'echo "$REQUEST_ID" > "$0"' ` + out},
+			}),
+		},
+	}
+	noop := func() error { return nil }
+
+	ctx := WithRequestID(context.Background(), "abc")
+	if err := r.RunHook(ctx, noop, "upload", "/file", "", testUser()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if strings.TrimSpace(string(got)) != "abc" {
+		t.Errorf("REQUEST_ID = %q, want %q", got, "abc")
+	}
+
+	// an ID is generated when the context has none
+	if err := r.RunHook(context.Background(), noop, "upload", "/file", "", testUser()); err != nil {
+		t.Errorf("expected a generated request ID, got %v", err)
+	}
+}
+
+func TestRunHookFinally(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("sh is not available on windows")
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	r := &Runner{
+		Enabled: true,
+		Settings: &settings.Settings{
+			Commands: hookCommands(map[string][]string{
+				"finally_upload": {`sh -c 'echo "$OUTCOME $OUTCOME_ERROR" >> "$0"' ` + out},
+			}),
+		},
+	}
+	failure := errors.New("disk full")
+
+	if err := r.RunHook(context.Background(), func() error { return nil }, "upload", "/file", "", testUser()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// the failed operations keep their error, and the finally hooks run
+	// even if the request is gone
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.RunHook(ctx, func() error { return failure }, "upload", "/file", "", testUser()); !errors.Is(err, failure) {
+		t.Fatalf("expected the error of the operation, got %v", err)
+	}
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if want := "success \nerror disk full\n"; string(got) != want {
+		t.Errorf("expected the outcomes %q, got %q", want, got)
+	}
+}
+
+// flakyQueue fails every other Enqueue and doesn't support batches.
+type flakyQueue struct {
+	calls int
+	jobs  []Job
+}
+
+func (q *flakyQueue) Enqueue(_ context.Context, job Job) error {
+	q.calls++
+	if q.calls%2 == 0 {
+		return errors.New("unavailable")
+	}
+	q.jobs = append(q.jobs, job)
+	return nil
+}
+
+func TestEnqueueBatch(t *testing.T) {
+	jobs := []Job{{Command: "a"}, {Command: "b"}, {Command: "c"}}
+
+	batch := &MemoryQueue{}
+	r := &Runner{}
+	if err := r.enqueue(context.Background(), batch, jobs); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := batch.Jobs(); !reflect.DeepEqual(got, jobs) {
+		t.Errorf("queued jobs = %+v, want %+v", got, jobs)
+	}
+
+	// without batches, the retries resume from the first job not queued
+	flaky := &flakyQueue{}
+	r = &Runner{RedisRetries: 3, RedisRetryBackoff: time.Millisecond}
+	if err := r.enqueue(context.Background(), flaky, jobs); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := flaky.jobs; !reflect.DeepEqual(got, jobs) {
+		t.Errorf("queued jobs = %+v, want %+v", got, jobs)
+	}
+}
+
+func TestTestCommand(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("sh is not available on windows")
+	}
+
+	r := &Runner{Settings: &settings.Settings{}}
+
+	result, err := r.TestCommand(context.Background(), `sh -c 'echo "$TRIGGER $1"; exit 3' sh $FILE &`, Job{Event: "after_upload", Path: "/a.txt"}, testUser())
+	if err == nil {
+		t.Error("expected an error for a failing command")
+	}
+	if result == nil || result.ExitCode != 3 || result.Stdout != "after_upload /a.txt\n" {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	r.AllowedCommands = []string{"true"}
+	if _, err := r.TestCommand(context.Background(), "sh -c true", Job{Path: "/a.txt"}, testUser()); !errors.Is(err, ErrCommandNotAllowed) {
+		t.Errorf("expected ErrCommandNotAllowed, got %v", err)
+	}
+}
+
+func TestExecMaxOutputBytes(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("sh is not available on windows")
+	}
+
+	r := &Runner{Settings: &settings.Settings{}, CaptureOutput: true, MaxOutputBytes: 4}
+
+	result, err := r.exec(context.Background(), `sh -c 'printf abcdef'`, newHookEvent("before_upload", "/file", "", testUser()))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := "abcd" + truncatedMarker; result.Stdout != want {
+		t.Errorf("stdout = %q, want %q", result.Stdout, want)
+	}
+
+	start := time.Now()
+	_, err = r.exec(context.Background(), "yes", newHookEvent("before_upload", "/file", "", testUser()))
+	if err == nil || !strings.Contains(err.Error(), "output exceeded 4 bytes") {
+		t.Errorf("expected the command to be killed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("command wasn't killed, took %s", elapsed)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("sleep is not available on windows")
+	}
+
+	r := &Runner{Settings: &settings.Settings{}, background: newBackgroundHooks(0)}
+
+	if _, err := r.exec(context.Background(), "sleep 5 &", newHookEvent("after_upload", "/file", "", testUser())); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	jobs := r.BackgroundJobs()
+	if len(jobs) != 1 || jobs[0].Command != "sleep 5" || jobs[0].ID == "" {
+		t.Fatalf("unexpected background jobs %+v", jobs)
+	}
+
+	if err := r.Cancel(jobs[0].ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := r.Shutdown(ctx); err != nil {
+		t.Errorf("expected the canceled command to exit, got %v", err)
+	}
+	if jobs := r.BackgroundJobs(); len(jobs) != 0 {
+		t.Errorf("expected no background jobs, got %+v", jobs)
+	}
+
+	if err := r.Cancel(jobs[0].ID); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestPartitionOf(t *testing.T) {
+	seen := map[int]bool{}
+	for _, key := range []string{"/a.txt", "/b.txt", "/c.txt", "/d.txt", "/e.txt", "/f.txt"} {
+		p := partitionOf(key, 4)
+		if p < 0 || p >= 4 {
+			t.Fatalf("partition %d of %q out of range", p, key)
+		}
+		if partitionOf(key, 4) != p {
+			t.Errorf("expected the partition of %q to be stable", key)
+		}
+		seen[p] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("expected the keys to be spread across partitions, got %v", seen)
+	}
+
+	if got := PartitionQueueName("fbq", 3); got != "fbq:3" {
+		t.Errorf("PartitionQueueName() = %q, want %q", got, "fbq:3")
+	}
+}
+
+func TestRunHookMetadata(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("sh is not available on windows")
+	}
+
+	tests := map[string]struct {
+		events  []string
+		command string
+		want    string
+		wantErr error
+	}{
+		"renamed": {
+			events:  []string{"before_upload"},
+			command: `sh -c 'echo working; echo "{\"name\":\"renamed.txt\"}"'`,
+			want:    "/dir/renamed.txt",
+		},
+		"not opted in": {
+			command: `sh -c 'echo "{\"name\":\"renamed.txt\"}"'`,
+			want:    "/dir/file.txt",
+		},
+		"no metadata": {
+			events:  []string{"before_upload"},
+			command: "echo {}",
+			want:    "/dir/file.txt",
+		},
+		"outside of the directory": {
+			events:  []string{"before_upload"},
+			command: `sh -c 'echo "{\"name\":\"../file.txt\"}"'`,
+			wantErr: ErrPathNotAllowed,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			queue := &MemoryQueue{}
+			r := &Runner{
+				Enabled:       true,
+				CaptureOutput: true,
+				Queue:         queue,
+				Settings: &settings.Settings{
+					MetadataEvents: tt.events,
+					Commands: hookCommands(map[string][]string{
+						"before_upload": {tt.command},
+						"after_upload":  {"echo $FILE"},
+					}),
+				},
+			}
+
+			var got string
+			err := r.RunHookPath(context.Background(), func(p string) error {
+				got = p
+				return nil
+			}, "upload", "/dir/file.txt", "", testUser())
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("path = %q, want %q", got, tt.want)
+			}
+			if jobs := queue.Take(); len(jobs) != 1 || jobs[0].Path != tt.want {
+				t.Errorf("expected the after hook to get %q, got %+v", tt.want, jobs)
+			}
+		})
+	}
+}
+
+func TestExecEnvFile(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("sh is not available on windows")
+	}
+
+	dir := t.TempDir()
+	content := "# scanner credentials\nAPI_KEY=\"hunter2\"\nexport REGION=eu\n\nFILE=/spoofed\n"
+	if err := os.WriteFile(filepath.Join(dir, "secrets.env"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Runner{
+		CaptureOutput: true,
+		Settings:      &settings.Settings{EnvDir: dir},
+	}
+	evt := newHookEvent("before_upload", "/file", "", testUser())
+
+	result, err := r.exec(context.Background(), `sh -c 'echo "$API_KEY $REGION $FILE"' --env secrets.env`, evt)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := "hunter2 eu /file\n"; result.Stdout != want {
+		t.Errorf("got %q, want %q", result.Stdout, want)
+	}
+	if _, ok := os.LookupEnv("API_KEY"); ok {
+		t.Error("expected the env file to stay out of the server environment")
+	}
+
+	for _, name := range []string{"missing.env", "../secrets.env"} {
+		if _, err := r.exec(context.Background(), "true --env "+name, evt); err == nil {
+			t.Errorf("expected an error for the env file %q", name)
+		}
+	}
+
+	// without an env directory, the option is given to the command
+	r.Settings = &settings.Settings{}
+	result, err = r.exec(context.Background(), "echo --env secrets.env", evt)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := "--env secrets.env\n"; result.Stdout != want {
+		t.Errorf("got %q, want %q", result.Stdout, want)
+	}
+}
+
+func TestRedisOptions(t *testing.T) {
+	opts, err := RedisOptions(settings.Redis{Password: "secret", DB: 2, PoolSize: 5})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if opts.Addr != settings.DefaultRedisAddress || opts.Password != "secret" || opts.DB != 2 || opts.PoolSize != 5 {
+		t.Errorf("unexpected options %+v", opts)
+	}
+	if opts.TLSConfig != nil {
+		t.Error("expected no TLS by default")
+	}
+
+	opts, err = RedisOptions(settings.Redis{Address: "redis.example.com:6380", TLS: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if opts.Addr != "redis.example.com:6380" || opts.TLSConfig == nil || opts.TLSConfig.RootCAs != nil {
+		t.Errorf("expected TLS with the system CAs, got %+v", opts)
+	}
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []settings.Redis{
+		{TLS: true, CA: ca},
+		{TLS: true, CA: filepath.Join(t.TempDir(), "missing.pem")},
+		{TLS: true, Cert: ca, Key: ca},
+		{CA: ca},
+	} {
+		if _, err := RedisOptions(s); err == nil {
+			t.Errorf("expected an error for %+v", s)
+		}
+	}
+}
+
+func TestFileAuditSink(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("true is not a binary on windows")
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	evt := newHookEvent("before_upload", "/file", "", testUser())
+
+	for _, command := range []string{"true", "false"} {
+		// a new sink continues the chain of the file
+		r := &Runner{Settings: &settings.Settings{}, Audit: &FileAuditSink{Path: path}}
+		_, _ = r.exec(context.Background(), command, evt)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyAuditLog(bytes.NewReader(data)); err != nil {
+		t.Fatalf("expected a valid audit log, got %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(lines))
+	}
+
+	var rec AuditRecord
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Command != "false" || rec.Event != "before_upload" || rec.UserName != "user" || rec.ExitCode != 1 || !rec.Blocking {
+		t.Errorf("unexpected record %+v", rec)
+	}
+
+	tampered := strings.Replace(string(data), `"exit_code":1`, `"exit_code":0`, 1)
+	if err := VerifyAuditLog(strings.NewReader(tampered)); err == nil {
+		t.Error("expected a modified record to be detected")
+	}
+	if err := VerifyAuditLog(strings.NewReader(lines[1])); err == nil {
+		t.Error("expected a removed record to be detected")
+	}
+}
+
+type recordingListener struct {
+	events []string
+}
+
+func (l *recordingListener) OperationDone(event, path, dst string, _ *users.User) {
+	l.events = append(l.events, event+" "+path+" "+dst)
+}
+
+func TestRunHookListeners(t *testing.T) {
+	listener := &recordingListener{}
+	r := &Runner{Settings: &settings.Settings{}, Listeners: []Listener{listener}}
+
+	_ = r.RunHook(context.Background(), func() error { return nil }, "copy", "/a", "/b", testUser())
+	_ = r.RunHook(context.Background(), func() error { return errors.New("failed") }, "delete", "/a", "", testUser())
+
+	// the listeners are told about the operations without the commands
+	want := []string{"after_copy /a /b"}
+	if !reflect.DeepEqual(listener.events, want) {
+		t.Errorf("got %v, want %v", listener.events, want)
+	}
+}
+
+func TestRunHookReadOnly(t *testing.T) {
+	r := &Runner{Enabled: true, Settings: &settings.Settings{
+		ReadOnly: true,
+		Commands: hookCommands(map[string][]string{"before_upload": {"false"}}),
+	}}
+
+	ran := false
+	fn := func() error {
+		ran = true
+		return nil
+	}
+	if err := r.RunHook(context.Background(), fn, "upload", "/file", "", testUser()); !errors.Is(err, ErrReadOnly) || ran {
+		t.Errorf("expected the upload to be refused without running, got %v", err)
+	}
+	if err := r.RunHook(context.Background(), fn, "download", "/file", "", testUser()); err != nil || !ran {
+		t.Errorf("expected the download to run, got %v", err)
+	}
+}
+
+func TestDirCommands(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("echo is not available on windows")
+	}
+
+	scope, outside := t.TempDir(), t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(scope, DirHooksFile), `{"after_upload": ["echo root $FILE"]}`)
+	write(filepath.Join(scope, "project", DirHooksFile), `{"after_*": ["echo build $FILE", "cat $FILE"], "before_upload": [{"match": "*.go", "command": "echo vet $FILE"}]}`)
+	write(filepath.Join(scope, "broken", DirHooksFile), `{"after_upload": "build"`)
+	write(filepath.Join(outside, DirHooksFile), `{"after_upload": ["echo escaped"]}`)
+	if err := os.Symlink(outside, filepath.Join(scope, "link")); err != nil {
+		t.Skipf("can't create symbolic links: %v", err)
+	}
+
+	r := &Runner{Settings: &settings.Settings{
+		DirHooks:        true,
+		Commands:        hookCommands(map[string][]string{"after_upload": {"index $FILE"}}),
+		AllowedCommands: []string{"echo", "cat"},
+	}}
+	// cat is allowed by the settings, but isn't a command of the user
+	user := &users.User{
+		Username: "user",
+		Perm:     users.Permissions{Execute: true},
+		Commands: []string{"echo"},
+		Fs:       afero.NewBasePathFs(afero.NewOsFs(), scope),
+	}
+
+	tests := []struct {
+		event string
+		path  string
+		want  []string
+	}{
+		{"after_upload", "/project/src/main.go", []string{"index $FILE", "echo build $FILE"}},
+		{"before_upload", "/project/main.go", []string{"echo vet $FILE"}},
+		{"before_upload", "/project/main.js", nil},
+		{"after_upload", "/docs/a.txt", []string{"index $FILE", "echo root $FILE"}},
+		// the nearest file is the one of the scope, not the linked one
+		{"after_upload", "/link/a.txt", []string{"index $FILE", "echo root $FILE"}},
+	}
+	for _, tt := range tests {
+		commands, err := r.hookCommands(tt.event, tt.path, user)
+		if err != nil {
+			t.Fatalf("hookCommands(%q, %q): %v", tt.event, tt.path, err)
+		}
+		if got := newHookEvent(tt.event, tt.path, "", user).runFor(commands); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("hookCommands(%q, %q) = %q, want %q", tt.event, tt.path, got, tt.want)
+		}
+	}
+
+	if _, err := r.hookCommands("before_upload", "/broken/a.txt", user); !errors.Is(err, ErrParseCommand) {
+		t.Errorf("expected an invalid hooks file to be an invalid command, got %v", err)
+	}
+	// the operation of the after hooks is done, the file is skipped
+	if commands, err := r.hookCommands("after_upload", "/broken/a.txt", user); err != nil || len(commands) != 1 {
+		t.Errorf("expected the invalid hooks file to be skipped, got %v and %v", commands, err)
+	}
+
+	// through a shell, the commands of the files can't chain others
+	write(filepath.Join(scope, "chained", DirHooksFile), `{"after_upload": ["echo \"$FILE\"", "echo a; rm -rf /", "echo $(id)"]}`)
+	r.UseShell = true
+	commands, err := r.hookCommands("after_upload", "/chained/a.txt", user)
+	if got := newHookEvent("after_upload", "/chained/a.txt", "", user).runFor(commands); err != nil || !reflect.DeepEqual(got, []string{"index $FILE", `echo "$FILE"`}) {
+		t.Errorf("expected the chained commands to be dropped, got %q and %v", got, err)
+	}
+	r.UseShell = false
+
+	// without the allowed commands of the settings, none is run
+	r.AllowedCommands = nil
+	if commands, err := r.hookCommands("after_upload", "/project/a.txt", user); err != nil || len(commands) != 1 {
+		t.Errorf("expected only the global commands without allowed commands, got %v and %v", commands, err)
+	}
+	r.AllowedCommands = []string{"echo", "cat"}
+
+	// the users who can't execute commands don't run the ones of the files
+	user.Perm.Execute = false
+	commands, err = r.hookCommands("after_upload", "/project/a.txt", user)
+	if err != nil || len(commands) != 1 {
+		t.Errorf("expected only the global commands, got %v and %v", commands, err)
+	}
+}
+
+func TestTransformListing(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("sh is not available on windows")
+	}
+
+	dir := t.TempDir()
+	input, count := filepath.Join(dir, "input"), filepath.Join(dir, "count")
+	hook := fmt.Sprintf(`sh -c 'cat > %s; echo x >> %s; echo "{\"hide\":[\"b.tmp\"],\"annotations\":{\"a.txt\":{\"scanned\":\"clean\"}}}"'`, input, count)
+
+	r := New(&settings.Server{EnableExec: true})
+	r.Settings = &settings.Settings{Commands: map[string][]settings.HookCommand{
+		ListingEvent: {{Command: hook, Match: "docs"}},
+		// the patterns only match the operations
+		"before_*": {{Command: "false"}},
+	}}
+	user := testUser()
+	entries := []ListingEntry{{Name: "a.txt", Size: 1}, {Name: "b.tmp", Size: 2}, {Name: "sub", IsDir: true}}
+
+	got, err := r.TransformListing(context.Background(), "/docs", user, entries)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := []ListingEntry{{Name: "a.txt", Size: 1, Annotations: map[string]string{"scanned": "clean"}}, {Name: "sub", IsDir: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	raw, err := os.ReadFile(input)
+	if err != nil || !strings.Contains(string(raw), `"path":"/docs"`) || !strings.Contains(string(raw), `"name":"b.tmp"`) {
+		t.Errorf("expected the hook to get the listing, got %q and %v", raw, err)
+	}
+
+	// the listing is cached until it changes
+	if _, err := r.TransformListing(context.Background(), "/docs", user, entries); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := os.ReadFile(count); strings.Count(string(raw), "x") != 1 {
+		t.Errorf("expected the hook to run once, got %q", raw)
+	}
+	if _, err := r.TransformListing(context.Background(), "/docs", user, entries[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := os.ReadFile(count); strings.Count(string(raw), "x") != 2 {
+		t.Errorf("expected the hook to run again, got %q", raw)
+	}
+
+	// the directories without a listing hook are left alone
+	got, err = r.TransformListing(context.Background(), "/other", user, entries)
+	if err != nil || !reflect.DeepEqual(got, entries) {
+		t.Errorf("expected the listing to be left alone, got %+v and %v", got, err)
+	}
+}
@@ -0,0 +1,95 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// QueueBackend is the kind of redis structure the after hooks are queued in.
+type QueueBackend string
+
+const (
+	// QueueBackendList pushes the jobs to a list with LPUSH. Workers pop
+	// them and nothing tracks the jobs being processed.
+	QueueBackendList QueueBackend = "list"
+	// QueueBackendStream adds the jobs to a stream with XADD. Workers read
+	// them in a consumer group and acknowledge them once done, so a job
+	// stays pending until then.
+	QueueBackendStream QueueBackend = "stream"
+)
+
+// streamJobField is the field of the stream entries holding the job.
+const streamJobField = "job"
+
+// ParseQueueBackend returns the queue backend with the given name. An empty
+// name means the list backend.
+func ParseQueueBackend(name string) (QueueBackend, error) {
+	switch backend := QueueBackend(name); backend {
+	case "", QueueBackendList:
+		return QueueBackendList, nil
+	case QueueBackendStream:
+		return backend, nil
+	default:
+		return "", fmt.Errorf("invalid queue backend %q, must be %q or %q", name, QueueBackendList, QueueBackendStream)
+	}
+}
+
+// push adds an encoded job to the redis queue using the configured backend.
+func (r *Runner) push(ctx context.Context, job []byte) error {
+	var key string
+	if decoded, err := UnmarshalJob(job); err == nil {
+		key = decoded.PartitionKey
+	}
+	return r.redisQueue().push(ctx, r.RedisClient, key, job)
+}
+
+// StreamJob is a job read from the stream backend.
+type StreamJob struct {
+	ID  string
+	Job []byte
+}
+
+// ReadStreamJobs reads up to count new jobs for a consumer of the group,
+// creating the group if needed. It waits up to block for jobs to arrive and
+// returns no jobs if none did. The jobs must be acknowledged with
+// AckStreamJob once processed, otherwise they stay pending.
+func (r *Runner) ReadStreamJobs(ctx context.Context, group, consumer string, count int64, block time.Duration) ([]StreamJob, error) {
+	err := r.RedisClient.XGroupCreateMkStream(ctx, r.queueName(), group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, fmt.Errorf("failed to create consumer group: %w", err)
+	}
+
+	streams, err := r.RedisClient.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{r.queueName(), ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []StreamJob
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			job, _ := msg.Values[streamJobField].(string)
+			jobs = append(jobs, StreamJob{ID: msg.ID, Job: []byte(job)})
+		}
+	}
+
+	return jobs, nil
+}
+
+// AckStreamJob marks a job read with ReadStreamJobs as processed.
+func (r *Runner) AckStreamJob(ctx context.Context, group, id string) error {
+	return r.RedisClient.XAck(ctx, r.queueName(), group, id).Err()
+}
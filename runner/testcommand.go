@@ -0,0 +1,41 @@
+package runner
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// DefaultTestCommandTimeout limits the commands run by TestCommand when the
+// runner has no CommandTimeout.
+const DefaultTestCommandTimeout = 30 * time.Second
+
+// TestCommand runs a hook command for a sample event, without any file
+// operation, and returns its output. The paths of the sample are relative
+// to the user scope, as in RunHook, and the command is expanded and checked
+// as it would be for a real event. It always runs blocking and with a
+// timeout, and it ignores the rate limits.
+func (r *Runner) TestCommand(ctx context.Context, raw string, sample Job, user *users.User) (*ExecResult, error) {
+	t := *r
+	t.CaptureOutput = true
+	if t.CommandTimeout <= 0 {
+		t.CommandTimeout = DefaultTestCommandTimeout
+	}
+
+	raw = strings.TrimSuffix(strings.TrimSpace(raw), "&")
+
+	evt := newHookEvent(sample.Event, sample.Path, sample.Destination, user)
+	evt.requestID = sample.RequestID
+	if evt.requestID == "" {
+		evt.requestID = requestID(ctx)
+	}
+
+	result, err := t.exec(ctx, raw, evt)
+	if result == nil && err == nil {
+		// dry run
+		result = &ExecResult{}
+	}
+	return result, err
+}
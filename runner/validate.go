@@ -0,0 +1,193 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// identifierPattern matches the names of the variables a placeholder can
+// refer to, leaving out the shell special parameters such as $1 or $?.
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+// Validate checks the commands of the settings: that their keys are known
+// events or patterns matching some, that their match patterns are valid,
+// that they aren't empty, that they parse and their scripts exist, and
+// that their placeholders and templates are defined. The command templates
+// are checked too, and the commands referencing them once their parameters
+// are filled. It returns an error for each problem found, nil if there are
+// none.
+//
+// The executables and scripts aren't checked when the commands run on an
+// Executor, as they are looked up there.
+func (r *Runner) Validate() []error {
+	if r.Settings == nil {
+		return nil
+	}
+
+	keys := make([]string, 0, len(r.Commands))
+	for key := range r.Commands {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	errs := r.validateTemplates()
+	for _, key := range keys {
+		if err := validateEventKey(key); err != nil {
+			errs = append(errs, err)
+		}
+
+		for _, command := range r.Commands[key] {
+			if err := validateMatch(command.Match); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			}
+			raw, err := r.ResolveCommand(command)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				continue
+			}
+			if err := r.validateCommand(raw); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			}
+		}
+	}
+
+	return errs
+}
+
+// validateTemplates checks that the parameters of the command templates
+// have valid names, and don't hide the templates of the events such as
+// {{year}}.
+func (r *Runner) validateTemplates() []error {
+	names := make([]string, 0, len(r.CommandTemplates))
+	for name := range r.CommandTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	builtin, _ := (&hookEvent{user: &users.User{}}).templates()
+
+	var errs []error
+	for _, name := range names {
+		template := r.CommandTemplates[name]
+		if strings.TrimSpace(template.Command) == "" {
+			errs = append(errs, fmt.Errorf("template %s: empty command", name))
+		}
+
+		var seen []string
+		for _, param := range template.Params {
+			switch _, hidden := builtin[param.Name]; {
+			case !paramPattern.MatchString(param.Name):
+				errs = append(errs, fmt.Errorf("template %s: invalid parameter name %q", name, param.Name))
+			case hidden:
+				errs = append(errs, fmt.Errorf("template %s: parameter %s hides the {{%s}} template", name, param.Name, param.Name))
+			case slices.Contains(seen, param.Name):
+				errs = append(errs, fmt.Errorf("template %s: duplicate parameter %s", name, param.Name))
+			}
+			seen = append(seen, param.Name)
+		}
+	}
+	return errs
+}
+
+// paramPattern matches the names of the parameters of the templates.
+var paramPattern = regexp.MustCompile(`^\w+$`)
+
+// hookEventNames returns the names of all the events the hooks can run for.
+func hookEventNames() []string {
+	names := make([]string, 0, 3*len(settings.HookEvents)) //nolint:gomnd
+	for _, event := range settings.HookEvents {
+		names = append(names, "before_"+event, "after_"+event, "finally_"+event)
+	}
+	return names
+}
+
+func validateEventKey(key string) error {
+	if key == ListingEvent {
+		return nil
+	}
+	names := hookEventNames()
+
+	if !isEventPattern(key) {
+		if !slices.Contains(names, key) {
+			return fmt.Errorf("unknown event %q", key)
+		}
+		return nil
+	}
+
+	for _, alt := range strings.Split(key, "|") {
+		alt = strings.TrimSpace(alt)
+		if _, err := path.Match(alt, ""); err != nil {
+			return fmt.Errorf("invalid event pattern %q: %w", alt, err)
+		}
+
+		if !slices.ContainsFunc(names, func(name string) bool { return matchEvent(alt, name) }) {
+			return fmt.Errorf("event pattern %q matches no event", alt)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) validateCommand(raw string) error {
+	raw = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(raw), "&"))
+	if raw == "" {
+		return errors.New("empty command")
+	}
+
+	raw, envFile := r.splitEnvFile(raw)
+	if r.Executor == nil {
+		if _, err := r.loadEnvFile(envFile); err != nil {
+			return fmt.Errorf("%q: %w", raw, err)
+		}
+		if _, err := ParseCommand(r.Settings, raw); err != nil {
+			return fmt.Errorf("%q: %w", raw, err)
+		}
+	}
+
+	// the variables and templates of an event, whatever its file
+	evt := &hookEvent{name: "after_", user: &users.User{}}
+	vars := evt.vars()
+	templates, _ := evt.templates()
+
+	// a shell also expands the variables of its environment
+	sh := len(shell(r.Settings)) > 0
+	defined := func(name string) bool {
+		if _, ok := vars[name]; ok || !identifierPattern.MatchString(name) {
+			return true
+		}
+		if !sh {
+			return false
+		}
+		if _, ok := r.ExtraEnv[name]; ok || envFile != "" {
+			return true
+		}
+		_, ok := os.LookupEnv(name)
+		return ok && r.GetInheritEnv()
+	}
+
+	var undefined []string
+	os.Expand(raw, func(name string) string {
+		if !defined(name) && !slices.Contains(undefined, "$"+name) {
+			undefined = append(undefined, "$"+name)
+		}
+		return ""
+	})
+	for _, match := range templatePattern.FindAllStringSubmatch(raw, -1) {
+		if _, ok := templates[match[1]]; !ok && !slices.Contains(undefined, match[0]) {
+			undefined = append(undefined, match[0])
+		}
+	}
+
+	if len(undefined) > 0 {
+		return fmt.Errorf("%q: undefined placeholders %s", raw, strings.Join(undefined, ", "))
+	}
+	return nil
+}
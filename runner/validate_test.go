@@ -0,0 +1,118 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+)
+
+func TestValidate(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("echo is not a binary on windows")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "scan.sh"), []byte("#!/bin/sh\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Runner{
+		Settings: &settings.Settings{
+			ScriptsDir: dir,
+			Commands: hookCommands(map[string][]string{
+				"before_upload":           {"@scan.sh $FILE", "echo {{year}} $USERNAME &"},
+				"after_*":                 {"echo $FILE_SHA256"},
+				"after_copy|after_move":   {"echo $DESTINATION"},
+				"before_uplaod":           {"echo $FILE"},
+				"before_login|after_copy": {},
+				"after_delete":            {" ", "@missing.sh", "echo $FIEL {{yaer}} $1"},
+			}),
+		},
+	}
+
+	var got []string
+	for _, err := range r.Validate() {
+		got = append(got, err.Error())
+	}
+
+	want := []string{
+		`after_delete: empty command`,
+		`after_delete: "@missing.sh": invalid hook command: script "missing.sh" not found in ` + dir,
+		`after_delete: "echo $FIEL {{yaer}} $1": undefined placeholders $FIEL, {{yaer}}`,
+		`event pattern "before_login" matches no event`,
+		`unknown event "before_uplaod"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestValidateShell(t *testing.T) {
+	t.Setenv("FILEBROWSER_TEST_VAR", "1")
+
+	r := &Runner{
+		Settings: &settings.Settings{
+			UseShell: true,
+			ExtraEnv: map[string]string{"TOKEN": "secret"},
+			Commands: hookCommands(map[string][]string{
+				"after_upload": {`echo "$FILE" "$TOKEN" "$FILEBROWSER_TEST_VAR" "$UNDEFINED_VAR"`},
+			}),
+		},
+	}
+
+	errs := r.Validate()
+	if len(errs) != 1 || !strings.HasSuffix(errs[0].Error(), "undefined placeholders $UNDEFINED_VAR") {
+		t.Errorf("expected only $UNDEFINED_VAR to be undefined, got %v", errs)
+	}
+}
+
+func TestValidateTemplates(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("echo is not a binary on windows")
+	}
+
+	r := &Runner{
+		Settings: &settings.Settings{
+			CommandTemplates: map[string]settings.CommandTemplate{
+				"copy": {Command: "echo {{from}} {{to}}", Params: []settings.TemplateParam{
+					{Name: "from", Default: "$FILE"}, {Name: "to", Required: true},
+				}},
+				"bad": {Command: " ", Params: []settings.TemplateParam{
+					{Name: "year"}, {Name: "a-b"}, {Name: "x"}, {Name: "x"},
+				}},
+			},
+			Commands: map[string][]settings.HookCommand{
+				"after_upload": {
+					{Template: "copy", Params: map[string]string{"to": "$DESTINATION"}},
+					{Template: "copy", Params: map[string]string{"to": "$FIEL"}},
+					{Template: "copy"},
+					{Template: "copy", Params: map[string]string{"to": "b", "size": "1"}},
+					{Template: "missing"},
+				},
+			},
+		},
+	}
+
+	var got []string
+	for _, err := range r.Validate() {
+		got = append(got, err.Error())
+	}
+
+	want := []string{
+		`template bad: empty command`,
+		`template bad: parameter year hides the {{year}} template`,
+		`template bad: invalid parameter name "a-b"`,
+		`template bad: duplicate parameter x`,
+		`after_upload: "echo $FILE $FIEL": undefined placeholders $FIEL`,
+		`after_upload: invalid command template: copy requires the to parameter`,
+		`after_upload: invalid command template: copy has no size parameter`,
+		`after_upload: invalid command template: unknown template "missing"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
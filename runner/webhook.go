@@ -0,0 +1,197 @@
+package runner
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// The headers of the webhook deliveries.
+const (
+	// WebhookSignatureHeader is "sha256=" and the hex encoded HMAC-SHA256,
+	// keyed with the secret, of the timestamp, a dot and the body.
+	WebhookSignatureHeader = "X-FileBrowser-Signature"
+	// WebhookTimestampHeader is the Unix time the delivery was signed at,
+	// for the receivers to refuse the replayed ones.
+	WebhookTimestampHeader = "X-FileBrowser-Timestamp"
+	// WebhookDeliveryHeader is the ID of the delivery, the same for all of
+	// its attempts.
+	WebhookDeliveryHeader = "X-FileBrowser-Delivery"
+)
+
+// webhookQueueSize is how many deliveries wait to be sent before the new
+// ones are dropped.
+const webhookQueueSize = 1000
+
+// webhookTimeout is how long an attempt to deliver a webhook can take.
+const webhookTimeout = 10 * time.Second
+
+// WebhookPayload is the JSON body of a webhook, the job the after hooks
+// of the operation would get, without a command. Its event is the one of
+// the after hooks, such as after_upload.
+type WebhookPayload struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Job
+}
+
+// WebhookSink posts the operations that succeeded to a URL, as signed
+// WebhookPayloads. It is a Listener: the deliveries are queued and sent in
+// order in the background, being retried with a backoff doubling each time
+// on the network errors and on the 408, 429 and 5xx statuses.
+type WebhookSink struct {
+	URL    string
+	Secret []byte
+	// Events are the names of the operations posted, such as upload, all
+	// of them if empty.
+	Events  []string
+	Retries int
+	Backoff time.Duration
+	Client  *http.Client
+
+	queue chan WebhookPayload
+}
+
+// NewWebhookSink returns the sink of the webhook of the server settings,
+// nil if it has none, and starts sending its deliveries.
+func NewWebhookSink(server *settings.Server) *WebhookSink {
+	if server.WebhookURL == "" {
+		return nil
+	}
+
+	s := &WebhookSink{
+		URL:     server.WebhookURL,
+		Secret:  []byte(server.WebhookSecret),
+		Retries: server.GetWebhookRetries(),
+		Backoff: server.GetWebhookBackoff(),
+		Client:  &http.Client{Timeout: webhookTimeout},
+		queue:   make(chan WebhookPayload, webhookQueueSize),
+	}
+	for _, event := range strings.FieldsFunc(server.WebhookEvents, func(r rune) bool { return r == ',' || r == ' ' }) {
+		s.Events = append(s.Events, strings.TrimPrefix(event, "after_"))
+	}
+	go s.run()
+	return s
+}
+
+// OperationDone implements Listener.
+func (s *WebhookSink) OperationDone(event, path, dst string, user *users.User) {
+	if !s.matches(strings.TrimPrefix(event, "after_")) {
+		return
+	}
+
+	id := make([]byte, 16) //nolint:gomnd
+	if _, err := rand.Read(id); err != nil {
+		log.Printf("[WARN] Failed to create the webhook delivery of %s %s: %v", event, path, err)
+		return
+	}
+	payload := WebhookPayload{
+		ID:   hex.EncodeToString(id),
+		Time: time.Now().UTC(),
+		Job: Job{
+			Event:       event,
+			Path:        path,
+			Destination: dst,
+			UserName:    user.Username,
+			UserScope:   user.Scope,
+		},
+	}
+
+	select {
+	case s.queue <- payload:
+	default:
+		log.Printf("[WARN] The webhook queue is full, dropping the delivery of %s %s", event, path)
+	}
+}
+
+func (s *WebhookSink) matches(event string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *WebhookSink) run() {
+	for payload := range s.queue {
+		if err := s.deliver(payload); err != nil {
+			log.Printf("[WARN] Failed to deliver the webhook %s of %s %s: %v", payload.ID, payload.Event, payload.Path, err)
+		}
+	}
+}
+
+// deliver posts a payload until it's accepted, or refused for good, or the
+// retries are exhausted.
+func (s *WebhookSink) deliver(payload WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	backoff := s.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(payload.ID, body)
+		if err == nil || !retry || attempt >= s.Retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post makes an attempt to deliver a body, telling if it can be retried
+// when it fails.
+func (s *WebhookSink) post(id string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookDeliveryHeader, id)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	if len(s.Secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(s.Secret, timestamp, body))
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	res.Body.Close()
+
+	switch {
+	case res.StatusCode >= http.StatusOK && res.StatusCode < http.StatusMultipleChoices:
+		return false, nil
+	case res.StatusCode == http.StatusRequestTimeout, res.StatusCode == http.StatusTooManyRequests,
+		res.StatusCode >= http.StatusInternalServerError:
+		return true, fmt.Errorf("status %d", res.StatusCode)
+	default:
+		return false, fmt.Errorf("status %d", res.StatusCode)
+	}
+}
+
+// SignWebhook returns the hex encoded signature of a webhook body, see
+// WebhookSignatureHeader.
+func SignWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
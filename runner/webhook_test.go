@@ -0,0 +1,87 @@
+package runner
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/filebrowser/filebrowser/v2/settings"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestWebhookSink(t *testing.T) {
+	var attempts int32
+	deliveries := make(chan WebhookPayload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get(WebhookTimestampHeader)
+		if r.Header.Get(WebhookSignatureHeader) != "sha256="+SignWebhook([]byte("secret"), timestamp, body) {
+			t.Errorf("expected a valid signature, got %q", r.Header.Get(WebhookSignatureHeader))
+		}
+
+		// the first attempt fails, to be retried
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil || r.Header.Get(WebhookDeliveryHeader) != payload.ID {
+			t.Errorf("expected the payload of the delivery, got %v", err)
+		}
+		deliveries <- payload
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(&settings.Server{
+		WebhookURL:     server.URL,
+		WebhookSecret:  "secret",
+		WebhookEvents:  "upload, after_rename",
+		WebhookBackoff: "10ms",
+	})
+	user := &users.User{Username: "alice", Scope: "/alice"}
+	sink.OperationDone("after_download", "/a.txt", "", user)
+	sink.OperationDone("after_upload", "/a.txt", "", user)
+	sink.OperationDone("after_rename", "/a.txt", "/b.txt", user)
+
+	for _, want := range []Job{
+		{Event: "after_upload", Path: "/a.txt", UserName: "alice", UserScope: "/alice"},
+		{Event: "after_rename", Path: "/a.txt", Destination: "/b.txt", UserName: "alice", UserScope: "/alice"},
+	} {
+		select {
+		case payload := <-deliveries:
+			if payload.Job != want || payload.ID == "" {
+				t.Errorf("expected the delivery of %+v, got %+v", want, payload)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected the delivery of %+v", want)
+		}
+	}
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+}
+
+func TestWebhookSinkRefused(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sink := &WebhookSink{URL: server.URL, Retries: 3, Backoff: time.Millisecond, Client: server.Client()}
+	if err := sink.deliver(WebhookPayload{ID: "id"}); err == nil {
+		t.Error("expected the refused delivery to fail")
+	}
+	if got := atomic.LoadInt32(&attempts); got != 1 {
+		t.Errorf("expected the refused delivery not to be retried, got %d attempts", got)
+	}
+
+	if NewWebhookSink(&settings.Server{}) != nil {
+		t.Error("expected no sink without a URL")
+	}
+}
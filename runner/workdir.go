@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// WorkingDir tells in which directory the commands run. It is set in the
+// settings, e.g. "scope".
+type WorkingDir string
+
+const (
+	// WorkingDirServer runs the commands in the working directory of the
+	// server. This is the default.
+	WorkingDirServer WorkingDir = "server"
+	// WorkingDirScope runs the commands in the scope of the user.
+	WorkingDirScope WorkingDir = "scope"
+	// WorkingDirFile runs the commands in the directory of the file, or in
+	// the file itself if it is a directory.
+	WorkingDirFile WorkingDir = "file"
+)
+
+// ParseWorkingDir parses the working directory of the settings, which
+// defaults to WorkingDirServer.
+func ParseWorkingDir(s string) (WorkingDir, error) {
+	switch dir := WorkingDir(s); dir {
+	case "":
+		return WorkingDirServer, nil
+	case WorkingDirServer, WorkingDirScope, WorkingDirFile:
+		return dir, nil
+	default:
+		return "", fmt.Errorf("unknown hook working directory %q", s)
+	}
+}
+
+// workingDir returns the directory a command of the event runs in, empty
+// for the one of the server. The directory must exist and be inside the
+// user scope.
+func (r *Runner) workingDir(evt *hookEvent) (string, error) {
+	mode := WorkingDirServer
+	if r.Settings != nil {
+		var err error
+		mode, err = ParseWorkingDir(r.HookWorkingDir)
+		if err != nil {
+			log.Printf("[WARN] %v, using %q", err, WorkingDirServer)
+			mode = WorkingDirServer
+		}
+	}
+
+	var dir string
+	switch mode {
+	case WorkingDirScope:
+		dir = evt.user.FullPath("/")
+	case WorkingDirFile:
+		dir = evt.path
+		if evt.file == nil || !evt.file.IsDir() {
+			dir = filepath.Dir(evt.path)
+		}
+	default:
+		return "", nil
+	}
+
+	if !InsideScope(evt.user, dir) {
+		return "", fmt.Errorf("%w: the working directory %s is outside of the user scope", ErrPathNotAllowed, dir)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("invalid working directory: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("invalid working directory: %s is not a directory", dir)
+	}
+
+	return dir, nil
+}
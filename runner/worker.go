@@ -0,0 +1,196 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultWorkerPollInterval is how long a worker waits for a job before
+// checking again if it must stop.
+const DefaultWorkerPollInterval = time.Second
+
+// DefaultWorkerGroup is the consumer group of the workers on the stream
+// backend.
+const DefaultWorkerGroup = "filebrowser"
+
+// Handler processes a job taken from the queue.
+type Handler func(job Job) error
+
+// Worker consumes the jobs queued by a runner. The jobs that can't be
+// decoded or whose handler fails are moved to the dead letter queue.
+type Worker struct {
+	// Runner is the runner the jobs are queued by. Its redis client, queue
+	// name and backend are used.
+	Runner  *Runner
+	Handler Handler
+	// Concurrency is the number of jobs processed at once, one if zero. It
+	// is ignored on a partitioned queue, where each partition is processed
+	// by its own goroutine.
+	Concurrency int
+	// Partitions are the partitions of the queue consumed by the worker,
+	// when the runner has Partitions. Empty means all of them. Each one is
+	// consumed by a single goroutine, so that its jobs are processed in
+	// order.
+	Partitions []int
+	// PollInterval is how long to wait for a job until checking if the
+	// worker must stop. DefaultWorkerPollInterval if zero.
+	PollInterval time.Duration
+	// Group and Consumer identify the worker on the stream backend. They
+	// default to DefaultWorkerGroup and the worker number.
+	Group    string
+	Consumer string
+}
+
+// Start processes the jobs until the context is done, and then waits for
+// the jobs being processed to finish.
+func (w *Worker) Start(ctx context.Context) error {
+	if w.Runner == nil || w.Runner.RedisClient == nil {
+		return errors.New("worker needs a runner with a redis client")
+	}
+	if w.Handler == nil {
+		return errors.New("worker needs a handler")
+	}
+
+	var wg sync.WaitGroup
+
+	if w.Runner.Partitions > 0 && w.Runner.QueueBackend != QueueBackendStream {
+		for _, partition := range w.partitions() {
+			wg.Add(1)
+			go func(queue string) {
+				defer wg.Done()
+				w.partitionLoop(ctx, queue)
+			}(PartitionQueueName(w.Runner.queueName(), partition))
+		}
+		wg.Wait()
+		return nil
+	}
+
+	concurrency := w.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w.loop(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (w *Worker) loop(ctx context.Context, i int) {
+	consumer := w.Consumer
+	if consumer == "" {
+		consumer = fmt.Sprintf("worker-%d", i)
+	}
+
+	for ctx.Err() == nil {
+		var err error
+		if w.Runner.QueueBackend == QueueBackendStream {
+			err = w.processStream(ctx, consumer)
+		} else {
+			err = w.processList(ctx, w.Runner.queueName())
+		}
+
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[WARN] Failed to read jobs: %v", err)
+			sleepContext(ctx, w.pollInterval())
+		}
+	}
+}
+
+func (w *Worker) partitions() []int {
+	if len(w.Partitions) > 0 {
+		return w.Partitions
+	}
+
+	all := make([]int, w.Runner.Partitions)
+	for i := range all {
+		all[i] = i
+	}
+	return all
+}
+
+// partitionLoop processes the jobs of a partition one after the other.
+func (w *Worker) partitionLoop(ctx context.Context, queue string) {
+	for ctx.Err() == nil {
+		if err := w.processList(ctx, queue); err != nil && ctx.Err() == nil {
+			log.Printf("[WARN] Failed to read jobs: %v", err)
+			sleepContext(ctx, w.pollInterval())
+		}
+	}
+}
+
+func (w *Worker) pollInterval() time.Duration {
+	if w.PollInterval <= 0 {
+		return DefaultWorkerPollInterval
+	}
+	return w.PollInterval
+}
+
+func (w *Worker) group() string {
+	if w.Group == "" {
+		return DefaultWorkerGroup
+	}
+	return w.Group
+}
+
+func (w *Worker) processList(ctx context.Context, queue string) error {
+	res, err := w.Runner.RedisClient.BRPop(ctx, w.pollInterval(), queue).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// the result is the name of the queue followed by the job
+	w.process([]byte(res[1]))
+	return nil
+}
+
+func (w *Worker) processStream(ctx context.Context, consumer string) error {
+	jobs, err := w.Runner.ReadStreamJobs(ctx, w.group(), consumer, 1, w.pollInterval())
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		w.process(job.Job)
+		if err := w.Runner.AckStreamJob(context.Background(), w.group(), job.ID); err != nil {
+			log.Printf("[WARN] Failed to acknowledge job %s: %v", job.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// process runs the handler of a job, moving it to the dead letter queue if
+// it fails.
+func (w *Worker) process(raw []byte) {
+	job, err := UnmarshalJob(raw)
+	if err != nil {
+		w.deadLetter(raw, err.Error())
+		return
+	}
+
+	if err := w.Handler(*job); err != nil {
+		w.deadLetter(raw, err.Error())
+	}
+}
+
+func (w *Worker) deadLetter(raw []byte, reason string) {
+	if err := w.Runner.MoveToDeadLetter(raw, reason); err != nil {
+		log.Printf("[WARN] Failed to process job and %v: %s", err, raw)
+	}
+}
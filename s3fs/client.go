@@ -0,0 +1,337 @@
+package s3fs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// unsignedPayload is the hash of the bodies that aren't signed, not to
+	// read the uploads twice.
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+)
+
+// Config is the bucket of a file system and how to reach it.
+type Config struct {
+	// Endpoint is the address of the S3 API, the one of AWS in the region
+	// if empty. The buckets are addressed in the path.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix is the key of the directory the file system is rooted at,
+	// the root of the bucket if empty.
+	Prefix       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// Client sends the requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+func (c *Config) endpoint() string {
+	if c.Endpoint != "" {
+		return strings.TrimSuffix(c.Endpoint, "/")
+	}
+	return "https://s3." + c.Region + ".amazonaws.com"
+}
+
+func (c *Config) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return http.DefaultClient
+}
+
+// newRequest returns a request for an object of the bucket, or for the
+// bucket itself if the key is empty.
+func (c *Config) newRequest(method, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	target := c.endpoint() + "/" + escapeKey(c.Bucket)
+	if key != "" {
+		target += "/" + escapeKey(key)
+	}
+	if len(query) > 0 {
+		target += "?" + canonicalQuery(query)
+	}
+
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	return req, nil
+}
+
+// do signs a request and sends it, returning the error of the responses
+// that aren't successful.
+func (c *Config) do(req *http.Request) (*http.Response, error) {
+	sign(req, c, time.Now())
+
+	res, err := c.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		return nil, os.ErrNotExist
+	case http.StatusForbidden:
+		return nil, os.ErrPermission
+	case http.StatusRequestedRangeNotSatisfiable:
+		return nil, io.EOF
+	}
+
+	var s3err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	_ = xml.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&s3err) //nolint:gomnd
+	return nil, fmt.Errorf("s3: %s %s: %d %s %s", req.Method, req.URL.Path, res.StatusCode, s3err.Code, s3err.Message)
+}
+
+// sign signs a request with the version 4 of the AWS signatures. The host,
+// the range and the x-amz- headers are signed, the hash of the payload
+// being the one of X-Amz-Content-Sha256.
+func sign(req *http.Request, c *Config, now time.Time) {
+	now = now.UTC()
+	date := now.Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", date)
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	scope := now.Format("20060102") + "/" + c.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + date + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapeKey encodes a key the way the signatures expect, every byte but
+// the unreserved ones and the slashes.
+func escapeKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c == '/' || isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func escapeQuery(s string) string {
+	return strings.ReplaceAll(escapeKey(s), "/", "%2F")
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '_' || c == '.' || c == '~'
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, escapeQuery(key)+"="+escapeQuery(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+type object struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+type listing struct {
+	Contents       []object `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// list calls fn with the pages of the objects whose key has a prefix, the
+// ones under a delimiter being grouped in common prefixes. It stops when
+// fn returns false.
+func (c *Config) list(prefix, delimiter string, max int, fn func(*listing) bool) error {
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+	if max > 0 {
+		query.Set("max-keys", fmt.Sprint(max))
+	}
+
+	for {
+		req, err := c.newRequest(http.MethodGet, "", query, nil)
+		if err != nil {
+			return err
+		}
+		res, err := c.do(req)
+		if err != nil {
+			return err
+		}
+
+		var page listing
+		err = xml.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if !fn(&page) || !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+// head returns the size and the modification time of an object.
+func (c *Config) head(key string) (int64, time.Time, error) {
+	req, err := c.newRequest(http.MethodHead, key, nil, nil)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	res.Body.Close()
+
+	modTime, _ := http.ParseTime(res.Header.Get("Last-Modified"))
+	return res.ContentLength, modTime, nil
+}
+
+// get returns the contents of an object from an offset, up to length bytes
+// unless length is negative.
+func (c *Config) get(key string, offset, length int64) (io.ReadCloser, error) {
+	req, err := c.newRequest(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case length >= 0:
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	case offset > 0:
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (c *Config) put(key string, body io.Reader, size int64) error {
+	req, err := c.newRequest(http.MethodPut, key, nil, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (c *Config) copy(src, dst string) error {
+	req, err := c.newRequest(http.MethodPut, dst, nil, http.NoBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Amz-Copy-Source", "/"+escapeKey(c.Bucket)+"/"+escapeKey(src))
+
+	res, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (c *Config) delete(key string) error {
+	req, err := c.newRequest(http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
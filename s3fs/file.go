@@ -0,0 +1,334 @@
+package s3fs
+
+import (
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// errReadOnly is returned when the files opened to be read are written.
+var errReadOnly = syscall.EBADF
+
+// reader is an object opened to be read. The contents are streamed from
+// the offset, and seeking starts another request.
+type reader struct {
+	fs     *Fs
+	name   string
+	key    string
+	info   os.FileInfo
+	offset int64
+	body   io.ReadCloser
+}
+
+func (f *reader) Name() string {
+	return f.name
+}
+
+func (f *reader) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *reader) Read(p []byte) (int, error) {
+	if f.offset >= f.info.Size() {
+		return 0, io.EOF
+	}
+
+	if f.body == nil {
+		body, err := f.fs.get(f.key, f.offset, -1)
+		if err != nil {
+			return 0, &os.PathError{Op: "read", Path: f.name, Err: err}
+		}
+		f.body = body
+	}
+
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *reader) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if off >= f.info.Size() {
+		return 0, io.EOF
+	}
+
+	length := int64(len(p))
+	if off+length > f.info.Size() {
+		length = f.info.Size() - off
+	}
+	body, err := f.fs.get(f.key, off, length)
+	if err != nil {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	defer body.Close()
+
+	n, err := io.ReadFull(body, p[:length])
+	if err == nil && length < int64(len(p)) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.Size()
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+
+	if offset != f.offset && f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *reader) Close() error {
+	if f.body != nil {
+		return f.body.Close()
+	}
+	return nil
+}
+
+func (f *reader) Readdir(int) ([]os.FileInfo, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+}
+
+func (f *reader) Readdirnames(int) ([]string, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+}
+
+func (f *reader) Write([]byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: errReadOnly}
+}
+
+func (f *reader) WriteAt([]byte, int64) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: errReadOnly}
+}
+
+func (f *reader) WriteString(string) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: errReadOnly}
+}
+
+func (f *reader) Truncate(int64) error {
+	return &os.PathError{Op: "truncate", Path: f.name, Err: errReadOnly}
+}
+
+func (f *reader) Sync() error {
+	return nil
+}
+
+// dir is a directory, listing the objects and the common prefixes under
+// it when it's read.
+type dir struct {
+	fs      *Fs
+	name    string
+	info    os.FileInfo
+	entries []os.FileInfo
+	listed  bool
+}
+
+func (f *dir) Name() string {
+	return f.name
+}
+
+func (f *dir) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *dir) list() error {
+	if f.listed {
+		return nil
+	}
+
+	prefix := dirKey(f.fs.key(f.name))
+	seen := map[string]bool{}
+	err := f.fs.list(prefix, "/", 0, func(page *listing) bool {
+		for _, p := range page.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(p.Prefix, prefix), "/")
+			if name != "" && !seen[name] {
+				seen[name] = true
+				f.entries = append(f.entries, &fileInfo{name: name, dir: true})
+			}
+		}
+		for _, obj := range page.Contents {
+			name := strings.TrimPrefix(obj.Key, prefix)
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			f.entries = append(f.entries, &fileInfo{name: path.Base(obj.Key), size: obj.Size, modTime: obj.LastModified})
+		}
+		return true
+	})
+	if err != nil {
+		return &os.PathError{Op: "readdir", Path: f.name, Err: err}
+	}
+
+	sort.Slice(f.entries, func(i, j int) bool { return f.entries[i].Name() < f.entries[j].Name() })
+	f.listed = true
+	return nil
+}
+
+func (f *dir) Readdir(count int) ([]os.FileInfo, error) {
+	if err := f.list(); err != nil {
+		return nil, err
+	}
+
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	if count > len(f.entries) {
+		count = len(f.entries)
+	}
+	entries := f.entries[:count]
+	f.entries = f.entries[count:]
+	return entries, nil
+}
+
+func (f *dir) Readdirnames(n int) ([]string, error) {
+	entries, err := f.Readdir(n)
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names, err
+}
+
+func (f *dir) Read([]byte) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+}
+
+func (f *dir) ReadAt([]byte, int64) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+}
+
+func (f *dir) Seek(int64, int) (int64, error) {
+	return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EISDIR}
+}
+
+func (f *dir) Write([]byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EISDIR}
+}
+
+func (f *dir) WriteAt([]byte, int64) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EISDIR}
+}
+
+func (f *dir) WriteString(string) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EISDIR}
+}
+
+func (f *dir) Truncate(int64) error {
+	return &os.PathError{Op: "truncate", Path: f.name, Err: syscall.EISDIR}
+}
+
+func (f *dir) Sync() error {
+	return nil
+}
+
+func (f *dir) Close() error {
+	return nil
+}
+
+// writer is a file opened to be written, in a temporary file that is
+// uploaded when it's closed.
+type writer struct {
+	*os.File
+	fs   *Fs
+	name string
+}
+
+func newWriter(fs *Fs, name string, keep, appending bool) (*writer, error) {
+	tmp, err := os.CreateTemp("", "s3fs-")
+	if err != nil {
+		return nil, err
+	}
+	f := &writer{File: tmp, fs: fs, name: name}
+
+	if keep {
+		if err := f.download(); err != nil {
+			f.discard()
+			return nil, err
+		}
+		if !appending {
+			if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+				f.discard()
+				return nil, err
+			}
+		}
+	}
+	return f, nil
+}
+
+// download copies the current contents of the object to the temporary
+// file.
+func (f *writer) download() error {
+	body, err := f.fs.get(f.fs.key(f.name), 0, -1)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: f.name, Err: err}
+	}
+	defer body.Close()
+
+	_, err = io.Copy(f.File, body)
+	return err
+}
+
+func (f *writer) discard() {
+	f.File.Close()
+	os.Remove(f.File.Name())
+}
+
+func (f *writer) Name() string {
+	return f.name
+}
+
+func (f *writer) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(f.name), size: info.Size(), modTime: info.ModTime()}, nil
+}
+
+func (f *writer) Readdir(int) ([]os.FileInfo, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+}
+
+func (f *writer) Readdirnames(int) ([]string, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+}
+
+// Close uploads the file.
+func (f *writer) Close() error {
+	defer f.discard()
+
+	info, err := f.File.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := f.File.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := f.fs.put(f.fs.key(f.name), f.File, info.Size()); err != nil {
+		return &os.PathError{Op: "close", Path: f.name, Err: err}
+	}
+	return nil
+}
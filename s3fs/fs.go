@@ -0,0 +1,353 @@
+// Package s3fs is a file system on the objects of an S3 bucket, to serve
+// the buckets as the scopes of the users.
+//
+// The object stores have no directories: a directory exists while there
+// are objects under it, and Mkdir creates an empty object whose key ends
+// with a slash to keep the empty ones. There are no permissions nor
+// modification times to change either, so Chmod, Chown and Chtimes do
+// nothing.
+package s3fs
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Scheme is the scheme of the URLs of the buckets, s3://bucket/prefix.
+const Scheme = "s3"
+
+// Fs is an afero.Fs on a prefix of a bucket.
+type Fs struct {
+	Config
+}
+
+// New returns the file system of a bucket.
+func New(config Config) *Fs {
+	config.Prefix = strings.Trim(config.Prefix, "/")
+	return &Fs{Config: config}
+}
+
+// IsURL tells if a root is the URL of a bucket rather than a local path.
+func IsURL(root string) bool {
+	return strings.HasPrefix(root, Scheme+"://")
+}
+
+// NewFromURL returns the file system of a URL like s3://bucket/prefix,
+// with the endpoint and the region in the endpoint and region query
+// parameters. The credentials are the ones of the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables, and
+// the region defaults to the one of AWS_REGION.
+func NewFromURL(raw string) (*Fs, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != Scheme || u.Host == "" {
+		return nil, errors.New("s3: the URL must be like s3://bucket/prefix")
+	}
+
+	region := u.Query().Get("region")
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return New(Config{
+		Endpoint:     u.Query().Get("endpoint"),
+		Region:       region,
+		Bucket:       u.Host,
+		Prefix:       u.Path,
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}), nil
+}
+
+// key returns the key of a name, without slash at the end.
+func (fs *Fs) key(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, "\\", "/")), "/")
+	switch {
+	case fs.Prefix == "":
+		return name
+	case name == "":
+		return fs.Prefix
+	default:
+		return fs.Prefix + "/" + name
+	}
+}
+
+// isRoot tells if a key is the one of the root of the file system, which
+// always exists.
+func (fs *Fs) isRoot(key string) bool {
+	return key == fs.Prefix
+}
+
+func dirKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	return key + "/"
+}
+
+// Name implements afero.Fs.
+func (fs *Fs) Name() string {
+	return "s3fs"
+}
+
+// RealPath returns the URL of the object of a name.
+func (fs *Fs) RealPath(name string) (string, error) {
+	return Scheme + "://" + fs.Bucket + "/" + fs.key(name), nil
+}
+
+// Stat implements afero.Fs. The directories are the ones with objects
+// under them.
+func (fs *Fs) Stat(name string) (os.FileInfo, error) {
+	key := fs.key(name)
+	if fs.isRoot(key) {
+		return &fileInfo{name: path.Base("/" + key), dir: true}, nil
+	}
+
+	size, modTime, err := fs.head(key)
+	if err == nil {
+		return &fileInfo{name: path.Base(key), size: size, modTime: modTime}, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	found := false
+	err = fs.list(dirKey(key), "", 1, func(page *listing) bool {
+		found = len(page.Contents) > 0 || len(page.CommonPrefixes) > 0
+		return false
+	})
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if !found {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return &fileInfo{name: path.Base(key), dir: true}, nil
+}
+
+// LstatIfPossible implements afero.Lstater, there are no links.
+func (fs *Fs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	info, err := fs.Stat(name)
+	return info, false, err
+}
+
+// Mkdir implements afero.Fs.
+func (fs *Fs) Mkdir(name string, _ os.FileMode) error {
+	key := fs.key(name)
+	if info, err := fs.Stat(name); err == nil {
+		if info.IsDir() && fs.isRoot(key) {
+			return nil
+		}
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+
+	if parent := path.Dir("/" + name); parent != "/" {
+		if info, err := fs.Stat(parent); err != nil || !info.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrNotExist}
+		}
+	}
+
+	return fs.mkdir(name, key)
+}
+
+// MkdirAll implements afero.Fs. The parents are virtual, only the last
+// directory being kept by an object.
+func (fs *Fs) MkdirAll(name string, _ os.FileMode) error {
+	key := fs.key(name)
+	if info, err := fs.Stat(name); err == nil {
+		if !info.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+		}
+		return nil
+	}
+	return fs.mkdir(name, key)
+}
+
+func (fs *Fs) mkdir(name, key string) error {
+	if err := fs.put(dirKey(key), nil, 0); err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Create implements afero.Fs.
+func (fs *Fs) Create(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0)
+}
+
+// Open implements afero.Fs.
+func (fs *Fs) Open(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile implements afero.Fs. The files opened to be written are kept in
+// a temporary file, which is uploaded when closed.
+func (fs *Fs) OpenFile(name string, flag int, _ os.FileMode) (afero.File, error) {
+	info, err := fs.Stat(name)
+	if err != nil && (!errors.Is(err, os.ErrNotExist) || flag&os.O_CREATE == 0) {
+		return nil, err
+	}
+
+	if info != nil && info.IsDir() {
+		if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+		}
+		return &dir{fs: fs, name: name, info: info}, nil
+	}
+
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return &reader{fs: fs, name: name, key: fs.key(name), info: info}, nil
+	}
+
+	if info != nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	}
+	keep := info != nil && flag&os.O_TRUNC == 0
+	return newWriter(fs, name, keep, flag&os.O_APPEND != 0)
+}
+
+// Remove implements afero.Fs. The directories must be empty.
+func (fs *Fs) Remove(name string) error {
+	info, err := fs.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	key := fs.key(name)
+	if !info.IsDir() {
+		return fs.delete(key)
+	}
+
+	empty := true
+	err = fs.list(dirKey(key), "/", 2, func(page *listing) bool { //nolint:gomnd
+		for _, obj := range page.Contents {
+			empty = empty && obj.Key == dirKey(key)
+		}
+		empty = empty && len(page.CommonPrefixes) == 0
+		return false
+	})
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if !empty {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+	return fs.delete(dirKey(key))
+}
+
+// RemoveAll implements afero.Fs.
+func (fs *Fs) RemoveAll(name string) error {
+	key := fs.key(name)
+	keys, err := fs.keysUnder(key)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+
+	if !fs.isRoot(key) {
+		keys = append(keys, key)
+	}
+	for _, k := range keys {
+		if err := fs.delete(k); err != nil {
+			return &os.PathError{Op: "remove", Path: name, Err: err}
+		}
+	}
+	return nil
+}
+
+// Rename implements afero.Fs, copying the objects and deleting them.
+func (fs *Fs) Rename(oldname, newname string) error {
+	info, err := fs.Stat(oldname)
+	if err != nil {
+		return err
+	}
+
+	src, dst := fs.key(oldname), fs.key(newname)
+	if src == dst {
+		return nil
+	}
+	if !info.IsDir() {
+		if err := fs.copy(src, dst); err != nil {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+		}
+		return fs.delete(src)
+	}
+	if strings.HasPrefix(dst, dirKey(src)) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EINVAL}
+	}
+
+	keys, err := fs.keysUnder(src)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	for _, k := range keys {
+		target := dirKey(dst) + strings.TrimPrefix(k, dirKey(src))
+		if err := fs.copy(k, target); err != nil {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+		}
+		if err := fs.delete(k); err != nil {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+		}
+	}
+	return nil
+}
+
+// keysUnder returns the keys of all the objects under a directory.
+func (fs *Fs) keysUnder(key string) ([]string, error) {
+	keys := []string{}
+	err := fs.list(dirKey(key), "", 0, func(page *listing) bool {
+		for _, obj := range page.Contents {
+			keys = append(keys, obj.Key)
+		}
+		return true
+	})
+	return keys, err
+}
+
+// Chmod implements afero.Fs, the objects have no modes.
+func (fs *Fs) Chmod(string, os.FileMode) error {
+	return nil
+}
+
+// Chown implements afero.Fs, the objects have no owners.
+func (fs *Fs) Chown(string, int, int) error {
+	return nil
+}
+
+// Chtimes implements afero.Fs, the modification time of the objects is the
+// time they were uploaded.
+func (fs *Fs) Chtimes(string, time.Time, time.Time) error {
+	return nil
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i *fileInfo) Name() string       { return i.name }
+func (i *fileInfo) Size() int64        { return i.size }
+func (i *fileInfo) ModTime() time.Time { return i.modTime }
+func (i *fileInfo) IsDir() bool        { return i.dir }
+func (i *fileInfo) Sys() interface{}   { return nil }
+
+func (i *fileInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0755 //nolint:gomnd
+	}
+	return 0644 //nolint:gomnd
+}
@@ -8,7 +8,8 @@ import (
 )
 
 var (
-	typeRegexp = regexp.MustCompile(`type:(\w+)`)
+	typeRegexp     = regexp.MustCompile(`type:(\w+)`)
+	contentsRegexp = regexp.MustCompile(`contents:("[^"]*"|\S+)`)
 )
 
 type condition func(path string) bool
@@ -45,6 +46,7 @@ func parseSearch(value string) *searchOptions {
 		CaseSensitive: strings.Contains(value, "case:sensitive"),
 		Conditions:    []condition{},
 		Terms:         []string{},
+		Contents:      []string{},
 	}
 
 	// removes the options from the value
@@ -75,6 +77,12 @@ func parseSearch(value string) *searchOptions {
 		value = typeRegexp.ReplaceAllString(value, "")
 	}
 
+	// the contents are matched word by word, like they're indexed
+	for _, c := range contentsRegexp.FindAllStringSubmatch(value, -1) {
+		opts.Contents = append(opts.Contents, tokenize(strings.Trim(c[1], `"`))...)
+	}
+	value = contentsRegexp.ReplaceAllString(value, "")
+
 	// If it's case insensitive, put everything in lowercase.
 	if !opts.CaseSensitive {
 		value = strings.ToLower(value)
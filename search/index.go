@@ -0,0 +1,361 @@
+package search
+
+import (
+	"encoding/gob"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// DefaultMaxIndexedSize is the size of the largest file whose contents are
+// indexed, when the index has no MaxFileSize.
+const DefaultMaxIndexedSize = 5 << 20
+
+// minTermLength is the length of the shortest word that is indexed.
+const minTermLength = 2
+
+// ErrNotIndexed is returned when the contents are searched without an
+// index.
+var ErrNotIndexed = errors.New("the contents of the files are not indexed")
+
+type document struct {
+	ModTime time.Time
+	Terms   []string
+}
+
+// Index keeps the words of the text files, to search them with the
+// contents: qualifier. The files are identified by their real path, so
+// that the users whose scopes overlap share them.
+type Index struct {
+	// Path is the file the index is saved to. Nothing is saved if empty.
+	Path string
+	// MaxFileSize is the size of the largest file whose contents are
+	// indexed, DefaultMaxIndexedSize if zero.
+	MaxFileSize int64
+
+	mu    sync.RWMutex
+	docs  map[string]*document
+	terms map[string]map[string]struct{}
+	dirty bool
+
+	once  sync.Once
+	queue chan func()
+}
+
+// NewIndex returns the index saved in path, or an empty one if the file
+// doesn't exist yet.
+func NewIndex(path string) (*Index, error) {
+	idx := &Index{
+		Path:  path,
+		docs:  map[string]*document{},
+		terms: map[string]map[string]struct{}{},
+	}
+	if path == "" {
+		return idx, nil
+	}
+
+	fd, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	if err := gob.NewDecoder(fd).Decode(&idx.docs); err != nil {
+		return nil, err
+	}
+	for name, doc := range idx.docs {
+		idx.addTerms(name, doc.Terms)
+	}
+
+	return idx, nil
+}
+
+// Save writes the index to its Path, if it changed.
+func (idx *Index) Save() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.Path == "" || !idx.dirty {
+		return nil
+	}
+
+	tmp := idx.Path + ".tmp"
+	fd, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := gob.NewEncoder(fd).Encode(idx.docs); err != nil {
+		fd.Close()
+		return err
+	}
+	if err := fd.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, idx.Path); err != nil {
+		return err
+	}
+
+	idx.dirty = false
+	return nil
+}
+
+// Build indexes the files under root that changed since they were indexed,
+// and forgets the ones that don't exist anymore.
+func (idx *Index) Build(fs afero.Fs, root string) error {
+	seen := map[string]bool{}
+	err := afero.Walk(fs, root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil //nolint:nilerr
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		key := realPath(fs, name)
+		seen[key] = true
+
+		idx.mu.RLock()
+		doc, ok := idx.docs[key]
+		idx.mu.RUnlock()
+		if ok && doc.ModTime.Equal(info.ModTime()) {
+			return nil
+		}
+
+		idx.indexFile(fs, name, info)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	prefix := realPath(fs, root)
+	idx.mu.Lock()
+	for name := range idx.docs {
+		if within(name, prefix) && !seen[name] {
+			idx.removeDoc(name)
+		}
+	}
+	idx.mu.Unlock()
+
+	return idx.Save()
+}
+
+// Update indexes a file, or the files of a directory, of a file system.
+func (idx *Index) Update(fs afero.Fs, name string) {
+	info, err := fs.Stat(name)
+	if err != nil {
+		idx.Remove(fs, name)
+		return
+	}
+
+	if !info.IsDir() {
+		idx.indexFile(fs, name, info)
+		return
+	}
+
+	_ = afero.Walk(fs, name, func(name string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			idx.indexFile(fs, name, info)
+		}
+		return nil
+	})
+}
+
+// Remove forgets a file, or the files of a directory, of a file system.
+func (idx *Index) Remove(fs afero.Fs, name string) {
+	prefix := realPath(fs, name)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for name := range idx.docs {
+		if within(name, prefix) {
+			idx.removeDoc(name)
+		}
+	}
+}
+
+// Contains tells if a file of a file system has all the terms.
+func (idx *Index) Contains(fs afero.Fs, name string, terms []string) bool {
+	key := realPath(fs, name)
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	for _, term := range terms {
+		if _, ok := idx.terms[term][key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// OperationDone updates the index after the uploads, saves, copies, moves
+// and deletions. It implements runner.Listener, the files being read in
+// the background. The updates are dropped while the queue is full, not to
+// hold the operations up, until the next Build picks the files up.
+func (idx *Index) OperationDone(event, path, dst string, user *users.User) {
+	fs := user.Fs
+	var job func()
+
+	switch event {
+	case "after_upload", "after_save":
+		job = func() { idx.Update(fs, path) }
+	case "after_copy":
+		job = func() { idx.Update(fs, dst) }
+	case "after_rename", "after_move":
+		job = func() {
+			idx.Remove(fs, path)
+			idx.Update(fs, dst)
+		}
+	case "after_delete":
+		job = func() { idx.Remove(fs, path) }
+	default:
+		return
+	}
+
+	idx.once.Do(func() {
+		idx.queue = make(chan func(), 1024) //nolint:gomnd
+		go idx.work()
+	})
+	select {
+	case idx.queue <- job:
+	default:
+		log.Printf("[WARN] Dropped the search index update of %s after %s: the queue is full", path, event)
+	}
+}
+
+// work runs the updates, saving the index each time there are no more.
+func (idx *Index) work() {
+	for job := range idx.queue {
+		job()
+		if len(idx.queue) > 0 {
+			continue
+		}
+		if err := idx.Save(); err != nil {
+			log.Printf("[WARN] Failed to save the search index: %v", err)
+		}
+	}
+}
+
+func (idx *Index) maxFileSize() int64 {
+	if idx.MaxFileSize <= 0 {
+		return DefaultMaxIndexedSize
+	}
+	return idx.MaxFileSize
+}
+
+// indexFile reads the words of a file if it's text. The other files are
+// kept without words, not to be read again until they change.
+func (idx *Index) indexFile(fs afero.Fs, name string, info os.FileInfo) {
+	key := realPath(fs, name)
+
+	var terms []string
+	if info.Size() <= idx.maxFileSize() {
+		terms = readTerms(fs, name)
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeDoc(key)
+	idx.docs[key] = &document{ModTime: info.ModTime(), Terms: terms}
+	idx.addTerms(key, terms)
+	idx.dirty = true
+}
+
+func (idx *Index) addTerms(name string, terms []string) {
+	for _, term := range terms {
+		if idx.terms[term] == nil {
+			idx.terms[term] = map[string]struct{}{}
+		}
+		idx.terms[term][name] = struct{}{}
+	}
+}
+
+func (idx *Index) removeDoc(name string) {
+	doc, ok := idx.docs[name]
+	if !ok {
+		return
+	}
+
+	for _, term := range doc.Terms {
+		delete(idx.terms[term], name)
+		if len(idx.terms[term]) == 0 {
+			delete(idx.terms, term)
+		}
+	}
+	delete(idx.docs, name)
+	idx.dirty = true
+}
+
+// readTerms returns the words of a text file, or nil if it isn't text.
+func readTerms(fs afero.Fs, name string) []string {
+	fd, err := fs.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer fd.Close()
+
+	content, err := io.ReadAll(fd)
+	if err != nil {
+		return nil
+	}
+
+	head := content
+	if len(head) > 512 { //nolint:gomnd
+		head = head[:512]
+	}
+	if !strings.HasPrefix(http.DetectContentType(head), "text/") || !utf8.Valid(content) {
+		return nil
+	}
+
+	return tokenize(string(content))
+}
+
+// tokenize returns the distinct words of a text, in lowercase.
+func tokenize(text string) []string {
+	seen := map[string]bool{}
+	terms := []string{}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if utf8.RuneCountInString(word) < minTermLength || seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+
+	return terms
+}
+
+// realPath returns the path of a file outside of its file system, the key
+// of the index.
+func realPath(fs afero.Fs, name string) string {
+	if base, ok := fs.(*afero.BasePathFs); ok {
+		if p, err := base.RealPath(name); err == nil {
+			return p
+		}
+	}
+	return filepath.Clean(name)
+}
+
+func within(name, dir string) bool {
+	return name == dir || strings.HasPrefix(name, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
@@ -0,0 +1,138 @@
+package search
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+func TestIndex(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for name, content := range map[string]string{
+		"/docs/a.txt":   "Hello world",
+		"/docs/b.txt":   "hello there",
+		"/bin/data.bin": "\x00\x01\x02hello",
+	} {
+		if err := afero.WriteFile(fs, name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "index")
+	idx, err := NewIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Build(fs, "/"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		terms []string
+		want  bool
+	}{
+		{"/docs/a.txt", []string{"hello", "world"}, true},
+		{"/docs/b.txt", []string{"hello", "world"}, false},
+		{"/docs/b.txt", []string{"there"}, true},
+		{"/bin/data.bin", []string{"hello"}, false},
+	} {
+		if got := idx.Contains(fs, tt.name, tt.terms); got != tt.want {
+			t.Errorf("%s %v: expected %t, got %t", tt.name, tt.terms, tt.want, got)
+		}
+	}
+
+	// the changes are picked up by the updates and the next builds
+	if err := afero.WriteFile(fs, "/docs/a.txt", []byte("goodbye"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	idx.Update(fs, "/docs/a.txt")
+	if idx.Contains(fs, "/docs/a.txt", []string{"hello"}) || !idx.Contains(fs, "/docs/a.txt", []string{"goodbye"}) {
+		t.Error("expected the update to replace the words")
+	}
+	idx.Remove(fs, "/docs")
+	if idx.Contains(fs, "/docs/b.txt", []string{"there"}) {
+		t.Error("expected the files of the directory to be removed")
+	}
+	if err := fs.Remove("/docs/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Build(fs, "/"); err != nil {
+		t.Fatal(err)
+	}
+	if idx.Contains(fs, "/docs/b.txt", []string{"there"}) || !idx.Contains(fs, "/docs/a.txt", []string{"goodbye"}) {
+		t.Error("expected the build to index the files that exist only")
+	}
+
+	// the saved index is loaded back
+	loaded, err := NewIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Contains(fs, "/docs/a.txt", []string{"goodbye"}) {
+		t.Error("expected the saved index to be loaded")
+	}
+}
+
+func TestIndexMaxFileSize(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "/big.txt", []byte("hello world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := NewIndex("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.MaxFileSize = 5
+	if err := idx.Build(fs, "/"); err != nil {
+		t.Fatal(err)
+	}
+	if idx.Contains(fs, "/big.txt", []string{"hello"}) {
+		t.Error("expected the contents of the large files not to be indexed")
+	}
+}
+
+func TestIndexOperationDone(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "/a.txt", []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := NewIndex("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &users.User{Fs: fs}
+	idx.OperationDone("after_upload", "/a.txt", "", user)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !idx.Contains(fs, "/a.txt", []string{"hello"}) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the upload to be indexed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the updates are dropped rather than waited for when the queue is full
+	block := make(chan struct{})
+	idx.queue <- func() { <-block }
+	for len(idx.queue) < cap(idx.queue) {
+		idx.queue <- func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		idx.OperationDone("after_delete", "/a.txt", "", user)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("expected the update not to block")
+	}
+	close(block)
+}
@@ -15,11 +15,24 @@ type searchOptions struct {
 	CaseSensitive bool
 	Conditions    []condition
 	Terms         []string
+	Contents      []string
 }
 
-// Search searches for a query in a fs.
-func Search(fs afero.Fs, scope, query string, checker rules.Checker, found func(path string, f os.FileInfo) error) error {
+// DirSkipper is a rules.Checker that tells which directories are skipped
+// along with everything under them, unlike the ones denied by the rules,
+// which may allow some of their files.
+type DirSkipper interface {
+	SkipDir(path string) bool
+}
+
+// Search searches for a query in a fs. The contents: qualifier is searched
+// in the index, ErrNotIndexed being returned if it's nil. The directories
+// the checker skips, if it's a DirSkipper, aren't walked.
+func Search(fs afero.Fs, scope, query string, checker rules.Checker, index *Index, found func(path string, f os.FileInfo) error) error {
 	search := parseSearch(query)
+	if len(search.Contents) > 0 && index == nil {
+		return ErrNotIndexed
+	}
 
 	scope = filepath.ToSlash(filepath.Clean(scope))
 	scope = path.Join("/", scope)
@@ -34,6 +47,10 @@ func Search(fs afero.Fs, scope, query string, checker rules.Checker, found func(
 			return nil
 		}
 
+		if skipper, ok := checker.(DirSkipper); ok && f != nil && f.IsDir() && skipper.SkipDir(fPath) {
+			return filepath.SkipDir
+		}
+
 		if !checker.Check(fPath) {
 			return nil
 		}
@@ -53,6 +70,10 @@ func Search(fs afero.Fs, scope, query string, checker rules.Checker, found func(
 			}
 		}
 
+		if len(search.Contents) > 0 && (f.IsDir() || !index.Contains(fs, fPath, search.Contents)) {
+			return nil
+		}
+
 		if len(search.Terms) > 0 {
 			for _, term := range search.Terms {
 				_, fileName := path.Split(fPath)
@@ -70,3 +91,26 @@ func Search(fs afero.Fs, scope, query string, checker rules.Checker, found func(
 		return found(relativePath, f)
 	})
 }
+
+// Excluded tells if a path, or one of its directories, matches one of the
+// patterns, against their name or against their path if the pattern is
+// absolute.
+func Excluded(patterns []string, p string) bool {
+	p = path.Join("/", filepath.ToSlash(p))
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "/") {
+			for dir := p; dir != "/"; dir = path.Dir(dir) {
+				if ok, _ := path.Match(pattern, dir); ok {
+					return true
+				}
+			}
+			continue
+		}
+		for _, name := range strings.Split(strings.Trim(p, "/"), "/") {
+			if ok, _ := path.Match(pattern, name); ok && name != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package search
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// skipChecker skips the directories with the prefix, and records the paths
+// it checks.
+type skipChecker struct {
+	prefix  string
+	checked []string
+}
+
+func (c *skipChecker) Check(p string) bool {
+	c.checked = append(c.checked, p)
+	return !strings.HasPrefix(p, c.prefix)
+}
+
+func (c *skipChecker) SkipDir(p string) bool {
+	return strings.HasPrefix(p, c.prefix)
+}
+
+func TestSearchSkipDir(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for _, name := range []string{"/a.txt", "/skipped/b.txt", "/skipped/deep/c.txt", "/kept/d.txt"} {
+		if err := afero.WriteFile(fs, name, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checker := &skipChecker{prefix: "/skipped"}
+	found := []string{}
+	err := Search(fs, "/", "txt", checker, nil, func(p string, _ os.FileInfo) error {
+		found = append(found, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(found, ",") != "a.txt,kept/d.txt" {
+		t.Errorf("unexpected results %v", found)
+	}
+	for _, p := range checker.checked {
+		if strings.HasPrefix(p, "/skipped") {
+			t.Errorf("expected %s not to be walked", p)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package session
+
+import "time"
+
+// Session is a token issued to a user at login. Deleting it revokes the
+// token before it expires.
+type Session struct {
+	ID     string `json:"id" storm:"id,index"`
+	UserID uint   `json:"userID" storm:"index"`
+	// Device is the user agent the user logged in with, and IP the address
+	// of the client.
+	Device   string `json:"device"`
+	IP       string `json:"ip"`
+	IssuedAt int64  `json:"issuedAt"`
+	LastSeen int64  `json:"lastSeen"`
+	Expire   int64  `json:"expire"`
+}
+
+// Expired tells if the token of the session expired.
+func (s *Session) Expired() bool {
+	return s.Expire != 0 && s.Expire <= time.Now().Unix()
+}
@@ -0,0 +1,78 @@
+package session
+
+import (
+	"github.com/filebrowser/filebrowser/v2/errors"
+)
+
+// StorageBackend is the interface to implement for a session storage.
+type StorageBackend interface {
+	FindByUserID(id uint) ([]*Session, error)
+	Get(id string) (*Session, error)
+	Save(s *Session) error
+	Delete(id string) error
+	DeleteByUserID(id uint) error
+}
+
+// Storage is a storage.
+type Storage struct {
+	back StorageBackend
+}
+
+// NewStorage creates a session storage from a backend.
+func NewStorage(back StorageBackend) *Storage {
+	return &Storage{back: back}
+}
+
+// FindByUserID wraps a StorageBackend.FindByUserID, deleting the expired
+// sessions.
+func (s *Storage) FindByUserID(id uint) ([]*Session, error) {
+	sessions, err := s.back.FindByUserID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	active := sessions[:0]
+	for _, sess := range sessions {
+		if !sess.Expired() {
+			active = append(active, sess)
+			continue
+		}
+		if err := s.Delete(sess.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return active, nil
+}
+
+// Get wraps a StorageBackend.Get.
+func (s *Storage) Get(id string) (*Session, error) {
+	sess, err := s.back.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if sess.Expired() {
+		if err := s.Delete(sess.ID); err != nil {
+			return nil, err
+		}
+		return nil, errors.ErrNotExist
+	}
+
+	return sess, nil
+}
+
+// Save wraps a StorageBackend.Save.
+func (s *Storage) Save(sess *Session) error {
+	return s.back.Save(sess)
+}
+
+// Delete wraps a StorageBackend.Delete.
+func (s *Storage) Delete(id string) error {
+	return s.back.Delete(id)
+}
+
+// DeleteByUserID wraps a StorageBackend.DeleteByUserID.
+func (s *Storage) DeleteByUserID(id uint) error {
+	return s.back.DeleteByUserID(id)
+}
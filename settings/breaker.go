@@ -0,0 +1,31 @@
+package settings
+
+import (
+	"log"
+	"time"
+)
+
+const DefaultHookBreakerCooldown = 30 * time.Second
+
+// HookBreaker contains the circuit breaker settings of the before hooks.
+type HookBreaker struct {
+	// Threshold is the number of consecutive failures of a command after
+	// which it isn't run anymore for a while. Zero disables the breaker.
+	Threshold int `json:"threshold"`
+	// Cooldown is how long the command isn't run for, as a duration.
+	Cooldown string `json:"cooldown"`
+}
+
+// GetCooldown returns the cooldown, DefaultHookBreakerCooldown if not set.
+func (b HookBreaker) GetCooldown() time.Duration {
+	if b.Cooldown == "" {
+		return DefaultHookBreakerCooldown
+	}
+
+	duration, err := time.ParseDuration(b.Cooldown)
+	if err != nil {
+		log.Printf("[WARN] Failed to parse hookBreaker.cooldown: %v", err)
+		return DefaultHookBreakerCooldown
+	}
+	return duration
+}
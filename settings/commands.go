@@ -0,0 +1,114 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// HookCommand is a hook command of an event, only run for the files that
+// match its patterns if it has some. In JSON, it is either a string, for a
+// command without patterns, or an object such as
+// {"match": "*.jpg,*.png", "command": "convert $FILE"}. Instead of a
+// command, it can reference a CommandTemplate of the settings, such as
+// {"template": "thumbnail", "params": {"size": "256x256"}}.
+type HookCommand struct {
+	Command string `json:"command,omitempty"`
+	// Match are comma separated patterns of the files the command runs
+	// for, on their name such as "*.jpg" or on their mime type such as
+	// "image/*". Empty matches every file.
+	Match string `json:"match,omitempty"`
+	// Template is the name of the template the command is made of, with
+	// the values of its parameters in Params.
+	Template string            `json:"template,omitempty"`
+	Params   map[string]string `json:"params,omitempty"`
+}
+
+type hookCommandJSON HookCommand
+
+// MarshalJSON implements json.Marshaler, writing the commands without
+// patterns nor template as strings.
+func (c HookCommand) MarshalJSON() ([]byte, error) {
+	if c.Match == "" && c.Template == "" {
+		return json.Marshal(c.Command)
+	}
+	return json.Marshal(hookCommandJSON(c))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *HookCommand) UnmarshalJSON(data []byte) error {
+	var command string
+	if err := json.Unmarshal(data, &command); err == nil {
+		*c = HookCommand{Command: command}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*hookCommandJSON)(c))
+}
+
+// CommandTemplate is a command several hook commands can share, such as
+// "convert $FILE -resize {{size}} {{output}}", whose named parameters each
+// command referencing it fills.
+type CommandTemplate struct {
+	Command     string          `json:"command"`
+	Params      []TemplateParam `json:"params"`
+	Description string          `json:"description,omitempty"`
+}
+
+// TemplateParam is a parameter of a CommandTemplate, written {{name}} in its
+// command.
+type TemplateParam struct {
+	Name string `json:"name"`
+	// Default is the value of the commands that don't set the parameter,
+	// unless it is Required.
+	Default  string `json:"default,omitempty"`
+	Required bool   `json:"required,omitempty"`
+}
+
+// ErrCommandTemplate is returned when a hook command references a template
+// that doesn't exist, or doesn't fill its parameters.
+var ErrCommandTemplate = errors.New("invalid command template")
+
+var templateParamPattern = regexp.MustCompile(`{{\s*(\w+)\s*}}`)
+
+// ResolveCommand returns the command line of a hook command, the command of
+// its template with the parameters filled if it references one. The values
+// are pasted as is, so they can have placeholders such as $FILE, expanded
+// from the event like the rest of the command. The other {{name}} of the
+// template, such as {{year}}, are kept for the runner.
+func (s *Settings) ResolveCommand(c HookCommand) (string, error) {
+	if c.Template == "" {
+		return c.Command, nil
+	}
+
+	template, ok := s.CommandTemplates[c.Template]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown template %q", ErrCommandTemplate, c.Template)
+	}
+
+	values := map[string]string{}
+	for _, param := range template.Params {
+		value, ok := c.Params[param.Name]
+		if !ok && param.Required {
+			return "", fmt.Errorf("%w: %s requires the %s parameter", ErrCommandTemplate, c.Template, param.Name)
+		}
+		if !ok {
+			value = param.Default
+		}
+		values[param.Name] = value
+	}
+	for name := range c.Params {
+		if _, ok := values[name]; !ok {
+			return "", fmt.Errorf("%w: %s has no %s parameter", ErrCommandTemplate, c.Template, name)
+		}
+	}
+
+	return templateParamPattern.ReplaceAllStringFunc(template.Command, func(match string) string {
+		name := templateParamPattern.FindStringSubmatch(match)[1]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return match
+	}), nil
+}
@@ -1,7 +1,12 @@
 package settings
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/filebrowser/filebrowser/v2/errors"
 	"github.com/filebrowser/filebrowser/v2/files"
+	"github.com/filebrowser/filebrowser/v2/rules"
 	"github.com/filebrowser/filebrowser/v2/users"
 )
 
@@ -15,6 +20,7 @@ type UserDefaults struct {
 	Sorting      files.Sorting     `json:"sorting"`
 	Perm         users.Permissions `json:"perm"`
 	Commands     []string          `json:"commands"`
+	Rules        []rules.Rule      `json:"rules"`
 	HideDotfiles bool              `json:"hideDotfiles"`
 	DateFormat   bool              `json:"dateFormat"`
 }
@@ -27,7 +33,41 @@ func (d *UserDefaults) Apply(u *users.User) {
 	u.SingleClick = d.SingleClick
 	u.Perm = d.Perm
 	u.Sorting = d.Sorting
-	u.Commands = d.Commands
+	u.Commands = append([]string{}, d.Commands...)
+	u.Rules = append([]rules.Rule{}, d.Rules...)
 	u.HideDotfiles = d.HideDotfiles
 	u.DateFormat = d.DateFormat
 }
+
+// Validate returns an error wrapping errors.ErrInvalidOption if the
+// defaults can't be applied to the new users.
+func (d *UserDefaults) Validate() error {
+	for _, part := range strings.Split(strings.ReplaceAll(d.Scope, "\\", "/"), "/") {
+		if part == ".." {
+			return fmt.Errorf("%w: the default scope %q leaves the root", errors.ErrInvalidOption, d.Scope)
+		}
+	}
+
+	switch d.ViewMode {
+	case "", users.ListViewMode, users.MosaicViewMode:
+	default:
+		return fmt.Errorf("%w: unknown default view mode %q", errors.ErrInvalidOption, d.ViewMode)
+	}
+
+	switch d.Sorting.By {
+	case "", "name", "size", "modified":
+	default:
+		return fmt.Errorf("%w: unknown default sorting %q", errors.ErrInvalidOption, d.Sorting.By)
+	}
+
+	for _, command := range d.Commands {
+		if strings.TrimSpace(command) == "" {
+			return fmt.Errorf("%w: empty default command", errors.ErrInvalidOption)
+		}
+	}
+
+	if err := rules.Validate(d.Rules); err != nil {
+		return fmt.Errorf("%w: default rules: %w", errors.ErrInvalidOption, err)
+	}
+	return nil
+}
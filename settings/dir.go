@@ -10,6 +10,8 @@ import (
 	"strings"
 
 	"github.com/spf13/afero"
+
+	"github.com/filebrowser/filebrowser/v2/users"
 )
 
 var (
@@ -32,7 +34,12 @@ func (s *Settings) MakeUserDir(username, userScope, serverRoot string) (string,
 
 	userScope = path.Join("/", userScope)
 
-	fs := afero.NewBasePathFs(afero.NewOsFs(), serverRoot)
+	rootFs, root, err := users.RootFs(serverRoot)
+	if err != nil {
+		return "", err
+	}
+
+	fs := afero.NewBasePathFs(rootFs, root)
 	if err := fs.MkdirAll(userScope, os.ModePerm); err != nil {
 		return "", fmt.Errorf("failed to create user home dir: [%s]: %w", userScope, err)
 	}
@@ -0,0 +1,27 @@
+package settings
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/filebrowser/filebrowser/v2/errors"
+)
+
+// cleanMimeTypes returns the MIME type overrides with their extensions in
+// lowercase, refusing the extensions that aren't a dot and a name, which
+// no file would have, and the invalid types.
+func cleanMimeTypes(types map[string]string) (map[string]string, error) {
+	cleaned := make(map[string]string, len(types))
+	for ext, typ := range types {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if len(ext) < 2 || ext[0] != '.' || strings.ContainsAny(ext[1:], "./\\") {
+			return nil, fmt.Errorf("%w: invalid extension %q", errors.ErrInvalidOption, ext)
+		}
+		if _, _, err := mime.ParseMediaType(typ); err != nil {
+			return nil, fmt.Errorf("%w: invalid MIME type %q of %s", errors.ErrInvalidOption, typ, ext)
+		}
+		cleaned[ext] = strings.TrimSpace(typ)
+	}
+	return cleaned, nil
+}
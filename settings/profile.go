@@ -0,0 +1,79 @@
+package settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/filebrowser/filebrowser/v2/errors"
+)
+
+// profileFixedFields are the settings the profiles can't override.
+var profileFixedFields = []string{"key", "signingKeys", "profiles"}
+
+// WithProfile returns a copy of the settings with the overrides of a profile
+// merged over them as a JSON merge patch: the objects are merged, null
+// removes a value and the other values, such as the lists, are replaced.
+// The settings are returned as they are for an empty name.
+func (s *Settings) WithProfile(name string) (*Settings, error) {
+	if name == "" {
+		return s, nil
+	}
+	override, ok := s.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown settings profile %q", errors.ErrInvalidOption, name)
+	}
+
+	var patch map[string]interface{}
+	if err := json.Unmarshal(override, &patch); err != nil || patch == nil {
+		return nil, fmt.Errorf("%w: the settings profile %q isn't a JSON object", errors.ErrInvalidOption, name)
+	}
+	for field := range patch {
+		if slices.Contains(profileFixedFields, field) {
+			return nil, fmt.Errorf("%w: the settings profile %q can't override %s", errors.ErrInvalidOption, name, field)
+		}
+	}
+
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var base map[string]interface{}
+	if err := json.Unmarshal(raw, &base); err != nil {
+		return nil, err
+	}
+	if raw, err = json.Marshal(mergePatch(base, patch)); err != nil {
+		return nil, err
+	}
+
+	// the misspelled settings would be ignored silently
+	merged := &Settings{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(merged); err != nil {
+		return nil, fmt.Errorf("%w: the settings profile %q: %v", errors.ErrInvalidOption, name, err) //nolint:errorlint
+	}
+	return merged, nil
+}
+
+// mergePatch applies a JSON merge patch to a value, see RFC 7386.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = mergePatch(targetObj[key], value)
+	}
+	return targetObj
+}
@@ -0,0 +1,31 @@
+package settings
+
+const DefaultRedisAddress = "localhost:6379"
+
+// Redis contains the connection settings of the redis database the after
+// hooks are queued in.
+type Redis struct {
+	// Address is the host:port of the server, DefaultRedisAddress if empty.
+	Address  string `json:"address"`
+	Password string `json:"password"`
+	DB       int    `json:"db"`
+	// PoolSize is the maximum number of connections, the default of the
+	// client if zero.
+	PoolSize int `json:"poolSize"`
+	// TLS connects to the server with TLS. CA is the authority to verify
+	// the server with, the system ones if empty, and Cert and Key are the
+	// client certificate, for servers that require one.
+	TLS  bool   `json:"tls"`
+	CA   string `json:"ca"`
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
+
+// GetAddress returns the address of the server, DefaultRedisAddress if not
+// set.
+func (r Redis) GetAddress() string {
+	if r.Address == "" {
+		return DefaultRedisAddress
+	}
+	return r.Address
+}
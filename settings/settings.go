@@ -2,6 +2,7 @@ package settings
 
 import (
 	"crypto/rand"
+	"encoding/json"
 	"log"
 	"strings"
 	"time"
@@ -16,17 +17,108 @@ type AuthMethod string
 
 // Settings contain the main settings of the application.
 type Settings struct {
-	Key              []byte              `json:"key"`
-	Signup           bool                `json:"signup"`
-	CreateUserDir    bool                `json:"createUserDir"`
-	UserHomeBasePath string              `json:"userHomeBasePath"`
-	Defaults         UserDefaults        `json:"defaults"`
-	AuthMethod       AuthMethod          `json:"authMethod"`
-	Branding         Branding            `json:"branding"`
-	Tus              Tus                 `json:"tus"`
-	Commands         map[string][]string `json:"commands"`
-	Shell            []string            `json:"shell"`
-	Rules            []rules.Rule        `json:"rules"`
+	Key              []byte                   `json:"key"`
+	Signup           bool                     `json:"signup"`
+	CreateUserDir    bool                     `json:"createUserDir"`
+	UserHomeBasePath string                   `json:"userHomeBasePath"`
+	Defaults         UserDefaults             `json:"defaults"`
+	AuthMethod       AuthMethod               `json:"authMethod"`
+	Branding         Branding                 `json:"branding"`
+	Tus              Tus                      `json:"tus"`
+	Commands         map[string][]HookCommand `json:"commands"`
+	// CommandTemplates are the templates the commands can reference by
+	// name.
+	CommandTemplates map[string]CommandTemplate `json:"commandTemplates"`
+	Shell            []string                   `json:"shell"`
+	// UseShell makes the commands run through a shell, the Shell if set or
+	// /bin/sh -c otherwise. Setting a Shell also enables it.
+	UseShell bool `json:"useShell"`
+	// ScriptsDir is where the scripts referenced as @name in the commands
+	// are looked up.
+	ScriptsDir string `json:"scriptsDir"`
+	// EnvDir is where the env files referenced by the commands, with
+	// --env name at their end, are looked up. Their KEY=VALUE pairs are
+	// only given to these commands.
+	EnvDir string `json:"envDir"`
+	// StdinEvents are the events, such as "after_upload", whose commands
+	// get the content of the file as their standard input.
+	StdinEvents []string `json:"stdinEvents"`
+	// MetadataEvents are the before events, such as "before_upload", whose
+	// commands can change the operation by printing a JSON object on
+	// stdout. See runner.Metadata.
+	MetadataEvents []string `json:"metadataEvents"`
+	// AllowedCommands restricts the executables the hooks can run to these
+	// absolute paths or names looked up in the PATH. Empty means any.
+	AllowedCommands []string `json:"allowedCommands"`
+	// DirHooks runs the commands of the .fbhooks.json files of the
+	// directories for the operations in their subtree, for the users who
+	// can execute commands. Only the executables in both the commands of
+	// the user and AllowedCommands are run.
+	DirHooks bool `json:"dirHooks"`
+	// HookWorkingDir is the directory the commands run in: "server", the
+	// default, "scope" for the scope of the user or "file" for the
+	// directory of the file.
+	HookWorkingDir string `json:"hookWorkingDir"`
+	// InheritEnv makes the commands inherit the environment of the server,
+	// which is the default. Disabling it runs them with only the variables
+	// of the event and ExtraEnv, so that they don't see its secrets.
+	InheritEnv *bool `json:"inheritEnv,omitempty"`
+	// ExtraEnv are environment variables added to the commands.
+	ExtraEnv map[string]string `json:"extraEnv"`
+	// HookBreaker stops running the before hooks that keep failing.
+	HookBreaker HookBreaker `json:"hookBreaker"`
+	// HookPolicies are the failure policies of the before hooks by event,
+	// such as "before_upload": "continue". They default to "abort".
+	HookPolicies map[string]string `json:"hookPolicies"`
+	// QueueName is the redis list the after hooks are queued to, so that
+	// several instances can share a redis database.
+	QueueName string       `json:"queueName"`
+	Rules     []rules.Rule `json:"rules"`
+	// SearchExclude are the patterns of the names or the paths the searches
+	// skip, with their contents, such as node_modules or /tmp/*.
+	SearchExclude []string `json:"searchExclude"`
+	// SymlinkPolicy is how the symlinks of the scopes are handled, one of
+	// the users.Symlink policies. They're followed wherever they point if
+	// empty.
+	SymlinkPolicy string `json:"symlinkPolicy"`
+	// MimeTypes override the MIME types of the extensions, such as ".md":
+	// "text/markdown", which the files are previewed and served with.
+	MimeTypes map[string]string `json:"mimeTypes"`
+	// MaxHooksPerMinute limits the hooks each user can run. Zero means
+	// no limit.
+	MaxHooksPerMinute int `json:"maxHooksPerMinute"`
+	// MaxGlobalHooksPerMinute limits the hooks run by all the users
+	// together. Zero means no limit.
+	MaxGlobalHooksPerMinute int `json:"maxGlobalHooksPerMinute"`
+	// ReadOnly refuses the operations changing the files, whatever the
+	// permissions of the users, and the hooks of their events.
+	ReadOnly bool `json:"readOnly"`
+	// MaxUploadSize is the size of the files the users can upload, unless
+	// they have their own. Zero means no limit.
+	MaxUploadSize int64 `json:"maxUploadSize"`
+	// MaxShareRequestsPerMinute limits the requests to all the public
+	// shares together, and MaxShareBandwidth the bytes per second that are
+	// downloaded from them, on top of the limits of each share. Zero means
+	// no limit.
+	MaxShareRequestsPerMinute int   `json:"maxShareRequestsPerMinute"`
+	MaxShareBandwidth         int64 `json:"maxShareBandwidth"`
+	// Profiles are named overrides of these settings, such as the hooks
+	// and the limits of an environment, merged over them as JSON merge
+	// patches by the server started with their name, see WithProfile.
+	Profiles map[string]json.RawMessage `json:"profiles,omitempty"`
+	// EnforceTOTP requires the users of the json auth to set up a second
+	// factor, which they do on their next login.
+	EnforceTOTP bool `json:"enforceTotp"`
+	// SigningKeys are the keys of the tokens, the current one last followed
+	// by the rotated ones still verifying the tokens they signed. The Key
+	// signs them until the keys are first rotated.
+	SigningKeys []SigningKey `json:"signingKeys"`
+}
+
+// GetInheritEnv returns whether the commands inherit the environment of the
+// server, true if not set.
+func (s *Settings) GetInheritEnv() bool {
+	return s.InheritEnv == nil || *s.InheritEnv
 }
 
 // GetRules implements rules.Provider.
@@ -46,15 +138,83 @@ type Server struct {
 	Log                   string `json:"log"`
 	EnableThumbnails      bool   `json:"enableThumbnails"`
 	ResizePreview         bool   `json:"resizePreview"`
+	ThumbnailSize         int    `json:"thumbnailSize"`
+	PreviewSize           int    `json:"previewSize"`
+	VideoThumbnailCommand string `json:"videoThumbnailCommand"`
 	EnableExec            bool   `json:"enableExec"`
+	EnableHookQueue       bool   `json:"enableHookQueue"`
+	HookDryRun            bool   `json:"hookDryRun"`
+	HookStrictValidation  bool   `json:"hookStrictValidation"`
 	TypeDetectionByHeader bool   `json:"typeDetectionByHeader"`
 	AuthHook              string `json:"authHook"`
 	TokenExpirationTime   string `json:"tokenExpirationTime"`
+	HookFallbackFile      string `json:"hookFallbackFile"`
+	HookAuditFile         string `json:"hookAuditFile"`
+	HookAuditList         string `json:"hookAuditList"`
+	HookTimeout           string `json:"hookTimeout"`
+	HookDedupWindow       string `json:"hookDedupWindow"`
+	HookLogFormat         string `json:"hookLogFormat"`
+	HookQueueBackend      string `json:"hookQueueBackend"`
+	MaxBackgroundHooks    int    `json:"maxBackgroundHooks"`
+	MaxHookOutputBytes    int64  `json:"maxHookOutputBytes"`
+	HookQueuePartitions   int    `json:"hookQueuePartitions"`
+	WebDAVPath            string `json:"webdavPath"`
+	TusDir                string `json:"tusDir"`
+	SearchIndex           string `json:"searchIndex"`
+	PluginsDir            string `json:"pluginsDir"`
+	HookExecutor          string `json:"hookExecutor"`
+	HookExecutorCA        string `json:"hookExecutorCA"`
+	Redis                 Redis  `json:"redis"`
+	LoginMaxAttempts      int    `json:"loginMaxAttempts"`
+	LoginMaxAttemptsPerIP int    `json:"loginMaxAttemptsPerIP"`
+	LoginAttemptWindow    string `json:"loginAttemptWindow"`
+	LoginLockout          string `json:"loginLockout"`
+	LoginBackoff          bool   `json:"loginBackoff"`
+	// AllowedIPs and DeniedIPs are the comma separated IPs and CIDRs
+	// allowed and denied to access the server, all of them being allowed
+	// if AllowedIPs is empty. AdminAllowedIPs and AdminDeniedIPs restrict
+	// the admin API the same way, on top of them.
+	AllowedIPs      string `json:"allowedIPs"`
+	DeniedIPs       string `json:"deniedIPs"`
+	AdminAllowedIPs string `json:"adminAllowedIPs"`
+	AdminDeniedIPs  string `json:"adminDeniedIPs"`
+	// TrustedProxies are the comma separated IPs and CIDRs of the proxies
+	// whose X-Forwarded-For header tells the IP of the clients.
+	TrustedProxies string `json:"trustedProxies"`
+	// Compression are the comma separated algorithms the responses are
+	// compressed with, gzip and br, the first ones being preferred. The
+	// responses aren't compressed if it's empty.
+	Compression string `json:"compression"`
+	// CompressionLevel is the level of the algorithms, their default one
+	// if zero.
+	CompressionLevel int `json:"compressionLevel"`
+	// CompressionMinSize is the size of the smallest responses compressed,
+	// DefaultCompressionMinSize if zero.
+	CompressionMinSize int `json:"compressionMinSize"`
+	// WebhookURL is the URL the operations are posted to, signed with
+	// WebhookSecret, see runner.WebhookSink. WebhookEvents are the comma
+	// separated operations posted, all of them if empty.
+	WebhookURL     string `json:"webhookURL"`
+	WebhookSecret  string `json:"webhookSecret"`
+	WebhookEvents  string `json:"webhookEvents"`
+	WebhookRetries int    `json:"webhookRetries"`
+	WebhookBackoff string `json:"webhookBackoff"`
+	// DirSizes shows the total size of the files under the directories of
+	// the listings, kept up to date with the operations and computed again
+	// every DirSizesInterval.
+	DirSizes         bool   `json:"dirSizes"`
+	DirSizesInterval string `json:"dirSizesInterval"`
+	// Profile is the name of the profile of the settings that is used,
+	// none if empty.
+	Profile string `json:"profile"`
 }
 
 // Clean cleans any variables that might need cleaning.
 func (s *Server) Clean() {
 	s.BaseURL = strings.TrimSuffix(s.BaseURL, "/")
+	if s.WebDAVPath != "" {
+		s.WebDAVPath = "/" + strings.Trim(s.WebDAVPath, "/")
+	}
 }
 
 func (s *Server) GetTokenExpirationTime(fallback time.Duration) time.Duration {
@@ -70,6 +230,196 @@ func (s *Server) GetTokenExpirationTime(fallback time.Duration) time.Duration {
 	return duration
 }
 
+// DefaultThumbnailSize and DefaultPreviewSize are the sizes of the previews
+// when the server doesn't set them.
+const (
+	DefaultThumbnailSize = 256
+	DefaultPreviewSize   = 1080
+)
+
+// GetThumbnailSize returns the size of the square thumbnails of the
+// listings, DefaultThumbnailSize if unset.
+func (s *Server) GetThumbnailSize() int {
+	if s.ThumbnailSize <= 0 {
+		return DefaultThumbnailSize
+	}
+	return s.ThumbnailSize
+}
+
+// DefaultCompressionMinSize is the size of the smallest responses
+// compressed by default, under which compressing them isn't worth it.
+const DefaultCompressionMinSize = 1024
+
+// GetCompressionMinSize returns the size of the smallest responses
+// compressed, DefaultCompressionMinSize if unset.
+func (s *Server) GetCompressionMinSize() int {
+	if s.CompressionMinSize <= 0 {
+		return DefaultCompressionMinSize
+	}
+	return s.CompressionMinSize
+}
+
+// GetPreviewSize returns the size the big previews fit in,
+// DefaultPreviewSize if unset.
+func (s *Server) GetPreviewSize() int {
+	if s.PreviewSize <= 0 {
+		return DefaultPreviewSize
+	}
+	return s.PreviewSize
+}
+
+// GetHookTimeout returns the maximum time a blocking hook can run for. Zero
+// means there is no limit.
+func (s *Server) GetHookTimeout() time.Duration {
+	if s.HookTimeout == "" {
+		return 0
+	}
+
+	duration, err := time.ParseDuration(s.HookTimeout)
+	if err != nil {
+		log.Printf("[WARN] Failed to parse hookTimeout: %v", err)
+		return 0
+	}
+	return duration
+}
+
+// GetHookDedupWindow returns how long identical after hook jobs are skipped
+// for. Zero means they are never skipped.
+func (s *Server) GetHookDedupWindow() time.Duration {
+	if s.HookDedupWindow == "" {
+		return 0
+	}
+
+	duration, err := time.ParseDuration(s.HookDedupWindow)
+	if err != nil {
+		log.Printf("[WARN] Failed to parse hookDedupWindow: %v", err)
+		return 0
+	}
+	return duration
+}
+
+// DefaultMaxHookOutputBytes is the output kept for each stream of a hook
+// command when the server doesn't set a limit.
+const DefaultMaxHookOutputBytes = 1 << 20
+
+// GetMaxHookOutputBytes returns the output kept for each stream of a hook
+// command, zero if there is no limit.
+func (s *Server) GetMaxHookOutputBytes() int64 {
+	switch {
+	case s.MaxHookOutputBytes == 0:
+		return DefaultMaxHookOutputBytes
+	case s.MaxHookOutputBytes < 0:
+		return 0
+	default:
+		return s.MaxHookOutputBytes
+	}
+}
+
+// DefaultLoginMaxAttempts and DefaultLoginMaxAttemptsPerIP are the failed
+// logins before a lockout, and DefaultLoginLockout how long it lasts and
+// how long the failures are counted for, when the server doesn't set them.
+const (
+	DefaultLoginMaxAttempts      = 5
+	DefaultLoginMaxAttemptsPerIP = 20
+	DefaultLoginLockout          = 15 * time.Minute
+)
+
+// GetLoginMaxAttempts returns the failed logins of a username before it's
+// locked out, zero if it never is.
+func (s *Server) GetLoginMaxAttempts() int {
+	return countOrDefault(s.LoginMaxAttempts, DefaultLoginMaxAttempts)
+}
+
+// GetLoginMaxAttemptsPerIP returns the failed logins from an IP before it's
+// locked out, zero if it never is.
+func (s *Server) GetLoginMaxAttemptsPerIP() int {
+	return countOrDefault(s.LoginMaxAttemptsPerIP, DefaultLoginMaxAttemptsPerIP)
+}
+
+// countOrDefault returns fallback for zero, and zero for the negative
+// values, which disable what they count.
+func countOrDefault(value, fallback int) int {
+	switch {
+	case value == 0:
+		return fallback
+	case value < 0:
+		return 0
+	default:
+		return value
+	}
+}
+
+// GetLoginAttemptWindow returns how long the failed logins are counted for.
+func (s *Server) GetLoginAttemptWindow() time.Duration {
+	return parseLoginDuration("loginAttemptWindow", s.LoginAttemptWindow)
+}
+
+// The default retries of the webhook deliveries, and the time before the
+// first one.
+const (
+	DefaultWebhookRetries = 3
+	DefaultWebhookBackoff = time.Second
+)
+
+// GetWebhookRetries returns how many times a failed webhook delivery is
+// retried, zero if it never is.
+func (s *Server) GetWebhookRetries() int {
+	return countOrDefault(s.WebhookRetries, DefaultWebhookRetries)
+}
+
+// GetWebhookBackoff returns the time before the first retry of a webhook
+// delivery, doubled for each of the next ones.
+func (s *Server) GetWebhookBackoff() time.Duration {
+	if s.WebhookBackoff == "" {
+		return DefaultWebhookBackoff
+	}
+
+	duration, err := time.ParseDuration(s.WebhookBackoff)
+	if err != nil || duration <= 0 {
+		log.Printf("[WARN] Failed to parse webhookBackoff: %q", s.WebhookBackoff)
+		return DefaultWebhookBackoff
+	}
+	return duration
+}
+
+// DefaultDirSizesInterval is how often the sizes of the directories are
+// computed again, when no interval is set.
+const DefaultDirSizesInterval = time.Hour
+
+// GetDirSizesInterval returns how often the sizes of the directories are
+// computed again, to fix the drift of the changes made out of the server.
+func (s *Server) GetDirSizesInterval() time.Duration {
+	if s.DirSizesInterval == "" {
+		return DefaultDirSizesInterval
+	}
+
+	duration, err := time.ParseDuration(s.DirSizesInterval)
+	if err != nil || duration <= 0 {
+		log.Printf("[WARN] Failed to parse dirSizesInterval: %q", s.DirSizesInterval)
+		return DefaultDirSizesInterval
+	}
+	return duration
+}
+
+// GetLoginLockout returns how long the usernames and the IPs with too many
+// failed logins are locked out for, before any backoff.
+func (s *Server) GetLoginLockout() time.Duration {
+	return parseLoginDuration("loginLockout", s.LoginLockout)
+}
+
+func parseLoginDuration(name, value string) time.Duration {
+	if value == "" {
+		return DefaultLoginLockout
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("[WARN] Failed to parse %s: %q", name, value)
+		return DefaultLoginLockout
+	}
+	return duration
+}
+
 // GenerateKey generates a key of 512 bits.
 func GenerateKey() ([]byte, error) {
 	b := make([]byte, 64) //nolint:gomnd
@@ -0,0 +1,174 @@
+package settings
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// The algorithms the tokens can be signed with.
+const (
+	SigningHS256 = "HS256"
+	SigningRS256 = "RS256"
+	SigningES256 = "ES256"
+)
+
+// rsaKeyBits is the size of the RS256 keys.
+const rsaKeyBits = 2048
+
+// SigningKey is a key the tokens are signed with, which they name in their
+// kid header.
+type SigningKey struct {
+	ID        string `json:"id"`
+	Algorithm string `json:"algorithm"`
+	// Secret is the secret of the HS256 keys, or the PKCS #8 private key of
+	// the others.
+	Secret  []byte    `json:"secret"`
+	Created time.Time `json:"created"`
+	// Expires is when a key that was rotated stops verifying the tokens it
+	// signed. It's zero for the current key.
+	Expires time.Time `json:"expires"`
+}
+
+// NewSigningKey generates a key of an algorithm, HS256 if empty.
+func NewSigningKey(algorithm string) (SigningKey, error) {
+	if algorithm == "" {
+		algorithm = SigningHS256
+	}
+
+	id := make([]byte, 8) //nolint:gomnd
+	if _, err := rand.Read(id); err != nil {
+		return SigningKey{}, err
+	}
+	key := SigningKey{ID: hex.EncodeToString(id), Algorithm: algorithm, Created: time.Now().UTC()}
+
+	var private interface{}
+	var err error
+	switch algorithm {
+	case SigningHS256:
+		key.Secret = make([]byte, 64) //nolint:gomnd
+		_, err = rand.Read(key.Secret)
+		return key, err
+	case SigningRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case SigningES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return SigningKey{}, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	key.Secret, err = x509.MarshalPKCS8PrivateKey(private)
+	return key, err
+}
+
+// SignKey returns the key to sign with, the secret of HS256 or the private
+// key of the others.
+func (k *SigningKey) SignKey() (interface{}, error) {
+	if k.Algorithm == SigningHS256 {
+		return k.Secret, nil
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(k.Secret)
+	if err != nil {
+		return nil, err
+	}
+	switch private.(type) {
+	case *rsa.PrivateKey:
+		if k.Algorithm != SigningRS256 {
+			return nil, fmt.Errorf("key %s is not a %s key", k.ID, k.Algorithm)
+		}
+	case *ecdsa.PrivateKey:
+		if k.Algorithm != SigningES256 {
+			return nil, fmt.Errorf("key %s is not a %s key", k.ID, k.Algorithm)
+		}
+	default:
+		return nil, fmt.Errorf("key %s has an unsupported type", k.ID)
+	}
+	return private, nil
+}
+
+// VerifyKey returns the key to verify with, the secret of HS256 or the
+// public key of the others.
+func (k *SigningKey) VerifyKey() (interface{}, error) {
+	key, err := k.SignKey()
+	if err != nil || k.Algorithm == SigningHS256 {
+		return key, err
+	}
+	return key.(crypto.Signer).Public(), nil
+}
+
+// CurrentSigningKey returns the key the tokens are signed with. Until the
+// keys are first rotated, it's the HS256 key of the settings, which names no
+// kid.
+func (s *Settings) CurrentSigningKey() SigningKey {
+	for i := len(s.SigningKeys) - 1; i >= 0; i-- {
+		if s.SigningKeys[i].Expires.IsZero() {
+			return s.SigningKeys[i]
+		}
+	}
+	return SigningKey{Algorithm: SigningHS256, Secret: s.Key}
+}
+
+// VerifyingKey returns the key of a kid that still verifies the tokens.
+func (s *Settings) VerifyingKey(id string, now time.Time) (SigningKey, bool) {
+	if len(s.SigningKeys) == 0 && id == "" {
+		return s.CurrentSigningKey(), true
+	}
+	for _, k := range s.SigningKeys {
+		if k.ID == id && (k.Expires.IsZero() || now.Before(k.Expires)) {
+			return k, true
+		}
+	}
+	return SigningKey{}, false
+}
+
+// RotateSigningKey makes a new key of an algorithm, the one of the current
+// key if empty, the current one. The previous key keeps verifying the tokens
+// it signed for the overlap, and the keys past their overlap are forgotten.
+func (s *Settings) RotateSigningKey(algorithm string, overlap time.Duration, now time.Time) (SigningKey, error) {
+	if algorithm == "" {
+		algorithm = s.CurrentSigningKey().Algorithm
+	}
+	key, err := NewSigningKey(algorithm)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	keys := s.SigningKeys
+	if len(keys) == 0 {
+		// the tokens signed before the first rotation are verified with
+		// the settings key, and name no kid
+		keys = []SigningKey{s.CurrentSigningKey()}
+	}
+
+	s.SigningKeys = []SigningKey{}
+	for _, k := range keys {
+		if k.Expires.IsZero() {
+			k.Expires = now.Add(overlap)
+		}
+		if now.Before(k.Expires) {
+			s.SigningKeys = append(s.SigningKeys, k)
+		}
+	}
+	s.SigningKeys = append(s.SigningKeys, key)
+	return key, nil
+}
+
+// validateSigningKeys checks that the keys can sign and verify the tokens.
+func validateSigningKeys(keys []SigningKey) error {
+	for i := range keys {
+		if _, err := keys[i].SignKey(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
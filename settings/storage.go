@@ -1,6 +1,8 @@
 package settings
 
 import (
+	"fmt"
+
 	"github.com/filebrowser/filebrowser/v2/errors"
 	"github.com/filebrowser/filebrowser/v2/rules"
 	"github.com/filebrowser/filebrowser/v2/users"
@@ -42,16 +44,46 @@ func (s *Storage) Get() (*Settings, error) {
 	return set, nil
 }
 
-var defaultEvents = []string{
+// HookEvents are the operations the hooks can run for, as before_, after_
+// and finally_ events.
+var HookEvents = []string{
 	"save",
 	"copy",
 	"rename",
+	"move",
 	"upload",
 	"delete",
+	"download",
+	"restore",
+	"trash",
 }
 
-// Save saves the settings for the current instance.
+// Save saves the settings for the current instance, once they're valid
+// with each of their profiles too.
 func (s *Storage) Save(set *Settings) error {
+	if err := cleanSettings(set); err != nil {
+		return err
+	}
+
+	for name := range set.Profiles {
+		if name == "" {
+			return fmt.Errorf("%w: a settings profile has no name", errors.ErrInvalidOption)
+		}
+		merged, err := set.WithProfile(name)
+		if err != nil {
+			return err
+		}
+		if err := cleanSettings(merged); err != nil {
+			return fmt.Errorf("settings profile %q: %w", name, err)
+		}
+	}
+
+	return s.back.Save(set)
+}
+
+// cleanSettings fills the settings that aren't set with their defaults and
+// validates them.
+func cleanSettings(set *Settings) error {
 	if len(set.Key) == 0 {
 		return errors.ErrEmptyKey
 	}
@@ -68,31 +100,69 @@ func (s *Storage) Save(set *Settings) error {
 		set.Defaults.ViewMode = users.MosaicViewMode
 	}
 
+	if set.Defaults.Rules == nil {
+		set.Defaults.Rules = []rules.Rule{}
+	}
+
+	if err := set.Defaults.Validate(); err != nil {
+		return err
+	}
+
 	if set.Rules == nil {
 		set.Rules = []rules.Rule{}
 	}
 
+	if err := rules.Validate(set.Rules); err != nil {
+		return err
+	}
+
+	if err := validateSigningKeys(set.SigningKeys); err != nil {
+		return err
+	}
+
+	if err := users.ValidateSymlinkPolicy(set.SymlinkPolicy); err != nil {
+		return err
+	}
+
+	mimeTypes, err := cleanMimeTypes(set.MimeTypes)
+	if err != nil {
+		return err
+	}
+	set.MimeTypes = mimeTypes
+
+	if set.SearchExclude == nil {
+		set.SearchExclude = []string{}
+	}
+
 	if set.Shell == nil {
 		set.Shell = []string{}
 	}
 
 	if set.Commands == nil {
-		set.Commands = map[string][]string{}
+		set.Commands = map[string][]HookCommand{}
+	}
+
+	if set.CommandTemplates == nil {
+		set.CommandTemplates = map[string]CommandTemplate{}
 	}
 
-	for _, event := range defaultEvents {
+	for _, event := range HookEvents {
 		if _, ok := set.Commands["before_"+event]; !ok {
-			set.Commands["before_"+event] = []string{}
+			set.Commands["before_"+event] = []HookCommand{}
 		}
 
 		if _, ok := set.Commands["after_"+event]; !ok {
-			set.Commands["after_"+event] = []string{}
+			set.Commands["after_"+event] = []HookCommand{}
+		}
+
+		if _, ok := set.Commands["finally_"+event]; !ok {
+			set.Commands["finally_"+event] = []HookCommand{}
 		}
 	}
 
-	err := s.back.Save(set)
-	if err != nil {
-		return err
+	// the listings only have before hooks, see runner.ListingEvent
+	if _, ok := set.Commands["before_listing"]; !ok {
+		set.Commands["before_listing"] = []HookCommand{}
 	}
 
 	return nil
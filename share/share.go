@@ -1,9 +1,14 @@
 package share
 
 type CreateBody struct {
-	Password string `json:"password"`
-	Expires  string `json:"expires"`
-	Unit     string `json:"unit"`
+	Password     string `json:"password"`
+	Expires      string `json:"expires"`
+	Unit         string `json:"unit"`
+	MaxDownloads int    `json:"maxDownloads"`
+	// MaxRequestsPerMinute and MaxBandwidth are the limits of the share,
+	// see Link.
+	MaxRequestsPerMinute int   `json:"maxRequestsPerMinute"`
+	MaxBandwidth         int64 `json:"maxBandwidth"`
 }
 
 // Link is the information needed to build a shareable link.
@@ -17,4 +22,18 @@ type Link struct {
 	// URL-Safe and is used to download links in password-protected shares via a
 	// query arg.
 	Token string `json:"token,omitempty"`
+	// MaxDownloads is how many times the share can be downloaded, without
+	// limit if zero. Downloads counts them.
+	MaxDownloads int `json:"maxDownloads,omitempty"`
+	Downloads    int `json:"downloads,omitempty"`
+	// MaxRequestsPerMinute limits the requests to the share, and
+	// MaxBandwidth the bytes per second downloaded from it. Zero means no
+	// limit.
+	MaxRequestsPerMinute int   `json:"maxRequestsPerMinute,omitempty"`
+	MaxBandwidth         int64 `json:"maxBandwidth,omitempty"`
+}
+
+// Exhausted tells if the share has no downloads left.
+func (l *Link) Exhausted() bool {
+	return l.MaxDownloads > 0 && l.Downloads >= l.MaxDownloads
 }
@@ -15,6 +15,12 @@ type StorageBackend interface {
 	Gets(path string, id uint) ([]*Link, error)
 	Save(s *Link) error
 	Delete(hash string) error
+	// UseDownload counts a download of a share atomically, failing with
+	// errors.ErrShareExhausted if it has none left.
+	UseDownload(hash string) (*Link, error)
+	// ReturnDownload gives back a download counted by UseDownload, for the
+	// ones that failed.
+	ReturnDownload(hash string) error
 }
 
 // Storage is a storage.
@@ -114,6 +120,16 @@ func (s *Storage) Save(l *Link) error {
 	return s.back.Save(l)
 }
 
+// UseDownload wraps a StorageBackend.UseDownload
+func (s *Storage) UseDownload(hash string) (*Link, error) {
+	return s.back.UseDownload(hash)
+}
+
+// ReturnDownload wraps a StorageBackend.ReturnDownload
+func (s *Storage) ReturnDownload(hash string) error {
+	return s.back.ReturnDownload(hash)
+}
+
 // Delete wraps a StorageBackend.Delete
 func (s *Storage) Delete(hash string) error {
 	return s.back.Delete(hash)
@@ -24,6 +24,10 @@ func (s authBackend) Get(t settings.AuthMethod) (auth.Auther, error) {
 		auther = &auth.HookAuth{}
 	case auth.MethodNoAuth:
 		auther = &auth.NoAuth{}
+	case auth.MethodWebAuthn:
+		auther = &auth.WebAuthnAuth{}
+	case auth.MethodOIDC:
+		auther = &auth.OIDCAuth{}
 	default:
 		return nil, errors.ErrInvalidAuthMethod
 	}
@@ -0,0 +1,28 @@
+package bolt
+
+import (
+	"io"
+
+	"github.com/asdine/storm/v3"
+	bolt "go.etcd.io/bbolt"
+)
+
+type backupBackend struct {
+	db *storm.DB
+}
+
+func (s backupBackend) Backup(w io.Writer) (int64, error) {
+	return Backup(s.db, w)
+}
+
+// Backup writes a snapshot of a database in a read transaction, which sees
+// a consistent state of it without blocking the writes.
+func Backup(db *storm.DB, w io.Writer) (int64, error) {
+	var n int64
+	err := db.Bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
@@ -1,23 +1,79 @@
 package bolt
 
 import (
+	"errors"
+
 	"github.com/asdine/storm/v3"
 
 	"github.com/filebrowser/filebrowser/v2/auth"
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/rules"
+	"github.com/filebrowser/filebrowser/v2/session"
 	"github.com/filebrowser/filebrowser/v2/settings"
 	"github.com/filebrowser/filebrowser/v2/share"
 	"github.com/filebrowser/filebrowser/v2/storage"
+	"github.com/filebrowser/filebrowser/v2/tokens"
 	"github.com/filebrowser/filebrowser/v2/users"
 )
 
+// version is the version of the database, the older ones being migrated
+// when opened.
+const version = defaultsVersion
+
+// rolesVersion is the first version with the roles.
+const rolesVersion = 3
+
+// ruleTypesVersion is the first version whose rules have a type.
+const ruleTypesVersion = 4
+
+// defaultsVersion is the first version whose defaults of the new users have
+// rules.
+const defaultsVersion = 5
+
 // NewStorage creates a storage.Storage based on Bolt DB.
 func NewStorage(db *storm.DB) (*storage.Storage, error) {
-	userStore := users.NewStorage(usersBackend{db: db})
-	shareStore := share.NewStorage(shareBackend{db: db})
+	roleStore := users.NewRoleStorage(rolesBackend{db: db})
 	settingsStore := settings.NewStorage(settingsBackend{db: db})
+	userStore := users.NewStorage(usersBackend{db: db}, roleStore, func() (string, error) {
+		set, err := settingsStore.Get()
+		if errors.Is(err, fbErrors.ErrNotExist) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return set.SymlinkPolicy, nil
+	})
+	shareStore := share.NewStorage(shareBackend{db: db})
+	sessionStore := session.NewStorage(sessionBackend{db: db})
+	tokenStore := tokens.NewStorage(tokenBackend{db: db})
 	authStore := auth.NewStorage(authBackend{db: db}, userStore)
 
-	err := save(db, "version", 2)
+	var current int
+	err := get(db, "version", &current)
+	if err != nil && !errors.Is(err, fbErrors.ErrNotExist) {
+		return nil, err
+	}
+
+	if current < rolesVersion {
+		if err := migrateRoles(userStore, roleStore, settingsStore); err != nil {
+			return nil, err
+		}
+	}
+
+	if current < ruleTypesVersion {
+		if err := migrateRuleTypes(db); err != nil {
+			return nil, err
+		}
+	}
+
+	if current < defaultsVersion {
+		if err := migrateDefaults(db); err != nil {
+			return nil, err
+		}
+	}
+
+	err = save(db, "version", version)
 	if err != nil {
 		return nil, err
 	}
@@ -25,7 +81,113 @@ func NewStorage(db *storm.DB) (*storage.Storage, error) {
 	return &storage.Storage{
 		Auth:     authStore,
 		Users:    userStore,
+		Roles:    roleStore,
 		Share:    shareStore,
+		Sessions: sessionStore,
+		Tokens:   tokenStore,
 		Settings: settingsStore,
+		DB:       backupBackend{db: db},
 	}, nil
 }
+
+// migrateRoles puts the users of the databases that had no roles in a
+// default role with the default permissions, their own permissions being
+// kept as overrides.
+func migrateRoles(userStore *users.Storage, roleStore *users.RoleStorage, settingsStore *settings.Storage) error {
+	all, err := userStore.Gets("")
+	if errors.Is(err, fbErrors.ErrNotExist) {
+		return nil
+	}
+	if err != nil || len(all) == 0 {
+		return err
+	}
+
+	role := &users.Role{Name: "default"}
+	if set, err := settingsStore.Get(); err == nil {
+		role.Perm = set.Defaults.Perm
+	}
+	if err := roleStore.Save(role); err != nil {
+		return err
+	}
+
+	for _, u := range all {
+		if u.Role != 0 {
+			continue
+		}
+		u.Role = role.ID
+		if err := userStore.Update(u, "Role"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateRuleTypes gives their type to the rules of the settings and the
+// users, which told only if they were regexes. The backends are used as is
+// not to reject the rules that are invalid.
+func migrateRuleTypes(db *storm.DB) error {
+	setBack := settingsBackend{db: db}
+	set, err := setBack.Get()
+	if err != nil && !errors.Is(err, fbErrors.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		typeRules(set.Rules)
+		if err := setBack.Save(set); err != nil {
+			return err
+		}
+	}
+
+	userBack := usersBackend{db: db}
+	all, err := userBack.Gets()
+	if errors.Is(err, fbErrors.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, u := range all {
+		if len(u.Rules) == 0 {
+			continue
+		}
+		typeRules(u.Rules)
+		if err := userBack.Update(u, "Rules"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateDefaults completes the defaults of the new users of the settings
+// with the fields they didn't have, such as their rules.
+func migrateDefaults(db *storm.DB) error {
+	setBack := settingsBackend{db: db}
+	set, err := setBack.Get()
+	if errors.Is(err, fbErrors.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if set.Defaults.Locale == "" {
+		set.Defaults.Locale = "en"
+	}
+	if set.Defaults.Commands == nil {
+		set.Defaults.Commands = []string{}
+	}
+	if set.Defaults.Rules == nil {
+		set.Defaults.Rules = []rules.Rule{}
+	}
+	typeRules(set.Defaults.Rules)
+	return setBack.Save(set)
+}
+
+func typeRules(list []rules.Rule) {
+	for i := range list {
+		list[i].Type = list[i].Kind()
+	}
+}
@@ -0,0 +1,50 @@
+package bolt
+
+import (
+	"errors"
+
+	"github.com/asdine/storm/v3"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+type rolesBackend struct {
+	db *storm.DB
+}
+
+func (s rolesBackend) Get(id uint) (*users.Role, error) {
+	var v users.Role
+	err := s.db.One("ID", id, &v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil, fbErrors.ErrNotExist
+	}
+
+	return &v, err
+}
+
+func (s rolesBackend) Gets() ([]*users.Role, error) {
+	var v []*users.Role
+	err := s.db.All(&v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return v, nil
+	}
+
+	return v, err
+}
+
+func (s rolesBackend) Save(r *users.Role) error {
+	err := s.db.Save(r)
+	if errors.Is(err, storm.ErrAlreadyExists) {
+		return fbErrors.ErrExist
+	}
+	return err
+}
+
+func (s rolesBackend) Delete(id uint) error {
+	err := s.db.DeleteStruct(&users.Role{ID: id})
+	if errors.Is(err, storm.ErrNotFound) {
+		return fbErrors.ErrNotExist
+	}
+	return err
+}
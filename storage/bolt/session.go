@@ -0,0 +1,55 @@
+package bolt
+
+import (
+	"errors"
+
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/session"
+)
+
+type sessionBackend struct {
+	db *storm.DB
+}
+
+func (s sessionBackend) FindByUserID(id uint) ([]*session.Session, error) {
+	var v []*session.Session
+	err := s.db.Select(q.Eq("UserID", id)).Find(&v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return v, nil
+	}
+
+	return v, err
+}
+
+func (s sessionBackend) Get(id string) (*session.Session, error) {
+	var v session.Session
+	err := s.db.One("ID", id, &v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil, fbErrors.ErrNotExist
+	}
+
+	return &v, err
+}
+
+func (s sessionBackend) Save(sess *session.Session) error {
+	return s.db.Save(sess)
+}
+
+func (s sessionBackend) Delete(id string) error {
+	err := s.db.DeleteStruct(&session.Session{ID: id})
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s sessionBackend) DeleteByUserID(id uint) error {
+	err := s.db.Select(q.Eq("UserID", id)).Delete(&session.Session{})
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil
+	}
+	return err
+}
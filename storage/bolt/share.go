@@ -68,6 +68,63 @@ func (s shareBackend) Save(l *share.Link) error {
 	return s.db.Save(l)
 }
 
+func (s shareBackend) UseDownload(hash string) (*share.Link, error) {
+	// the writable transactions of bolt are serialized, so that two
+	// downloads can't both take the last one
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var v share.Link
+	err = tx.One("Hash", hash, &v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil, fbErrors.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if v.Exhausted() {
+		return nil, fbErrors.ErrShareExhausted
+	}
+
+	v.Downloads++
+	if err := tx.Save(&v); err != nil {
+		return nil, err
+	}
+
+	return &v, tx.Commit()
+}
+
+func (s shareBackend) ReturnDownload(hash string) error {
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var v share.Link
+	err = tx.One("Hash", hash, &v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return fbErrors.ErrNotExist
+	}
+	if err != nil {
+		return err
+	}
+
+	if v.Downloads == 0 {
+		return nil
+	}
+	v.Downloads--
+	if err := tx.Save(&v); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (s shareBackend) Delete(hash string) error {
 	err := s.db.DeleteStruct(&share.Link{Hash: hash})
 	if errors.Is(err, storm.ErrNotFound) {
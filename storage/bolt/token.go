@@ -0,0 +1,55 @@
+package bolt
+
+import (
+	"errors"
+
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/tokens"
+)
+
+type tokenBackend struct {
+	db *storm.DB
+}
+
+func (s tokenBackend) FindByUserID(id uint) ([]*tokens.Token, error) {
+	var v []*tokens.Token
+	err := s.db.Select(q.Eq("UserID", id)).Find(&v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return v, nil
+	}
+
+	return v, err
+}
+
+func (s tokenBackend) Get(id string) (*tokens.Token, error) {
+	var v tokens.Token
+	err := s.db.One("ID", id, &v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil, fbErrors.ErrNotExist
+	}
+
+	return &v, err
+}
+
+func (s tokenBackend) Save(tok *tokens.Token) error {
+	return s.db.Save(tok)
+}
+
+func (s tokenBackend) Delete(id string) error {
+	err := s.db.DeleteStruct(&tokens.Token{ID: id})
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s tokenBackend) DeleteByUserID(id uint) error {
+	err := s.db.Select(q.Eq("UserID", id)).Delete(&tokens.Token{})
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil
+	}
+	return err
+}
@@ -1,9 +1,13 @@
 package storage
 
 import (
+	"io"
+
 	"github.com/filebrowser/filebrowser/v2/auth"
+	"github.com/filebrowser/filebrowser/v2/session"
 	"github.com/filebrowser/filebrowser/v2/settings"
 	"github.com/filebrowser/filebrowser/v2/share"
+	"github.com/filebrowser/filebrowser/v2/tokens"
 	"github.com/filebrowser/filebrowser/v2/users"
 )
 
@@ -11,7 +15,17 @@ import (
 // verifications when fetching and saving data to ensure consistency.
 type Storage struct {
 	Users    users.Store
+	Roles    *users.RoleStorage
 	Share    *share.Storage
+	Sessions *session.Storage
+	Tokens   *tokens.Storage
 	Auth     *auth.Storage
 	Settings *settings.Storage
+	DB       Backuper
+}
+
+// Backuper writes a consistent snapshot of the whole database, while it's
+// being used.
+type Backuper interface {
+	Backup(w io.Writer) (int64, error)
 }
@@ -0,0 +1,78 @@
+package tokens
+
+import (
+	"github.com/filebrowser/filebrowser/v2/errors"
+)
+
+// StorageBackend is the interface to implement for a token storage.
+type StorageBackend interface {
+	FindByUserID(id uint) ([]*Token, error)
+	Get(id string) (*Token, error)
+	Save(s *Token) error
+	Delete(id string) error
+	DeleteByUserID(id uint) error
+}
+
+// Storage is a storage.
+type Storage struct {
+	back StorageBackend
+}
+
+// NewStorage creates a token storage from a backend.
+func NewStorage(back StorageBackend) *Storage {
+	return &Storage{back: back}
+}
+
+// FindByUserID wraps a StorageBackend.FindByUserID, deleting the expired
+// tokens.
+func (s *Storage) FindByUserID(id uint) ([]*Token, error) {
+	tokens, err := s.back.FindByUserID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	active := tokens[:0]
+	for _, tok := range tokens {
+		if !tok.Expired() {
+			active = append(active, tok)
+			continue
+		}
+		if err := s.Delete(tok.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return active, nil
+}
+
+// Get wraps a StorageBackend.Get.
+func (s *Storage) Get(id string) (*Token, error) {
+	tok, err := s.back.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok.Expired() {
+		if err := s.Delete(tok.ID); err != nil {
+			return nil, err
+		}
+		return nil, errors.ErrNotExist
+	}
+
+	return tok, nil
+}
+
+// Save wraps a StorageBackend.Save.
+func (s *Storage) Save(tok *Token) error {
+	return s.back.Save(tok)
+}
+
+// Delete wraps a StorageBackend.Delete.
+func (s *Storage) Delete(id string) error {
+	return s.back.Delete(id)
+}
+
+// DeleteByUserID wraps a StorageBackend.DeleteByUserID.
+func (s *Storage) DeleteByUserID(id uint) error {
+	return s.back.DeleteByUserID(id)
+}
@@ -0,0 +1,89 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/filebrowser/filebrowser/v2/users"
+)
+
+// Prefix starts the API tokens, telling them apart from the JWTs of the
+// logins.
+const Prefix = "fb_"
+
+// The lengths of the encoded ID and secret of a token.
+const (
+	idLength     = 12
+	secretLength = 43
+)
+
+// Token is a personal access token of a user, for the scripts. It grants a
+// subset of the permissions of the user, on a directory of its scope, until
+// it's revoked or it expires. Only the hash of its secret is kept.
+type Token struct {
+	ID     string `json:"id" storm:"id,index"`
+	UserID uint   `json:"userID" storm:"index"`
+	Name   string `json:"name"`
+	Hash   string `json:"hash"`
+	// Perm are the permissions granted, the ones the user doesn't have
+	// anymore being left out.
+	Perm users.Permissions `json:"perm"`
+	// Scope is the directory of the scope of the user the token is
+	// restricted to, "/" for all of it.
+	Scope    string `json:"scope"`
+	Created  int64  `json:"created"`
+	LastUsed int64  `json:"lastUsed"`
+	LastIP   string `json:"lastIP"`
+	Expire   int64  `json:"expire"`
+}
+
+// New returns a token of a user with its secret, the plain text of the token
+// which is only shown once.
+func New(userID uint) (*Token, string, error) {
+	raw := make([]byte, 9+32) //nolint:gomnd
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", err
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(raw[:9])
+	plain := Prefix + id + base64.RawURLEncoding.EncodeToString(raw[9:])
+	return &Token{
+		ID:      id,
+		UserID:  userID,
+		Hash:    hash(plain),
+		Scope:   "/",
+		Created: time.Now().Unix(),
+	}, plain, nil
+}
+
+// ParseID returns the ID of the plain text of a token, false if it isn't
+// one.
+func ParseID(plain string) (string, bool) {
+	rest, ok := strings.CutPrefix(plain, Prefix)
+	if !ok || len(rest) != idLength+secretLength {
+		return "", false
+	}
+	return rest[:idLength], true
+}
+
+// Verify tells if the plain text is the one of the token.
+func (t *Token) Verify(plain string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash(plain)), []byte(t.Hash)) == 1
+}
+
+// Expired tells if the token expired.
+func (t *Token) Expired() bool {
+	return t.Expire != 0 && t.Expire <= time.Now().Unix()
+}
+
+// hash returns the hash of the plain text of a token. The secrets are
+// random, a fast hash is enough.
+func hash(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
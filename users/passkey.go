@@ -0,0 +1,33 @@
+package users
+
+import (
+	"bytes"
+	"encoding/base64"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// Passkey is a WebAuthn credential the user can log in with.
+type Passkey struct {
+	Name       string              `json:"name"`
+	Created    time.Time           `json:"created"`
+	Credential webauthn.Credential `json:"credential"`
+}
+
+// ID returns the identifier of the passkey, the base64url encoded ID of its
+// credential.
+func (p Passkey) ID() string {
+	return base64.RawURLEncoding.EncodeToString(p.Credential.ID)
+}
+
+// PasskeyIndex returns the index of the passkey with the given credential
+// ID, -1 if the user has none.
+func (u *User) PasskeyIndex(credentialID []byte) int {
+	for i, passkey := range u.Passkeys {
+		if bytes.Equal(passkey.Credential.ID, credentialID) {
+			return i
+		}
+	}
+	return -1
+}
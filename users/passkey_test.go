@@ -0,0 +1,24 @@
+package users
+
+import (
+	"testing"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+func TestPasskeyIndex(t *testing.T) {
+	u := &User{Passkeys: []Passkey{
+		{Name: "laptop", Credential: webauthn.Credential{ID: []byte{1, 2}}},
+		{Name: "phone", Credential: webauthn.Credential{ID: []byte{3, 4}}},
+	}}
+
+	if i := u.PasskeyIndex([]byte{3, 4}); i != 1 {
+		t.Errorf("expected the second passkey, got %d", i)
+	}
+	if i := u.PasskeyIndex([]byte{5}); i != -1 {
+		t.Errorf("expected no passkey, got %d", i)
+	}
+	if id := u.Passkeys[0].ID(); id != "AQI" {
+		t.Errorf("expected the base64url credential ID, got %q", id)
+	}
+}
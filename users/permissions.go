@@ -11,3 +11,23 @@ type Permissions struct {
 	Share    bool `json:"share"`
 	Download bool `json:"download"`
 }
+
+// ReadOnly returns the permissions left to the user when the server is read
+// only, without the ones changing the files or running commands.
+func (p Permissions) ReadOnly() Permissions {
+	return Permissions{Admin: p.Admin, Share: p.Share, Download: p.Download}
+}
+
+// Intersect returns the permissions granted by both p and other.
+func (p Permissions) Intersect(other Permissions) Permissions {
+	return Permissions{
+		Admin:    p.Admin && other.Admin,
+		Execute:  p.Execute && other.Execute,
+		Create:   p.Create && other.Create,
+		Rename:   p.Rename && other.Rename,
+		Modify:   p.Modify && other.Modify,
+		Delete:   p.Delete && other.Delete,
+		Share:    p.Share && other.Share,
+		Download: p.Download && other.Download,
+	}
+}
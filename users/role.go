@@ -0,0 +1,97 @@
+package users
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/filebrowser/filebrowser/v2/errors"
+)
+
+// Role is a named set of permissions shared by users. The permissions of
+// a user of a role are the ones of the role, overridden by the
+// PermOverrides of the user.
+type Role struct {
+	ID   uint        `storm:"id,increment" json:"id"`
+	Name string      `storm:"unique" json:"name"`
+	Perm Permissions `json:"perm"`
+	// Scope is the template of the scope of the users created with the
+	// role and no scope, {username} being replaced by their username.
+	Scope string `json:"scope"`
+}
+
+// UserScope returns the scope of a new user of the role.
+func (r *Role) UserScope(username string) string {
+	return strings.ReplaceAll(r.Scope, "{username}", username)
+}
+
+// Overrides returns the permissions of p that differ from base, by their
+// JSON name.
+func (p Permissions) Overrides(base Permissions) map[string]bool {
+	overrides := map[string]bool{}
+
+	v, b := reflect.ValueOf(p), reflect.ValueOf(base)
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).Bool() != b.Field(i).Bool() {
+			overrides[permName(v.Type().Field(i))] = v.Field(i).Bool()
+		}
+	}
+
+	return overrides
+}
+
+// Override returns the permissions of p with the overrides applied.
+func (p Permissions) Override(overrides map[string]bool) Permissions {
+	v := reflect.ValueOf(&p).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if perm, ok := overrides[permName(v.Type().Field(i))]; ok {
+			v.Field(i).SetBool(perm)
+		}
+	}
+
+	return p
+}
+
+func permName(field reflect.StructField) string {
+	return field.Tag.Get("json")
+}
+
+// RoleStorageBackend is the interface to implement for a roles storage.
+type RoleStorageBackend interface {
+	Get(id uint) (*Role, error)
+	Gets() ([]*Role, error)
+	Save(r *Role) error
+	Delete(id uint) error
+}
+
+// RoleStorage is a roles storage.
+type RoleStorage struct {
+	back RoleStorageBackend
+}
+
+// NewRoleStorage creates a roles storage from a backend.
+func NewRoleStorage(back RoleStorageBackend) *RoleStorage {
+	return &RoleStorage{back: back}
+}
+
+// Get wraps a RoleStorageBackend.Get.
+func (s *RoleStorage) Get(id uint) (*Role, error) {
+	return s.back.Get(id)
+}
+
+// Gets wraps a RoleStorageBackend.Gets.
+func (s *RoleStorage) Gets() ([]*Role, error) {
+	return s.back.Gets()
+}
+
+// Save saves a role, which must have a name.
+func (s *RoleStorage) Save(r *Role) error {
+	if r.Name == "" {
+		return errors.ErrEmptyRoleName
+	}
+	return s.back.Save(r)
+}
+
+// Delete wraps a RoleStorageBackend.Delete.
+func (s *RoleStorage) Delete(id uint) error {
+	return s.back.Delete(id)
+}
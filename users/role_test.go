@@ -0,0 +1,34 @@
+package users
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPermissionsOverrides(t *testing.T) {
+	role := Permissions{Create: true, Rename: true, Download: true}
+	user := Permissions{Create: true, Delete: true, Download: false}
+
+	overrides := user.Overrides(role)
+	want := map[string]bool{"rename": false, "delete": true, "download": false}
+	if !reflect.DeepEqual(overrides, want) {
+		t.Errorf("expected the overrides %v, got %v", want, overrides)
+	}
+
+	if got := role.Override(overrides); got != user {
+		t.Errorf("expected the overridden permissions %+v, got %+v", user, got)
+	}
+
+	// the permissions that aren't overridden follow the role
+	role.Share = true
+	if got := role.Override(overrides); !got.Share || got.Rename {
+		t.Errorf("expected the share permission of the role only, got %+v", got)
+	}
+}
+
+func TestRoleUserScope(t *testing.T) {
+	role := &Role{Scope: "/users/{username}"}
+	if scope := role.UserScope("alice"); scope != "/users/alice" {
+		t.Errorf("expected /users/alice, got %s", scope)
+	}
+}
@@ -1,10 +1,12 @@
 package users
 
 import (
+	"errors"
 	"sync"
 	"time"
 
-	"github.com/filebrowser/filebrowser/v2/errors"
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+	"github.com/filebrowser/filebrowser/v2/rules"
 )
 
 // StorageBackend is the interface to implement for a users storage.
@@ -28,16 +30,22 @@ type Store interface {
 
 // Storage is a users storage.
 type Storage struct {
-	back    StorageBackend
-	updated map[uint]int64
-	mux     sync.RWMutex
+	back          StorageBackend
+	roles         *RoleStorage
+	symlinkPolicy func() (string, error)
+	updated       map[uint]int64
+	mux           sync.RWMutex
 }
 
-// NewStorage creates a users storage from a backend.
-func NewStorage(back StorageBackend) *Storage {
+// NewStorage creates a users storage from a backend, the permissions of
+// the users being resolved with their role. The file systems of the users
+// enforce the symlink policy returned by symlinkPolicy, if not nil.
+func NewStorage(back StorageBackend, roles *RoleStorage, symlinkPolicy func() (string, error)) *Storage {
 	return &Storage{
-		back:    back,
-		updated: map[uint]int64{},
+		back:          back,
+		roles:         roles,
+		symlinkPolicy: symlinkPolicy,
+		updated:       map[uint]int64{},
 	}
 }
 
@@ -49,20 +57,42 @@ func (s *Storage) Get(baseScope string, id interface{}) (user *User, err error)
 	if err != nil {
 		return
 	}
+	if err := s.resolve(user); err != nil {
+		return nil, err
+	}
+	if user.symlinkPolicy, err = s.policy(); err != nil {
+		return nil, err
+	}
 	if err := user.Clean(baseScope); err != nil {
 		return nil, err
 	}
 	return
 }
 
+// policy returns the symlink policy of the file systems of the users.
+func (s *Storage) policy() (string, error) {
+	if s.symlinkPolicy == nil {
+		return "", nil
+	}
+	return s.symlinkPolicy()
+}
+
 // Gets gets a list of all users.
 func (s *Storage) Gets(baseScope string) ([]*User, error) {
 	users, err := s.back.Gets()
 	if err != nil {
 		return nil, err
 	}
+	policy, err := s.policy()
+	if err != nil {
+		return nil, err
+	}
 
 	for _, user := range users {
+		if err := s.resolve(user); err != nil {
+			return nil, err
+		}
+		user.symlinkPolicy = policy
 		if err := user.Clean(baseScope); err != nil { //nolint:govet
 			return nil, err
 		}
@@ -78,6 +108,21 @@ func (s *Storage) Update(user *User, fields ...string) error {
 		return err
 	}
 
+	if len(fields) == 0 || contains(fields, "Rules") {
+		if err = rules.Validate(user.Rules); err != nil {
+			return err
+		}
+	}
+
+	if len(fields) == 0 || contains(fields, "Perm") || contains(fields, "Role") {
+		if err = s.overrides(user); err != nil {
+			return err
+		}
+		if len(fields) > 0 && !contains(fields, "PermOverrides") {
+			fields = append(fields, "PermOverrides")
+		}
+	}
+
 	err = s.back.Update(user, fields...)
 	if err != nil {
 		return err
@@ -95,6 +140,14 @@ func (s *Storage) Save(user *User) error {
 		return err
 	}
 
+	if err := rules.Validate(user.Rules); err != nil {
+		return err
+	}
+
+	if err := s.overrides(user); err != nil {
+		return err
+	}
+
 	return s.back.Save(user)
 }
 
@@ -109,16 +162,16 @@ func (s *Storage) Delete(id interface{}) error {
 			return err
 		}
 		if user.ID == 1 {
-			return errors.ErrRootUserDeletion
+			return fbErrors.ErrRootUserDeletion
 		}
 		return s.back.DeleteByUsername(id)
 	case uint:
 		if id == 1 {
-			return errors.ErrRootUserDeletion
+			return fbErrors.ErrRootUserDeletion
 		}
 		return s.back.DeleteByID(id)
 	default:
-		return errors.ErrInvalidDataType
+		return fbErrors.ErrInvalidDataType
 	}
 }
 
@@ -131,3 +184,49 @@ func (s *Storage) LastUpdate(id uint) int64 {
 	}
 	return 0
 }
+
+// resolve sets the permissions of a user of a role to the ones of the
+// role with the overrides of the user. The users of a deleted role keep
+// their last permissions.
+func (s *Storage) resolve(user *User) error {
+	if user.Role == 0 || s.roles == nil {
+		return nil
+	}
+
+	role, err := s.roles.Get(user.Role)
+	if errors.Is(err, fbErrors.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	user.Perm = role.Perm.Override(user.PermOverrides)
+	return nil
+}
+
+// overrides keeps the permissions of a user that differ from the ones of
+// its role, so that the other ones follow the role.
+func (s *Storage) overrides(user *User) error {
+	if user.Role == 0 || s.roles == nil {
+		user.PermOverrides = nil
+		return nil
+	}
+
+	role, err := s.roles.Get(user.Role)
+	if err != nil {
+		return err
+	}
+
+	user.PermOverrides = user.Perm.Overrides(role.Perm)
+	return nil
+}
+
+func contains(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,318 @@
+package users
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+
+	fbErrors "github.com/filebrowser/filebrowser/v2/errors"
+)
+
+// The policies of the symlinks of the scopes. Without any, the symlinks are
+// followed wherever they point.
+const (
+	// SymlinkDeny hides the symlinks, and refuses the paths through them.
+	SymlinkDeny = "deny"
+	// SymlinkFollowWithinScope follows the symlinks whose target is in the
+	// scope, the other ones being hidden and refused.
+	SymlinkFollowWithinScope = "follow-within-scope"
+	// SymlinkShowAsLink lists the symlinks without following them.
+	SymlinkShowAsLink = "show-as-link"
+)
+
+// maxSymlinks is how many symlinks are followed to resolve a path.
+const maxSymlinks = 255
+
+var errTooManySymlinks = errors.New("too many levels of symbolic links")
+
+// ValidateSymlinkPolicy returns an error if the policy isn't one of the
+// symlink policies, or empty.
+func ValidateSymlinkPolicy(policy string) error {
+	switch policy {
+	case "", SymlinkDeny, SymlinkFollowWithinScope, SymlinkShowAsLink:
+		return nil
+	default:
+		return fbErrors.ErrInvalidOption
+	}
+}
+
+// symlinkFs is the local file system of a scope enforcing a symlink policy.
+// Its paths are the real ones, under the base path of the user.
+type symlinkFs struct {
+	afero.Fs
+	root   string
+	policy string
+}
+
+// newSymlinkFs returns the local file system of the scope at root, with the
+// symlink policy.
+func newSymlinkFs(root, policy string) *symlinkFs {
+	return &symlinkFs{Fs: afero.NewOsFs(), root: filepath.Clean(root), policy: policy}
+}
+
+// check returns a permission error if the path can't be used with the
+// policy. If link is true, the operation is on the file itself, which can be
+// a symlink, instead of on what it points to.
+func (fs *symlinkFs) check(op, name string, link bool) error {
+	var allowed bool
+	switch fs.policy {
+	case SymlinkFollowWithinScope:
+		if link {
+			name = filepath.Dir(name)
+		}
+		real, err := resolveSymlinks(name)
+		if err != nil {
+			return err
+		}
+		root, err := resolveSymlinks(fs.root)
+		if err != nil {
+			return err
+		}
+		allowed = within(root, real)
+	case SymlinkDeny, SymlinkShowAsLink:
+		links, err := fs.links(name)
+		if err != nil {
+			return err
+		}
+		allowed = links == 0 || fs.policy == SymlinkShowAsLink && link && links == 1 && isSymlink(name)
+	default:
+		allowed = true
+	}
+
+	if !allowed {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrPermission}
+	}
+	return nil
+}
+
+// links returns how many of the existing files of a path under the root
+// are symlinks.
+func (fs *symlinkFs) links(name string) (int, error) {
+	rel, err := filepath.Rel(fs.root, name)
+	if err != nil || !within(fs.root, name) {
+		return 0, &os.PathError{Op: "stat", Path: name, Err: os.ErrPermission}
+	}
+	if rel == "." {
+		return 0, nil
+	}
+
+	links := 0
+	p := fs.root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		p = filepath.Join(p, part)
+		info, err := os.Lstat(p)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			links++
+		}
+	}
+	return links, nil
+}
+
+// listed tells if a file of a listing is shown with the policy.
+func (fs *symlinkFs) listed(name string, info os.FileInfo) bool {
+	if info.Mode()&os.ModeSymlink == 0 {
+		return true
+	}
+	switch fs.policy {
+	case SymlinkDeny:
+		return false
+	case SymlinkFollowWithinScope:
+		return fs.check("stat", name, false) == nil
+	default:
+		return true
+	}
+}
+
+func isSymlink(name string) bool {
+	info, err := os.Lstat(name)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// within tells if a path is the root or under it.
+func within(root, name string) bool {
+	rel, err := filepath.Rel(root, name)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolveSymlinks returns the real path of a file, the files that don't
+// exist being resolved from their deepest existing parent. The dangling
+// symlinks are resolved to where they point, where the files are created.
+func resolveSymlinks(name string) (string, error) {
+	rest := ""
+	for i := 0; i < maxSymlinks; i++ {
+		real, err := filepath.EvalSymlinks(name)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+
+		if isSymlink(name) {
+			target, err := os.Readlink(name)
+			if err != nil {
+				return "", err
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(name), target)
+			}
+			name = target
+			continue
+		}
+
+		parent := filepath.Dir(name)
+		if parent == name {
+			return filepath.Join(name, rest), nil
+		}
+		rest = filepath.Join(filepath.Base(name), rest)
+		name = parent
+	}
+	return "", errTooManySymlinks
+}
+
+func (fs *symlinkFs) Create(name string) (afero.File, error) {
+	if err := fs.check("open", name, false); err != nil {
+		return nil, err
+	}
+	return fs.Fs.Create(name)
+}
+
+func (fs *symlinkFs) Mkdir(name string, perm os.FileMode) error {
+	if err := fs.check("mkdir", name, false); err != nil {
+		return err
+	}
+	return fs.Fs.Mkdir(name, perm)
+}
+
+func (fs *symlinkFs) MkdirAll(name string, perm os.FileMode) error {
+	if err := fs.check("mkdir", name, false); err != nil {
+		return err
+	}
+	return fs.Fs.MkdirAll(name, perm)
+}
+
+func (fs *symlinkFs) Open(name string) (afero.File, error) {
+	if err := fs.check("open", name, false); err != nil {
+		return nil, err
+	}
+	file, err := fs.Fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &symlinkFile{File: file, fs: fs, name: name}, nil
+}
+
+func (fs *symlinkFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if err := fs.check("open", name, false); err != nil {
+		return nil, err
+	}
+	file, err := fs.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &symlinkFile{File: file, fs: fs, name: name}, nil
+}
+
+func (fs *symlinkFs) Remove(name string) error {
+	if err := fs.check("remove", name, true); err != nil {
+		return err
+	}
+	return fs.Fs.Remove(name)
+}
+
+func (fs *symlinkFs) RemoveAll(name string) error {
+	if err := fs.check("remove", name, true); err != nil {
+		return err
+	}
+	return fs.Fs.RemoveAll(name)
+}
+
+func (fs *symlinkFs) Rename(oldname, newname string) error {
+	if err := fs.check("rename", oldname, true); err != nil {
+		return err
+	}
+	if err := fs.check("rename", newname, true); err != nil {
+		return err
+	}
+	return fs.Fs.Rename(oldname, newname)
+}
+
+func (fs *symlinkFs) Stat(name string) (os.FileInfo, error) {
+	if err := fs.check("stat", name, false); err != nil {
+		return nil, err
+	}
+	return fs.Fs.Stat(name)
+}
+
+// LstatIfPossible implements afero.Lstater.
+func (fs *symlinkFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if err := fs.check("lstat", name, true); err != nil {
+		return nil, true, err
+	}
+	info, err := os.Lstat(name)
+	return info, true, err
+}
+
+func (fs *symlinkFs) Chmod(name string, mode os.FileMode) error {
+	if err := fs.check("chmod", name, false); err != nil {
+		return err
+	}
+	return fs.Fs.Chmod(name, mode)
+}
+
+func (fs *symlinkFs) Chown(name string, uid, gid int) error {
+	if err := fs.check("chown", name, false); err != nil {
+		return err
+	}
+	return fs.Fs.Chown(name, uid, gid)
+}
+
+func (fs *symlinkFs) Chtimes(name string, atime, mtime time.Time) error {
+	if err := fs.check("chtimes", name, false); err != nil {
+		return err
+	}
+	return fs.Fs.Chtimes(name, atime, mtime)
+}
+
+// symlinkFile is a file of a symlinkFs, whose listings leave out the
+// symlinks the policy hides.
+type symlinkFile struct {
+	afero.File
+	fs   *symlinkFs
+	name string
+}
+
+func (f *symlinkFile) Readdir(count int) ([]os.FileInfo, error) {
+	for {
+		infos, err := f.File.Readdir(count)
+		listed := infos[:0]
+		for _, info := range infos {
+			if f.fs.listed(filepath.Join(f.name, info.Name()), info) {
+				listed = append(listed, info)
+			}
+		}
+		// the files of a count are read until one is listed
+		if len(listed) > 0 || len(infos) == 0 || err != nil || count <= 0 {
+			return listed, err
+		}
+	}
+}
+
+func (f *symlinkFile) Readdirnames(count int) ([]string, error) {
+	infos, err := f.Readdir(count)
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+	}
+	return names, err
+}
@@ -0,0 +1,147 @@
+package users
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestSymlinkPolicies(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"scope/dir", "outside"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"scope/file.txt", "scope/dir/inner.txt", "outside/secret.txt"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil { //nolint:gosec
+			t.Fatal(err)
+		}
+	}
+	for name, target := range map[string]string{
+		"in":       "dir",
+		"up":       "../outside",
+		"abs":      filepath.Join(root, "outside/secret.txt"),
+		"dangling": filepath.Join(root, "outside/new.txt"),
+	} {
+		if err := os.Symlink(target, filepath.Join(root, "scope", name)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	for _, tc := range []struct {
+		policy  string
+		allowed []string
+		denied  []string
+		listing string
+	}{
+		{
+			policy:  "",
+			allowed: []string{"/file.txt", "/in/inner.txt", "/up/secret.txt", "/abs"},
+			listing: "abs dangling dir file.txt in up",
+		},
+		{
+			policy:  SymlinkDeny,
+			allowed: []string{"/file.txt", "/dir/inner.txt"},
+			denied:  []string{"/in", "/in/inner.txt", "/up/secret.txt", "/abs"},
+			listing: "dir file.txt",
+		},
+		{
+			policy:  SymlinkFollowWithinScope,
+			allowed: []string{"/file.txt", "/in", "/in/inner.txt"},
+			denied:  []string{"/up", "/up/secret.txt", "/abs", "/dangling"},
+			listing: "dir file.txt in",
+		},
+		{
+			policy:  SymlinkShowAsLink,
+			allowed: []string{"/file.txt", "/dir/inner.txt"},
+			denied:  []string{"/in", "/in/inner.txt", "/up/secret.txt", "/abs"},
+			listing: "abs dangling dir file.txt in up",
+		},
+	} {
+		u := &User{Username: "user", Scope: "/scope", symlinkPolicy: tc.policy}
+		if err := u.Clean(root, "Scope"); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range tc.allowed {
+			if _, err := u.Fs.Stat(name); err != nil {
+				t.Errorf("%q: expected %s to be allowed, got %v", tc.policy, name, err)
+			}
+		}
+		for _, name := range tc.denied {
+			if _, err := u.Fs.Stat(name); !errors.Is(err, os.ErrPermission) {
+				t.Errorf("%q: expected %s to be denied, got %v", tc.policy, name, err)
+			}
+			if f, err := u.Fs.Open(name); !errors.Is(err, os.ErrPermission) {
+				if err == nil {
+					f.Close()
+				}
+				t.Errorf("%q: expected %s not to open, got %v", tc.policy, name, err)
+			}
+		}
+
+		infos, err := afero.ReadDir(u.Fs, "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		sort.Strings(names)
+		if got := strings.Join(names, " "); got != tc.listing {
+			t.Errorf("%q: expected the listing %q, got %q", tc.policy, tc.listing, got)
+		}
+	}
+
+	// the files aren't created through the links leaving the scope
+	u := &User{Username: "user", Scope: "/scope", symlinkPolicy: SymlinkFollowWithinScope}
+	if err := u.Clean(root, "Scope"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Fs.Create("/dangling"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected the dangling link not to be written, got %v", err)
+	}
+	if err := u.Fs.MkdirAll("/up/dir", 0755); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected no directory to be created outside, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "outside/new.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no file outside the scope, got %v", err)
+	}
+	if err := afero.WriteFile(u.Fs, "/in/new.txt", []byte("new"), 0644); err != nil {
+		t.Errorf("expected the link inside the scope to be written, got %v", err)
+	}
+
+	// the links themselves can be shown and removed
+	u = &User{Username: "user", Scope: "/scope", symlinkPolicy: SymlinkShowAsLink}
+	if err := u.Clean(root, "Scope"); err != nil {
+		t.Fatal(err)
+	}
+	info, _, err := u.Fs.(afero.Lstater).LstatIfPossible("/abs")
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected the link to be shown, got %v", err)
+	}
+	if err := u.Fs.Remove("/up"); err != nil {
+		t.Errorf("expected the link to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "outside/secret.txt")); err != nil {
+		t.Errorf("expected the target to be kept, got %v", err)
+	}
+}
+
+func TestValidateSymlinkPolicy(t *testing.T) {
+	for _, policy := range []string{"", SymlinkDeny, SymlinkFollowWithinScope, SymlinkShowAsLink} {
+		if err := ValidateSymlinkPolicy(policy); err != nil {
+			t.Errorf("expected %q to be valid, got %v", policy, err)
+		}
+	}
+	if err := ValidateSymlinkPolicy("follow"); err == nil {
+		t.Error("expected an unknown policy to be refused")
+	}
+}
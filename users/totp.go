@@ -0,0 +1,201 @@
+package users
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// TOTPPeriod is how long a code is valid.
+	TOTPPeriod = 30 * time.Second
+	// TOTPDigits is the length of the codes.
+	TOTPDigits = 6
+	// TOTPSkew is how many periods before and after the current one are
+	// accepted, for the clocks that drift.
+	TOTPSkew = 1
+	// RecoveryCodes is how many recovery codes are generated.
+	RecoveryCodes = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTP is the second factor of a user, as time-based one-time passwords
+// (RFC 6238).
+type TOTP struct {
+	// Secret is the shared secret, encrypted with the key of the settings.
+	Secret string `json:"secret,omitempty"`
+	// Enabled is set once the user confirmed the enrollment with a code.
+	Enabled bool `json:"enabled"`
+	// LastStep is the time step of the last accepted code, which can't be
+	// used again.
+	LastStep int64 `json:"lastStep,omitempty"`
+	// RecoveryCodes are the hashes of the unused recovery codes.
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+}
+
+// NewTOTPSecret generates a base32 encoded secret.
+func NewTOTPSecret() (string, error) {
+	b := make([]byte, 20) //nolint:gomnd
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPURI returns the provisioning URI of a secret, to be shown as a QR code
+// to the authenticator apps.
+func TOTPURI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(TOTPDigits))
+	query.Set("period", fmt.Sprint(int(TOTPPeriod.Seconds())))
+
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// TOTPCode returns the code of a secret for the time step of t.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	return totpCode(secret, t.Unix()/int64(TOTPPeriod.Seconds()))
+}
+
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha1.New, key)
+	_ = binary.Write(mac, binary.BigEndian, step)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f                            //nolint:gomnd
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff //nolint:gomnd
+
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod), nil
+}
+
+// CheckTOTP checks a code against a secret at the time t, returning the
+// time step it belongs to.
+func CheckTOTP(secret, code string, t time.Time) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+
+	current := t.Unix() / int64(TOTPPeriod.Seconds())
+	for step := current - TOTPSkew; step <= current+TOTPSkew; step++ {
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// EncryptTOTPSecret encrypts a secret with a key, such as the one of the
+// settings, so that it isn't stored in clear.
+func EncryptTOTPSecret(key []byte, secret string) (string, error) {
+	gcm, err := totpCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptTOTPSecret decrypts a secret encrypted by EncryptTOTPSecret.
+func DecryptTOTPSecret(key []byte, encrypted string) (string, error) {
+	gcm, err := totpCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("invalid encrypted secret")
+	}
+
+	secret, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+func totpCipher(key []byte) (cipher.AEAD, error) {
+	sum := sha256.Sum256(append([]byte("totp\x00"), key...))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// NewRecoveryCodes generates the recovery codes of a user, returning them
+// and the hashes to store.
+func NewRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < RecoveryCodes; i++ {
+		b := make([]byte, 5) //nolint:gomnd
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(totpEncoding.EncodeToString(b))
+		code = code[:4] + "-" + code[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// UseRecoveryCode removes a recovery code, returning whether it was valid.
+func (t *TOTP) UseRecoveryCode(code string) bool {
+	hash := hashRecoveryCode(code)
+	for i, h := range t.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			t.RecoveryCodes = append(t.RecoveryCodes[:i], t.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// the recovery codes are random enough for a fast hash
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,77 @@
+package users
+
+import (
+	"testing"
+	"time"
+)
+
+// the secret of the test vectors of RFC 6238, in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	tests := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		2000000000: "279037",
+	}
+
+	for unix, want := range tests {
+		code, err := TOTPCode(rfcSecret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != want {
+			t.Errorf("expected %s at %d, got %s", want, unix, code)
+		}
+	}
+}
+
+func TestCheckTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+
+	previous, _ := TOTPCode(rfcSecret, now.Add(-TOTPPeriod))
+	if step, ok := CheckTOTP(rfcSecret, previous, now); !ok || step != now.Unix()/30-1 {
+		t.Errorf("expected the code of the previous period to be accepted, got %d and %t", step, ok)
+	}
+
+	old, _ := TOTPCode(rfcSecret, now.Add(-3*TOTPPeriod))
+	if _, ok := CheckTOTP(rfcSecret, old, now); ok {
+		t.Error("expected an old code to be rejected")
+	}
+}
+
+func TestTOTPSecretEncryption(t *testing.T) {
+	key := []byte("key")
+
+	encrypted, err := EncryptTOTPSecret(key, rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := DecryptTOTPSecret(key, encrypted)
+	if err != nil || secret != rfcSecret {
+		t.Errorf("expected the secret back, got %q and %v", secret, err)
+	}
+
+	if _, err := DecryptTOTPSecret([]byte("other"), encrypted); err == nil {
+		t.Error("expected another key to fail")
+	}
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	totp := TOTP{RecoveryCodes: hashes}
+	if !totp.UseRecoveryCode(codes[3]) {
+		t.Fatal("expected the recovery code to be valid")
+	}
+	if totp.UseRecoveryCode(codes[3]) {
+		t.Error("expected the recovery code to be used once")
+	}
+	if len(totp.RecoveryCodes) != RecoveryCodes-1 {
+		t.Errorf("expected %d codes left, got %d", RecoveryCodes-1, len(totp.RecoveryCodes))
+	}
+}
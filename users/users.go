@@ -1,14 +1,18 @@
 package users
 
 import (
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/spf13/afero"
 
 	"github.com/filebrowser/filebrowser/v2/errors"
 	"github.com/filebrowser/filebrowser/v2/files"
 	"github.com/filebrowser/filebrowser/v2/rules"
+	"github.com/filebrowser/filebrowser/v2/s3fs"
 )
 
 // ViewMode describes a view mode.
@@ -36,6 +40,99 @@ type User struct {
 	Rules        []rules.Rule  `json:"rules"`
 	HideDotfiles bool          `json:"hideDotfiles"`
 	DateFormat   bool          `json:"dateFormat"`
+	// Hooks override the global hook commands by event for this user.
+	Hooks map[string]EventHooks `json:"hooks"`
+	// Passkeys are the WebAuthn credentials the user can log in with, see
+	// auth.WebAuthnAuth.
+	Passkeys []Passkey `json:"passkeys"`
+	// TOTP is the second factor of the user, see auth.JSONAuth.
+	TOTP TOTP `json:"totp"`
+	// Quota is how many bytes the user can store, without limit if zero.
+	// It is checked by the uploads and the copies.
+	Quota int64 `json:"quota"`
+	// MaxUploadSize overrides the maximum size of the files the user can
+	// upload of the settings. Zero uses the one of the settings, and a
+	// negative size means no limit.
+	MaxUploadSize int64 `json:"maxUploadSize"`
+	// TokenVersion is in the tokens of the user, bumping it revokes all of
+	// them.
+	TokenVersion uint `json:"tokenVersion"`
+	// Role is the ID of the role the permissions come from, none if zero.
+	Role uint `json:"role"`
+	// PermOverrides are the permissions of the user that differ from the
+	// ones of its role, kept when the user is saved with its Perm.
+	PermOverrides map[string]bool `json:"permOverrides"`
+	// Versions is how many of the previous contents of the files the user
+	// overwrites are kept, and for how long.
+	Versions Versioning `json:"versions"`
+	// SharedFolders are the directories of the scope the other users can
+	// transfer files from and to.
+	SharedFolders []SharedFolder `json:"sharedFolders"`
+	// Trash moves the files the user deletes to a trash they can be
+	// restored from, until they're purged.
+	Trash Trash `json:"trash"`
+	// OIDCSubject is the issuer and the subject of the OpenID Connect
+	// identity the user logs in with, see auth.OIDCAuth.
+	OIDCSubject string `json:"oidcSubject,omitempty"`
+
+	// symlinkPolicy is the policy the local file system of the user is
+	// built with, set by the storage from the settings.
+	symlinkPolicy string
+}
+
+// Trash is the trash of the deleted files of a scope.
+type Trash struct {
+	Enabled bool `json:"enabled"`
+	// Days is how long the deleted files are kept for before they're
+	// purged, without limit if zero.
+	Days int `json:"days"`
+}
+
+// SharedFolder is a directory of the scope of a user shared with others.
+type SharedFolder struct {
+	Path string `json:"path"`
+	// Users are the IDs of the users it's shared with.
+	Users []uint `json:"users"`
+	// Write lets them put files in it, not only take them out of it.
+	Write bool `json:"write"`
+}
+
+// SharedWith tells if a path of the scope of the user is in a folder shared
+// with another user, with write access if needed.
+func (u *User) SharedWith(userID uint, p string, write bool) bool {
+	p = path.Clean("/" + p)
+	for _, folder := range u.SharedFolders {
+		dir := path.Clean("/" + folder.Path)
+		if p != dir && !strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/") {
+			continue
+		}
+		if (folder.Write || !write) && slices.Contains(folder.Users, userID) {
+			return true
+		}
+	}
+	return false
+}
+
+// Versioning is the retention of the versions of the files of a scope. The
+// files have no versions if both are zero.
+type Versioning struct {
+	// Count is how many versions of a file are kept, without limit if zero.
+	Count int `json:"count"`
+	// Days is how long the versions are kept for, without limit if zero.
+	Days int `json:"days"`
+}
+
+// Enabled tells if the versions of the files are kept.
+func (v Versioning) Enabled() bool {
+	return v.Count > 0 || v.Days > 0
+}
+
+// EventHooks are the hook commands of a user for an event.
+type EventHooks struct {
+	Commands []string `json:"commands"`
+	// Append makes the commands run after the global ones instead of
+	// replacing them.
+	Append bool `json:"append"`
 }
 
 // GetRules implements rules.Provider.
@@ -51,6 +148,8 @@ var checkableFields = []string{
 	"Commands",
 	"Sorting",
 	"Rules",
+	"Hooks",
+	"SharedFolders",
 }
 
 // Clean cleans up a user and verifies if all its fields
@@ -88,18 +187,48 @@ func (u *User) Clean(baseScope string, fields ...string) error {
 			if u.Rules == nil {
 				u.Rules = []rules.Rule{}
 			}
+		case "Hooks":
+			if u.Hooks == nil {
+				u.Hooks = map[string]EventHooks{}
+			}
+		case "SharedFolders":
+			if u.SharedFolders == nil {
+				u.SharedFolders = []SharedFolder{}
+			}
+			for i := range u.SharedFolders {
+				u.SharedFolders[i].Path = path.Clean("/" + u.SharedFolders[i].Path)
+			}
 		}
 	}
 
 	if u.Fs == nil {
+		fs, root, err := RootFs(baseScope)
+		if err != nil {
+			return err
+		}
 		scope := u.Scope
-		scope = filepath.Join(baseScope, filepath.Join("/", scope)) //nolint:gocritic
-		u.Fs = afero.NewBasePathFs(afero.NewOsFs(), scope)
+		scope = filepath.Join(root, filepath.Join("/", scope)) //nolint:gocritic
+		if u.symlinkPolicy != "" && !s3fs.IsURL(baseScope) {
+			fs = newSymlinkFs(scope, u.symlinkPolicy)
+		}
+		u.Fs = afero.NewBasePathFs(fs, scope)
 	}
 
 	return nil
 }
 
+// RootFs returns the file system of the root of the server, the local one
+// or the bucket of an s3:// URL, and the path of the root in it. The paths
+// in a bucket are the ones under its prefix, which are also the paths the
+// hooks get.
+func RootFs(root string) (afero.Fs, string, error) {
+	if s3fs.IsURL(root) {
+		fs, err := s3fs.NewFromURL(root)
+		return fs, "/", err
+	}
+	return afero.NewOsFs(), root, nil
+}
+
 // FullPath gets the full path for a user's relative path.
 func (u *User) FullPath(path string) string {
 	return afero.FullBaseFsPath(u.Fs.(*afero.BasePathFs), path)
@@ -0,0 +1,30 @@
+package users
+
+import "testing"
+
+func TestSharedWith(t *testing.T) {
+	u := &User{SharedFolders: []SharedFolder{
+		{Path: "/shared", Users: []uint{2}, Write: true},
+		{Path: "/read/", Users: []uint{2, 3}},
+	}}
+
+	for _, tc := range []struct {
+		user  uint
+		path  string
+		write bool
+		want  bool
+	}{
+		{2, "/shared", true, true},
+		{2, "shared/a/b.txt", true, true},
+		{2, "/shared-old/a.txt", false, false},
+		{2, "/read/a.txt", false, true},
+		{2, "/read/a.txt", true, false},
+		{3, "/read", false, true},
+		{3, "/shared/a.txt", false, false},
+		{2, "/a.txt", false, false},
+	} {
+		if got := u.SharedWith(tc.user, tc.path, tc.write); got != tc.want {
+			t.Errorf("SharedWith(%d, %q, %t) = %t, want %t", tc.user, tc.path, tc.write, got, tc.want)
+		}
+	}
+}